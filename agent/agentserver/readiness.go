@@ -0,0 +1,130 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// Readiness describes whether an image is fully cached on the agent.
+type Readiness struct {
+	Ready    bool          `json:"ready"`
+	Manifest core.Digest   `json:"manifest"`
+	Missing  []core.Digest `json:"missing"`
+}
+
+// readinessTagHandler reports whether the image of a tag is fully cached,
+// returning 200 if it is and 503 otherwise, such that it can be used as an
+// http readiness probe. Response model Readiness.
+func (s *Server) readinessTagHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	d, err := s.tags.Get(tag)
+	if err != nil {
+		if err == tagclient.ErrTagNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("get tag: %s", err)
+	}
+	return s.writeReadiness(w, d)
+}
+
+// readinessBlobHandler reports whether the image of a manifest digest is fully
+// cached. See readinessTagHandler.
+func (s *Server) readinessBlobHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := parseDigest(r)
+	if err != nil {
+		return err
+	}
+	return s.writeReadiness(w, d)
+}
+
+func (s *Server) writeReadiness(w http.ResponseWriter, manifest core.Digest) error {
+	rd, err := s.readiness(manifest)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !rd.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(rd); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// bootstrapHandler reports the progress of bootstrapping the standard set of
+// images, returning 200 once bootstrap is done and 503 before, such that it can
+// be used as an http readiness probe for new hosts. Response model
+// bootstrap.Progress. Returns 404 if bootstrap is disabled.
+func (s *Server) bootstrapHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.bootstrapper == nil {
+		return handler.Errorf("bootstrap not enabled").Status(http.StatusNotFound)
+	}
+	p := s.bootstrapper.Progress()
+	w.Header().Set("Content-Type", "application/json")
+	if !p.Done {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// readiness checks whether manifest and every blob it references are in the
+// cache. Blobs referenced by the manifest are only known once the manifest
+// itself is cached.
+func (s *Server) readiness(manifest core.Digest) (Readiness, error) {
+	rd := Readiness{Manifest: manifest, Missing: []core.Digest{}}
+	f, err := s.cads.Cache().GetFileReader(manifest.Hex())
+	if err != nil {
+		if os.IsNotExist(err) {
+			rd.Missing = append(rd.Missing, manifest)
+			return rd, nil
+		}
+		return rd, handler.Errorf("store: %s", err)
+	}
+	defer f.Close()
+	m, _, err := dockerutil.ParseManifestV2(f)
+	if err != nil {
+		return rd, handler.Errorf("parse manifest: %s", err)
+	}
+	refs, err := dockerutil.GetManifestReferences(m)
+	if err != nil {
+		return rd, handler.Errorf("get manifest references: %s", err)
+	}
+	for _, d := range refs {
+		if _, err := s.cads.Cache().GetFileStat(d.Hex()); err != nil {
+			if os.IsNotExist(err) {
+				rd.Missing = append(rd.Missing, d)
+				continue
+			}
+			return rd, handler.Errorf("store: %s", err)
+		}
+	}
+	rd.Ready = len(rd.Missing) == 0
+	return rd, nil
+}
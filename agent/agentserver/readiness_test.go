@@ -0,0 +1,130 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getReadiness(t *testing.T, u string) (int, Readiness) {
+	t.Helper()
+
+	resp, err := http.Get(u)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var rd Readiness
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rd))
+	return resp.StatusCode, rd
+}
+
+func TestReadinessTag(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	tag := core.TagFixture()
+	config := core.NewBlobFixture()
+	layer1 := core.NewBlobFixture()
+	layer2 := core.NewBlobFixture()
+	manifest, raw := dockerutil.ManifestFixture(config.Digest, layer1.Digest, layer2.Digest)
+
+	mocks.tags.EXPECT().Get(tag).Return(manifest, nil).Times(3)
+
+	addr := mocks.startServer()
+	u := fmt.Sprintf("http://%s/readiness/tags/%s", addr, url.PathEscape(tag))
+
+	status, rd := getReadiness(t, u)
+	require.Equal(http.StatusServiceUnavailable, status)
+	require.False(rd.Ready)
+	require.Equal([]core.Digest{manifest}, rd.Missing)
+
+	require.NoError(store.RunDownload(mocks.cads, manifest, raw))
+	require.NoError(store.RunDownload(mocks.cads, config.Digest, config.Content))
+
+	status, rd = getReadiness(t, u)
+	require.Equal(http.StatusServiceUnavailable, status)
+	require.False(rd.Ready)
+	require.ElementsMatch([]core.Digest{layer1.Digest, layer2.Digest}, rd.Missing)
+
+	require.NoError(store.RunDownload(mocks.cads, layer1.Digest, layer1.Content))
+	require.NoError(store.RunDownload(mocks.cads, layer2.Digest, layer2.Content))
+
+	status, rd = getReadiness(t, u)
+	require.Equal(http.StatusOK, status)
+	require.True(rd.Ready)
+	require.Empty(rd.Missing)
+}
+
+func TestReadinessBlob(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	config := core.NewBlobFixture()
+	layer1 := core.NewBlobFixture()
+	layer2 := core.NewBlobFixture()
+	manifest, raw := dockerutil.ManifestFixture(config.Digest, layer1.Digest, layer2.Digest)
+
+	for _, b := range []*core.BlobFixture{config, layer1, layer2} {
+		require.NoError(store.RunDownload(mocks.cads, b.Digest, b.Content))
+	}
+	require.NoError(store.RunDownload(mocks.cads, manifest, raw))
+
+	addr := mocks.startServer()
+
+	status, rd := getReadiness(t, fmt.Sprintf("http://%s/readiness/blobs/%s", addr, manifest))
+	require.Equal(http.StatusOK, status)
+	require.True(rd.Ready)
+	require.Equal(manifest, rd.Manifest)
+}
+
+func TestReadinessTagNotFound(t *testing.T) {
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	tag := core.TagFixture()
+
+	mocks.tags.EXPECT().Get(tag).Return(core.Digest{}, tagclient.ErrTagNotFound)
+
+	addr := mocks.startServer()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/readiness/tags/%s", addr, url.PathEscape(tag)))
+	require.True(t, httputil.IsNotFound(err))
+}
+
+func TestBootstrapNotEnabled(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr := mocks.startServer()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/bootstrap", addr))
+	require.True(httputil.IsNotFound(err))
+}
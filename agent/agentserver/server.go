@@ -23,12 +23,15 @@ import (
 	"os"
 	"strings"
 
+	"github.com/uber/kraken/agent/bootstrap"
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/dockerdaemon"
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
 
@@ -47,6 +50,23 @@ type Server struct {
 	sched     scheduler.ReloadableScheduler
 	tags      tagclient.Client
 	dockerCli dockerdaemon.DockerClient
+
+	bootstrapper *bootstrap.Bootstrapper // Nil if bootstrap is disabled.
+	metrics      http.Handler            // Nil if metrics are not scraped from s.
+}
+
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithBootstrapper reports the progress of b on /bootstrap.
+func WithBootstrapper(b *bootstrap.Bootstrapper) Option {
+	return func(s *Server) { s.bootstrapper = b }
+}
+
+// WithMetricsHandler configures the Server to serve metrics at /metrics using
+// h.
+func WithMetricsHandler(h http.Handler) Option {
+	return func(s *Server) { s.metrics = h }
 }
 
 // New creates a new Server.
@@ -56,13 +76,25 @@ func New(
 	cads *store.CADownloadStore,
 	sched scheduler.ReloadableScheduler,
 	tags tagclient.Client,
-	dockerCli dockerdaemon.DockerClient) *Server {
+	dockerCli dockerdaemon.DockerClient,
+	opts ...Option) *Server {
 
 	stats = stats.Tagged(map[string]string{
 		"module": "agentserver",
 	})
 
-	return &Server{config, stats, cads, sched, tags, dockerCli}
+	s := &Server{
+		config:    config,
+		stats:     stats,
+		cads:      cads,
+		sched:     sched,
+		tags:      tags,
+		dockerCli: dockerCli,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Handler returns the HTTP handler.
@@ -73,6 +105,9 @@ func (s *Server) Handler() http.Handler {
 	r.Use(middleware.LatencyTimer(s.stats))
 
 	r.Get("/health", handler.Wrap(s.healthHandler))
+	if s.metrics != nil {
+		r.Handle("/metrics", s.metrics)
+	}
 
 	r.Get("/tags/{tag}", handler.Wrap(s.getTagHandler))
 
@@ -83,10 +118,16 @@ func (s *Server) Handler() http.Handler {
 	// Preheat/preload endpoints.
 	r.Get("/preload/tags/{tag}", handler.Wrap(s.preloadTagHandler))
 
+	// Readiness endpoints for gating pods on pre-distributed images.
+	r.Get("/readiness/tags/{tag}", handler.Wrap(s.readinessTagHandler))
+	r.Get("/readiness/blobs/{digest}", handler.Wrap(s.readinessBlobHandler))
+	r.Get("/bootstrap", handler.Wrap(s.bootstrapHandler))
+
 	// Dangerous endpoint for running experiments.
 	r.Patch("/x/config/scheduler", handler.Wrap(s.patchSchedulerConfigHandler))
 
 	r.Get("/x/blacklist", handler.Wrap(s.getBlacklistHandler))
+	r.Get("/x/conns", handler.Wrap(s.getConnsHandler))
 
 	// Serves /debug/pprof endpoints.
 	r.Mount("/", http.DefaultServeMux)
@@ -94,13 +135,19 @@ func (s *Server) Handler() http.Handler {
 	return r
 }
 
-// getTagHandler proxies get tag requests to the build-index.
+// getTagHandler proxies get tag requests to the build-index, forwarding
+// consistency tokens.
 func (s *Server) getTagHandler(w http.ResponseWriter, r *http.Request) error {
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
 		return err
 	}
-	d, err := s.tags.Get(tag)
+	var d core.Digest
+	if token := r.Header.Get(tagmodels.ConsistencyTokenHeader); token != "" {
+		d, err = s.tags.GetConsistent(tag, token)
+	} else {
+		d, err = s.tags.Get(tag)
+	}
 	if err != nil {
 		if err == tagclient.ErrTagNotFound {
 			return handler.ErrorStatus(http.StatusNotFound)
@@ -205,6 +252,37 @@ func (s *Server) getBlacklistHandler(w http.ResponseWriter, r *http.Request) err
 	return nil
 }
 
+// getConnsHandler dumps active peer connections, including their most recent
+// messages if capture is enabled. Connections may be filtered by the infohash
+// query.
+func (s *Server) getConnsHandler(w http.ResponseWriter, r *http.Request) error {
+	var h *core.InfoHash
+	if raw := r.URL.Query().Get("infohash"); raw != "" {
+		parsed, err := core.NewInfoHashFromHex(raw)
+		if err != nil {
+			return handler.Errorf("parse infohash: %s", err).Status(http.StatusBadRequest)
+		}
+		h = &parsed
+	}
+	conns, err := s.sched.ConnSnapshot()
+	if err != nil {
+		return handler.Errorf("conn snapshot: %s", err)
+	}
+	if h != nil {
+		filtered := []conn.Snapshot{}
+		for _, c := range conns {
+			if c.InfoHash == *h {
+				filtered = append(filtered, c)
+			}
+		}
+		conns = filtered
+	}
+	if err := json.NewEncoder(w).Encode(&conns); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
 func parseDigest(r *http.Request) (core.Digest, error) {
 	raw, err := httputil.ParseParam(r, "digest")
 	if err != nil {
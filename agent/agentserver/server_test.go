@@ -20,15 +20,18 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"testing"
 	"time"
 
 	"github.com/uber/kraken/agent/agentclient"
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	mocktagclient "github.com/uber/kraken/mocks/build-index/tagclient"
 	mockdockerdaemon "github.com/uber/kraken/mocks/lib/dockerdaemon"
@@ -92,6 +95,27 @@ func TestGetTag(t *testing.T) {
 	require.Equal(d, result)
 }
 
+func TestGetTagForwardsConsistencyToken(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	tag := core.TagFixture()
+	d := core.DigestFixture()
+
+	mocks.tags.EXPECT().GetConsistent(tag, "some-token").Return(d, nil)
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/tags/%s", mocks.startServer(), url.PathEscape(tag)),
+		httputil.SendHeaders(map[string]string{tagmodels.ConsistencyTokenHeader: "some-token"}))
+	require.NoError(err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal(d.String(), string(b))
+}
+
 func TestGetTagNotFound(t *testing.T) {
 	require := require.New(t)
 
@@ -245,6 +269,57 @@ func TestGetBlacklistHandler(t *testing.T) {
 	require.Equal(blacklist, result)
 }
 
+func TestGetConnsHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	conns := []conn.Snapshot{{
+		PeerID:          core.PeerIDFixture(),
+		InfoHash:        core.InfoHashFixture(),
+		CreatedAt:       now,
+		LastSent:        now,
+		LastReceived:    now,
+		PendingRequests: 1,
+		Messages: []conn.CapturedMessage{{
+			Time:      now,
+			Direction: "sent",
+			Type:      "PIECE_REQUEST",
+			Index:     3,
+			Length:    1024,
+		}},
+	}, {
+		PeerID:       core.PeerIDFixture(),
+		InfoHash:     core.InfoHashFixture(),
+		CreatedAt:    now,
+		LastSent:     now,
+		LastReceived: now,
+	}}
+	mocks.sched.EXPECT().ConnSnapshot().Return(conns, nil).Times(2)
+
+	addr := mocks.startServer()
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/x/conns", addr))
+	require.NoError(err)
+
+	var result []conn.Snapshot
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(conns, result)
+
+	resp, err = httputil.Get(
+		fmt.Sprintf("http://%s/x/conns?infohash=%s", addr, conns[1].InfoHash.Hex()))
+	require.NoError(err)
+
+	result = nil
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(conns[1:], result)
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/x/conns?infohash=invalid", addr))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
+
 func TestDeleteBlobHandler(t *testing.T) {
 	require := require.New(t)
 
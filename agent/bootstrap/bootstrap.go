@@ -0,0 +1,246 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// Config defines Bootstrapper configuration.
+type Config struct {
+	// Tags is the standard set of images, e.g. "repo:tag", fetched as soon as
+	// the agent starts. Bootstrap is disabled if empty.
+	Tags []string `yaml:"tags"`
+
+	// Concurrency is the number of blobs downloaded at once.
+	Concurrency int `yaml:"concurrency"`
+
+	// Attempts is the number of times each image is tried before it is
+	// reported as failed.
+	Attempts int `yaml:"attempts"`
+
+	// RetryInterval is the wait between attempts of an image.
+	RetryInterval time.Duration `yaml:"retry_interval"`
+}
+
+func (c *Config) applyDefaults() {
+	if c.Concurrency == 0 {
+		c.Concurrency = 4
+	}
+	if c.Attempts == 0 {
+		c.Attempts = 3
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = 10 * time.Second
+	}
+}
+
+// Enabled returns whether bootstrap is configured.
+func (c Config) Enabled() bool {
+	return len(c.Tags) > 0
+}
+
+// Progress describes how far bootstrap got.
+type Progress struct {
+	// Done is set once every image was either fetched or failed.
+	Done bool `json:"done"`
+
+	Images     int `json:"images"`
+	ImagesDone int `json:"images_done"`
+
+	// Blobs only counts blobs of images whose manifest was fetched, and so
+	// grows as bootstrap proceeds.
+	Blobs     int `json:"blobs"`
+	BlobsDone int `json:"blobs_done"`
+
+	// Failed lists the tags which could not be fetched.
+	Failed []string `json:"failed"`
+}
+
+// Bootstrapper fetches the standard set of images onto a new agent. Blobs are
+// downloaded through p2p, such that they are served by the nearest peers which
+// already hold them, with origins only as a last resort.
+type Bootstrapper struct {
+	config     Config
+	stats      tally.Scope
+	transferer transfer.ImageTransferer
+	clk        clock.Clock
+
+	mu       sync.Mutex // Protects the following fields:
+	progress Progress
+	blobs    map[core.Digest]bool
+}
+
+// New creates a new Bootstrapper.
+func New(
+	config Config,
+	stats tally.Scope,
+	transferer transfer.ImageTransferer,
+	clk clock.Clock) *Bootstrapper {
+
+	config.applyDefaults()
+
+	stats = stats.Tagged(map[string]string{
+		"module": "bootstrap",
+	})
+
+	return &Bootstrapper{
+		config:     config,
+		stats:      stats,
+		transferer: transferer,
+		clk:        clk,
+		progress:   Progress{Images: len(config.Tags), Failed: []string{}},
+		blobs:      make(map[core.Digest]bool),
+	}
+}
+
+// Progress returns a snapshot of the bootstrap progress.
+func (b *Bootstrapper) Progress() Progress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p := b.progress
+	p.Failed = append([]string{}, b.progress.Failed...)
+	return p
+}
+
+// Run is a blocking call which fetches every configured image. Images already
+// cached are not downloaded again, so restarted agents finish quickly.
+func (b *Bootstrapper) Run() {
+	start := b.clk.Now()
+	log.Infof("Bootstrapping %d images", len(b.config.Tags))
+	for _, tag := range b.config.Tags {
+		var err error
+		for i := 0; i < b.config.Attempts; i++ {
+			if i > 0 {
+				b.clk.Sleep(b.config.RetryInterval)
+			}
+			if err = b.fetch(tag); err == nil {
+				break
+			}
+			log.With("tag", tag).Warnf("Error bootstrapping image: %s", err)
+		}
+		b.mu.Lock()
+		if err != nil {
+			b.progress.Failed = append(b.progress.Failed, tag)
+			b.stats.Counter("failed_images").Inc(1)
+		} else {
+			b.progress.ImagesDone++
+			b.stats.Counter("images").Inc(1)
+		}
+		b.mu.Unlock()
+	}
+	b.mu.Lock()
+	b.progress.Done = true
+	b.mu.Unlock()
+	b.stats.Timer("duration").Record(b.clk.Now().Sub(start))
+	log.Infof("Bootstrap finished in %s", b.clk.Now().Sub(start))
+}
+
+// fetch downloads the manifest of tag and every blob it references.
+func (b *Bootstrapper) fetch(tag string) error {
+	parts := strings.Split(tag, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid tag %q", tag)
+	}
+	repo := parts[0]
+	manifest, err := b.transferer.GetTag(tag)
+	if err != nil {
+		return fmt.Errorf("get tag: %s", err)
+	}
+	f, err := b.transferer.Download(repo, manifest)
+	if err != nil {
+		return fmt.Errorf("download manifest: %s", err)
+	}
+	defer f.Close()
+	m, _, err := dockerutil.ParseManifestV2(f)
+	if err != nil {
+		return fmt.Errorf("parse manifest: %s", err)
+	}
+	refs, err := dockerutil.GetManifestReferences(m)
+	if err != nil {
+		return fmt.Errorf("get manifest references: %s", err)
+	}
+	return b.download(repo, b.track(refs))
+}
+
+// track adds the blobs in refs which no earlier image referenced to the
+// progress, and returns them.
+func (b *Bootstrapper) track(refs []core.Digest) []core.Digest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var blobs []core.Digest
+	for _, d := range refs {
+		if !b.blobs[d] {
+			b.blobs[d] = true
+			blobs = append(blobs, d)
+		}
+	}
+	b.progress.Blobs += len(blobs)
+	return blobs
+}
+
+// download downloads blobs with up to Concurrency downloads at once, and
+// returns the first error. Blobs which failed are tracked again by the next
+// attempt.
+func (b *Bootstrapper) download(repo string, blobs []core.Digest) error {
+	sem := make(chan struct{}, b.config.Concurrency)
+	errs := make(chan error, len(blobs))
+	var wg sync.WaitGroup
+	for _, d := range blobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d core.Digest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs <- b.downloadBlob(repo, d)
+		}(d)
+	}
+	wg.Wait()
+	close(errs)
+	var first error
+	for err := range errs {
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (b *Bootstrapper) downloadBlob(repo string, d core.Digest) error {
+	f, err := b.transferer.Download(repo, d)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		delete(b.blobs, d)
+		b.progress.Blobs--
+		return fmt.Errorf("download blob %s: %s", d, err)
+	}
+	f.Close()
+	b.progress.BlobsDone++
+	b.stats.Counter("blobs").Inc(1)
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package bootstrap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/mocks/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/utils/dockerutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestBootstrapperFetchesImages(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	transferer := mocktransfer.NewMockImageTransferer(ctrl)
+
+	config := core.DigestFixture()
+	base := core.DigestFixture()
+	layer1 := core.DigestFixture()
+	layer2 := core.DigestFixture()
+	manifest1, raw1 := dockerutil.ManifestFixture(config, base, layer1)
+	manifest2, raw2 := dockerutil.ManifestFixture(config, base, layer2)
+
+	transferer.EXPECT().GetTag("repo:1").Return(manifest1, nil)
+	transferer.EXPECT().GetTag("repo:2").Return(manifest2, nil)
+	transferer.EXPECT().Download("repo", manifest1).Return(store.NewBufferFileReader(raw1), nil)
+	transferer.EXPECT().Download("repo", manifest2).Return(store.NewBufferFileReader(raw2), nil)
+
+	// Blobs shared by both images are only downloaded once.
+	for _, d := range []core.Digest{config, base, layer1, layer2} {
+		transferer.EXPECT().Download("repo", d).Return(store.NewBufferFileReader(nil), nil)
+	}
+
+	b := New(Config{Tags: []string{"repo:1", "repo:2"}}, tally.NoopScope, transferer, clock.New())
+	require.False(b.Progress().Done)
+
+	b.Run()
+
+	require.Equal(Progress{
+		Done:       true,
+		Images:     2,
+		ImagesDone: 2,
+		Blobs:      4,
+		BlobsDone:  4,
+		Failed:     []string{},
+	}, b.Progress())
+}
+
+func TestBootstrapperRetriesFailedImages(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	transferer := mocktransfer.NewMockImageTransferer(ctrl)
+
+	config := core.DigestFixture()
+	layer := core.DigestFixture()
+	manifest, raw := dockerutil.ManifestFixture(config, layer, layer)
+
+	transferer.EXPECT().GetTag("repo:ok").Return(manifest, nil).Times(2)
+	transferer.EXPECT().Download("repo", manifest).DoAndReturn(
+		func(string, core.Digest) (store.FileReader, error) {
+			return store.NewBufferFileReader(raw), nil
+		}).Times(2)
+	transferer.EXPECT().Download("repo", config).Return(store.NewBufferFileReader(nil), nil)
+	gomock.InOrder(
+		transferer.EXPECT().Download("repo", layer).Return(nil, errors.New("some error")),
+		transferer.EXPECT().Download("repo", layer).Return(store.NewBufferFileReader(nil), nil))
+
+	transferer.EXPECT().GetTag("repo:missing").Return(core.Digest{}, errors.New("some error")).Times(2)
+
+	b := New(Config{
+		Tags:          []string{"repo:ok", "repo:missing"},
+		Attempts:      2,
+		RetryInterval: time.Millisecond,
+	}, tally.NoopScope, transferer, clock.New())
+
+	b.Run()
+
+	require.Equal(Progress{
+		Done:       true,
+		Images:     2,
+		ImagesDone: 1,
+		Blobs:      2,
+		BlobsDone:  2,
+		Failed:     []string{"repo:missing"},
+	}, b.Progress())
+}
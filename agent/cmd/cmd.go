@@ -16,35 +16,56 @@ package cmd
 import (
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/uber/kraken/agent/agentserver"
+	"github.com/uber/kraken/agent/bootstrap"
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/dockerdaemon"
 	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/lib/kms"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/watchdog"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/fleet"
+	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/tracker/multitracker"
 	"github.com/uber/kraken/utils/configutil"
 	"github.com/uber/kraken/utils/log"
 	"github.com/uber/kraken/utils/netutil"
+	"github.com/uber/kraken/utils/osutil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
 
+// _peerPortAttempts is the number of ports tried when picking a free peer port
+// from the configured range.
+const _peerPortAttempts = 10
+
 // Flags defines agent CLI flags.
 type Flags struct {
 	PeerIP            string
+	PeerIPv6          string
+	PeerNetworks      string
+	PeerHostname      string
 	PeerPort          int
 	AgentServerPort   int
 	AgentRegistryPort int
 	ConfigFile        string
 	Zone              string
+	Rack              string
+	DC                string
 	KrakenCluster     string
 	SecretsFile       string
 }
@@ -54,8 +75,15 @@ func ParseFlags() *Flags {
 	var flags Flags
 	flag.StringVar(
 		&flags.PeerIP, "peer-ip", "", "ip which peer will announce itself as")
+	flag.StringVar(
+		&flags.PeerIPv6, "peer-ipv6", "", "optional ipv6 address which dual-stack peer will also announce")
+	flag.StringVar(
+		&flags.PeerNetworks, "peer-networks", "",
+		"optional comma separated label=ip pairs of additional networks which multi-homed peer will announce")
+	flag.StringVar(
+		&flags.PeerHostname, "peer-hostname", "", "optional hostname which peer will announce itself as")
 	flag.IntVar(
-		&flags.PeerPort, "peer-port", 0, "port which peer will announce itself as")
+		&flags.PeerPort, "peer-port", 0, "port which peer will announce itself as, picked from peer_port_range if 0")
 	flag.IntVar(
 		&flags.AgentServerPort, "agent-server-port", 0, "port which agent server listens on")
 	flag.IntVar(
@@ -64,6 +92,10 @@ func ParseFlags() *Flags {
 		&flags.ConfigFile, "config", "", "configuration file path")
 	flag.StringVar(
 		&flags.Zone, "zone", "", "zone/datacenter name")
+	flag.StringVar(
+		&flags.Rack, "rack", "", "optional rack name used by topology-aware trackers")
+	flag.StringVar(
+		&flags.DC, "dc", "", "optional datacenter name used by topology-aware trackers")
 	flag.StringVar(
 		&flags.KrakenCluster, "cluster", "", "cluster name (e.g. prod01-zone1)")
 	flag.StringVar(
@@ -99,9 +131,6 @@ func WithLogger(l *zap.Logger) Option {
 
 // Run runs the agent.
 func Run(flags *Flags, opts ...Option) {
-	if flags.PeerPort == 0 {
-		panic("must specify non-zero peer port")
-	}
 	if flags.AgentServerPort == 0 {
 		panic("must specify non-zero agent server port")
 	}
@@ -136,17 +165,53 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	stats := overrides.metrics
+	var metricsHandler http.Handler
 	if stats == nil {
-		s, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+		s, closer, h, err := metrics.NewWithHandler(config.Metrics, flags.KrakenCluster)
 		if err != nil {
 			log.Fatalf("Failed to init metrics: %s", err)
 		}
 		stats = s
+		metricsHandler = h
 		defer closer.Close()
 	}
 
+	// The peer listener is bound as soon as its port is picked, such that the
+	// port cannot be taken by another process before the scheduler starts.
+	var schedOpts []scheduler.AgentOption
+	if flags.PeerPort == 0 {
+		if config.PeerPortRange == "" {
+			panic("must specify non-zero peer port or peer port range")
+		}
+		r, err := netutil.ParsePortRange(config.PeerPortRange)
+		if err != nil {
+			log.Fatalf("Error parsing peer port range: %s", err)
+		}
+		l, err := netutil.ListenInRange(r, _peerPortAttempts)
+		if err != nil {
+			log.Fatalf("Error binding peer port: %s", err)
+		}
+		flags.PeerPort = l.Addr().(*net.TCPAddr).Port
+		schedOpts = append(schedOpts, scheduler.WithPeerListener(l))
+		log.Infof("Picked peer port %d from range %s", flags.PeerPort, r)
+	}
+
 	go metrics.EmitVersion(stats)
 
+	if config.Watchdog.Enabled {
+		w, err := watchdog.New(config.Watchdog, stats)
+		if err != nil {
+			log.Fatalf("Error creating watchdog: %s", err)
+		}
+		go w.Run()
+	}
+
+	if config.Debug.Enabled() {
+		go func() {
+			log.Fatal(debugserver.ListenAndServe(config.Debug, config))
+		}()
+	}
+
 	if flags.PeerIP == "" {
 		localIP, err := netutil.GetLocalIP()
 		if err != nil {
@@ -160,8 +225,50 @@ func Run(flags *Flags, opts ...Option) {
 	if err != nil {
 		log.Fatalf("Failed to create peer context: %s", err)
 	}
+	pctx.Hostname = flags.PeerHostname
+	pctx.Rack = flags.Rack
+	pctx.DC = flags.DC
+	if flags.PeerIPv6 != "" {
+		if core.AddressFamily(flags.PeerIPv6) != core.IPv6 {
+			log.Fatalf("Invalid peer ipv6 %q", flags.PeerIPv6)
+		}
+		pctx.IPv6 = flags.PeerIPv6
+	}
+	pctx.Networks, err = core.ParseNetworks(flags.PeerNetworks)
+	if err != nil {
+		log.Fatalf("Invalid peer networks: %s", err)
+	}
+
+	tls, err := config.TLS.BuildClient()
+	if err != nil {
+		log.Fatalf("Error building client tls config: %s", err)
+	}
+
+	var storeOpts []store.CADownloadStoreOption
+	if config.CADownloadStore.Encryption.Enabled {
+		host := pctx.Hostname
+		if host == "" {
+			host, err = os.Hostname()
+			if err != nil {
+				log.Fatalf("Error getting hostname: %s", err)
+			}
+		}
+		kmsClient, err := kms.NewClient(config.KMS, tls)
+		if err != nil {
+			log.Fatalf("Error creating kms client: %s", err)
+		}
+		key, err := kmsClient.GetDataKey(host)
+		if err != nil {
+			log.Fatalf("Error getting data key: %s", err)
+		}
+		cipher, err := store.NewCipher(key)
+		if err != nil {
+			log.Fatalf("Error creating cipher: %s", err)
+		}
+		storeOpts = append(storeOpts, store.WithCipher(cipher))
+	}
 
-	cads, err := store.NewCADownloadStore(config.CADownloadStore, stats)
+	cads, err := store.NewCADownloadStore(config.CADownloadStore, stats, storeOpts...)
 	if err != nil {
 		log.Fatalf("Failed to create local store: %s", err)
 	}
@@ -177,17 +284,47 @@ func Run(flags *Flags, opts ...Option) {
 	}
 	go trackers.Monitor(nil)
 
-	tls, err := config.TLS.BuildClient()
-	if err != nil {
-		log.Fatalf("Error building client tls config: %s", err)
+	if len(config.Trackers) > 0 {
+		additional, err := multitracker.Build(config.Trackers, tls)
+		if err != nil {
+			log.Fatalf("Error building additional trackers: %s", err)
+		}
+		for _, t := range additional {
+			log.Infof("Announcing matching namespaces to tracker %s", t.Name)
+			go t.Ring.Monitor(nil)
+		}
+		schedOpts = append(schedOpts, scheduler.WithTrackers(additional))
 	}
 
 	sched, err := scheduler.NewAgentScheduler(
-		config.Scheduler, stats, pctx, cads, netevents, trackers, tls)
+		config.Scheduler, stats, pctx, cads, netevents, trackers, tls, schedOpts...)
 	if err != nil {
 		log.Fatalf("Error creating scheduler: %s", err)
 	}
 
+	reporter := fleet.NewReporter(config.Fleet, fleet.NewClient(trackers, tls), func() (*fleet.Report, error) {
+		summary, err := sched.Summary()
+		if err != nil {
+			return nil, fmt.Errorf("scheduler summary: %s", err)
+		}
+		util, err := osutil.DiskUtilization(config.CADownloadStore.CacheDir)
+		if err != nil {
+			return nil, fmt.Errorf("cache utilization: %s", err)
+		}
+		return &fleet.Report{
+			PeerID:           pctx.PeerID,
+			IP:               pctx.IP,
+			Zone:             pctx.Zone,
+			Cluster:          pctx.Cluster,
+			Version:          os.Getenv("GIT_DESCRIBE"),
+			Protocol:         announceclient.CurrentProtocol,
+			CacheUtilization: util,
+			ActiveTorrents:   summary.ActiveTorrents,
+			DownloadErrors:   summary.DownloadErrors,
+		}, nil
+	})
+	go reporter.Run()
+
 	buildIndexes, err := config.BuildIndex.Build()
 	if err != nil {
 		log.Fatalf("Error building build-index upstream: %s", err)
@@ -195,7 +332,13 @@ func Run(flags *Flags, opts ...Option) {
 
 	tagClient := tagclient.NewClusterClient(buildIndexes, tls)
 
-	transferer := transfer.NewReadOnlyTransferer(stats, cads, tagClient, sched)
+	// Bundles are looked up from the default tracker cluster only.
+	bundles := metainfoclient.New(
+		trackers, tls, metainfoclient.WithBearerToken(config.Scheduler.TrackerBearerToken),
+	).(metainfoclient.BundleClient)
+
+	transferer := transfer.NewReadOnlyTransferer(
+		stats, cads, tagClient, sched, transfer.WithBundles(config.Bundles, bundles))
 
 	registry, err := config.Registry.Build(config.Registry.ReadOnlyParameters(transferer, cads, stats))
 	if err != nil {
@@ -208,8 +351,18 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("failed to init docker client for preload: %s", err)
 	}
 
+	var serverOpts []agentserver.Option
+	if metricsHandler != nil {
+		serverOpts = append(serverOpts, agentserver.WithMetricsHandler(metricsHandler))
+	}
+	if config.Bootstrap.Enabled() {
+		b := bootstrap.New(config.Bootstrap, stats, transferer, clock.New())
+		serverOpts = append(serverOpts, agentserver.WithBootstrapper(b))
+		go b.Run()
+	}
+
 	agentServer := agentserver.New(
-		config.AgentServer, stats, cads, sched, tagClient, dockerCli)
+		config.AgentServer, stats, cads, sched, tagClient, dockerCli, serverOpts...)
 	addr := fmt.Sprintf(":%d", flags.AgentServerPort)
 	log.Infof("Starting agent server on %s", addr)
 	go func() {
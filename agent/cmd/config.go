@@ -15,15 +15,22 @@ package cmd
 
 import (
 	"github.com/uber/kraken/agent/agentserver"
+	"github.com/uber/kraken/agent/bootstrap"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/dockerdaemon"
 	"github.com/uber/kraken/lib/dockerregistry"
+	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/lib/kms"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
 	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/lib/watchdog"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/tracker/fleet"
+	"github.com/uber/kraken/tracker/multitracker"
 	"github.com/uber/kraken/utils/httputil"
 
 	"go.uber.org/zap"
@@ -46,4 +53,22 @@ type Config struct {
 	TLS             httputil.TLSConfig             `yaml:"tls"`
 	AllowedCidrs    []string                       `yaml:"allowed_cidrs"`
 	DockerDaemon    dockerdaemon.Config            `yaml:"docker_daemon"`
+	Fleet           fleet.ReporterConfig           `yaml:"fleet"`
+	KMS             kms.Config                     `yaml:"kms"`
+	Watchdog        watchdog.Config                `yaml:"watchdog"`
+	Debug           debugserver.Config             `yaml:"debug"`
+	Bootstrap       bootstrap.Config               `yaml:"bootstrap"`
+
+	// Bundles downloads the small blobs of images as single torrents, if
+	// origins bundle them.
+	Bundles transfer.BundleConfig `yaml:"bundles"`
+
+	// Trackers are additional tracker clusters, which torrents of matching
+	// namespaces are announced to instead of Tracker. Allows hosts to serve
+	// several logical clusters.
+	Trackers []multitracker.Config `yaml:"trackers"`
+
+	// PeerPortRange is the range of ports, e.g. "16000-16999", the agent picks
+	// a free peer port from if no peer port flag is given.
+	PeerPortRange string `yaml:"peer_port_range"`
 }
@@ -15,12 +15,18 @@ package cmd
 
 import (
 	"flag"
+	"fmt"
+	"net/http"
+	"os"
 
+	"github.com/uber/kraken/build-index/contenttrust"
+	"github.com/uber/kraken/build-index/tagalias"
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/build-index/tagserver"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/persistedretry"
@@ -28,6 +34,7 @@ import (
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/lib/watchdog"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
@@ -120,17 +127,33 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	stats := overrides.metrics
+	var metricsHandler http.Handler
 	if stats == nil {
-		s, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+		s, closer, h, err := metrics.NewWithHandler(config.Metrics, flags.KrakenCluster)
 		if err != nil {
 			log.Fatalf("Failed to init metrics: %s", err)
 		}
 		stats = s
+		metricsHandler = h
 		defer closer.Close()
 	}
 
 	go metrics.EmitVersion(stats)
 
+	if config.Watchdog.Enabled {
+		w, err := watchdog.New(config.Watchdog, stats)
+		if err != nil {
+			log.Fatalf("Error creating watchdog: %s", err)
+		}
+		go w.Run()
+	}
+
+	if config.Debug.Enabled() {
+		go func() {
+			log.Fatal(debugserver.ListenAndServe(config.Debug, config))
+		}()
+	}
+
 	ss, err := store.NewSimpleStore(config.Store, stats)
 	if err != nil {
 		log.Fatalf("Error creating simple store: %s", err)
@@ -178,10 +201,15 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error building remotes from configuration: %s", err)
 	}
 
+	remoteProxies, err := config.RemoteProxies.Build()
+	if err != nil {
+		log.Fatalf("Error building remote proxies: %s", err)
+	}
+
 	tagReplicationExecutor := tagreplication.NewExecutor(
 		stats,
 		originClient,
-		tagclient.NewProvider(tls))
+		tagclient.NewRemoteProvider(tls, remoteProxies))
 	tagReplicationStore, err := tagreplication.NewStore(localDB, remotes)
 	if err != nil {
 		log.Fatalf("Error creating tag replication store: %s", err)
@@ -204,13 +232,31 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating write-back manager: %s", err)
 	}
 
-	tagStore := tagstore.New(config.TagStore, stats, ss, backends, writeBackManager)
+	verifier, err := contenttrust.New(config.ContentTrust, stats, backends, originClient)
+	if err != nil {
+		log.Fatalf("Error creating content trust verifier: %s", err)
+	}
+
+	tagStore := tagstore.New(
+		config.TagStore, stats, ss, backends, writeBackManager, tagstore.WithVerifier(verifier))
 
 	depResolver, err := tagtype.NewMap(config.TagTypes, originClient)
 	if err != nil {
 		log.Fatalf("Error creating tag type manager: %s", err)
 	}
 
+	if config.TagServer.Consistency.AdvertiseAddr == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("Error getting hostname: %s", err)
+		}
+		config.TagServer.Consistency.AdvertiseAddr = fmt.Sprintf("%s:%d", hostname, flags.Port)
+	}
+
+	var serverOpts []tagserver.Option
+	if metricsHandler != nil {
+		serverOpts = append(serverOpts, tagserver.WithMetricsHandler(metricsHandler))
+	}
 	server := tagserver.New(
 		config.TagServer,
 		stats,
@@ -219,10 +265,12 @@ func Run(flags *Flags, opts ...Option) {
 		originClient,
 		neighbors,
 		tagStore,
+		tagalias.NewStore(localDB),
 		remotes,
 		tagReplicationManager,
-		tagclient.NewProvider(tls),
-		depResolver)
+		tagclient.NewRemoteProvider(tls, remoteProxies),
+		depResolver,
+		serverOpts...)
 	go func() {
 		log.Fatal(server.ListenAndServe())
 	}()
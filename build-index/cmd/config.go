@@ -14,14 +14,17 @@
 package cmd
 
 import (
+	"github.com/uber/kraken/build-index/contenttrust"
 	"github.com/uber/kraken/build-index/tagserver"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/lib/watchdog"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
@@ -48,4 +51,8 @@ type Config struct {
 	WriteBack      persistedretry.Config        `yaml:"writeback"`
 	Nginx          nginx.Config                 `yaml:"nginx"`
 	TLS            httputil.TLSConfig           `yaml:"tls"`
+	RemoteProxies  httputil.ProxiesConfig       `yaml:"remote_proxies"`
+	ContentTrust   contenttrust.Config          `yaml:"content_trust"`
+	Watchdog       watchdog.Config              `yaml:"watchdog"`
+	Debug          debugserver.Config           `yaml:"debug"`
 }
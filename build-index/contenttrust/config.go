@@ -0,0 +1,39 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package contenttrust
+
+// Supported signature types.
+const (
+	TypeCosign = "cosign"
+)
+
+// Config defines content trust policies for tags imported from backends.
+type Config struct {
+	// Policies require signatures on tags of matching namespaces. The first
+	// policy whose namespace regexp matches a tag applies. Tags which match no
+	// policy are not verified.
+	Policies []PolicyConfig `yaml:"policies"`
+}
+
+// PolicyConfig requires tags of a namespace to be signed by any of a set of
+// keys.
+type PolicyConfig struct {
+	Namespace string `yaml:"namespace"`
+
+	// Type is the signature format. Only "cosign" is supported.
+	Type string `yaml:"type"`
+
+	// PublicKeys are PEM encoded ECDSA public keys, any of which may sign tags.
+	PublicKeys []string `yaml:"public_keys"`
+}
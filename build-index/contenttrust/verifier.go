@@ -0,0 +1,258 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package contenttrust
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// _cosignSignatureAnnotation is the layer annotation holding the signature of
+// a cosign signature payload.
+const _cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// UntrustedError is returned when a tag is not signed by any trusted key.
+type UntrustedError struct {
+	Tag    string
+	Reason string
+}
+
+func (e *UntrustedError) Error() string {
+	return fmt.Sprintf("tag %s is not trusted: %s", e.Tag, e.Reason)
+}
+
+// BlobDownloader downloads blobs, e.g. from the origin cluster.
+type BlobDownloader interface {
+	DownloadBlob(namespace string, d core.Digest, dst io.Writer) error
+}
+
+type policy struct {
+	namespace *regexp.Regexp
+	keys      []*ecdsa.PublicKey
+}
+
+// Verifier verifies the signatures of tags against content trust policies.
+type Verifier struct {
+	stats    tally.Scope
+	policies []policy
+	backends *backend.Manager
+	blobs    BlobDownloader
+}
+
+// New creates a new Verifier.
+func New(
+	config Config,
+	stats tally.Scope,
+	backends *backend.Manager,
+	blobs BlobDownloader) (*Verifier, error) {
+
+	var policies []policy
+	for _, c := range config.Policies {
+		if c.Type != TypeCosign {
+			return nil, fmt.Errorf("policy %s: unsupported type %q", c.Namespace, c.Type)
+		}
+		re, err := regexp.Compile(c.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %s", c.Namespace, err)
+		}
+		if len(c.PublicKeys) == 0 {
+			return nil, fmt.Errorf("policy %s: no public keys", c.Namespace)
+		}
+		var keys []*ecdsa.PublicKey
+		for i, k := range c.PublicKeys {
+			key, err := parsePublicKey(k)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: public key %d: %s", c.Namespace, i, err)
+			}
+			keys = append(keys, key)
+		}
+		policies = append(policies, policy{re, keys})
+	}
+	return &Verifier{
+		stats:    stats.SubScope("contenttrust"),
+		policies: policies,
+		backends: backends,
+		blobs:    blobs,
+	}, nil
+}
+
+func parsePublicKey(s string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("invalid pem")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %s", err)
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+	return key, nil
+}
+
+// Verify returns an UntrustedError if the policy of tag requires a signature
+// and the manifest d of tag is not signed by any of its keys.
+func (v *Verifier) Verify(tag string, d core.Digest) error {
+	p, ok := v.match(tag)
+	if !ok {
+		return nil
+	}
+	err := v.verify(p, tag, d)
+	if err != nil {
+		var uerr *UntrustedError
+		if errors.As(err, &uerr) {
+			log.With("tag", tag, "digest", d).Warnf("Rejected untrusted tag: %s", uerr.Reason)
+			v.stats.Counter("untrusted_tags").Inc(1)
+		} else {
+			v.stats.Counter("errors").Inc(1)
+		}
+		return err
+	}
+	v.stats.Counter("trusted_tags").Inc(1)
+	return nil
+}
+
+func (v *Verifier) match(tag string) (policy, bool) {
+	for _, p := range v.policies {
+		if p.namespace.MatchString(tag) {
+			return p, true
+		}
+	}
+	return policy{}, false
+}
+
+// signatureTag returns the tag cosign stores the signatures of d under, in the
+// same repo as tag.
+func signatureTag(tag string, d core.Digest) string {
+	repo := tag
+	if i := strings.LastIndex(tag, ":"); i != -1 {
+		repo = tag[:i]
+	}
+	return fmt.Sprintf("%s:%s-%s.sig", repo, d.Algo(), d.Hex())
+}
+
+type signatureManifest struct {
+	Layers []struct {
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+type signaturePayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+func (v *Verifier) verify(p policy, tag string, d core.Digest) error {
+	sigTag := signatureTag(tag, d)
+	client, err := v.backends.GetClient(sigTag)
+	if err != nil {
+		return fmt.Errorf("backend manager: %s", err)
+	}
+	var b bytes.Buffer
+	if err := client.Download(sigTag, sigTag, &b); err != nil {
+		if errors.Is(err, backenderrors.ErrBlobNotFound) {
+			return &UntrustedError{tag, "no signatures"}
+		}
+		return fmt.Errorf("resolve signature tag: %s", err)
+	}
+	sigDigest, err := core.ParseSHA256Digest(b.String())
+	if err != nil {
+		return fmt.Errorf("parse signature digest: %s", err)
+	}
+	var m signatureManifest
+	if err := v.download(sigTag, sigDigest, &m); err != nil {
+		return fmt.Errorf("signature manifest: %s", err)
+	}
+	for _, layer := range m.Layers {
+		sig, ok := layer.Annotations[_cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		ld, err := core.ParseSHA256Digest(layer.Digest)
+		if err != nil {
+			return fmt.Errorf("parse payload digest: %s", err)
+		}
+		var payload bytes.Buffer
+		if err := v.blobs.DownloadBlob(sigTag, ld, &payload); err != nil {
+			return fmt.Errorf("download payload: %s", err)
+		}
+		if verifyPayload(p.keys, payload.Bytes(), sig, d) {
+			return nil
+		}
+	}
+	return &UntrustedError{tag, "no valid signatures from trusted keys"}
+}
+
+func (v *Verifier) download(namespace string, d core.Digest, dst interface{}) error {
+	var b bytes.Buffer
+	if err := v.blobs.DownloadBlob(namespace, d, &b); err != nil {
+		return fmt.Errorf("download: %s", err)
+	}
+	if err := json.Unmarshal(b.Bytes(), dst); err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	return nil
+}
+
+// verifyPayload returns whether sig is a valid signature of payload by any of
+// keys, and payload refers to manifest d.
+func verifyPayload(keys []*ecdsa.PublicKey, payload []byte, sig string, d core.Digest) bool {
+	var sp signaturePayload
+	if err := json.Unmarshal(payload, &sp); err != nil {
+		return false
+	}
+	if sp.Critical.Image.DockerManifestDigest != d.String() {
+		return false
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	var es struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(raw, &es); err != nil {
+		return false
+	}
+	h := sha256.Sum256(payload)
+	for _, key := range keys {
+		if ecdsa.Verify(key, h[:], es.R, es.S) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package contenttrust
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/mocks/lib/backend"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type fakeBlobs map[core.Digest][]byte
+
+func (b fakeBlobs) DownloadBlob(namespace string, d core.Digest, dst io.Writer) error {
+	blob, ok := b[d]
+	if !ok {
+		return errors.New("blob not found")
+	}
+	_, err := dst.Write(blob)
+	return err
+}
+
+// add adds blob and returns its digest.
+func (b fakeBlobs) add(t *testing.T, blob []byte) core.Digest {
+	d, err := core.NewDigester().FromBytes(blob)
+	require.NoError(t, err)
+	b[d] = blob
+	return d
+}
+
+func newKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// sign stores a cosign signature of d by key, and returns the digest of the
+// signature manifest.
+func sign(t *testing.T, blobs fakeBlobs, key *ecdsa.PrivateKey, d core.Digest) core.Digest {
+	payload := []byte(fmt.Sprintf(
+		`{"critical":{"identity":{},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"}}`,
+		d.String()))
+	h := sha256.Sum256(payload)
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	require.NoError(t, err)
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	require.NoError(t, err)
+
+	pd := blobs.add(t, payload)
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"layers": []map[string]interface{}{{
+			"digest": pd.String(),
+			"annotations": map[string]string{
+				_cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+			},
+		}},
+	})
+	require.NoError(t, err)
+	return blobs.add(t, manifest)
+}
+
+type verifierMocks struct {
+	backends      *backend.Manager
+	backendClient *mockbackend.MockClient
+	blobs         fakeBlobs
+}
+
+func newVerifierMocks(t *testing.T) (*verifierMocks, func()) {
+	ctrl := gomock.NewController(t)
+
+	backends := backend.ManagerFixture()
+	backendClient := mockbackend.NewMockClient(ctrl)
+	require.NoError(t, backends.Register(".*", backendClient))
+
+	return &verifierMocks{backends, backendClient, make(fakeBlobs)}, ctrl.Finish
+}
+
+func (m *verifierMocks) new(t *testing.T, keys ...string) *Verifier {
+	v, err := New(Config{Policies: []PolicyConfig{{
+		Namespace:  "trusted/.*",
+		Type:       TypeCosign,
+		PublicKeys: keys,
+	}}}, tally.NoopScope, m.backends, m.blobs)
+	require.NoError(t, err)
+	return v
+}
+
+func (m *verifierMocks) expectSignatureTag(tag string, d core.Digest, sigDigest core.Digest) {
+	sigTag := signatureTag(tag, d)
+	m.backendClient.EXPECT().Download(sigTag, sigTag, gomock.Any()).DoAndReturn(
+		func(namespace, name string, dst io.Writer) error {
+			_, err := io.Copy(dst, bytes.NewBufferString(sigDigest.String()))
+			return err
+		})
+}
+
+func TestVerifySignedTag(t *testing.T) {
+	mocks, cleanup := newVerifierMocks(t)
+	defer cleanup()
+
+	key, pub := newKey(t)
+	tag := "trusted/repo:v1"
+	d := core.DigestFixture()
+
+	mocks.expectSignatureTag(tag, d, sign(t, mocks.blobs, key, d))
+
+	require.NoError(t, mocks.new(t, pub).Verify(tag, d))
+}
+
+func TestVerifyUnsignedTag(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newVerifierMocks(t)
+	defer cleanup()
+
+	_, pub := newKey(t)
+	tag := "trusted/repo:v1"
+	d := core.DigestFixture()
+
+	sigTag := signatureTag(tag, d)
+	mocks.backendClient.EXPECT().Download(sigTag, sigTag, gomock.Any()).Return(
+		backenderrors.ErrBlobNotFound)
+
+	err := mocks.new(t, pub).Verify(tag, d)
+	var uerr *UntrustedError
+	require.True(errors.As(err, &uerr))
+}
+
+func TestVerifyTagSignedByUntrustedKey(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newVerifierMocks(t)
+	defer cleanup()
+
+	_, pub := newKey(t)
+	other, _ := newKey(t)
+	tag := "trusted/repo:v1"
+	d := core.DigestFixture()
+
+	mocks.expectSignatureTag(tag, d, sign(t, mocks.blobs, other, d))
+
+	err := mocks.new(t, pub).Verify(tag, d)
+	var uerr *UntrustedError
+	require.True(errors.As(err, &uerr))
+}
+
+func TestVerifySignatureOfOtherManifest(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newVerifierMocks(t)
+	defer cleanup()
+
+	key, pub := newKey(t)
+	tag := "trusted/repo:v1"
+	d := core.DigestFixture()
+
+	// A valid signature of a different manifest, copied to the signature tag of d.
+	mocks.expectSignatureTag(tag, d, sign(t, mocks.blobs, key, core.DigestFixture()))
+
+	err := mocks.new(t, pub).Verify(tag, d)
+	var uerr *UntrustedError
+	require.True(errors.As(err, &uerr))
+}
+
+func TestVerifySkipsTagsWithoutPolicy(t *testing.T) {
+	mocks, cleanup := newVerifierMocks(t)
+	defer cleanup()
+
+	_, pub := newKey(t)
+
+	require.NoError(t, mocks.new(t, pub).Verify("other/repo:v1", core.DigestFixture()))
+}
+
+func TestNewRejectsInvalidPolicies(t *testing.T) {
+	_, pub := newKey(t)
+
+	for _, c := range []PolicyConfig{
+		{Namespace: ".*", Type: "notary", PublicKeys: []string{pub}},
+		{Namespace: ".*", Type: TypeCosign},
+		{Namespace: ".*", Type: TypeCosign, PublicKeys: []string{"not a key"}},
+		{Namespace: "(", Type: TypeCosign, PublicKeys: []string{pub}},
+	} {
+		_, err := New(Config{Policies: []PolicyConfig{c}}, tally.NoopScope, nil, nil)
+		require.Error(t, err)
+	}
+}
+
+func TestSignatureTag(t *testing.T) {
+	d := core.DigestFixture()
+	require.Equal(t, fmt.Sprintf("repo:sha256-%s.sig", d.Hex()), signatureTag("repo:v1", d))
+}
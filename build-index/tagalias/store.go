@@ -0,0 +1,147 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagalias
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Store errors.
+var (
+	ErrAliasNotFound   = errors.New("alias not found")
+	ErrVersionConflict = errors.New("alias version conflict")
+)
+
+// Store persists aliases and the history of their targets.
+type Store struct {
+	db *sqlx.DB
+}
+
+// NewStore creates a new Store.
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db}
+}
+
+// Get returns the current target of alias.
+func (s *Store) Get(alias string) (tagmodels.Alias, error) {
+	var a tagmodels.Alias
+	err := s.db.Get(&a, `
+		SELECT alias, target, version, updated_at
+		FROM tag_alias
+		WHERE alias=?`, alias)
+	if err == sql.ErrNoRows {
+		return tagmodels.Alias{}, ErrAliasNotFound
+	}
+	return a, err
+}
+
+// Set atomically points alias at target. If version is not
+// tagmodels.AnyAliasVersion, alias is only moved if its current version is
+// version (0 for aliases which do not exist yet), else ErrVersionConflict is
+// returned.
+func (s *Store) Set(alias, target string, version int) (tagmodels.Alias, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return tagmodels.Alias{}, fmt.Errorf("begin: %s", err)
+	}
+	defer tx.Rollback()
+
+	var cur int
+	err = tx.Get(&cur, `SELECT version FROM tag_alias WHERE alias=?`, alias)
+	if err != nil && err != sql.ErrNoRows {
+		return tagmodels.Alias{}, fmt.Errorf("select version: %s", err)
+	}
+	if version != tagmodels.AnyAliasVersion && version != cur {
+		return tagmodels.Alias{}, ErrVersionConflict
+	}
+	a := tagmodels.Alias{
+		Name:      alias,
+		Target:    target,
+		Version:   cur + 1,
+		UpdatedAt: time.Now(),
+	}
+	if err := write(tx, a); err != nil {
+		return tagmodels.Alias{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return tagmodels.Alias{}, fmt.Errorf("commit: %s", err)
+	}
+	return a, nil
+}
+
+// Apply stores a, which was set on another build-index, if it is newer than
+// the local version of the alias. Returns whether a was applied.
+func (s *Store) Apply(a tagmodels.Alias) (bool, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return false, fmt.Errorf("begin: %s", err)
+	}
+	defer tx.Rollback()
+
+	var cur int
+	err = tx.Get(&cur, `SELECT version FROM tag_alias WHERE alias=?`, a.Name)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("select version: %s", err)
+	}
+	if a.Version <= cur {
+		return false, nil
+	}
+	if err := write(tx, a); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit: %s", err)
+	}
+	return true, nil
+}
+
+// History returns every version of alias, newest first.
+func (s *Store) History(alias string) ([]tagmodels.Alias, error) {
+	var history []tagmodels.Alias
+	err := s.db.Select(&history, `
+		SELECT alias, target, version, updated_at
+		FROM tag_alias_history
+		WHERE alias=?
+		ORDER BY version DESC`, alias)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, ErrAliasNotFound
+	}
+	return history, nil
+}
+
+func write(tx *sqlx.Tx, a tagmodels.Alias) error {
+	if _, err := tx.NamedExec(`
+		INSERT OR REPLACE INTO tag_alias (alias, target, version, updated_at)
+		VALUES (:alias, :target, :version, :updated_at)
+	`, a); err != nil {
+		return fmt.Errorf("upsert alias: %s", err)
+	}
+	if _, err := tx.NamedExec(`
+		INSERT OR IGNORE INTO tag_alias_history (alias, target, version, updated_at)
+		VALUES (:alias, :target, :version, :updated_at)
+	`, a); err != nil {
+		return fmt.Errorf("insert history: %s", err)
+	}
+	return nil
+}
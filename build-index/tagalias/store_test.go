@@ -0,0 +1,124 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagalias
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/localdb"
+
+	"github.com/stretchr/testify/require"
+)
+
+func targets(history []tagmodels.Alias) []string {
+	var result []string
+	for _, a := range history {
+		result = append(result, a.Target)
+	}
+	return result
+}
+
+func TestStoreSetAndGet(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	s := NewStore(db)
+
+	alias := core.TagFixture()
+	t1 := core.TagFixture()
+	t2 := core.TagFixture()
+
+	_, err := s.Get(alias)
+	require.Equal(ErrAliasNotFound, err)
+
+	a, err := s.Set(alias, t1, tagmodels.AnyAliasVersion)
+	require.NoError(err)
+	require.Equal(1, a.Version)
+
+	a, err = s.Set(alias, t2, tagmodels.AnyAliasVersion)
+	require.NoError(err)
+	require.Equal(2, a.Version)
+
+	result, err := s.Get(alias)
+	require.NoError(err)
+	require.Equal(t2, result.Target)
+	require.Equal(2, result.Version)
+
+	history, err := s.History(alias)
+	require.NoError(err)
+	require.Equal([]string{t2, t1}, targets(history))
+}
+
+func TestStoreSetVersionConflict(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	s := NewStore(db)
+
+	alias := core.TagFixture()
+	t1 := core.TagFixture()
+	t2 := core.TagFixture()
+
+	_, err := s.Set(alias, t1, 1)
+	require.Equal(ErrVersionConflict, err)
+
+	_, err = s.Set(alias, t1, 0)
+	require.NoError(err)
+
+	_, err = s.Set(alias, t2, 0)
+	require.Equal(ErrVersionConflict, err)
+
+	a, err := s.Set(alias, t2, 1)
+	require.NoError(err)
+	require.Equal(2, a.Version)
+}
+
+func TestStoreApplyIgnoresStaleVersions(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	s := NewStore(db)
+
+	alias := core.TagFixture()
+	t1 := core.TagFixture()
+	t2 := core.TagFixture()
+
+	ok, err := s.Apply(tagmodels.Alias{Name: alias, Target: t2, Version: 2})
+	require.NoError(err)
+	require.True(ok)
+
+	ok, err = s.Apply(tagmodels.Alias{Name: alias, Target: t1, Version: 1})
+	require.NoError(err)
+	require.False(ok)
+
+	result, err := s.Get(alias)
+	require.NoError(err)
+	require.Equal(t2, result.Target)
+}
+
+func TestStoreHistoryNotFound(t *testing.T) {
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	_, err := NewStore(db).History(core.TagFixture())
+	require.Equal(t, ErrAliasNotFound, err)
+}
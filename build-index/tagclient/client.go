@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"strconv"
 	"time"
@@ -33,30 +34,60 @@ import (
 
 // Client errors.
 var (
-	ErrTagNotFound = errors.New("tag not found")
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrAliasNotFound   = errors.New("alias not found")
+	ErrVersionConflict = errors.New("alias version conflict")
 )
 
+// PolicyViolations returns the violations listed by err if err is the
+// rejection of a tag whose image violates the manifest policy of its
+// namespace.
+func PolicyViolations(err error) (tagmodels.PolicyViolations, bool) {
+	serr, ok := err.(httputil.StatusError)
+	if !ok || serr.Status != http.StatusBadRequest ||
+		serr.Header.Get("Content-Type") != "application/json" {
+		return tagmodels.PolicyViolations{}, false
+	}
+	var v tagmodels.PolicyViolations
+	if err := json.Unmarshal([]byte(serr.ResponseDump), &v); err != nil {
+		return tagmodels.PolicyViolations{}, false
+	}
+	return v, true
+}
+
 // Client wraps tagserver endpoints.
 type Client interface {
 	Put(tag string, d core.Digest) error
 	PutAndReplicate(tag string, d core.Digest) error
 	Get(tag string) (core.Digest, error)
+	GetConsistent(tag, token string) (core.Digest, error)
 	Has(tag string) (bool, error)
 	List(prefix string) ([]string, error)
 	ListWithPagination(prefix string, filter ListFilter) (tagmodels.ListResponse, error)
 	ListRepository(repo string) ([]string, error)
 	ListRepositoryWithPagination(repo string, filter ListFilter) (tagmodels.ListResponse, error)
+	ListManifests(repo string) ([]tagmodels.Manifest, error)
+	ListManifestsWithPagination(repo string, filter ListFilter) (tagmodels.ManifestListResponse, error)
 	Replicate(tag string) error
 	Origin() (string, error)
 
+	PutAlias(alias, tag string, version int) (tagmodels.Alias, error)
+	GetAlias(alias string) (tagmodels.Alias, error)
+	AliasHistory(alias string) ([]tagmodels.Alias, error)
+
+	Lineage(tag string) (tagmodels.Lineage, error)
+
 	DuplicateReplicate(
 		tag string, d core.Digest, dependencies core.DigestList, delay time.Duration) error
-	DuplicatePut(tag string, d core.Digest, delay time.Duration) error
+	DuplicatePut(tag string, d core.Digest, delay time.Duration, version time.Time) error
+	DuplicateDelete(tag string, d core.Digest, version time.Time) error
+	DuplicatePutAlias(a tagmodels.Alias) error
 }
 
 type singleClient struct {
-	addr string
-	tls  *tls.Config
+	addr  string
+	tls   *tls.Config
+	proxy *httputil.Proxy
 }
 
 // ListFilter contains filter request for list with pagination operations.
@@ -65,16 +96,29 @@ type ListFilter struct {
 	Limit  int
 }
 
+// Option allows setting optional singleClient parameters.
+type Option func(*singleClient)
+
+// WithProxy configures a Client to send requests through an egress proxy.
+func WithProxy(p *httputil.Proxy) Option {
+	return func(c *singleClient) { c.proxy = p }
+}
+
 // NewSingleClient returns a Client scoped to a single tagserver instance.
-func NewSingleClient(addr string, config *tls.Config) Client {
-	return &singleClient{addr, config}
+func NewSingleClient(addr string, config *tls.Config, opts ...Option) Client {
+	c := &singleClient{addr: addr, tls: config}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *singleClient) Put(tag string, d core.Digest) error {
 	_, err := httputil.Put(
 		fmt.Sprintf("http://%s/tags/%s/digest/%s", c.addr, url.PathEscape(tag), d.String()),
 		httputil.SendTimeout(30*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
@@ -82,15 +126,28 @@ func (c *singleClient) PutAndReplicate(tag string, d core.Digest) error {
 	_, err := httputil.Put(
 		fmt.Sprintf("http://%s/tags/%s/digest/%s?replicate=true", c.addr, url.PathEscape(tag), d.String()),
 		httputil.SendTimeout(30*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
 func (c *singleClient) Get(tag string) (core.Digest, error) {
+	return c.GetConsistent(tag, "")
+}
+
+// GetConsistent gets tag, presenting the consistency token returned by a put
+// of tag such that the result observes the put. Empty tokens are not sent.
+func (c *singleClient) GetConsistent(tag, token string) (core.Digest, error) {
+	headers := make(map[string]string)
+	if token != "" {
+		headers[tagmodels.ConsistencyTokenHeader] = token
+	}
 	resp, err := httputil.Get(
 		fmt.Sprintf("http://%s/tags/%s", c.addr, url.PathEscape(tag)),
+		httputil.SendHeaders(headers),
 		httputil.SendTimeout(10*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		if httputil.IsNotFound(err) {
 			return core.Digest{}, ErrTagNotFound
@@ -113,7 +170,8 @@ func (c *singleClient) Has(tag string) (bool, error) {
 	_, err := httputil.Head(
 		fmt.Sprintf("http://%s/tags/%s", c.addr, url.PathEscape(tag)),
 		httputil.SendTimeout(10*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		if httputil.IsNotFound(err) {
 			return false, nil
@@ -146,7 +204,8 @@ func (c *singleClient) doListPaginated(urlFormat string, pathSub string,
 	httpResp, err := httputil.Get(
 		serverUrl.String(),
 		httputil.SendTimeout(60*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		return resp, err
 	}
@@ -209,6 +268,57 @@ func (c *singleClient) ListRepositoryWithPagination(repo string,
 	return c.doListPaginated("repositories/%s/tags", url.PathEscape(repo), filter)
 }
 
+// ListManifests lists every tag of repo and the manifest it points to.
+func (c *singleClient) ListManifests(repo string) ([]tagmodels.Manifest, error) {
+	var manifests []tagmodels.Manifest
+	offset := ""
+	for ok := true; ok; ok = (offset != "") {
+		resp, err := c.ListManifestsWithPagination(repo, ListFilter{Offset: offset})
+		if err != nil {
+			return nil, err
+		}
+		offset, err = resp.GetOffset()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		manifests = append(manifests, resp.Result...)
+	}
+	return manifests, nil
+}
+
+func (c *singleClient) ListManifestsWithPagination(repo string,
+	filter ListFilter) (tagmodels.ManifestListResponse, error) {
+
+	reqVal := url.Values{}
+	reqVal.Add(tagmodels.RepoQ, repo)
+	if filter.Offset != "" {
+		reqVal.Add(tagmodels.OffsetQ, filter.Offset)
+	}
+	if filter.Limit != 0 {
+		reqVal.Add(tagmodels.LimitQ, strconv.Itoa(filter.Limit))
+	}
+	serverUrl := url.URL{
+		Scheme:   "http",
+		Host:     c.addr,
+		Path:     "manifest",
+		RawQuery: reqVal.Encode(),
+	}
+	var resp tagmodels.ManifestListResponse
+	httpResp, err := httputil.Get(
+		serverUrl.String(),
+		httputil.SendTimeout(60*time.Second),
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("json decode: %s", err)
+	}
+	return resp, nil
+}
+
 // ReplicateRequest defines a Replicate request body.
 type ReplicateRequest struct {
 	Dependencies []core.Digest `json:"dependencies"`
@@ -218,7 +328,8 @@ func (c *singleClient) Replicate(tag string) error {
 	_, err := httputil.Post(
 		fmt.Sprintf("http://%s/remotes/tags/%s", c.addr, url.PathEscape(tag)),
 		httputil.SendTimeout(15*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
@@ -242,17 +353,26 @@ func (c *singleClient) DuplicateReplicate(
 		httputil.SendBody(bytes.NewReader(b)),
 		httputil.SendTimeout(10*time.Second),
 		httputil.SendRetry(),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
 // DuplicatePutRequest defines a DuplicatePut request body.
 type DuplicatePutRequest struct {
 	Delay time.Duration `json:"delay"`
+
+	// Version is the time the put was accepted by the build-index it is
+	// duplicated from, in nanoseconds since the epoch. Zero if unknown.
+	Version int64 `json:"version,omitempty"`
 }
 
-func (c *singleClient) DuplicatePut(tag string, d core.Digest, delay time.Duration) error {
-	b, err := json.Marshal(DuplicatePutRequest{delay})
+// DuplicatePut duplicates the put of tag to d, accepted at version, to the
+// neighbor build-index of c.
+func (c *singleClient) DuplicatePut(
+	tag string, d core.Digest, delay time.Duration, version time.Time) error {
+
+	b, err := json.Marshal(DuplicatePutRequest{Delay: delay, Version: version.UnixNano()})
 	if err != nil {
 		return fmt.Errorf("json marshal: %s", err)
 	}
@@ -263,7 +383,128 @@ func (c *singleClient) DuplicatePut(tag string, d core.Digest, delay time.Durati
 		httputil.SendBody(bytes.NewReader(b)),
 		httputil.SendTimeout(10*time.Second),
 		httputil.SendRetry(),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
+	return err
+}
+
+// DuplicateDelete duplicates the delete of tag, accepted at version, to the
+// neighbor build-index of c.
+func (c *singleClient) DuplicateDelete(tag string, d core.Digest, version time.Time) error {
+	_, err := httputil.Delete(
+		fmt.Sprintf(
+			"http://%s/internal/duplicate/tags/%s/digest/%s?version=%d",
+			c.addr, url.PathEscape(tag), d.String(), version.UnixNano()),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendRetry(),
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
+	return err
+}
+
+// PutAlias points alias at tag. If version is not tagmodels.AnyAliasVersion,
+// alias is only moved if its current version matches version.
+func (c *singleClient) PutAlias(alias, tag string, version int) (tagmodels.Alias, error) {
+	var a tagmodels.Alias
+	u := fmt.Sprintf("http://%s/aliases/%s/tags/%s", c.addr, url.PathEscape(alias), url.PathEscape(tag))
+	if version != tagmodels.AnyAliasVersion {
+		u += fmt.Sprintf("?%s=%d", tagmodels.VersionQ, version)
+	}
+	resp, err := httputil.Put(
+		u,
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return a, ErrTagNotFound
+		}
+		if httputil.IsConflict(err) {
+			return a, ErrVersionConflict
+		}
+		return a, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&a); err != nil {
+		return a, fmt.Errorf("json decode: %s", err)
+	}
+	return a, nil
+}
+
+func (c *singleClient) GetAlias(alias string) (tagmodels.Alias, error) {
+	var a tagmodels.Alias
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/aliases/%s", c.addr, url.PathEscape(alias)),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return a, ErrAliasNotFound
+		}
+		return a, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&a); err != nil {
+		return a, fmt.Errorf("json decode: %s", err)
+	}
+	return a, nil
+}
+
+func (c *singleClient) AliasHistory(alias string) ([]tagmodels.Alias, error) {
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/aliases/%s/history", c.addr, url.PathEscape(alias)),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return nil, ErrAliasNotFound
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var history []tagmodels.Alias
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, fmt.Errorf("json decode: %s", err)
+	}
+	return history, nil
+}
+
+// Lineage returns the bases and descendants of tag. Returns ErrTagNotFound if
+// tag does not exist or its lineage is not indexed.
+func (c *singleClient) Lineage(tag string) (tagmodels.Lineage, error) {
+	var l tagmodels.Lineage
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/lineage/%s", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(30*time.Second),
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return l, ErrTagNotFound
+		}
+		return l, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return l, fmt.Errorf("json decode: %s", err)
+	}
+	return l, nil
+}
+
+func (c *singleClient) DuplicatePutAlias(a tagmodels.Alias) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("json marshal: %s", err)
+	}
+	_, err = httputil.Put(
+		fmt.Sprintf("http://%s/internal/duplicate/aliases/%s", c.addr, url.PathEscape(a.Name)),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendRetry(),
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
@@ -271,7 +512,8 @@ func (c *singleClient) Origin() (string, error) {
 	resp, err := httputil.Get(
 		fmt.Sprintf("http://%s/origin", c.addr),
 		httputil.SendTimeout(5*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		return "", err
 	}
@@ -327,6 +569,14 @@ func (cc *clusterClient) Get(tag string) (d core.Digest, err error) {
 	return
 }
 
+func (cc *clusterClient) GetConsistent(tag, token string) (d core.Digest, err error) {
+	err = cc.do(func(c Client) error {
+		d, err = c.GetConsistent(tag, token)
+		return err
+	})
+	return
+}
+
 func (cc *clusterClient) Has(tag string) (ok bool, err error) {
 	err = cc.do(func(c Client) error {
 		ok, err = c.Has(tag)
@@ -371,6 +621,24 @@ func (cc *clusterClient) ListRepositoryWithPagination(repo string,
 	return
 }
 
+func (cc *clusterClient) ListManifests(repo string) (manifests []tagmodels.Manifest, err error) {
+	err = cc.do(func(c Client) error {
+		manifests, err = c.ListManifests(repo)
+		return err
+	})
+	return
+}
+
+func (cc *clusterClient) ListManifestsWithPagination(repo string,
+	filter ListFilter) (resp tagmodels.ManifestListResponse, err error) {
+
+	err = cc.do(func(c Client) error {
+		resp, err = c.ListManifestsWithPagination(repo, filter)
+		return err
+	})
+	return
+}
+
 func (cc *clusterClient) Replicate(tag string) error {
 	return cc.do(func(c Client) error { return c.Replicate(tag) })
 }
@@ -389,6 +657,48 @@ func (cc *clusterClient) DuplicateReplicate(
 	return errors.New("duplicate replicate not supported on cluster client")
 }
 
-func (cc *clusterClient) DuplicatePut(tag string, d core.Digest, delay time.Duration) error {
+func (cc *clusterClient) DuplicatePut(
+	tag string, d core.Digest, delay time.Duration, version time.Time) error {
+
 	return errors.New("duplicate put not supported on cluster client")
 }
+
+func (cc *clusterClient) DuplicateDelete(tag string, d core.Digest, version time.Time) error {
+	return errors.New("duplicate delete not supported on cluster client")
+}
+
+func (cc *clusterClient) PutAlias(alias, tag string, version int) (a tagmodels.Alias, err error) {
+	err = cc.do(func(c Client) error {
+		a, err = c.PutAlias(alias, tag, version)
+		return err
+	})
+	return
+}
+
+func (cc *clusterClient) GetAlias(alias string) (a tagmodels.Alias, err error) {
+	err = cc.do(func(c Client) error {
+		a, err = c.GetAlias(alias)
+		return err
+	})
+	return
+}
+
+func (cc *clusterClient) AliasHistory(alias string) (history []tagmodels.Alias, err error) {
+	err = cc.do(func(c Client) error {
+		history, err = c.AliasHistory(alias)
+		return err
+	})
+	return
+}
+
+func (cc *clusterClient) Lineage(tag string) (l tagmodels.Lineage, err error) {
+	err = cc.do(func(c Client) error {
+		l, err = c.Lineage(tag)
+		return err
+	})
+	return
+}
+
+func (cc *clusterClient) DuplicatePutAlias(a tagmodels.Alias) error {
+	return errors.New("duplicate put alias not supported on cluster client")
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// StreamEvents subscribes to the tag events of namespace emitted by the
+// build-index instance at addr, calling f with each event. connected is called
+// once the subscription is established, such that callers can resync state
+// which may have changed while they were not subscribed. Blocks until the
+// stream is closed, e.g. because the subscriber fell behind, or ctx is done.
+func StreamEvents(
+	ctx context.Context,
+	addr string,
+	config *tls.Config,
+	namespace string,
+	connected func(),
+	f func(tagmodels.TagEvent)) error {
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/events?namespace=%s", addr, url.QueryEscape(namespace)),
+		httputil.SendTimeout(0),
+		httputil.SendContext(ctx),
+		httputil.SendTLS(config))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	connected()
+
+	s := bufio.NewScanner(resp.Body)
+	for s.Scan() {
+		// Event types are repeated in the data, and comment lines are
+		// heartbeats, so only data lines are parsed.
+		line := s.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var e tagmodels.TagEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+			return fmt.Errorf("json unmarshal: %s", err)
+		}
+		f(e)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("read stream: %s", err)
+	}
+	return nil
+}
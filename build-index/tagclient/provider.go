@@ -15,6 +15,8 @@ package tagclient
 
 import (
 	"crypto/tls"
+
+	"github.com/uber/kraken/utils/httputil"
 )
 
 // Provider maps addresses into Clients.
@@ -22,11 +24,21 @@ type Provider interface {
 	Provide(addr string) Client
 }
 
-type provider struct{ tls *tls.Config }
+type provider struct {
+	tls     *tls.Config
+	proxies map[string]*httputil.Proxy
+}
 
 // NewProvider creates a Provider which wraps NewSingleClient.
-func NewProvider(config *tls.Config) Provider { return provider{config} }
+func NewProvider(config *tls.Config) Provider { return provider{tls: config} }
+
+// NewRemoteProvider creates a Provider which wraps NewSingleClient, and sends
+// requests to each addr through its proxy in proxies. Addresses without a
+// proxy are reached directly.
+func NewRemoteProvider(config *tls.Config, proxies map[string]*httputil.Proxy) Provider {
+	return provider{config, proxies}
+}
 
 func (p provider) Provide(addr string) Client {
-	return NewSingleClient(addr, p.tls)
+	return NewSingleClient(addr, p.tls, WithProxy(p.proxies[addr]))
 }
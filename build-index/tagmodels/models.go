@@ -17,14 +17,31 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"time"
+
+	"github.com/uber/kraken/core"
 )
 
 const (
 	// Filters.
 	LimitQ  string = "limit"
 	OffsetQ string = "offset"
+
+	// RepoQ is the repository whose manifests are listed.
+	RepoQ string = "repo"
+
+	// VersionQ is the expected current version of an alias being moved.
+	VersionQ string = "version"
 )
 
+// ConsistencyTokenHeader carries consistency tokens. Tag puts return a token
+// in this response header which, when presented in this request header on a
+// get of the same tag, guarantees the get observes the put.
+const ConsistencyTokenHeader = "Kraken-Consistency-Token"
+
+// AnyAliasVersion moves an alias regardless of its current version.
+const AnyAliasVersion = -1
+
 // List Response with pagination. Models tagserver reponse to list and
 // listRepository.
 type ListResponse struct {
@@ -39,11 +56,37 @@ type ListResponse struct {
 // GetOffset returns offset token from the ListResponse struct.
 // Returns token if present, io.EOF if Next is empty, error otherwise.
 func (resp ListResponse) GetOffset() (string, error) {
-	if resp.Links.Next == "" {
+	return parseOffset(resp.Links.Next)
+}
+
+// Manifest is a tag of a repository and the manifest digest it points to.
+type Manifest struct {
+	Tag    string      `json:"tag"`
+	Digest core.Digest `json:"digest"`
+}
+
+// ManifestListResponse is a page of the manifests tagged in a repository.
+type ManifestListResponse struct {
+	Links struct {
+		Next string `json:"next"`
+		Self string `json:"self"`
+	}
+	Size   int        `json:"size"`
+	Result []Manifest `json:"result"`
+}
+
+// GetOffset returns offset token from the ManifestListResponse struct.
+// Returns token if present, io.EOF if Next is empty, error otherwise.
+func (resp ManifestListResponse) GetOffset() (string, error) {
+	return parseOffset(resp.Links.Next)
+}
+
+func parseOffset(next string) (string, error) {
+	if next == "" {
 		return "", io.EOF
 	}
 
-	nextUrl, err := url.Parse(resp.Links.Next)
+	nextUrl, err := url.Parse(next)
 	if err != nil {
 		return "", err
 	}
@@ -53,7 +96,82 @@ func (resp ListResponse) GetOffset() (string, error) {
 	}
 	offset := val.Get(OffsetQ)
 	if offset == "" {
-		return "", fmt.Errorf("invalid offset in %s", resp.Links.Next)
+		return "", fmt.Errorf("invalid offset in %s", next)
 	}
 	return offset, nil
 }
+
+// Alias points an alias tag, e.g. "repo:latest", at a target tag. Version is
+// incremented every time the alias is moved, starting at 1.
+type Alias struct {
+	Name      string    `json:"name" db:"alias"`
+	Target    string    `json:"target" db:"target"`
+	Version   int       `json:"version" db:"version"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Tag event types. TagDeleted events carry the digest the tag pointed to.
+const (
+	TagCreated = "tag_created"
+	TagUpdated = "tag_updated"
+	TagDeleted = "tag_deleted"
+)
+
+// TagEvent describes a change to a tag.
+type TagEvent struct {
+	Type   string      `json:"type"`
+	Tag    string      `json:"tag"`
+	Digest core.Digest `json:"digest"`
+	Time   time.Time   `json:"time"`
+}
+
+// Lineage sources, i.e. how an image was found to be based on another.
+const (
+	// LineageByLayers relates images whose layers extend those of the base.
+	LineageByLayers = "layers"
+
+	// LineageByAnnotation relates images which name their base in the
+	// org.opencontainers.image.base.name manifest annotation.
+	LineageByAnnotation = "annotation"
+)
+
+// LineageImage is an image related to the subject of a Lineage. Digest is nil
+// for annotated bases which are not known to build-index.
+type LineageImage struct {
+	Tag    string       `json:"tag"`
+	Digest *core.Digest `json:"digest,omitempty"`
+	Source string       `json:"source"`
+}
+
+// Lineage describes which images a tag is based on, and which images are
+// based on it.
+type Lineage struct {
+	Tag    string      `json:"tag"`
+	Digest core.Digest `json:"digest"`
+
+	// Bases are ordered from the direct base of Tag to the root image.
+	Bases []LineageImage `json:"bases"`
+
+	// Descendants are all images transitively based on Tag, sorted by tag.
+	Descendants []LineageImage `json:"descendants"`
+}
+
+// PolicyViolation is a rule of a namespace's manifest policy which an image
+// violates.
+type PolicyViolation struct {
+	// Rule is the violated rule, e.g. "max_layer_size".
+	Rule string `json:"rule"`
+
+	// Digest is the manifest which violates Rule. For multi-arch images, this
+	// is either the manifest list or the manifest of a platform.
+	Digest core.Digest `json:"digest"`
+
+	Message string `json:"message"`
+}
+
+// PolicyViolations is the body of 400 responses to tags of images which
+// violate the manifest policy of their namespace.
+type PolicyViolations struct {
+	Tag        string            `json:"tag"`
+	Violations []PolicyViolation `json:"violations"`
+}
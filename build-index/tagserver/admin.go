@@ -0,0 +1,156 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// AdminTokenHeader carries an admin token, which authorizes destructive
+// operations such as deleting tags.
+const AdminTokenHeader = "Kraken-Admin-Token"
+
+// AdminConfig defines who may perform destructive operations. Such operations
+// are rejected unless tokens are configured.
+type AdminConfig struct {
+	// Tokens maps the names of admin token holders to their tokens. Every use
+	// of a token is audit logged with the holder name.
+	Tokens map[string]string `yaml:"tokens"`
+}
+
+// holder returns the holder of admin token.
+func (c AdminConfig) holder(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	for holder, t := range c.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return holder, true
+		}
+	}
+	return "", false
+}
+
+// checkAdmin returns the holder of the admin token presented by r. Returns 403
+// if admin operations are disabled, and 401 if the token is missing or
+// unknown.
+func (s *Server) checkAdmin(r *http.Request) (string, error) {
+	if len(s.config.Admin.Tokens) == 0 {
+		return "", handler.Errorf("admin operations disabled").Status(http.StatusForbidden)
+	}
+	holder, ok := s.config.Admin.holder(r.Header.Get(AdminTokenHeader))
+	if !ok {
+		s.stats.Counter("unauthorized_admin_requests").Inc(1)
+		log.With(
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote_addr", r.RemoteAddr).Warn("Rejected unauthorized admin request")
+		return "", handler.Errorf(
+			"admin operations require a %s header", AdminTokenHeader).
+			Status(http.StatusUnauthorized)
+	}
+	return holder, nil
+}
+
+// deleteManifestHandler deletes a tag from the backend and from the disk of
+// every build-index in the cluster. Manifests and layers are content
+// addressed, so are left to origin retention.
+func (s *Server) deleteManifestHandler(w http.ResponseWriter, r *http.Request) error {
+	holder, err := s.checkAdmin(r)
+	if err != nil {
+		return err
+	}
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	version := time.Now()
+	d, err := s.store.Delete(tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		if errors.Is(err, backenderrors.ErrDeleteNotSupported) {
+			return handler.Errorf("%s", err).Status(http.StatusNotImplemented)
+		}
+		return handler.Errorf("storage: %s", err)
+	}
+	s.onTagDeleted(tag, d, version)
+
+	log.With("holder", holder, "tag", tag).Info("Deleted tag")
+	s.stats.Counter("deleted_tags").Inc(1)
+
+	neighbors := s.neighbors.Resolve()
+
+	var successes int
+	for addr := range neighbors {
+		client := s.provider.Provide(addr)
+		if err := client.DuplicateDelete(tag, d, version); err != nil {
+			log.Errorf("Error duplicating delete to %s: %s", addr, err)
+		} else {
+			successes++
+		}
+	}
+	if len(neighbors) != 0 && successes == 0 {
+		s.stats.Counter("duplicate_delete_failures").Inc(1)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// duplicateDeleteTagHandler deletes a tag deleted through a neighbor. Deleting
+// the disk copy cancels any write-back of the tag still pending on s.
+func (s *Server) duplicateDeleteTagHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	version, err := strconv.ParseInt(httputil.GetQueryArg(r, "version", "0"), 10, 64)
+	if err != nil {
+		return handler.Errorf("parse query arg `version`: %s", err).Status(http.StatusBadRequest)
+	}
+	if _, err := s.store.Delete(tag); err != nil && err != tagstore.ErrTagNotFound {
+		return handler.Errorf("storage: %s", err)
+	}
+	s.onTagDeleted(tag, d, writeVersion(version))
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// onTagDeleted forgets tag in every in-memory index of s, and notifies event
+// subscribers that tag no longer points to d. version is the time the delete
+// was accepted.
+func (s *Server) onTagDeleted(tag string, d core.Digest, version time.Time) {
+	s.writes.record(tag, version)
+	s.lineage.remove(tag)
+	s.events.publish(tagmodels.TagEvent{
+		Type: tagmodels.TagDeleted, Tag: tag, Digest: d, Time: version})
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func deleteManifest(addr, tag, token string) error {
+	_, err := httputil.Delete(
+		fmt.Sprintf("http://%s/manifest/%s", addr, url.PathEscape(tag)),
+		httputil.SendHeaders(map[string]string{AdminTokenHeader: token}),
+		httputil.SendAcceptedCodes(http.StatusNoContent))
+	return err
+}
+
+func TestDeleteManifest(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Admin = AdminConfig{Tokens: map[string]string{"oncall": "secret"}}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.store.EXPECT().Delete(tag).Return(digest, nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().DuplicateDelete(tag, digest, gomock.Any()).Return(nil)
+
+	require.NoError(deleteManifest(addr, tag, "secret"))
+}
+
+func TestDeleteManifestErrors(t *testing.T) {
+	tag := core.TagFixture()
+
+	tests := []struct {
+		desc     string
+		tokens   map[string]string
+		token    string
+		storeErr error
+		status   int
+	}{
+		{"admin disabled", nil, "secret", nil, http.StatusForbidden},
+		{"missing token", map[string]string{"oncall": "secret"}, "", nil, http.StatusUnauthorized},
+		{"wrong token", map[string]string{"oncall": "secret"}, "wrong", nil, http.StatusUnauthorized},
+		{
+			"not found", map[string]string{"oncall": "secret"}, "secret",
+			tagstore.ErrTagNotFound, http.StatusNotFound,
+		}, {
+			"not supported", map[string]string{"oncall": "secret"}, "secret",
+			backenderrors.ErrDeleteNotSupported, http.StatusNotImplemented,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			mocks.config.Admin = AdminConfig{Tokens: test.tokens}
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			if test.storeErr != nil {
+				mocks.store.EXPECT().Delete(tag).Return(core.Digest{}, test.storeErr)
+			}
+
+			err := deleteManifest(addr, tag, test.token)
+			require.True(httputil.IsStatus(err, test.status))
+		})
+	}
+}
+
+func TestDuplicateDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := tagclient.NewSingleClient(addr, nil)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.store.EXPECT().Delete(tag).Return(digest, nil)
+	require.NoError(client.DuplicateDelete(tag, digest, time.Now()))
+
+	// Tags which were never duplicated to the neighbor are not an error.
+	mocks.store.EXPECT().Delete(tag).Return(core.Digest{}, tagstore.ErrTagNotFound)
+	require.NoError(client.DuplicateDelete(tag, digest, time.Now()))
+}
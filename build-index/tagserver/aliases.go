@@ -0,0 +1,209 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagalias"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// putAliasHandler points an alias at an existing tag. If the version query
+// arg is set, the alias is only moved if its current version matches, so
+// concurrent writers cannot silently overwrite each other. Response model
+// tagmodels.Alias.
+func (s *Server) putAliasHandler(w http.ResponseWriter, r *http.Request) error {
+	alias, err := httputil.ParseParam(r, "alias")
+	if err != nil {
+		return err
+	}
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	version := tagmodels.AnyAliasVersion
+	if v := httputil.GetQueryArg(r, tagmodels.VersionQ, ""); v != "" {
+		version, err = strconv.Atoi(v)
+		if err != nil || version < 0 {
+			return handler.Errorf(
+				"invalid %s %q", tagmodels.VersionQ, v).Status(http.StatusBadRequest)
+		}
+	}
+	if err := s.checkFreeze(r, alias); err != nil {
+		return err
+	}
+	if err := s.throttlePush(alias); err != nil {
+		return err
+	}
+
+	if _, err := s.aliases.Get(tag); err == nil {
+		return handler.Errorf(
+			"cannot alias %s to alias %s", alias, tag).Status(http.StatusBadRequest)
+	} else if err != tagalias.ErrAliasNotFound {
+		return handler.Errorf("aliases: %s", err)
+	}
+	d, err := s.store.Get(tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("storage: %s", err)
+	}
+
+	a, err := s.aliases.Set(alias, tag, version)
+	if err != nil {
+		if err == tagalias.ErrVersionConflict {
+			return handler.Errorf(
+				"alias %s is not at version %d", alias, version).Status(http.StatusConflict)
+		}
+		return handler.Errorf("aliases: %s", err)
+	}
+	s.publishAlias(a, d)
+
+	var successes int
+	neighbors := s.neighbors.Resolve()
+	for addr := range neighbors {
+		if err := s.provider.Provide(addr).DuplicatePutAlias(a); err != nil {
+			log.Errorf("Error duplicating alias %s to %s: %s", alias, addr, err)
+		} else {
+			successes++
+		}
+	}
+	if len(neighbors) != 0 && successes == 0 {
+		s.stats.Counter("duplicate_alias_failures").Inc(1)
+	}
+
+	if err := json.NewEncoder(w).Encode(a); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// getAliasHandler returns the current target of an alias. Response model
+// tagmodels.Alias.
+func (s *Server) getAliasHandler(w http.ResponseWriter, r *http.Request) error {
+	alias, err := httputil.ParseParam(r, "alias")
+	if err != nil {
+		return err
+	}
+	a, err := s.aliases.Get(alias)
+	if err != nil {
+		if err == tagalias.ErrAliasNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("aliases: %s", err)
+	}
+	if err := json.NewEncoder(w).Encode(a); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// getAliasHistoryHandler returns every target an alias has pointed at, newest
+// first. Response model []tagmodels.Alias.
+func (s *Server) getAliasHistoryHandler(w http.ResponseWriter, r *http.Request) error {
+	alias, err := httputil.ParseParam(r, "alias")
+	if err != nil {
+		return err
+	}
+	history, err := s.aliases.History(alias)
+	if err != nil {
+		if err == tagalias.ErrAliasNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("aliases: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) duplicatePutAliasHandler(w http.ResponseWriter, r *http.Request) error {
+	alias, err := httputil.ParseParam(r, "alias")
+	if err != nil {
+		return err
+	}
+	var a tagmodels.Alias
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		return handler.Errorf("decode body: %s", err)
+	}
+	if a.Name != alias {
+		return handler.Errorf(
+			"alias %s does not match body %s", alias, a.Name).Status(http.StatusBadRequest)
+	}
+	applied, err := s.aliases.Apply(a)
+	if err != nil {
+		return handler.Errorf("aliases: %s", err)
+	}
+	if applied && s.events.hasSubscribers() {
+		d, err := s.store.Get(a.Target)
+		if err != nil {
+			log.With("alias", alias).Errorf("Error getting alias target digest: %s", err)
+		} else {
+			s.publishAlias(a, d)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// publishAlias notifies event subscribers that alias a now resolves to d.
+// Moving an alias updates what the alias name resolves to, so it is published
+// as an update of the alias name.
+func (s *Server) publishAlias(a tagmodels.Alias, d core.Digest) {
+	s.events.publish(tagmodels.TagEvent{
+		Type:   tagmodels.TagUpdated,
+		Tag:    a.Name,
+		Digest: d,
+		Time:   time.Now(),
+	})
+}
+
+// resolveRequestedAlias resolves tag as resolveAlias does, and marks the
+// response to a request of an alias as uncacheable by nginx, since aliases
+// move without any tag being written.
+func (s *Server) resolveRequestedAlias(w http.ResponseWriter, tag string) (string, error) {
+	target, err := s.resolveAlias(tag)
+	if err != nil {
+		return "", err
+	}
+	if target != tag {
+		w.Header().Set("X-Accel-Expires", "0")
+	}
+	return target, nil
+}
+
+// resolveAlias returns the target of tag if tag is an alias, else tag itself.
+func (s *Server) resolveAlias(tag string) (string, error) {
+	a, err := s.aliases.Get(tag)
+	if err != nil {
+		if err == tagalias.ErrAliasNotFound {
+			return tag, nil
+		}
+		return "", fmt.Errorf("aliases: %s", err)
+	}
+	return a.Target, nil
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutAliasResolvesOnGet(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	alias := core.TagFixture()
+	t1 := core.TagFixture()
+	d1 := core.DigestFixture()
+	t2 := core.TagFixture()
+	d2 := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.store.EXPECT().Get(t1).Return(d1, nil).Times(2)
+	mocks.store.EXPECT().Get(t2).Return(d2, nil).Times(2)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient).Times(2)
+	neighborClient.EXPECT().DuplicatePutAlias(gomock.Any()).Return(nil).Times(2)
+
+	a, err := client.PutAlias(alias, t1, 0)
+	require.NoError(err)
+	require.Equal(1, a.Version)
+
+	result, err := client.Get(alias)
+	require.NoError(err)
+	require.Equal(d1, result)
+
+	_, err = client.PutAlias(alias, t2, 1)
+	require.NoError(err)
+
+	result, err = client.Get(alias)
+	require.NoError(err)
+	require.Equal(d2, result)
+
+	history, err := client.AliasHistory(alias)
+	require.NoError(err)
+	require.Len(history, 2)
+	require.Equal(t2, history[0].Target)
+	require.Equal(t1, history[1].Target)
+}
+
+func TestPutAliasVersionConflict(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	alias := core.TagFixture()
+	tag := core.TagFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.store.EXPECT().Get(tag).Return(core.DigestFixture(), nil).Times(2)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().DuplicatePutAlias(gomock.Any()).Return(nil)
+
+	_, err := client.PutAlias(alias, tag, 0)
+	require.NoError(err)
+
+	_, err = client.PutAlias(alias, tag, 0)
+	require.Equal(tagclient.ErrVersionConflict, err)
+
+	a, err := client.GetAlias(alias)
+	require.NoError(err)
+	require.Equal(1, a.Version)
+}
+
+func TestPutAliasTargetNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	alias := core.TagFixture()
+	tag := core.TagFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound)
+
+	_, err := client.PutAlias(alias, tag, tagmodels.AnyAliasVersion)
+	require.Equal(tagclient.ErrTagNotFound, err)
+
+	_, err = client.GetAlias(alias)
+	require.Equal(tagclient.ErrAliasNotFound, err)
+}
+
+func TestDuplicatePutAliasIgnoresStaleVersions(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := tagclient.NewSingleClient(addr, nil)
+
+	alias := core.TagFixture()
+	t1 := core.TagFixture()
+	t2 := core.TagFixture()
+
+	require.NoError(client.DuplicatePutAlias(tagmodels.Alias{Name: alias, Target: t2, Version: 2}))
+	require.NoError(client.DuplicatePutAlias(tagmodels.Alias{Name: alias, Target: t1, Version: 1}))
+
+	a, err := client.GetAlias(alias)
+	require.NoError(err)
+	require.Equal(t2, a.Target)
+	require.Equal(2, a.Version)
+}
+
+func TestAliasesAreNotCachedByNginx(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := tagclient.NewSingleClient(addr, nil)
+
+	alias := core.TagFixture()
+	tag := core.TagFixture()
+	d := core.DigestFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(d, nil).Times(2)
+
+	require.NoError(client.DuplicatePutAlias(tagmodels.Alias{Name: alias, Target: tag, Version: 1}))
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/tags/%s", addr, url.PathEscape(alias)))
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal("0", resp.Header.Get("X-Accel-Expires"))
+
+	resp, err = http.Get(fmt.Sprintf("http://%s/tags/%s", addr, url.PathEscape(tag)))
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Empty(resp.Header.Get("X-Accel-Expires"))
+}
+
+func TestAliasMovesAreStreamed(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/events", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+
+	alias := core.TagFixture()
+	t1 := core.TagFixture()
+	d1 := core.DigestFixture()
+	t2 := core.TagFixture()
+	d2 := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.store.EXPECT().Get(t1).Return(d1, nil)
+	mocks.store.EXPECT().Get(t2).Return(d2, nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().DuplicatePutAlias(gomock.Any()).Return(nil)
+
+	_, err = newClusterClient(addr).PutAlias(alias, t1, 0)
+	require.NoError(err)
+	e := readEvent(t, events)
+	require.Equal(tagmodels.TagUpdated, e.Type)
+	require.Equal(alias, e.Tag)
+	require.Equal(d1, e.Digest)
+
+	// Aliases moved through neighbors are streamed as well.
+	require.NoError(tagclient.NewSingleClient(addr, nil).DuplicatePutAlias(
+		tagmodels.Alias{Name: alias, Target: t2, Version: 2}))
+	e = readEvent(t, events)
+	require.Equal(tagmodels.TagUpdated, e.Type)
+	require.Equal(alias, e.Tag)
+	require.Equal(d2, e.Digest)
+}
@@ -16,6 +16,7 @@ package tagserver
 import (
 	"time"
 
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/utils/listener"
 )
 
@@ -24,6 +25,32 @@ type Config struct {
 	Listener                  listener.Config `yaml:"listener"`
 	DuplicateReplicateStagger time.Duration   `yaml:"duplicate_replicate_stagger"`
 	DuplicatePutStagger       time.Duration   `yaml:"duplicate_put_stagger"`
+
+	// EventBufferSize is the number of tag events buffered per events stream
+	// subscriber before the subscriber is disconnected.
+	EventBufferSize int `yaml:"event_buffer_size"`
+
+	// EventHeartbeatInterval is the interval at which idle events streams are
+	// sent heartbeats.
+	EventHeartbeatInterval time.Duration `yaml:"event_heartbeat_interval"`
+
+	// PushLimits limits the rate at which tags and aliases are put.
+	PushLimits PushLimitConfig `yaml:"push_limits"`
+
+	// Freezes rejects tag and alias puts during freeze windows.
+	Freezes FreezeConfig `yaml:"freezes"`
+
+	// Lineage configures which tags are indexed into the lineage graph.
+	Lineage LineageConfig `yaml:"lineage"`
+
+	// Compression compresses json listings, e.g. repository tags.
+	Compression middleware.CompressConfig `yaml:"compression"`
+
+	// Consistency configures read-your-writes gets of tags.
+	Consistency ConsistencyConfig `yaml:"consistency"`
+
+	// Admin authorizes destructive operations, e.g. deleting tags.
+	Admin AdminConfig `yaml:"admin"`
 }
 
 func (c Config) applyDefaults() Config {
@@ -33,5 +60,12 @@ func (c Config) applyDefaults() Config {
 	if c.DuplicatePutStagger == 0 {
 		c.DuplicatePutStagger = 20 * time.Minute
 	}
+	if c.EventBufferSize == 0 {
+		c.EventBufferSize = 1000
+	}
+	if c.EventHeartbeatInterval == 0 {
+		c.EventHeartbeatInterval = 15 * time.Second
+	}
+	c.Consistency = c.Consistency.applyDefaults()
 	return c
 }
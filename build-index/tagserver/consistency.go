@@ -0,0 +1,280 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/cenkalti/backoff"
+)
+
+// ConsistencyConfig defines how gets presenting consistency tokens catch up
+// with puts which have not yet replicated to this build-index.
+type ConsistencyConfig struct {
+	// AdvertiseAddr is the address of this build-index as listed in the
+	// cluster config of its neighbors. Lagging neighbors route gets to the
+	// build-index which issued their token.
+	AdvertiseAddr string `yaml:"advertise_addr"`
+
+	// MaxWait is how long gets wait for puts to replicate when the
+	// build-index which issued their token cannot be reached.
+	MaxWait time.Duration `yaml:"max_wait"`
+
+	// PollInterval is the initial interval at which waiting gets check
+	// whether puts have replicated. The interval doubles after each check, up
+	// to MaxPollInterval.
+	PollInterval    time.Duration `yaml:"poll_interval"`
+	MaxPollInterval time.Duration `yaml:"max_poll_interval"`
+
+	// WriteRetention is how long writes of tags are remembered, such that
+	// gets presenting tokens of older puts observe newer puts of the tag.
+	WriteRetention time.Duration `yaml:"write_retention"`
+}
+
+func (c ConsistencyConfig) applyDefaults() ConsistencyConfig {
+	if c.MaxWait == 0 {
+		c.MaxWait = 5 * time.Second
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = 100 * time.Millisecond
+	}
+	if c.MaxPollInterval == 0 {
+		c.MaxPollInterval = time.Second
+	}
+	if c.WriteRetention == 0 {
+		c.WriteRetention = 10 * time.Minute
+	}
+	return c
+}
+
+// consistencyToken identifies a tag put.
+type consistencyToken struct {
+	Tag    string      `json:"tag"`
+	Digest core.Digest `json:"digest"`
+
+	// Issuer is the advertised address of the build-index which accepted the
+	// put. Empty if unknown.
+	Issuer string `json:"issuer,omitempty"`
+
+	// Version is the time the put was accepted by the issuer, in nanoseconds
+	// since the epoch. Any write of the tag at least this new observes the
+	// put. Versions of writes are assigned by the build-index which accepted
+	// them, and carried to its neighbors along with duplicated writes, such
+	// that the local clocks of lagging build-indexes do not matter. Concurrent
+	// writes of a tag accepted by different build-indexes are ordered by the
+	// clocks of those build-indexes.
+	Version int64 `json:"version"`
+}
+
+func (t consistencyToken) encode() (string, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeConsistencyToken(s string) (consistencyToken, error) {
+	var t consistencyToken
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return t, fmt.Errorf("base64: %s", err)
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return t, fmt.Errorf("json: %s", err)
+	}
+	return t, nil
+}
+
+// tagWrites remembers the versions of the latest writes and deletes of tags
+// on a build-index, such that tags which have since been overwritten can be
+// told apart from tags which have not yet replicated.
+type tagWrites struct {
+	retention time.Duration
+
+	mu        sync.Mutex
+	writes    map[string]time.Time
+	lastSweep time.Time
+}
+
+func newTagWrites(config ConsistencyConfig) *tagWrites {
+	return &tagWrites{
+		retention: config.WriteRetention,
+		writes:    make(map[string]time.Time),
+	}
+}
+
+// record records a write of tag accepted at now.
+func (w *tagWrites) record(tag string, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sweep(now)
+	if now.After(w.writes[tag]) {
+		w.writes[tag] = now
+	}
+}
+
+// since returns whether tag was written at or after version.
+func (w *tagWrites) since(tag string, version time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	t, ok := w.writes[tag]
+	return ok && !t.Before(version)
+}
+
+// sweep forgets writes older than the retention. Must be called with mu held.
+func (w *tagWrites) sweep(now time.Time) {
+	if now.Sub(w.lastSweep) < w.retention {
+		return
+	}
+	w.lastSweep = now
+	for tag, t := range w.writes {
+		if now.Sub(t) >= w.retention {
+			delete(w.writes, tag)
+		}
+	}
+}
+
+// writeVersion returns the time a duplicated write was accepted, given its
+// version in nanoseconds since the epoch. Writes duplicated by build-indexes
+// which predate versions are assumed to have been accepted just now.
+func writeVersion(version int64) time.Time {
+	if version == 0 {
+		return time.Now()
+	}
+	return time.Unix(0, version)
+}
+
+// issueConsistencyToken returns a token for the put of tag to d, accepted at
+// version, in the response header of w.
+func (s *Server) issueConsistencyToken(
+	w http.ResponseWriter, tag string, d core.Digest, version time.Time) error {
+
+	token, err := consistencyToken{
+		Tag:     tag,
+		Digest:  d,
+		Issuer:  s.config.Consistency.AdvertiseAddr,
+		Version: version.UnixNano(),
+	}.encode()
+	if err != nil {
+		return handler.Errorf("encode consistency token: %s", err)
+	}
+	w.Header().Set(tagmodels.ConsistencyTokenHeader, token)
+	return nil
+}
+
+// getConsistentTag resolves tag, guaranteeing the result reflects the put
+// identified by the consistency token of r, if any. Puts which have not yet
+// replicated to s are served by the build-index which accepted them, or else
+// waited for.
+func (s *Server) getConsistentTag(r *http.Request, tag string) (core.Digest, error) {
+	d, err := s.store.Get(tag)
+	raw := r.Header.Get(tagmodels.ConsistencyTokenHeader)
+	if raw == "" {
+		return d, err
+	}
+	t, terr := decodeConsistencyToken(raw)
+	if terr != nil {
+		return core.Digest{}, handler.Errorf(
+			"decode consistency token: %s", terr).Status(http.StatusBadRequest)
+	}
+	if t.Tag != tag {
+		return core.Digest{}, handler.Errorf(
+			"consistency token is for %s, not %s", t.Tag, tag).Status(http.StatusBadRequest)
+	}
+	if err != nil && err != tagstore.ErrTagNotFound {
+		return d, err
+	}
+	if s.observed(t, d, err) {
+		return d, err
+	}
+	s.stats.Counter("lagging_consistent_gets").Inc(1)
+
+	// Tokens are presented by clients, so gets are only routed to known
+	// neighbors.
+	if t.Issuer != "" && s.neighbors.Resolve().Has(t.Issuer) {
+		d, err := s.provider.Provide(t.Issuer).Get(tag)
+		if err == nil {
+			s.stats.Counter("routed_consistent_gets").Inc(1)
+			return d, nil
+		}
+		log.With("tag", tag, "issuer", t.Issuer).Errorf(
+			"Error routing consistent get to issuer: %s", err)
+	}
+	return s.waitForTag(t)
+}
+
+// observed returns whether the result d, err of getting the tag of t from s
+// reflects the put identified by t. err must be nil or tagstore.ErrTagNotFound.
+func (s *Server) observed(t consistencyToken, d core.Digest, err error) bool {
+	if t.Issuer == s.config.Consistency.AdvertiseAddr {
+		// s accepted the put and has therefore observed it and any later put.
+		return true
+	}
+	if err != nil {
+		// Only a delete at least as new as the put removes the tag.
+		return s.writes.since(t.Tag, time.Unix(0, t.Version))
+	}
+	// Either the put already replicated, or a put at least as new since
+	// overwrote it.
+	return d == t.Digest || s.writes.since(t.Tag, time.Unix(0, t.Version))
+}
+
+// waitForTag polls the store, backing off exponentially, until it observes the
+// put identified by t. Returns 503 if it does not within the configured max
+// wait.
+func (s *Server) waitForTag(t consistencyToken) (core.Digest, error) {
+	timer := time.NewTimer(s.config.Consistency.MaxWait)
+	defer timer.Stop()
+	b := &backoff.ExponentialBackOff{
+		InitialInterval:     s.config.Consistency.PollInterval,
+		RandomizationFactor: 0.05,
+		Multiplier:          2,
+		MaxInterval:         s.config.Consistency.MaxPollInterval,
+		Clock:               backoff.SystemClock,
+	}
+	b.Reset()
+	for {
+		poll := time.NewTimer(b.NextBackOff())
+		select {
+		case <-poll.C:
+			d, err := s.store.Get(t.Tag)
+			if err != nil && err != tagstore.ErrTagNotFound {
+				return core.Digest{}, err
+			}
+			if s.observed(t, d, err) {
+				return d, err
+			}
+		case <-timer.C:
+			poll.Stop()
+			s.stats.Counter("inconsistent_gets").Inc(1)
+			return core.Digest{}, handler.Errorf(
+				"put of %s to %s has not yet replicated", t.Tag, t.Digest).
+				Status(http.StatusServiceUnavailable)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+const _testAdvertiseAddr = "this-build-index:3000"
+
+func consistencyConfigFixture() ConsistencyConfig {
+	return ConsistencyConfig{
+		AdvertiseAddr: _testAdvertiseAddr,
+		MaxWait:       500 * time.Millisecond,
+		PollInterval:  10 * time.Millisecond,
+	}
+}
+
+func consistencyTokenFixture(tag string, d core.Digest, issuer string) string {
+	token, err := consistencyToken{
+		Tag:     tag,
+		Digest:  d,
+		Issuer:  issuer,
+		Version: time.Now().UnixNano(),
+	}.encode()
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// getConsistent gets tag from addr, presenting token.
+func getConsistent(addr, tag, token string) (core.Digest, error) {
+	return tagclient.NewSingleClient(addr, nil).GetConsistent(tag, token)
+}
+
+func TestPutIssuesConsistencyToken(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Consistency = consistencyConfigFixture()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().DuplicatePut(tag, digest, gomock.Any(), gomock.Any()).Return(nil)
+
+	start := time.Now()
+	resp, err := httputil.Put(
+		fmt.Sprintf("http://%s/tags/%s/digest/%s", addr, url.PathEscape(tag), digest))
+	require.NoError(err)
+
+	token, err := decodeConsistencyToken(resp.Header.Get(tagmodels.ConsistencyTokenHeader))
+	require.NoError(err)
+	require.Equal(tag, token.Tag)
+	require.Equal(digest, token.Digest)
+	require.Equal(_testAdvertiseAddr, token.Issuer)
+	require.True(token.Version >= start.UnixNano())
+	require.True(token.Version <= time.Now().UnixNano())
+}
+
+func TestConsistentGetServesReplicatedPut(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Consistency = consistencyConfigFixture()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+
+	result, err := getConsistent(addr, tag, consistencyTokenFixture(tag, digest, _testNeighbor))
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestConsistentGetOnIssuerServesLaterPuts(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Consistency = consistencyConfigFixture()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	later := core.DigestFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(later, nil)
+
+	result, err := getConsistent(addr, tag, consistencyTokenFixture(tag, digest, _testAdvertiseAddr))
+	require.NoError(err)
+	require.Equal(later, result)
+}
+
+func TestConsistentGetServesNewerPuts(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Consistency = consistencyConfigFixture()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	later := core.DigestFixture()
+
+	// The put of digest has not replicated to this build-index, but a later
+	// put of the tag has.
+	token := consistencyTokenFixture(tag, digest, _testNeighbor)
+
+	mocks.store.EXPECT().Put(tag, later, time.Duration(0)).Return(nil)
+	require.NoError(tagclient.NewSingleClient(addr, nil).DuplicatePut(tag, later, 0, time.Now()))
+
+	mocks.store.EXPECT().Get(tag).Return(later, nil)
+
+	result, err := getConsistent(addr, tag, token)
+	require.NoError(err)
+	require.Equal(later, result)
+}
+
+func TestConsistentGetWaitsForPutsNewerThanOlderWrites(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Consistency = consistencyConfigFixture()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	stale := core.DigestFixture()
+	digest := core.DigestFixture()
+
+	mocks.store.EXPECT().Put(tag, stale, time.Duration(0)).Return(nil)
+	require.NoError(tagclient.NewSingleClient(addr, nil).DuplicatePut(tag, stale, 0, time.Now()))
+
+	// The put of digest happened after the last write this build-index
+	// observed.
+	token := consistencyTokenFixture(tag, digest, "unknown-build-index:3000")
+
+	gomock.InOrder(
+		mocks.store.EXPECT().Get(tag).Return(stale, nil).Times(2),
+		mocks.store.EXPECT().Get(tag).Return(digest, nil),
+	)
+
+	result, err := getConsistent(addr, tag, token)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestConsistentGetOrdersDuplicatedWritesByIssuerVersion(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Consistency = consistencyConfigFixture()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	older := core.DigestFixture()
+	digest := core.DigestFixture()
+
+	token := consistencyTokenFixture(tag, digest, "unknown-build-index:3000")
+
+	// The put of older was accepted by a neighbor before the put of digest,
+	// but only replicates to this build-index after the token was issued.
+	mocks.store.EXPECT().Put(tag, older, time.Duration(0)).Return(nil)
+	require.NoError(tagclient.NewSingleClient(addr, nil).DuplicatePut(
+		tag, older, 0, time.Now().Add(-time.Minute)))
+
+	gomock.InOrder(
+		mocks.store.EXPECT().Get(tag).Return(older, nil).Times(2),
+		mocks.store.EXPECT().Get(tag).Return(digest, nil),
+	)
+
+	result, err := getConsistent(addr, tag, token)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestTagWrites(t *testing.T) {
+	require := require.New(t)
+
+	w := newTagWrites(ConsistencyConfig{WriteRetention: time.Minute})
+
+	tag := core.TagFixture()
+	now := time.Now()
+
+	require.False(w.since(tag, now))
+
+	w.record(tag, now)
+	require.True(w.since(tag, now.Add(-time.Second)))
+	require.True(w.since(tag, now))
+	require.False(w.since(tag, now.Add(time.Second)))
+
+	// Older writes do not replace newer ones.
+	w.record(tag, now.Add(-time.Second))
+	require.True(w.since(tag, now))
+
+	// Writes are forgotten once older than the retention.
+	w.record(core.TagFixture(), now.Add(time.Minute))
+	require.False(w.since(tag, now))
+}
+
+func TestConsistentGetRoutesToIssuer(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Consistency = consistencyConfigFixture()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	stale := core.DigestFixture()
+	digest := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.store.EXPECT().Get(tag).Return(stale, nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().Get(tag).Return(digest, nil)
+
+	result, err := getConsistent(addr, tag, consistencyTokenFixture(tag, digest, _testNeighbor))
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestConsistentGetWaitsForReplication(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Consistency = consistencyConfigFixture()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	// Tokens of unknown issuers, e.g. build-indexes of other clusters, are
+	// never routed to.
+	token := consistencyTokenFixture(tag, digest, "unknown-build-index:3000")
+
+	gomock.InOrder(
+		mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound).Times(3),
+		mocks.store.EXPECT().Get(tag).Return(digest, nil),
+	)
+
+	result, err := getConsistent(addr, tag, token)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestConsistentGetUnavailableUntilReplicated(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Consistency = consistencyConfigFixture()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	stale := core.DigestFixture()
+	digest := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.store.EXPECT().Get(tag).Return(stale, nil).MinTimes(1)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().Get(tag).Return(core.Digest{}, errors.New("some error"))
+
+	_, err := getConsistent(addr, tag, consistencyTokenFixture(tag, digest, _testNeighbor))
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+}
+
+func TestConsistentGetRejectsInvalidTokens(t *testing.T) {
+	tag := core.TagFixture()
+
+	tests := []struct {
+		desc  string
+		token string
+	}{
+		{"malformed", "not a token"},
+		{"other tag", consistencyTokenFixture(core.TagFixture(), core.DigestFixture(), "")},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			mocks.store.EXPECT().Get(tag).Return(core.DigestFixture(), nil)
+
+			_, err := getConsistent(addr, tag, test.token)
+			require.Error(t, err)
+			require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// inNamespace returns true if tag belongs to namespace, i.e. if the repository
+// of tag is namespace or is nested under namespace. All tags belong to the
+// empty namespace.
+func inNamespace(tag, namespace string) bool {
+	if namespace == "" {
+		return true
+	}
+	repo := strings.SplitN(tag, ":", 2)[0]
+	return repo == namespace || strings.HasPrefix(repo, namespace+"/")
+}
+
+type subscriber struct {
+	namespace string
+	events    chan tagmodels.TagEvent
+}
+
+// eventBroker fans out tag events to subscribers. Subscribers which fall too
+// far behind are disconnected rather than blocking tag writes, such that they
+// can reconnect and resync from the catalog.
+type eventBroker struct {
+	stats tally.Scope
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+func newEventBroker(stats tally.Scope) *eventBroker {
+	return &eventBroker{
+		stats:       stats,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+func (b *eventBroker) subscribe(namespace string, bufferSize int) *subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscriber{namespace, make(chan tagmodels.TagEvent, bufferSize)}
+	b.subscribers[sub] = struct{}{}
+	b.stats.Gauge("event_subscribers").Update(float64(len(b.subscribers)))
+	return sub
+}
+
+func (b *eventBroker) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+	b.stats.Gauge("event_subscribers").Update(float64(len(b.subscribers)))
+}
+
+func (b *eventBroker) hasSubscribers() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers) > 0
+}
+
+func (b *eventBroker) publish(e tagmodels.TagEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if !inNamespace(e.Tag, sub.namespace) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			log.Warnf("Disconnecting slow tag event subscriber of namespace %q", sub.namespace)
+			b.stats.Counter("event_subscribers_dropped").Inc(1)
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// publishPut prepares an event for tag being put as d, returning a function
+// which publishes the event once the put succeeds. Must be called before the
+// tag is written, such that created and updated tags can be told apart. The
+// previous digest is only looked up if anyone is listening.
+func (s *Server) publishPut(tag string, d core.Digest) func() {
+	if !s.events.hasSubscribers() {
+		return func() {}
+	}
+	eventType := tagmodels.TagUpdated
+	prev, err := s.store.Get(tag)
+	if err == tagstore.ErrTagNotFound {
+		eventType = tagmodels.TagCreated
+	} else if err != nil {
+		log.With("tag", tag).Errorf("Error getting previous tag digest: %s", err)
+	} else if prev == d {
+		// Tag is unchanged.
+		return func() {}
+	}
+	return func() {
+		s.events.publish(tagmodels.TagEvent{Type: eventType, Tag: tag, Digest: d, Time: time.Now()})
+	}
+}
+
+// eventsHandler streams tag events as server-sent events, optionally filtered
+// to the "namespace" query arg.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return handler.Errorf("streaming not supported")
+	}
+	namespace := r.URL.Query().Get("namespace")
+
+	sub := s.events.subscribe(namespace, s.config.EventBufferSize)
+	defer s.events.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keeps nginx from buffering events until its buffers fill.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(s.config.EventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-heartbeat.C:
+			// Comment lines keep idle connections from being closed by proxies.
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e, ok := <-sub.events:
+			if !ok {
+				// Subscriber fell behind and was disconnected.
+				return nil
+			}
+			b, err := json.Marshal(e)
+			if err != nil {
+				return handler.Errorf("json marshal: %s", err)
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+		}
+		flusher.Flush()
+	}
+}
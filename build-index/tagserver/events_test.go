@@ -0,0 +1,168 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// readEvent reads the next event from an events stream, skipping heartbeats.
+func readEvent(t *testing.T, r *bufio.Reader) tagmodels.TagEvent {
+	var eventType string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if strings.HasPrefix(line, "event: ") {
+			eventType = strings.TrimPrefix(line, "event: ")
+		} else if strings.HasPrefix(line, "data: ") {
+			var e tagmodels.TagEvent
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e))
+			require.Equal(t, eventType, e.Type)
+			return e
+		}
+	}
+}
+
+func TestEventsStreamsTagPuts(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/events?namespace=namespace-foo", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+	require.Equal("no", resp.Header.Get("X-Accel-Buffering"))
+	events := bufio.NewReader(resp.Body)
+
+	client := newClusterClient(addr)
+	tag := core.TagFixture()
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.depResolver.EXPECT().Resolve(tag, gomock.Any()).Return(nil, nil).Times(2)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient).Times(2)
+	neighborClient.EXPECT().DuplicatePut(tag, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	gomock.InOrder(
+		mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound),
+		mocks.store.EXPECT().Put(tag, d1, time.Duration(0)).Return(nil),
+		mocks.store.EXPECT().Get(tag).Return(d1, nil),
+		mocks.store.EXPECT().Put(tag, d2, time.Duration(0)).Return(nil),
+	)
+
+	require.NoError(client.Put(tag, d1))
+	e := readEvent(t, events)
+	require.Equal(tagmodels.TagCreated, e.Type)
+	require.Equal(tag, e.Tag)
+	require.Equal(d1, e.Digest)
+
+	require.NoError(client.Put(tag, d2))
+	e = readEvent(t, events)
+	require.Equal(tagmodels.TagUpdated, e.Type)
+	require.Equal(d2, e.Digest)
+}
+
+func TestEventsStreamsDuplicatedPutsAndDeletes(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/events", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+
+	client := tagclient.NewSingleClient(addr, nil)
+	tag := core.TagFixture()
+	d := core.DigestFixture()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound),
+		mocks.store.EXPECT().Put(tag, d, time.Duration(0)).Return(nil),
+		mocks.store.EXPECT().Delete(tag).Return(d, nil),
+	)
+
+	// Tags written through neighbors are streamed by every build-index.
+	require.NoError(client.DuplicatePut(tag, d, 0, time.Now()))
+	e := readEvent(t, events)
+	require.Equal(tagmodels.TagCreated, e.Type)
+	require.Equal(d, e.Digest)
+
+	require.NoError(client.DuplicateDelete(tag, d, time.Now()))
+	e = readEvent(t, events)
+	require.Equal(tagmodels.TagDeleted, e.Type)
+	require.Equal(tag, e.Tag)
+	require.Equal(d, e.Digest)
+}
+
+func TestEventBrokerFiltersNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	b := newEventBroker(tally.NoopScope)
+	foo := b.subscribe("foo", 10)
+	all := b.subscribe("", 10)
+
+	b.publish(tagmodels.TagEvent{Tag: "foo/bar:latest"})
+	b.publish(tagmodels.TagEvent{Tag: "foobar/baz:latest"})
+
+	require.Len(foo.events, 1)
+	require.Len(all.events, 2)
+}
+
+func TestEventBrokerDisconnectsSlowSubscribers(t *testing.T) {
+	require := require.New(t)
+
+	b := newEventBroker(tally.NoopScope)
+	sub := b.subscribe("", 1)
+
+	b.publish(tagmodels.TagEvent{Tag: "foo/bar:1"})
+	b.publish(tagmodels.TagEvent{Tag: "foo/bar:2"})
+
+	_, ok := <-sub.events
+	require.True(ok)
+	_, ok = <-sub.events
+	require.False(ok)
+	require.False(b.hasSubscribers())
+
+	// Unsubscribing a disconnected subscriber is a no-op.
+	b.unsubscribe(sub)
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// FreezeOverrideHeader carries an override token, which allows writes during
+// freeze windows.
+const FreezeOverrideHeader = "Kraken-Freeze-Override"
+
+// FreezeConfig defines windows during which tag writes are rejected, e.g.
+// holiday code freezes.
+type FreezeConfig struct {
+	Windows []FreezeWindow `yaml:"windows"`
+
+	// OverrideTokens maps the names of holders of tokens which override
+	// freezes to their tokens. Every override is audit logged with the holder
+	// name.
+	OverrideTokens map[string]string `yaml:"override_tokens"`
+}
+
+// FreezeWindow rejects writes to tags matching any of the Namespaces regexes
+// between Start (inclusive) and End (exclusive).
+type FreezeWindow struct {
+	Name       string    `yaml:"name" json:"name"`
+	Namespaces []string  `yaml:"namespaces" json:"namespaces"`
+	Start      time.Time `yaml:"start" json:"start"`
+	End        time.Time `yaml:"end" json:"end"`
+}
+
+type freezeWindow struct {
+	FreezeWindow
+	res []*regexp.Regexp
+}
+
+func (w freezeWindow) match(tag string, now time.Time) bool {
+	if now.Before(w.Start) || !now.Before(w.End) {
+		return false
+	}
+	for _, re := range w.res {
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// freezer enforces FreezeConfig.
+type freezer struct {
+	windows   []freezeWindow
+	overrides map[string]string
+}
+
+func newFreezer(config FreezeConfig) *freezer {
+	f := &freezer{overrides: config.OverrideTokens}
+	for _, w := range config.Windows {
+		if !w.Start.Before(w.End) {
+			log.Errorf("Ignoring freeze window %q which ends before it starts", w.Name)
+			continue
+		}
+		fw := freezeWindow{FreezeWindow: w}
+		for _, n := range w.Namespaces {
+			re, err := regexp.Compile(n)
+			if err != nil {
+				log.Errorf("Ignoring invalid namespace %q of freeze window %q: %s", n, w.Name, err)
+				continue
+			}
+			fw.res = append(fw.res, re)
+		}
+		f.windows = append(f.windows, fw)
+	}
+	return f
+}
+
+// frozen returns the window which freezes tag at now, if any.
+func (f *freezer) frozen(tag string, now time.Time) (FreezeWindow, bool) {
+	for _, w := range f.windows {
+		if w.match(tag, now) {
+			return w.FreezeWindow, true
+		}
+	}
+	return FreezeWindow{}, false
+}
+
+// active returns the windows which have not ended at now.
+func (f *freezer) active(now time.Time) []FreezeWindow {
+	windows := []FreezeWindow{}
+	for _, w := range f.windows {
+		if now.Before(w.End) {
+			windows = append(windows, w.FreezeWindow)
+		}
+	}
+	return windows
+}
+
+// holder returns the holder of override token.
+func (f *freezer) holder(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	for holder, t := range f.overrides {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return holder, true
+		}
+	}
+	return "", false
+}
+
+// checkFreeze returns 403 if tag is frozen, unless r presents an override
+// token. Overrides are audit logged.
+func (s *Server) checkFreeze(r *http.Request, tag string) error {
+	w, ok := s.freezes.frozen(tag, time.Now())
+	if !ok {
+		return nil
+	}
+	holder, ok := s.freezes.holder(r.Header.Get(FreezeOverrideHeader))
+	if !ok {
+		s.stats.Counter("frozen_writes").Inc(1)
+		return handler.Errorf(
+			"%s is frozen by %q until %s, writes require a %s header",
+			tag, w.Name, w.End.Format(time.RFC3339), FreezeOverrideHeader).
+			Status(http.StatusForbidden)
+	}
+	s.stats.Counter("freeze_overrides").Inc(1)
+	log.With(
+		"tag", tag,
+		"window", w.Name,
+		"holder", holder,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"remote_addr", r.RemoteAddr).Warn("Freeze window overridden")
+	return nil
+}
+
+// getFreezesHandler returns the freeze windows which have not ended.
+func (s *Server) getFreezesHandler(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.freezes.active(time.Now())); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreezerFrozen(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+
+	f := newFreezer(FreezeConfig{
+		Windows: []FreezeWindow{{
+			Name:       "holidays",
+			Namespaces: []string{"^prod/.*"},
+			Start:      now.Add(-time.Hour),
+			End:        now.Add(time.Hour),
+		}},
+	})
+
+	w, ok := f.frozen("prod/foo:1", now)
+	require.True(ok)
+	require.Equal("holidays", w.Name)
+
+	_, ok = f.frozen("ci/foo:1", now)
+	require.False(ok)
+
+	_, ok = f.frozen("prod/foo:1", now.Add(-2*time.Hour))
+	require.False(ok)
+
+	_, ok = f.frozen("prod/foo:1", now.Add(time.Hour))
+	require.False(ok)
+}
+
+func TestFreezerIgnoresInvalidWindows(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+
+	f := newFreezer(FreezeConfig{
+		Windows: []FreezeWindow{{
+			Name:       "backwards",
+			Namespaces: []string{".*"},
+			Start:      now.Add(time.Hour),
+			End:        now.Add(-time.Hour),
+		}, {
+			Name:       "invalid namespace",
+			Namespaces: []string{"("},
+			Start:      now.Add(-time.Hour),
+			End:        now.Add(time.Hour),
+		}},
+	})
+
+	_, ok := f.frozen("foo:1", now)
+	require.False(ok)
+}
+
+func TestFreezerHolder(t *testing.T) {
+	require := require.New(t)
+
+	f := newFreezer(FreezeConfig{
+		OverrideTokens: map[string]string{"release-team": "secret"},
+	})
+
+	holder, ok := f.holder("secret")
+	require.True(ok)
+	require.Equal("release-team", holder)
+
+	_, ok = f.holder("wrong")
+	require.False(ok)
+
+	_, ok = f.holder("")
+	require.False(ok)
+}
+
+func TestPutTagDuringFreeze(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Freezes = FreezeConfig{
+		Windows: []FreezeWindow{{
+			Name:       "holidays",
+			Namespaces: []string{".*"},
+			Start:      time.Now().Add(-time.Hour),
+			End:        time.Now().Add(time.Hour),
+		}},
+		OverrideTokens: map[string]string{"release-team": "secret"},
+	}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	u := fmt.Sprintf("http://%s/tags/%s/digest/%s", addr, url.PathEscape(tag), digest)
+
+	_, err := httputil.Put(u)
+	require.True(httputil.IsForbidden(err))
+
+	_, err = httputil.Put(u, httputil.SendHeaders(map[string]string{
+		FreezeOverrideHeader: "wrong",
+	}))
+	require.True(httputil.IsForbidden(err))
+
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().DuplicatePut(tag, digest, gomock.Any(), gomock.Any()).Return(nil)
+
+	_, err = httputil.Put(u, httputil.SendHeaders(map[string]string{
+		FreezeOverrideHeader: "secret",
+	}))
+	require.NoError(err)
+}
+
+func TestGetFreezes(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	current := FreezeWindow{
+		Name:       "current",
+		Namespaces: []string{".*"},
+		Start:      now.Add(-time.Hour),
+		End:        now.Add(time.Hour),
+	}
+	mocks.config.Freezes = FreezeConfig{
+		Windows: []FreezeWindow{current, {
+			Name:       "ended",
+			Namespaces: []string{".*"},
+			Start:      now.Add(-2 * time.Hour),
+			End:        now.Add(-time.Hour),
+		}},
+	}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/freezes", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var windows []FreezeWindow
+	require.NoError(json.NewDecoder(resp.Body).Decode(&windows))
+	require.Len(windows, 1)
+	require.Equal(current.Name, windows[0].Name)
+	require.True(current.End.Equal(windows[0].End))
+}
@@ -0,0 +1,420 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// Manifest annotations which name the base of an image.
+const (
+	_baseNameAnnotation   = "org.opencontainers.image.base.name"
+	_baseDigestAnnotation = "org.opencontainers.image.base.digest"
+)
+
+// LineageConfig configures the lineage graph served by GET /lineage/{tag}.
+type LineageConfig struct {
+	// Namespaces are regexes of tags whose docker manifests are indexed into
+	// the lineage graph. Lineage is disabled if empty.
+	Namespaces []string `yaml:"namespaces"`
+}
+
+// lineageImage is an image indexed into the lineage graph.
+type lineageImage struct {
+	tag    string
+	digest core.Digest
+	layers []core.Digest
+
+	// Annotated base, if any. baseName is normalized to a tag.
+	baseName   string
+	baseDigest *core.Digest
+}
+
+func (img *lineageImage) root() (core.Digest, bool) {
+	if len(img.layers) == 0 {
+		return core.Digest{}, false
+	}
+	return img.layers[0], true
+}
+
+// extends returns true if the layers of img strictly extend those of base.
+func (img *lineageImage) extends(base *lineageImage) bool {
+	if len(base.layers) == 0 || len(base.layers) >= len(img.layers) {
+		return false
+	}
+	for i, l := range base.layers {
+		if img.layers[i] != l {
+			return false
+		}
+	}
+	return true
+}
+
+func (img *lineageImage) sameLayers(o *lineageImage) bool {
+	if len(img.layers) != len(o.layers) {
+		return false
+	}
+	for i, l := range img.layers {
+		if o.layers[i] != l {
+			return false
+		}
+	}
+	return true
+}
+
+// lineageGraph indexes images by their bottom layer and annotated base, such
+// that bases and descendants are found without scanning every image. The graph
+// is kept in memory: it covers tags put since startup, plus tags indexed
+// lazily when their lineage is requested.
+type lineageGraph struct {
+	namespaces []*regexp.Regexp
+
+	mu     sync.RWMutex
+	images map[string]*lineageImage
+	byRoot map[core.Digest]map[string]*lineageImage
+	byBase map[string]map[string]*lineageImage
+}
+
+func newLineageGraph(config LineageConfig) *lineageGraph {
+	g := &lineageGraph{
+		images: make(map[string]*lineageImage),
+		byRoot: make(map[core.Digest]map[string]*lineageImage),
+		byBase: make(map[string]map[string]*lineageImage),
+	}
+	for _, ns := range config.Namespaces {
+		re, err := regexp.Compile(ns)
+		if err != nil {
+			log.Errorf("Ignoring lineage of invalid namespace %q: %s", ns, err)
+			continue
+		}
+		g.namespaces = append(g.namespaces, re)
+	}
+	return g
+}
+
+// indexes returns true if tag is indexed into g.
+func (g *lineageGraph) indexes(tag string) bool {
+	for _, re := range g.namespaces {
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *lineageGraph) get(tag string) *lineageImage {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.images[tag]
+}
+
+// add adds img to g, replacing any previous image of the same tag.
+func (g *lineageGraph) add(img *lineageImage) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.unlink(img.tag)
+	g.images[img.tag] = img
+	if r, ok := img.root(); ok {
+		if g.byRoot[r] == nil {
+			g.byRoot[r] = make(map[string]*lineageImage)
+		}
+		g.byRoot[r][img.tag] = img
+	}
+	if img.baseName != "" {
+		if g.byBase[img.baseName] == nil {
+			g.byBase[img.baseName] = make(map[string]*lineageImage)
+		}
+		g.byBase[img.baseName][img.tag] = img
+	}
+}
+
+// remove removes the image of tag from g, if any.
+func (g *lineageGraph) remove(tag string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.unlink(tag)
+}
+
+// unlink removes the image of tag from every index of g. Must be called with
+// g.mu held.
+func (g *lineageGraph) unlink(tag string) {
+	prev, ok := g.images[tag]
+	if !ok {
+		return
+	}
+	delete(g.images, tag)
+	if r, ok := prev.root(); ok {
+		delete(g.byRoot[r], prev.tag)
+		if len(g.byRoot[r]) == 0 {
+			delete(g.byRoot, r)
+		}
+	}
+	if prev.baseName != "" {
+		delete(g.byBase[prev.baseName], prev.tag)
+		if len(g.byBase[prev.baseName]) == 0 {
+			delete(g.byBase, prev.baseName)
+		}
+	}
+}
+
+// parent returns the direct base of img. An annotated base takes precedence,
+// in which case the returned image is nil if the base is not indexed.
+// Otherwise the base is the image whose layers img extends the furthest, where
+// ties between tags of the same layers are broken by tag. Must be called with
+// g.mu held.
+func (g *lineageGraph) parent(img *lineageImage) (*lineageImage, tagmodels.LineageImage, bool) {
+	if img.baseName != "" && img.baseName != img.tag {
+		if base, ok := g.images[img.baseName]; ok {
+			return base, newLineageImage(base, tagmodels.LineageByAnnotation), true
+		}
+		return nil, tagmodels.LineageImage{
+			Tag:    img.baseName,
+			Digest: img.baseDigest,
+			Source: tagmodels.LineageByAnnotation,
+		}, true
+	}
+	r, ok := img.root()
+	if !ok {
+		return nil, tagmodels.LineageImage{}, false
+	}
+	var base *lineageImage
+	for _, c := range g.byRoot[r] {
+		if !img.extends(c) {
+			continue
+		}
+		if base == nil ||
+			len(c.layers) > len(base.layers) ||
+			(len(c.layers) == len(base.layers) && c.tag < base.tag) {
+			base = c
+		}
+	}
+	if base == nil {
+		return nil, tagmodels.LineageImage{}, false
+	}
+	return base, newLineageImage(base, tagmodels.LineageByLayers), true
+}
+
+// lineage returns the bases and descendants of img.
+func (g *lineageGraph) lineage(img *lineageImage) tagmodels.Lineage {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	l := tagmodels.Lineage{
+		Tag:         img.tag,
+		Digest:      img.digest,
+		Bases:       []tagmodels.LineageImage{},
+		Descendants: []tagmodels.LineageImage{},
+	}
+
+	// Annotations may form cycles, so both walks track visited tags.
+	visited := map[string]bool{img.tag: true}
+	for cur := img; cur != nil; {
+		base, li, ok := g.parent(cur)
+		if !ok || visited[li.Tag] {
+			break
+		}
+		visited[li.Tag] = true
+		l.Bases = append(l.Bases, li)
+		cur = base
+	}
+
+	visited = map[string]bool{img.tag: true}
+	queue := []*lineageImage{img}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, c := range g.children(cur) {
+			if visited[c.tag] {
+				continue
+			}
+			visited[c.tag] = true
+			source := tagmodels.LineageByLayers
+			if c.baseName == cur.tag {
+				source = tagmodels.LineageByAnnotation
+			}
+			l.Descendants = append(l.Descendants, newLineageImage(c, source))
+			queue = append(queue, c)
+		}
+	}
+	sort.Slice(l.Descendants, func(i, j int) bool {
+		return l.Descendants[i].Tag < l.Descendants[j].Tag
+	})
+	return l
+}
+
+// children returns the images whose direct base is img, or an image with the
+// same layers as img. Must be called with g.mu held.
+func (g *lineageGraph) children(img *lineageImage) []*lineageImage {
+	var candidates []*lineageImage
+	for _, c := range g.byBase[img.tag] {
+		candidates = append(candidates, c)
+	}
+	if r, ok := img.root(); ok {
+		for _, c := range g.byRoot[r] {
+			if c.baseName == "" && c.extends(img) {
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	var children []*lineageImage
+	for _, c := range candidates {
+		if base, _, ok := g.parent(c); ok && base != nil &&
+			(base == img || (c.baseName == "" && base.sameLayers(img))) {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+func newLineageImage(img *lineageImage, source string) tagmodels.LineageImage {
+	d := img.digest
+	return tagmodels.LineageImage{Tag: img.tag, Digest: &d, Source: source}
+}
+
+// parseLineageImage parses the docker manifest of tag into a lineageImage.
+func parseLineageImage(tag string, d core.Digest, manifest []byte) (*lineageImage, error) {
+	m, _, err := dockerutil.ParseManifestV2(bytes.NewReader(manifest))
+	if err != nil {
+		return nil, fmt.Errorf("parse manifest: %s", err)
+	}
+	layers, err := dockerutil.ManifestLayers(m)
+	if err != nil {
+		return nil, err
+	}
+	img := &lineageImage{tag: tag, digest: d}
+	for _, desc := range layers {
+		l, err := core.ParseSHA256Digest(string(desc.Digest))
+		if err != nil {
+			return nil, fmt.Errorf("parse layer digest: %s", err)
+		}
+		img.layers = append(img.layers, l)
+	}
+
+	annotations, err := dockerutil.ManifestAnnotations(m)
+	if err != nil {
+		return nil, err
+	}
+	if name := annotations[_baseNameAnnotation]; name != "" {
+		img.baseName = normalizeBaseName(name)
+		if raw := annotations[_baseDigestAnnotation]; raw != "" {
+			bd, err := core.ParseSHA256Digest(raw)
+			if err != nil {
+				return nil, fmt.Errorf("parse base digest annotation: %s", err)
+			}
+			img.baseDigest = &bd
+		}
+	}
+	return img, nil
+}
+
+// normalizeBaseName converts an image reference, e.g.
+// "registry.example.com/base/ubuntu:20.04@sha256:...", into a build-index
+// tag, e.g. "base/ubuntu:20.04".
+func normalizeBaseName(ref string) string {
+	if i := strings.Index(ref, "@"); i != -1 {
+		ref = ref[:i]
+	}
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) == 2 &&
+		(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref = parts[1]
+	}
+	if !strings.Contains(ref[strings.LastIndex(ref, "/")+1:], ":") {
+		ref += ":latest"
+	}
+	return ref
+}
+
+// indexLineage indexes tag, which points to d, into the lineage graph unless it
+// is already indexed at d.
+func (s *Server) indexLineage(tag string, d core.Digest) (*lineageImage, error) {
+	if img := s.lineage.get(tag); img != nil && img.digest == d {
+		return img, nil
+	}
+	var b bytes.Buffer
+	if err := s.localOriginClient.DownloadBlob(tag, d, &b); err != nil {
+		return nil, fmt.Errorf("download manifest: %s", err)
+	}
+	img, err := parseLineageImage(tag, d, b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	s.lineage.add(img)
+	return img, nil
+}
+
+// maybeIndexLineage indexes newly put tags. Failures only cost lineage
+// coverage, so they do not fail the put.
+func (s *Server) maybeIndexLineage(tag string, d core.Digest) {
+	if !s.lineage.indexes(tag) {
+		return
+	}
+	if _, err := s.indexLineage(tag, d); err != nil {
+		s.stats.Counter("lineage_index_failures").Inc(1)
+		log.With("tag", tag, "digest", d).Errorf("Error indexing lineage: %s", err)
+	}
+}
+
+// getLineageHandler handles lineage requests. Response model
+// tagmodels.Lineage.
+func (s *Server) getLineageHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	tag, err = s.resolveAlias(tag)
+	if err != nil {
+		return err
+	}
+	if !s.lineage.indexes(tag) {
+		return handler.Errorf("lineage of %s is not indexed", tag).Status(http.StatusNotFound)
+	}
+
+	d, err := s.store.Get(tag)
+	if err != nil {
+		if errors.Is(err, tagstore.ErrTagNotFound) {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("storage: %s", err)
+	}
+	img, err := s.indexLineage(tag, d)
+	if err != nil {
+		return handler.Errorf("index lineage: %s", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.lineage.lineage(img)); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	mocktagclient "github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/mockutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func lineageManifestFixture(
+	layers []core.Digest, annotations map[string]string) (core.Digest, []byte) {
+
+	type descriptor struct {
+		MediaType string      `json:"mediaType"`
+		Size      int64       `json:"size"`
+		Digest    core.Digest `json:"digest"`
+	}
+	m := struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		MediaType     string            `json:"mediaType"`
+		Config        descriptor        `json:"config"`
+		Layers        []descriptor      `json:"layers"`
+		Annotations   map[string]string `json:"annotations,omitempty"`
+	}{
+		SchemaVersion: 2,
+		MediaType:     schema2.MediaTypeManifest,
+		Config:        descriptor{schema2.MediaTypeImageConfig, 256, core.DigestFixture()},
+		Annotations:   annotations,
+	}
+	for _, l := range layers {
+		m.Layers = append(m.Layers, descriptor{schema2.MediaTypeLayer, 1024, l})
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	d, err := core.NewDigester().FromBytes(raw)
+	if err != nil {
+		panic(err)
+	}
+	return d, raw
+}
+
+func addLineageFixture(
+	t *testing.T,
+	g *lineageGraph,
+	tag string,
+	layers []core.Digest,
+	annotations map[string]string) *lineageImage {
+
+	d, manifest := lineageManifestFixture(layers, annotations)
+	img, err := parseLineageImage(tag, d, manifest)
+	require.NoError(t, err)
+	g.add(img)
+	return img
+}
+
+func lineageTags(images []tagmodels.LineageImage) []string {
+	var tags []string
+	for _, img := range images {
+		tags = append(tags, img.Tag+"/"+img.Source)
+	}
+	return tags
+}
+
+func TestNormalizeBaseName(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{"ubuntu", "ubuntu:latest"},
+		{"library/ubuntu:20.04", "library/ubuntu:20.04"},
+		{"docker.io/library/ubuntu:20.04", "library/ubuntu:20.04"},
+		{"registry.example.com:5000/base/go:1.13", "base/go:1.13"},
+		{"localhost/base/go", "base/go:latest"},
+		{"base/go:1.13@sha256:" + core.DigestFixture().Hex(), "base/go:1.13"},
+	}
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			require.Equal(t, test.expected, normalizeBaseName(test.ref))
+		})
+	}
+}
+
+func TestLineageGraph(t *testing.T) {
+	require := require.New(t)
+
+	g := newLineageGraph(LineageConfig{})
+
+	a, b, c, d := core.DigestFixture(), core.DigestFixture(), core.DigestFixture(), core.DigestFixture()
+
+	base := addLineageFixture(t, g, "base:1", []core.Digest{a}, nil)
+	mid := addLineageFixture(t, g, "mid:1", []core.Digest{a, b}, nil)
+	app := addLineageFixture(t, g, "app:1", []core.Digest{a, b, c}, nil)
+	addLineageFixture(t, g, "app:2", []core.Digest{a, b, c, d}, nil)
+	addLineageFixture(t, g, "other:1", []core.Digest{core.DigestFixture()}, nil)
+	svc := addLineageFixture(t, g, "svc:1", []core.Digest{core.DigestFixture()}, map[string]string{
+		_baseNameAnnotation: "registry.example.com/app:1",
+	})
+
+	l := g.lineage(mid)
+	require.Equal("mid:1", l.Tag)
+	require.Equal(mid.digest, l.Digest)
+	require.Equal([]string{"base:1/layers"}, lineageTags(l.Bases))
+	require.Equal(base.digest, *l.Bases[0].Digest)
+	require.Equal(
+		[]string{"app:1/layers", "app:2/layers", "svc:1/annotation"},
+		lineageTags(l.Descendants))
+
+	l = g.lineage(svc)
+	require.Equal(
+		[]string{"app:1/annotation", "mid:1/layers", "base:1/layers"},
+		lineageTags(l.Bases))
+	require.Empty(l.Descendants)
+
+	l = g.lineage(app)
+	require.Equal([]string{"app:2/layers", "svc:1/annotation"}, lineageTags(l.Descendants))
+}
+
+func TestLineageGraphSiblingTagsShareDescendants(t *testing.T) {
+	require := require.New(t)
+
+	g := newLineageGraph(LineageConfig{})
+
+	a, b := core.DigestFixture(), core.DigestFixture()
+
+	addLineageFixture(t, g, "base:1", []core.Digest{a}, nil)
+	latest := addLineageFixture(t, g, "base:latest", []core.Digest{a}, nil)
+	addLineageFixture(t, g, "app:1", []core.Digest{a, b}, nil)
+
+	require.Equal([]string{"app:1/layers"}, lineageTags(g.lineage(latest).Descendants))
+}
+
+func TestLineageGraphUnknownAnnotatedBase(t *testing.T) {
+	require := require.New(t)
+
+	g := newLineageGraph(LineageConfig{})
+
+	baseDigest := core.DigestFixture()
+	img := addLineageFixture(t, g, "app:1", []core.Digest{core.DigestFixture()}, map[string]string{
+		_baseNameAnnotation:   "docker.io/library/ubuntu:20.04",
+		_baseDigestAnnotation: baseDigest.String(),
+	})
+
+	require.Equal([]tagmodels.LineageImage{{
+		Tag:    "library/ubuntu:20.04",
+		Digest: &baseDigest,
+		Source: tagmodels.LineageByAnnotation,
+	}}, g.lineage(img).Bases)
+}
+
+func TestLineageGraphReplacesRetaggedImages(t *testing.T) {
+	require := require.New(t)
+
+	g := newLineageGraph(LineageConfig{})
+
+	a, b, c := core.DigestFixture(), core.DigestFixture(), core.DigestFixture()
+
+	addLineageFixture(t, g, "base:1", []core.Digest{a}, nil)
+	addLineageFixture(t, g, "mid:1", []core.Digest{a, b}, nil)
+	app := addLineageFixture(t, g, "app:1", []core.Digest{a, b, c}, nil)
+
+	require.Equal([]string{"mid:1/layers", "base:1/layers"}, lineageTags(g.lineage(app).Bases))
+
+	addLineageFixture(t, g, "mid:1", []core.Digest{core.DigestFixture()}, nil)
+
+	require.Equal([]string{"base:1/layers"}, lineageTags(g.lineage(app).Bases))
+}
+
+func TestGetLineage(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Lineage = LineageConfig{Namespaces: []string{"^images/.*"}}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	layer := core.DigestFixture()
+	baseDigest, baseManifest := lineageManifestFixture([]core.Digest{layer}, nil)
+	appDigest, appManifest := lineageManifestFixture(
+		[]core.Digest{layer, core.DigestFixture()}, nil)
+
+	// Lineage is indexed lazily, so requesting the base first makes it known
+	// to the app.
+	mocks.store.EXPECT().Get("images/base:1").Return(baseDigest, nil).Times(2)
+	mocks.originClient.EXPECT().DownloadBlob(
+		"images/base:1", baseDigest, mockutil.MatchWriter(baseManifest)).Return(nil)
+	mocks.store.EXPECT().Get("images/app:1").Return(appDigest, nil)
+	mocks.originClient.EXPECT().DownloadBlob(
+		"images/app:1", appDigest, mockutil.MatchWriter(appManifest)).Return(nil)
+
+	l, err := client.Lineage("images/base:1")
+	require.NoError(err)
+	require.Empty(l.Bases)
+	require.Empty(l.Descendants)
+
+	l, err = client.Lineage("images/app:1")
+	require.NoError(err)
+	require.Equal(appDigest, l.Digest)
+	require.Equal([]tagmodels.LineageImage{{
+		Tag:    "images/base:1",
+		Digest: &baseDigest,
+		Source: tagmodels.LineageByLayers,
+	}}, l.Bases)
+
+	l, err = client.Lineage("images/base:1")
+	require.NoError(err)
+	require.Equal([]string{"images/app:1/layers"}, lineageTags(l.Descendants))
+}
+
+func TestGetLineageNotIndexed(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	_, err := client.Lineage(core.TagFixture())
+	require.Equal(tagclient.ErrTagNotFound, err)
+}
+
+func TestPutIndexesLineage(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Lineage = LineageConfig{Namespaces: []string{".*"}}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	d, manifest := lineageManifestFixture([]core.Digest{core.DigestFixture()}, nil)
+
+	mocks.depResolver.EXPECT().Resolve(tag, d).Return(core.DigestList{d}, nil)
+	mocks.originClient.EXPECT().Stat(tag, d).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().Put(tag, d, time.Duration(0)).Return(nil)
+	mocks.originClient.EXPECT().DownloadBlob(
+		tag, d, mockutil.MatchWriter(manifest)).Return(nil)
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().DuplicatePut(
+		tag, d, mocks.config.DuplicateReplicateStagger, gomock.Any()).Return(nil)
+
+	require.NoError(client.Put(tag, d))
+
+	// The manifest indexed by the put is not downloaded again.
+	mocks.store.EXPECT().Get(tag).Return(d, nil)
+
+	l, err := client.Lineage(tag)
+	require.NoError(err)
+	require.Equal(d, l.Digest)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/utils/handler"
+)
+
+// Page sizes of manifest listings, which resolve the digest of every tag
+// listed.
+const (
+	_defaultManifestLimit = 100
+	_maxManifestLimit     = 1000
+)
+
+// listManifestsHandler lists the tags of a repository and the manifests they
+// point to, one page at a time. Response model tagmodels.ManifestListResponse.
+func (s *Server) listManifestsHandler(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	for k, v := range q {
+		if len(v) != 1 {
+			return handler.Errorf("invalid query %s:%s", k, v).Status(http.StatusBadRequest)
+		}
+		switch k {
+		case tagmodels.RepoQ, tagmodels.LimitQ, tagmodels.OffsetQ:
+		default:
+			return handler.Errorf("invalid query %s", k).Status(http.StatusBadRequest)
+		}
+	}
+	repo := q.Get(tagmodels.RepoQ)
+	if repo == "" {
+		return handler.Errorf("query arg %s required", tagmodels.RepoQ).Status(http.StatusBadRequest)
+	}
+	limit := _defaultManifestLimit
+	if v := q.Get(tagmodels.LimitQ); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > _maxManifestLimit {
+			return handler.Errorf(
+				"invalid limit %s: must be between 1 and %d", v, _maxManifestLimit).Status(http.StatusBadRequest)
+		}
+	}
+
+	manifests, next, err := s.store.ListManifests(repo, limit, q.Get(tagmodels.OffsetQ))
+	if err != nil {
+		return handler.Errorf("list manifests: %s", err)
+	}
+
+	var resp tagmodels.ManifestListResponse
+	resp.Size = len(manifests)
+	resp.Result = manifests
+	resp.Links.Self = r.URL.String()
+	if next != "" {
+		u := *r.URL
+		v := url.Values{}
+		v.Set(tagmodels.RepoQ, repo)
+		v.Set(tagmodels.LimitQ, strconv.Itoa(limit))
+		v.Set(tagmodels.OffsetQ, next)
+		u.RawQuery = v.Encode()
+		resp.Links.Next = u.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListManifests(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	repo := "namespace-foo/repo-bar"
+	page1 := []tagmodels.Manifest{
+		{Tag: "v1", Digest: core.DigestFixture()},
+		{Tag: "v2", Digest: core.DigestFixture()},
+	}
+	page2 := []tagmodels.Manifest{
+		{Tag: "v3", Digest: core.DigestFixture()},
+	}
+
+	mocks.store.EXPECT().ListManifests(repo, 2, "").Return(page1, "next", nil)
+	mocks.store.EXPECT().ListManifests(repo, 2, "next").Return(page2, "", nil)
+
+	resp, err := client.ListManifestsWithPagination(repo, tagclient.ListFilter{Limit: 2})
+	require.NoError(err)
+	require.Equal(page1, resp.Result)
+	require.Equal(2, resp.Size)
+	offset, err := resp.GetOffset()
+	require.NoError(err)
+	require.Equal("next", offset)
+
+	resp, err = client.ListManifestsWithPagination(repo, tagclient.ListFilter{Offset: offset, Limit: 2})
+	require.NoError(err)
+	require.Equal(page2, resp.Result)
+	require.Empty(resp.Links.Next)
+}
+
+func TestListManifestsFollowsPages(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	repo := "namespace-foo/repo-bar"
+	m1 := tagmodels.Manifest{Tag: "v1", Digest: core.DigestFixture()}
+	m2 := tagmodels.Manifest{Tag: "v2", Digest: core.DigestFixture()}
+
+	mocks.store.EXPECT().ListManifests(repo, _defaultManifestLimit, "").Return(
+		[]tagmodels.Manifest{m1}, "next", nil)
+	mocks.store.EXPECT().ListManifests(repo, _defaultManifestLimit, "next").Return(
+		[]tagmodels.Manifest{m2}, "", nil)
+
+	result, err := client.ListManifests(repo)
+	require.NoError(err)
+	require.Equal([]tagmodels.Manifest{m1, m2}, result)
+}
+
+func TestListManifestsBadRequests(t *testing.T) {
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	for _, query := range []string{
+		"",
+		"limit=10",
+		"repo=foo&limit=0",
+		"repo=foo&limit=1001",
+		"repo=foo&limit=bar",
+		"repo=foo&prefix=bar",
+		"repo=foo&repo=bar",
+	} {
+		t.Run(query, func(t *testing.T) {
+			_, err := httputil.Get("http://" + addr + "/manifest?" + query)
+			require.True(t, httputil.IsStatus(err, http.StatusBadRequest), "%s", err)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+
+	"golang.org/x/time/rate"
+)
+
+// PushLimitConfig limits the rate at which tags are pushed, protecting the
+// replication and notification pipelines from runaway clients. Zero values
+// disable the corresponding limit.
+type PushLimitConfig struct {
+	// TagPerMinute is the max number of pushes of any single tag per minute.
+	TagPerMinute int `yaml:"tag_per_minute"`
+
+	// Namespaces limits the number of pushes per minute across all tags of a
+	// namespace. The first namespace matching a tag applies.
+	Namespaces []NamespacePushLimit `yaml:"namespaces"`
+}
+
+// NamespacePushLimit limits pushes of tags matching the Namespace regex.
+type NamespacePushLimit struct {
+	Namespace string `yaml:"namespace"`
+	PerMinute int    `yaml:"per_minute"`
+}
+
+type namespaceLimiter struct {
+	re      *regexp.Regexp
+	limiter *rate.Limiter
+}
+
+type tagLimiter struct {
+	limiter  *rate.Limiter
+	lastPush time.Time
+}
+
+// pushLimiter enforces PushLimitConfig using token buckets which allow a burst
+// of the full per-minute limit.
+type pushLimiter struct {
+	tagPerMinute int
+	namespaces   []namespaceLimiter
+
+	mu        sync.Mutex
+	tags      map[string]*tagLimiter
+	lastSweep time.Time
+}
+
+func newPushLimiter(config PushLimitConfig) *pushLimiter {
+	l := &pushLimiter{
+		tagPerMinute: config.TagPerMinute,
+		tags:         make(map[string]*tagLimiter),
+	}
+	for _, n := range config.Namespaces {
+		if n.PerMinute <= 0 {
+			continue
+		}
+		re, err := regexp.Compile(n.Namespace)
+		if err != nil {
+			log.Errorf("Ignoring push limit of invalid namespace %q: %s", n.Namespace, err)
+			continue
+		}
+		l.namespaces = append(l.namespaces, namespaceLimiter{re, perMinute(n.PerMinute)})
+	}
+	return l
+}
+
+func perMinute(n int) *rate.Limiter {
+	return rate.NewLimiter(rate.Every(time.Minute/time.Duration(n)), n)
+}
+
+// reserve records a push of tag at now. If tag or its namespace exceeded
+// their limits, the push is not recorded and the duration until it would be
+// allowed is returned instead.
+func (l *pushLimiter) reserve(tag string, now time.Time) (ok bool, wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var limiters []*rate.Limiter
+	if l.tagPerMinute > 0 {
+		l.sweep(now)
+		t, ok := l.tags[tag]
+		if !ok {
+			t = &tagLimiter{limiter: perMinute(l.tagPerMinute)}
+			l.tags[tag] = t
+		}
+		t.lastPush = now
+		limiters = append(limiters, t.limiter)
+	}
+	for _, n := range l.namespaces {
+		if n.re.MatchString(tag) {
+			limiters = append(limiters, n.limiter)
+			break
+		}
+	}
+
+	var reservations []*rate.Reservation
+	for _, limiter := range limiters {
+		r := limiter.ReserveN(now, 1)
+		reservations = append(reservations, r)
+		if d := r.DelayFrom(now); d > wait {
+			wait = d
+		}
+	}
+	if wait == 0 {
+		return true, 0
+	}
+	for _, r := range reservations {
+		r.CancelAt(now)
+	}
+	return false, wait
+}
+
+// sweep forgets tags which have not been pushed for a minute, at which point
+// their buckets are full again. Must be called with mu held.
+func (l *pushLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for tag, t := range l.tags {
+		if now.Sub(t.lastPush) >= time.Minute {
+			delete(l.tags, tag)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushLimiterPerTag(t *testing.T) {
+	require := require.New(t)
+
+	l := newPushLimiter(PushLimitConfig{TagPerMinute: 2})
+
+	now := time.Now()
+	tag := core.TagFixture()
+
+	for i := 0; i < 2; i++ {
+		ok, _ := l.reserve(tag, now)
+		require.True(ok)
+	}
+	ok, wait := l.reserve(tag, now)
+	require.False(ok)
+	require.InDelta(30*time.Second, wait, float64(time.Second))
+
+	// Other tags have their own limits.
+	ok, _ = l.reserve(core.TagFixture(), now)
+	require.True(ok)
+
+	ok, _ = l.reserve(tag, now.Add(31*time.Second))
+	require.True(ok)
+}
+
+func TestPushLimiterPerNamespace(t *testing.T) {
+	require := require.New(t)
+
+	l := newPushLimiter(PushLimitConfig{
+		Namespaces: []NamespacePushLimit{
+			{Namespace: "^ci/.*", PerMinute: 1},
+			{Namespace: ".*", PerMinute: 100},
+		},
+	})
+
+	now := time.Now()
+
+	ok, _ := l.reserve("ci/foo:1", now)
+	require.True(ok)
+	ok, wait := l.reserve("ci/bar:1", now)
+	require.False(ok)
+	require.InDelta(time.Minute, wait, float64(time.Second))
+
+	ok, _ = l.reserve("prod/foo:1", now)
+	require.True(ok)
+}
+
+func TestPushLimiterRejectedPushesAreNotCounted(t *testing.T) {
+	require := require.New(t)
+
+	l := newPushLimiter(PushLimitConfig{
+		TagPerMinute: 10,
+		Namespaces:   []NamespacePushLimit{{Namespace: ".*", PerMinute: 1}},
+	})
+
+	now := time.Now()
+	tag := core.TagFixture()
+
+	ok, _ := l.reserve(core.TagFixture(), now)
+	require.True(ok)
+
+	// Rejected by the namespace limit, which must not consume the tag limit.
+	for i := 0; i < 20; i++ {
+		ok, _ = l.reserve(tag, now)
+		require.False(ok)
+	}
+	ok, _ = l.reserve(tag, now.Add(61*time.Second))
+	require.True(ok)
+}
+
+func TestPushLimiterForgetsIdleTags(t *testing.T) {
+	require := require.New(t)
+
+	l := newPushLimiter(PushLimitConfig{TagPerMinute: 1})
+
+	now := time.Now()
+
+	ok, _ := l.reserve(core.TagFixture(), now)
+	require.True(ok)
+	require.Len(l.tags, 1)
+
+	ok, _ = l.reserve(core.TagFixture(), now.Add(time.Minute))
+	require.True(ok)
+	require.Len(l.tags, 1)
+}
+
+func TestPutExceedsPushLimit(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.PushLimits = PushLimitConfig{TagPerMinute: 1}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().DuplicatePut(tag, digest, gomock.Any(), gomock.Any()).Return(nil)
+
+	u := fmt.Sprintf("http://%s/tags/%s/digest/%s", addr, url.PathEscape(tag), digest)
+
+	_, err := httputil.Put(u)
+	require.NoError(err)
+
+	_, err = httputil.Put(u)
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+	require.Equal("60", err.(httputil.StatusError).Header.Get("Retry-After"))
+}
@@ -15,8 +15,10 @@ package tagserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"path"
@@ -24,6 +26,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/uber/kraken/build-index/contenttrust"
+	"github.com/uber/kraken/build-index/tagalias"
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/build-index/tagstore"
@@ -55,6 +59,7 @@ type Server struct {
 	localOriginClient blobclient.ClusterClient
 	neighbors         hostlist.List
 	store             tagstore.Store
+	aliases           *tagalias.Store
 
 	// For async new tag replication.
 	remotes               tagreplication.Remotes
@@ -63,6 +68,33 @@ type Server struct {
 
 	// For checking if a tag has all dependent blobs.
 	depResolver tagtype.DependencyResolver
+
+	// For streaming tag events.
+	events *eventBroker
+
+	// For throttling tag pushes.
+	pushes *pushLimiter
+
+	// For rejecting tag pushes during freeze windows.
+	freezes *freezer
+
+	// For serving image lineage.
+	lineage *lineageGraph
+
+	// For serving read-your-writes gets of tags.
+	writes *tagWrites
+
+	// For serving metrics scraped from the server listener.
+	metrics http.Handler
+}
+
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithMetricsHandler configures the Server to serve metrics at /metrics using
+// h.
+func WithMetricsHandler(h http.Handler) Option {
+	return func(s *Server) { s.metrics = h }
 }
 
 // New creates a new Server.
@@ -74,10 +106,12 @@ func New(
 	localOriginClient blobclient.ClusterClient,
 	neighbors hostlist.List,
 	store tagstore.Store,
+	aliases *tagalias.Store,
 	remotes tagreplication.Remotes,
 	tagReplicationManager persistedretry.Manager,
 	provider tagclient.Provider,
-	depResolver tagtype.DependencyResolver) *Server {
+	depResolver tagtype.DependencyResolver,
+	opts ...Option) *Server {
 
 	config = config.applyDefaults()
 
@@ -85,7 +119,7 @@ func New(
 		"module": "tagserver",
 	})
 
-	return &Server{
+	s := &Server{
 		config:                config,
 		stats:                 stats,
 		backends:              backends,
@@ -93,11 +127,21 @@ func New(
 		localOriginClient:     localOriginClient,
 		neighbors:             neighbors,
 		store:                 store,
+		aliases:               aliases,
 		remotes:               remotes,
 		tagReplicationManager: tagReplicationManager,
 		provider:              provider,
 		depResolver:           depResolver,
+		events:                newEventBroker(stats),
+		pushes:                newPushLimiter(config.PushLimits),
+		freezes:               newFreezer(config.Freezes),
+		lineage:               newLineageGraph(config.Lineage),
+		writes:                newTagWrites(config.Consistency),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // Handler returns an http.Handler for s.
@@ -108,14 +152,35 @@ func (s *Server) Handler() http.Handler {
 	r.Use(middleware.LatencyTimer(s.stats))
 
 	r.Get("/health", handler.Wrap(s.healthHandler))
+	if s.metrics != nil {
+		r.Handle("/metrics", s.metrics)
+	}
 
 	r.Put("/tags/{tag}/digest/{digest}", handler.Wrap(s.putTagHandler))
 	r.Head("/tags/{tag}", handler.Wrap(s.hasTagHandler))
 	r.Get("/tags/{tag}", handler.Wrap(s.getTagHandler))
 
-	r.Get("/repositories/{repo}/tags", handler.Wrap(s.listRepositoryHandler))
+	r.Put("/aliases/{alias}/tags/{tag}", handler.Wrap(s.putAliasHandler))
+	r.Get("/aliases/{alias}", handler.Wrap(s.getAliasHandler))
+
+	// Listings can be megabytes of json, so are compressed if enabled.
+	listings := r.With(middleware.Compress(s.config.Compression, s.stats))
+
+	listings.Get("/aliases/{alias}/history", handler.Wrap(s.getAliasHistoryHandler))
+
+	listings.Get("/repositories/{repo}/tags", handler.Wrap(s.listRepositoryHandler))
+
+	listings.Get("/manifest", handler.Wrap(s.listManifestsHandler))
 
-	r.Get("/list/*", handler.Wrap(s.listHandler))
+	r.Delete("/manifest/{tag}", handler.Wrap(s.deleteManifestHandler))
+
+	listings.Get("/list/*", handler.Wrap(s.listHandler))
+
+	listings.Get("/lineage/{tag}", handler.Wrap(s.getLineageHandler))
+
+	listings.Get("/freezes", handler.Wrap(s.getFreezesHandler))
+
+	r.Get("/events", handler.Wrap(s.eventsHandler))
 
 	r.Post("/remotes/tags/{tag}", handler.Wrap(s.replicateTagHandler))
 
@@ -129,6 +194,14 @@ func (s *Server) Handler() http.Handler {
 		"/internal/duplicate/tags/{tag}/digest/{digest}",
 		handler.Wrap(s.duplicatePutTagHandler))
 
+	r.Delete(
+		"/internal/duplicate/tags/{tag}/digest/{digest}",
+		handler.Wrap(s.duplicateDeleteTagHandler))
+
+	r.Put(
+		"/internal/duplicate/aliases/{alias}",
+		handler.Wrap(s.duplicatePutAliasHandler))
+
 	r.Mount("/debug", chimiddleware.Profiler())
 
 	return r
@@ -158,12 +231,19 @@ func (s *Server) putTagHandler(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return handler.Errorf("parse query arg `replicate`: %s", err)
 	}
+	if err := s.checkFreeze(r, tag); err != nil {
+		return err
+	}
+	if err := s.throttlePush(tag); err != nil {
+		return err
+	}
 
-	deps, err := s.depResolver.Resolve(tag, d)
+	deps, err := s.resolveDependencies(tag, d)
 	if err != nil {
-		return fmt.Errorf("resolve dependencies: %s", err)
+		return err
 	}
-	if err := s.putTag(tag, d, deps); err != nil {
+	version := time.Now()
+	if err := s.putTag(tag, d, deps, version); err != nil {
 		return err
 	}
 
@@ -172,10 +252,63 @@ func (s *Server) putTagHandler(w http.ResponseWriter, r *http.Request) error {
 			return err
 		}
 	}
+	if err := s.issueConsistencyToken(w, tag, d, version); err != nil {
+		return err
+	}
 	w.WriteHeader(http.StatusOK)
 	return nil
 }
 
+// throttlePush returns 429 with Retry-After if tag is pushed more often than
+// the configured push limits allow.
+func (s *Server) throttlePush(tag string) error {
+	ok, wait := s.pushes.reserve(tag, time.Now())
+	if ok {
+		return nil
+	}
+	s.stats.Counter("throttled_pushes").Inc(1)
+	retryAfter := int64(math.Ceil(wait.Seconds()))
+	return handler.Errorf(
+		"push limit of %s exceeded, retry after %ds", tag, retryAfter).
+		Status(http.StatusTooManyRequests).
+		Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+}
+
+// resolveDependencies resolves the dependencies of tag, rejecting images which
+// exceed the limits of its tag type with 400. Images which violate the policy
+// of its tag type are rejected with 400 and a json tagmodels.PolicyViolations
+// body.
+func (s *Server) resolveDependencies(tag string, d core.Digest) (core.DigestList, error) {
+	deps, err := s.depResolver.Resolve(tag, d)
+	if err != nil {
+		var lerr *tagtype.ManifestLimitError
+		if errors.As(err, &lerr) {
+			return nil, handler.Errorf("%s", lerr).Status(http.StatusBadRequest)
+		}
+		var perr *tagtype.PolicyViolationError
+		if errors.As(err, &perr) {
+			s.stats.Counter("policy_violations").Inc(1)
+			b, err := json.Marshal(tagmodels.PolicyViolations{
+				Tag:        perr.Tag,
+				Violations: perr.Violations,
+			})
+			if err != nil {
+				return nil, handler.Errorf("json marshal: %s", err)
+			}
+			return nil, handler.Errorf("%s", b).
+				Status(http.StatusBadRequest).
+				Header("Content-Type", "application/json")
+		}
+		var derr *tagtype.ManifestDigestError
+		if errors.As(err, &derr) {
+			s.stats.Counter("manifest_digest_mismatches").Inc(1)
+			return nil, handler.Errorf("%s", derr).Status(http.StatusBadRequest)
+		}
+		return nil, fmt.Errorf("resolve dependencies: %s", err)
+	}
+	return deps, nil
+}
+
 func (s *Server) duplicatePutTagHandler(w http.ResponseWriter, r *http.Request) error {
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
@@ -192,9 +325,12 @@ func (s *Server) duplicatePutTagHandler(w http.ResponseWriter, r *http.Request)
 	}
 	delay := req.Delay
 
+	publish := s.publishPut(tag, d)
 	if err := s.store.Put(tag, d, delay); err != nil {
 		return handler.Errorf("storage: %s", err)
 	}
+	s.writes.record(tag, writeVersion(req.Version))
+	publish()
 
 	w.WriteHeader(http.StatusOK)
 	return nil
@@ -205,15 +341,27 @@ func (s *Server) getTagHandler(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	tag, err = s.resolveRequestedAlias(w, tag)
+	if err != nil {
+		return err
+	}
 
-	d, err := s.store.Get(tag)
+	d, err := s.getConsistentTag(r, tag)
 	if err != nil {
 		if err == tagstore.ErrTagNotFound {
 			return handler.ErrorStatus(http.StatusNotFound)
 		}
+		var uerr *contenttrust.UntrustedError
+		if errors.As(err, &uerr) {
+			return handler.Errorf("%s", uerr).Status(http.StatusForbidden)
+		}
+		if _, ok := err.(*handler.Error); ok {
+			return err
+		}
 		return handler.Errorf("storage: %s", err)
 	}
 
+	w.Header().Set("Docker-Content-Digest", d.String())
 	if _, err := io.WriteString(w, d.String()); err != nil {
 		return handler.Errorf("write digest: %s", err)
 	}
@@ -225,13 +373,17 @@ func (s *Server) hasTagHandler(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	tag, err = s.resolveRequestedAlias(w, tag)
+	if err != nil {
+		return err
+	}
 
 	client, err := s.backends.GetClient(tag)
 	if err != nil {
 		return handler.Errorf("backend manager: %s", err)
 	}
 	if _, err := client.Stat(tag, tag); err != nil {
-		if err == backenderrors.ErrBlobNotFound {
+		if errors.Is(err, backenderrors.ErrBlobNotFound) {
 			return handler.ErrorStatus(http.StatusNotFound)
 		}
 		return err
@@ -264,6 +416,7 @@ func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		return handler.Errorf("json encode: %s", err)
 	}
@@ -309,6 +462,7 @@ func (s *Server) listRepositoryHandler(w http.ResponseWriter, r *http.Request) e
 	if err != nil {
 		return err
 	}
+	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		return handler.Errorf("json encode: %s", err)
 	}
@@ -328,9 +482,9 @@ func (s *Server) replicateTagHandler(w http.ResponseWriter, r *http.Request) err
 		}
 		return handler.Errorf("storage: %s", err)
 	}
-	deps, err := s.depResolver.Resolve(tag, d)
+	deps, err := s.resolveDependencies(tag, d)
 	if err != nil {
-		return fmt.Errorf("resolve dependencies: %s", err)
+		return err
 	}
 	if err := s.replicateTag(tag, d, deps); err != nil {
 		return err
@@ -372,7 +526,11 @@ func (s *Server) getOriginHandler(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
-func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
+// putTag puts tag to d, accepted at version, and duplicates the put to the
+// neighbors of s.
+func (s *Server) putTag(
+	tag string, d core.Digest, deps core.DigestList, version time.Time) error {
+
 	for _, dep := range deps {
 		if _, err := s.localOriginClient.Stat(tag, dep); err == blobclient.ErrBlobNotFound {
 			return handler.Errorf("cannot upload tag, missing dependency %s", dep)
@@ -381,9 +539,14 @@ func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
 		}
 	}
 
+	publish := s.publishPut(tag, d)
 	if err := s.store.Put(tag, d, 0); err != nil {
 		return handler.Errorf("storage: %s", err)
 	}
+	s.writes.record(tag, version)
+	publish()
+
+	s.maybeIndexLineage(tag, d)
 
 	neighbors := s.neighbors.Resolve()
 
@@ -392,7 +555,7 @@ func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
 	for addr := range neighbors {
 		delay += s.config.DuplicatePutStagger
 		client := s.provider.Provide(addr)
-		if err := client.DuplicatePut(tag, d, delay); err != nil {
+		if err := client.DuplicatePut(tag, d, delay, version); err != nil {
 			log.Errorf("Error duplicating put task to %s: %s", addr, err)
 		} else {
 			successes++
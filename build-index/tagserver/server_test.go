@@ -22,14 +22,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/uber/kraken/build-index/tagalias"
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/mocks/build-index/tagclient"
 	"github.com/uber/kraken/mocks/build-index/tagstore"
 	"github.com/uber/kraken/mocks/build-index/tagtype"
@@ -62,6 +66,7 @@ type serverMocks struct {
 	depResolver           *mocktagtype.MockDependencyResolver
 	originClient          *mockblobclient.MockClusterClient
 	store                 *mocktagstore.MockStore
+	aliases               *tagalias.Store
 	neighbors             hostlist.List
 }
 
@@ -93,6 +98,9 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 
 	store := mocktagstore.NewMockStore(ctrl)
 
+	db, c := localdb.Fixture()
+	cleanup.Add(c)
+
 	return &serverMocks{
 		ctrl:                  ctrl,
 		config:                Config{DuplicateReplicateStagger: 20 * time.Minute},
@@ -104,6 +112,7 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 		originClient:          originClient,
 		depResolver:           depResolver,
 		store:                 store,
+		aliases:               tagalias.NewStore(db),
 		neighbors:             hostlist.Fixture(_testNeighbor),
 	}, cleanup.Run
 }
@@ -112,7 +121,7 @@ func (m *serverMocks) client() *mocktagclient.MockClient {
 	return mocktagclient.NewMockClient(m.ctrl)
 }
 
-func (m *serverMocks) handler() http.Handler {
+func (m *serverMocks) handler(opts ...Option) http.Handler {
 	return New(
 		m.config,
 		tally.NoopScope,
@@ -121,10 +130,12 @@ func (m *serverMocks) handler() http.Handler {
 		m.originClient,
 		m.neighbors,
 		m.store,
+		m.aliases,
 		m.remotes,
 		m.tagReplicationManager,
 		m.provider,
-		m.depResolver).Handler()
+		m.depResolver,
+		opts...).Handler()
 }
 
 func newClusterClient(addr string) tagclient.Client {
@@ -149,6 +160,26 @@ func TestHealth(t *testing.T) {
 	require.Equal("OK\n", string(b))
 }
 
+func TestMetricsHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "some_metric 1")
+	})
+	addr, stop := testutil.StartServer(mocks.handler(WithMetricsHandler(metrics)))
+	defer stop()
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/metrics", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal("some_metric 1", string(b))
+}
+
 func TestPut(t *testing.T) {
 	require := require.New(t)
 
@@ -169,11 +200,91 @@ func TestPut(t *testing.T) {
 	mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil)
 	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
 	neighborClient.EXPECT().DuplicatePut(
-		tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
+		tag, digest, mocks.config.DuplicateReplicateStagger, gomock.Any()).Return(nil)
 
 	require.NoError(client.Put(tag, digest))
 }
 
+func TestPutExceedsManifestLimits(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(
+		nil, &tagtype.ManifestLimitError{Tag: tag, Reason: "3 layers, max is 2"})
+
+	err := client.Put(tag, digest)
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+	require.Contains(err.Error(), "3 layers, max is 2")
+}
+
+func TestPutManifestPolicyViolation(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	violations := []tagmodels.PolicyViolation{{
+		Rule:    tagtype.RuleArchitectures,
+		Digest:  digest,
+		Message: "architecture \"s390x\" not allowed",
+	}, {
+		Rule:    tagtype.RuleRequiredLabels,
+		Digest:  digest,
+		Message: "label team required",
+	}}
+
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(
+		nil, &tagtype.PolicyViolationError{Tag: tag, Violations: violations})
+
+	err := client.Put(tag, digest)
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	v, ok := tagclient.PolicyViolations(err)
+	require.True(ok)
+	require.Equal(tagmodels.PolicyViolations{Tag: tag, Violations: violations}, v)
+}
+
+func TestPutManifestDigestMismatch(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(
+		nil, &tagtype.ManifestDigestError{Expected: digest, Actual: core.DigestFixture()})
+
+	err := client.Put(tag, digest)
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
+
 func TestPutInvalidParam(t *testing.T) {
 	tag := core.TagFixture()
 	digest := core.DigestFixture()
@@ -231,7 +342,7 @@ func TestDuplicatePut(t *testing.T) {
 
 	mocks.store.EXPECT().Put(tag, digest, delay).Return(nil)
 
-	require.NoError(client.DuplicatePut(tag, digest, delay))
+	require.NoError(client.DuplicatePut(tag, digest, delay, time.Now()))
 }
 
 func TestDuplicatePutInvalidParam(t *testing.T) {
@@ -291,6 +402,26 @@ func TestGet(t *testing.T) {
 	require.Equal(digest, result)
 }
 
+func TestGetDockerContentDigest(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/tags/%s", addr, url.PathEscape(tag)))
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(digest.String(), resp.Header.Get("Docker-Content-Digest"))
+}
+
 func TestGetTagNotFound(t *testing.T) {
 	require := require.New(t)
 
@@ -479,7 +610,7 @@ func TestPutAndReplicate(t *testing.T) {
 		mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil),
 		mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient),
 		neighborClient.EXPECT().DuplicatePut(
-			tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil),
+			tag, digest, mocks.config.DuplicateReplicateStagger, gomock.Any()).Return(nil),
 		mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil),
 		mocks.provider.EXPECT().Provide(_testNeighbor).Return(replicaClient),
 		replicaClient.EXPECT().DuplicateReplicate(
@@ -19,8 +19,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"strings"
 	"time"
 
+	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
@@ -28,6 +31,7 @@ import (
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
 
 	"github.com/uber-go/tally"
 )
@@ -42,12 +46,20 @@ type FileStore interface {
 	CreateCacheFile(name string, r io.Reader) error
 	SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error)
 	GetCacheFileReader(name string) (store.FileReader, error)
+	DeleteCacheFile(name string) error
+}
+
+// Verifier verifies tags resolved from backends before they are served.
+type Verifier interface {
+	Verify(tag string, d core.Digest) error
 }
 
 // Store defines tag storage operations.
 type Store interface {
 	Put(tag string, d core.Digest, writeBackDelay time.Duration) error
 	Get(tag string) (core.Digest, error)
+	ListManifests(repo string, limit int, offset string) ([]tagmodels.Manifest, string, error)
+	Delete(tag string) (core.Digest, error)
 }
 
 // tagStore encapsulates two-level tag storage:
@@ -58,6 +70,16 @@ type tagStore struct {
 	fs               FileStore
 	backends         *backend.Manager
 	writeBackManager persistedretry.Manager
+	verifier         Verifier
+}
+
+// Option allows setting optional Store parameters.
+type Option func(*tagStore)
+
+// WithVerifier configures a Store to reject tags resolved from backends which
+// fail verification, e.g. tags of mirrored registries which are not signed.
+func WithVerifier(v Verifier) Option {
+	return func(s *tagStore) { s.verifier = v }
 }
 
 // New creates a new Store.
@@ -66,18 +88,23 @@ func New(
 	stats tally.Scope,
 	fs FileStore,
 	backends *backend.Manager,
-	writeBackManager persistedretry.Manager) Store {
+	writeBackManager persistedretry.Manager,
+	opts ...Option) Store {
 
 	stats = stats.Tagged(map[string]string{
 		"module": "tagstore",
 	})
 
-	return &tagStore{
+	s := &tagStore{
 		config:           config,
 		fs:               fs,
 		backends:         backends,
 		writeBackManager: writeBackManager,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *tagStore) Put(tag string, d core.Digest, writeBackDelay time.Duration) error {
@@ -115,6 +142,83 @@ func (s *tagStore) Get(tag string) (d core.Digest, err error) {
 	return d, err
 }
 
+// Delete deletes tag from both the backend and disk, returning the digest tag
+// pointed to. Returns backenderrors.ErrDeleteNotSupported if the backend of tag
+// does not support deletion, in which case tag is left untouched.
+func (s *tagStore) Delete(tag string) (core.Digest, error) {
+	d, err := s.resolveFromDisk(tag)
+	if err == ErrTagNotFound {
+		// Tags are deleted whether or not they pass verification.
+		d, err = s.downloadFromBackend(tag)
+	}
+	if err != nil {
+		return core.Digest{}, err
+	}
+	backendClient, err := s.backends.GetClient(tag)
+	if err != nil {
+		return core.Digest{}, fmt.Errorf("backend manager: %s", err)
+	}
+	// The backend is deleted from first, such that tags of backends which do
+	// not support deletion keep their pending write-backs. Tags only on disk
+	// have not been written back yet.
+	if err := backend.Delete(backendClient, tag, tag); err != nil &&
+		!errors.Is(err, backenderrors.ErrBlobNotFound) {
+
+		if errors.Is(err, backenderrors.ErrDeleteNotSupported) {
+			return core.Digest{}, backenderrors.ErrDeleteNotSupported
+		}
+		return core.Digest{}, fmt.Errorf("backend client: %s", err)
+	}
+	// Deleting the cache file also cancels any pending write-back of tag,
+	// since write-backs of missing cache files are dropped.
+	if err := s.fs.DeleteCacheFile(tag); err != nil && !os.IsNotExist(err) {
+		return core.Digest{}, fmt.Errorf("delete from disk: %s", err)
+	}
+	return d, nil
+}
+
+// ListManifests lists up to limit tags of repo, starting at the continuation
+// token offset, and resolves the manifest digest of each tag. Returns the
+// continuation token of the next page, which is empty once every tag has been
+// listed.
+func (s *tagStore) ListManifests(
+	repo string, limit int, offset string) ([]tagmodels.Manifest, string, error) {
+
+	backendClient, err := s.backends.GetClient(repo)
+	if err != nil {
+		return nil, "", fmt.Errorf("backend manager: %s", err)
+	}
+	opts := []backend.ListOption{
+		backend.ListWithPagination(),
+		backend.ListWithMaxKeys(limit),
+	}
+	if offset != "" {
+		opts = append(opts, backend.ListWithContinuationToken(offset))
+	}
+	result, err := backendClient.List(path.Join(repo, "_manifests/tags"), opts...)
+	if err != nil {
+		return nil, "", fmt.Errorf("backend list: %s", err)
+	}
+	manifests := make([]tagmodels.Manifest, 0, len(result.Names))
+	for _, name := range result.Names {
+		parts := strings.Split(name, ":")
+		if len(parts) != 2 {
+			log.With("name", name).Warn("Manifest list skipping name, expected repo:tag format")
+			continue
+		}
+		d, err := s.Get(name)
+		if err == ErrTagNotFound {
+			// Listings may be stale, e.g. when tags are removed from the
+			// backend out of band.
+			continue
+		} else if err != nil {
+			return nil, "", fmt.Errorf("get %s: %s", name, err)
+		}
+		manifests = append(manifests, tagmodels.Manifest{Tag: parts[1], Digest: d})
+	}
+	return manifests, result.ContinuationToken, nil
+}
+
 func (s *tagStore) writeTagToDisk(tag string, d core.Digest) error {
 	buf := bytes.NewBufferString(d.String())
 	if err := s.fs.CreateCacheFile(tag, buf); err != nil && !os.IsExist(err) {
@@ -144,13 +248,26 @@ func (s *tagStore) resolveFromDisk(tag string) (core.Digest, error) {
 }
 
 func (s *tagStore) resolveFromBackend(tag string) (core.Digest, error) {
+	d, err := s.downloadFromBackend(tag)
+	if err != nil {
+		return core.Digest{}, err
+	}
+	if s.verifier != nil {
+		if err := s.verifier.Verify(tag, d); err != nil {
+			return core.Digest{}, fmt.Errorf("verify: %w", err)
+		}
+	}
+	return d, nil
+}
+
+func (s *tagStore) downloadFromBackend(tag string) (core.Digest, error) {
 	backendClient, err := s.backends.GetClient(tag)
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("backend manager: %s", err)
 	}
 	var b bytes.Buffer
 	if err := backendClient.Download(tag, tag, &b); err != nil {
-		if err == backenderrors.ErrBlobNotFound {
+		if errors.Is(err, backenderrors.ErrBlobNotFound) {
 			return core.Digest{}, ErrTagNotFound
 		}
 		return core.Digest{}, fmt.Errorf("backend client: %s", err)
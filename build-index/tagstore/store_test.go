@@ -14,11 +14,13 @@
 package tagstore_test
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"sync"
 	"testing"
 
+	"github.com/uber/kraken/build-index/tagmodels"
 	. "github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
@@ -64,8 +66,16 @@ func newStoreMocks(t *testing.T) (*storeMocks, func()) {
 	return &storeMocks{ctrl, ss, backends, backendClient, writeBackManager}, cleanup.Run
 }
 
-func (m *storeMocks) new(config Config) Store {
-	return New(config, tally.NoopScope, m.ss, m.backends, m.writeBackManager)
+func (m *storeMocks) new(config Config, opts ...Option) Store {
+	return New(config, tally.NoopScope, m.ss, m.backends, m.writeBackManager, opts...)
+}
+
+type fakeVerifier struct {
+	err error
+}
+
+func (v fakeVerifier) Verify(tag string, d core.Digest) error {
+	return v.err
 }
 
 func checkConcurrentGets(t *testing.T, store Store, tag string, expected core.Digest) {
@@ -182,3 +192,180 @@ func TestGetFromBackendInvalidValue(t *testing.T) {
 	_, err := store.Get(tag)
 	require.Error(err)
 }
+
+func TestGetFromBackendVerifies(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	verifyErr := errors.New("untrusted")
+	store := mocks.new(Config{}, WithVerifier(fakeVerifier{verifyErr}))
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	w := mockutil.MatchWriter([]byte(digest.String()))
+	mocks.backendClient.EXPECT().Download(tag, tag, w).Return(nil)
+
+	_, err := store.Get(tag)
+	require.True(errors.Is(err, verifyErr))
+}
+
+func TestListManifests(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	repo := "namespace-foo/repo-bar"
+	onDisk := core.DigestFixture()
+	inBackend := core.DigestFixture()
+
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	require.NoError(store.Put(repo+":v1", onDisk, 0))
+
+	mocks.backendClient.EXPECT().List(
+		repo+"/_manifests/tags", gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&backend.ListResult{
+			Names:             []string{repo + ":v1", repo + ":v2", repo + ":v3", "malformed"},
+			ContinuationToken: "next",
+		}, nil)
+	mocks.backendClient.EXPECT().Download(
+		repo+":v2", repo+":v2", mockutil.MatchWriter([]byte(inBackend.String()))).Return(nil)
+	mocks.backendClient.EXPECT().Download(
+		repo+":v3", repo+":v3", gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+
+	manifests, next, err := store.ListManifests(repo, 10, "prev")
+	require.NoError(err)
+	require.Equal("next", next)
+	require.Equal([]tagmodels.Manifest{
+		{Tag: "v1", Digest: onDisk},
+		{Tag: "v2", Digest: inBackend},
+	}, manifests)
+}
+
+func TestListManifestsBackendError(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	mocks.backendClient.EXPECT().List(
+		"repo/_manifests/tags", gomock.Any(), gomock.Any()).Return(nil, errors.New("some error"))
+
+	_, _, err := store.ListManifests("repo", 10, "")
+	require.Error(err)
+}
+
+// deleterClient is a backend client which supports deletion.
+type deleterClient struct {
+	*mockbackend.MockClient
+	err error
+}
+
+func (c deleterClient) Delete(namespace, name string) error {
+	return c.err
+}
+
+func (m *storeMocks) newWithDeleter(t *testing.T, deleteErr error) Store {
+	backends := backend.ManagerFixture()
+	require.NoError(t, backends.Register(_testNamespace, deleterClient{m.backendClient, deleteErr}))
+	return New(Config{}, tally.NoopScope, m.ss, backends, m.writeBackManager)
+}
+
+func TestDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.newWithDeleter(t, nil)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	require.NoError(store.Put(tag, digest, 0))
+
+	result, err := store.Delete(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+
+	_, err = store.Get(tag)
+	require.Equal(ErrTagNotFound, err)
+}
+
+func TestDeleteFromBackendSkipsVerification(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	backends := backend.ManagerFixture()
+	require.NoError(backends.Register(_testNamespace, deleterClient{mocks.backendClient, nil}))
+	store := New(
+		Config{}, tally.NoopScope, mocks.ss, backends, mocks.writeBackManager,
+		WithVerifier(fakeVerifier{errors.New("untrusted")}))
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(digest.String()))).Return(nil)
+
+	result, err := store.Delete(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestDeleteOnlyOnDisk(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	// The write-back of tag has not executed yet.
+	store := mocks.newWithDeleter(t, backenderrors.ErrBlobNotFound)
+
+	tag := core.TagFixture()
+
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	require.NoError(store.Put(tag, core.DigestFixture(), 0))
+
+	_, err := store.Delete(tag)
+	require.NoError(err)
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+
+	_, err = store.Delete(tag)
+	require.Equal(ErrTagNotFound, err)
+}
+
+func TestDeleteNotSupported(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	require.NoError(store.Put(tag, digest, 0))
+
+	_, err := store.Delete(tag)
+	require.Equal(backenderrors.ErrDeleteNotSupported, err)
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
@@ -15,28 +15,114 @@ package tagtype
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 
+	"github.com/docker/distribution"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/dockerutil"
-	"github.com/docker/distribution"
 )
 
+// ManifestDigestError is returned when the manifest stored under a digest does
+// not hash to that digest, e.g. because it was corrupted.
+type ManifestDigestError struct {
+	Expected core.Digest
+	Actual   core.Digest
+}
+
+func (e *ManifestDigestError) Error() string {
+	return fmt.Sprintf("manifest %s has digest %s", e.Expected, e.Actual)
+}
+
 type dockerResolver struct {
 	originClient blobclient.ClusterClient
+	limits       ManifestLimits
+	policy       ManifestPolicy
 }
 
-// Resolve returns all layers + manifest of given tag as its dependencies.
+// Resolve returns all layers + manifest of given tag as its dependencies. Tags
+// of manifest lists, i.e. multi-arch images, depend on the manifests and layers
+// of every platform. Returns ManifestLimitError if the image, or the image of
+// any platform, exceeds the configured limits, PolicyViolationError if it
+// violates the configured policy, and ManifestDigestError if any manifest does
+// not match its digest.
 func (r *dockerResolver) Resolve(tag string, d core.Digest) (core.DigestList, error) {
 	m, err := r.downloadManifest(tag, d)
 	if err != nil {
 		return nil, err
 	}
+	check := &policyCheck{policy: r.policy}
+	var deps core.DigestList
+	if dockerutil.IsManifestList(m) {
+		deps, err = r.resolveList(tag, d, m, check)
+	} else {
+		deps, err = r.resolveImage(tag, d, m, check)
+		deps = append(deps, d)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := check.err(tag); err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+// resolveImage returns the config and layers of the image manifest m.
+func (r *dockerResolver) resolveImage(
+	tag string, d core.Digest, m distribution.Manifest, check *policyCheck) (core.DigestList, error) {
+
+	if err := r.limits.check(tag, m); err != nil {
+		return nil, err
+	}
+	fetchConfig := func(desc distribution.Descriptor) (imageConfig, error) {
+		return r.downloadConfig(tag, desc)
+	}
+	if err := check.checkImage(d, m, fetchConfig); err != nil {
+		return nil, fmt.Errorf("check policy: %s", err)
+	}
 	deps, err := dockerutil.GetManifestReferences(m)
 	if err != nil {
 		return nil, fmt.Errorf("get manifest references: %s", err)
 	}
+	return deps, nil
+}
+
+// resolveList returns the manifests of every platform of the manifest list l,
+// along with their configs and layers. Blobs shared by platforms are only
+// listed once.
+func (r *dockerResolver) resolveList(
+	tag string, d core.Digest, l distribution.Manifest, check *policyCheck) (core.DigestList, error) {
+
+	if err := check.checkMediaType(d, l); err != nil {
+		return nil, fmt.Errorf("check policy: %s", err)
+	}
+	manifests, err := dockerutil.GetManifestReferences(l)
+	if err != nil {
+		return nil, fmt.Errorf("get manifest references: %s", err)
+	}
+	seen := make(map[core.Digest]bool)
+	var deps core.DigestList
+	for _, md := range manifests {
+		m, err := r.downloadManifest(tag, md)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s: %w", md, err)
+		}
+		if dockerutil.IsManifestList(m) {
+			return nil, fmt.Errorf("manifest %s: nested manifest lists not supported", md)
+		}
+		blobs, err := r.resolveImage(tag, md, m, check)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range append(blobs, md) {
+			if !seen[b] {
+				seen[b] = true
+				deps = append(deps, b)
+			}
+		}
+	}
 	return append(deps, d), nil
 }
 
@@ -45,9 +131,30 @@ func (r *dockerResolver) downloadManifest(tag string, d core.Digest) (distributi
 	if err := r.originClient.DownloadBlob(tag, d, buf); err != nil {
 		return nil, fmt.Errorf("download blob: %s", err)
 	}
-	manifest, _, err := dockerutil.ParseManifestV2(buf)
+	manifest, actual, err := dockerutil.ParseManifest(buf)
 	if err != nil {
 		return nil, fmt.Errorf("parse manifest: %s", err)
 	}
+	if actual != d {
+		return nil, &ManifestDigestError{Expected: d, Actual: actual}
+	}
 	return manifest, nil
 }
+
+func (r *dockerResolver) downloadConfig(
+	tag string, desc distribution.Descriptor) (imageConfig, error) {
+
+	d, err := core.ParseSHA256Digest(string(desc.Digest))
+	if err != nil {
+		return imageConfig{}, fmt.Errorf("parse digest: %s", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := r.originClient.DownloadBlob(tag, d, buf); err != nil {
+		return imageConfig{}, fmt.Errorf("download blob: %s", err)
+	}
+	var config imageConfig
+	if err := json.Unmarshal(buf.Bytes(), &config); err != nil {
+		return imageConfig{}, fmt.Errorf("unmarshal: %s", err)
+	}
+	return config, nil
+}
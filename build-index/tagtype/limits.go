@@ -0,0 +1,83 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagtype
+
+import (
+	"fmt"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+)
+
+// ManifestLimits defines limits on docker images. Zero values disable the
+// corresponding limit.
+type ManifestLimits struct {
+	// MaxLayers is the maximum number of layers an image may have.
+	MaxLayers int `yaml:"max_layers"`
+
+	// MaxImageSize is the maximum total size of an image's config and layers,
+	// as declared by its manifest. Multi-arch images are limited per platform.
+	MaxImageSize datasize.ByteSize `yaml:"max_image_size"`
+}
+
+func (l ManifestLimits) enabled() bool {
+	return l.MaxLayers > 0 || l.MaxImageSize > 0
+}
+
+// ManifestLimitError is returned when an image exceeds ManifestLimits.
+type ManifestLimitError struct {
+	Tag    string
+	Reason string
+}
+
+func (e *ManifestLimitError) Error() string {
+	return fmt.Sprintf("image %s exceeds limits: %s", e.Tag, e.Reason)
+}
+
+func (l ManifestLimits) check(tag string, m distribution.Manifest) error {
+	if !l.enabled() {
+		return nil
+	}
+	var config distribution.Descriptor
+	var layers []distribution.Descriptor
+	switch dm := m.(type) {
+	case *schema2.DeserializedManifest:
+		config, layers = dm.Config, dm.Layers
+	case *ocischema.DeserializedManifest:
+		config, layers = dm.Config, dm.Layers
+	default:
+		return fmt.Errorf("unsupported manifest type %T", m)
+	}
+	if l.MaxLayers > 0 && len(layers) > l.MaxLayers {
+		return &ManifestLimitError{
+			Tag:    tag,
+			Reason: fmt.Sprintf("%d layers, max is %d", len(layers), l.MaxLayers),
+		}
+	}
+	if l.MaxImageSize > 0 {
+		size := config.Size
+		for _, layer := range layers {
+			size += layer.Size
+		}
+		if datasize.ByteSize(size) > l.MaxImageSize {
+			return &ManifestLimitError{
+				Tag:    tag,
+				Reason: fmt.Sprintf("size %s, max is %s", datasize.ByteSize(size), l.MaxImageSize),
+			}
+		}
+	}
+	return nil
+}
@@ -28,6 +28,14 @@ var errNamespaceNotFound = errors.New("no matches for namespace")
 type Config struct {
 	Namespace string `yaml:"namespace"`
 	Type      string `yaml:"type"`
+
+	// Limits rejects images which exceed them. Only supported by the docker
+	// type.
+	Limits ManifestLimits `yaml:"limits"`
+
+	// Policy rejects images which violate its rules. Only supported by the
+	// docker type.
+	Policy ManifestPolicy `yaml:"policy"`
 }
 
 // DependencyResolver returns a list of blob dependencies for a tag->digest mapping.
@@ -59,8 +67,14 @@ func NewMap(configs []Config, originClient blobclient.ClusterClient) (*Map, erro
 		var sr *subResolver
 		switch config.Type {
 		case "docker":
-			sr = &subResolver{re, &dockerResolver{originClient}}
+			sr = &subResolver{re, &dockerResolver{originClient, config.Limits, config.Policy}}
 		case "default":
+			if config.Limits.enabled() {
+				return nil, fmt.Errorf("namespace %s: limits not supported by type default", config.Namespace)
+			}
+			if config.Policy.enabled() {
+				return nil, fmt.Errorf("namespace %s: policy not supported by type default", config.Namespace)
+			}
 			sr = &subResolver{re, &defaultResolver{}}
 		default:
 			return nil, fmt.Errorf("type %s is undefined", config.Type)
@@ -14,6 +14,8 @@
 package tagtype
 
 import (
+	"encoding/json"
+	"fmt"
 	"testing"
 
 	"github.com/uber/kraken/core"
@@ -21,6 +23,8 @@ import (
 	"github.com/uber/kraken/utils/dockerutil"
 	"github.com/uber/kraken/utils/mockutil"
 
+	"github.com/c2h5oh/datasize"
+	"github.com/docker/distribution/manifest/schema2"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 )
@@ -54,6 +58,133 @@ func TestMapResolveDocker(t *testing.T) {
 	require.Equal(core.DigestList(append(layers, manifest)), deps)
 }
 
+func TestMapResolveDockerRejectsDigestMismatch(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	originClient := mockblobclient.NewMockClusterClient(ctrl)
+
+	m, err := NewMap(testConfigs(), originClient)
+	require.NoError(err)
+
+	tag := "namespace-foo/repo-bar:0001"
+	layers := core.DigestListFixture(3)
+	actual, b := dockerutil.ManifestFixture(layers[0], layers[1], layers[2])
+	expected := core.DigestFixture()
+
+	originClient.EXPECT().DownloadBlob(tag, expected, mockutil.MatchWriter(b)).Return(nil)
+
+	_, err = m.Resolve(tag, expected)
+	require.Equal(&ManifestDigestError{Expected: expected, Actual: actual}, err)
+}
+
+func TestMapResolveDockerOCIManifest(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	originClient := mockblobclient.NewMockClusterClient(ctrl)
+
+	m, err := NewMap(testConfigs(), originClient)
+	require.NoError(err)
+
+	tag := "namespace-foo/repo-bar:0001"
+	layers := core.DigestListFixture(3)
+	manifest, b := dockerutil.OCIManifestFixture(layers[0], layers[1], layers[2])
+
+	originClient.EXPECT().DownloadBlob(tag, manifest, mockutil.MatchWriter(b)).Return(nil)
+
+	deps, err := m.Resolve(tag, manifest)
+	require.NoError(err)
+	require.Equal(core.DigestList(append(layers, manifest)), deps)
+}
+
+func TestMapResolveDockerRejectsOCIArtifacts(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	originClient := mockblobclient.NewMockClusterClient(ctrl)
+
+	m, err := NewMap(testConfigs(), originClient)
+	require.NoError(err)
+
+	tag := "namespace-foo/repo-bar:0001"
+	b := []byte(fmt.Sprintf(`{
+	   "schemaVersion": 2,
+	   "mediaType": "application/vnd.oci.image.manifest.v1+json",
+	   "config": {
+		  "mediaType": "application/vnd.cncf.helm.config.v1+json",
+		  "size": 120,
+		  "digest": "%s"
+	   },
+	   "layers": []
+	}`, core.DigestFixture()))
+	manifest, err := core.NewDigester().FromBytes(b)
+	require.NoError(err)
+
+	originClient.EXPECT().DownloadBlob(tag, manifest, mockutil.MatchWriter(b)).Return(nil)
+
+	_, err = m.Resolve(tag, manifest)
+	require.Error(err)
+}
+
+func TestMapResolveDockerManifestList(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	originClient := mockblobclient.NewMockClusterClient(ctrl)
+
+	m, err := NewMap(testConfigs(), originClient)
+	require.NoError(err)
+
+	tag := "namespace-foo/repo-bar:0001"
+	config := core.DigestFixture()
+	base := core.DigestFixture()
+	amd64Layer := core.DigestFixture()
+	arm64Layer := core.DigestFixture()
+	amd64, amd64Raw := dockerutil.ManifestFixture(config, base, amd64Layer)
+	arm64, arm64Raw := dockerutil.ManifestFixture(config, base, arm64Layer)
+	list, listRaw := dockerutil.ManifestListFixture(amd64, arm64)
+
+	originClient.EXPECT().DownloadBlob(tag, list, mockutil.MatchWriter(listRaw)).Return(nil)
+	originClient.EXPECT().DownloadBlob(tag, amd64, mockutil.MatchWriter(amd64Raw)).Return(nil)
+	originClient.EXPECT().DownloadBlob(tag, arm64, mockutil.MatchWriter(arm64Raw)).Return(nil)
+
+	// Blobs shared by platforms are only listed once.
+	deps, err := m.Resolve(tag, list)
+	require.NoError(err)
+	require.Equal(core.DigestList{config, base, amd64Layer, amd64, arm64Layer, arm64, list}, deps)
+}
+
+func TestMapResolveDockerRejectsNestedManifestLists(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	originClient := mockblobclient.NewMockClusterClient(ctrl)
+
+	m, err := NewMap(testConfigs(), originClient)
+	require.NoError(err)
+
+	tag := "namespace-foo/repo-bar:0001"
+	inner, innerRaw := dockerutil.ManifestListFixture(core.DigestFixture())
+	outer, outerRaw := dockerutil.ManifestListFixture(inner)
+
+	originClient.EXPECT().DownloadBlob(tag, outer, mockutil.MatchWriter(outerRaw)).Return(nil)
+	originClient.EXPECT().DownloadBlob(tag, inner, mockutil.MatchWriter(innerRaw)).Return(nil)
+
+	_, err = m.Resolve(tag, outer)
+	require.Error(err)
+}
+
 func TestMapResolveDefault(t *testing.T) {
 	require := require.New(t)
 
@@ -98,3 +229,206 @@ func TestMapGetResolverNamespaceError(t *testing.T) {
 	require.Error(err)
 	require.Equal(errNamespaceNotFound, err)
 }
+
+func TestMapResolveDockerLimits(t *testing.T) {
+	// The manifest fixture has 2 layers and a total size of 4250080 bytes.
+	tests := []struct {
+		description string
+		limits      ManifestLimits
+		exceeded    bool
+	}{
+		{"no limits", ManifestLimits{}, false},
+		{"within limits", ManifestLimits{MaxLayers: 2, MaxImageSize: 5 * datasize.MB}, false},
+		{"too many layers", ManifestLimits{MaxLayers: 1}, true},
+		{"too large", ManifestLimits{MaxImageSize: 4 * datasize.MB}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require := require.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			originClient := mockblobclient.NewMockClusterClient(ctrl)
+
+			m, err := NewMap([]Config{{
+				Namespace: ".*",
+				Type:      "docker",
+				Limits:    test.limits,
+			}}, originClient)
+			require.NoError(err)
+
+			tag := "namespace-foo/repo-bar:0001"
+			layers := core.DigestListFixture(3)
+			manifest, b := dockerutil.ManifestFixture(layers[0], layers[1], layers[2])
+
+			originClient.EXPECT().DownloadBlob(tag, manifest, mockutil.MatchWriter(b)).Return(nil)
+
+			_, err = m.Resolve(tag, manifest)
+			if test.exceeded {
+				_, ok := err.(*ManifestLimitError)
+				require.True(ok, "expected ManifestLimitError, got %v", err)
+			} else {
+				require.NoError(err)
+			}
+		})
+	}
+}
+
+func TestNewMapRejectsLimitsOnDefaultType(t *testing.T) {
+	_, err := NewMap([]Config{{
+		Namespace: ".*",
+		Type:      "default",
+		Limits:    ManifestLimits{MaxLayers: 10},
+	}}, nil)
+	require.Error(t, err)
+}
+
+func imageConfigFixture(architecture string, labels map[string]string) (core.Digest, []byte) {
+	var config imageConfig
+	config.Architecture = architecture
+	config.Config.Labels = labels
+	b, err := json.Marshal(config)
+	if err != nil {
+		panic(err)
+	}
+	d, err := core.NewDigester().FromBytes(b)
+	if err != nil {
+		panic(err)
+	}
+	return d, b
+}
+
+func TestMapResolveDockerPolicy(t *testing.T) {
+	// The manifest fixture has 2 gzip layers of 1902063 and 2345077 bytes.
+	tests := []struct {
+		description string
+		policy      ManifestPolicy
+		rules       []string
+	}{
+		{"no policy", ManifestPolicy{}, nil},
+		{
+			"allowed media type",
+			ManifestPolicy{MediaTypes: []string{schema2.MediaTypeManifest}},
+			nil,
+		}, {
+			"disallowed media type",
+			ManifestPolicy{MediaTypes: []string{dockerutil.MediaTypeOCIManifest}},
+			[]string{RuleMediaTypes},
+		}, {
+			"disallowed layer media type",
+			ManifestPolicy{LayerMediaTypes: []string{"application/vnd.docker.image.rootfs.diff.tar"}},
+			[]string{RuleLayerMediaTypes, RuleLayerMediaTypes},
+		}, {
+			"layer too large",
+			ManifestPolicy{MaxLayerSize: 2 * datasize.MB},
+			[]string{RuleMaxLayerSize},
+		}, {
+			"missing annotation",
+			ManifestPolicy{RequiredAnnotations: []string{"org.opencontainers.image.source"}},
+			[]string{RuleRequiredAnnotations},
+		}, {
+			"labels and architecture",
+			ManifestPolicy{
+				RequiredLabels: []string{"team"},
+				Architectures:  []string{"amd64"},
+			},
+			nil,
+		}, {
+			"missing label and disallowed architecture",
+			ManifestPolicy{
+				RequiredLabels: []string{"team", "owner"},
+				Architectures:  []string{"arm64"},
+			},
+			[]string{RuleRequiredLabels, RuleArchitectures},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require := require.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			originClient := mockblobclient.NewMockClusterClient(ctrl)
+
+			m, err := NewMap([]Config{{
+				Namespace: ".*",
+				Type:      "docker",
+				Policy:    test.policy,
+			}}, originClient)
+			require.NoError(err)
+
+			tag := "namespace-foo/repo-bar:0001"
+			config, configRaw := imageConfigFixture("amd64", map[string]string{"team": "kraken"})
+			layers := core.DigestListFixture(2)
+			manifest, b := dockerutil.ManifestFixture(config, layers[0], layers[1])
+
+			originClient.EXPECT().DownloadBlob(tag, manifest, mockutil.MatchWriter(b)).Return(nil)
+			if test.policy.checksConfig() {
+				originClient.EXPECT().DownloadBlob(
+					tag, config, mockutil.MatchWriter(configRaw)).Return(nil)
+			}
+
+			_, err = m.Resolve(tag, manifest)
+			if test.rules == nil {
+				require.NoError(err)
+				return
+			}
+			perr, ok := err.(*PolicyViolationError)
+			require.True(ok, "expected PolicyViolationError, got %v", err)
+			require.Equal(tag, perr.Tag)
+			var rules []string
+			for _, v := range perr.Violations {
+				require.Equal(manifest, v.Digest)
+				rules = append(rules, v.Rule)
+			}
+			require.Equal(test.rules, rules)
+		})
+	}
+}
+
+func TestMapResolveDockerPolicyManifestList(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	originClient := mockblobclient.NewMockClusterClient(ctrl)
+
+	m, err := NewMap([]Config{{
+		Namespace: ".*",
+		Type:      "docker",
+		Policy:    ManifestPolicy{Architectures: []string{"amd64"}},
+	}}, originClient)
+	require.NoError(err)
+
+	tag := "namespace-foo/repo-bar:0001"
+	amd64Config, amd64ConfigRaw := imageConfigFixture("amd64", nil)
+	arm64Config, arm64ConfigRaw := imageConfigFixture("arm64", nil)
+	amd64, amd64Raw := dockerutil.ManifestFixture(amd64Config, core.DigestFixture(), core.DigestFixture())
+	arm64, arm64Raw := dockerutil.ManifestFixture(arm64Config, core.DigestFixture(), core.DigestFixture())
+	list, listRaw := dockerutil.ManifestListFixture(amd64, arm64)
+
+	originClient.EXPECT().DownloadBlob(tag, list, mockutil.MatchWriter(listRaw)).Return(nil)
+	originClient.EXPECT().DownloadBlob(tag, amd64, mockutil.MatchWriter(amd64Raw)).Return(nil)
+	originClient.EXPECT().DownloadBlob(tag, amd64Config, mockutil.MatchWriter(amd64ConfigRaw)).Return(nil)
+	originClient.EXPECT().DownloadBlob(tag, arm64, mockutil.MatchWriter(arm64Raw)).Return(nil)
+	originClient.EXPECT().DownloadBlob(tag, arm64Config, mockutil.MatchWriter(arm64ConfigRaw)).Return(nil)
+
+	_, err = m.Resolve(tag, list)
+	perr, ok := err.(*PolicyViolationError)
+	require.True(ok, "expected PolicyViolationError, got %v", err)
+	require.Len(perr.Violations, 1)
+	require.Equal(RuleArchitectures, perr.Violations[0].Rule)
+	require.Equal(arm64, perr.Violations[0].Digest)
+}
+
+func TestNewMapRejectsPolicyOnDefaultType(t *testing.T) {
+	_, err := NewMap([]Config{{
+		Namespace: ".*",
+		Type:      "default",
+		Policy:    ManifestPolicy{MaxLayerSize: datasize.GB},
+	}}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagtype
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/dockerutil"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+)
+
+// Manifest policy rules, reported as the rule of each violation.
+const (
+	RuleMediaTypes          = "media_types"
+	RuleLayerMediaTypes     = "layer_media_types"
+	RuleMaxLayerSize        = "max_layer_size"
+	RuleRequiredLabels      = "required_labels"
+	RuleRequiredAnnotations = "required_annotations"
+	RuleArchitectures       = "architectures"
+)
+
+// ManifestPolicy defines rules docker images must satisfy to be tagged. Empty
+// rules are not enforced. Multi-arch images must satisfy every rule on every
+// platform.
+type ManifestPolicy struct {
+	// MediaTypes allows only manifests, including manifest lists, of these
+	// media types.
+	MediaTypes []string `yaml:"media_types"`
+
+	// LayerMediaTypes allows only layers of these media types.
+	LayerMediaTypes []string `yaml:"layer_media_types"`
+
+	// MaxLayerSize is the maximum size of each layer, as declared by its
+	// manifest.
+	MaxLayerSize datasize.ByteSize `yaml:"max_layer_size"`
+
+	// RequiredLabels are labels image configs must set, e.g.
+	// "org.opencontainers.image.source".
+	RequiredLabels []string `yaml:"required_labels"`
+
+	// RequiredAnnotations are annotations image manifests must set.
+	RequiredAnnotations []string `yaml:"required_annotations"`
+
+	// Architectures allows only images of these architectures, as declared by
+	// their configs, e.g. "amd64".
+	Architectures []string `yaml:"architectures"`
+}
+
+func (p ManifestPolicy) enabled() bool {
+	return len(p.MediaTypes) > 0 ||
+		len(p.LayerMediaTypes) > 0 ||
+		p.MaxLayerSize > 0 ||
+		len(p.RequiredAnnotations) > 0 ||
+		p.checksConfig()
+}
+
+// checksConfig returns whether p has rules on image configs, which must be
+// downloaded to be checked.
+func (p ManifestPolicy) checksConfig() bool {
+	return len(p.RequiredLabels) > 0 || len(p.Architectures) > 0
+}
+
+// PolicyViolationError is returned when an image violates the ManifestPolicy
+// of its namespace. Lists every violation, not just the first.
+type PolicyViolationError struct {
+	Tag        string
+	Violations []tagmodels.PolicyViolation
+}
+
+func (e *PolicyViolationError) Error() string {
+	var msgs []string
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.Message)
+	}
+	return fmt.Sprintf("image %s violates policy: %s", e.Tag, strings.Join(msgs, "; "))
+}
+
+// imageConfig is the part of docker and OCI image configs which policies check.
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	Config       struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// configFetcher downloads the image config referenced by desc.
+type configFetcher func(desc distribution.Descriptor) (imageConfig, error)
+
+// policyCheck accumulates the violations of a single image, including every
+// platform of multi-arch images.
+type policyCheck struct {
+	policy     ManifestPolicy
+	violations []tagmodels.PolicyViolation
+}
+
+func (c *policyCheck) violate(rule string, d core.Digest, format string, args ...interface{}) {
+	c.violations = append(c.violations, tagmodels.PolicyViolation{
+		Rule:    rule,
+		Digest:  d,
+		Message: fmt.Sprintf("manifest %s: %s", d, fmt.Sprintf(format, args...)),
+	})
+}
+
+// err returns a PolicyViolationError listing the violations of tag, or nil if
+// there were none.
+func (c *policyCheck) err(tag string) error {
+	if len(c.violations) == 0 {
+		return nil
+	}
+	return &PolicyViolationError{Tag: tag, Violations: c.violations}
+}
+
+// checkMediaType checks the media type of the manifest or manifest list m.
+func (c *policyCheck) checkMediaType(d core.Digest, m distribution.Manifest) error {
+	if len(c.policy.MediaTypes) == 0 {
+		return nil
+	}
+	mediaType, _, err := m.Payload()
+	if err != nil {
+		return fmt.Errorf("payload: %s", err)
+	}
+	if !contains(c.policy.MediaTypes, mediaType) {
+		c.violate(RuleMediaTypes, d, "media type %s not allowed", mediaType)
+	}
+	return nil
+}
+
+// checkImage checks the image manifest m against every rule of the policy.
+func (c *policyCheck) checkImage(
+	d core.Digest, m distribution.Manifest, fetchConfig configFetcher) error {
+
+	if !c.policy.enabled() {
+		return nil
+	}
+	var config distribution.Descriptor
+	var layers []distribution.Descriptor
+	switch dm := m.(type) {
+	case *schema2.DeserializedManifest:
+		config, layers = dm.Config, dm.Layers
+	case *ocischema.DeserializedManifest:
+		config, layers = dm.Config, dm.Layers
+	default:
+		return fmt.Errorf("unsupported manifest type %T", m)
+	}
+	if err := c.checkMediaType(d, m); err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		if len(c.policy.LayerMediaTypes) > 0 && !contains(c.policy.LayerMediaTypes, layer.MediaType) {
+			c.violate(RuleLayerMediaTypes, d,
+				"layer %s media type %s not allowed", layer.Digest, layer.MediaType)
+		}
+		if c.policy.MaxLayerSize > 0 && datasize.ByteSize(layer.Size) > c.policy.MaxLayerSize {
+			c.violate(RuleMaxLayerSize, d,
+				"layer %s size %s, max is %s",
+				layer.Digest, datasize.ByteSize(layer.Size), c.policy.MaxLayerSize)
+		}
+	}
+	if len(c.policy.RequiredAnnotations) > 0 {
+		annotations, err := dockerutil.ManifestAnnotations(m)
+		if err != nil {
+			return err
+		}
+		for _, a := range c.policy.RequiredAnnotations {
+			if _, ok := annotations[a]; !ok {
+				c.violate(RuleRequiredAnnotations, d, "annotation %s required", a)
+			}
+		}
+	}
+	if c.policy.checksConfig() {
+		ic, err := fetchConfig(config)
+		if err != nil {
+			return fmt.Errorf("config %s: %s", config.Digest, err)
+		}
+		for _, l := range c.policy.RequiredLabels {
+			if _, ok := ic.Config.Labels[l]; !ok {
+				c.violate(RuleRequiredLabels, d, "label %s required", l)
+			}
+		}
+		if len(c.policy.Architectures) > 0 && !contains(c.policy.Architectures, ic.Architecture) {
+			c.violate(RuleArchitectures, d, "architecture %q not allowed", ic.Architecture)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
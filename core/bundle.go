@@ -0,0 +1,146 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A bundle is a single blob concatenating several small blobs of an image, such
+// that they are distributed as one torrent instead of one torrent each. Bundles
+// start with the length of their header as a big-endian uint64, followed by a
+// json header listing their entries, followed by the content of each entry in
+// order.
+
+// _maxBundleHeaderSize bounds the header read from untrusted bundles.
+const _maxBundleHeaderSize = 16 << 20
+
+// BundleBlob is a blob to be written to a bundle.
+type BundleBlob struct {
+	Digest Digest
+	Length int64
+}
+
+// BundleEntry locates a blob within a bundle.
+type BundleEntry struct {
+	Digest Digest `json:"digest"`
+
+	// Offset is the offset of the content of the blob from the start of the
+	// bundle.
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// BundleIndex describes the bundle of the small blobs of an image.
+type BundleIndex struct {
+	// Digest is the digest of the bundle blob itself.
+	Digest  Digest        `json:"digest"`
+	Entries []BundleEntry `json:"entries"`
+}
+
+// bundleHeader is the header of a bundle. Entry offsets are relative to the end
+// of the header, since the header length depends on them.
+type bundleHeader struct {
+	Entries []BundleEntry `json:"entries"`
+}
+
+// WriteBundle writes a bundle of blobs to w, copying the content of each blob
+// to the bundle with copyBlob. The content copied must match the digest and
+// length of the blob. Returns the entries of the bundle.
+func WriteBundle(
+	w io.Writer, blobs []BundleBlob, copyBlob func(d Digest, dst io.Writer) error) ([]BundleEntry, error) {
+
+	var h bundleHeader
+	var offset int64
+	for _, b := range blobs {
+		h.Entries = append(h.Entries, BundleEntry{b.Digest, offset, b.Length})
+		offset += b.Length
+	}
+	hb, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("marshal header: %s", err)
+	}
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(hb)))
+	if _, err := w.Write(size[:]); err != nil {
+		return nil, fmt.Errorf("write header size: %s", err)
+	}
+	if _, err := w.Write(hb); err != nil {
+		return nil, fmt.Errorf("write header: %s", err)
+	}
+	for _, b := range blobs {
+		digester := NewDigester()
+		cw := &countingWriter{w: io.MultiWriter(w, digester.hash)}
+		if err := copyBlob(b.Digest, cw); err != nil {
+			return nil, fmt.Errorf("copy %s: %s", b.Digest, err)
+		}
+		if cw.n != b.Length {
+			return nil, fmt.Errorf("copy %s: copied %d bytes, expected %d", b.Digest, cw.n, b.Length)
+		}
+		if d := digester.Digest(); d != b.Digest {
+			return nil, fmt.Errorf("copy %s: content digest is %s", b.Digest, d)
+		}
+	}
+	return absoluteBundleEntries(h.Entries, len(hb)), nil
+}
+
+// ReadBundleEntries reads the entries of the bundle r.
+func ReadBundleEntries(r io.ReaderAt) ([]BundleEntry, error) {
+	var size [8]byte
+	if _, err := r.ReadAt(size[:], 0); err != nil {
+		return nil, fmt.Errorf("read header size: %s", err)
+	}
+	n := binary.BigEndian.Uint64(size[:])
+	if n > _maxBundleHeaderSize {
+		return nil, fmt.Errorf("header size %d exceeds limit", n)
+	}
+	hb := make([]byte, n)
+	if _, err := r.ReadAt(hb, int64(len(size))); err != nil {
+		return nil, fmt.Errorf("read header: %s", err)
+	}
+	var h bundleHeader
+	if err := json.Unmarshal(hb, &h); err != nil {
+		return nil, fmt.Errorf("unmarshal header: %s", err)
+	}
+	for _, e := range h.Entries {
+		if e.Offset < 0 || e.Length < 0 {
+			return nil, errors.New("invalid entry")
+		}
+	}
+	return absoluteBundleEntries(h.Entries, int(n)), nil
+}
+
+func absoluteBundleEntries(entries []BundleEntry, headerSize int) []BundleEntry {
+	abs := make([]BundleEntry, len(entries))
+	for i, e := range entries {
+		e.Offset += int64(8 + headerSize)
+		abs[i] = e
+	}
+	return abs
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
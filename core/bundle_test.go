@@ -0,0 +1,106 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeBundleFixture(blobs ...*BlobFixture) ([]byte, []BundleEntry, error) {
+	content := make(map[Digest][]byte)
+	var bundled []BundleBlob
+	for _, b := range blobs {
+		content[b.Digest] = b.Content
+		bundled = append(bundled, BundleBlob{b.Digest, b.Length()})
+	}
+	var buf bytes.Buffer
+	entries, err := WriteBundle(&buf, bundled, func(d Digest, dst io.Writer) error {
+		_, err := dst.Write(content[d])
+		return err
+	})
+	return buf.Bytes(), entries, err
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	blobs := []*BlobFixture{
+		SizedBlobFixture(10, 4),
+		SizedBlobFixture(20, 4),
+		SizedBlobFixture(30, 4),
+	}
+	bundle, entries, err := writeBundleFixture(blobs...)
+	require.NoError(err)
+
+	result, err := ReadBundleEntries(bytes.NewReader(bundle))
+	require.NoError(err)
+	require.Equal(entries, result)
+
+	require.Len(result, len(blobs))
+	for i, e := range result {
+		require.Equal(blobs[i].Digest, e.Digest)
+		require.Equal(blobs[i].Content, bundle[e.Offset:e.Offset+e.Length])
+	}
+}
+
+func TestWriteBundleRejectsMismatchedContent(t *testing.T) {
+	blob := NewBlobFixture()
+
+	tests := []struct {
+		desc    string
+		content []byte
+	}{
+		{"short", blob.Content[1:]},
+		{"corrupt", append([]byte{blob.Content[0] + 1}, blob.Content[1:]...)},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := WriteBundle(
+				&bytes.Buffer{},
+				[]BundleBlob{{blob.Digest, blob.Length()}},
+				func(d Digest, dst io.Writer) error {
+					_, err := dst.Write(test.content)
+					return err
+				})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestWriteBundleCopyError(t *testing.T) {
+	blob := NewBlobFixture()
+
+	_, err := WriteBundle(
+		&bytes.Buffer{},
+		[]BundleBlob{{blob.Digest, blob.Length()}},
+		func(d Digest, dst io.Writer) error {
+			return errors.New("some error")
+		})
+	require.Error(t, err)
+}
+
+func TestReadBundleEntriesRejectsTruncatedBundle(t *testing.T) {
+	require := require.New(t)
+
+	bundle, _, err := writeBundleFixture(NewBlobFixture())
+	require.NoError(err)
+
+	_, err = ReadBundleEntries(bytes.NewReader(bundle[:10]))
+	require.Error(err)
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package core
+
+import "time"
+
+// DistributionHint advises a peer how to download a blob, based on the
+// tracker's view of the blob's swarm when the peer requested its metainfo.
+type DistributionHint struct {
+	// Length is the size of the blob in bytes.
+	Length int64 `json:"length"`
+
+	// Seeders and Leechers estimate the size of the swarm.
+	Seeders  int `json:"seeders"`
+	Leechers int `json:"leechers"`
+
+	// MaxConnections is the suggested number of concurrent connections for the
+	// torrent. Zero if no suggestion is made.
+	MaxConnections int `json:"max_connections,omitempty"`
+
+	// StallTimeout is the suggested duration a download may make no progress
+	// before it is abandoned. Zero if no suggestion is made.
+	StallTimeout time.Duration `json:"stall_timeout,omitempty"`
+}
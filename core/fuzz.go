@@ -0,0 +1,41 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gofuzz
+// +build gofuzz
+
+package core
+
+import "fmt"
+
+// Fuzz is a go-fuzz target for metainfo deserialization, which peers and
+// trackers perform on metainfo received over the network.
+func Fuzz(data []byte) int {
+	mi, err := DeserializeMetaInfo(data)
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for i := 0; i < mi.NumPieces(); i++ {
+		l := mi.GetPieceLength(i)
+		if l <= 0 || l > mi.PieceLength() {
+			panic(fmt.Sprintf("piece %d has invalid length %d", i, l))
+		}
+		total += l
+	}
+	if total != mi.Length() {
+		panic(fmt.Sprintf("pieces sum to %d, expected length %d", total, mi.Length()))
+	}
+	return 1
+}
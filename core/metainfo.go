@@ -43,6 +43,27 @@ func (info *info) Hash() (InfoHash, error) {
 	return NewInfoHashFromBytes(b.Bytes()), nil
 }
 
+// validate checks that info describes a well-formed torrent, i.e. that it has
+// exactly one piece sum for every piece of the blob.
+func (info *info) validate() error {
+	if info.PieceLength <= 0 {
+		return errors.New("piece length must be positive")
+	}
+	if info.Length < 0 {
+		return errors.New("length must not be negative")
+	}
+	numPieces := info.Length / info.PieceLength
+	if info.Length%info.PieceLength != 0 {
+		numPieces++
+	}
+	if int64(len(info.PieceSums)) != numPieces {
+		return fmt.Errorf(
+			"expected %d piece sums for length %d and piece length %d, got %d",
+			numPieces, info.Length, info.PieceLength, len(info.PieceSums))
+	}
+	return nil
+}
+
 // MetaInfo contains torrent metadata.
 type MetaInfo struct {
 	info     info
@@ -135,6 +156,9 @@ func DeserializeMetaInfo(data []byte) (*MetaInfo, error) {
 	if err := json.Unmarshal(data, &j); err != nil {
 		return nil, fmt.Errorf("json: %s", err)
 	}
+	if err := j.Info.validate(); err != nil {
+		return nil, fmt.Errorf("invalid info: %s", err)
+	}
 	h, err := j.Info.Hash()
 	if err != nil {
 		return nil, fmt.Errorf("compute info hash: %s", err)
@@ -14,6 +14,7 @@
 package core
 
 import (
+	"encoding/json"
 	"math/rand"
 	"testing"
 
@@ -118,3 +119,25 @@ func TestMetaInfoSerializationLimit(t *testing.T) {
 		})
 	}
 }
+
+func TestDeserializeMetaInfoRejectsMalformedInfo(t *testing.T) {
+	name := DigestFixture().Hex()
+
+	tests := []struct {
+		desc string
+		info info
+	}{
+		{"zero piece length", info{PieceLength: 0, PieceSums: []uint32{1}, Name: name, Length: 1}},
+		{"negative length", info{PieceLength: 4, PieceSums: nil, Name: name, Length: -1}},
+		{"missing piece sums", info{PieceLength: 4, PieceSums: []uint32{1}, Name: name, Length: 5}},
+		{"extra piece sums", info{PieceLength: 4, PieceSums: []uint32{1, 2}, Name: name, Length: 4}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			b, err := json.Marshal(&metaInfoJSON{test.info})
+			require.NoError(t, err)
+			_, err = DeserializeMetaInfo(b)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxNetworks caps the number of labeled networks a peer may announce.
+const MaxNetworks = 8
+
+// ValidNetworkLabel returns whether label may name a network. Labels are
+// restricted to alphanumerics, '-' and '_', such that they can be embedded in
+// storage keys.
+func ValidNetworkLabel(label string) bool {
+	if label == "" || len(label) > 64 {
+		return false
+	}
+	for _, r := range label {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ParseNetworks parses a comma separated list of 'label=ip' pairs, e.g.
+// "storage=10.1.0.1,service=10.2.0.1". Returns nil if s is empty.
+func ParseNetworks(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	networks := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid network %q: expected 'label=ip'", pair)
+		}
+		label, ip := parts[0], parts[1]
+		if !ValidNetworkLabel(label) {
+			return nil, fmt.Errorf("invalid network label %q", label)
+		}
+		if AddressFamily(ip) == "" {
+			return nil, fmt.Errorf("invalid ip %q for network %s", ip, label)
+		}
+		if _, ok := networks[label]; ok {
+			return nil, fmt.Errorf("duplicate network %s", label)
+		}
+		networks[label] = ip
+	}
+	if len(networks) > MaxNetworks {
+		return nil, fmt.Errorf("at most %d networks allowed", MaxNetworks)
+	}
+	return networks, nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidNetworkLabel(t *testing.T) {
+	for label, expected := range map[string]bool{
+		"storage":   true,
+		"svc-net_1": true,
+		"":          false,
+		"a:b":       false,
+		"a=b":       false,
+		"a,b":       false,
+	} {
+		require.Equal(t, expected, ValidNetworkLabel(label), label)
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	require := require.New(t)
+
+	networks, err := ParseNetworks("")
+	require.NoError(err)
+	require.Nil(networks)
+
+	networks, err = ParseNetworks("storage=10.1.0.1,service=2001:db8::1")
+	require.NoError(err)
+	require.Equal(map[string]string{
+		"storage": "10.1.0.1",
+		"service": "2001:db8::1",
+	}, networks)
+}
+
+func TestParseNetworksErrors(t *testing.T) {
+	for _, s := range []string{
+		"storage",
+		"=10.1.0.1",
+		"sto:rage=10.1.0.1",
+		"storage=host.example.com",
+		"storage=10.1.0.1,storage=10.1.0.2",
+	} {
+		_, err := ParseNetworks(s)
+		require.Error(t, err, s)
+	}
+}
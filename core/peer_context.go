@@ -26,12 +26,30 @@ type PeerContext struct {
 	IP   string `json:"ip"`
 	Port int    `json:"port"`
 
+	// IPv6 is an optional IPv6 address which dual-stack peers announce in
+	// addition to IP.
+	IPv6 string `json:"ipv6,omitempty"`
+
+	// Networks maps labels of additional networks the peer is reachable on,
+	// e.g. "storage", to its IP on each. Multi-homed peers announce these
+	// such that trackers can hand out addresses on preferred networks.
+	Networks map[string]string `json:"networks,omitempty"`
+
+	// Hostname is an optional DNS name the peer will announce itself as, for
+	// environments which address peers by name, e.g. for TLS validation.
+	Hostname string `json:"hostname,omitempty"`
+
 	// PeerID the peer will identify itself as.
 	PeerID PeerID `json:"peer_id"`
 
 	// Zone is the zone the peer is running within.
 	Zone string `json:"zone"`
 
+	// Rack and DC optionally locate the peer within the cluster, for trackers
+	// without a topology covering it.
+	Rack string `json:"rack,omitempty"`
+	DC   string `json:"dc,omitempty"`
+
 	// Cluster is the Kraken cluster the peer is running within.
 	Cluster string `json:"cluster"`
 
@@ -62,3 +80,17 @@ func NewPeerContext(
 		Origin:  origin,
 	}, nil
 }
+
+// AddressFamilies returns the address families of the IPs pctx announces,
+// which are the families the peer can connect to other peers over.
+func (pctx PeerContext) AddressFamilies() []string {
+	var families []string
+	seen := make(map[string]bool)
+	for _, ip := range []string{pctx.IP, pctx.IPv6} {
+		if f := AddressFamily(ip); f != "" && !seen[f] {
+			seen[f] = true
+			families = append(families, f)
+		}
+	}
+	return families
+}
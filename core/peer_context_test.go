@@ -65,3 +65,16 @@ func TestNewOriginPeerContextErrors(t *testing.T) {
 		require.Error(err)
 	})
 }
+
+func TestPeerContextAddressFamilies(t *testing.T) {
+	require := require.New(t)
+
+	p := PeerContextFixture()
+	require.Equal([]string{IPv4}, p.AddressFamilies())
+
+	p.IPv6 = "2001:db8::1"
+	require.Equal([]string{IPv4, IPv6}, p.AddressFamilies())
+
+	p.IP = "2001:db8::2"
+	require.Equal([]string{IPv6}, p.AddressFamilies())
+}
@@ -13,7 +13,31 @@
 // limitations under the License.
 package core
 
-import "sort"
+import (
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Address families of peer IPs.
+const (
+	IPv4 = "ipv4"
+	IPv6 = "ipv6"
+)
+
+// AddressFamily returns the address family of ip, or "" if ip is not a valid
+// IP address. IPv4-mapped IPv6 addresses are IPv4.
+func AddressFamily(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if parsed.To4() != nil {
+		return IPv4
+	}
+	return IPv6
+}
 
 // PeerInfo defines peer metadata scoped to a torrent.
 type PeerInfo struct {
@@ -22,6 +46,32 @@ type PeerInfo struct {
 	Port     int    `json:"port"`
 	Origin   bool   `json:"origin"`
 	Complete bool   `json:"complete"`
+
+	// Hostname is an optional DNS name of the peer. Handouts may carry IP,
+	// Hostname, or both, depending on tracker configuration.
+	Hostname string `json:"hostname,omitempty"`
+
+	// Zone is the zone / datacenter the peer is running within, if known.
+	Zone string `json:"zone,omitempty"`
+
+	// Rack and DC locate the peer for topology-aware handouts, if known.
+	// Locations from the tracker's configured topology take precedence.
+	Rack string `json:"rack,omitempty"`
+	DC   string `json:"dc,omitempty"`
+
+	// IPv6 is an optional second address of dual-stack peers, which announce
+	// their IPv4 address in IP. Handouts carry the address the receiving peer
+	// can reach in IP, and omit IPv6.
+	IPv6 string `json:"ipv6,omitempty"`
+
+	// Networks maps labels of additional networks a multi-homed peer is
+	// reachable on, e.g. "storage", to its IP on each. Handouts carry the
+	// address of the preferred network in IP, and omit Networks.
+	Networks map[string]string `json:"networks,omitempty"`
+
+	// LastSeen is when the peer last announced, if the peer store records
+	// it. Only used by trackers, and never sent to peers.
+	LastSeen time.Time `json:"-"`
 }
 
 // NewPeerInfo creates a new PeerInfo.
@@ -43,7 +93,38 @@ func NewPeerInfo(
 
 // PeerInfoFromContext derives PeerInfo from a PeerContext.
 func PeerInfoFromContext(pctx PeerContext, complete bool) *PeerInfo {
-	return NewPeerInfo(pctx.PeerID, pctx.IP, pctx.Port, pctx.Origin, complete)
+	p := NewPeerInfo(pctx.PeerID, pctx.IP, pctx.Port, pctx.Origin, complete)
+	p.Hostname = pctx.Hostname
+	p.Zone = pctx.Zone
+	p.Rack = pctx.Rack
+	p.DC = pctx.DC
+	p.IPv6 = pctx.IPv6
+	p.Networks = pctx.Networks
+	return p
+}
+
+// Addr returns the address used to connect to p. Hostname is preferred over
+// IP if set.
+func (p *PeerInfo) Addr() string {
+	host := p.IP
+	if p.Hostname != "" {
+		host = p.Hostname
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p.Port))
+}
+
+// IPs returns the addresses of p by family. Addresses which are not valid IPs
+// are omitted.
+func (p *PeerInfo) IPs() map[string]string {
+	ips := make(map[string]string)
+	for _, ip := range []string{p.IP, p.IPv6} {
+		if f := AddressFamily(ip); f != "" {
+			if _, ok := ips[f]; !ok {
+				ips[f] = ip
+			}
+		}
+	}
+	return ips
 }
 
 // PeerInfos groups PeerInfo structs for sorting.
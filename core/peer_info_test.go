@@ -30,3 +30,45 @@ func TestSortedByPeerID(t *testing.T) {
 	require.True(sorted[0].PeerID.LessThan(sorted[1].PeerID))
 	require.True(sorted[1].PeerID.LessThan(sorted[2].PeerID))
 }
+
+func TestPeerInfoAddrPrefersHostname(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPeerInfo(PeerIDFixture(), "10.0.0.1", 8080, false, false)
+	require.Equal("10.0.0.1:8080", p.Addr())
+
+	p.Hostname = "agent1.example.com"
+	require.Equal("agent1.example.com:8080", p.Addr())
+}
+
+func TestPeerInfoAddrBracketsIPv6(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPeerInfo(PeerIDFixture(), "2001:db8::1", 8080, false, false)
+	require.Equal("[2001:db8::1]:8080", p.Addr())
+}
+
+func TestAddressFamily(t *testing.T) {
+	for ip, expected := range map[string]string{
+		"10.0.0.1":          IPv4,
+		"::ffff:10.0.0.1":   IPv4,
+		"2001:db8::1":       IPv6,
+		"agent.example.com": "",
+		"":                  "",
+	} {
+		require.Equal(t, expected, AddressFamily(ip), ip)
+	}
+}
+
+func TestPeerInfoIPs(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPeerInfo(PeerIDFixture(), "10.0.0.1", 8080, false, false)
+	require.Equal(map[string]string{IPv4: "10.0.0.1"}, p.IPs())
+
+	p.IPv6 = "2001:db8::1"
+	require.Equal(map[string]string{IPv4: "10.0.0.1", IPv6: "2001:db8::1"}, p.IPs())
+
+	p.IP = ""
+	require.Equal(map[string]string{IPv6: "2001:db8::1"}, p.IPs())
+}
@@ -76,6 +76,7 @@ const (
 	Message_CANCEL_PIECE  Message_Type = 4
 	Message_ERROR         Message_Type = 5
 	Message_COMPLETE      Message_Type = 6
+	Message_KEEPALIVE     Message_Type = 7
 )
 
 var Message_Type_name = map[int32]string{
@@ -86,6 +87,7 @@ var Message_Type_name = map[int32]string{
 	4: "CANCEL_PIECE",
 	5: "ERROR",
 	6: "COMPLETE",
+	7: "KEEPALIVE",
 }
 var Message_Type_value = map[string]int32{
 	"BITFIELD":      0,
@@ -95,6 +97,7 @@ var Message_Type_value = map[string]int32{
 	"CANCEL_PIECE":  4,
 	"ERROR":         5,
 	"COMPLETE":      6,
+	"KEEPALIVE":     7,
 }
 
 func (x Message_Type) String() string {
@@ -288,46 +291,47 @@ func init() {
 func init() { proto.RegisterFile("proto/p2p/p2p.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 647 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x54, 0x4f, 0x6f, 0xd3, 0x4e,
-	0x10, 0x6d, 0x12, 0x3b, 0x7f, 0x26, 0x69, 0xeb, 0x6c, 0xa3, 0xdf, 0xcf, 0x14, 0x0e, 0x95, 0x45,
-	0x45, 0x85, 0xa0, 0xad, 0xcc, 0x05, 0x10, 0x12, 0x4a, 0x1c, 0x57, 0x44, 0x4a, 0x9b, 0xb0, 0xa4,
-	0x07, 0xc4, 0xa1, 0x72, 0x9d, 0x49, 0x6b, 0x91, 0x7a, 0x8d, 0xed, 0x56, 0xcd, 0xd7, 0xe0, 0x43,
-	0x21, 0xf1, 0xad, 0xd0, 0x4e, 0xec, 0xc4, 0x6e, 0x02, 0xe2, 0xc0, 0x21, 0x92, 0xdf, 0xf3, 0x7b,
-	0xb3, 0xb3, 0x33, 0x2f, 0x86, 0x9d, 0x20, 0x14, 0xb1, 0x38, 0x0a, 0xcc, 0x40, 0xfe, 0x0e, 0x09,
-	0xb1, 0x52, 0x60, 0x06, 0xc6, 0x8f, 0x22, 0x6c, 0x77, 0xbc, 0x78, 0xe2, 0xe1, 0x74, 0x7c, 0x8a,
-	0x51, 0xe4, 0x5c, 0x21, 0xdb, 0x85, 0xaa, 0xe7, 0x4f, 0xc4, 0x07, 0x27, 0xba, 0xd6, 0x8b, 0x7b,
-	0x85, 0x83, 0x1a, 0x5f, 0x60, 0xc6, 0x40, 0xf1, 0x9d, 0x1b, 0xd4, 0x4b, 0xc4, 0xd3, 0x33, 0xfb,
-	0x0f, 0xca, 0x01, 0x62, 0xd8, 0xeb, 0xea, 0x0a, 0xb1, 0x09, 0x62, 0x4f, 0x61, 0xf3, 0x32, 0x29,
-	0xdd, 0x99, 0xc5, 0x18, 0xe9, 0xea, 0x5e, 0xe1, 0xa0, 0xc1, 0xf3, 0x24, 0x7b, 0x02, 0x35, 0x59,
-	0x25, 0x0a, 0x1c, 0x17, 0xf5, 0x32, 0x15, 0x58, 0x12, 0xec, 0x02, 0x76, 0x42, 0xbc, 0x11, 0x31,
-	0x76, 0x72, 0x95, 0x2a, 0x7b, 0xa5, 0x83, 0xba, 0xf9, 0xf2, 0x50, 0xde, 0xe6, 0x41, 0xfb, 0x87,
-	0x7c, 0x55, 0x6f, 0xfb, 0x71, 0x38, 0xe3, 0xeb, 0x2a, 0xed, 0x9e, 0x80, 0xfe, 0x3b, 0x03, 0xd3,
-	0xa0, 0xf4, 0x15, 0x67, 0x7a, 0x81, 0x9a, 0x92, 0x8f, 0xac, 0x05, 0xea, 0x9d, 0x33, 0xbd, 0x45,
-	0x9a, 0x4b, 0x83, 0xcf, 0xc1, 0xdb, 0xe2, 0xeb, 0x82, 0xf1, 0x05, 0x76, 0x86, 0x1e, 0xba, 0xc8,
-	0xf1, 0xdb, 0x2d, 0x46, 0x71, 0x3a, 0xcb, 0x16, 0xa8, 0x9e, 0x3f, 0xc6, 0x7b, 0x32, 0xa8, 0x7c,
-	0x0e, 0xe4, 0xc4, 0xc4, 0x64, 0x12, 0x61, 0x4c, 0x73, 0x54, 0x79, 0x82, 0x24, 0x3f, 0x45, 0xff,
-	0x2a, 0xbe, 0xa6, 0x49, 0xaa, 0x3c, 0x41, 0x46, 0x94, 0x14, 0x1f, 0x3a, 0xb3, 0xa9, 0x70, 0xc6,
-	0xff, 0xb4, 0xb8, 0xe4, 0xc7, 0xde, 0x15, 0x46, 0x31, 0xed, 0xa7, 0xc6, 0x13, 0x64, 0xbc, 0x80,
-	0x56, 0xdb, 0xf7, 0xc5, 0xad, 0xef, 0x22, 0x1d, 0xfe, 0xc7, 0x53, 0x8d, 0xe7, 0xc0, 0x2c, 0xc7,
-	0x77, 0x71, 0xfa, 0x17, 0xda, 0xef, 0x05, 0x68, 0xd8, 0x61, 0x28, 0xc2, 0x8c, 0x0c, 0x25, 0x4e,
-	0xe2, 0x36, 0x07, 0x4b, 0x73, 0x29, 0x7b, 0xbd, 0x23, 0x50, 0x5c, 0x31, 0x46, 0xba, 0xc4, 0x96,
-	0xf9, 0x98, 0x22, 0x90, 0x2d, 0x36, 0x07, 0x96, 0x18, 0x23, 0x27, 0xa1, 0xb1, 0x0f, 0xb5, 0x05,
-	0xc5, 0x74, 0x68, 0x0d, 0x7b, 0xb6, 0x65, 0x5f, 0x70, 0xfb, 0xe3, 0xb9, 0xfd, 0x69, 0x74, 0x71,
-	0xd2, 0xee, 0xf5, 0xed, 0xae, 0xb6, 0x61, 0x34, 0x61, 0xdb, 0x12, 0x37, 0xc1, 0x14, 0xe3, 0xb4,
-	0x7b, 0xe3, 0xa7, 0x02, 0x95, 0xb4, 0x45, 0x1d, 0x2a, 0x77, 0x18, 0x46, 0x9e, 0xf0, 0x93, 0x3c,
-	0xa4, 0x90, 0xed, 0x83, 0x12, 0xcf, 0x82, 0x79, 0x24, 0xb6, 0xcc, 0x26, 0x35, 0x94, 0xf6, 0x32,
-	0x9a, 0x05, 0xc8, 0xe9, 0x35, 0x3b, 0x86, 0x6a, 0x1a, 0x7c, 0xba, 0x50, 0xdd, 0x6c, 0xad, 0x8b,
-	0x2f, 0x5f, 0xa8, 0xd8, 0x3b, 0x68, 0x04, 0x99, 0x48, 0xd1, 0x8d, 0xeb, 0xa6, 0x4e, 0xae, 0x35,
-	0x59, 0xe3, 0x39, 0xf5, 0xc2, 0x9d, 0x64, 0x86, 0x96, 0x9b, 0x73, 0xe7, 0xc3, 0xc4, 0x73, 0x6a,
-	0xf6, 0x1e, 0x36, 0x9d, 0xec, 0xf2, 0xe9, 0x9f, 0x59, 0x37, 0x1f, 0x91, 0x7d, 0x5d, 0x2c, 0x78,
-	0x5e, 0xcf, 0xde, 0x40, 0xdd, 0x5d, 0xe6, 0x41, 0xaf, 0x90, 0xfd, 0x7f, 0xb2, 0xaf, 0xe6, 0x84,
-	0x67, 0xb5, 0xec, 0x59, 0x9a, 0x86, 0x2a, 0x99, 0x9a, 0x2b, 0x2b, 0x4e, 0x03, 0x72, 0x0c, 0x55,
-	0x37, 0x59, 0x99, 0x5e, 0xcb, 0x8c, 0xf4, 0xc1, 0x1e, 0xf9, 0x42, 0x65, 0xdc, 0x83, 0x22, 0x57,
-	0xc2, 0x1a, 0x50, 0xed, 0xf4, 0x46, 0x27, 0x3d, 0xbb, 0xdf, 0xd5, 0x36, 0x58, 0x13, 0x36, 0x73,
-	0xa1, 0xd0, 0x0a, 0x4b, 0x6a, 0xd8, 0xfe, 0xdc, 0x1f, 0xb4, 0xbb, 0x5a, 0x51, 0x52, 0xed, 0xb3,
-	0xb3, 0xc1, 0xb9, 0x24, 0xe5, 0x2b, 0xad, 0xc4, 0x34, 0x68, 0x58, 0xed, 0x33, 0xcb, 0xee, 0x27,
-	0x8c, 0xc2, 0x6a, 0xa0, 0xda, 0x9c, 0x0f, 0xb8, 0xa6, 0xca, 0x33, 0xac, 0xc1, 0xe9, 0xb0, 0x6f,
-	0x8f, 0x6c, 0xad, 0x7c, 0x59, 0xa6, 0x8f, 0xee, 0xab, 0x5f, 0x01, 0x00, 0x00, 0xff, 0xff, 0xfd,
-	0x11, 0xd8, 0xe6, 0x8b, 0x05, 0x00, 0x00,
+	// 657 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xad, 0x54, 0x4d, 0x6f, 0xd3, 0x40,
+	0x10, 0x25, 0x89, 0xf3, 0x35, 0x49, 0x5a, 0x67, 0x1b, 0x81, 0x29, 0x1c, 0x2a, 0x8b, 0x8a, 0x0a,
+	0x41, 0x8b, 0xcc, 0x05, 0x10, 0x12, 0x72, 0xdc, 0xad, 0x88, 0x48, 0x9b, 0xb0, 0x4d, 0x91, 0x10,
+	0x87, 0xca, 0x4d, 0x36, 0xad, 0x45, 0x6a, 0x1b, 0xdb, 0xad, 0xc8, 0x2f, 0xe0, 0xce, 0x8f, 0xe2,
+	0x3f, 0xf0, 0x6f, 0xd8, 0x1d, 0xdb, 0x89, 0xdd, 0x06, 0xc4, 0x81, 0x83, 0xa5, 0x7d, 0x6f, 0xdf,
+	0xcc, 0xce, 0xce, 0x3c, 0x2f, 0x6c, 0xf8, 0x81, 0x17, 0x79, 0x7b, 0xbe, 0xe1, 0xcb, 0x6f, 0x17,
+	0x11, 0x29, 0x89, 0xa5, 0xfe, 0xb3, 0x08, 0xeb, 0x5d, 0x27, 0x9a, 0x3a, 0x7c, 0x36, 0x39, 0xe4,
+	0x61, 0x68, 0x9f, 0x73, 0xb2, 0x09, 0x35, 0xc7, 0x9d, 0x7a, 0xef, 0xec, 0xf0, 0x42, 0x2b, 0x6e,
+	0x15, 0x76, 0xea, 0x6c, 0x81, 0x09, 0x01, 0xc5, 0xb5, 0x2f, 0xb9, 0x56, 0x42, 0x1e, 0xd7, 0xe4,
+	0x2e, 0x54, 0x7c, 0xce, 0x83, 0xde, 0xbe, 0xa6, 0x20, 0x9b, 0x20, 0xf2, 0x08, 0x5a, 0x67, 0x49,
+	0xea, 0xee, 0x3c, 0xe2, 0xa1, 0x56, 0x16, 0xdb, 0x4d, 0x96, 0x27, 0xc9, 0x43, 0xa8, 0xcb, 0x2c,
+	0xa1, 0x6f, 0x8f, 0xb9, 0x56, 0xc1, 0x04, 0x4b, 0x82, 0x9c, 0xc2, 0x46, 0xc0, 0x2f, 0xbd, 0x88,
+	0x77, 0x73, 0x99, 0xaa, 0x5b, 0xa5, 0x9d, 0x86, 0xf1, 0x6c, 0x57, 0xde, 0xe6, 0x46, 0xf9, 0xbb,
+	0xec, 0xb6, 0x9e, 0xba, 0x51, 0x30, 0x67, 0xab, 0x32, 0x6d, 0x1e, 0x80, 0xf6, 0xa7, 0x00, 0xa2,
+	0x42, 0xe9, 0x0b, 0x9f, 0x6b, 0x05, 0x2c, 0x4a, 0x2e, 0x49, 0x07, 0xca, 0xd7, 0xf6, 0xec, 0x8a,
+	0x63, 0x5f, 0x9a, 0x2c, 0x06, 0xaf, 0x8b, 0x2f, 0x0b, 0xfa, 0x67, 0xd8, 0x18, 0x3a, 0x7c, 0xcc,
+	0x19, 0xff, 0x7a, 0xc5, 0xc3, 0x28, 0xed, 0xa5, 0x08, 0x70, 0xdc, 0x09, 0xff, 0x86, 0x01, 0x65,
+	0x16, 0x03, 0xd9, 0x31, 0x6f, 0x3a, 0x0d, 0x79, 0x84, 0x7d, 0x2c, 0xb3, 0x04, 0x49, 0x7e, 0xc6,
+	0xdd, 0xf3, 0xe8, 0x02, 0x3b, 0x29, 0xf8, 0x18, 0xe9, 0x61, 0x92, 0x7c, 0x68, 0xcf, 0x67, 0x9e,
+	0x3d, 0xf9, 0xaf, 0xc9, 0x25, 0x3f, 0x71, 0xce, 0x45, 0xcd, 0x38, 0x1f, 0x31, 0xbe, 0x18, 0xe9,
+	0x4f, 0xa1, 0x63, 0xba, 0xae, 0x77, 0xe5, 0x8a, 0x73, 0xe5, 0xe1, 0x7f, 0x3d, 0x55, 0x7f, 0x02,
+	0xc4, 0xb2, 0x85, 0x74, 0xf6, 0x0f, 0xda, 0x1f, 0x05, 0x68, 0xd2, 0x20, 0xf0, 0x82, 0x8c, 0x8c,
+	0x4b, 0x9c, 0xd8, 0x2d, 0x06, 0xcb, 0xe0, 0x52, 0xf6, 0x7a, 0x7b, 0xa0, 0x8c, 0xbd, 0x09, 0xc7,
+	0x4b, 0xac, 0x19, 0x0f, 0xd0, 0x02, 0xd9, 0x64, 0x31, 0xb0, 0x84, 0x84, 0xa1, 0x50, 0xdf, 0x86,
+	0xfa, 0x82, 0x22, 0x1a, 0x74, 0x86, 0x3d, 0x6a, 0xd1, 0x53, 0x46, 0x3f, 0x9c, 0xd0, 0xe3, 0xd1,
+	0xe9, 0x81, 0xd9, 0xeb, 0xd3, 0x7d, 0xf5, 0x8e, 0xde, 0x86, 0x75, 0xcb, 0xbb, 0xf4, 0x67, 0x3c,
+	0x4a, 0xab, 0xd7, 0x7f, 0x29, 0x50, 0x4d, 0x4b, 0xd4, 0xa0, 0x7a, 0xcd, 0x83, 0xd0, 0xf1, 0xdc,
+	0xc4, 0x0f, 0x29, 0x24, 0xdb, 0xa0, 0x44, 0x73, 0x3f, 0xb6, 0xc4, 0x9a, 0xd1, 0xc6, 0x82, 0xd2,
+	0x5a, 0x46, 0x62, 0x83, 0xe1, 0x36, 0x79, 0x0e, 0xb5, 0xd4, 0xf8, 0x78, 0xa1, 0x86, 0xd1, 0x59,
+	0x65, 0x5f, 0xb6, 0x50, 0x91, 0x37, 0xd0, 0xf4, 0x33, 0x96, 0xc2, 0x1b, 0x37, 0x0c, 0x0d, 0xa3,
+	0x56, 0x78, 0x8d, 0xe5, 0xd4, 0x8b, 0xe8, 0xc4, 0x33, 0x38, 0xdc, 0x5c, 0x74, 0xde, 0x4c, 0x2c,
+	0xa7, 0x26, 0x6f, 0xa1, 0x65, 0x67, 0x87, 0x8f, 0x7f, 0x66, 0xc3, 0xb8, 0x8f, 0xe1, 0xab, 0x6c,
+	0xc1, 0xf2, 0x7a, 0xf2, 0x0a, 0x1a, 0xe3, 0xa5, 0x1f, 0xc4, 0x0f, 0x2b, 0xc3, 0xef, 0x61, 0xf8,
+	0x6d, 0x9f, 0xb0, 0xac, 0x96, 0x3c, 0x4e, 0xdd, 0x50, 0xc3, 0xa0, 0xf6, 0xad, 0x11, 0xa7, 0x06,
+	0x11, 0x2d, 0x1d, 0x27, 0x23, 0xd3, 0xea, 0x99, 0x96, 0xde, 0x98, 0x23, 0x5b, 0xa8, 0xf4, 0xef,
+	0x05, 0x50, 0xe4, 0x4c, 0x48, 0x13, 0x6a, 0xdd, 0xde, 0xe8, 0xa0, 0x47, 0xfb, 0x62, 0xf6, 0xa4,
+	0x0d, 0xad, 0x9c, 0x2b, 0xd4, 0xc2, 0x92, 0x1a, 0x9a, 0x9f, 0xfa, 0x03, 0x73, 0x5f, 0x2d, 0x4a,
+	0xca, 0x3c, 0x3a, 0x1a, 0x9c, 0x48, 0x52, 0x6e, 0xa9, 0x25, 0xf1, 0x42, 0x34, 0x2d, 0xf3, 0xc8,
+	0xa2, 0xfd, 0x84, 0x51, 0x48, 0x1d, 0xca, 0x94, 0xb1, 0x01, 0x53, 0xcb, 0xf2, 0x0c, 0x6b, 0x70,
+	0x38, 0xec, 0xd3, 0x11, 0x55, 0x2b, 0xa4, 0x05, 0xf5, 0xf7, 0x94, 0x0e, 0xcd, 0x7e, 0xef, 0x23,
+	0x55, 0xab, 0x67, 0x15, 0x7c, 0x84, 0x5f, 0xfc, 0x06, 0x6e, 0x51, 0x10, 0x15, 0x9b, 0x05, 0x00,
+	0x00,
 }
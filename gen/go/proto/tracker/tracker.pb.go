@@ -0,0 +1,456 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Code generated by protoc-gen-go.
+// source: proto/tracker/tracker.proto
+// DO NOT EDIT!
+
+/*
+Package tracker is a generated protocol buffer package.
+
+It is generated from these files:
+	proto/tracker/tracker.proto
+
+It has these top-level messages:
+	GetMetaInfoRequest
+	GetMetaInfoResponse
+	Peer
+	Token
+	AnnounceRequest
+	AnnounceResponse
+	ScrapeRequest
+	SwarmStats
+	ScrapeResponse
+	GetHostInfoHashesRequest
+	GetHostInfoHashesResponse
+*/
+package tracker
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type GetMetaInfoRequest struct {
+	Namespace string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+	Digest    string `protobuf:"bytes,2,opt,name=digest" json:"digest,omitempty"`
+}
+
+func (m *GetMetaInfoRequest) Reset()                    { *m = GetMetaInfoRequest{} }
+func (m *GetMetaInfoRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetMetaInfoRequest) ProtoMessage()               {}
+func (*GetMetaInfoRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+type GetMetaInfoResponse struct {
+	InfoHash string `protobuf:"bytes,1,opt,name=info_hash,json=infoHash" json:"info_hash,omitempty"`
+	// metainfo is the json metainfo, as served by the HTTP API.
+	Metainfo []byte `protobuf:"bytes,2,opt,name=metainfo,proto3" json:"metainfo,omitempty"`
+}
+
+func (m *GetMetaInfoResponse) Reset()                    { *m = GetMetaInfoResponse{} }
+func (m *GetMetaInfoResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetMetaInfoResponse) ProtoMessage()               {}
+func (*GetMetaInfoResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+type Peer struct {
+	PeerId   string `protobuf:"bytes,1,opt,name=peer_id,json=peerId" json:"peer_id,omitempty"`
+	Ip       string `protobuf:"bytes,2,opt,name=ip" json:"ip,omitempty"`
+	Port     int32  `protobuf:"varint,3,opt,name=port" json:"port,omitempty"`
+	Complete bool   `protobuf:"varint,4,opt,name=complete" json:"complete,omitempty"`
+	Origin   bool   `protobuf:"varint,5,opt,name=origin" json:"origin,omitempty"`
+	Hostname string `protobuf:"bytes,6,opt,name=hostname" json:"hostname,omitempty"`
+	Zone     string `protobuf:"bytes,7,opt,name=zone" json:"zone,omitempty"`
+	Rack     string `protobuf:"bytes,8,opt,name=rack" json:"rack,omitempty"`
+	Dc       string `protobuf:"bytes,9,opt,name=dc" json:"dc,omitempty"`
+}
+
+func (m *Peer) Reset()                    { *m = Peer{} }
+func (m *Peer) String() string            { return proto.CompactTextString(m) }
+func (*Peer) ProtoMessage()               {}
+func (*Peer) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+type Token struct {
+	Nonce     string `protobuf:"bytes,1,opt,name=nonce" json:"nonce,omitempty"`
+	Timestamp int64  `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	Signature string `protobuf:"bytes,3,opt,name=signature" json:"signature,omitempty"`
+}
+
+func (m *Token) Reset()                    { *m = Token{} }
+func (m *Token) String() string            { return proto.CompactTextString(m) }
+func (*Token) ProtoMessage()               {}
+func (*Token) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+type AnnounceRequest struct {
+	Namespace string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+	Digest    string `protobuf:"bytes,2,opt,name=digest" json:"digest,omitempty"`
+	InfoHash  string `protobuf:"bytes,3,opt,name=info_hash,json=infoHash" json:"info_hash,omitempty"`
+	Peer      *Peer  `protobuf:"bytes,4,opt,name=peer" json:"peer,omitempty"`
+	// token is only required when the tracker enforces announce tokens.
+	Token      *Token `protobuf:"bytes,5,opt,name=token" json:"token,omitempty"`
+	Uploaded   int64  `protobuf:"varint,6,opt,name=uploaded" json:"uploaded,omitempty"`
+	Downloaded int64  `protobuf:"varint,7,opt,name=downloaded" json:"downloaded,omitempty"`
+	// address_families lists the families the peer can connect over, e.g.
+	// "ipv4". All families are handed out if empty.
+	AddressFamilies []string `protobuf:"bytes,8,rep,name=address_families,json=addressFamilies" json:"address_families,omitempty"`
+}
+
+func (m *AnnounceRequest) Reset()                    { *m = AnnounceRequest{} }
+func (m *AnnounceRequest) String() string            { return proto.CompactTextString(m) }
+func (*AnnounceRequest) ProtoMessage()               {}
+func (*AnnounceRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *AnnounceRequest) GetPeer() *Peer {
+	if m != nil {
+		return m.Peer
+	}
+	return nil
+}
+
+func (m *AnnounceRequest) GetToken() *Token {
+	if m != nil {
+		return m.Token
+	}
+	return nil
+}
+
+type AnnounceResponse struct {
+	Peers []*Peer `protobuf:"bytes,1,rep,name=peers" json:"peers,omitempty"`
+	// interval_ms is the interval the peer should announce at.
+	IntervalMs int64 `protobuf:"varint,2,opt,name=interval_ms,json=intervalMs" json:"interval_ms,omitempty"`
+}
+
+func (m *AnnounceResponse) Reset()                    { *m = AnnounceResponse{} }
+func (m *AnnounceResponse) String() string            { return proto.CompactTextString(m) }
+func (*AnnounceResponse) ProtoMessage()               {}
+func (*AnnounceResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *AnnounceResponse) GetPeers() []*Peer {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+type ScrapeRequest struct {
+	InfoHashes []string `protobuf:"bytes,1,rep,name=info_hashes,json=infoHashes" json:"info_hashes,omitempty"`
+}
+
+func (m *ScrapeRequest) Reset()                    { *m = ScrapeRequest{} }
+func (m *ScrapeRequest) String() string            { return proto.CompactTextString(m) }
+func (*ScrapeRequest) ProtoMessage()               {}
+func (*ScrapeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+type SwarmStats struct {
+	Seeders   int32 `protobuf:"varint,1,opt,name=seeders" json:"seeders,omitempty"`
+	Leechers  int32 `protobuf:"varint,2,opt,name=leechers" json:"leechers,omitempty"`
+	Completed int32 `protobuf:"varint,3,opt,name=completed" json:"completed,omitempty"`
+}
+
+func (m *SwarmStats) Reset()                    { *m = SwarmStats{} }
+func (m *SwarmStats) String() string            { return proto.CompactTextString(m) }
+func (*SwarmStats) ProtoMessage()               {}
+func (*SwarmStats) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+type ScrapeResponse struct {
+	// stats are in the order of the requested infohashes.
+	Stats []*SwarmStats `protobuf:"bytes,1,rep,name=stats" json:"stats,omitempty"`
+}
+
+func (m *ScrapeResponse) Reset()                    { *m = ScrapeResponse{} }
+func (m *ScrapeResponse) String() string            { return proto.CompactTextString(m) }
+func (*ScrapeResponse) ProtoMessage()               {}
+func (*ScrapeResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *ScrapeResponse) GetStats() []*SwarmStats {
+	if m != nil {
+		return m.Stats
+	}
+	return nil
+}
+
+type GetHostInfoHashesRequest struct {
+	Host string `protobuf:"bytes,1,opt,name=host" json:"host,omitempty"`
+}
+
+func (m *GetHostInfoHashesRequest) Reset()                    { *m = GetHostInfoHashesRequest{} }
+func (m *GetHostInfoHashesRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetHostInfoHashesRequest) ProtoMessage()               {}
+func (*GetHostInfoHashesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+type GetHostInfoHashesResponse struct {
+	InfoHashes []string `protobuf:"bytes,1,rep,name=info_hashes,json=infoHashes" json:"info_hashes,omitempty"`
+}
+
+func (m *GetHostInfoHashesResponse) Reset()                    { *m = GetHostInfoHashesResponse{} }
+func (m *GetHostInfoHashesResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetHostInfoHashesResponse) ProtoMessage()               {}
+func (*GetHostInfoHashesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func init() {
+	proto.RegisterType((*GetMetaInfoRequest)(nil), "tracker.GetMetaInfoRequest")
+	proto.RegisterType((*GetMetaInfoResponse)(nil), "tracker.GetMetaInfoResponse")
+	proto.RegisterType((*Peer)(nil), "tracker.Peer")
+	proto.RegisterType((*Token)(nil), "tracker.Token")
+	proto.RegisterType((*AnnounceRequest)(nil), "tracker.AnnounceRequest")
+	proto.RegisterType((*AnnounceResponse)(nil), "tracker.AnnounceResponse")
+	proto.RegisterType((*ScrapeRequest)(nil), "tracker.ScrapeRequest")
+	proto.RegisterType((*SwarmStats)(nil), "tracker.SwarmStats")
+	proto.RegisterType((*ScrapeResponse)(nil), "tracker.ScrapeResponse")
+	proto.RegisterType((*GetHostInfoHashesRequest)(nil), "tracker.GetHostInfoHashesRequest")
+	proto.RegisterType((*GetHostInfoHashesResponse)(nil), "tracker.GetHostInfoHashesResponse")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Tracker service
+
+type TrackerClient interface {
+	// GetMetaInfo returns the metainfo of a blob, which maps its digest to the
+	// infohash its torrent is announced under.
+	GetMetaInfo(ctx context.Context, in *GetMetaInfoRequest, opts ...grpc.CallOption) (*GetMetaInfoResponse, error)
+	// Announce records a peer of a torrent, and returns the peers it should
+	// download from.
+	Announce(ctx context.Context, in *AnnounceRequest, opts ...grpc.CallOption) (*AnnounceResponse, error)
+	// Scrape returns the swarm stats of torrents.
+	Scrape(ctx context.Context, in *ScrapeRequest, opts ...grpc.CallOption) (*ScrapeResponse, error)
+	// GetHostInfoHashes returns the infohashes a host recently announced.
+	GetHostInfoHashes(ctx context.Context, in *GetHostInfoHashesRequest, opts ...grpc.CallOption) (*GetHostInfoHashesResponse, error)
+}
+
+type trackerClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTrackerClient(cc *grpc.ClientConn) TrackerClient {
+	return &trackerClient{cc}
+}
+
+func (c *trackerClient) GetMetaInfo(ctx context.Context, in *GetMetaInfoRequest, opts ...grpc.CallOption) (*GetMetaInfoResponse, error) {
+	out := new(GetMetaInfoResponse)
+	err := grpc.Invoke(ctx, "/tracker.Tracker/GetMetaInfo", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackerClient) Announce(ctx context.Context, in *AnnounceRequest, opts ...grpc.CallOption) (*AnnounceResponse, error) {
+	out := new(AnnounceResponse)
+	err := grpc.Invoke(ctx, "/tracker.Tracker/Announce", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackerClient) Scrape(ctx context.Context, in *ScrapeRequest, opts ...grpc.CallOption) (*ScrapeResponse, error) {
+	out := new(ScrapeResponse)
+	err := grpc.Invoke(ctx, "/tracker.Tracker/Scrape", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackerClient) GetHostInfoHashes(ctx context.Context, in *GetHostInfoHashesRequest, opts ...grpc.CallOption) (*GetHostInfoHashesResponse, error) {
+	out := new(GetHostInfoHashesResponse)
+	err := grpc.Invoke(ctx, "/tracker.Tracker/GetHostInfoHashes", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Tracker service
+
+type TrackerServer interface {
+	// GetMetaInfo returns the metainfo of a blob, which maps its digest to the
+	// infohash its torrent is announced under.
+	GetMetaInfo(context.Context, *GetMetaInfoRequest) (*GetMetaInfoResponse, error)
+	// Announce records a peer of a torrent, and returns the peers it should
+	// download from.
+	Announce(context.Context, *AnnounceRequest) (*AnnounceResponse, error)
+	// Scrape returns the swarm stats of torrents.
+	Scrape(context.Context, *ScrapeRequest) (*ScrapeResponse, error)
+	// GetHostInfoHashes returns the infohashes a host recently announced.
+	GetHostInfoHashes(context.Context, *GetHostInfoHashesRequest) (*GetHostInfoHashesResponse, error)
+}
+
+func RegisterTrackerServer(s *grpc.Server, srv TrackerServer) {
+	s.RegisterService(&_Tracker_serviceDesc, srv)
+}
+
+func _Tracker_GetMetaInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMetaInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).GetMetaInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tracker.Tracker/GetMetaInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).GetMetaInfo(ctx, req.(*GetMetaInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tracker_Announce_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnnounceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).Announce(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tracker.Tracker/Announce",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).Announce(ctx, req.(*AnnounceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tracker_Scrape_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScrapeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).Scrape(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tracker.Tracker/Scrape",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).Scrape(ctx, req.(*ScrapeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tracker_GetHostInfoHashes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetHostInfoHashesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackerServer).GetHostInfoHashes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tracker.Tracker/GetHostInfoHashes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackerServer).GetHostInfoHashes(ctx, req.(*GetHostInfoHashesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Tracker_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "tracker.Tracker",
+	HandlerType: (*TrackerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetMetaInfo",
+			Handler:    _Tracker_GetMetaInfo_Handler,
+		},
+		{
+			MethodName: "Announce",
+			Handler:    _Tracker_Announce_Handler,
+		},
+		{
+			MethodName: "Scrape",
+			Handler:    _Tracker_Scrape_Handler,
+		},
+		{
+			MethodName: "GetHostInfoHashes",
+			Handler:    _Tracker_GetHostInfoHashes_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/tracker/tracker.proto",
+}
+
+func init() { proto.RegisterFile("proto/tracker/tracker.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 654 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa5, 0x54, 0x4d, 0x6f, 0x13, 0x31,
+	0x10, 0x55, 0x3e, 0x36, 0x1f, 0x13, 0x9a, 0x16, 0x17, 0xb5, 0xdb, 0xa4, 0x02, 0xba, 0x70, 0xa0,
+	0x97, 0x80, 0xc2, 0x09, 0x81, 0x84, 0xb8, 0x40, 0x82, 0x54, 0x84, 0x36, 0x3d, 0x00, 0x97, 0xe0,
+	0xee, 0xba, 0xc9, 0xaa, 0x59, 0x7b, 0x59, 0x3b, 0x54, 0xe2, 0x77, 0xf0, 0x2f, 0xf8, 0x29, 0xfc,
+	0x29, 0x3c, 0xb6, 0x77, 0x93, 0x36, 0x11, 0x1c, 0x38, 0xad, 0xdf, 0x1b, 0x7b, 0xfc, 0xe6, 0xcd,
+	0xac, 0xa1, 0x9f, 0xe5, 0x42, 0x89, 0xa7, 0x2a, 0xa7, 0xd1, 0x15, 0xcb, 0x8b, 0xef, 0xc0, 0xb0,
+	0xa4, 0xe9, 0x60, 0xf0, 0x1e, 0xc8, 0x3b, 0xa6, 0xce, 0x98, 0xa2, 0x63, 0x7e, 0x29, 0x42, 0xf6,
+	0x6d, 0xc9, 0xa4, 0x22, 0xc7, 0xd0, 0xe6, 0x34, 0x65, 0x32, 0xa3, 0x11, 0xf3, 0x2b, 0x0f, 0x2b,
+	0x4f, 0xda, 0xe1, 0x8a, 0x20, 0x07, 0xd0, 0x88, 0x93, 0x99, 0xde, 0xe7, 0x57, 0x4d, 0xc8, 0xa1,
+	0xe0, 0x03, 0xec, 0xdf, 0xc8, 0x25, 0x33, 0xc1, 0x25, 0x23, 0x7d, 0x68, 0x27, 0x1a, 0x4f, 0xe7,
+	0x54, 0xce, 0x5d, 0xb2, 0x16, 0x12, 0x23, 0x8d, 0x49, 0x0f, 0x5a, 0xa9, 0x3e, 0x80, 0xd8, 0x64,
+	0xbb, 0x13, 0x96, 0x38, 0xf8, 0x5d, 0x81, 0xfa, 0x47, 0xc6, 0x72, 0x72, 0x08, 0xcd, 0x4c, 0x7f,
+	0xa7, 0x49, 0xec, 0xce, 0x37, 0x10, 0x8e, 0x63, 0xd2, 0x85, 0x6a, 0x92, 0x39, 0x15, 0x7a, 0x45,
+	0x08, 0xd4, 0x33, 0x91, 0x2b, 0xbf, 0xa6, 0x19, 0x2f, 0x34, 0x6b, 0xbc, 0x21, 0x12, 0x69, 0xb6,
+	0x60, 0x8a, 0xf9, 0x75, 0xcd, 0xb7, 0xc2, 0x12, 0x63, 0x25, 0x22, 0x4f, 0x66, 0x09, 0xf7, 0x3d,
+	0x13, 0x71, 0x08, 0xcf, 0xcc, 0x85, 0x54, 0x58, 0xb2, 0xdf, 0xb0, 0x8a, 0x0b, 0x8c, 0x77, 0xfc,
+	0x10, 0x9c, 0xf9, 0x4d, 0xc3, 0x9b, 0x35, 0x72, 0xe8, 0xa7, 0xdf, 0xb2, 0x1c, 0xae, 0x51, 0x5b,
+	0x1c, 0xf9, 0x6d, 0xab, 0x2d, 0x8e, 0x82, 0xcf, 0xe0, 0x9d, 0x8b, 0x2b, 0xc6, 0xc9, 0x3d, 0xf0,
+	0xb8, 0xe0, 0xa5, 0xb1, 0x16, 0xa0, 0xe5, 0x2a, 0xd1, 0x0e, 0x2b, 0x9a, 0xda, 0x8a, 0x6a, 0xe1,
+	0x8a, 0xc0, 0xa8, 0x4c, 0x66, 0x9c, 0xaa, 0x65, 0xce, 0x4c, 0x75, 0xba, 0x21, 0x25, 0x11, 0xfc,
+	0xac, 0xc2, 0xee, 0x1b, 0xce, 0xc5, 0x52, 0x27, 0xfa, 0xaf, 0x16, 0xde, 0xec, 0x55, 0xed, 0x56,
+	0xaf, 0x4e, 0xb4, 0xbb, 0xda, 0x77, 0xe3, 0x62, 0x67, 0xb8, 0x33, 0x28, 0x46, 0x0a, 0x7b, 0x14,
+	0x9a, 0x10, 0x79, 0x0c, 0x9e, 0xc2, 0x22, 0x8d, 0x9f, 0x9d, 0x61, 0xb7, 0xdc, 0x63, 0x4a, 0x0f,
+	0x6d, 0x10, 0xed, 0x5d, 0x66, 0x0b, 0x41, 0x63, 0x16, 0x1b, 0x7b, 0x6b, 0x61, 0x89, 0xc9, 0x7d,
+	0x80, 0x58, 0x5c, 0x73, 0x17, 0x6d, 0x9a, 0xe8, 0x1a, 0x43, 0x4e, 0x61, 0x8f, 0xc6, 0x71, 0xce,
+	0xa4, 0x9c, 0x5e, 0xd2, 0x34, 0x59, 0x24, 0x4c, 0x6a, 0xdb, 0x6b, 0x5a, 0xe8, 0xae, 0xe3, 0xdf,
+	0x3a, 0x3a, 0xf8, 0x04, 0x7b, 0x2b, 0x57, 0xdc, 0x30, 0x3e, 0x02, 0x0f, 0x85, 0x4a, 0x6d, 0x49,
+	0x6d, 0xb3, 0x08, 0x1b, 0x23, 0x0f, 0xa0, 0x93, 0x70, 0xc5, 0xf2, 0xef, 0x74, 0x31, 0x4d, 0xa5,
+	0xeb, 0x06, 0x14, 0xd4, 0x99, 0x0c, 0x9e, 0xc1, 0xce, 0x24, 0xca, 0x69, 0x56, 0xba, 0x6d, 0x4e,
+	0x38, 0xdf, 0x98, 0x4d, 0xde, 0xc6, 0x13, 0xd6, 0x39, 0xad, 0xe5, 0x2b, 0xc0, 0xe4, 0x9a, 0xe6,
+	0xe9, 0x44, 0x51, 0x25, 0x89, 0x0f, 0x4d, 0xc9, 0x58, 0x6c, 0x75, 0xe0, 0xa8, 0x16, 0x10, 0xad,
+	0x59, 0x30, 0x16, 0xcd, 0x31, 0x54, 0x35, 0xa1, 0x12, 0x63, 0x4b, 0x8b, 0xc9, 0x8d, 0xdd, 0x88,
+	0xaf, 0x88, 0xe0, 0x25, 0x74, 0x0b, 0x4d, 0xae, 0xd6, 0x53, 0xf0, 0x24, 0x5e, 0xe7, 0x6a, 0xdd,
+	0x2f, 0x6b, 0x5d, 0x29, 0x09, 0xed, 0x8e, 0x60, 0x00, 0xbe, 0xfe, 0x75, 0x47, 0x7a, 0xc6, 0xc7,
+	0xa5, 0xe6, 0xa2, 0x36, 0x3d, 0xdc, 0x38, 0xfc, 0x6e, 0x88, 0xcc, 0x3a, 0x78, 0x05, 0x47, 0x5b,
+	0xf6, 0xbb, 0x7b, 0xff, 0x65, 0xc6, 0xf0, 0x57, 0x15, 0x9a, 0xe7, 0x56, 0x0b, 0x19, 0x41, 0x67,
+	0xed, 0xd1, 0x20, 0xfd, 0x52, 0xe4, 0xe6, 0xb3, 0xd4, 0x3b, 0xde, 0x1e, 0x74, 0xd7, 0xbe, 0x86,
+	0x56, 0xd1, 0x6e, 0xe2, 0x97, 0x3b, 0x6f, 0xfd, 0x17, 0xbd, 0xa3, 0x2d, 0x11, 0x97, 0xe0, 0x05,
+	0x34, 0xac, 0x83, 0xe4, 0x60, 0x65, 0xd5, 0x7a, 0x9b, 0x7b, 0x87, 0x1b, 0xbc, 0x3b, 0xfa, 0x05,
+	0xee, 0x6e, 0xf8, 0x41, 0x4e, 0xd6, 0xe5, 0x6e, 0xf5, 0xb6, 0x17, 0xfc, 0x6d, 0x8b, 0xcd, 0x7d,
+	0xd1, 0x30, 0x4f, 0xf6, 0xf3, 0x3f, 0x22, 0x46, 0x5e, 0xd6, 0xd1, 0x05, 0x00, 0x00,
+}
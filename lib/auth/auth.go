@@ -0,0 +1,174 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims carried by ctx, or nil if the request was not
+// authenticated.
+func FromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*Claims)
+	return claims
+}
+
+// Authenticator authorizes requests by the scopes granted to the bearer tokens
+// they carry.
+type Authenticator struct {
+	validator Validator
+	optional  stringset.Set
+	stats     tally.Scope
+}
+
+// New creates a new Authenticator which validates JSON Web Tokens. Returns an
+// error if config is invalid.
+func New(config Config, stats tally.Scope, clk clock.Clock) (*Authenticator, error) {
+	v, err := NewJWTValidator(config, clk)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithValidator(config, v, stats), nil
+}
+
+// NewWithValidator creates a new Authenticator which validates tokens with v
+// instead of the keys of config.
+func NewWithValidator(config Config, v Validator, stats tally.Scope) *Authenticator {
+	return &Authenticator{
+		validator: v,
+		optional:  stringset.FromSlice(config.Optional),
+		stats: stats.Tagged(map[string]string{
+			"module": "auth",
+		}),
+	}
+}
+
+// BearerHeader returns the headers which present token, or nil if token is
+// empty.
+func BearerHeader(token string) map[string]string {
+	if token == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+// bearerToken returns the token of the Authorization header h, or "" if h is
+// empty.
+func bearerToken(h string) (string, error) {
+	if h == "" {
+		return "", nil
+	}
+	parts := strings.SplitN(h, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+		return "", ErrMalformed
+	}
+	return strings.TrimSpace(parts[1]), nil
+}
+
+func challenge(params string) string {
+	if params == "" {
+		return `Bearer realm="kraken"`
+	}
+	return `Bearer realm="kraken", ` + params
+}
+
+// Authorize returns an error unless r carries a valid token granting scope.
+// Requests without a token are authorized if scope is optional. On success,
+// returns r with the claims of its token attached, if any.
+func (a *Authenticator) Authorize(r *http.Request, scope string) (*http.Request, error) {
+	claims, err := a.AuthorizeHeader(r.Header.Get("Authorization"), scope)
+	if err != nil {
+		return nil, err
+	}
+	if claims == nil {
+		return r, nil
+	}
+	return r.WithContext(NewContext(r.Context(), claims)), nil
+}
+
+// AuthorizeHeader returns an error unless the Authorization header h carries a
+// valid token granting scope, such that requests of transports other than
+// http can be authorized. Returns the claims of the token, or nil if h is empty
+// and scope is optional.
+func (a *Authenticator) AuthorizeHeader(h, scope string) (*Claims, error) {
+	stats := a.stats.Tagged(map[string]string{"scope": scope})
+
+	token, err := bearerToken(h)
+	if err == nil && token == "" {
+		if a.optional.Has(scope) {
+			stats.Counter("anonymous").Inc(1)
+			return nil, nil
+		}
+		stats.Counter("unauthenticated").Inc(1)
+		return nil, handler.Errorf("bearer token required").
+			Status(http.StatusUnauthorized).
+			Header("WWW-Authenticate", challenge(""))
+	}
+	var claims *Claims
+	if err == nil {
+		claims, err = a.validator.Validate(token)
+	}
+	if err != nil {
+		stats.Counter("invalid_token").Inc(1)
+		return nil, handler.Errorf("invalid token: %s", err).
+			Status(http.StatusUnauthorized).
+			Header("WWW-Authenticate", challenge(`error="invalid_token"`))
+	}
+	if !claims.HasScope(scope) {
+		stats.Counter("forbidden").Inc(1)
+		return nil, handler.Errorf("token of %q lacks scope %q", claims.Subject, scope).
+			Status(http.StatusForbidden).
+			Header("WWW-Authenticate", challenge(
+				fmt.Sprintf(`error="insufficient_scope", scope=%q`, scope)))
+	}
+	stats.Counter("authorized").Inc(1)
+	return claims, nil
+}
+
+// Wrap returns h guarded by scope.
+func (a *Authenticator) Wrap(scope string, h handler.ErrHandler) handler.ErrHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		r, err := a.Authorize(r, scope)
+		if err != nil {
+			return err
+		}
+		return h(w, r)
+	}
+}
+
+// Require returns middleware which guards handlers by scope.
+func (a *Authenticator) Require(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return handler.Wrap(a.Wrap(scope, func(w http.ResponseWriter, r *http.Request) error {
+			next.ServeHTTP(w, r)
+			return nil
+		}))
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+type fakeValidator map[string]*Claims
+
+func (v fakeValidator) Validate(token string) (*Claims, error) {
+	claims, ok := v[token]
+	if !ok {
+		return nil, errors.New("unknown token")
+	}
+	return claims, nil
+}
+
+func startAuthServer(optional ...string) (addr string, stop func()) {
+	a := NewWithValidator(Config{Optional: optional}, fakeValidator{
+		"announcer": {Subject: "agent", Scopes: []string{"announce"}},
+		"admin":     {Subject: "operator", Scopes: []string{"admin"}},
+	}, tally.NoopScope)
+
+	mux := http.NewServeMux()
+	ok := func(w http.ResponseWriter, r *http.Request) error {
+		if claims := FromContext(r.Context()); claims != nil {
+			fmt.Fprint(w, claims.Subject)
+		}
+		return nil
+	}
+	mux.Handle("/announce", handler.Wrap(a.Wrap("announce", ok)))
+	mux.Handle("/admin", a.Require("admin")(handler.Wrap(ok)))
+
+	return testutil.StartServer(mux)
+}
+
+func sendWithToken(addr, path, token string) (*http.Response, error) {
+	var headers map[string]string
+	if token != "" {
+		headers = map[string]string{"Authorization": "Bearer " + token}
+	}
+	return httputil.Get(
+		fmt.Sprintf("http://%s%s", addr, path),
+		httputil.SendHeaders(headers))
+}
+
+func TestAuthenticatorScopes(t *testing.T) {
+	addr, stop := startAuthServer()
+	defer stop()
+
+	tests := []struct {
+		path     string
+		token    string
+		expected int
+	}{
+		{"/announce", "announcer", http.StatusOK},
+		{"/announce", "admin", http.StatusForbidden},
+		{"/announce", "", http.StatusUnauthorized},
+		{"/announce", "forged", http.StatusUnauthorized},
+		{"/admin", "admin", http.StatusOK},
+		{"/admin", "announcer", http.StatusForbidden},
+		{"/admin", "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s %s", test.path, test.token), func(t *testing.T) {
+			resp, err := sendWithToken(addr, test.path, test.token)
+			if test.expected == http.StatusOK {
+				require.NoError(t, err)
+				resp.Body.Close()
+				return
+			}
+			require.True(t, httputil.IsStatus(err, test.expected), "%v", err)
+		})
+	}
+}
+
+func TestAuthenticatorChallenge(t *testing.T) {
+	require := require.New(t)
+
+	addr, stop := startAuthServer()
+	defer stop()
+
+	_, err := sendWithToken(addr, "/admin", "announcer")
+	require.True(httputil.IsForbidden(err))
+	require.Equal(
+		`Bearer realm="kraken", error="insufficient_scope", scope="admin"`,
+		err.(httputil.StatusError).Header.Get("WWW-Authenticate"))
+}
+
+func TestAuthenticatorOptionalScope(t *testing.T) {
+	require := require.New(t)
+
+	addr, stop := startAuthServer("announce")
+	defer stop()
+
+	resp, err := sendWithToken(addr, "/announce", "")
+	require.NoError(err)
+	resp.Body.Close()
+
+	// Tokens are still validated if present.
+	_, err = sendWithToken(addr, "/announce", "forged")
+	require.True(httputil.IsStatus(err, http.StatusUnauthorized))
+
+	_, err = sendWithToken(addr, "/admin", "")
+	require.True(httputil.IsStatus(err, http.StatusUnauthorized))
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package auth
+
+import "time"
+
+// Signing algorithms.
+const (
+	// HS256 is HMAC with SHA-256, verified with a shared secret.
+	HS256 = "HS256"
+
+	// RS256 is RSASSA-PKCS1-v1_5 with SHA-256, verified with an RSA public key.
+	RS256 = "RS256"
+)
+
+// Config defines bearer token authentication.
+//
+// NOTE: Requests are not authenticated unless Enabled is true.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Keys are the keys tokens may be signed with. Tokens which name a key id
+	// are only verified with the key of that id. Required if enabled.
+	Keys []KeyConfig `yaml:"keys"`
+
+	// Issuer, if set, must match the "iss" claim of tokens.
+	Issuer string `yaml:"issuer"`
+
+	// Audience, if set, must be one of the "aud" claims of tokens.
+	Audience string `yaml:"audience"`
+
+	// MaxClockSkew is tolerated when checking the "exp" and "nbf" claims of
+	// tokens.
+	MaxClockSkew time.Duration `yaml:"max_clock_skew"`
+
+	// Optional lists scopes whose endpoints accept requests without a token,
+	// e.g. while clients are rolled out with tokens. Tokens which are present
+	// are still validated.
+	Optional []string `yaml:"optional"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.MaxClockSkew == 0 {
+		c.MaxClockSkew = 30 * time.Second
+	}
+	return c
+}
+
+// KeyConfig defines a token signing key.
+type KeyConfig struct {
+	// ID is matched against the "kid" header of tokens.
+	ID string `yaml:"id"`
+
+	// Algorithm is the signing algorithm of the key, either HS256 or RS256.
+	// Tokens signed with any other algorithm are rejected.
+	Algorithm string `yaml:"algorithm"`
+
+	// Secret is the HMAC key of HS256 keys. Should be supplied via secrets
+	// file.
+	Secret string `yaml:"secret"`
+
+	// PublicKey is the PEM encoded public key of RS256 keys.
+	PublicKey string `yaml:"public_key"`
+}
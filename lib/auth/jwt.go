@@ -0,0 +1,271 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// Token errors.
+var (
+	ErrMalformed        = errors.New("token malformed")
+	ErrUnknownKey       = errors.New("token signed with unknown key")
+	ErrInvalidSignature = errors.New("token signature invalid")
+	ErrExpired          = errors.New("token expired")
+	ErrNotYetValid      = errors.New("token not yet valid")
+	ErrInvalidIssuer    = errors.New("token issuer invalid")
+	ErrInvalidAudience  = errors.New("token audience invalid")
+)
+
+// Claims are the validated claims of a token.
+type Claims struct {
+	Subject string
+	Scopes  []string
+}
+
+// HasScope returns true if c grants scope.
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Validator validates bearer tokens.
+type Validator interface {
+	Validate(token string) (*Claims, error)
+}
+
+type verifier interface {
+	verify(signed, sig []byte) bool
+}
+
+type hmacVerifier []byte
+
+func (v hmacVerifier) verify(signed, sig []byte) bool {
+	mac := hmac.New(sha256.New, v)
+	mac.Write(signed)
+	return hmac.Equal(mac.Sum(nil), sig)
+}
+
+type rsaVerifier struct {
+	key *rsa.PublicKey
+}
+
+func (v rsaVerifier) verify(signed, sig []byte) bool {
+	h := sha256.Sum256(signed)
+	return rsa.VerifyPKCS1v15(v.key, crypto.SHA256, h[:], sig) == nil
+}
+
+func parseRSAPublicKey(s string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("no pem block found")
+	}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("not an rsa public key")
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported pem block %q", block.Type)
+	}
+}
+
+type key struct {
+	id        string
+	algorithm string
+	verifier  verifier
+}
+
+// JWTValidator validates JSON Web Tokens signed with the configured keys.
+// Scopes are read from either the space-separated "scope" claim or the "scp"
+// array claim.
+type JWTValidator struct {
+	config Config
+	clk    clock.Clock
+	keys   []key
+}
+
+// NewJWTValidator creates a new JWTValidator. Returns an error if any key of
+// config is invalid.
+func NewJWTValidator(config Config, clk clock.Clock) (*JWTValidator, error) {
+	config = config.applyDefaults()
+	if len(config.Keys) == 0 {
+		return nil, errors.New("keys required")
+	}
+	v := &JWTValidator{config: config, clk: clk}
+	for i, kc := range config.Keys {
+		k := key{id: kc.ID, algorithm: kc.Algorithm}
+		switch kc.Algorithm {
+		case HS256:
+			if kc.Secret == "" {
+				return nil, fmt.Errorf("key %d: secret required", i)
+			}
+			k.verifier = hmacVerifier(kc.Secret)
+		case RS256:
+			pub, err := parseRSAPublicKey(kc.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("key %d: public key: %s", i, err)
+			}
+			k.verifier = rsaVerifier{pub}
+		default:
+			return nil, fmt.Errorf("key %d: unsupported algorithm %q", i, kc.Algorithm)
+		}
+		v.keys = append(v.keys, k)
+	}
+	return v, nil
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// audience is either a single string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		return json.Unmarshal(b, (*[]string)(a))
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*a = audience{s}
+	return nil
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Scope     string   `json:"scope"`
+	Scp       []string `json:"scp"`
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Validate verifies the signature and registered claims of token, and returns
+// its claims. Tokens must expire.
+func (v *JWTValidator) Validate(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if err := v.verify(header, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	now := v.clk.Now()
+	if claims.ExpiresAt == nil {
+		return nil, ErrMalformed
+	}
+	if now.After(unixTime(*claims.ExpiresAt).Add(v.config.MaxClockSkew)) {
+		return nil, ErrExpired
+	}
+	if claims.NotBefore != nil && now.Before(unixTime(*claims.NotBefore).Add(-v.config.MaxClockSkew)) {
+		return nil, ErrNotYetValid
+	}
+	if v.config.Issuer != "" && claims.Issuer != v.config.Issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if v.config.Audience != "" && !contains(claims.Audience, v.config.Audience) {
+		return nil, ErrInvalidAudience
+	}
+	scopes := strings.Fields(claims.Scope)
+	scopes = append(scopes, claims.Scp...)
+	return &Claims{Subject: claims.Subject, Scopes: scopes}, nil
+}
+
+// verify checks sig against the keys matching header. The algorithm of the
+// header must match the algorithm of the key, such that tokens cannot select a
+// weaker algorithm than the key was configured with.
+func (v *JWTValidator) verify(header jwtHeader, signed, sig []byte) error {
+	var found bool
+	for _, k := range v.keys {
+		if header.KeyID != "" && k.id != header.KeyID {
+			continue
+		}
+		if k.algorithm != header.Algorithm {
+			continue
+		}
+		found = true
+		if k.verifier.verify(signed, sig) {
+			return nil
+		}
+	}
+	if !found {
+		return ErrUnknownKey
+	}
+	return ErrInvalidSignature
+}
+
+func unixTime(secs float64) time.Time {
+	return time.Unix(0, int64(secs*float64(time.Second)))
+}
+
+func contains(xs []string, x string) bool {
+	for _, y := range xs {
+		if y == x {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signHS256(t *testing.T, secret, kid string, claims map[string]interface{}) string {
+	header := map[string]string{"alg": HS256, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": RS256}) + "." + encodeSegment(t, claims)
+	h := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func hs256Config(secret string) Config {
+	return Config{
+		Enabled: true,
+		Keys:    []KeyConfig{{Algorithm: HS256, Secret: secret}},
+	}
+}
+
+func TestJWTValidatorHS256(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Unix(1000, 0))
+
+	v, err := NewJWTValidator(hs256Config("secret"), clk)
+	require.NoError(err)
+
+	claims, err := v.Validate(signHS256(t, "secret", "", map[string]interface{}{
+		"sub":   "build-system",
+		"exp":   2000,
+		"scope": "announce admin",
+	}))
+	require.NoError(err)
+	require.Equal("build-system", claims.Subject)
+	require.True(claims.HasScope("announce"))
+	require.True(claims.HasScope("admin"))
+	require.False(claims.HasScope("metainfo:write"))
+}
+
+func TestJWTValidatorScpClaim(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Unix(1000, 0))
+
+	v, err := NewJWTValidator(hs256Config("secret"), clk)
+	require.NoError(err)
+
+	claims, err := v.Validate(signHS256(t, "secret", "", map[string]interface{}{
+		"exp": 2000,
+		"scp": []string{"metainfo:write"},
+	}))
+	require.NoError(err)
+	require.True(claims.HasScope("metainfo:write"))
+}
+
+func TestJWTValidatorRS256(t *testing.T) {
+	require := require.New(t)
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(err)
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(err)
+	pub := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	clk := clock.NewMock()
+	clk.Set(time.Unix(1000, 0))
+
+	v, err := NewJWTValidator(Config{
+		Keys: []KeyConfig{{Algorithm: RS256, PublicKey: pub}},
+	}, clk)
+	require.NoError(err)
+
+	claims, err := v.Validate(signRS256(t, priv, map[string]interface{}{
+		"exp":   2000,
+		"scope": "admin",
+	}))
+	require.NoError(err)
+	require.True(claims.HasScope("admin"))
+
+	// An HS256 token signed with the public key must not be accepted.
+	_, err = v.Validate(signHS256(t, pub, "", map[string]interface{}{
+		"exp":   2000,
+		"scope": "admin",
+	}))
+	require.Equal(ErrUnknownKey, err)
+}
+
+func TestJWTValidatorKeyID(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Unix(1000, 0))
+
+	v, err := NewJWTValidator(Config{
+		Keys: []KeyConfig{
+			{ID: "old", Algorithm: HS256, Secret: "s1"},
+			{ID: "new", Algorithm: HS256, Secret: "s2"},
+		},
+	}, clk)
+	require.NoError(err)
+
+	claims := map[string]interface{}{"exp": 2000}
+
+	_, err = v.Validate(signHS256(t, "s1", "old", claims))
+	require.NoError(err)
+
+	_, err = v.Validate(signHS256(t, "s2", "new", claims))
+	require.NoError(err)
+
+	// Tokens without key ids are verified with any key.
+	_, err = v.Validate(signHS256(t, "s2", "", claims))
+	require.NoError(err)
+
+	_, err = v.Validate(signHS256(t, "s1", "new", claims))
+	require.Equal(ErrInvalidSignature, err)
+
+	_, err = v.Validate(signHS256(t, "s1", "unknown", claims))
+	require.Equal(ErrUnknownKey, err)
+}
+
+func TestJWTValidatorErrors(t *testing.T) {
+	clk := clock.NewMock()
+	clk.Set(time.Unix(1000, 0))
+
+	config := hs256Config("secret")
+	config.Issuer = "kraken-ci"
+	config.Audience = "tracker"
+	config.MaxClockSkew = 10 * time.Second
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"exp": 2000,
+			"iss": "kraken-ci",
+			"aud": []string{"origin", "tracker"},
+		}
+	}
+
+	tests := []struct {
+		desc     string
+		token    func() string
+		expected error
+	}{
+		{"valid", func() string {
+			return signHS256(t, "secret", "", valid())
+		}, nil},
+		{"malformed", func() string {
+			return "foo.bar"
+		}, ErrMalformed},
+		{"wrong secret", func() string {
+			return signHS256(t, "other", "", valid())
+		}, ErrInvalidSignature},
+		{"no expiry", func() string {
+			c := valid()
+			delete(c, "exp")
+			return signHS256(t, "secret", "", c)
+		}, ErrMalformed},
+		{"expired", func() string {
+			c := valid()
+			c["exp"] = 989
+			return signHS256(t, "secret", "", c)
+		}, ErrExpired},
+		{"expired within skew", func() string {
+			c := valid()
+			c["exp"] = 991
+			return signHS256(t, "secret", "", c)
+		}, nil},
+		{"not yet valid", func() string {
+			c := valid()
+			c["nbf"] = 1011
+			return signHS256(t, "secret", "", c)
+		}, ErrNotYetValid},
+		{"wrong issuer", func() string {
+			c := valid()
+			c["iss"] = "someone"
+			return signHS256(t, "secret", "", c)
+		}, ErrInvalidIssuer},
+		{"wrong audience", func() string {
+			c := valid()
+			c["aud"] = "origin"
+			return signHS256(t, "secret", "", c)
+		}, ErrInvalidAudience},
+		{"single audience", func() string {
+			c := valid()
+			c["aud"] = "tracker"
+			return signHS256(t, "secret", "", c)
+		}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			v, err := NewJWTValidator(config, clk)
+			require.NoError(t, err)
+
+			_, err = v.Validate(test.token())
+			require.Equal(t, test.expected, err)
+		})
+	}
+}
+
+func TestNewJWTValidatorInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config Config
+	}{
+		{"no keys", Config{}},
+		{"no secret", Config{Keys: []KeyConfig{{Algorithm: HS256}}}},
+		{"bad public key", Config{Keys: []KeyConfig{{Algorithm: RS256, PublicKey: "foo"}}}},
+		{"unsupported algorithm", Config{Keys: []KeyConfig{{Algorithm: "none"}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewJWTValidator(test.config, clock.NewMock())
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"io"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/errutil"
+)
+
+// AnnotatedClient wraps a Client such that all errors carry the operation,
+// name and backend which failed. Errors such as backenderrors.ErrBlobNotFound
+// must be checked with errors.Is.
+type AnnotatedClient struct {
+	Client
+	backend string
+}
+
+// annotate wraps c such that its errors name backend.
+func annotate(c Client, backend string) *AnnotatedClient {
+	return &AnnotatedClient{c, backend}
+}
+
+// Stat implements Client.
+func (c *AnnotatedClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	info, err := c.Client.Stat(namespace, name)
+	if err != nil {
+		return nil, errutil.WrapBackend(err, c.backend, "stat", name)
+	}
+	return info, nil
+}
+
+// Upload implements Client.
+func (c *AnnotatedClient) Upload(namespace, name string, src io.Reader) error {
+	return errutil.WrapBackend(c.Client.Upload(namespace, name, src), c.backend, "upload", name)
+}
+
+// Download implements Client.
+func (c *AnnotatedClient) Download(namespace, name string, dst io.Writer) error {
+	return errutil.WrapBackend(c.Client.Download(namespace, name, dst), c.backend, "download", name)
+}
+
+// Delete implements Deleter, if the wrapped Client does.
+func (c *AnnotatedClient) Delete(namespace, name string) error {
+	return errutil.WrapBackend(Delete(c.Client, namespace, name), c.backend, "delete", name)
+}
+
+// List implements Client.
+func (c *AnnotatedClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	result, err := c.Client.List(prefix, opts...)
+	if err != nil {
+		return nil, errutil.WrapBackend(err, c.backend, "list", prefix)
+	}
+	return result, nil
+}
@@ -17,3 +17,7 @@ import "errors"
 
 // ErrBlobNotFound is returned when a blob is not found in a storage backend.
 var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrDeleteNotSupported is returned when deleting from a storage backend which
+// does not support deletion.
+var ErrDeleteNotSupported = errors.New("backend does not support deletion")
@@ -0,0 +1,112 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backendtest provides a driver suite which every backend.Client
+// implementation is expected to pass.
+package backendtest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the driver suite against client. Names are written under a random
+// prefix, such that the suite may run against a shared backend.
+func Run(t *testing.T, client backend.Client) {
+	prefix := string(randutil.Text(8))
+
+	t.Run("MissingBlob", func(t *testing.T) {
+		testMissingBlob(t, client, prefix)
+	})
+	t.Run("UploadStatDownload", func(t *testing.T) {
+		testUploadStatDownload(t, client, prefix)
+	})
+	t.Run("UploadOverwrites", func(t *testing.T) {
+		testUploadOverwrites(t, client, prefix)
+	})
+	t.Run("List", func(t *testing.T) {
+		testList(t, client, prefix)
+	})
+}
+
+func testMissingBlob(t *testing.T, client backend.Client, prefix string) {
+	require := require.New(t)
+
+	name := fmt.Sprintf("%s/missing/%s", prefix, core.DigestFixture().Hex())
+
+	_, err := client.Stat("", name)
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+
+	var b bytes.Buffer
+	require.Equal(backenderrors.ErrBlobNotFound, client.Download("", name, &b))
+}
+
+func testUploadStatDownload(t *testing.T, client backend.Client, prefix string) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(256, 8)
+	name := fmt.Sprintf("%s/blobs/%s", prefix, blob.Digest.Hex())
+
+	require.NoError(client.Upload("", name, bytes.NewReader(blob.Content)))
+
+	info, err := client.Stat("", name)
+	require.NoError(err)
+	require.Equal(int64(len(blob.Content)), info.Size)
+
+	var b bytes.Buffer
+	require.NoError(client.Download("", name, &b))
+	require.Equal(blob.Content, b.Bytes())
+}
+
+func testUploadOverwrites(t *testing.T, client backend.Client, prefix string) {
+	require := require.New(t)
+
+	name := fmt.Sprintf("%s/overwrite/%s", prefix, core.DigestFixture().Hex())
+	content := randutil.Text(64)
+
+	require.NoError(client.Upload("", name, bytes.NewReader(randutil.Text(32))))
+	require.NoError(client.Upload("", name, bytes.NewReader(content)))
+
+	var b bytes.Buffer
+	require.NoError(client.Download("", name, &b))
+	require.Equal(content, b.Bytes())
+}
+
+func testList(t *testing.T, client backend.Client, prefix string) {
+	require := require.New(t)
+
+	dir := fmt.Sprintf("%s/list", prefix)
+
+	var names []string
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("%s/%s", dir, core.DigestFixture().Hex())
+		require.NoError(client.Upload("", name, bytes.NewReader(randutil.Text(16))))
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result, err := client.List(dir)
+	require.NoError(err)
+	sort.Strings(result.Names)
+	require.Equal(names, result.Names)
+}
@@ -18,6 +18,7 @@ import (
 	"io"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
 )
 
 var _factories = make(map[string]ClientFactory)
@@ -64,3 +65,20 @@ type Client interface {
 	// List lists entries whose names start with prefix.
 	List(prefix string, opts ...ListOption) (*ListResult, error)
 }
+
+// Deleter is implemented by Clients whose storage backends support deletion.
+type Deleter interface {
+	// Delete deletes name. All implementations should return
+	// backenderrors.ErrBlobNotFound when the blob was not found.
+	Delete(namespace, name string) error
+}
+
+// Delete deletes name using c. Returns backenderrors.ErrDeleteNotSupported if
+// c does not implement Deleter.
+func Delete(c Client, namespace, name string) error {
+	d, ok := c.(Deleter)
+	if !ok {
+		return backenderrors.ErrDeleteNotSupported
+	}
+	return d.Delete(namespace, name)
+}
@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//	   http://www.apache.org/licenses/LICENSE-2.0
+//     http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -18,15 +18,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"path"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
 
 	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"gopkg.in/yaml.v2"
@@ -114,8 +118,11 @@ func NewClient(
 	}
 
 	ctx := context.Background()
-	sClient, err := storage.NewClient(ctx,
-		option.WithCredentialsJSON([]byte(auth.GCS.AccessBlob)))
+	clientOpt, err := clientOption(ctx, config, []byte(auth.GCS.AccessBlob))
+	if err != nil {
+		return nil, err
+	}
+	sClient, err := storage.NewClient(ctx, clientOpt)
 	if err != nil {
 		return nil, fmt.Errorf("invalid gcs credentials: %s", err)
 	}
@@ -127,6 +134,31 @@ func NewClient(
 	return client, nil
 }
 
+// clientOption returns the option which authenticates the storage client. If
+// a proxy or TLS is configured, both token and storage requests use them.
+func clientOption(
+	ctx context.Context, config Config, blob []byte) (option.ClientOption, error) {
+
+	proxy, err := config.Proxy.Build()
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %s", err)
+	}
+	tls, err := config.TLS.Build()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %s", err)
+	}
+	if proxy == nil && tls == nil {
+		return option.WithCredentialsJSON(blob), nil
+	}
+	ctx = context.WithValue(
+		ctx, oauth2.HTTPClient, &http.Client{Transport: httputil.NewTransport(tls, proxy)})
+	creds, err := google.CredentialsFromJSON(ctx, blob, storage.ScopeFullControl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gcs credentials: %s", err)
+	}
+	return option.WithHTTPClient(oauth2.NewClient(ctx, creds.TokenSource)), nil
+}
+
 // Stat returns blob info for name.
 func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
 	path, err := c.pather.BlobPath(name)
@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//	   http://www.apache.org/licenses/LICENSE-2.0
+//     http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -17,6 +17,7 @@ import (
 	"github.com/c2h5oh/datasize"
 
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/httputil"
 )
 
 // Config defines gcs connection specific
@@ -38,6 +39,14 @@ type Config struct {
 
 	// NamePath identifies which namepath.Pather to use.
 	NamePath string `yaml:"name_path"`
+
+	// Proxy routes requests to GCS through an egress proxy.
+	Proxy httputil.ProxyConfig `yaml:"proxy"`
+
+	// TLS verifies GCS endpoints signed by private CAs, e.g. of TLS inspecting
+	// egress gateways, and presents client certificates to endpoints which
+	// require them.
+	TLS httputil.ClientTLSConfig `yaml:"tls"`
 }
 
 // UserAuthConfig defines authentication configuration overlayed by Langley.
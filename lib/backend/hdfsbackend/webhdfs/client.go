@@ -15,6 +15,7 @@ package webhdfs
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -57,6 +58,8 @@ type client struct {
 	config    Config
 	namenodes []string
 	username  string
+	proxy     *httputil.Proxy
+	tls       *tls.Config // Nil unless TLS is configured.
 }
 
 // NewClient creates a new Client.
@@ -65,7 +68,15 @@ func NewClient(config Config, namenodes []string, username string) (Client, erro
 	if len(namenodes) == 0 {
 		return nil, errors.New("namenodes required")
 	}
-	return &client{config, namenodes, username}, nil
+	proxy, err := config.Proxy.Build()
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %s", err)
+	}
+	tls, err := config.TLS.Build()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %s", err)
+	}
+	return &client{config, namenodes, username, proxy, tls}, nil
 }
 
 // nameNodeBackOff returns the backoff used on all http requests to namenodes.
@@ -139,6 +150,8 @@ func (c *client) Create(path string, src io.Reader) error {
 	for _, nn := range c.namenodes {
 		nameresp, nnErr = httputil.Put(
 			getURL(nn, path, v),
+			httputil.SendProxy(c.proxy),
+			httputil.SendTLSNoFallback(c.tls),
 			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())),
 			httputil.SendRedirect(func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse
@@ -160,6 +173,8 @@ func (c *client) Create(path string, src io.Reader) error {
 
 		dataresp, nnErr = httputil.Put(
 			loc[0],
+			httputil.SendProxy(c.proxy),
+			httputil.SendTLSNoFallback(c.tls),
 			httputil.SendBody(readSeeker),
 			httputil.SendAcceptedCodes(http.StatusCreated))
 		if nnErr != nil {
@@ -189,6 +204,8 @@ func (c *client) Rename(from, to string) error {
 	for _, nn := range c.namenodes {
 		resp, nnErr = httputil.Put(
 			getURL(nn, from, v),
+			httputil.SendProxy(c.proxy),
+			httputil.SendTLSNoFallback(c.tls),
 			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())))
 		if nnErr != nil {
 			if retryable(nnErr) {
@@ -212,6 +229,8 @@ func (c *client) Mkdirs(path string) error {
 	for _, nn := range c.namenodes {
 		resp, nnErr = httputil.Put(
 			getURL(nn, path, v),
+			httputil.SendProxy(c.proxy),
+			httputil.SendTLSNoFallback(c.tls),
 			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())))
 		if nnErr != nil {
 			if retryable(nnErr) {
@@ -239,6 +258,8 @@ func (c *client) Open(path string, dst io.Writer) error {
 		// to a valid datanode.
 		resp, nnErr = httputil.Get(
 			getURL(nn, path, v),
+			httputil.SendProxy(c.proxy),
+			httputil.SendTLSNoFallback(c.tls),
 			httputil.SendRetry(
 				httputil.RetryBackoff(c.nameNodeBackOff()),
 				httputil.RetryCodes(http.StatusBadRequest)))
@@ -272,6 +293,8 @@ func (c *client) GetFileStatus(path string) (FileStatus, error) {
 	for _, nn := range c.namenodes {
 		resp, nnErr = httputil.Get(
 			getURL(nn, path, v),
+			httputil.SendProxy(c.proxy),
+			httputil.SendTLSNoFallback(c.tls),
 			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())))
 		if nnErr != nil {
 			if retryable(nnErr) {
@@ -301,6 +324,8 @@ func (c *client) ListFileStatus(path string) ([]FileStatus, error) {
 	for _, nn := range c.namenodes {
 		resp, nnErr = httputil.Get(
 			getURL(nn, path, v),
+			httputil.SendProxy(c.proxy),
+			httputil.SendTLSNoFallback(c.tls),
 			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())))
 		if nnErr != nil {
 			if retryable(nnErr) {
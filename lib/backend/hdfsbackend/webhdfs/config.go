@@ -13,7 +13,11 @@
 // limitations under the License.
 package webhdfs
 
-import "github.com/c2h5oh/datasize"
+import (
+	"github.com/c2h5oh/datasize"
+
+	"github.com/uber/kraken/utils/httputil"
+)
 
 // Config defines Client configuration.
 type Config struct {
@@ -23,6 +27,14 @@ type Config struct {
 	// BufferGuard protects upload from draining the src reader into an oversized
 	// buffer when io.Seeker is not implemented.
 	BufferGuard datasize.ByteSize `yaml:"buffer_guard"`
+
+	// Proxy routes requests to name nodes and data nodes through an egress
+	// proxy.
+	Proxy httputil.ProxyConfig `yaml:"proxy"`
+
+	// TLS connects to name nodes and data nodes over https, e.g. with client
+	// certificates.
+	TLS httputil.ClientTLSConfig `yaml:"tls"`
 }
 
 func (c *Config) applyDefaults() {
@@ -15,6 +15,7 @@ package httpbackend
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -59,11 +60,15 @@ type Config struct {
 	DownloadURL     string                            `yaml:"download_url"` // http download get url
 	DownloadTimeout time.Duration                     `yaml:"download_timeout"`
 	DownloadBackOff httputil.ExponentialBackOffConfig `yaml:"download_backoff"`
+	Proxy           httputil.ProxyConfig              `yaml:"proxy"`
+	TLS             httputil.ClientTLSConfig          `yaml:"tls"`
 }
 
 // Client implements downloading/uploading object from/to S3
 type Client struct {
 	config Config
+	proxy  *httputil.Proxy
+	tls    *tls.Config // Nil unless TLS is configured.
 }
 
 func (c Config) applyDefaults() Config {
@@ -75,7 +80,15 @@ func (c Config) applyDefaults() Config {
 
 // NewClient creates a new http Client.
 func NewClient(config Config) (*Client, error) {
-	return &Client{config: config.applyDefaults()}, nil
+	proxy, err := config.Proxy.Build()
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %s", err)
+	}
+	tls, err := config.TLS.Build()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %s", err)
+	}
+	return &Client{config: config.applyDefaults(), proxy: proxy, tls: tls}, nil
 }
 
 // Stat always succeeds.
@@ -95,6 +108,8 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	resp, err := httputil.Get(
 		b.String(),
 		httputil.SendTimeout(c.config.DownloadTimeout),
+		httputil.SendProxy(c.proxy),
+		httputil.SendTLSNoFallback(c.tls),
 		httputil.SendRetry(httputil.RetryBackoff(c.config.DownloadBackOff.Build())))
 	if err != nil {
 		if httputil.IsNotFound(err) {
@@ -70,6 +70,7 @@ func NewManager(configs []Config, auth AuthConfig) (*Manager, error) {
 		if err != nil {
 			return nil, fmt.Errorf("create backend client: %s", err)
 		}
+		c = annotate(c, name)
 
 		if config.Bandwidth.Enable {
 			l, err := bandwidth.NewLimiter(config.Bandwidth)
@@ -14,14 +14,19 @@
 package backend_test
 
 import (
+	"bytes"
+	"errors"
 	"testing"
 
 	. "github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/backend/namepath"
 	"github.com/uber/kraken/lib/backend/testfs"
 	"github.com/uber/kraken/mocks/lib/backend"
 	"github.com/uber/kraken/utils/bandwidth"
+	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/stringset"
+	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -117,7 +122,8 @@ func TestManagerNamespaceOrdering(t *testing.T) {
 	} {
 		c, err := m.GetClient(ns)
 		require.NoError(err)
-		require.Equal(expected, c.(*testfs.Client).Addr(), "Namespace: %s", ns)
+		require.Equal(
+			expected, c.(*AnnotatedClient).Client.(*testfs.Client).Addr(), "Namespace: %s", ns)
 	}
 }
 
@@ -154,3 +160,34 @@ func TestManagerBandwidth(t *testing.T) {
 
 	checkBandwidth(5, 25)
 }
+
+func TestManagerAnnotatesErrors(t *testing.T) {
+	require := require.New(t)
+
+	s := testfs.NewServer()
+	defer s.Cleanup()
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	m, err := NewManager([]Config{{
+		Namespace: ".*",
+		Backend: map[string]interface{}{
+			"testfs": testfs.Config{Addr: addr, NamePath: namepath.Identity},
+		},
+	}}, AuthConfig{})
+	require.NoError(err)
+
+	c, err := m.GetClient("foo")
+	require.NoError(err)
+
+	_, err = c.Stat("foo", "missing")
+	require.True(errors.Is(err, backenderrors.ErrBlobNotFound))
+	require.Equal("stat missing (backend testfs): blob not found", err.Error())
+
+	var b bytes.Buffer
+	err = c.Download("foo", "missing", &b)
+	require.True(errors.Is(err, backenderrors.ErrBlobNotFound))
+	require.Equal(
+		[]interface{}{"op", "download", "key", "missing", "backend", "testfs"}, errutil.Fields(err))
+}
@@ -44,6 +44,11 @@ func (c NoopClient) Download(namespace, name string, dst io.Writer) error {
 	return backenderrors.ErrBlobNotFound
 }
 
+// Delete always returns ErrBlobNotFound.
+func (c NoopClient) Delete(namespace, name string) error {
+	return backenderrors.ErrBlobNotFound
+}
+
 // List always returns nil.
 func (c NoopClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
 	return nil, nil
@@ -84,7 +84,7 @@ func (c *BlobClient) Stat(namespace, name string) (*core.BlobInfo, error) {
 	if err != nil && err == backenderrors.ErrBlobNotFound {
 		// Docker registry does not support querying manifests with blob path.
 		log.Infof("Blob %s unknown to registry. Tring to stat manifest instead", name)
-		info, err = c.statHelper(namespace, name, _manifestquery, opts)
+		info, err = c.statHelper(namespace, name, _manifestquery, acceptManifests(opts))
 	}
 	return info, err
 }
@@ -100,11 +100,17 @@ func (c *BlobClient) Download(namespace, name string, dst io.Writer) error {
 	if err != nil && err == backenderrors.ErrBlobNotFound {
 		// Docker registry does not support querying manifests with blob path.
 		log.Infof("Blob %s unknown to registry. Tring to download manifest instead", name)
-		err = c.downloadHelper(namespace, name, _manifestquery, dst, opts)
+		err = c.downloadHelper(namespace, name, _manifestquery, dst, acceptManifests(opts))
 	}
 	return err
 }
 
+// acceptManifests adds the manifest types Kraken supports to opts. Registries
+// would otherwise only serve manifests of the docker schema2 type.
+func acceptManifests(opts []httputil.SendOption) []httputil.SendOption {
+	return append(opts, httputil.SendHeaders(map[string]string{"Accept": _manifestTypes}))
+}
+
 func (c *BlobClient) statHelper(namespace, name, query string, opts []httputil.SendOption) (*core.BlobInfo, error) {
 	URL := fmt.Sprintf(query, c.config.Address, namespace, name)
 	resp, err := httputil.Head(
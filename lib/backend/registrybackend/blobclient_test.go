@@ -24,6 +24,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/dockerutil"
 	"github.com/uber/kraken/utils/memsize"
 	"github.com/uber/kraken/utils/randutil"
 	"github.com/uber/kraken/utils/testutil"
@@ -76,6 +77,7 @@ func TestBlobDownloadManifestSuccess(t *testing.T) {
 
 	r := chi.NewRouter()
 	r.Get(fmt.Sprintf("/v2/%s/manifests/{blob}", namespace), func(w http.ResponseWriter, req *http.Request) {
+		require.Contains(req.Header.Get("Accept"), dockerutil.MediaTypeOCIManifest)
 		_, err := io.Copy(w, bytes.NewReader(blob))
 		require.NoError(err)
 	})
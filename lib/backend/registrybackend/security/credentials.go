@@ -0,0 +1,232 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package security
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// Credential provider types.
+const (
+	ProviderBasic = "basic"
+	ProviderECR   = "ecr"
+	ProviderGCP   = "gcp"
+)
+
+// _gcpUsername is the username registries on GCP expect alongside an OAuth2
+// access token.
+const _gcpUsername = "oauth2accesstoken"
+
+// CredentialProviderConfig defines a provider of registry credentials which
+// expire, e.g. ECR authorization tokens, which are only valid for 12 hours.
+type CredentialProviderConfig struct {
+	// Type is one of "basic", "ecr" or "gcp". Basic uses the static
+	// credentials of the basic auth config.
+	Type string `yaml:"type"`
+
+	ECR ECRConfig `yaml:"ecr"`
+	GCP GCPConfig `yaml:"gcp"`
+
+	// RefreshMargin is how long before expiry credentials are refreshed.
+	RefreshMargin time.Duration `yaml:"refreshMargin"`
+}
+
+// ECRConfig defines configuration for fetching ECR authorization tokens using
+// the default AWS credential chain.
+type ECRConfig struct {
+	Region string `yaml:"region"`
+
+	// RegistryID is the AWS account ID of the registry. Defaults to the
+	// account of the AWS credentials.
+	RegistryID string `yaml:"registryID"`
+}
+
+// GCPConfig defines configuration for fetching OAuth2 access tokens using
+// Google application default credentials.
+type GCPConfig struct {
+	Scopes []string `yaml:"scopes"`
+}
+
+func (c CredentialProviderConfig) applyDefaults() CredentialProviderConfig {
+	if c.RefreshMargin == 0 {
+		c.RefreshMargin = 5 * time.Minute
+	}
+	if len(c.GCP.Scopes) == 0 {
+		c.GCP.Scopes = []string{"https://www.googleapis.com/auth/cloud-platform"}
+	}
+	return c
+}
+
+// Credentials are registry credentials which are valid until Expiry. A zero
+// Expiry never expires.
+type Credentials struct {
+	Username string
+	Password string
+	Expiry   time.Time
+}
+
+// CredentialProvider provides credentials for a registry.
+type CredentialProvider interface {
+	Credentials() (Credentials, error)
+}
+
+// newCredentialProvider returns the credential provider defined by config, or
+// nil if none is configured.
+func newCredentialProvider(config Config, clk clock.Clock) (CredentialProvider, error) {
+	c := config.CredentialProvider.applyDefaults()
+
+	var p CredentialProvider
+	switch c.Type {
+	case "":
+		return nil, nil
+	case ProviderBasic:
+		if config.BasicAuth == nil {
+			return nil, errors.New("basic provider requires basic auth config")
+		}
+		return staticProvider{Credentials{
+			Username: config.BasicAuth.Username,
+			Password: config.BasicAuth.Password,
+		}}, nil
+	case ProviderECR:
+		sess, err := session.NewSession(aws.NewConfig().WithRegion(c.ECR.Region))
+		if err != nil {
+			return nil, fmt.Errorf("aws session: %s", err)
+		}
+		p = &ecrProvider{ecr.New(sess), c.ECR.RegistryID}
+	case ProviderGCP:
+		ts, err := google.DefaultTokenSource(context.Background(), c.GCP.Scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("gcp token source: %s", err)
+		}
+		p = gcpProvider{ts}
+	default:
+		return nil, fmt.Errorf("unknown credential provider %q", c.Type)
+	}
+	return newRefreshingProvider(p, c.RefreshMargin, clk), nil
+}
+
+type staticProvider struct {
+	creds Credentials
+}
+
+func (p staticProvider) Credentials() (Credentials, error) {
+	return p.creds, nil
+}
+
+// ecrClient is the subset of the ECR API used to fetch authorization tokens.
+type ecrClient interface {
+	GetAuthorizationToken(*ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error)
+}
+
+type ecrProvider struct {
+	client     ecrClient
+	registryID string
+}
+
+func (p *ecrProvider) Credentials() (Credentials, error) {
+	input := &ecr.GetAuthorizationTokenInput{}
+	if p.registryID != "" {
+		input.RegistryIds = []*string{aws.String(p.registryID)}
+	}
+	output, err := p.client.GetAuthorizationToken(input)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("get authorization token: %s", err)
+	}
+	if len(output.AuthorizationData) == 0 {
+		return Credentials{}, errors.New("no authorization data")
+	}
+	data := output.AuthorizationData[0]
+	b, err := base64.StdEncoding.DecodeString(aws.StringValue(data.AuthorizationToken))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("decode authorization token: %s", err)
+	}
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 {
+		return Credentials{}, errors.New("invalid authorization token: expected '<user>:<password>'")
+	}
+	return Credentials{
+		Username: parts[0],
+		Password: parts[1],
+		Expiry:   aws.TimeValue(data.ExpiresAt),
+	}, nil
+}
+
+type gcpProvider struct {
+	ts oauth2.TokenSource
+}
+
+func (p gcpProvider) Credentials() (Credentials, error) {
+	token, err := p.ts.Token()
+	if err != nil {
+		return Credentials{}, fmt.Errorf("token: %s", err)
+	}
+	return Credentials{
+		Username: _gcpUsername,
+		Password: token.AccessToken,
+		Expiry:   token.Expiry,
+	}, nil
+}
+
+// refreshingProvider caches the credentials of a provider until they are
+// within margin of expiring. If a refresh fails, cached credentials are used
+// until they expire.
+type refreshingProvider struct {
+	provider CredentialProvider
+	margin   time.Duration
+	clk      clock.Clock
+
+	mu    sync.Mutex
+	creds *Credentials
+}
+
+func newRefreshingProvider(
+	p CredentialProvider, margin time.Duration, clk clock.Clock) *refreshingProvider {
+
+	return &refreshingProvider{provider: p, margin: margin, clk: clk}
+}
+
+func (p *refreshingProvider) Credentials() (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.clk.Now()
+	if p.creds != nil && (p.creds.Expiry.IsZero() || now.Add(p.margin).Before(p.creds.Expiry)) {
+		return *p.creds, nil
+	}
+	creds, err := p.provider.Credentials()
+	if err != nil {
+		if p.creds != nil && now.Before(p.creds.Expiry) {
+			log.Warnf("Error refreshing registry credentials, using cached credentials: %s", err)
+			return *p.creds, nil
+		}
+		return Credentials{}, err
+	}
+	p.creds = &creds
+	return creds, nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package security
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeECRClient struct {
+	token   string
+	expires time.Time
+}
+
+func (c *fakeECRClient) GetAuthorizationToken(
+	*ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+
+	return &ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{{
+			AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(c.token))),
+			ExpiresAt:          aws.Time(c.expires),
+		}},
+	}, nil
+}
+
+func TestECRProviderDecodesToken(t *testing.T) {
+	require := require.New(t)
+
+	expires := time.Now().Add(12 * time.Hour)
+	p := &ecrProvider{client: &fakeECRClient{token: "AWS:secret", expires: expires}}
+
+	creds, err := p.Credentials()
+	require.NoError(err)
+	require.Equal("AWS", creds.Username)
+	require.Equal("secret", creds.Password)
+	require.True(expires.Equal(creds.Expiry))
+}
+
+func TestECRProviderInvalidToken(t *testing.T) {
+	p := &ecrProvider{client: &fakeECRClient{token: "no-separator"}}
+
+	_, err := p.Credentials()
+	require.Error(t, err)
+}
+
+type fakeProvider struct {
+	creds Credentials
+	err   error
+	calls int
+}
+
+func (p *fakeProvider) Credentials() (Credentials, error) {
+	p.calls++
+	return p.creds, p.err
+}
+
+func TestRefreshingProviderRefreshesBeforeExpiry(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	fake := &fakeProvider{creds: Credentials{Username: "a", Expiry: clk.Now().Add(time.Hour)}}
+	p := newRefreshingProvider(fake, 5*time.Minute, clk)
+
+	for i := 0; i < 3; i++ {
+		creds, err := p.Credentials()
+		require.NoError(err)
+		require.Equal("a", creds.Username)
+	}
+	require.Equal(1, fake.calls)
+
+	clk.Add(56 * time.Minute)
+	fake.creds = Credentials{Username: "b", Expiry: clk.Now().Add(time.Hour)}
+
+	creds, err := p.Credentials()
+	require.NoError(err)
+	require.Equal("b", creds.Username)
+	require.Equal(2, fake.calls)
+}
+
+func TestRefreshingProviderUsesCachedCredentialsOnError(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	fake := &fakeProvider{creds: Credentials{Username: "a", Expiry: clk.Now().Add(time.Hour)}}
+	p := newRefreshingProvider(fake, 5*time.Minute, clk)
+
+	_, err := p.Credentials()
+	require.NoError(err)
+
+	// Within the refresh margin, failed refreshes fall back to cached credentials.
+	clk.Add(58 * time.Minute)
+	fake.err = errors.New("some error")
+	creds, err := p.Credentials()
+	require.NoError(err)
+	require.Equal("a", creds.Username)
+
+	// Expired credentials are never used.
+	clk.Add(5 * time.Minute)
+	_, err = p.Credentials()
+	require.Error(err)
+}
+
+func TestNewCredentialProviderBasicRequiresBasicAuth(t *testing.T) {
+	_, err := newCredentialProvider(
+		Config{CredentialProvider: CredentialProviderConfig{Type: ProviderBasic}}, clock.New())
+	require.Error(t, err)
+}
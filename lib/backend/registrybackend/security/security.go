@@ -24,6 +24,7 @@ import (
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/docker/distribution/registry/client/auth"
 	"github.com/docker/distribution/registry/client/auth/challenge"
 	"github.com/docker/distribution/registry/client/transport"
@@ -49,6 +50,13 @@ type Config struct {
 	BasicAuth              *types.AuthConfig  `yaml:"basic"`
 	RemoteCredentialsStore string             `yaml:"credsStore"`
 	EnableHTTPFallback     bool               `yaml:"enableHTTPFallback"`
+
+	// Proxy routes requests to the registry through an egress proxy.
+	Proxy httputil.ProxyConfig `yaml:"proxy"`
+
+	// CredentialProvider provides credentials which expire, and takes
+	// precedence over BasicAuth and RemoteCredentialsStore.
+	CredentialProvider CredentialProviderConfig `yaml:"credentialProvider"`
 }
 
 // Authenticator creates send options to authenticate requests to registry
@@ -66,6 +74,7 @@ type authenticator struct {
 	credentialStore  auth.CredentialStore
 	challengeManager challenge.Manager
 	tokenHandlers    sync.Map
+	proxy            *httputil.Proxy
 }
 
 // NewAuthenticator returns a new authenticator for the given docker registry
@@ -79,12 +88,24 @@ func NewAuthenticator(address string, config Config) (Authenticator, error) {
 		return nil, fmt.Errorf("build tls config for %q: %s", address, err)
 	}
 	rt.TLSClientConfig = tlsClientConfig
+	proxy, err := config.Proxy.Build()
+	if err != nil {
+		return nil, fmt.Errorf("build proxy for %q: %s", address, err)
+	}
+	if proxy != nil {
+		rt.Proxy = proxy.Func()
+	}
+	provider, err := newCredentialProvider(config, clock.New())
+	if err != nil {
+		return nil, fmt.Errorf("build credential provider for %q: %s", address, err)
+	}
 	return &authenticator{
 		address:          address,
 		config:           config,
 		roundTripper:     rt,
-		credentialStore:  newCredentialStore(address, config),
+		credentialStore:  newCredentialStore(address, config, provider),
 		challengeManager: challenge.NewSimpleManager(),
+		proxy:            proxy,
 	}, nil
 }
 
@@ -93,7 +114,7 @@ func (a *authenticator) Authenticate(repo string) ([]httputil.SendOption, error)
 
 	var opts []httputil.SendOption
 	if config.TLS.Client.Disabled {
-		opts = append(opts, httputil.SendNoop())
+		opts = append(opts, httputil.SendProxy(a.proxy))
 		return opts, nil
 	}
 
@@ -112,7 +133,9 @@ func (a *authenticator) Authenticate(repo string) ([]httputil.SendOption, error)
 }
 
 func (a *authenticator) shouldAuth() bool {
-	return a.config.BasicAuth != nil || a.config.RemoteCredentialsStore != ""
+	return a.config.BasicAuth != nil ||
+		a.config.RemoteCredentialsStore != "" ||
+		a.config.CredentialProvider.Type != ""
 }
 
 func (a *authenticator) transport(repo string) http.RoundTripper {
@@ -154,18 +177,30 @@ func (a *authenticator) updateChallenge() error {
 }
 
 type credentialStore struct {
-	address string
-	config  Config
+	address  string
+	config   Config
+	provider CredentialProvider
 }
 
-func newCredentialStore(address string, config Config) *credentialStore {
+func newCredentialStore(
+	address string, config Config, provider CredentialProvider) *credentialStore {
+
 	return &credentialStore{
-		address: address,
-		config:  config,
+		address:  address,
+		config:   config,
+		provider: provider,
 	}
 }
 
 func (c credentialStore) Basic(*url.URL) (string, string) {
+	if c.provider != nil {
+		creds, err := c.provider.Credentials()
+		if err != nil {
+			log.Errorf("get credentials from provider for %q: %s", c.address, err)
+			return "", ""
+		}
+		return creds.Username, creds.Password
+	}
 	if username, password := c.credentialsFromHelper(); username != "" && username != tokenUsername {
 		return username, password
 	}
@@ -177,6 +212,9 @@ func (c credentialStore) Basic(*url.URL) (string, string) {
 }
 
 func (c credentialStore) RefreshToken(*url.URL, string) string {
+	if c.provider != nil {
+		return ""
+	}
 	if username, token := c.credentialsFromHelper(); username == tokenUsername {
 		return token
 	}
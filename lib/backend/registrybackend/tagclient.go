@@ -53,7 +53,10 @@ func (f *tagClientFactory) Create(
 }
 
 const _tagquery = "http://%s/v2/%s/manifests/%s"
-const _v2ManifestType = "application/vnd.docker.distribution.manifest.v2+json"
+
+// _manifestTypes accepts single-arch manifests as well as manifest lists, such
+// that tags of multi-arch images resolve to their list.
+var _manifestTypes = strings.Join(dockerutil.ManifestMediaTypes, ", ")
 
 // TagClient stats and downloads tag from registry.
 type TagClient struct {
@@ -92,7 +95,7 @@ func (c *TagClient) Stat(namespace, name string) (*core.BlobInfo, error) {
 		URL,
 		append(
 			opts,
-			httputil.SendHeaders(map[string]string{"Accept": _v2ManifestType}),
+			httputil.SendHeaders(map[string]string{"Accept": _manifestTypes}),
 			httputil.SendAcceptedCodes(http.StatusOK, http.StatusNotFound),
 		)...,
 	)
@@ -128,7 +131,7 @@ func (c *TagClient) Download(namespace, name string, dst io.Writer) error {
 		URL,
 		append(
 			opts,
-			httputil.SendHeaders(map[string]string{"Accept": _v2ManifestType}),
+			httputil.SendHeaders(map[string]string{"Accept": _manifestTypes}),
 			httputil.SendAcceptedCodes(http.StatusOK, http.StatusNotFound),
 		)...,
 	)
@@ -141,9 +144,9 @@ func (c *TagClient) Download(namespace, name string, dst io.Writer) error {
 		return backenderrors.ErrBlobNotFound
 	}
 
-	_, digest, err := dockerutil.ParseManifestV2(resp.Body)
+	_, digest, err := dockerutil.ParseManifest(resp.Body)
 	if err != nil {
-		return fmt.Errorf("parse manifest v2: %s", err)
+		return fmt.Errorf("parse manifest: %s", err)
 	}
 	if _, err := io.Copy(dst, strings.NewReader(digest.String())); err != nil {
 		return fmt.Errorf("copy: %s", err)
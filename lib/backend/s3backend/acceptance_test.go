@@ -0,0 +1,54 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build acceptance
+// +build acceptance
+
+package s3backend
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/lib/backend/backendtest"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/test/containers"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientSuiteAgainstMinio(t *testing.T) {
+	require := require.New(t)
+
+	minio, err := containers.StartMinio()
+	require.NoError(err)
+	defer minio.Close()
+
+	var auth AuthConfig
+	auth.S3.AccessKeyID = containers.MinioAccessKey
+	auth.S3.AccessSecretKey = containers.MinioSecretKey
+
+	client, err := NewClient(Config{
+		Username:         "minio",
+		Region:           "us-east-1",
+		Bucket:           containers.MinioBucket,
+		Endpoint:         minio.Addr(),
+		DisableSSL:       true,
+		S3ForcePathStyle: true,
+		RootDirectory:    "/root",
+		NamePath:         namepath.Identity,
+	}, UserAuthConfig{"minio": auth})
+	require.NoError(err)
+
+	backendtest.Run(t, client)
+}
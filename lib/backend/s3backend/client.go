@@ -17,12 +17,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"path"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
 	"github.com/uber/kraken/utils/rwutil"
 
@@ -126,6 +128,19 @@ func NewClient(
 		awsConfig = awsConfig.WithS3ForcePathStyle(config.S3ForcePathStyle)
 	}
 
+	proxy, err := config.Proxy.Build()
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %s", err)
+	}
+	tls, err := config.TLS.Build()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %s", err)
+	}
+	if proxy != nil || tls != nil {
+		awsConfig = awsConfig.WithHTTPClient(
+			&http.Client{Transport: httputil.NewTransport(tls, proxy)})
+	}
+
 	api := s3.New(session.New(), awsConfig)
 
 	downloader := s3manager.NewDownloaderWithClient(api, func(d *s3manager.Downloader) {
@@ -168,6 +183,23 @@ func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
 	return core.NewBlobInfo(size), nil
 }
 
+// Delete deletes name from the configured bucket. S3 deletes succeed whether
+// or not the object exists, so the object is checked first.
+func (c *Client) Delete(namespace, name string) error {
+	if _, err := c.Stat(namespace, name); err != nil {
+		return err
+	}
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	_, err = c.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(c.config.Bucket),
+		Key:    aws.String(path),
+	})
+	return err
+}
+
 // Download downloads the content from a configured bucket and writes the
 // data to dst.
 func (c *Client) Download(namespace, name string, dst io.Writer) error {
@@ -272,7 +304,6 @@ func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListR
 			names = append(names, name)
 		}
 
-
 		if int64(len(names)) < maxKeys {
 			// Continue iterating pages to get more keys
 			return true
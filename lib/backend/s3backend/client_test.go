@@ -104,6 +104,28 @@ func TestClientStat(t *testing.T) {
 	require.Equal(core.NewBlobInfo(100), info)
 }
 
+func TestClientDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	var length int64 = 100
+
+	mocks.s3.EXPECT().HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("/root/test"),
+	}).Return(&s3.HeadObjectOutput{ContentLength: &length}, nil)
+	mocks.s3.EXPECT().DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("/root/test"),
+	}).Return(&s3.DeleteObjectOutput{}, nil)
+
+	require.NoError(client.Delete(core.NamespaceFixture(), "test"))
+}
+
 func TestClientDownload(t *testing.T) {
 	require := require.New(t)
 
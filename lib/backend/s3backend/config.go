@@ -17,6 +17,7 @@ import (
 	"github.com/c2h5oh/datasize"
 
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/httputil"
 )
 
 // Config defines s3 connection specific
@@ -45,6 +46,13 @@ type Config struct {
 
 	// NamePath identifies which namepath.Pather to use.
 	NamePath string `yaml:"name_path"`
+
+	// Proxy routes requests to S3 through an egress proxy.
+	Proxy httputil.ProxyConfig `yaml:"proxy"`
+
+	// TLS verifies S3 endpoints signed by private CAs, and presents client
+	// certificates to endpoints which require them.
+	TLS httputil.ClientTLSConfig `yaml:"tls"`
 }
 
 // UserAuthConfig defines authentication configuration overlayed by Langley.
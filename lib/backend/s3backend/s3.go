@@ -25,6 +25,8 @@ import (
 type S3 interface {
 	HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
 
+	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+
 	Download(
 		w io.WriterAt,
 		input *s3.GetObjectInput,
@@ -14,9 +14,13 @@
 package testfs
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/backend/backendtest"
 	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/stretchr/testify/require"
 )
@@ -32,3 +36,36 @@ func TestClientFactory(t *testing.T) {
 	_, err := f.Create(config, nil)
 	require.NoError(err)
 }
+
+func TestClientSuite(t *testing.T) {
+	s := NewServer()
+	defer s.Cleanup()
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	client, err := NewClient(Config{Addr: addr, Root: "root", NamePath: namepath.Identity})
+	require.NoError(t, err)
+
+	backendtest.Run(t, client)
+}
+
+func TestClientDelete(t *testing.T) {
+	require := require.New(t)
+
+	s := NewServer()
+	defer s.Cleanup()
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	client, err := NewClient(Config{Addr: addr, Root: "root", NamePath: namepath.Identity})
+	require.NoError(err)
+
+	require.NoError(client.Upload("", "a", bytes.NewBufferString("foo")))
+	require.NoError(client.Delete("", "a"))
+
+	_, err = client.Stat("", "a")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+	require.Equal(backenderrors.ErrBlobNotFound, client.Delete("", "a"))
+}
@@ -69,7 +69,7 @@ func New(
 	})
 
 	requests := dedup.NewRequestCache(dedup.RequestCacheConfig{}, clock.New())
-	requests.SetNotFound(func(err error) bool { return err == backenderrors.ErrBlobNotFound })
+	requests.SetNotFound(func(err error) bool { return errors.Is(err, backenderrors.ErrBlobNotFound) })
 
 	return &Refresher{config, stats, requests, cas, backends, metaInfoGenerator}
 }
@@ -90,7 +90,7 @@ func (r *Refresher) Refresh(namespace string, d core.Digest, hooks ...PostHook)
 	// errors are propogated quickly and syncronously.
 	info, err := client.Stat(namespace, d.Hex())
 	if err != nil {
-		if err == backenderrors.ErrBlobNotFound {
+		if errors.Is(err, backenderrors.ErrBlobNotFound) {
 			return ErrNotFound
 		}
 		return fmt.Errorf("stat: %s", err)
@@ -122,12 +122,12 @@ func (r *Refresher) Refresh(namespace string, d core.Digest, hooks ...PostHook)
 		}
 		return nil
 	})
-	switch err {
-	case dedup.ErrRequestPending:
+	switch {
+	case err == dedup.ErrRequestPending:
 		return ErrPending
-	case backenderrors.ErrBlobNotFound:
+	case errors.Is(err, backenderrors.ErrBlobNotFound):
 		return ErrNotFound
-	case dedup.ErrWorkersBusy:
+	case err == dedup.ErrWorkersBusy:
 		return ErrWorkersBusy
 	default:
 		return err
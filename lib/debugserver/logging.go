@@ -0,0 +1,238 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package debugserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LoggingConfig defines how long runtime logging overrides last before they
+// are reverted.
+type LoggingConfig struct {
+	// DefaultDuration is the duration of overrides which do not specify one.
+	DefaultDuration time.Duration `yaml:"default_duration"`
+
+	// MaxDuration bounds the duration of overrides, such that debug logging is
+	// never left on indefinitely.
+	MaxDuration time.Duration `yaml:"max_duration"`
+}
+
+func (c LoggingConfig) applyDefaults() LoggingConfig {
+	if c.DefaultDuration == 0 {
+		c.DefaultDuration = 15 * time.Minute
+	}
+	if c.MaxDuration == 0 {
+		c.MaxDuration = 4 * time.Hour
+	}
+	return c
+}
+
+// loggingRequest overrides the logging settings of a component. Omitted
+// settings are left unchanged.
+type loggingRequest struct {
+	Level *zapcore.Level `json:"level"`
+
+	Sampling        *zap.SamplingConfig `json:"sampling"`
+	DisableSampling bool                `json:"disable_sampling"`
+
+	// Duration is how long the override lasts, e.g. "30m".
+	Duration string `json:"duration"`
+}
+
+// loggingResponse describes the current logging settings, and when they revert
+// if they are overridden.
+type loggingResponse struct {
+	log.Settings
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// loggingOverrides applies runtime overrides of the global logger, and reverts
+// them to the settings preceding the first override once they expire.
+type loggingOverrides struct {
+	config LoggingConfig
+	clk    clock.Clock
+
+	mu       sync.Mutex
+	baseline *log.Settings
+	revertAt time.Time
+	timer    *clock.Timer
+
+	// gen identifies the latest override, such that timers of replaced
+	// overrides which already fired do not revert it.
+	gen int
+}
+
+func newLoggingOverrides(config LoggingConfig, clk clock.Clock) *loggingOverrides {
+	return &loggingOverrides{config: config.applyDefaults(), clk: clk}
+}
+
+// ServeHTTP returns the current settings on GET, overrides them on PUT, and
+// reverts overrides on DELETE.
+func (o *loggingOverrides) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		err = o.override(r)
+	case http.MethodDelete:
+		err = o.revert(o.generation())
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		if serr, ok := err.(statusError); ok {
+			http.Error(w, serr.msg, serr.status)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := o.current()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type statusError struct {
+	status int
+	msg    string
+}
+
+func (e statusError) Error() string { return e.msg }
+
+func badRequest(format string, args ...interface{}) error {
+	return statusError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+func (o *loggingOverrides) current() (loggingResponse, error) {
+	s, ok := log.GetSettings()
+	if !ok {
+		return loggingResponse{}, statusError{
+			http.StatusNotImplemented, "logger cannot be reconfigured"}
+	}
+	resp := loggingResponse{Settings: s}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.baseline != nil {
+		t := o.revertAt
+		resp.RevertAt = &t
+	}
+	return resp, nil
+}
+
+func (o *loggingOverrides) override(r *http.Request) error {
+	var req loggingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return badRequest("json decode request: %s", err)
+	}
+	d := o.config.DefaultDuration
+	if req.Duration != "" {
+		var err error
+		d, err = time.ParseDuration(req.Duration)
+		if err != nil {
+			return badRequest("parse duration: %s", err)
+		}
+	}
+	if d <= 0 || d > o.config.MaxDuration {
+		return badRequest("duration must be within (0, %s]", o.config.MaxDuration)
+	}
+	if req.Sampling != nil && (req.Sampling.Initial < 0 || req.Sampling.Thereafter < 0) {
+		return badRequest("sampling rates must not be negative")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	current, ok := log.GetSettings()
+	if !ok {
+		return statusError{http.StatusNotImplemented, "logger cannot be reconfigured"}
+	}
+	s := current
+	if req.Level != nil {
+		s.Level = *req.Level
+	}
+	if req.DisableSampling {
+		s.Sampling = nil
+	} else if req.Sampling != nil {
+		s.Sampling = req.Sampling
+	}
+	if err := log.Reconfigure(s); err != nil {
+		return fmt.Errorf("reconfigure logger: %s", err)
+	}
+	if o.baseline == nil {
+		o.baseline = &current
+	}
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	o.gen++
+	gen := o.gen
+	o.timer = o.clk.AfterFunc(d, func() {
+		if err := o.revert(gen); err != nil {
+			log.Errorf("Error reverting logging override: %s", err)
+		}
+	})
+	o.revertAt = o.clk.Now().Add(d)
+
+	log.With(
+		"level", s.Level,
+		"sampling", s.Sampling,
+		"duration", d,
+		"remote_addr", r.RemoteAddr).Warn("Logging settings overridden")
+	return nil
+}
+
+func (o *loggingOverrides) generation() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.gen
+}
+
+// revert restores the settings preceding the first override, unless gen was
+// replaced by a newer override.
+func (o *loggingOverrides) revert(gen int) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.baseline == nil || gen != o.gen {
+		return nil
+	}
+	if err := log.Reconfigure(*o.baseline); err != nil {
+		return fmt.Errorf("reconfigure logger: %s", err)
+	}
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	o.baseline = nil
+	o.timer = nil
+	log.Info("Logging settings reverted")
+	return nil
+}
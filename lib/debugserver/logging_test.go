@@ -0,0 +1,161 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package debugserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func serveLogging(t *testing.T, h http.Handler, method, body string) (int, loggingResponse) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, "/admin/logging", strings.NewReader(body)))
+	var resp loggingResponse
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	}
+	return rec.Code, resp
+}
+
+// restoreLogging restores the settings of the global logger once a test ends.
+func restoreLogging(t *testing.T) func() {
+	s, ok := log.GetSettings()
+	require.True(t, ok)
+	return func() { require.NoError(t, log.Reconfigure(s)) }
+}
+
+func TestLoggingOverrideReverts(t *testing.T) {
+	require := require.New(t)
+
+	defer restoreLogging(t)()
+	require.NoError(log.Reconfigure(log.Settings{Level: zapcore.InfoLevel}))
+
+	clk := clock.NewMock()
+	h := newHandler(Config{}, nil, clk)
+
+	code, resp := serveLogging(t, h, "GET", "")
+	require.Equal(http.StatusOK, code)
+	require.Equal(zapcore.InfoLevel, resp.Level)
+	require.Nil(resp.RevertAt)
+
+	code, resp = serveLogging(t, h, "PUT", `{
+		"level": "debug",
+		"sampling": {"initial": 10, "thereafter": 50},
+		"duration": "10m"
+	}`)
+	require.Equal(http.StatusOK, code)
+	require.Equal(zapcore.DebugLevel, resp.Level)
+	require.Equal(&zap.SamplingConfig{Initial: 10, Thereafter: 50}, resp.Sampling)
+	require.NotNil(resp.RevertAt)
+	require.True(clk.Now().Add(10 * time.Minute).Equal(*resp.RevertAt))
+	require.True(log.Default().Desugar().Core().Enabled(zapcore.DebugLevel))
+
+	clk.Add(5 * time.Minute)
+	s, _ := log.GetSettings()
+	require.Equal(zapcore.DebugLevel, s.Level)
+
+	clk.Add(5 * time.Minute)
+	s, _ = log.GetSettings()
+	require.Equal(log.Settings{Level: zapcore.InfoLevel}, s)
+	require.False(log.Default().Desugar().Core().Enabled(zapcore.DebugLevel))
+
+	_, resp = serveLogging(t, h, "GET", "")
+	require.Nil(resp.RevertAt)
+}
+
+func TestLoggingOverrideExtendsAndRevertsToBaseline(t *testing.T) {
+	require := require.New(t)
+
+	defer restoreLogging(t)()
+	require.NoError(log.Reconfigure(log.Settings{Level: zapcore.WarnLevel}))
+
+	clk := clock.NewMock()
+	h := newHandler(Config{}, nil, clk)
+
+	code, _ := serveLogging(t, h, "PUT", `{"level": "info", "duration": "10m"}`)
+	require.Equal(http.StatusOK, code)
+
+	clk.Add(5 * time.Minute)
+
+	code, _ = serveLogging(t, h, "PUT", `{"level": "debug", "duration": "10m"}`)
+	require.Equal(http.StatusOK, code)
+
+	// The first override would have expired by now.
+	clk.Add(6 * time.Minute)
+	s, _ := log.GetSettings()
+	require.Equal(zapcore.DebugLevel, s.Level)
+
+	// Reverts to the settings preceding the first override.
+	clk.Add(5 * time.Minute)
+	s, _ = log.GetSettings()
+	require.Equal(zapcore.WarnLevel, s.Level)
+}
+
+func TestLoggingOverrideDefaultDurationAndDelete(t *testing.T) {
+	require := require.New(t)
+
+	defer restoreLogging(t)()
+	require.NoError(log.Reconfigure(log.Settings{
+		Level:    zapcore.InfoLevel,
+		Sampling: &zap.SamplingConfig{Initial: 100, Thereafter: 100},
+	}))
+
+	clk := clock.NewMock()
+	h := newHandler(Config{Logging: LoggingConfig{DefaultDuration: time.Minute}}, nil, clk)
+
+	code, resp := serveLogging(t, h, "PUT", `{"disable_sampling": true}`)
+	require.Equal(http.StatusOK, code)
+	require.Equal(zapcore.InfoLevel, resp.Level)
+	require.Nil(resp.Sampling)
+	require.True(clk.Now().Add(time.Minute).Equal(*resp.RevertAt))
+
+	code, resp = serveLogging(t, h, "DELETE", "")
+	require.Equal(http.StatusOK, code)
+	require.Equal(&zap.SamplingConfig{Initial: 100, Thereafter: 100}, resp.Sampling)
+	require.Nil(resp.RevertAt)
+}
+
+func TestLoggingOverrideBadRequests(t *testing.T) {
+	defer restoreLogging(t)()
+
+	h := newHandler(Config{Logging: LoggingConfig{MaxDuration: time.Hour}}, nil, clock.NewMock())
+
+	for _, body := range []string{
+		`not json`,
+		`{"level": "verbose"}`,
+		`{"duration": "forever"}`,
+		`{"duration": "2h"}`,
+		`{"duration": "-1m"}`,
+		`{"sampling": {"initial": -1}}`,
+	} {
+		t.Run(body, func(t *testing.T) {
+			code, _ := serveLogging(t, h, "PUT", body)
+			require.Equal(t, http.StatusBadRequest, code)
+		})
+	}
+
+	code, _ := serveLogging(t, h, "POST", "")
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+}
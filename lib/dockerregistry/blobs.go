@@ -22,10 +22,13 @@ import (
 	"os"
 	"time"
 
+	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/dockerregistry/transfer"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/utils/log"
 
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/uber-go/tally"
 )
 
 // BlobStore defines cache file accessors.
@@ -34,13 +37,18 @@ type BlobStore interface {
 	GetCacheFileReader(name string) (store.FileReader, error)
 }
 
+// ErrContentCorrupted is returned when blob content read in full does not match
+// its digest.
+var ErrContentCorrupted = errors.New("blob content does not match digest")
+
 type blobs struct {
 	bs         BlobStore
 	transferer transfer.ImageTransferer
+	metrics    tally.Scope
 }
 
-func newBlobs(bs BlobStore, transferer transfer.ImageTransferer) *blobs {
-	return &blobs{bs, transferer}
+func newBlobs(bs BlobStore, transferer transfer.ImageTransferer, metrics tally.Scope) *blobs {
+	return &blobs{bs, transferer, metrics}
 }
 
 // getDigest returns blob digest given a blob path.
@@ -82,13 +90,43 @@ func (b *blobs) reader(ctx context.Context, path string, offset int64) (io.ReadC
 	return b.getCacheReaderHelper(ctx, path, offset)
 }
 
+// getContent returns the full content of the blob at path. Full reads are used
+// for manifests and image configs, which are small enough to verify against
+// their digest before they are served, such that corrupted content is never
+// handed to clients.
 func (b *blobs) getContent(ctx context.Context, path string) ([]byte, error) {
 	r, err := b.getCacheReaderHelper(ctx, path, 0)
 	if err != nil {
 		return nil, err
 	}
 	defer r.Close()
-	return ioutil.ReadAll(r)
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read: %s", err)
+	}
+	if err := b.verify(path, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// verify checks that content matches the digest of the blob at path.
+func (b *blobs) verify(path string, content []byte) error {
+	expected, err := GetBlobDigest(path)
+	if err != nil {
+		return fmt.Errorf("get blob digest %s: %s", path, err)
+	}
+	actual, err := core.NewDigester().FromBytes(content)
+	if err != nil {
+		return fmt.Errorf("compute digest: %s", err)
+	}
+	if actual != expected {
+		b.metrics.Counter("blob_content_corrupted").Inc(1)
+		log.With("expected", expected, "actual", actual).Errorf(
+			"Refusing to serve corrupted blob content: %s", ErrContentCorrupted)
+		return fmt.Errorf("verify %s: %w", expected, ErrContentCorrupted)
+	}
+	return nil
 }
 
 func (b *blobs) getCacheReaderHelper(
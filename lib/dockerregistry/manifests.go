@@ -14,13 +14,16 @@
 package dockerregistry
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"strings"
 	"time"
 
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/utils/dockerutil"
 	"github.com/uber/kraken/utils/log"
 )
 
@@ -32,6 +35,10 @@ const (
 	getFailureCounter    = "dockertag.failure.get"
 )
 
+// _encryptAtRestAnnotation is the manifest annotation with which images opt
+// into encryption of their blobs at rest on agents.
+const _encryptAtRestAnnotation = "com.github.uber.kraken.encrypt-at-rest"
+
 type manifests struct {
 	transferer transfer.ImageTransferer
 }
@@ -40,13 +47,21 @@ func newManifests(transferer transfer.ImageTransferer) *manifests {
 	return &manifests{transferer}
 }
 
+func (t *manifests) getTag(tag, token string) (core.Digest, error) {
+	if c, ok := t.transferer.(transfer.ConsistentTagGetter); ok && token != "" {
+		return c.GetConsistentTag(tag, token)
+	}
+	return t.transferer.GetTag(tag)
+}
+
 // getDigest downloads and returns manifest digest.
 // This is the only place storage driver would download a manifest blob via
 // torrent scheduler or origin because it has namespace information.
 // The caller of storage driver would first call this function to resolve
 // the manifest link (and downloads manifest blob),
 // then call Stat or Reader which would assume the blob is on disk already.
-func (t *manifests) getDigest(path string, subtype PathSubType) ([]byte, error) {
+// Tags are resolved presenting token, if set and supported by the transferer.
+func (t *manifests) getDigest(path string, subtype PathSubType, token string) ([]byte, error) {
 	repo, err := GetRepo(path)
 	if err != nil {
 		return nil, fmt.Errorf("get repo: %s", err)
@@ -59,7 +74,7 @@ func (t *manifests) getDigest(path string, subtype PathSubType) ([]byte, error)
 		if err != nil {
 			return nil, fmt.Errorf("get manifest tag: %s", err)
 		}
-		digest, err = t.transferer.GetTag(fmt.Sprintf("%s:%s", repo, tag))
+		digest, err = t.getTag(fmt.Sprintf("%s:%s", repo, tag), token)
 		if err != nil {
 			return nil, fmt.Errorf("transferer get tag: %w", err)
 		}
@@ -79,9 +94,50 @@ func (t *manifests) getDigest(path string, subtype PathSubType) ([]byte, error)
 	}
 	defer blob.Close()
 
+	if r, ok := t.transferer.(transfer.EncryptionRequester); ok {
+		manifest, err := ioutil.ReadAll(blob)
+		if err != nil {
+			return nil, fmt.Errorf("read manifest: %s", err)
+		}
+		if err := requestEncryption(r, repo, manifest); err != nil {
+			return nil, fmt.Errorf("request encryption: %s", err)
+		}
+	}
+
+	if b, ok := t.transferer.(transfer.BundleDownloader); ok {
+		// Bundles are an optimization, and blobs are downloaded individually
+		// if the bundle cannot be.
+		if err := b.DownloadBundle(repo, digest); err != nil {
+			log.With("manifest", digest).Errorf("Error downloading bundle: %s", err)
+		}
+	}
+
 	return []byte(digest.String()), nil
 }
 
+// requestEncryption requests encryption at rest of all blobs referenced by
+// manifest, if manifest opts in via annotation.
+func requestEncryption(r transfer.EncryptionRequester, repo string, manifest []byte) error {
+	// Manifests which fail to parse, e.g. manifest lists, cannot opt in.
+	m, _, err := dockerutil.ParseManifestV2(bytes.NewReader(manifest))
+	if err != nil {
+		return nil
+	}
+	annotations, err := dockerutil.ManifestAnnotations(m)
+	if err != nil {
+		return nil
+	}
+	if annotations[_encryptAtRestAnnotation] != "true" {
+		return nil
+	}
+	refs, err := dockerutil.GetManifestReferences(m)
+	if err != nil {
+		return fmt.Errorf("get manifest references: %s", err)
+	}
+	r.RequestEncryption(repo, refs)
+	return nil
+}
+
 func (t *manifests) putContent(path string, subtype PathSubType) error {
 	switch subtype {
 	case _tags:
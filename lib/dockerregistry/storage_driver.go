@@ -20,10 +20,12 @@ import (
 	"io"
 	"os"
 
+	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/lib/dockerregistry/transfer"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/utils/log"
 
+	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/factory"
 	"github.com/uber-go/tally"
@@ -130,7 +132,7 @@ func NewReadWriteStorageDriver(
 	return &KrakenStorageDriver{
 		config:     config,
 		transferer: transferer,
-		blobs:      newBlobs(cas, transferer),
+		blobs:      newBlobs(cas, transferer, metrics),
 		uploads:    newCASUploads(cas, transferer),
 		manifests:  newManifests(transferer),
 		metrics:    metrics,
@@ -147,7 +149,7 @@ func NewReadOnlyStorageDriver(
 	return &KrakenStorageDriver{
 		config:     config,
 		transferer: transferer,
-		blobs:      newBlobs(bs, transferer),
+		blobs:      newBlobs(bs, transferer, metrics),
 		uploads:    disabledUploads{},
 		manifests:  newManifests(transferer),
 		metrics:    metrics,
@@ -171,7 +173,7 @@ func (d *KrakenStorageDriver) GetContent(ctx context.Context, path string) ([]by
 	var data []byte
 	switch pathType {
 	case _manifests:
-		data, err = d.manifests.getDigest(path, pathSubType)
+		data, err = d.manifests.getDigest(path, pathSubType, consistencyToken(ctx))
 	case _uploads:
 		data, err = d.uploads.getContent(path, pathSubType)
 	case _layers:
@@ -187,6 +189,16 @@ func (d *KrakenStorageDriver) GetContent(ctx context.Context, path string) ([]by
 	return data, nil
 }
 
+// consistencyToken returns the consistency token presented by the registry
+// request of ctx, if any.
+func consistencyToken(ctx context.Context) string {
+	r, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return ""
+	}
+	return r.Header.Get(tagmodels.ConsistencyTokenHeader)
+}
+
 // Reader returns a reader of path at offset
 func (d *KrakenStorageDriver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
 	log.Debugf("(*KrakenStorageDriver).Reader %s", path)
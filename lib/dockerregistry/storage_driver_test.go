@@ -15,6 +15,7 @@ package dockerregistry
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -24,8 +25,12 @@ import (
 
 	"github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/uuid"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	mocktransfer "github.com/uber/kraken/mocks/lib/dockerregistry/transfer"
 	"github.com/uber/kraken/utils/randutil"
 )
 
@@ -254,3 +259,84 @@ func TestStorageDriverMove(t *testing.T) {
 	require.NoError(err)
 	require.Equal(uploadContent, string(data))
 }
+
+func TestStorageDriverGetContentRejectsCorruptedBlobs(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	transferer := mocktransfer.NewMockImageTransferer(ctrl)
+	stats := tally.NewTestScope("", nil)
+	sd := NewReadOnlyStorageDriver(Config{}, nil, transferer, stats)
+
+	blob := core.NewBlobFixture()
+	corrupted := append([]byte("corrupted"), blob.Content...)
+
+	transferer.EXPECT().Download("dummy", blob.Digest).Return(
+		store.NewBufferFileReader(corrupted), nil)
+
+	_, err := sd.GetContent(contextFixture(), genBlobDataPath(blob.Digest.Hex()))
+	require.True(errors.Is(err, ErrContentCorrupted))
+	require.Equal(int64(1), stats.Snapshot().Counters()["blob_content_corrupted+"].Value())
+}
+
+type encryptionRequestRecorder struct {
+	*mocktransfer.MockImageTransferer
+	requested []core.Digest
+}
+
+func (r *encryptionRequestRecorder) RequestEncryption(namespace string, ds []core.Digest) {
+	r.requested = append(r.requested, ds...)
+}
+
+func TestStorageDriverGetManifestRequestsEncryption(t *testing.T) {
+	config := core.DigestFixture()
+	layer := core.DigestFixture()
+
+	tests := []struct {
+		desc       string
+		annotation string
+		expected   []core.Digest
+	}{
+		{"opted in", "true", []core.Digest{config, layer}},
+		{"not opted in", "false", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			transferer := &encryptionRequestRecorder{
+				MockImageTransferer: mocktransfer.NewMockImageTransferer(ctrl),
+			}
+			sd := NewReadOnlyStorageDriver(Config{}, nil, transferer, tally.NoopScope)
+
+			manifest := []byte(fmt.Sprintf(`{
+				"schemaVersion": 2,
+				"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+				"config": {
+					"mediaType": "application/vnd.docker.container.image.v1+json",
+					"size": 10,
+					"digest": "%s"
+				},
+				"layers": [{
+					"mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip",
+					"size": 10,
+					"digest": "%s"
+				}],
+				"annotations": {"%s": "%s"}
+			}`, config, layer, _encryptAtRestAnnotation, test.annotation))
+			d, err := core.NewDigester().FromBytes(manifest)
+			require.NoError(err)
+
+			transferer.EXPECT().Download(repoName, d).Return(store.NewBufferFileReader(manifest), nil)
+
+			_, err = sd.GetContent(contextFixture(), genManifestRevisionLinkPath(repoName, d.Hex()))
+			require.NoError(err)
+			require.Equal(test.expected, transferer.requested)
+		})
+	}
+}
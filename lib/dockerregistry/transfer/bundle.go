@@ -0,0 +1,165 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/tracker/metainfoclient"
+)
+
+// BundleConfig defines downloading the small blobs of images as bundles, which
+// origins build when bundling is enabled.
+type BundleConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MinMissing is the fewest bundled blobs which must be missing locally for
+	// the bundle to be downloaded. Fewer missing blobs are downloaded
+	// individually.
+	MinMissing int `yaml:"min_missing"`
+}
+
+func (c BundleConfig) applyDefaults() BundleConfig {
+	if c.MinMissing == 0 {
+		c.MinMissing = 2
+	}
+	return c
+}
+
+// BundleDownloader is implemented by ImageTransferers which can download the
+// small blobs of an image as a single bundle.
+type BundleDownloader interface {
+	// DownloadBundle downloads the bundled blobs of the image of manifest into
+	// the local cache. No-op if the image is not bundled.
+	DownloadBundle(namespace string, manifest core.Digest) error
+}
+
+// ReadOnlyOption allows setting optional ReadOnlyTransferer parameters.
+type ReadOnlyOption func(*ReadOnlyTransferer)
+
+// WithBundles configures a ReadOnlyTransferer to download the small blobs of
+// images as bundles, which are looked up with client.
+func WithBundles(config BundleConfig, client metainfoclient.BundleClient) ReadOnlyOption {
+	return func(t *ReadOnlyTransferer) {
+		if config.Enabled {
+			t.bundleConfig = config.applyDefaults()
+			t.bundles = client
+		}
+	}
+}
+
+// DownloadBundle downloads the bundle of the image of manifest, and unpacks
+// the blobs it contains into the cache. Bundles are kept in the cache, such
+// that they are seeded to other agents.
+func (t *ReadOnlyTransferer) DownloadBundle(namespace string, manifest core.Digest) error {
+	if t.bundles == nil {
+		return nil
+	}
+	index, err := t.bundles.GetBundle(namespace, manifest)
+	if err == metainfoclient.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("get bundle: %s", err)
+	}
+	var missing int
+	for _, e := range index.Entries {
+		if t.cads.EncryptionRequested(e.Digest.Hex()) {
+			// Bundles are stored in plaintext, so blobs which must be encrypted
+			// at rest are never downloaded as part of one.
+			t.stats.Counter("bundles_skipped").Inc(1)
+			return nil
+		}
+		_, err := t.cads.Cache().GetFileStat(e.Digest.Hex())
+		if os.IsNotExist(err) || t.cads.InDownloadError(err) {
+			missing++
+		} else if err != nil {
+			return fmt.Errorf("stat cache: %s", err)
+		}
+	}
+	if missing < t.bundleConfig.MinMissing {
+		return nil
+	}
+	if err := t.sched.Download(namespace, index.Digest); err != nil {
+		return fmt.Errorf("scheduler: %s", err)
+	}
+	f, err := t.cads.Cache().GetFileReader(index.Digest.Hex())
+	if err != nil {
+		return fmt.Errorf("cache: %s", err)
+	}
+	defer f.Close()
+	entries, err := core.ReadBundleEntries(f)
+	if err != nil {
+		return fmt.Errorf("read bundle entries: %s", err)
+	}
+	var unpacked int64
+	for _, e := range entries {
+		ok, err := unpackBundleEntry(t.cads, f, e)
+		if err != nil {
+			return fmt.Errorf("unpack %s: %s", e.Digest, err)
+		}
+		if ok {
+			unpacked++
+		}
+	}
+	t.stats.Counter("bundles_downloaded").Inc(1)
+	t.stats.Counter("bundled_blobs_unpacked").Inc(unpacked)
+	return nil
+}
+
+// unpackBundleEntry copies the blob of e from bundle into the cache. Blobs
+// which are already cached or being downloaded are skipped. Returns whether
+// the blob was unpacked.
+func unpackBundleEntry(
+	cads *store.CADownloadStore, bundle io.ReaderAt, e core.BundleEntry) (bool, error) {
+
+	name := e.Digest.Hex()
+	if err := cads.CreateDownloadFile(name, e.Length); err != nil {
+		if cads.InDownloadError(err) || cads.InCacheError(err) || os.IsExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("create download file: %s", err)
+	}
+	if err := writeBundleEntry(cads, bundle, e); err != nil {
+		cads.Download().DeleteFile(name)
+		return false, err
+	}
+	if err := cads.MoveDownloadFileToCache(name); err != nil && !os.IsExist(err) {
+		return false, fmt.Errorf("move download file to cache: %s", err)
+	}
+	return true, nil
+}
+
+// writeBundleEntry writes the blob of e to its download file, verifying its
+// digest.
+func writeBundleEntry(cads *store.CADownloadStore, bundle io.ReaderAt, e core.BundleEntry) error {
+	w, err := cads.GetDownloadFileReadWriter(e.Digest.Hex())
+	if err != nil {
+		return fmt.Errorf("get download writer: %s", err)
+	}
+	defer w.Close()
+
+	digester := core.NewDigester()
+	r := digester.Tee(io.NewSectionReader(bundle, e.Offset, e.Length))
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("copy: %s", err)
+	}
+	if d := digester.Digest(); d != e.Digest {
+		return fmt.Errorf("bundled content digest is %s", d)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/tracker/metainfoclient"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// bundleFixture bundles blobs, returning the bundle and its index.
+func bundleFixture(blobs ...*core.BlobFixture) (*core.BlobFixture, *core.BundleIndex) {
+	content := make(map[core.Digest][]byte)
+	var bundled []core.BundleBlob
+	for _, b := range blobs {
+		content[b.Digest] = b.Content
+		bundled = append(bundled, core.BundleBlob{Digest: b.Digest, Length: b.Length()})
+	}
+	var buf bytes.Buffer
+	entries, err := core.WriteBundle(&buf, bundled, func(d core.Digest, dst io.Writer) error {
+		_, err := dst.Write(content[d])
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	d, err := core.NewDigester().FromBytes(buf.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	return &core.BlobFixture{Content: buf.Bytes(), Digest: d}, &core.BundleIndex{Digest: d, Entries: entries}
+}
+
+func (m *agentTransfererMocks) newWithBundles(bundles metainfoclient.BundleClient) *ReadOnlyTransferer {
+	return NewReadOnlyTransferer(
+		tally.NoopScope, m.cads, m.tags, m.sched,
+		WithBundles(BundleConfig{Enabled: true}, bundles))
+}
+
+func requireCached(t *testing.T, cads *store.CADownloadStore, blob *core.BlobFixture) {
+	f, err := cads.Cache().GetFileReader(blob.Digest.Hex())
+	require.NoError(t, err)
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, blob.Content, b)
+}
+
+func TestReadOnlyTransfererDownloadBundleUnpacksBlobs(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadOnlyTransfererMocks(t)
+	defer cleanup()
+
+	bundles := metainfoclient.NewTestClient()
+	transferer := mocks.newWithBundles(bundles)
+
+	namespace := "docker/repo-bar:latest"
+	manifest := core.DigestFixture()
+	blobs := []*core.BlobFixture{
+		core.SizedBlobFixture(16, 4),
+		core.SizedBlobFixture(32, 4),
+		core.SizedBlobFixture(64, 4),
+	}
+	bundle, index := bundleFixture(blobs...)
+	bundles.SetBundle(manifest, index)
+
+	// Cached blobs are left as is.
+	require.NoError(store.RunDownload(mocks.cads, blobs[0].Digest, blobs[0].Content))
+
+	mocks.sched.EXPECT().Download(
+		namespace, bundle.Digest).DoAndReturn(func(namespace string, d core.Digest) error {
+
+		return store.RunDownload(mocks.cads, d, bundle.Content)
+	})
+
+	require.NoError(transferer.DownloadBundle(namespace, manifest))
+
+	for _, blob := range blobs {
+		requireCached(t, mocks.cads, blob)
+	}
+	// Bundles are kept for seeding.
+	requireCached(t, mocks.cads, bundle)
+}
+
+func TestReadOnlyTransfererDownloadBundleSkipsMostlyCachedImages(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadOnlyTransfererMocks(t)
+	defer cleanup()
+
+	bundles := metainfoclient.NewTestClient()
+	transferer := mocks.newWithBundles(bundles)
+
+	manifest := core.DigestFixture()
+	blobs := []*core.BlobFixture{
+		core.SizedBlobFixture(16, 4),
+		core.SizedBlobFixture(32, 4),
+		core.SizedBlobFixture(64, 4),
+	}
+	_, index := bundleFixture(blobs...)
+	bundles.SetBundle(manifest, index)
+
+	for _, blob := range blobs[:2] {
+		require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+	}
+
+	// Only one blob is missing, so no bundle is downloaded.
+	require.NoError(transferer.DownloadBundle("docker/repo-bar:latest", manifest))
+}
+
+func TestReadOnlyTransfererDownloadBundleNoops(t *testing.T) {
+	tests := []struct {
+		desc    string
+		bundles metainfoclient.BundleClient
+	}{
+		{"bundles disabled", nil},
+		{"image not bundled", metainfoclient.NewTestClient()},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newReadOnlyTransfererMocks(t)
+			defer cleanup()
+
+			transferer := NewReadOnlyTransferer(
+				tally.NoopScope, mocks.cads, mocks.tags, mocks.sched,
+				WithBundles(BundleConfig{Enabled: test.bundles != nil}, test.bundles))
+
+			require.NoError(t, transferer.DownloadBundle("docker/repo-bar:latest", core.DigestFixture()))
+		})
+	}
+}
+
+func TestUnpackBundleEntryRejectsCorruptContent(t *testing.T) {
+	require := require.New(t)
+
+	cads, cleanup := store.CADownloadStoreFixture()
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	bundle, index := bundleFixture(blob)
+
+	// Corrupt the last byte of the blob.
+	e := index.Entries[0]
+	bundle.Content[e.Offset+e.Length-1]++
+
+	_, err := unpackBundleEntry(cads, bytes.NewReader(bundle.Content), e)
+	require.Error(err)
+
+	_, err = cads.Any().GetFileStat(blob.Digest.Hex())
+	require.Error(err)
+}
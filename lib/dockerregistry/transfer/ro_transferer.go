@@ -18,14 +18,20 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/uber-go/tally"
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/scheduler"
-	"github.com/uber-go/tally"
+	"github.com/uber/kraken/tracker/metainfoclient"
 )
 
-var _ ImageTransferer = (*ReadOnlyTransferer)(nil)
+var (
+	_ ImageTransferer     = (*ReadOnlyTransferer)(nil)
+	_ EncryptionRequester = (*ReadOnlyTransferer)(nil)
+	_ BundleDownloader    = (*ReadOnlyTransferer)(nil)
+	_ ConsistentTagGetter = (*ReadOnlyTransferer)(nil)
+)
 
 // ReadOnlyTransferer gets and posts manifest to tracker, and transfers blobs as torrent.
 type ReadOnlyTransferer struct {
@@ -33,6 +39,9 @@ type ReadOnlyTransferer struct {
 	cads  *store.CADownloadStore
 	tags  tagclient.Client
 	sched scheduler.Scheduler
+
+	bundleConfig BundleConfig
+	bundles      metainfoclient.BundleClient // Nil if bundles are disabled.
 }
 
 // NewReadOnlyTransferer creates a new ReadOnlyTransferer.
@@ -40,13 +49,18 @@ func NewReadOnlyTransferer(
 	stats tally.Scope,
 	cads *store.CADownloadStore,
 	tags tagclient.Client,
-	sched scheduler.Scheduler) *ReadOnlyTransferer {
+	sched scheduler.Scheduler,
+	opts ...ReadOnlyOption) *ReadOnlyTransferer {
 
 	stats = stats.Tagged(map[string]string{
 		"module": "rotransferer",
 	})
 
-	return &ReadOnlyTransferer{stats, cads, tags, sched}
+	t := &ReadOnlyTransferer{stats: stats, cads: cads, tags: tags, sched: sched}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
 // Stat returns blob info from local cache, and triggers download if the blob is
@@ -84,6 +98,17 @@ func (t *ReadOnlyTransferer) Download(namespace string, d core.Digest) (store.Fi
 	return f, nil
 }
 
+// RequestEncryption marks ds for encryption at rest once downloaded. No-op if
+// the agent does not encrypt blobs.
+func (t *ReadOnlyTransferer) RequestEncryption(namespace string, ds []core.Digest) {
+	names := make([]string, len(ds))
+	for i, d := range ds {
+		names[i] = d.Hex()
+	}
+	t.cads.RequestEncryption(names...)
+	t.stats.Counter("encryption_requests").Inc(int64(len(ds)))
+}
+
 // Upload uploads blobs to a torrent network.
 func (t *ReadOnlyTransferer) Upload(namespace string, d core.Digest, blob store.FileReader) error {
 	return errors.New("unsupported operation")
@@ -91,7 +116,16 @@ func (t *ReadOnlyTransferer) Upload(namespace string, d core.Digest, blob store.
 
 // GetTag gets manifest digest for tag.
 func (t *ReadOnlyTransferer) GetTag(tag string) (core.Digest, error) {
-	d, err := t.tags.Get(tag)
+	return t.getTag(t.tags.Get(tag))
+}
+
+// GetConsistentTag gets manifest digest for tag, observing the put of tag
+// which returned token.
+func (t *ReadOnlyTransferer) GetConsistentTag(tag, token string) (core.Digest, error) {
+	return t.getTag(t.tags.GetConsistent(tag, token))
+}
+
+func (t *ReadOnlyTransferer) getTag(d core.Digest, err error) (core.Digest, error) {
 	if err != nil {
 		if err == tagclient.ErrTagNotFound {
 			t.stats.Counter("tag_not_found").Inc(1)
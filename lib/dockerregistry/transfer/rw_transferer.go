@@ -126,7 +126,16 @@ func (t *ReadWriteTransferer) Upload(
 
 // GetTag returns the manifest digest for tag.
 func (t *ReadWriteTransferer) GetTag(tag string) (core.Digest, error) {
-	d, err := t.tags.Get(tag)
+	return t.getTag(t.tags.Get(tag))
+}
+
+// GetConsistentTag returns the manifest digest for tag, observing the put of
+// tag which returned token.
+func (t *ReadWriteTransferer) GetConsistentTag(tag, token string) (core.Digest, error) {
+	return t.getTag(t.tags.GetConsistent(tag, token))
+}
+
+func (t *ReadWriteTransferer) getTag(d core.Digest, err error) (core.Digest, error) {
 	if err != nil {
 		if err == tagclient.ErrTagNotFound {
 			return core.Digest{}, ErrTagNotFound
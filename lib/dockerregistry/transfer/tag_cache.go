@@ -0,0 +1,331 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"container/list"
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// TagCacheConfig defines TagCachingTransferer configuration.
+type TagCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is the longest a tag resolution is served from the cache. Cached
+	// tags are invalidated by build-index tag events as soon as they change,
+	// so TTL only bounds staleness when events are missed.
+	TTL time.Duration `yaml:"ttl"`
+
+	// MaxSize is the number of tags cached, after which the least recently
+	// used tags are evicted.
+	MaxSize int `yaml:"max_size"`
+
+	// RetryInterval is the interval at which dropped event streams are
+	// reconnected.
+	RetryInterval time.Duration `yaml:"retry_interval"`
+}
+
+func (c *TagCacheConfig) applyDefaults() {
+	if c.TTL == 0 {
+		c.TTL = 5 * time.Minute
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = 10000
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = 5 * time.Second
+	}
+}
+
+type tagCacheEntry struct {
+	tag      string
+	digest   core.Digest
+	cachedAt time.Time
+}
+
+// tagFetch tracks build-index lookups in flight for a tag. version is bumped
+// whenever the tag changes, such that lookups which started earlier do not
+// cache a digest which may already be stale.
+type tagFetch struct {
+	version  uint64
+	inflight int
+}
+
+// TagCachingTransferer wraps an ImageTransferer and caches tag resolutions,
+// such that manifest GETs by tag do not hit build-index every time. Manifests
+// themselves are content addressed, so once a tag resolves to a digest, the
+// manifest is served from the local cache of the wrapped transferer.
+type TagCachingTransferer struct {
+	ImageTransferer
+
+	config TagCacheConfig
+	stats  tally.Scope
+	clk    clock.Clock
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	fetches map[string]*tagFetch
+}
+
+// NewTagCachingTransferer creates a new TagCachingTransferer which wraps t.
+func NewTagCachingTransferer(
+	config TagCacheConfig,
+	stats tally.Scope,
+	t ImageTransferer,
+	clk clock.Clock) *TagCachingTransferer {
+
+	config.applyDefaults()
+
+	stats = stats.Tagged(map[string]string{
+		"module": "tagcache",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &TagCachingTransferer{
+		ImageTransferer: t,
+		config:          config,
+		stats:           stats,
+		clk:             clk,
+		ctx:             ctx,
+		cancel:          cancel,
+		lru:             list.New(),
+		entries:         make(map[string]*list.Element),
+		fetches:         make(map[string]*tagFetch),
+	}
+}
+
+// Close stops all event subscriptions.
+func (t *TagCachingTransferer) Close() {
+	t.cancel()
+}
+
+// GetTag returns the manifest digest for tag, from the cache if possible.
+// Missing tags are not cached, such that pushes are visible immediately. If
+// the tag changes while build-index is queried, the result is returned but
+// not cached.
+func (t *TagCachingTransferer) GetTag(tag string) (core.Digest, error) {
+	if d, ok := t.get(tag); ok {
+		t.stats.Counter("hits").Inc(1)
+		return d, nil
+	}
+	t.stats.Counter("misses").Inc(1)
+	version := t.startFetch(tag)
+	d, err := t.ImageTransferer.GetTag(tag)
+	if err != nil {
+		t.finishFetch(tag, version, nil)
+		return core.Digest{}, err
+	}
+	t.finishFetch(tag, version, &d)
+	return d, nil
+}
+
+// GetConsistentTag returns the manifest digest for tag, observing the put of
+// tag which returned token. The cache may predate the put, so it is bypassed.
+// Falls back to GetTag if the wrapped transferer cannot present tokens.
+func (t *TagCachingTransferer) GetConsistentTag(tag, token string) (core.Digest, error) {
+	c, ok := t.ImageTransferer.(ConsistentTagGetter)
+	if !ok {
+		return t.GetTag(tag)
+	}
+	t.stats.Counter("consistent_bypasses").Inc(1)
+	return c.GetConsistentTag(tag, token)
+}
+
+// PutTag uploads d as the manifest digest for tag, and caches it on success.
+func (t *TagCachingTransferer) PutTag(tag string, d core.Digest) error {
+	if err := t.ImageTransferer.PutTag(tag, d); err != nil {
+		t.invalidate(tag)
+		return err
+	}
+	t.set(tag, d)
+	return nil
+}
+
+// Subscribe streams tag events from every build-index instance in hosts, and
+// applies them to the cache. Dropped streams are reconnected every
+// RetryInterval until Close is called. Since events may have been missed
+// while a stream was down, the cache is cleared whenever a stream connects.
+func (t *TagCachingTransferer) Subscribe(hosts hostlist.List, config *tls.Config) {
+	for addr := range hosts.Resolve() {
+		go t.subscribe(addr, config)
+	}
+}
+
+func (t *TagCachingTransferer) subscribe(addr string, config *tls.Config) {
+	for {
+		err := tagclient.StreamEvents(t.ctx, addr, config, "", t.clear, t.apply)
+		if t.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.With("addr", addr).Errorf("Error streaming tag events: %s", err)
+		}
+		t.stats.Counter("event_stream_disconnects").Inc(1)
+		select {
+		case <-t.clk.After(t.config.RetryInterval):
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// apply updates the cached digest of the tag of e, or evicts it if the tag was
+// deleted. Events which carry the cached digest leave the entry untouched.
+// Lookups of e's tag in flight are made stale.
+func (t *TagCachingTransferer) apply(e tagmodels.TagEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.bump(e.Tag)
+	el, ok := t.entries[e.Tag]
+	if !ok {
+		return
+	}
+	if e.Type == tagmodels.TagDeleted {
+		t.remove(el)
+		t.stats.Counter("invalidations").Inc(1)
+		return
+	}
+	entry := el.Value.(*tagCacheEntry)
+	if entry.digest == e.Digest {
+		return
+	}
+	entry.digest = e.Digest
+	entry.cachedAt = t.clk.Now()
+	t.stats.Counter("invalidations").Inc(1)
+}
+
+func (t *TagCachingTransferer) get(tag string) (core.Digest, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	el, ok := t.entries[tag]
+	if !ok {
+		return core.Digest{}, false
+	}
+	entry := el.Value.(*tagCacheEntry)
+	if t.clk.Now().Sub(entry.cachedAt) >= t.config.TTL {
+		t.remove(el)
+		return core.Digest{}, false
+	}
+	t.lru.MoveToFront(el)
+	return entry.digest, true
+}
+
+func (t *TagCachingTransferer) set(tag string, d core.Digest) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.bump(tag)
+	t.add(tag, d)
+}
+
+// startFetch registers a build-index lookup of tag, and returns the version
+// to pass to finishFetch.
+func (t *TagCachingTransferer) startFetch(tag string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.fetches[tag]
+	if !ok {
+		f = &tagFetch{}
+		t.fetches[tag] = f
+	}
+	f.inflight++
+	return f.version
+}
+
+// finishFetch unregisters a build-index lookup of tag, and caches d if set
+// and the tag has not changed since version.
+func (t *TagCachingTransferer) finishFetch(tag string, version uint64, d *core.Digest) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f := t.fetches[tag]
+	f.inflight--
+	if f.inflight == 0 {
+		delete(t.fetches, tag)
+	}
+	if d == nil {
+		return
+	}
+	if f.version != version {
+		t.stats.Counter("stale_fetches").Inc(1)
+		return
+	}
+	t.add(tag, *d)
+}
+
+// bump makes lookups of tag in flight stale. Must be called with t.mu held.
+func (t *TagCachingTransferer) bump(tag string) {
+	if f, ok := t.fetches[tag]; ok {
+		f.version++
+	}
+}
+
+// add must be called with t.mu held.
+func (t *TagCachingTransferer) add(tag string, d core.Digest) {
+	if el, ok := t.entries[tag]; ok {
+		t.remove(el)
+	}
+	t.entries[tag] = t.lru.PushFront(&tagCacheEntry{tag, d, t.clk.Now()})
+	for t.lru.Len() > t.config.MaxSize {
+		t.remove(t.lru.Back())
+	}
+}
+
+func (t *TagCachingTransferer) invalidate(tag string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.bump(tag)
+	if el, ok := t.entries[tag]; ok {
+		t.remove(el)
+	}
+}
+
+func (t *TagCachingTransferer) clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for tag := range t.fetches {
+		t.bump(tag)
+	}
+
+	t.lru.Init()
+	t.entries = make(map[string]*list.Element)
+}
+
+// remove must be called with t.mu held.
+func (t *TagCachingTransferer) remove(el *list.Element) {
+	t.lru.Remove(el)
+	delete(t.entries, el.Value.(*tagCacheEntry).tag)
+}
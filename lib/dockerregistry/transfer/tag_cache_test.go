@@ -0,0 +1,308 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/mocks/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type tagCacheMocks struct {
+	underlying *mocktransfer.MockImageTransferer
+	clk        *clock.Mock
+}
+
+func newTagCacheMocks(t *testing.T) (*tagCacheMocks, func()) {
+	var cleanup testutil.Cleanup
+
+	ctrl := gomock.NewController(t)
+	cleanup.Add(ctrl.Finish)
+
+	return &tagCacheMocks{mocktransfer.NewMockImageTransferer(ctrl), clock.NewMock()}, cleanup.Run
+}
+
+func (m *tagCacheMocks) new(config TagCacheConfig) *TagCachingTransferer {
+	return NewTagCachingTransferer(config, tally.NoopScope, m.underlying, m.clk)
+}
+
+func TestTagCachingTransfererCachesTagsUntilTTL(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTagCacheMocks(t)
+	defer cleanup()
+
+	tc := mocks.new(TagCacheConfig{TTL: time.Minute})
+	defer tc.Close()
+
+	tag := "repo:tag"
+	d := core.DigestFixture()
+
+	mocks.underlying.EXPECT().GetTag(tag).Return(d, nil).Times(2)
+
+	for i := 0; i < 3; i++ {
+		result, err := tc.GetTag(tag)
+		require.NoError(err)
+		require.Equal(d, result)
+	}
+
+	mocks.clk.Add(time.Minute)
+
+	result, err := tc.GetTag(tag)
+	require.NoError(err)
+	require.Equal(d, result)
+}
+
+// consistentTransferer resolves consistent gets from a fixed map of tokens.
+type consistentTransferer struct {
+	*mocktransfer.MockImageTransferer
+	tags map[string]core.Digest
+}
+
+func (t consistentTransferer) GetConsistentTag(tag, token string) (core.Digest, error) {
+	return t.tags[tag+"@"+token], nil
+}
+
+func TestTagCachingTransfererBypassesCacheForConsistentGets(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTagCacheMocks(t)
+	defer cleanup()
+
+	tag := "repo:tag"
+	stale := core.DigestFixture()
+	pushed := core.DigestFixture()
+
+	tc := NewTagCachingTransferer(TagCacheConfig{}, tally.NoopScope, consistentTransferer{
+		mocks.underlying, map[string]core.Digest{tag + "@some-token": pushed},
+	}, mocks.clk)
+	defer tc.Close()
+
+	mocks.underlying.EXPECT().GetTag(tag).Return(stale, nil)
+
+	result, err := tc.GetTag(tag)
+	require.NoError(err)
+	require.Equal(stale, result)
+
+	result, err = tc.GetConsistentTag(tag, "some-token")
+	require.NoError(err)
+	require.Equal(pushed, result)
+}
+
+func TestTagCachingTransfererDoesNotCacheMissingTags(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTagCacheMocks(t)
+	defer cleanup()
+
+	tc := mocks.new(TagCacheConfig{})
+	defer tc.Close()
+
+	tag := "repo:tag"
+
+	mocks.underlying.EXPECT().GetTag(tag).Return(core.Digest{}, ErrTagNotFound).Times(2)
+
+	for i := 0; i < 2; i++ {
+		_, err := tc.GetTag(tag)
+		require.Equal(ErrTagNotFound, err)
+	}
+}
+
+func TestTagCachingTransfererPutTagUpdatesCache(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTagCacheMocks(t)
+	defer cleanup()
+
+	tc := mocks.new(TagCacheConfig{})
+	defer tc.Close()
+
+	tag := "repo:tag"
+	d := core.DigestFixture()
+
+	mocks.underlying.EXPECT().PutTag(tag, d).Return(nil)
+
+	require.NoError(tc.PutTag(tag, d))
+
+	result, err := tc.GetTag(tag)
+	require.NoError(err)
+	require.Equal(d, result)
+}
+
+func TestTagCachingTransfererEvictsLeastRecentlyUsed(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTagCacheMocks(t)
+	defer cleanup()
+
+	tc := mocks.new(TagCacheConfig{MaxSize: 2})
+	defer tc.Close()
+
+	d := core.DigestFixture()
+	for _, tag := range []string{"repo:a", "repo:b", "repo:c"} {
+		mocks.underlying.EXPECT().GetTag(tag).Return(d, nil)
+		_, err := tc.GetTag(tag)
+		require.NoError(err)
+	}
+
+	mocks.underlying.EXPECT().GetTag("repo:a").Return(d, nil)
+
+	for _, tag := range []string{"repo:b", "repo:c", "repo:a"} {
+		_, err := tc.GetTag(tag)
+		require.NoError(err)
+	}
+}
+
+func TestTagCachingTransfererAppliesTagEvents(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTagCacheMocks(t)
+	defer cleanup()
+
+	tc := mocks.new(TagCacheConfig{})
+	defer tc.Close()
+
+	tag := "repo:tag"
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	mocks.underlying.EXPECT().GetTag(tag).Return(d1, nil)
+
+	result, err := tc.GetTag(tag)
+	require.NoError(err)
+	require.Equal(d1, result)
+
+	// Events carrying the cached digest are no-ops.
+	tc.apply(tagmodels.TagEvent{Type: tagmodels.TagUpdated, Tag: tag, Digest: d1})
+	tc.apply(tagmodels.TagEvent{Type: tagmodels.TagUpdated, Tag: tag, Digest: d2})
+
+	result, err = tc.GetTag(tag)
+	require.NoError(err)
+	require.Equal(d2, result)
+}
+
+func TestTagCachingTransfererEvictsDeletedTags(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTagCacheMocks(t)
+	defer cleanup()
+
+	tc := mocks.new(TagCacheConfig{})
+	defer tc.Close()
+
+	tag := "repo:tag"
+
+	gomock.InOrder(
+		mocks.underlying.EXPECT().GetTag(tag).Return(core.DigestFixture(), nil),
+		mocks.underlying.EXPECT().GetTag(tag).Return(core.Digest{}, ErrTagNotFound),
+	)
+
+	_, err := tc.GetTag(tag)
+	require.NoError(err)
+
+	tc.apply(tagmodels.TagEvent{Type: tagmodels.TagDeleted, Tag: tag})
+
+	_, err = tc.GetTag(tag)
+	require.Equal(ErrTagNotFound, err)
+}
+
+func TestTagCachingTransfererDoesNotCacheStaleFetches(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTagCacheMocks(t)
+	defer cleanup()
+
+	tc := mocks.new(TagCacheConfig{})
+	defer tc.Close()
+
+	tag := "repo:tag"
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	// The tag is updated while the miss is being fetched.
+	mocks.underlying.EXPECT().GetTag(tag).DoAndReturn(func(string) (core.Digest, error) {
+		tc.apply(tagmodels.TagEvent{Type: tagmodels.TagUpdated, Tag: tag, Digest: d2})
+		return d1, nil
+	})
+	mocks.underlying.EXPECT().GetTag(tag).Return(d2, nil)
+
+	result, err := tc.GetTag(tag)
+	require.NoError(err)
+	require.Equal(d1, result)
+
+	result, err = tc.GetTag(tag)
+	require.NoError(err)
+	require.Equal(d2, result)
+}
+
+func TestTagCachingTransfererSubscribesToTagEvents(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTagCacheMocks(t)
+	defer cleanup()
+
+	tc := mocks.new(TagCacheConfig{})
+	defer tc.Close()
+
+	tag := "repo:tag"
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	events := make(chan tagmodels.TagEvent, 100)
+	addr, stop := testutil.StartServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case e := <-events:
+					b, _ := json.Marshal(e)
+					fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}))
+	defer stop()
+
+	// The cache is cleared once the stream connects, so the tag may be
+	// resolved more than once.
+	mocks.underlying.EXPECT().GetTag(tag).Return(d1, nil).AnyTimes()
+
+	tc.Subscribe(hostlist.Fixture(addr), nil)
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		result, err := tc.GetTag(tag)
+		require.NoError(err)
+		if result == d2 {
+			return true
+		}
+		events <- tagmodels.TagEvent{Type: tagmodels.TagUpdated, Tag: tag, Digest: d2}
+		return false
+	}))
+}
@@ -28,3 +28,20 @@ type ImageTransferer interface {
 	PutTag(tag string, d core.Digest) error
 	ListTags(prefix string) ([]string, error)
 }
+
+// EncryptionRequester is implemented by ImageTransferers which can encrypt
+// blobs at rest, such that images can opt in via manifest annotations.
+type EncryptionRequester interface {
+	// RequestEncryption requests encryption at rest of blobs ds, which are
+	// about to be downloaded under namespace.
+	RequestEncryption(namespace string, ds []core.Digest)
+}
+
+// ConsistentTagGetter is implemented by ImageTransferers which can resolve
+// tags presenting consistency tokens, such that clients which pushed a tag
+// observe their push.
+type ConsistentTagGetter interface {
+	// GetConsistentTag returns the manifest digest for tag, observing the put
+	// of tag which returned token.
+	GetConsistentTag(tag, token string) (core.Digest, error)
+}
@@ -25,6 +25,13 @@ type Config struct {
 	// RefreshInterval is the interval at which membership / health information
 	// is refreshed during monitoring.
 	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	// FailureDomainRollout is the percent of blobs, bucketed by digest, whose
+	// owners are spread across failure domains when failure domains are
+	// known. Spreading changes the owners of most blobs, so raising it in
+	// steps bounds how many blobs are re-replicated at once. Defaults to 0,
+	// i.e. owners ignore failure domains.
+	FailureDomainRollout int `yaml:"failure_domain_rollout"`
 }
 
 func (c *Config) applyDefaults() {
@@ -34,4 +41,7 @@ func (c *Config) applyDefaults() {
 	if c.RefreshInterval == 0 {
 		c.RefreshInterval = 10 * time.Second
 	}
+	if c.FailureDomainRollout > 100 {
+		c.FailureDomainRollout = 100
+	}
 }
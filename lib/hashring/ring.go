@@ -15,6 +15,7 @@ package hashring
 
 import (
 	"log"
+	"strconv"
 	"sync"
 	"time"
 
@@ -61,6 +62,10 @@ type ring struct {
 	healthy stringset.Set
 
 	watchers []Watcher
+
+	// domain returns the failure domain of an address. Nil if replica sets
+	// ignore failure domains.
+	domain func(addr string) string
 }
 
 // Option allows setting custom parameters for ring.
@@ -71,6 +76,16 @@ func WithWatcher(w Watcher) Option {
 	return func(r *ring) { r.watchers = append(r.watchers, w) }
 }
 
+// WithFailureDomains spreads the replica set of each digest across as many
+// failure domains, e.g. racks, as possible. domain returns the failure domain
+// of an address, or "" if unknown, in which case the address is treated as a
+// failure domain of its own. Only digests within Config.FailureDomainRollout
+// are spread. Note, all parties computing locations must agree on failure
+// domains and rollout, since they change which addresses own each digest.
+func WithFailureDomains(domain func(addr string) string) Option {
+	return func(r *ring) { r.domain = domain }
+}
+
 // New creates a new Ring whose members are defined by cluster.
 func New(
 	config Config, cluster hostlist.List, filter healthcheck.Filter, opts ...Option) Ring {
@@ -103,13 +118,21 @@ func (r *ring) Locations(d core.Digest) []string {
 		log.Fatal("invariant violation: ordered hash nodes not equal to cluster size")
 	}
 
+	addrs := make([]string, len(nodes))
+	for i, n := range nodes {
+		addrs[i] = n.Label
+	}
+	if r.spread(d) {
+		addrs = r.place(addrs)
+	}
+
 	if len(r.healthy) == 0 {
-		return []string{nodes[0].Label}
+		return []string{addrs[0]}
 	}
 
 	var locs []string
-	for i := 0; i < len(nodes) && (len(locs) == 0 || i < r.config.MaxReplica); i++ {
-		addr := nodes[i].Label
+	for i := 0; i < len(addrs) && (len(locs) == 0 || i < r.config.MaxReplica); i++ {
+		addr := addrs[i]
 		if r.healthy.Has(addr) {
 			locs = append(locs, addr)
 		}
@@ -117,6 +140,42 @@ func (r *ring) Locations(d core.Digest) []string {
 	return locs
 }
 
+// spread returns whether the replica set of d is spread across failure domains.
+// Digests are bucketed by shard, such that raising the rollout only moves the
+// owners of the digests in the newly included buckets.
+func (r *ring) spread(d core.Digest) bool {
+	if r.domain == nil || r.config.FailureDomainRollout <= 0 {
+		return false
+	}
+	shard, err := strconv.ParseUint(d.ShardID(), 16, 64)
+	if err != nil {
+		return false
+	}
+	return int(shard%100) < r.config.FailureDomainRollout
+}
+
+// place reorders addrs, which are ordered by rank, such that the first
+// MaxReplica addresses span as many failure domains as possible. Addresses
+// sharing a failure domain with a higher ranked address are deferred, and rank
+// order is preserved otherwise.
+func (r *ring) place(addrs []string) []string {
+	owners := make([]string, 0, r.config.MaxReplica)
+	var deferred []string
+	domains := make(map[string]bool)
+	for _, addr := range addrs {
+		d := r.domain(addr)
+		if len(owners) < r.config.MaxReplica && (d == "" || !domains[d]) {
+			if d != "" {
+				domains[d] = true
+			}
+			owners = append(owners, addr)
+		} else {
+			deferred = append(deferred, addr)
+		}
+	}
+	return append(owners, deferred...)
+}
+
 // Contains returns whether the ring contains addr.
 func (r *ring) Contains(addr string) bool {
 	r.mu.RLock()
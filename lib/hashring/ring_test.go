@@ -14,6 +14,7 @@
 package hashring
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -166,6 +167,80 @@ func TestRingLocationsReturnsFirstHostWhenAllHostsUnhealthy(t *testing.T) {
 	}
 }
 
+func TestRingLocationsSpreadsAcrossFailureDomains(t *testing.T) {
+	tests := []struct {
+		desc            string
+		racks           int
+		expectedDomains int
+	}{
+		{"enough racks", 3, 3},
+		{"too few racks", 2, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			addrs := addrsFixture(12)
+			racks := make(map[string]string)
+			for i, addr := range addrs {
+				racks[addr] = fmt.Sprintf("rack%d", i%test.racks)
+			}
+
+			r := New(
+				Config{MaxReplica: 3, FailureDomainRollout: 100},
+				hostlist.Fixture(addrs...),
+				healthcheck.IdentityFilter{},
+				WithFailureDomains(func(addr string) string { return racks[addr] }))
+
+			for i := 0; i < 100; i++ {
+				locs := r.Locations(core.DigestFixture())
+				require.Len(locs, 3)
+				domains := make(map[string]bool)
+				for _, addr := range locs {
+					domains[racks[addr]] = true
+				}
+				require.Len(domains, test.expectedDomains)
+			}
+		})
+	}
+}
+
+func TestRingLocationsFailureDomainRollout(t *testing.T) {
+	require := require.New(t)
+
+	addrs := addrsFixture(12)
+	racks := make(map[string]string)
+	for i, addr := range addrs {
+		racks[addr] = fmt.Sprintf("rack%d", i%3)
+	}
+	domain := func(addr string) string { return racks[addr] }
+
+	plain := New(Config{MaxReplica: 3}, hostlist.Fixture(addrs...), healthcheck.IdentityFilter{})
+	half := New(
+		Config{MaxReplica: 3, FailureDomainRollout: 50},
+		hostlist.Fixture(addrs...),
+		healthcheck.IdentityFilter{},
+		WithFailureDomains(domain))
+	full := New(
+		Config{MaxReplica: 3, FailureDomainRollout: 100},
+		hostlist.Fixture(addrs...),
+		healthcheck.IdentityFilter{},
+		WithFailureDomains(domain))
+
+	// Digests are either kept in place or spread as in a full rollout.
+	var spread int
+	for i := 0; i < 1000; i++ {
+		d := core.DigestFixture()
+		if half.(*ring).spread(d) {
+			require.Equal(full.Locations(d), half.Locations(d))
+			spread++
+		} else {
+			require.Equal(plain.Locations(d), half.Locations(d))
+		}
+	}
+	require.True(spread > 0 && spread < 1000)
+}
+
 func TestRingContains(t *testing.T) {
 	require := require.New(t)
 
@@ -0,0 +1,96 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package kms
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// ErrNotConfigured is returned when neither a KMS address nor a key file is
+// configured.
+var ErrNotConfigured = errors.New("kms not configured")
+
+// DataKeyResponse is the response body of a data key request.
+type DataKeyResponse struct {
+	// Key is the base64 encoded data key.
+	Key string `json:"key"`
+}
+
+// Client fetches data keys.
+type Client interface {
+	GetDataKey(host string) ([]byte, error)
+}
+
+type client struct {
+	config Config
+	tls    *tls.Config
+}
+
+// NewClient returns a new Client. Data keys are only requested from the KMS
+// over TLS, so tls is required if the client is configured with an Addr.
+func NewClient(config Config, tls *tls.Config) (Client, error) {
+	if config.KeyFile == "" && config.Addr != "" && tls == nil {
+		return nil, errors.New("kms addr requires client tls")
+	}
+	return &client{config.applyDefaults(), tls}, nil
+}
+
+// GetDataKey returns the data key of host. Keys are read from the configured
+// key file if present, else requested from the KMS.
+func (c *client) GetDataKey(host string) ([]byte, error) {
+	if c.config.KeyFile != "" {
+		b, err := ioutil.ReadFile(c.config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read key file: %s", err)
+		}
+		return decodeKey(strings.TrimSpace(string(b)))
+	}
+	if c.config.Addr == "" {
+		return nil, ErrNotConfigured
+	}
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/hosts/%s/data_key", c.config.Addr, url.PathEscape(host)),
+		httputil.SendTimeout(c.config.Timeout),
+		httputil.SendTLS(c.tls),
+		httputil.DisableHTTPFallback())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var r DataKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("decode response: %s", err)
+	}
+	return decodeKey(r.Key)
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %s", err)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("empty key")
+	}
+	return key, nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package kms
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/randutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientGetDataKeyFromAddr(t *testing.T) {
+	require := require.New(t)
+
+	key := randutil.Blob(32)
+
+	r := chi.NewRouter()
+	r.Get("/hosts/{host}/data_key", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "host") != "host-a" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(DataKeyResponse{base64.StdEncoding.EncodeToString(key)})
+	})
+	server := httptest.NewTLSServer(r)
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	c, err := NewClient(
+		Config{Addr: strings.TrimPrefix(server.URL, "https://")},
+		&tls.Config{RootCAs: roots})
+	require.NoError(err)
+
+	result, err := c.GetDataKey("host-a")
+	require.NoError(err)
+	require.Equal(key, result)
+
+	_, err = c.GetDataKey("host-b")
+	require.True(httputil.IsNotFound(err))
+}
+
+func TestClientGetDataKeyFromFile(t *testing.T) {
+	require := require.New(t)
+
+	key := randutil.Blob(32)
+
+	name, cleanup := testutil.TempFile([]byte(base64.StdEncoding.EncodeToString(key) + "\n"))
+	defer cleanup()
+
+	c, err := NewClient(Config{KeyFile: name}, nil)
+	require.NoError(err)
+
+	result, err := c.GetDataKey("host-a")
+	require.NoError(err)
+	require.Equal(key, result)
+}
+
+func TestClientGetDataKeyNotConfigured(t *testing.T) {
+	require := require.New(t)
+
+	c, err := NewClient(Config{}, nil)
+	require.NoError(err)
+
+	_, err = c.GetDataKey("host-a")
+	require.Equal(ErrNotConfigured, err)
+}
+
+func TestNewClientRequiresTLSForAddr(t *testing.T) {
+	_, err := NewClient(Config{Addr: "kms:443"}, nil)
+	require.Error(t, err)
+}
+
+func TestClientGetDataKeyDoesNotFallBackToHTTP(t *testing.T) {
+	require := require.New(t)
+
+	r := chi.NewRouter()
+	r.Get("/hosts/{host}/data_key", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(DataKeyResponse{base64.StdEncoding.EncodeToString(randutil.Blob(32))})
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	c, err := NewClient(Config{Addr: addr}, &tls.Config{})
+	require.NoError(err)
+
+	_, err = c.GetDataKey("host-a")
+	require.Error(err)
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package kms
+
+import "time"
+
+// Config defines where agents fetch data keys for encryption at rest.
+type Config struct {
+	// Addr is the address of a KMS which serves per-host data keys.
+	Addr string `yaml:"addr"`
+
+	// KeyFile is the path of a file containing a base64 encoded data key,
+	// used instead of Addr, e.g. when keys are provisioned by a sidecar.
+	KeyFile string `yaml:"key_file"`
+
+	// Timeout bounds requests to Addr.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
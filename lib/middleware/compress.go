@@ -0,0 +1,287 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/klauspost/compress/zstd"
+	"github.com/uber-go/tally"
+)
+
+// Supported response encodings.
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// CompressConfig defines response compression.
+type CompressConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MinSize is the smallest response body which is compressed, since
+	// compressing tiny bodies costs more cpu and framing than it saves.
+	MinSize datasize.ByteSize `yaml:"min_size"`
+
+	// Encodings lists the encodings responses may be compressed with, in
+	// order of preference. Each response is compressed with the most
+	// preferred encoding the client accepts.
+	Encodings []string `yaml:"encodings"`
+}
+
+func (c CompressConfig) applyDefaults() CompressConfig {
+	if c.MinSize == 0 {
+		c.MinSize = datasize.KB
+	}
+	if len(c.Encodings) == 0 {
+		c.Encodings = []string{EncodingZstd, EncodingGzip}
+	}
+	return c
+}
+
+// encoder is implemented by both gzip and zstd writers.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var _encoders = map[string]*sync.Pool{
+	EncodingGzip: {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	EncodingZstd: {New: func() interface{} {
+		// Only fails on invalid options.
+		e, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return e
+	}},
+}
+
+// Compress compresses response bodies of at least MinSize with the most
+// preferred encoding the client accepts, as negotiated via Accept-Encoding.
+// Compress is intended for JSON endpoints: responses whose content type is set
+// to anything but JSON, e.g. bencoded announce responses or event streams, are
+// never compressed.
+func Compress(config CompressConfig, stats tally.Scope) func(next http.Handler) http.Handler {
+	config = config.applyDefaults()
+	return func(next http.Handler) http.Handler {
+		if !config.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(config.Encodings, r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minSize:        int(config.MinSize),
+				stats:          stats,
+				status:         http.StatusOK,
+			}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the first of preferred which the Accept-Encoding
+// header accepts, or "" if none is accepted.
+func negotiateEncoding(preferred []string, header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+		ok := true
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if !strings.HasPrefix(p, "q=") {
+				continue
+			}
+			q, err := strconv.ParseFloat(p[2:], 64)
+			ok = err == nil && q > 0
+		}
+		accepted[coding] = ok
+	}
+	for _, e := range preferred {
+		if _, ok := _encoders[e]; !ok {
+			continue
+		}
+		if ok, explicit := accepted[e]; explicit {
+			if ok {
+				return e
+			}
+			continue
+		}
+		if accepted["*"] {
+			return e
+		}
+	}
+	return ""
+}
+
+// compressWriter buffers the response body until it reaches minSize, and then
+// decides whether to compress it. Bodies which never reach minSize are written
+// uncompressed once the handler returns.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	stats    tally.Scope
+
+	status      int
+	wroteHeader bool
+	buf         []byte
+
+	// started is set once the header was written to the underlying writer.
+	started bool
+	enc     encoder // Nil unless compressing.
+	in      int64
+	out     countingWriter
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.started {
+		return w.write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) < w.minSize {
+		return len(b), nil
+	}
+	if err := w.start(w.compressible()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush implements http.Flusher. Streamed bodies are compressed regardless of
+// their size, since the size is not known upfront.
+func (w *compressWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+	if !w.started {
+		if err := w.start(w.compressible()); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// compressible returns whether the response may be compressed.
+func (w *compressWriter) compressible() bool {
+	if w.status < http.StatusOK ||
+		w.status == http.StatusNoContent ||
+		w.status == http.StatusNotModified {
+		return false
+	}
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	// Only json is compressed, so responses must declare their content type.
+	mt, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// start writes the header and the buffered body to the underlying writer,
+// compressing the body if compress is set.
+func (w *compressWriter) start(compress bool) error {
+	w.started = true
+	if compress {
+		h := w.Header()
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		w.out = countingWriter{w: w.ResponseWriter}
+		w.enc = _encoders[w.encoding].Get().(encoder)
+		w.enc.Reset(&w.out)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.write(buf)
+	return err
+}
+
+func (w *compressWriter) write(b []byte) (int, error) {
+	if w.enc == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	w.in += int64(len(b))
+	return w.enc.Write(b)
+}
+
+// close writes any body still buffered uncompressed, or finishes compression.
+func (w *compressWriter) close() {
+	if !w.started {
+		if w.wroteHeader {
+			w.start(false)
+		}
+		return
+	}
+	if w.enc == nil {
+		return
+	}
+	w.enc.Close()
+	_encoders[w.encoding].Put(w.enc)
+	w.enc = nil
+
+	scope := w.stats.Tagged(map[string]string{"encoding": w.encoding})
+	scope.Counter("compressed_responses").Inc(1)
+	scope.Counter("compression_input_bytes").Inc(w.in)
+	scope.Counter("compression_output_bytes").Inc(w.out.n)
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func serveCompressed(
+	config CompressConfig,
+	acceptEncoding string,
+	h http.HandlerFunc) *httptest.ResponseRecorder {
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if acceptEncoding != "" {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	Compress(config, tally.NoopScope)(h).ServeHTTP(w, r)
+	return w
+}
+
+func jsonHandler(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}
+}
+
+func decode(t *testing.T, encoding string, b []byte) string {
+	switch encoding {
+	case EncodingGzip:
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		require.NoError(t, err)
+		out, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		return string(out)
+	case EncodingZstd:
+		r, err := zstd.NewReader(nil)
+		require.NoError(t, err)
+		defer r.Close()
+		out, err := r.DecodeAll(b, nil)
+		require.NoError(t, err)
+		return string(out)
+	}
+	return string(b)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	preferred := []string{EncodingZstd, EncodingGzip}
+
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"", ""},
+		{"gzip", EncodingGzip},
+		{"gzip, deflate, br", EncodingGzip},
+		{"gzip, zstd", EncodingZstd},
+		{"GZIP;q=0.5", EncodingGzip},
+		{"zstd;q=0, gzip", EncodingGzip},
+		{"zstd;q=0.0, gzip;q=0", ""},
+		{"*", EncodingZstd},
+		{"*, zstd;q=0", EncodingGzip},
+		{"identity", ""},
+		{"br", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			require.Equal(t, test.expected, negotiateEncoding(preferred, test.header))
+		})
+	}
+}
+
+func TestNegotiateEncodingIgnoresUnsupportedPreferences(t *testing.T) {
+	require.Equal(t, EncodingGzip, negotiateEncoding([]string{"br", EncodingGzip}, "br, gzip"))
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat(`{"peer": "a"}`, 200)
+
+	for _, encoding := range []string{EncodingZstd, EncodingGzip} {
+		t.Run(encoding, func(t *testing.T) {
+			require := require.New(t)
+
+			w := serveCompressed(CompressConfig{Enabled: true}, encoding, jsonHandler(body))
+
+			require.Equal(http.StatusOK, w.Code)
+			require.Equal(encoding, w.Header().Get("Content-Encoding"))
+			require.Equal("Accept-Encoding", w.Header().Get("Vary"))
+			require.Equal("application/json", w.Header().Get("Content-Type"))
+			require.True(w.Body.Len() < len(body))
+			require.Equal(body, decode(t, encoding, w.Body.Bytes()))
+		})
+	}
+}
+
+func TestCompressSkipsSmallBodies(t *testing.T) {
+	require := require.New(t)
+
+	w := serveCompressed(CompressConfig{Enabled: true}, "gzip", jsonHandler(`{"peer": "a"}`))
+
+	require.Empty(w.Header().Get("Content-Encoding"))
+	require.Equal(`{"peer": "a"}`, w.Body.String())
+}
+
+func TestCompressSkipsNonJSON(t *testing.T) {
+	require := require.New(t)
+
+	body := strings.Repeat("d8:intervali3ee", 200)
+
+	w := serveCompressed(CompressConfig{Enabled: true}, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	})
+
+	require.Empty(w.Header().Get("Content-Encoding"))
+	require.Equal(body, w.Body.String())
+}
+
+func TestCompressDisabled(t *testing.T) {
+	require := require.New(t)
+
+	body := strings.Repeat(`{"peer": "a"}`, 200)
+
+	w := serveCompressed(CompressConfig{}, "gzip", jsonHandler(body))
+
+	require.Empty(w.Header().Get("Content-Encoding"))
+	require.Empty(w.Header().Get("Vary"))
+	require.Equal(body, w.Body.String())
+}
+
+func TestCompressPreservesStatus(t *testing.T) {
+	require := require.New(t)
+
+	body := strings.Repeat(`{"error": "a"}`, 200)
+
+	w := serveCompressed(CompressConfig{Enabled: true}, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(body))
+	})
+	require.Equal(http.StatusNotFound, w.Code)
+	require.Equal(EncodingGzip, w.Header().Get("Content-Encoding"))
+	require.Equal(body, decode(t, EncodingGzip, w.Body.Bytes()))
+
+	w = serveCompressed(CompressConfig{Enabled: true}, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	require.Equal(http.StatusNoContent, w.Code)
+	require.Empty(w.Header().Get("Content-Encoding"))
+}
+
+func TestCompressSkipsUndeclaredContentType(t *testing.T) {
+	require := require.New(t)
+
+	body := strings.Repeat(`{"tag": "a"}`, 200)
+
+	w := serveCompressed(CompressConfig{Enabled: true}, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+	require.Empty(w.Header().Get("Content-Encoding"))
+	require.Equal(body, w.Body.String())
+}
+
+func TestCompressJSONSuffix(t *testing.T) {
+	require := require.New(t)
+
+	body := strings.Repeat(`{"tag": "a"}`, 200)
+
+	w := serveCompressed(CompressConfig{Enabled: true}, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+		w.Write([]byte(body))
+	})
+	require.Equal(EncodingGzip, w.Header().Get("Content-Encoding"))
+	require.Equal(body, decode(t, EncodingGzip, w.Body.Bytes()))
+}
+
+func TestCompressFlushesStreamedBodies(t *testing.T) {
+	require := require.New(t)
+
+	w := serveCompressed(CompressConfig{Enabled: true}, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"a": 1}`))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(`{"b": 2}`))
+	})
+	require.True(w.Flushed)
+	require.Equal(EncodingGzip, w.Header().Get("Content-Encoding"))
+	require.Equal(`{"a": 1}{"b": 2}`, decode(t, EncodingGzip, w.Body.Bytes()))
+}
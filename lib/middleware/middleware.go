@@ -19,6 +19,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/uber/kraken/utils/requestid"
+
 	"github.com/pressly/chi"
 	"github.com/uber-go/tally"
 )
@@ -89,6 +91,14 @@ func (w *recordStatusWriter) Write(b []byte) (int, error) {
 	return w.ResponseWriter.Write(b)
 }
 
+// Flush implements http.Flusher, such that streaming handlers keep working
+// when wrapped.
+func (w *recordStatusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // StatusCounter measures endpoint status count.
 func StatusCounter(stats tally.Scope) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -99,3 +109,65 @@ func StatusCounter(stats tally.Scope) func(next http.Handler) http.Handler {
 		})
 	}
 }
+
+// RequestCounter counts requests by endpoint, tagged by status. Unlike
+// StatusCounter, the metric name is fixed, as required by backends such as
+// prometheus.
+func RequestCounter(stats tally.Scope) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recordw := &recordStatusWriter{w, false, http.StatusOK}
+			next.ServeHTTP(recordw, r)
+			tagEndpoint(stats, r).Tagged(map[string]string{
+				"status": strconv.Itoa(recordw.code),
+			}).Counter("requests").Inc(1)
+		})
+	}
+}
+
+type recordSizeWriter struct {
+	http.ResponseWriter
+	size int64
+}
+
+func (w *recordSizeWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, such that streaming handlers keep working
+// when wrapped.
+func (w *recordSizeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// _responseSizeBuckets range from 64B to 64MB.
+var _responseSizeBuckets = tally.MustMakeExponentialValueBuckets(64, 4, 11)
+
+// ResponseSize measures endpoint response body sizes in bytes, after any
+// compression applied by inner handlers.
+func ResponseSize(stats tally.Scope) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recordw := &recordSizeWriter{ResponseWriter: w}
+			next.ServeHTTP(recordw, r)
+			tagEndpoint(stats, r).
+				Histogram("response_size", _responseSizeBuckets).
+				RecordValue(float64(recordw.size))
+		})
+	}
+}
+
+// RequestID assigns each request an id, propagated from the caller's
+// X-Request-ID header if present, which is carried in the request context and
+// returned in the X-Request-ID response header.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestid.FromRequest(r)
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
@@ -17,10 +17,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/requestid"
 	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/pressly/chi"
@@ -155,3 +158,93 @@ func TestStatusCounter(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestCounter(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+
+	r := chi.NewRouter()
+	r.Use(RequestCounter(stats))
+	r.Get("/foo/{foo}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	// Served synchronously, such that metrics are recorded before they are
+	// read.
+	for i := 0; i < 3; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo/x", nil))
+	}
+
+	require.Equal(1, len(stats.Snapshot().Counters()))
+	for _, v := range stats.Snapshot().Counters() {
+		require.Equal("requests", v.Name())
+		require.Equal(int64(3), v.Value())
+		require.Equal(map[string]string{
+			"endpoint": "foo",
+			"method":   "GET",
+			"status":   "404",
+		}, v.Tags())
+	}
+}
+
+func TestResponseSize(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+
+	r := chi.NewRouter()
+	r.Use(ResponseSize(stats))
+	r.Get("/foo/{foo}", func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, strings.Repeat("a", 100))
+		io.WriteString(w, strings.Repeat("a", 100))
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo/x", nil))
+
+	// Snapshots consume histogram samples, so are only taken once.
+	histograms := stats.Snapshot().Histograms()
+	require.Equal(1, len(histograms))
+	for _, v := range histograms {
+		require.Equal("response_size", v.Name())
+		require.Equal(map[string]string{
+			"endpoint": "foo",
+			"method":   "GET",
+		}, v.Tags())
+		var count int64
+		for upper, n := range v.Values() {
+			if n > 0 {
+				// 200 bytes fall into the (64, 256] bucket.
+				require.Equal(256.0, upper)
+			}
+			count += n
+		}
+		require.Equal(int64(1), count)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	require := require.New(t)
+
+	var received string
+	r := chi.NewRouter()
+	r.Use(RequestID)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		received = requestid.FromContext(r.Context())
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/", addr))
+	require.NoError(err)
+	generated := resp.Header.Get(requestid.Header)
+	require.NotEmpty(generated)
+	require.Equal(generated, received)
+
+	resp, err = httputil.Get(
+		fmt.Sprintf("http://%s/", addr),
+		httputil.SendHeaders(map[string]string{requestid.Header: "support-ticket-1"}))
+	require.NoError(err)
+	require.Equal("support-ticket-1", resp.Header.Get(requestid.Header))
+	require.Equal("support-ticket-1", received)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/uber/kraken/utils/requestid"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pressly/chi"
+)
+
+// Trace starts a server span for each request, continuing the trace of the
+// caller if the request headers carry one. The span is carried in the request
+// context, such that handlers can start child spans of it, and is named after
+// the endpoint's route pattern once the request is routed.
+func Trace(tracer opentracing.Tracer) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method := strings.ToUpper(r.Method)
+			parent, _ := tracer.Extract(
+				opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+			span := tracer.StartSpan(method, ext.RPCServerOption(parent))
+			defer span.Finish()
+
+			ext.HTTPMethod.Set(span, method)
+			ext.HTTPUrl.Set(span, r.URL.Path)
+			if id := requestid.FromContext(r.Context()); id != "" {
+				span.SetTag("request_id", id)
+			}
+
+			recordw := &recordStatusWriter{w, false, http.StatusOK}
+			next.ServeHTTP(recordw, r.WithContext(opentracing.ContextWithSpan(r.Context(), span)))
+
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				span.SetOperationName(method + " " + rctx.RoutePattern())
+			}
+			ext.HTTPStatusCode.Set(span, uint16(recordw.code))
+			if recordw.code >= 500 {
+				ext.Error.Set(span, true)
+			}
+		})
+	}
+}
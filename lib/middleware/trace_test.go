@@ -0,0 +1,95 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/pressly/chi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	require := require.New(t)
+
+	tracer := mocktracer.New()
+
+	var child *mocktracer.MockSpan
+	r := chi.NewRouter()
+	r.Use(RequestID)
+	r.Use(Trace(tracer))
+	r.Get("/foo/{foo}", func(w http.ResponseWriter, r *http.Request) {
+		span, _ := opentracing.StartSpanFromContextWithTracer(r.Context(), tracer, "child")
+		span.Finish()
+		child = span.(*mocktracer.MockSpan)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	_, err := httputil.Get(
+		fmt.Sprintf("http://%s/foo/x", addr),
+		httputil.SendHeaders(map[string]string{"X-Request-ID": "some-request"}))
+	require.Error(err)
+
+	spans := tracer.FinishedSpans()
+	require.Len(spans, 2)
+	server := spans[1]
+	require.Equal("GET /foo/{foo}", server.OperationName)
+	require.Equal(server.SpanContext.SpanID, child.ParentID)
+
+	tags := server.Tags()
+	require.Equal("server", fmt.Sprint(tags["span.kind"]))
+	require.Equal("/foo/x", tags["http.url"])
+	require.Equal(uint16(500), tags["http.status_code"])
+	require.Equal(true, tags["error"])
+	require.Equal("some-request", tags["request_id"])
+}
+
+func TestTraceContinuesCallerTrace(t *testing.T) {
+	require := require.New(t)
+
+	tracer := mocktracer.New()
+
+	r := chi.NewRouter()
+	r.Use(Trace(tracer))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	caller := tracer.StartSpan("caller")
+	header := make(http.Header)
+	require.NoError(tracer.Inject(
+		caller.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)))
+	headers := make(map[string]string)
+	for k := range header {
+		headers[k] = header.Get(k)
+	}
+	_, err := httputil.Get(fmt.Sprintf("http://%s/", addr), httputil.SendHeaders(headers))
+	require.NoError(err)
+	caller.Finish()
+
+	spans := tracer.FinishedSpans()
+	require.Len(spans, 2)
+	callerCtx := caller.Context().(mocktracer.MockSpanContext)
+	require.Equal(callerCtx.TraceID, spans[0].SpanContext.TraceID)
+	require.Equal(callerCtx.SpanID, spans[0].ParentID)
+}
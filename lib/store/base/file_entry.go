@@ -24,6 +24,7 @@ import (
 	"sync"
 
 	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
 	"github.com/uber/kraken/utils/stringset"
 )
 
@@ -295,7 +296,9 @@ func (entry *localFileEntry) Create(targetState FileState, size int64) error {
 	err = f.Truncate(size)
 	if err != nil {
 		// Try to delete file.
-		os.RemoveAll(filepath.Dir(targetPath))
+		if rmErr := os.RemoveAll(filepath.Dir(targetPath)); rmErr != nil {
+			log.With("path", targetPath).Errorf("Error removing partially created file: %s", rmErr)
+		}
 		return err
 	}
 
@@ -14,8 +14,11 @@
 package store
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/uber/kraken/lib/store/base"
 	"github.com/uber/kraken/lib/store/metadata"
@@ -30,10 +33,22 @@ type CADownloadStore struct {
 	downloadState base.FileState
 	cacheState    base.FileState
 	cleanup       *cleanupManager
+
+	clk    clock.Clock
+	cipher *Cipher
+
+	// encryptionRequests maps names of blobs which must be encrypted once
+	// downloaded to when encryption was requested.
+	encryptionMu       sync.Mutex
+	encryptionRequests map[string]time.Time
 }
 
 // NewCADownloadStore creates a new CADownloadStore.
-func NewCADownloadStore(config CADownloadStoreConfig, stats tally.Scope) (*CADownloadStore, error) {
+func NewCADownloadStore(
+	config CADownloadStoreConfig,
+	stats tally.Scope,
+	opts ...CADownloadStoreOption) (*CADownloadStore, error) {
+
 	stats = stats.Tagged(map[string]string{
 		"module": "cadownloadstore",
 	})
@@ -61,12 +76,29 @@ func NewCADownloadStore(config CADownloadStoreConfig, stats tally.Scope) (*CADow
 		config.CacheCleanup,
 		backend.NewFileOp().AcceptState(cacheState))
 
-	return &CADownloadStore{
+	s := &CADownloadStore{
 		backend:       backend,
 		downloadState: downloadState,
 		cacheState:    cacheState,
 		cleanup:       cleanup,
-	}, nil
+		clk:           clock.New(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if config.Encryption.Enabled {
+		if s.cipher == nil {
+			s.Close()
+			return nil, errors.New("encryption enabled but no cipher provided")
+		}
+		s.encryptionRequests = make(map[string]time.Time)
+	}
+	return s, nil
+}
+
+// CacheDir returns the directory in which cache files are stored.
+func (s *CADownloadStore) CacheDir() string {
+	return s.cacheState.GetDirectory()
 }
 
 // Close terminates all goroutines started by s.
@@ -155,9 +187,14 @@ func (s *CADownloadStore) Any() *CADownloadStoreScope {
 	return s.states().download().cache()
 }
 
-// GetFileReader returns a reader for name.
+// GetFileReader returns a reader for name. Encrypted files are decrypted
+// transparently.
 func (a *CADownloadStoreScope) GetFileReader(name string) (FileReader, error) {
-	return a.op.GetFileReader(name)
+	f, err := a.op.GetFileReader(name)
+	if err != nil {
+		return nil, err
+	}
+	return a.store.decryptReader(a.op, name, f)
 }
 
 // GetFileStat returns file info for name.
@@ -76,22 +76,55 @@ func (s *CAStore) Close() {
 	s.cleanup.stop()
 }
 
+// Dirs returns the distinct directories s writes files to, i.e. the upload
+// and cache directories and any cache volumes.
+func (s *CAStore) Dirs() []string {
+	dirs := []string{s.config.UploadDir}
+	seen := map[string]bool{s.config.UploadDir: true}
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	add(s.config.CacheDir)
+	for _, v := range s.config.Volumes {
+		add(v.Location)
+	}
+	return dirs
+}
+
 // MoveUploadFileToCache commits uploadName as cacheName. Clients are expected
 // to validate the content of the upload file matches the cacheName digest.
 func (s *CAStore) MoveUploadFileToCache(uploadName, cacheName string) error {
+	return s.moveUploadFileToCache(uploadName, cacheName, true)
+}
+
+// MoveVerifiedUploadFileToCache commits uploadName as cacheName without hashing
+// the upload file. Only intended for callers which already verified the upload
+// content matches the cacheName digest, e.g. while writing it.
+func (s *CAStore) MoveVerifiedUploadFileToCache(uploadName, cacheName string) error {
+	return s.moveUploadFileToCache(uploadName, cacheName, false)
+}
+
+func (s *CAStore) moveUploadFileToCache(uploadName, cacheName string, verify bool) error {
 	uploadPath, err := s.uploadStore.newFileOp().GetFilePath(uploadName)
 	if err != nil {
 		return err
 	}
 	defer s.DeleteUploadFile(uploadName)
 
-	f, err := s.uploadStore.newFileOp().GetFileReader(uploadName)
-	if err != nil {
-		return fmt.Errorf("get file reader %s: %s", uploadName, err)
-	}
-	defer f.Close()
-	if err := s.verify(f, cacheName); err != nil {
-		return fmt.Errorf("verify digest: %s", err)
+	if verify {
+		f, err := s.uploadStore.newFileOp().GetFileReader(uploadName)
+		if err != nil {
+			return fmt.Errorf("get file reader %s: %s", uploadName, err)
+		}
+		defer f.Close()
+		if err := s.verify(f, cacheName); err != nil {
+			return fmt.Errorf("verify digest: %s", err)
+		}
+	} else if _, err := core.NewSHA256DigestFromHex(cacheName); err != nil {
+		return fmt.Errorf("new digest from file name: %s", err)
 	}
 
 	return s.cacheStore.newFileOp().MoveFileFrom(cacheName, s.cacheStore.state, uploadPath)
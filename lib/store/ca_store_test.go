@@ -136,6 +136,24 @@ func TestCAStoreInitVolumesAfterChangingVolumes(t *testing.T) {
 	require.True(float32(n4)/256 > float32(0.15))
 }
 
+func TestCAStoreDirs(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	volume, err := ioutil.TempDir("/tmp", "volume")
+	require.NoError(err)
+	defer os.RemoveAll(volume)
+
+	config.Volumes = []Volume{{Location: volume, Weight: 100}}
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+
+	require.Equal([]string{config.UploadDir, config.CacheDir, volume}, s.Dirs())
+}
+
 func TestCAStoreCreateUploadFileAndMoveToCache(t *testing.T) {
 	require := require.New(t)
 
@@ -55,4 +55,8 @@ type CADownloadStoreConfig struct {
 	CacheDir        string        `yaml:"cache_dir"`
 	DownloadCleanup CleanupConfig `yaml:"download_cleanup"`
 	CacheCleanup    CleanupConfig `yaml:"cache_cleanup"`
+
+	// Encryption encrypts blobs of selected namespaces at rest. Requires a
+	// cipher to be provided via WithCipher.
+	Encryption EncryptionConfig `yaml:"encryption"`
 }
@@ -0,0 +1,305 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+// _encryptionRequestTTL bounds how long after encryption of a blob is
+// requested its download may start and still be encrypted.
+const _encryptionRequestTTL = time.Hour
+
+// EncryptionConfig defines encryption at rest of blobs downloaded into a
+// CADownloadStore. Blobs are only encrypted if requested via
+// RequestEncryption, e.g. because the image manifest referencing them opts in.
+type EncryptionConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// Cipher encrypts chunks of blobs using AES-GCM. Each chunk is sealed with a
+// random nonce and bound to its blob and position, such that chunks cannot be
+// swapped between blobs or within a blob without detection.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a new Cipher from a 16, 24 or 32 byte AES key.
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes: %s", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("gcm: %s", err)
+	}
+	return &Cipher{aead}, nil
+}
+
+func chunkAdditionalData(name string, i int) []byte {
+	return []byte(name + ":" + strconv.Itoa(i))
+}
+
+// seal encrypts b, chunk i of name, in place. Returns the nonce and tag
+// required to open it.
+func (c *Cipher) seal(name string, i int, b []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("nonce: %s", err)
+	}
+	out := c.aead.Seal(nil, nonce, b, chunkAdditionalData(name, i))
+	copy(b, out)
+	return append(nonce, out[len(b):]...), nil
+}
+
+// open decrypts b, chunk i of name, in place.
+func (c *Cipher) open(name string, i int, b, seal []byte) error {
+	n := c.aead.NonceSize()
+	if len(seal) != n+c.aead.Overhead() {
+		return fmt.Errorf("invalid seal size %d", len(seal))
+	}
+	ciphertext := append(append(make([]byte, 0, len(b)+len(seal)-n), b...), seal[n:]...)
+	out, err := c.aead.Open(ciphertext[:0], seal[:n], ciphertext, chunkAdditionalData(name, i))
+	if err != nil {
+		return err
+	}
+	copy(b, out)
+	return nil
+}
+
+// CADownloadStoreOption defines an optional NewCADownloadStore parameter.
+type CADownloadStoreOption func(*CADownloadStore)
+
+// WithCipher encrypts blobs for which encryption is requested using c.
+func WithCipher(c *Cipher) CADownloadStoreOption {
+	return func(s *CADownloadStore) { s.cipher = c }
+}
+
+// RequestEncryption marks names as blobs which must be encrypted at rest if
+// their download starts within the next hour. No-op if encryption is disabled.
+// Blobs already on disk are not rewritten.
+func (s *CADownloadStore) RequestEncryption(names ...string) {
+	if s.encryptionRequests == nil {
+		return
+	}
+	s.encryptionMu.Lock()
+	defer s.encryptionMu.Unlock()
+
+	now := s.clk.Now()
+	for name, t := range s.encryptionRequests {
+		if now.Sub(t) >= _encryptionRequestTTL {
+			delete(s.encryptionRequests, name)
+		}
+	}
+	for _, name := range names {
+		s.encryptionRequests[name] = now
+	}
+}
+
+// EncryptionRequested returns true if name must be encrypted at rest.
+func (s *CADownloadStore) EncryptionRequested(name string) bool {
+	if s.encryptionRequests == nil {
+		return false
+	}
+	s.encryptionMu.Lock()
+	defer s.encryptionMu.Unlock()
+
+	t, ok := s.encryptionRequests[name]
+	return ok && s.clk.Now().Sub(t) < _encryptionRequestTTL
+}
+
+// InitEncryption marks the download file name as encrypted in numChunks
+// chunks of chunkSize. Chunks must then be written with WriteEncryptedChunk.
+func (s *CADownloadStore) InitEncryption(name string, chunkSize int64, numChunks int) error {
+	if s.cipher == nil {
+		return errors.New("no cipher configured")
+	}
+	return s.Download().GetOrSetMetadata(name, metadata.NewEncryption(chunkSize, numChunks))
+}
+
+// Encrypted returns true if name is encrypted at rest.
+func (s *CADownloadStore) Encrypted(name string) (bool, error) {
+	var e metadata.Encryption
+	if err := s.Any().GetMetadata(name, &e); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// WriteEncryptedChunk encrypts b, chunk i of the download file name, in place
+// and writes it.
+func (s *CADownloadStore) WriteEncryptedChunk(name string, i int, b []byte) error {
+	if s.cipher == nil {
+		return errors.New("no cipher configured")
+	}
+	var e metadata.Encryption
+	if err := s.Download().GetMetadata(name, &e); err != nil {
+		return fmt.Errorf("get encryption metadata: %s", err)
+	}
+	if i < 0 || i >= len(e.Seals) {
+		return fmt.Errorf("invalid chunk %d: num chunks = %d", i, len(e.Seals))
+	}
+	seal, err := s.cipher.seal(name, i, b)
+	if err != nil {
+		return fmt.Errorf("seal: %s", err)
+	}
+	f, err := s.GetDownloadFileReadWriter(name)
+	if err != nil {
+		return fmt.Errorf("get download writer: %s", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(b, int64(i)*e.ChunkSize); err != nil {
+		return fmt.Errorf("write: %s", err)
+	}
+	if _, err := s.Download().SetMetadataAt(
+		name, &metadata.Encryption{}, seal, metadata.EncryptionSealOffset(i)); err != nil {
+		return fmt.Errorf("write seal: %s", err)
+	}
+	return nil
+}
+
+// decryptReader wraps f, a reader of name, such that encrypted files are
+// transparently decrypted. Plaintext files are returned as is.
+func (s *CADownloadStore) decryptReader(op base.FileOp, name string, f FileReader) (FileReader, error) {
+	var e metadata.Encryption
+	if err := op.GetFileMetadata(name, &e); err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		f.Close()
+		return nil, fmt.Errorf("get encryption metadata: %s", err)
+	}
+	if s.cipher == nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is encrypted but no cipher is configured", name)
+	}
+	return &decryptingFileReader{FileReader: f, name: name, cipher: s.cipher, meta: &e}, nil
+}
+
+// decryptingFileReader decrypts an encrypted file chunk by chunk.
+type decryptingFileReader struct {
+	FileReader
+	name   string
+	cipher *Cipher
+	meta   *metadata.Encryption
+
+	mu     sync.Mutex
+	offset int64
+
+	// chunk caches the most recently decrypted chunk, since reads are mostly
+	// sequential.
+	chunkIndex int
+	chunk      []byte
+}
+
+func (r *decryptingFileReader) loadChunk(i int) ([]byte, error) {
+	if r.chunk != nil && r.chunkIndex == i {
+		return r.chunk, nil
+	}
+	if i >= len(r.meta.Seals) || r.meta.Seals[i] == nil {
+		return nil, fmt.Errorf("chunk %d is not written", i)
+	}
+	off := int64(i) * r.meta.ChunkSize
+	n := r.meta.ChunkSize
+	if rem := r.Size() - off; rem < n {
+		n = rem
+	}
+	b := make([]byte, n)
+	if _, err := r.FileReader.ReadAt(b, off); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read chunk %d: %s", i, err)
+	}
+	if err := r.cipher.open(r.name, i, b, r.meta.Seals[i]); err != nil {
+		return nil, fmt.Errorf("decrypt chunk %d: %s", i, err)
+	}
+	r.chunkIndex, r.chunk = i, b
+	return b, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *decryptingFileReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.readAt(p, off)
+}
+
+func (r *decryptingFileReader) readAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	var n int
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.Size() {
+			return n, io.EOF
+		}
+		i := int(pos / r.meta.ChunkSize)
+		chunk, err := r.loadChunk(i)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], chunk[pos-int64(i)*r.meta.ChunkSize:])
+	}
+	return n, nil
+}
+
+// Read implements io.Reader.
+func (r *decryptingFileReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, err := r.readAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (r *decryptingFileReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.Size()
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	r.offset = offset
+	return offset, nil
+}
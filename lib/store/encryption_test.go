@@ -0,0 +1,189 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// writeEncryptedFixture writes blob into s as an encrypted file of name in
+// chunks of chunkSize, and moves it to the cache.
+func writeEncryptedFixture(
+	t *testing.T, s *CADownloadStore, name string, blob []byte, chunkSize int64) {
+
+	require := require.New(t)
+
+	numChunks := (int64(len(blob)) + chunkSize - 1) / chunkSize
+	require.NoError(s.CreateDownloadFile(name, int64(len(blob))))
+	require.NoError(s.InitEncryption(name, chunkSize, int(numChunks)))
+	for i := int64(0); i < numChunks; i++ {
+		end := (i + 1) * chunkSize
+		if end > int64(len(blob)) {
+			end = int64(len(blob))
+		}
+		chunk := append([]byte(nil), blob[i*chunkSize:end]...)
+		require.NoError(s.WriteEncryptedChunk(name, int(i), chunk))
+	}
+	require.NoError(s.MoveDownloadFileToCache(name))
+}
+
+func TestCADownloadStoreEncryptedReads(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := EncryptedCADownloadStoreFixture()
+	defer cleanup()
+
+	name := core.DigestFixture().Hex()
+	blob := randutil.Blob(100)
+	writeEncryptedFixture(t, s, name, blob, 16)
+
+	encrypted, err := s.Encrypted(name)
+	require.NoError(err)
+	require.True(encrypted)
+
+	// Data is not stored in plaintext.
+	rawReader, err := s.backend.NewFileOp().AcceptState(s.cacheState).GetFileReader(name)
+	require.NoError(err)
+	raw, err := ioutil.ReadAll(rawReader)
+	require.NoError(err)
+	rawReader.Close()
+	require.Len(raw, len(blob))
+	require.NotEqual(blob, raw)
+
+	f, err := s.Cache().GetFileReader(name)
+	require.NoError(err)
+	defer f.Close()
+
+	require.Equal(int64(len(blob)), f.Size())
+
+	result, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.Equal(blob, result)
+
+	// Reads spanning chunks.
+	b := make([]byte, 40)
+	n, err := f.ReadAt(b, 10)
+	require.NoError(err)
+	require.Equal(40, n)
+	require.Equal(blob[10:50], b)
+
+	// Short read at the end.
+	n, err = f.ReadAt(b, 90)
+	require.Equal(io.EOF, err)
+	require.Equal(10, n)
+	require.Equal(blob[90:], b[:n])
+
+	_, err = f.Seek(95, io.SeekStart)
+	require.NoError(err)
+	result, err = ioutil.ReadAll(f)
+	require.NoError(err)
+	require.Equal(blob[95:], result)
+}
+
+func TestCADownloadStoreEncryptedReadRejectsTampering(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := EncryptedCADownloadStoreFixture()
+	defer cleanup()
+
+	name := core.DigestFixture().Hex()
+	writeEncryptedFixture(t, s, name, randutil.Blob(64), 16)
+
+	// Swap the seals of the first two chunks.
+	var e metadata.Encryption
+	require.NoError(s.Cache().GetMetadata(name, &e))
+	e.Seals[0], e.Seals[1] = e.Seals[1], e.Seals[0]
+	_, err := s.Cache().SetMetadata(name, &e)
+	require.NoError(err)
+
+	f, err := s.Cache().GetFileReader(name)
+	require.NoError(err)
+	defer f.Close()
+
+	_, err = ioutil.ReadAll(f)
+	require.Error(err)
+}
+
+func TestCADownloadStoreEncryptedReadRequiresCipher(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := EncryptedCADownloadStoreFixture()
+	defer cleanup()
+
+	name := core.DigestFixture().Hex()
+	writeEncryptedFixture(t, s, name, randutil.Blob(32), 16)
+
+	plain, err := NewCADownloadStore(CADownloadStoreConfig{
+		DownloadDir: s.downloadState.GetDirectory(),
+		CacheDir:    s.CacheDir(),
+	}, tally.NoopScope)
+	require.NoError(err)
+	defer plain.Close()
+
+	_, err = plain.Cache().GetFileReader(name)
+	require.Error(err)
+}
+
+func TestCADownloadStoreEncryptionRequested(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := EncryptedCADownloadStoreFixture()
+	defer cleanup()
+
+	clk := clock.NewMock()
+	s.clk = clk
+
+	requested := core.DigestFixture().Hex()
+	s.RequestEncryption(requested)
+	require.True(s.EncryptionRequested(requested))
+	require.False(s.EncryptionRequested(core.DigestFixture().Hex()))
+
+	// Requests expire.
+	clk.Add(_encryptionRequestTTL)
+	require.False(s.EncryptionRequested(requested))
+
+	plain, cleanup := CADownloadStoreFixture()
+	defer cleanup()
+
+	plain.RequestEncryption(requested)
+	require.False(plain.EncryptionRequested(requested))
+
+	// Plaintext files are read as is.
+	name := core.DigestFixture().Hex()
+	blob := randutil.Blob(32)
+	require.NoError(s.CreateDownloadFile(name, int64(len(blob))))
+	w, err := s.GetDownloadFileReadWriter(name)
+	require.NoError(err)
+	_, err = io.Copy(w, bytes.NewReader(blob))
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	f, err := s.Download().GetFileReader(name)
+	require.NoError(err)
+	defer f.Close()
+	result, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.Equal(blob, result)
+}
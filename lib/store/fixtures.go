@@ -17,6 +17,7 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/uber/kraken/utils/randutil"
 	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/uber-go/tally"
@@ -84,6 +85,40 @@ func CADownloadStoreFixture() (*CADownloadStore, func()) {
 	return s, cleanup.Run
 }
 
+// CipherFixture returns a Cipher with a random key for testing purposes.
+func CipherFixture() *Cipher {
+	c, err := NewCipher(randutil.Blob(32))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// EncryptedCADownloadStoreFixture returns a CADownloadStore which encrypts
+// requested blobs for testing purposes.
+func EncryptedCADownloadStoreFixture() (*CADownloadStore, func()) {
+	cleanup := &testutil.Cleanup{}
+	defer cleanup.Recover()
+
+	download := tempdir(cleanup, "download")
+	cache := tempdir(cleanup, "cache")
+
+	config := CADownloadStoreConfig{
+		DownloadDir: download,
+		CacheDir:    cache,
+		Encryption: EncryptionConfig{
+			Enabled: true,
+		},
+	}
+	s, err := NewCADownloadStore(config, tally.NoopScope, WithCipher(CipherFixture()))
+	if err != nil {
+		panic(err)
+	}
+	cleanup.Add(s.Close)
+
+	return s, cleanup.Run
+}
+
 // SimpleStoreFixture returns a SimpleStore for testing purposes.
 func SimpleStoreFixture() (*SimpleStore, func()) {
 	cleanup := &testutil.Cleanup{}
@@ -104,3 +139,20 @@ func SimpleStoreFixture() (*SimpleStore, func()) {
 
 	return s, cleanup.Run
 }
+
+// CorruptCacheFile overwrites the start of the cache file of name for testing
+// purposes, such that its content no longer matches its digest.
+func CorruptCacheFile(s *CAStore, name string) {
+	path, err := s.cacheStore.newFileOp().GetFilePath(name)
+	if err != nil {
+		panic(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt([]byte("corrupt"), 0); err != nil {
+		panic(err)
+	}
+}
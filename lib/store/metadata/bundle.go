@@ -0,0 +1,63 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/uber/kraken/core"
+)
+
+const _bundleSuffix = "_bundle"
+
+func init() {
+	Register(regexp.MustCompile(_bundleSuffix), &bundleFactory{})
+}
+
+type bundleFactory struct{}
+
+func (f bundleFactory) Create(suffix string) Metadata {
+	return &Bundle{}
+}
+
+// Bundle records the bundle of the small blobs referenced by a manifest.
+type Bundle struct {
+	Index core.BundleIndex
+}
+
+// NewBundle creates a new Bundle.
+func NewBundle(index core.BundleIndex) *Bundle {
+	return &Bundle{index}
+}
+
+// GetSuffix returns a static suffix.
+func (m *Bundle) GetSuffix() string {
+	return _bundleSuffix
+}
+
+// Movable is true.
+func (m *Bundle) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *Bundle) Serialize() ([]byte, error) {
+	return json.Marshal(m.Index)
+}
+
+// Deserialize loads b into m.
+func (m *Bundle) Deserialize(b []byte) error {
+	return json.Unmarshal(b, &m.Index)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+)
+
+const _encryptionSuffix = "_encryption"
+
+// EncryptionSealSize is the size of the AES-GCM nonce and tag sealing each
+// chunk of an encrypted blob.
+const EncryptionSealSize = 12 + 16
+
+func init() {
+	Register(regexp.MustCompile(_encryptionSuffix), &encryptionFactory{})
+}
+
+type encryptionFactory struct{}
+
+func (f encryptionFactory) Create(suffix string) Metadata {
+	return &Encryption{}
+}
+
+// Encryption records that a blob is encrypted at rest in chunks of ChunkSize,
+// along with the seal of each chunk. Seals of chunks which have not been
+// written yet are nil.
+type Encryption struct {
+	ChunkSize int64
+	Seals     [][]byte
+}
+
+// NewEncryption creates a new Encryption for numChunks unwritten chunks.
+func NewEncryption(chunkSize int64, numChunks int) *Encryption {
+	return &Encryption{chunkSize, make([][]byte, numChunks)}
+}
+
+// EncryptionSealOffset returns the offset of the seal of chunk i within
+// serialized Encryption metadata, for use with SetMetadataAt.
+func EncryptionSealOffset(i int) int64 {
+	return 8 + int64(i)*EncryptionSealSize
+}
+
+// GetSuffix returns a static suffix.
+func (m *Encryption) GetSuffix() string {
+	return _encryptionSuffix
+}
+
+// Movable is true.
+func (m *Encryption) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *Encryption) Serialize() ([]byte, error) {
+	b := make([]byte, EncryptionSealOffset(len(m.Seals)))
+	binary.BigEndian.PutUint64(b, uint64(m.ChunkSize))
+	for i, s := range m.Seals {
+		if s == nil {
+			continue
+		}
+		if len(s) != EncryptionSealSize {
+			return nil, fmt.Errorf("seal %d: invalid size %d", i, len(s))
+		}
+		copy(b[EncryptionSealOffset(i):], s)
+	}
+	return b, nil
+}
+
+// Deserialize loads b into m.
+func (m *Encryption) Deserialize(b []byte) error {
+	if len(b) < 8 || (len(b)-8)%EncryptionSealSize != 0 {
+		return fmt.Errorf("invalid encryption metadata size %d", len(b))
+	}
+	m.ChunkSize = int64(binary.BigEndian.Uint64(b))
+	if m.ChunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size %d", m.ChunkSize)
+	}
+	m.Seals = make([][]byte, (len(b)-8)/EncryptionSealSize)
+	for i := range m.Seals {
+		off := EncryptionSealOffset(i)
+		s := b[off : off+EncryptionSealSize]
+		if !isZero(s) {
+			m.Seals[i] = append([]byte(nil), s...)
+		}
+	}
+	return nil
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
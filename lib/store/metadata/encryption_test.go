@@ -0,0 +1,47 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptionMetadataSerialization(t *testing.T) {
+	require := require.New(t)
+
+	e := NewEncryption(4, 3)
+	e.Seals[1] = bytes.Repeat([]byte{1}, EncryptionSealSize)
+
+	b, err := e.Serialize()
+	require.NoError(err)
+	require.Len(b, int(EncryptionSealOffset(3)))
+
+	var result Encryption
+	require.NoError(result.Deserialize(b))
+	require.Equal(e, &result)
+}
+
+func TestEncryptionMetadataDeserializeErrors(t *testing.T) {
+	for _, b := range [][]byte{
+		nil,
+		make([]byte, 8+EncryptionSealSize-1),
+		make([]byte, 8), // Zero chunk size.
+	} {
+		var e Encryption
+		require.Error(t, e.Deserialize(b))
+	}
+}
@@ -31,7 +31,9 @@ type uploadStore struct {
 
 func newUploadStore(dir string) (*uploadStore, error) {
 	// Always wipe upload directory on startup.
-	os.RemoveAll(dir)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("wipe: %s", err)
+	}
 
 	if err := os.MkdirAll(dir, 0775); err != nil {
 		return nil, fmt.Errorf("mkdir: %s", err)
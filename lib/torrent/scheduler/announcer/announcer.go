@@ -75,7 +75,6 @@ func New(
 }
 
 // Default creates a default Announcer.
-// TODO(evelynl94): make announce interval configurable.
 func Default(
 	client announceclient.Client,
 	events Events,
@@ -87,9 +86,9 @@ func Default(
 // Announce announces through the underlying client and returns the resulting
 // peer handout. Updates the announce interval if it has changed.
 func (a *Announcer) Announce(
-	d core.Digest, h core.InfoHash, complete bool) ([]*core.PeerInfo, error) {
+	namespace string, d core.Digest, h core.InfoHash, complete bool) ([]*core.PeerInfo, error) {
 
-	peers, interval, err := a.client.Announce(d, h, complete, announceclient.V1)
+	peers, interval, err := a.client.Announce(namespace, d, h, complete, announceclient.V1)
 	if err != nil {
 		return nil, err
 	}
@@ -16,9 +16,12 @@ package scheduler
 import (
 	"time"
 
+	"github.com/uber/kraken/lib/torrent/scheduler/announcer"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/tracker/udptracker"
 	"github.com/uber/kraken/utils/log"
 )
 
@@ -60,6 +63,35 @@ type Config struct {
 
 	Dispatch dispatch.Config `yaml:"dispatch"`
 
+	// Announcer configures the announce interval used until trackers hand out
+	// one, and the longest interval handed out by trackers which is obeyed.
+	Announcer announcer.Config `yaml:"announcer"`
+
+	AnnounceToken announcetoken.Config `yaml:"announce_token"`
+
+	// TrackerBearerToken authenticates announces and metainfo downloads, for
+	// trackers which require authentication. Should be supplied via secrets
+	// file. Not sent to UDP trackers.
+	TrackerBearerToken string `yaml:"tracker_bearer_token"`
+
+	LoadHint LoadHintConfig `yaml:"load_hint"`
+
+	// CompactAnnounce requests compact peer lists from trackers, which only
+	// carry peer ids and IPv4 addresses.
+	CompactAnnounce bool `yaml:"compact_announce"`
+
+	// UDPTracker announces to trackers over the UDP tracker protocol instead
+	// of HTTP, if an address is configured.
+	UDPTracker udptracker.ClientConfig `yaml:"udp_tracker"`
+
+	DistributionHints DistributionHintConfig `yaml:"distribution_hints"`
+
+	// ReportTransfers attaches the bytes uploaded and downloaded for each
+	// torrent to its announces, which trackers account per namespace.
+	ReportTransfers bool `yaml:"report_transfers"`
+
+	HostDedup HostDedupConfig `yaml:"host_dedup"`
+
 	TorrentLog log.Config `yaml:"torrentlog"`
 	Log        log.Config `yaml:"log"`
 }
@@ -86,5 +118,40 @@ func (c Config) applyDefaults() Config {
 	if c.ProbeTimeout == 0 {
 		c.ProbeTimeout = 3 * time.Second
 	}
+	c.DistributionHints = c.DistributionHints.applyDefaults()
 	return c
 }
+
+// DistributionHintConfig defines configuration for applying the distribution
+// hints trackers attach to metainfo. Hints override ConnState's
+// MaxOpenConnectionsPerTorrent and LeecherTTI per torrent, within the bounds
+// below.
+type DistributionHintConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxConnections caps hinted connection limits.
+	MaxConnections int `yaml:"max_connections"`
+
+	// MinLeecherTTI and MaxLeecherTTI bound hinted stall timeouts.
+	MinLeecherTTI time.Duration `yaml:"min_leecher_tti"`
+	MaxLeecherTTI time.Duration `yaml:"max_leecher_tti"`
+}
+
+func (c DistributionHintConfig) applyDefaults() DistributionHintConfig {
+	if c.MaxConnections == 0 {
+		c.MaxConnections = 20
+	}
+	if c.MinLeecherTTI == 0 {
+		c.MinLeecherTTI = time.Minute
+	}
+	if c.MaxLeecherTTI == 0 {
+		c.MaxLeecherTTI = 30 * time.Minute
+	}
+	return c
+}
+
+// LoadHintConfig defines configuration for advertising agent load to the
+// tracker in announce requests.
+type LoadHintConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
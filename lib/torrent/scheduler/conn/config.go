@@ -37,7 +37,37 @@ type Config struct {
 	// is taking a long time to process a message.
 	ReceiverBufferSize int `yaml:"receiver_buffer_size"`
 
+	// KeepAliveInterval is the interval at which keepalive messages are sent
+	// over otherwise idle connections. Peers which predate keepalives log an
+	// error for each keepalive received, so keepalives are disabled by default.
+	KeepAliveInterval time.Duration `yaml:"keepalive_interval"`
+
+	// KeepAliveTimeout closes connections over which nothing was received for
+	// the timeout, e.g. connections left half-open by crashed hosts. It must
+	// be several times the KeepAliveInterval of remote peers, else idle
+	// connections to healthy peers are closed. Disabled by default.
+	KeepAliveTimeout time.Duration `yaml:"keepalive_timeout"`
+
 	Bandwidth bandwidth.Config `yaml:"bandwidth"`
+
+	// Capture records the most recent messages of each connection, which are
+	// dumped by the agent debug api.
+	Capture CaptureConfig `yaml:"capture"`
+}
+
+// CaptureConfig defines message capture of connections.
+type CaptureConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Size is the number of most recent messages captured per connection.
+	Size int `yaml:"size"`
+}
+
+func (c CaptureConfig) applyDefaults() CaptureConfig {
+	if c.Size == 0 {
+		c.Size = 64
+	}
+	return c
 }
 
 func (c Config) applyDefaults() Config {
@@ -56,5 +86,16 @@ func (c Config) applyDefaults() Config {
 	if c.Bandwidth.IngressBitsPerSec == 0 {
 		c.Bandwidth.IngressBitsPerSec = 300 * 8 * memsize.Mbit
 	}
+	c.Capture = c.Capture.applyDefaults()
 	return c
 }
+
+// keepAliveTick returns the interval at which keepalives are checked, or 0 if
+// keepalives are disabled.
+func (c Config) keepAliveTick() time.Duration {
+	tick := c.KeepAliveTimeout / 4
+	if c.KeepAliveInterval > 0 && (tick == 0 || c.KeepAliveInterval < tick) {
+		tick = c.KeepAliveInterval
+	}
+	return tick
+}
@@ -72,6 +72,14 @@ type Conn struct {
 	sender   chan *Message
 	receiver chan *Message
 
+	// Unix nanoseconds at which bytes were last sent / received, for
+	// keepalives.
+	lastSent     *atomic.Int64
+	lastReceived *atomic.Int64
+
+	requests *pendingRequests
+	capture  *messageRing // Nil if capture disabled.
+
 	// The following fields orchestrate the closing of the connection:
 	closed *atomic.Bool
 	done   chan struct{}  // Signals to readLoop / writeLoop to exit.
@@ -100,6 +108,8 @@ func newConn(
 		return nil, fmt.Errorf("set deadline: %s", err)
 	}
 
+	now := clk.Now().UnixNano()
+
 	c := &Conn{
 		peerID:         remotePeerID,
 		infoHash:       info.InfoHash(),
@@ -115,10 +125,16 @@ func newConn(
 		openedByRemote: openedByRemote,
 		sender:         make(chan *Message, config.SenderBufferSize),
 		receiver:       make(chan *Message, config.ReceiverBufferSize),
+		lastSent:       atomic.NewInt64(now),
+		lastReceived:   atomic.NewInt64(now),
+		requests:       newPendingRequests(),
 		closed:         atomic.NewBool(false),
 		done:           make(chan struct{}),
 		logger:         logger,
 	}
+	if config.Capture.Enabled && config.Capture.Size > 0 {
+		c.capture = newMessageRing(config.Capture.Size)
+	}
 
 	return c, nil
 }
@@ -131,6 +147,10 @@ func (c *Conn) Start() {
 		c.wg.Add(2)
 		go c.readLoop()
 		go c.writeLoop()
+		if tick := c.config.keepAliveTick(); tick > 0 {
+			c.wg.Add(1)
+			go c.keepAliveLoop(tick)
+		}
 	})
 }
 
@@ -200,7 +220,7 @@ func (c *Conn) readPayload(length int32) ([]byte, error) {
 		return nil, fmt.Errorf("ingress bandwidth: %s", err)
 	}
 	payload := make([]byte, length)
-	if _, err := io.ReadFull(c.nc, payload); err != nil {
+	if _, err := io.ReadFull(c.reader(), payload); err != nil {
 		return nil, err
 	}
 	c.countBandwidth("ingress", int64(8*length))
@@ -208,7 +228,7 @@ func (c *Conn) readPayload(length int32) ([]byte, error) {
 }
 
 func (c *Conn) readMessage() (*Message, error) {
-	p2pMessage, err := readMessage(c.nc)
+	p2pMessage, err := readMessage(c.reader())
 	if err != nil {
 		return nil, fmt.Errorf("read message: %s", err)
 	}
@@ -223,6 +243,7 @@ func (c *Conn) readMessage() (*Message, error) {
 		// TODO(codyg): Consider making this reader read directly from the socket.
 		pr = piecereader.NewBuffer(payload)
 	}
+	c.recordMessage(_received, p2pMessage)
 
 	return &Message{p2pMessage, pr}, nil
 }
@@ -246,6 +267,9 @@ func (c *Conn) readLoop() {
 				c.log().Infof("Error reading message from socket, exiting read loop: %s", err)
 				return
 			}
+			if msg.Message.Type == p2p.Message_KEEPALIVE {
+				continue
+			}
 			c.receiver <- msg
 		}
 	}
@@ -278,6 +302,7 @@ func (c *Conn) sendMessage(msg *Message) error {
 			return fmt.Errorf("send piece payload: %s", err)
 		}
 	}
+	c.recordMessage(_sent, msg.Message)
 	return nil
 }
 
@@ -298,10 +323,61 @@ func (c *Conn) writeLoop() {
 				c.log().Infof("Error writing message to socket, exiting write loop: %s", err)
 				return
 			}
+			c.lastSent.Store(c.clk.Now().UnixNano())
+		}
+	}
+}
+
+// keepAliveLoop sends keepalives over c while it is idle, and closes c once
+// nothing was received for the keepalive timeout, such that connections left
+// half-open by crashed hosts do not hold scheduler slots.
+func (c *Conn) keepAliveLoop(tick time.Duration) {
+	defer c.wg.Done()
+
+	ticker := c.clk.Ticker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			now := c.clk.Now()
+			timeout := c.config.KeepAliveTimeout
+			if timeout > 0 && now.Sub(time.Unix(0, c.lastReceived.Load())) >= timeout {
+				c.log().Infof("Closing connection which received nothing for %s", timeout)
+				c.stats.Counter("reaped_conns").Inc(1)
+				c.Close()
+				return
+			}
+			interval := c.config.KeepAliveInterval
+			if interval > 0 && now.Sub(time.Unix(0, c.lastSent.Load())) >= interval {
+				// Send fails only if c is closed or backed up, in which case
+				// keepalives are moot.
+				c.Send(NewKeepAliveMessage())
+			}
 		}
 	}
 }
 
+// reader returns a reader of the underlying connection which records the
+// time at which bytes were last received.
+func (c *Conn) reader() io.Reader {
+	return livenessReader{c}
+}
+
+type livenessReader struct {
+	c *Conn
+}
+
+func (r livenessReader) Read(b []byte) (int, error) {
+	n, err := r.c.nc.Read(b)
+	if n > 0 {
+		r.c.lastReceived.Store(r.c.clk.Now().UnixNano())
+	}
+	return n, err
+}
+
 func (c *Conn) countBandwidth(direction string, n int64) {
 	c.stats.Tagged(map[string]string{
 		"piece_bandwidth_direction": direction,
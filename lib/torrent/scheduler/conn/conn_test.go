@@ -16,8 +16,14 @@ package conn
 import (
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/gen/go/proto/p2p"
+	"github.com/uber/kraken/lib/torrent/storage"
+	"github.com/uber/kraken/lib/torrent/storage/piecereader"
+	"github.com/uber/kraken/utils/testutil"
 )
 
 func TestConnClose(t *testing.T) {
@@ -40,3 +46,115 @@ func TestConnClose(t *testing.T) {
 
 	require.True(c.IsClosed())
 }
+
+func TestConnKeepAlivesKeepIdleConnsOpen(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		KeepAliveInterval: 10 * time.Millisecond,
+		KeepAliveTimeout:  100 * time.Millisecond,
+	}
+	local, remote, cleanup := PipeFixture(config, storage.TorrentInfoFixture(1, 1))
+	defer cleanup()
+
+	time.Sleep(500 * time.Millisecond)
+
+	require.False(local.IsClosed())
+	require.False(remote.IsClosed())
+
+	// Keepalives are not delivered to receivers.
+	select {
+	case msg := <-local.Receiver():
+		require.FailNow("unexpected message", msg)
+	default:
+	}
+}
+
+func TestConnKeepAliveTimeoutClosesIdleConns(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{KeepAliveTimeout: 50 * time.Millisecond}
+	local, remote, cleanup := PipeFixture(config, storage.TorrentInfoFixture(1, 1))
+	defer cleanup()
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		return local.IsClosed() && remote.IsClosed()
+	}))
+}
+
+func TestMessageRing(t *testing.T) {
+	require := require.New(t)
+
+	r := newMessageRing(3)
+	require.Empty(r.snapshot())
+
+	for i := int32(0); i < 5; i++ {
+		r.add(CapturedMessage{Index: i})
+	}
+	var indices []int32
+	for _, m := range r.snapshot() {
+		indices = append(indices, m.Index)
+	}
+	require.Equal([]int32{2, 3, 4}, indices)
+}
+
+func TestConnCapturesRecentMessages(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Capture: CaptureConfig{Enabled: true, Size: 3}}
+	local, remote, cleanup := PipeFixture(config, storage.TorrentInfoFixture(4, 1))
+	defer cleanup()
+
+	require.NoError(local.Send(NewPieceRequestMessage(0, 1)))
+	for i := 1; i < 4; i++ {
+		require.NoError(local.Send(NewAnnouncePieceMessage(i)))
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case <-remote.Receiver():
+		case <-time.After(5 * time.Second):
+			require.FailNow("timed out waiting for message")
+		}
+	}
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		return len(local.Snapshot().Messages) == 3 && local.Snapshot().Messages[2].Index == 3
+	}))
+
+	s := local.Snapshot()
+	for i, m := range s.Messages {
+		require.Equal(_sent, m.Direction)
+		require.Equal(p2p.Message_ANNOUCE_PIECE.String(), m.Type)
+		require.Equal(int32(i+1), m.Index)
+	}
+	require.Equal(1, s.PendingRequests)
+
+	received := remote.Snapshot().Messages
+	require.Len(received, 3)
+	require.Equal(_received, received[0].Direction)
+}
+
+func TestConnWithoutCaptureOmitsMessages(t *testing.T) {
+	c, cleanup := Fixture()
+	defer cleanup()
+
+	require.Nil(t, c.Snapshot().Messages)
+}
+
+func TestConnAnsweredPieceRequestsAreNotPending(t *testing.T) {
+	require := require.New(t)
+
+	local, remote, cleanup := PipeFixture(Config{}, storage.TorrentInfoFixture(4, 1))
+	defer cleanup()
+
+	require.NoError(local.Send(NewPieceRequestMessage(0, 1)))
+	require.NoError(local.Send(NewPieceRequestMessage(1, 1)))
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		return local.Snapshot().PendingRequests == 2
+	}))
+
+	require.NoError(remote.Send(NewPiecePayloadMessage(0, piecereader.NewBuffer([]byte{1}))))
+	msg := <-local.Receiver()
+	require.Equal(p2p.Message_PIECE_PAYLOAD, msg.Message.Type)
+
+	require.Equal(1, local.Snapshot().PendingRequests)
+}
@@ -226,6 +226,16 @@ func NewHandshaker(
 	}, nil
 }
 
+// EgressSaturation returns the fraction of egress bandwidth currently in use.
+func (h *Handshaker) EgressSaturation() float64 {
+	return h.bandwidth.EgressSaturation()
+}
+
+// TotalEgressBytes returns the number of bytes uploaded by h's connections.
+func (h *Handshaker) TotalEgressBytes() int64 {
+	return h.bandwidth.TotalEgressBytes()
+}
+
 // Accept upgrades a raw network connection opened by a remote peer into a
 // PendingConn.
 func (h *Handshaker) Accept(nc net.Conn) (*PendingConn, error) {
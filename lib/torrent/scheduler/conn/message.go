@@ -96,6 +96,15 @@ func NewCompleteMessage() *Message {
 	}
 }
 
+// NewKeepAliveMessage returns a Message for keeping an idle connection alive.
+func NewKeepAliveMessage() *Message {
+	return &Message{
+		Message: &p2p.Message{
+			Type: p2p.Message_KEEPALIVE,
+		},
+	}
+}
+
 func sendMessage(nc net.Conn, msg *p2p.Message) error {
 	data, err := proto.Marshal(msg)
 	if err != nil {
@@ -123,9 +132,9 @@ func sendMessageWithTimeout(nc net.Conn, msg *p2p.Message, timeout time.Duration
 	return sendMessage(nc, msg)
 }
 
-func readMessage(nc net.Conn) (*p2p.Message, error) {
+func readMessage(r io.Reader) (*p2p.Message, error) {
 	var msglen [4]byte
-	if _, err := io.ReadFull(nc, msglen[:]); err != nil {
+	if _, err := io.ReadFull(r, msglen[:]); err != nil {
 		return nil, fmt.Errorf("read message length: %s", err)
 	}
 	dataLen := binary.BigEndian.Uint32(msglen[:])
@@ -133,7 +142,7 @@ func readMessage(nc net.Conn) (*p2p.Message, error) {
 		return nil, fmt.Errorf("message exceeds max size: %d > %d", dataLen, maxMessageSize)
 	}
 	data := make([]byte, dataLen)
-	if _, err := io.ReadFull(nc, data); err != nil {
+	if _, err := io.ReadFull(r, data); err != nil {
 		return nil, fmt.Errorf("read data: %s", err)
 	}
 	p2pMessage := new(p2p.Message)
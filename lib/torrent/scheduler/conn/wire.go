@@ -0,0 +1,198 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conn
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/gen/go/proto/p2p"
+)
+
+// Message directions.
+const (
+	_sent     = "sent"
+	_received = "received"
+)
+
+var _pieceRequestLatencyBuckets = tally.MustMakeExponentialDurationBuckets(time.Millisecond, 2, 16)
+
+// CapturedMessage describes a message sent or received over a Conn. Piece
+// payloads themselves are never captured.
+type CapturedMessage struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Type      string    `json:"type"`
+	Index     int32     `json:"index"`
+	Length    int32     `json:"length,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+func captureMessage(now time.Time, direction string, msg *p2p.Message) CapturedMessage {
+	m := CapturedMessage{
+		Time:      now,
+		Direction: direction,
+		Type:      msg.Type.String(),
+		Index:     -1,
+	}
+	switch msg.Type {
+	case p2p.Message_PIECE_REQUEST:
+		m.Index, m.Length = msg.PieceRequest.Index, msg.PieceRequest.Length
+	case p2p.Message_PIECE_PAYLOAD:
+		m.Index, m.Length = msg.PiecePayload.Index, msg.PiecePayload.Length
+	case p2p.Message_ANNOUCE_PIECE:
+		m.Index = msg.AnnouncePiece.Index
+	case p2p.Message_CANCEL_PIECE:
+		m.Index = msg.CancelPiece.Index
+	case p2p.Message_ERROR:
+		m.Index, m.Error = msg.Error.Index, msg.Error.Error
+	}
+	return m
+}
+
+// messageRing holds the most recent messages of a Conn.
+type messageRing struct {
+	mu       sync.Mutex
+	messages []CapturedMessage
+	next     int
+	full     bool
+}
+
+func newMessageRing(size int) *messageRing {
+	return &messageRing{messages: make([]CapturedMessage, size)}
+}
+
+func (r *messageRing) add(m CapturedMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages[r.next] = m
+	r.next = (r.next + 1) % len(r.messages)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns the messages of r, oldest first.
+func (r *messageRing) snapshot() []CapturedMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]CapturedMessage{}, r.messages[:r.next]...)
+	}
+	result := make([]CapturedMessage, 0, len(r.messages))
+	result = append(result, r.messages[r.next:]...)
+	return append(result, r.messages[:r.next]...)
+}
+
+// pendingRequests tracks when each outstanding piece request of a Conn was
+// sent, to measure how long peers take to answer requests.
+type pendingRequests struct {
+	mu   sync.Mutex
+	sent map[int32]time.Time
+}
+
+func newPendingRequests() *pendingRequests {
+	return &pendingRequests{sent: make(map[int32]time.Time)}
+}
+
+func (p *pendingRequests) add(index int32, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sent[index] = now
+}
+
+// remove returns when the request for index was sent, if it is outstanding.
+func (p *pendingRequests) remove(index int32) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.sent[index]
+	delete(p.sent, index)
+	return t, ok
+}
+
+func (p *pendingRequests) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.sent)
+}
+
+// recordMessage counts msg, measures the latency of piece requests, and
+// captures msg if enabled.
+func (c *Conn) recordMessage(direction string, msg *p2p.Message) {
+	c.stats.Tagged(map[string]string{
+		"message_type": msg.Type.String(),
+		"direction":    direction,
+	}).Counter("messages").Inc(1)
+
+	now := c.clk.Now()
+	m := captureMessage(now, direction, msg)
+	switch {
+	case direction == _sent && msg.Type == p2p.Message_PIECE_REQUEST:
+		c.requests.add(m.Index, now)
+	case direction == _received && msg.Type == p2p.Message_PIECE_PAYLOAD:
+		if sent, ok := c.requests.remove(m.Index); ok {
+			c.stats.Histogram(
+				"piece_request_latency", _pieceRequestLatencyBuckets).RecordDuration(now.Sub(sent))
+		}
+	case direction == _sent && msg.Type == p2p.Message_CANCEL_PIECE,
+		direction == _received && msg.Type == p2p.Message_ERROR:
+		c.requests.remove(m.Index)
+	}
+	if c.capture != nil {
+		c.capture.add(m)
+	}
+}
+
+// Snapshot describes a Conn for debugging.
+type Snapshot struct {
+	PeerID         core.PeerID   `json:"peer_id"`
+	InfoHash       core.InfoHash `json:"info_hash"`
+	CreatedAt      time.Time     `json:"created_at"`
+	OpenedByRemote bool          `json:"opened_by_remote"`
+	LastSent       time.Time     `json:"last_sent"`
+	LastReceived   time.Time     `json:"last_received"`
+
+	// PendingRequests is the number of piece requests sent over the Conn
+	// which were neither answered nor failed.
+	PendingRequests int `json:"pending_requests"`
+
+	// Messages are the most recent messages of the Conn, oldest first. Empty
+	// unless capture is enabled.
+	Messages []CapturedMessage `json:"messages,omitempty"`
+}
+
+// Snapshot returns a snapshot of c.
+func (c *Conn) Snapshot() Snapshot {
+	s := Snapshot{
+		PeerID:          c.peerID,
+		InfoHash:        c.infoHash,
+		CreatedAt:       c.createdAt,
+		OpenedByRemote:  c.openedByRemote,
+		LastSent:        time.Unix(0, c.lastSent.Load()),
+		LastReceived:    time.Unix(0, c.lastReceived.Load()),
+		PendingRequests: c.requests.len(),
+	}
+	if c.capture != nil {
+		s.Messages = c.capture.snapshot()
+	}
+	return s
+}
@@ -90,6 +90,9 @@ type State struct {
 
 	// All blacklisted conns. These do not count towards conn capacity.
 	blacklist map[connKey]*blacklistEntry
+
+	// Per-torrent overrides of MaxOpenConnectionsPerTorrent.
+	maxConns map[core.InfoHash]int
 }
 
 // New creates a new State.
@@ -110,7 +113,27 @@ func New(
 		logger:      logger,
 		conns:       make(map[core.InfoHash]map[core.PeerID]entry),
 		blacklist:   make(map[connKey]*blacklistEntry),
+		maxConns:    make(map[core.InfoHash]int),
+	}
+}
+
+// SetMaxOpenConnections overrides the connection limit of h. A non-positive
+// n restores the configured MaxOpenConnectionsPerTorrent. Existing conns are
+// not closed if h is over its new limit.
+func (s *State) SetMaxOpenConnections(h core.InfoHash, n int) {
+	if n <= 0 {
+		delete(s.maxConns, h)
+		return
+	}
+	s.maxConns[h] = n
+}
+
+// MaxOpenConnections returns the connection limit of h.
+func (s *State) MaxOpenConnections(h core.InfoHash) int {
+	if n, ok := s.maxConns[h]; ok {
+		return n
 	}
+	return s.config.MaxOpenConnectionsPerTorrent
 }
 
 // ActiveConns returns a list of all active connections.
@@ -138,7 +161,7 @@ func (s *State) Saturated(h core.InfoHash) bool {
 			active++
 		}
 	}
-	return active == s.config.MaxOpenConnectionsPerTorrent
+	return active >= s.MaxOpenConnections(h)
 }
 
 // Blacklist blacklists peerID/h for the configured BlacklistDuration.
@@ -180,7 +203,7 @@ func (s *State) ClearBlacklist(h core.InfoHash) {
 // AddPending sets the connection for peerID/h as pending and reserves capacity
 // for it.
 func (s *State) AddPending(peerID core.PeerID, h core.InfoHash, neighbors []core.PeerID) error {
-	if len(s.conns[h]) == s.config.MaxOpenConnectionsPerTorrent {
+	if len(s.conns[h]) >= s.MaxOpenConnections(h) {
 		return ErrTorrentAtCapacity
 	}
 	switch s.get(h, peerID).status {
@@ -307,7 +330,7 @@ func (s *State) delete(h core.InfoHash, peerID core.PeerID) {
 }
 
 func (s *State) capacity(h core.InfoHash) int {
-	return s.config.MaxOpenConnectionsPerTorrent - len(s.conns[h])
+	return s.MaxOpenConnections(h) - len(s.conns[h])
 }
 
 func (s *State) log(args ...interface{}) *zap.SugaredLogger {
@@ -122,6 +122,31 @@ func TestStateAddPendingReservesCapacity(t *testing.T) {
 	require.Equal(ErrTorrentAtCapacity, s.AddPending(core.PeerIDFixture(), h, nil))
 }
 
+func TestStateSetMaxOpenConnections(t *testing.T) {
+	require := require.New(t)
+
+	s := testState(Config{MaxOpenConnectionsPerTorrent: 2}, clock.New())
+
+	h := core.InfoHashFixture()
+	other := core.InfoHashFixture()
+
+	s.SetMaxOpenConnections(h, 3)
+	require.Equal(3, s.MaxOpenConnections(h))
+	require.Equal(2, s.MaxOpenConnections(other))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(s.AddPending(core.PeerIDFixture(), h, nil))
+	}
+	require.Equal(ErrTorrentAtCapacity, s.AddPending(core.PeerIDFixture(), h, nil))
+
+	// Lowering the limit below the current conns keeps h at capacity.
+	s.SetMaxOpenConnections(h, 1)
+	require.Equal(ErrTorrentAtCapacity, s.AddPending(core.PeerIDFixture(), h, nil))
+
+	s.SetMaxOpenConnections(h, 0)
+	require.Equal(2, s.MaxOpenConnections(h))
+}
+
 func TestStateDeletePendingAllowsFutureAddPending(t *testing.T) {
 	require := require.New(t)
 
@@ -16,6 +16,7 @@ package scheduler
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/blobrefresh"
@@ -27,10 +28,34 @@ import (
 	"github.com/uber/kraken/lib/torrent/storage/originstorage"
 	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/tracker/multitracker"
+	"github.com/uber/kraken/tracker/udptracker"
 
 	"github.com/uber-go/tally"
 )
 
+// AgentOption defines an optional NewAgentScheduler parameter.
+type AgentOption func(*agentOptions)
+
+type agentOptions struct {
+	listener net.Listener
+	trackers []multitracker.Tracker
+}
+
+// WithPeerListener serves peer connections on l, which must be bound to the
+// port of the peer context, instead of binding a new listener on start. The
+// scheduler binds the port itself when restarted on reload.
+func WithPeerListener(l net.Listener) AgentOption {
+	return func(o *agentOptions) { o.listener = l }
+}
+
+// WithTrackers announces torrents of namespaces matching trackers to them, and
+// downloads their metainfo from them, instead of the default tracker. Such
+// torrents are always announced over HTTP.
+func WithTrackers(trackers []multitracker.Tracker) AgentOption {
+	return func(o *agentOptions) { o.trackers = trackers }
+}
+
 // NewAgentScheduler creates and starts a ReloadableScheduler configured for an agent.
 func NewAgentScheduler(
 	config Config,
@@ -39,21 +64,83 @@ func NewAgentScheduler(
 	cads *store.CADownloadStore,
 	netevents networkevent.Producer,
 	trackers hashring.PassiveRing,
-	tls *tls.Config) (ReloadableScheduler, error) {
+	tls *tls.Config,
+	opts ...AgentOption) (ReloadableScheduler, error) {
+
+	var o agentOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var announceOpts []announceclient.Option
+	if config.CompactAnnounce {
+		announceOpts = append(announceOpts, announceclient.WithCompactPeers())
+	}
+	var load *loadMonitor
+	if config.LoadHint.Enabled {
+		load = &loadMonitor{cacheDir: cads.CacheDir()}
+		announceOpts = append(announceOpts, announceclient.WithLoadHint(load.hint))
+	}
+	var transfers *transferMonitor
+	if config.ReportTransfers {
+		transfers = new(transferMonitor)
+		announceOpts = append(announceOpts, announceclient.WithTransfer(transfers.transfer))
+	}
+	newAnnounceClient := func(t multitracker.Tracker) announceclient.Client {
+		opts := append([]announceclient.Option{
+			announceclient.WithToken(t.AnnounceToken),
+			announceclient.WithBearerToken(t.BearerToken),
+		}, announceOpts...)
+		return announceclient.New(pctx, t.Ring, t.TLS, opts...)
+	}
+
+	var announceClient announceclient.Client
+	if config.UDPTracker.Addr != "" {
+		udpOpts := []udptracker.ClientOption{udptracker.WithToken(config.AnnounceToken)}
+		if load != nil {
+			udpOpts = append(udpOpts, udptracker.WithLoadHint(load.hint))
+		}
+		if transfers != nil {
+			udpOpts = append(udpOpts, udptracker.WithTransfer(transfers.transfer))
+		}
+		announceClient = udptracker.NewClient(config.UDPTracker, pctx, udpOpts...)
+	} else {
+		announceClient = newAnnounceClient(multitracker.Tracker{
+			Ring:          trackers,
+			TLS:           tls,
+			AnnounceToken: config.AnnounceToken,
+			BearerToken:   config.TrackerBearerToken,
+		})
+	}
+	announceClient = multitracker.NewAnnounceClient(announceClient, o.trackers, newAnnounceClient)
+
+	metaInfoClient := multitracker.NewMetaInfoClient(
+		metainfoclient.New(trackers, tls, metainfoclient.WithBearerToken(config.TrackerBearerToken)),
+		o.trackers,
+		func(t multitracker.Tracker) metainfoclient.Client {
+			return metainfoclient.New(t.Ring, t.TLS, metainfoclient.WithBearerToken(t.BearerToken))
+		})
 
 	s, err := newScheduler(
 		config,
-		agentstorage.NewTorrentArchive(stats, cads, metainfoclient.New(trackers, tls)),
+		agentstorage.NewTorrentArchive(stats, cads, metaInfoClient),
 		stats,
 		pctx,
-		announceclient.New(pctx, trackers, tls),
-		netevents)
+		announceClient,
+		netevents,
+		withTransferMonitor(transfers),
+		withListener(o.listener))
 	if err != nil {
 		return nil, fmt.Errorf("new scheduler: %s", err)
 	}
 
 	aq := func() announcequeue.Queue { return announcequeue.New() }
 	rs := makeReloadable(s, aq)
+	rs.transfers = transfers
+	if load != nil {
+		load.setEgress(s.handshaker)
+		rs.load = load
+	}
 	if err := rs.start(aq()); err != nil {
 		return nil, fmt.Errorf("start: %s", err)
 	}
@@ -31,6 +31,7 @@ import (
 	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 	"github.com/willf/bitset"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"golang.org/x/sync/syncmap"
 )
@@ -78,6 +79,8 @@ type Dispatcher struct {
 	events                Events
 	logger                *zap.SugaredLogger
 	torrentlog            *torrentlog.Logger
+	bytesUploaded         *atomic.Int64
+	bytesDownloaded       *atomic.Int64
 }
 
 // New creates a new Dispatcher.
@@ -147,6 +150,8 @@ func newDispatcher(
 		events:              events,
 		logger:              logger,
 		torrentlog:          tlog,
+		bytesUploaded:       atomic.NewInt64(0),
+		bytesDownloaded:     atomic.NewInt64(0),
 	}, nil
 }
 
@@ -175,6 +180,12 @@ func (d *Dispatcher) Complete() bool {
 	return d.torrent.Complete()
 }
 
+// Transferred returns the number of piece bytes d uploaded to and downloaded
+// from peers.
+func (d *Dispatcher) Transferred() (uploaded, downloaded int64) {
+	return d.bytesUploaded.Load(), d.bytesDownloaded.Load()
+}
+
 // CreatedAt returns when d was created.
 func (d *Dispatcher) CreatedAt() time.Time {
 	return d.createdAt
@@ -516,6 +527,7 @@ func (d *Dispatcher) handlePieceRequest(p *peer, msg *p2p.PieceRequestMessage) {
 
 	p.touchLastPieceSent()
 	p.pstats.incrementPiecesSent()
+	d.bytesUploaded.Add(int64(msg.Length))
 
 	// Assume that the peer successfully received the piece.
 	p.bitfield.Set(uint(i), true)
@@ -548,6 +560,7 @@ func (d *Dispatcher) handlePiecePayload(
 
 	p.pstats.incrementGoodPiecesReceived()
 	p.touchLastGoodPieceReceived()
+	d.bytesDownloaded.Add(int64(msg.Length))
 	if d.torrent.Complete() {
 		d.complete()
 	}
@@ -343,6 +343,35 @@ func TestDispatcherHandlePiecePayloadAnnouncesPiece(t *testing.T) {
 	require.Equal([]int{0}, announcedPieces(p2.messages))
 }
 
+func TestDispatcherCountsTransferredBytes(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(4, 2)
+
+	torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+	defer cleanup()
+
+	d := testDispatcher(Config{}, clock.NewMock(), torrent)
+
+	p1, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(true, true), newMockMessages())
+	require.NoError(err)
+
+	p2, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(false, false), newMockMessages())
+	require.NoError(err)
+
+	require.NoError(d.dispatch(p1, conn.NewPiecePayloadMessage(0, piecereader.NewBuffer(blob.Content[0:2]))))
+
+	uploaded, downloaded := d.Transferred()
+	require.Equal(int64(0), uploaded)
+	require.Equal(int64(2), downloaded)
+
+	require.NoError(d.dispatch(p2, conn.NewPieceRequestMessage(0, 2)))
+
+	uploaded, downloaded = d.Transferred()
+	require.Equal(int64(2), uploaded)
+	require.Equal(int64(2), downloaded)
+}
+
 func TestDispatcherHandlePiecePayloadSendsCompleteMessage(t *testing.T) {
 	require := require.New(t)
 
@@ -247,7 +247,10 @@ func (e announceTickEvent) apply(s *state) {
 			continue
 		}
 		go s.sched.announce(
-			ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), ctrl.dispatcher.Complete())
+			ctrl.namespace,
+			ctrl.dispatcher.Digest(),
+			ctrl.dispatcher.InfoHash(),
+			ctrl.dispatcher.Complete())
 		break
 	}
 	// Re-enqueue any torrents we pulled off and ignored, else we would never
@@ -337,7 +340,11 @@ func (e newTorrentEvent) apply(s *state) {
 	ctrl.errors = append(ctrl.errors, e.errc)
 
 	// Immediately announce new torrents.
-	go s.sched.announce(ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), ctrl.dispatcher.Complete())
+	go s.sched.announce(
+		ctrl.namespace,
+		ctrl.dispatcher.Digest(),
+		ctrl.dispatcher.InfoHash(),
+		ctrl.dispatcher.Complete())
 }
 
 // dispatcherCompleteEvent occurs when a dispatcher finishes downloading its torrent.
@@ -374,7 +381,7 @@ func (e dispatcherCompleteEvent) apply(s *state) {
 	s.sched.netevents.Produce(networkevent.TorrentCompleteEvent(infoHash, s.sched.pctx.PeerID))
 
 	// Immediately announce completed torrents.
-	go s.sched.announce(ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), true)
+	go s.sched.announce(ctrl.namespace, ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), true)
 }
 
 // peerRemovedEvent occurs when a dispatcher removes a peer with a closed
@@ -425,7 +432,7 @@ func (e preemptionTickEvent) apply(s *state) {
 
 		idleLeecher :=
 			!ctrl.dispatcher.Complete() &&
-				s.sched.clock.Now().Sub(ctrl.dispatcher.LastWriteTime()) >= s.sched.config.LeecherTTI
+				s.sched.clock.Now().Sub(ctrl.dispatcher.LastWriteTime()) >= ctrl.leecherTTI
 		if idleLeecher {
 			s.sched.torrentlog.LeechTimeout(ctrl.dispatcher.Digest(), h)
 		}
@@ -452,6 +459,27 @@ func (e blacklistSnapshotEvent) apply(s *state) {
 	e.result <- s.conns.BlacklistSnapshot()
 }
 
+type connSnapshotEvent struct {
+	result chan []conn.Snapshot
+}
+
+func (e connSnapshotEvent) apply(s *state) {
+	var snapshots []conn.Snapshot
+	for _, c := range s.conns.ActiveConns() {
+		snapshots = append(snapshots, c.Snapshot())
+	}
+	e.result <- snapshots
+}
+
+// activeTorrentsEvent occurs when the number of active torrents is requested.
+type activeTorrentsEvent struct {
+	result chan int
+}
+
+func (e activeTorrentsEvent) apply(s *state) {
+	e.result <- len(s.torrentControls)
+}
+
 // removeTorrentEvent occurs when a torrent is manually removed via scheduler API.
 type removeTorrentEvent struct {
 	digest core.Digest
@@ -139,6 +139,7 @@ func TestAnnounceTickEvent(t *testing.T) {
 	// First torrent should announce.
 	mocks.announceClient.EXPECT().
 		Announce(
+			_testNamespace,
 			ctrls[0].dispatcher.Digest(),
 			ctrls[0].dispatcher.InfoHash(),
 			false,
@@ -184,6 +185,7 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 	// torrent.
 	mocks.announceClient.EXPECT().
 		Announce(
+			_testNamespace,
 			empty.dispatcher.Digest(),
 			empty.dispatcher.InfoHash(),
 			false,
@@ -216,6 +218,7 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 
 	mocks.announceClient.EXPECT().
 		Announce(
+			_testNamespace,
 			full.dispatcher.Digest(),
 			full.dispatcher.InfoHash(),
 			false,
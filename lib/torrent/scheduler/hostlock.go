@@ -0,0 +1,111 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// HostDedupConfig defines configuration for deduplicating downloads between
+// agents which share a host, e.g. replicas of the same service co-located on
+// one machine. Agents take a per-blob lock in a directory shared between
+// them, such that only one agent downloads each blob from remote peers while
+// the others wait, and then download from the co-located agent instead.
+type HostDedupConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// LockDir is the directory holding download locks. It must be shared by
+	// every agent on the host, e.g. via a host path mount.
+	LockDir string `yaml:"lock_dir"`
+
+	// MaxWait bounds how long a download waits for a co-located agent to
+	// finish the same blob, after which the download proceeds regardless.
+	MaxWait time.Duration `yaml:"max_wait"`
+
+	// PollInterval is the interval in which waiting downloads retry the lock.
+	PollInterval time.Duration `yaml:"poll_interval"`
+}
+
+func (c HostDedupConfig) applyDefaults() HostDedupConfig {
+	if c.MaxWait == 0 {
+		c.MaxWait = 5 * time.Minute
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = 100 * time.Millisecond
+	}
+	return c
+}
+
+var errHostLockTimeout = errors.New("timed out waiting for host download lock")
+
+// hostLocker serializes downloads of the same blob across processes on a host
+// using advisory file locks, which the kernel releases if the holder crashes.
+type hostLocker struct {
+	config HostDedupConfig
+}
+
+func newHostLocker(config HostDedupConfig) (*hostLocker, error) {
+	config = config.applyDefaults()
+	if config.LockDir == "" {
+		return nil, errors.New("no lock dir configured")
+	}
+	if err := os.MkdirAll(config.LockDir, 0775); err != nil {
+		return nil, fmt.Errorf("mkdir: %s", err)
+	}
+	return &hostLocker{config}, nil
+}
+
+// lock acquires the host-wide download lock for d, waiting until it is
+// released by co-located agents or MaxWait elapses. Returns whether lock had
+// to wait, and a function which releases the lock. If the wait times out,
+// errHostLockTimeout is returned alongside a no-op release, and callers
+// should download regardless.
+func (l *hostLocker) lock(d core.Digest) (waited bool, release func(), err error) {
+	noop := func() {}
+
+	f, err := os.OpenFile(
+		filepath.Join(l.config.LockDir, d.Hex()+".lock"), os.O_CREATE|os.O_RDWR, 0664)
+	if err != nil {
+		return false, noop, fmt.Errorf("open: %s", err)
+	}
+	deadline := time.Now().Add(l.config.MaxWait)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			f.Close()
+			return waited, noop, fmt.Errorf("flock: %s", err)
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return waited, noop, errHostLockTimeout
+		}
+		waited = true
+		time.Sleep(l.config.PollInterval)
+	}
+	return waited, func() {
+		// Closing the file releases the lock. The lock file itself is left in
+		// place, since removing it races with agents about to lock it.
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func hostLockerFixture(t *testing.T, maxWait time.Duration) (*hostLocker, func()) {
+	dir, err := ioutil.TempDir("", "hostlock")
+	require.NoError(t, err)
+	l, err := newHostLocker(HostDedupConfig{
+		Enabled:      true,
+		LockDir:      dir,
+		MaxWait:      maxWait,
+		PollInterval: 5 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	return l, func() { os.RemoveAll(dir) }
+}
+
+func TestHostLockerWaitsForRelease(t *testing.T) {
+	require := require.New(t)
+
+	l, cleanup := hostLockerFixture(t, time.Minute)
+	defer cleanup()
+
+	d := core.DigestFixture()
+
+	waited, release, err := l.lock(d)
+	require.NoError(err)
+	require.False(waited)
+
+	acquired := make(chan bool)
+	go func() {
+		waited, release, err := l.lock(d)
+		if err == nil {
+			release()
+		}
+		acquired <- waited && err == nil
+	}()
+
+	select {
+	case <-acquired:
+		require.FailNow("lock acquired while held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	require.True(<-acquired)
+}
+
+func TestHostLockerTimesOut(t *testing.T) {
+	require := require.New(t)
+
+	l, cleanup := hostLockerFixture(t, 20*time.Millisecond)
+	defer cleanup()
+
+	d := core.DigestFixture()
+
+	_, release, err := l.lock(d)
+	require.NoError(err)
+	defer release()
+
+	waited, _, err := l.lock(d)
+	require.Equal(errHostLockTimeout, err)
+	require.True(waited)
+}
+
+func TestHostLockerLocksDigestsIndependently(t *testing.T) {
+	require := require.New(t)
+
+	l, cleanup := hostLockerFixture(t, 20*time.Millisecond)
+	defer cleanup()
+
+	_, release, err := l.lock(core.DigestFixture())
+	require.NoError(err)
+	defer release()
+
+	waited, release2, err := l.lock(core.DigestFixture())
+	require.NoError(err)
+	require.False(waited)
+	release2()
+}
+
+func TestNewHostLockerRequiresLockDir(t *testing.T) {
+	_, err := newHostLocker(HostDedupConfig{Enabled: true})
+	require.Error(t, err)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"sync"
+
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/osutil"
+)
+
+// egressMeter reports the fraction of egress bandwidth currently in use, and
+// the number of bytes uploaded so far.
+type egressMeter interface {
+	EgressSaturation() float64
+	TotalEgressBytes() int64
+}
+
+// loadMonitor computes the load hint attached to agent announce requests.
+type loadMonitor struct {
+	cacheDir string
+
+	mu     sync.Mutex
+	egress egressMeter
+
+	// uploaded is the number of bytes uploaded by previous egress meters,
+	// such that reloads do not reset the uploaded bytes reported.
+	uploaded int64
+}
+
+// setEgress swaps the egress meter, e.g. when the scheduler is reloaded.
+func (m *loadMonitor) setEgress(e egressMeter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.egress != nil {
+		m.uploaded += m.egress.TotalEgressBytes()
+	}
+	m.egress = e
+}
+
+func (m *loadMonitor) hint() *announceclient.LoadHint {
+	var h announceclient.LoadHint
+	m.mu.Lock()
+	egress := m.egress
+	h.Uploaded = m.uploaded
+	m.mu.Unlock()
+	if egress != nil {
+		h.UploadSaturation = egress.EgressSaturation()
+		h.Uploaded += egress.TotalEgressBytes()
+	}
+	if u, err := osutil.DiskUtilization(m.cacheDir); err != nil {
+		log.Warnf("Error computing disk pressure of %s: %s", m.cacheDir, err)
+	} else {
+		h.DiskPressure = u
+	}
+	return &h
+}
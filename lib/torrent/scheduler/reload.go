@@ -31,6 +31,12 @@ type reloadableScheduler struct {
 	*scheduler
 	mu sync.Mutex // Protects reloading Scheduler.
 	aq func() announcequeue.Queue
+
+	// load is optional and is re-pointed at each new scheduler's handshaker.
+	load *loadMonitor
+
+	// transfers is optional and is shared by each new scheduler.
+	transfers *transferMonitor
 }
 
 func makeReloadable(s *scheduler, aq func() announcequeue.Queue) *reloadableScheduler {
@@ -55,11 +61,15 @@ func (rs *reloadableScheduler) reload(config Config) error {
 	s.Stop()
 
 	n, err := newScheduler(
-		config, s.torrentArchive, s.stats, s.pctx, s.announceClient, s.netevents)
+		config, s.torrentArchive, s.stats, s.pctx, s.announceClient, s.netevents,
+		withTransferMonitor(rs.transfers))
 	if err != nil {
 		return fmt.Errorf("create new scheduler: %s", err)
 	}
 	rs.scheduler = n
+	if rs.load != nil {
+		rs.load.setEgress(n.handshaker)
+	}
 
 	if err := rs.scheduler.start(rs.aq()); err != nil {
 		return fmt.Errorf("start new scheduler: %s", err)
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/andres-erbsen/clock"
@@ -50,8 +51,19 @@ type Scheduler interface {
 	Stop()
 	Download(namespace string, d core.Digest) error
 	BlacklistSnapshot() ([]connstate.BlacklistedConn, error)
+	ConnSnapshot() ([]conn.Snapshot, error)
 	RemoveTorrent(d core.Digest) error
 	Probe() error
+	Summary() (Summary, error)
+}
+
+// Summary summarizes the state of a Scheduler.
+type Summary struct {
+	ActiveTorrents int
+
+	// DownloadErrors is the number of failed downloads since the Scheduler
+	// started.
+	DownloadErrors int64
 }
 
 // scheduler manages global state for the peer. This includes:
@@ -62,6 +74,9 @@ type Scheduler interface {
 // - Dispatching connections to torrents.
 // - Pre-empting existing connections when better options are available (TODO).
 type scheduler struct {
+	// Accessed atomically. Must be first for 64-bit alignment.
+	downloadErrors int64
+
 	pctx           core.PeerContext
 	config         Config
 	clock          clock.Clock
@@ -86,6 +101,11 @@ type scheduler struct {
 
 	torrentlog *torrentlog.Logger
 
+	// transfers is optional and reports the bytes transferred per torrent.
+	transfers *transferMonitor
+
+	hostLocks *hostLocker // Nil if host download dedup is disabled.
+
 	logger *zap.SugaredLogger
 
 	// The following fields orchestrate the stopping of the scheduler.
@@ -99,6 +119,8 @@ type scheduler struct {
 type schedOverrides struct {
 	clock     clock.Clock
 	eventLoop eventLoop
+	transfers *transferMonitor
+	listener  net.Listener
 }
 
 type option func(*schedOverrides)
@@ -111,6 +133,14 @@ func withEventLoop(l eventLoop) option {
 	return func(o *schedOverrides) { o.eventLoop = l }
 }
 
+func withTransferMonitor(m *transferMonitor) option {
+	return func(o *schedOverrides) { o.transfers = m }
+}
+
+func withListener(l net.Listener) option {
+	return func(o *schedOverrides) { o.listener = l }
+}
+
 // newScheduler creates and starts a scheduler.
 func newScheduler(
 	config Config,
@@ -161,6 +191,14 @@ func newScheduler(
 		return nil, fmt.Errorf("torrentlog: %s", err)
 	}
 
+	var hostLocks *hostLocker
+	if config.HostDedup.Enabled {
+		hostLocks, err = newHostLocker(config.HostDedup)
+		if err != nil {
+			return nil, fmt.Errorf("host dedup: %s", err)
+		}
+	}
+
 	s := &scheduler{
 		pctx:           pctx,
 		config:         config,
@@ -172,9 +210,12 @@ func newScheduler(
 		preemptionTick: preemptionTick,
 		emitStatsTick:  overrides.clock.Tick(config.EmitStatsInterval),
 		announceClient: announceClient,
-		announcer:      announcer.Default(announceClient, eventLoop, overrides.clock, slogger),
+		announcer:      announcer.New(config.Announcer, announceClient, eventLoop, overrides.clock, slogger),
 		netevents:      netevents,
 		torrentlog:     tlog,
+		transfers:      overrides.transfers,
+		hostLocks:      hostLocks,
+		listener:       overrides.listener,
 		logger:         slogger,
 		done:           done,
 	}
@@ -198,11 +239,15 @@ func (s *scheduler) start(aq announcequeue.Queue) error {
 		"Scheduler starting as peer %s on addr %s:%d",
 		s.pctx.PeerID, s.pctx.IP, s.pctx.Port)
 
-	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.pctx.Port))
-	if err != nil {
-		return err
+	// The listener may already be bound by the caller, e.g. if the port was
+	// picked from a range.
+	if s.listener == nil {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.pctx.Port))
+		if err != nil {
+			return err
+		}
+		s.listener = l
 	}
-	s.listener = l
 
 	s.wg.Add(4)
 	go s.runEventLoop(aq) // Careful, this should be the only reference to aq.
@@ -240,6 +285,11 @@ func (s *scheduler) doDownload(namespace string, d core.Digest) (size int64, err
 		return 0, fmt.Errorf("create torrent: %s", err)
 	}
 
+	if s.hostLocks != nil && !t.Complete() {
+		release := s.lockHost(d)
+		defer release()
+	}
+
 	// Buffer size of 1 so sends do not block.
 	errc := make(chan error, 1)
 	if !s.eventLoop.send(newTorrentEvent{namespace, t, errc}) {
@@ -248,6 +298,25 @@ func (s *scheduler) doDownload(namespace string, d core.Digest) (size int64, err
 	return t.Length(), <-errc
 }
 
+// lockHost waits until no co-located agent is downloading d, such that d is
+// only fetched from remote peers once per host. Once the lock is acquired,
+// agents which waited find d seeded by the co-located agent. Lock errors are
+// logged and do not fail the download.
+func (s *scheduler) lockHost(d core.Digest) (release func()) {
+	waited, release, err := s.hostLocks.lock(d)
+	if waited {
+		s.stats.Counter("host_dedup_waits").Inc(1)
+	}
+	if err == errHostLockTimeout {
+		s.stats.Counter("host_dedup_timeouts").Inc(1)
+		s.log("digest", d).Warn("Downloading without host lock: co-located download did not finish in time")
+	} else if err != nil {
+		s.stats.Counter("host_dedup_errors").Inc(1)
+		s.log("digest", d).Errorf("Error locking host download: %s", err)
+	}
+	return release
+}
+
 // Download downloads the torrent given metainfo. Once the torrent is downloaded,
 // it will begin seeding asynchronously.
 func (s *scheduler) Download(namespace string, d core.Digest) error {
@@ -270,6 +339,7 @@ func (s *scheduler) Download(namespace string, d core.Digest) error {
 		s.stats.Tagged(map[string]string{
 			"error": errTag,
 		}).Counter("download_errors").Inc(1)
+		atomic.AddInt64(&s.downloadErrors, 1)
 		s.torrentlog.DownloadFailure(namespace, d, size, err)
 	} else {
 		downloadTime := time.Since(start)
@@ -288,6 +358,15 @@ func (s *scheduler) BlacklistSnapshot() ([]connstate.BlacklistedConn, error) {
 	return <-result, nil
 }
 
+// ConnSnapshot returns a snapshot of all active connections.
+func (s *scheduler) ConnSnapshot() ([]conn.Snapshot, error) {
+	result := make(chan []conn.Snapshot)
+	if !s.eventLoop.send(connSnapshotEvent{result}) {
+		return nil, ErrSchedulerStopped
+	}
+	return <-result, nil
+}
+
 // RemoveTorrent forcibly stops leeching / seeding torrent for d and removes
 // the torrent from disk.
 func (s *scheduler) RemoveTorrent(d core.Digest) error {
@@ -299,6 +378,18 @@ func (s *scheduler) RemoveTorrent(d core.Digest) error {
 	return <-errc
 }
 
+// Summary returns a summary of the scheduler's current state.
+func (s *scheduler) Summary() (Summary, error) {
+	result := make(chan int)
+	if !s.eventLoop.send(activeTorrentsEvent{result}) {
+		return Summary{}, ErrSchedulerStopped
+	}
+	return Summary{
+		ActiveTorrents: <-result,
+		DownloadErrors: atomic.LoadInt64(&s.downloadErrors),
+	}, nil
+}
+
 // Probe verifies that the scheduler event loop is running and unblocked.
 func (s *scheduler) Probe() error {
 	return s.eventLoop.sendTimeout(probeEvent{}, s.config.ProbeTimeout)
@@ -357,8 +448,8 @@ func (s *scheduler) announceLoop() {
 	s.announcer.Ticker(s.done)
 }
 
-func (s *scheduler) announce(d core.Digest, h core.InfoHash, complete bool) {
-	peers, err := s.announcer.Announce(d, h, complete)
+func (s *scheduler) announce(namespace string, d core.Digest, h core.InfoHash, complete bool) {
+	peers, err := s.announcer.Announce(namespace, d, h, complete)
 	if err != nil {
 		if err != announceclient.ErrDisabled {
 			s.eventLoop.send(announceErrEvent{h, err})
@@ -398,7 +489,7 @@ func (s *scheduler) establishIncomingHandshake(pc *conn.PendingConn, rb conn.Rem
 func (s *scheduler) initializeOutgoingHandshake(
 	p *core.PeerInfo, info *storage.TorrentInfo, rb conn.RemoteBitfields, namespace string) {
 
-	addr := fmt.Sprintf("%s:%d", p.IP, p.Port)
+	addr := p.Addr()
 	result, err := s.handshaker.Initialize(p.PeerID, addr, info, rb, namespace)
 	if err != nil {
 		s.log(
@@ -190,6 +190,10 @@ func TestSeederTTI(t *testing.T) {
 	seeder.writeTorrent(namespace, blob)
 	require.NoError(seeder.scheduler.Download(namespace, blob.Digest))
 
+	// The leecher only announces once since the clock is mocked, so the seeder
+	// must be known to the tracker by then.
+	w.waitFor(t, announceResultEvent{})
+
 	leecher := mocks.newPeer(config, withClock(clk))
 
 	errc := make(chan error)
@@ -313,6 +317,7 @@ func TestNetworkEvents(t *testing.T) {
 	config := configFixture()
 	config.ConnTTI = 2 * time.Second
 	config.ConnState.BlacklistDuration = 30 * time.Second
+	config.ConnState.MaxOpenConnectionsPerTorrent = 5
 
 	seeder := mocks.newPeer(config)
 	leecher := mocks.newPeer(config)
@@ -386,7 +391,7 @@ func TestPullInactiveTorrent(t *testing.T) {
 	// Force announce the scheduler for this torrent to simulate a peer which
 	// is registered in tracker but does not have the torrent in memory.
 	ac := announceclient.New(seeder.pctx, hashring.NoopPassiveRing(hostlist.Fixture(mocks.trackerAddr)), nil)
-	ac.Announce(blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V1)
+	ac.Announce(namespace, blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V1)
 
 	leecher := mocks.newPeer(config)
 
@@ -473,6 +478,39 @@ func TestSchedulerProbe(t *testing.T) {
 	require.Equal(ErrSchedulerStopped, p.scheduler.Probe())
 }
 
+func TestSchedulerSummary(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	w := newEventWatcher()
+
+	p := mocks.newPeer(configFixture(), withEventLoop(w))
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mocks.metaInfoClient.EXPECT().Download(
+		namespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	errc := make(chan error)
+	go func() { errc <- p.scheduler.Download(namespace, blob.Digest) }()
+
+	w.waitFor(t, newTorrentEvent{})
+
+	summary, err := p.scheduler.Summary()
+	require.NoError(err)
+	require.Equal(Summary{ActiveTorrents: 1}, summary)
+
+	require.NoError(p.scheduler.RemoveTorrent(blob.Digest))
+	require.Equal(ErrTorrentRemoved, <-errc)
+
+	summary, err = p.scheduler.Summary()
+	require.NoError(err)
+	require.Equal(Summary{ActiveTorrents: 0, DownloadErrors: 1}, summary)
+}
+
 type deadlockEvent struct {
 	release chan struct{}
 }
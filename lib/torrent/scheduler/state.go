@@ -16,6 +16,7 @@ package scheduler
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/torrent/networkevent"
@@ -35,6 +36,10 @@ type torrentControl struct {
 	dispatcher   *dispatch.Dispatcher
 	errors       []chan error
 	localRequest bool
+
+	// leecherTTI is the duration the torrent may be leeched without progress
+	// before it is cancelled.
+	leecherTTI time.Duration
 }
 
 // state is a superset of scheduler, which includes protected state which can
@@ -86,17 +91,51 @@ func (s *state) addTorrent(
 		namespace:    namespace,
 		dispatcher:   d,
 		localRequest: localRequest,
+		leecherTTI:   s.sched.config.LeecherTTI,
+	}
+	if ht, ok := t.(storage.HintedTorrent); ok && s.sched.config.DistributionHints.Enabled {
+		s.applyHint(t.InfoHash(), ctrl, ht.DistributionHint())
 	}
 	s.announceQueue.Add(t.InfoHash())
+	s.sched.transfers.track(d)
 	s.sched.netevents.Produce(networkevent.AddTorrentEvent(
 		t.InfoHash(),
 		s.sched.pctx.PeerID,
 		t.Bitfield(),
-		s.sched.config.ConnState.MaxOpenConnectionsPerTorrent))
+		s.conns.MaxOpenConnections(t.InfoHash())))
 	s.torrentControls[t.InfoHash()] = ctrl
 	return ctrl, nil
 }
 
+// applyHint tunes the connection limit and leecher TTI of the torrent h
+// according to hint, which may be nil.
+func (s *state) applyHint(h core.InfoHash, ctrl *torrentControl, hint *core.DistributionHint) {
+	if hint == nil {
+		return
+	}
+	config := s.sched.config.DistributionHints
+	if hint.MaxConnections > 0 {
+		n := hint.MaxConnections
+		if n > config.MaxConnections {
+			n = config.MaxConnections
+		}
+		s.conns.SetMaxOpenConnections(h, n)
+	}
+	if hint.StallTimeout > 0 {
+		ttl := hint.StallTimeout
+		if ttl < config.MinLeecherTTI {
+			ttl = config.MinLeecherTTI
+		}
+		if ttl > config.MaxLeecherTTI {
+			ttl = config.MaxLeecherTTI
+		}
+		ctrl.leecherTTI = ttl
+	}
+	s.log("hash", h, "seeders", hint.Seeders, "leechers", hint.Leechers).Infof(
+		"Applied distribution hint: max conns %d, leecher tti %s",
+		s.conns.MaxOpenConnections(h), ctrl.leecherTTI)
+}
+
 // removeTorrent tears down the torrentControl associated with h, sending err to
 // all clients waiting on this torrent.
 func (s *state) removeTorrent(h core.InfoHash, err error) {
@@ -113,6 +152,8 @@ func (s *state) removeTorrent(h core.InfoHash, err error) {
 		s.sched.netevents.Produce(networkevent.TorrentCancelledEvent(h, s.sched.pctx.PeerID))
 		s.sched.torrentArchive.DeleteTorrent(ctrl.dispatcher.Digest())
 	}
+	s.conns.SetMaxOpenConnections(h, 0)
+	s.sched.transfers.untrack(h)
 	delete(s.torrentControls, h)
 }
 
@@ -0,0 +1,89 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/torrent/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+type hintedTorrent struct {
+	storage.Torrent
+	hint *core.DistributionHint
+}
+
+func (t hintedTorrent) DistributionHint() *core.DistributionHint { return t.hint }
+
+func TestAddTorrentAppliesDistributionHint(t *testing.T) {
+	tests := []struct {
+		desc          string
+		enabled       bool
+		hint          *core.DistributionHint
+		expectedConns int
+		expectedTTI   time.Duration
+	}{
+		{
+			"disabled",
+			false,
+			&core.DistributionHint{MaxConnections: 15, StallTimeout: 10 * time.Minute},
+			10,
+			5 * time.Minute,
+		}, {
+			"no hint",
+			true,
+			nil,
+			10,
+			5 * time.Minute,
+		}, {
+			"within bounds",
+			true,
+			&core.DistributionHint{MaxConnections: 15, StallTimeout: 10 * time.Minute},
+			15,
+			10 * time.Minute,
+		}, {
+			"clamped",
+			true,
+			&core.DistributionHint{MaxConnections: 100, StallTimeout: time.Second},
+			20,
+			time.Minute,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newStateMocks(t)
+			defer cleanup()
+
+			config := Config{}.applyDefaults()
+			config.DistributionHints.Enabled = test.enabled
+			state := mocks.newState(config)
+
+			tor := hintedTorrent{mocks.newTorrent(), test.hint}
+			ctrl, err := state.addTorrent(_testNamespace, tor, true)
+			require.NoError(err)
+
+			require.Equal(test.expectedConns, state.conns.MaxOpenConnections(tor.InfoHash()))
+			require.Equal(test.expectedTTI, ctrl.leecherTTI)
+
+			state.removeTorrent(tor.InfoHash(), ErrTorrentTimeout)
+			require.Equal(10, state.conns.MaxOpenConnections(tor.InfoHash()))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
+	"github.com/uber/kraken/tracker/announceclient"
+
+	"golang.org/x/sync/syncmap"
+)
+
+// transferMonitor reports the bytes transferred for each active torrent in
+// announce requests. A nil transferMonitor is valid and tracks nothing.
+type transferMonitor struct {
+	dispatchers syncmap.Map // core.InfoHash -> *dispatch.Dispatcher
+}
+
+func (m *transferMonitor) track(d *dispatch.Dispatcher) {
+	if m == nil {
+		return
+	}
+	m.dispatchers.Store(d.InfoHash(), d)
+}
+
+func (m *transferMonitor) untrack(h core.InfoHash) {
+	if m == nil {
+		return
+	}
+	m.dispatchers.Delete(h)
+}
+
+// transfer returns the bytes transferred for h, or nil if h is not active.
+func (m *transferMonitor) transfer(h core.InfoHash) *announceclient.Transfer {
+	v, ok := m.dispatchers.Load(h)
+	if !ok {
+		return nil
+	}
+	uploaded, downloaded := v.(*dispatch.Dispatcher).Transferred()
+	return &announceclient.Transfer{Uploaded: uploaded, Downloaded: downloaded}
+}
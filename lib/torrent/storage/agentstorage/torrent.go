@@ -39,6 +39,8 @@ var (
 type caDownloadStore interface {
 	MoveDownloadFileToCache(name string) error
 	GetDownloadFileReadWriter(name string) (store.FileReadWriter, error)
+	Encrypted(name string) (bool, error)
+	WriteEncryptedChunk(name string, i int, b []byte) error
 	Any() *store.CADownloadStoreScope
 	Download() *store.CADownloadStoreScope
 	InCacheError(error) bool
@@ -54,6 +56,13 @@ type Torrent struct {
 	pieces      []*piece
 	numComplete *atomic.Int32
 	committed   *atomic.Bool
+
+	// encrypted is true if pieces are encrypted at rest.
+	encrypted bool
+
+	// hint is the distribution hint received alongside metainfo, if any. Only
+	// set on torrents whose metainfo was just downloaded.
+	hint *core.DistributionHint
 }
 
 // NewTorrent creates a new Torrent.
@@ -63,6 +72,11 @@ func NewTorrent(cads caDownloadStore, mi *core.MetaInfo) (*Torrent, error) {
 		return nil, fmt.Errorf("restore pieces: %s", err)
 	}
 
+	encrypted, err := cads.Encrypted(mi.Digest().Hex())
+	if err != nil {
+		return nil, fmt.Errorf("check encryption: %s", err)
+	}
+
 	committed := false
 	if numComplete == len(pieces) {
 		if err := cads.MoveDownloadFileToCache(mi.Digest().Hex()); err != nil && !os.IsExist(err) {
@@ -77,9 +91,15 @@ func NewTorrent(cads caDownloadStore, mi *core.MetaInfo) (*Torrent, error) {
 		pieces:      pieces,
 		numComplete: atomic.NewInt32(int32(numComplete)),
 		committed:   atomic.NewBool(committed),
+		encrypted:   encrypted,
 	}, nil
 }
 
+// DistributionHint returns the distribution hint of t, or nil if it has none.
+func (t *Torrent) DistributionHint() *core.DistributionHint {
+	return t.hint
+}
+
 // Digest returns the digest of the target blob.
 func (t *Torrent) Digest() core.Digest {
 	return t.metaInfo.Digest()
@@ -173,6 +193,10 @@ func (t *Torrent) markPieceComplete(pi int) error {
 
 // writePiece writes data to piece pi. If the write succeeds, marks the piece as completed.
 func (t *Torrent) writePiece(src storage.PieceReader, pi int) error {
+	if t.encrypted {
+		return t.writeEncryptedPiece(src, pi)
+	}
+
 	f, err := t.cads.GetDownloadFileReadWriter(t.metaInfo.Digest().Hex())
 	if err != nil {
 		return fmt.Errorf("get download writer: %s", err)
@@ -198,6 +222,27 @@ func (t *Torrent) writePiece(src storage.PieceReader, pi int) error {
 	return nil
 }
 
+// writeEncryptedPiece buffers piece pi in memory, such that it is verified
+// before being encrypted and written.
+func (t *Torrent) writeEncryptedPiece(src storage.PieceReader, pi int) error {
+	b := make([]byte, t.PieceLength(pi))
+	if _, err := io.ReadFull(src, b); err != nil {
+		return fmt.Errorf("read: %s", err)
+	}
+	h := core.PieceHash()
+	h.Write(b)
+	if h.Sum32() != t.metaInfo.GetPieceSum(pi) {
+		return errors.New("invalid piece sum")
+	}
+	if err := t.cads.WriteEncryptedChunk(t.Digest().Hex(), pi, b); err != nil {
+		return fmt.Errorf("write encrypted piece: %s", err)
+	}
+	if err := t.markPieceComplete(pi); err != nil {
+		return fmt.Errorf("mark piece complete: %s", err)
+	}
+	return nil
+}
+
 // WritePiece writes data to piece pi.
 func (t *Torrent) WritePiece(src storage.PieceReader, pi int) error {
 	piece, err := t.getPiece(pi)
@@ -73,9 +73,11 @@ func (a *TorrentArchive) Stat(namespace string, d core.Digest) (*storage.Torrent
 // if no metainfo was found.
 func (a *TorrentArchive) CreateTorrent(namespace string, d core.Digest) (storage.Torrent, error) {
 	var tm metadata.TorrentMeta
+	var hint *core.DistributionHint
 	if err := a.cads.Any().GetMetadata(d.Hex(), &tm); os.IsNotExist(err) {
 		downloadTimer := a.stats.Timer("metainfo_download").Start()
-		mi, err := a.metaInfoClient.Download(namespace, d)
+		var mi *core.MetaInfo
+		mi, hint, err = a.downloadMetaInfo(namespace, d)
 		if err != nil {
 			if err == metainfoclient.ErrNotFound {
 				return nil, storage.ErrNotFound
@@ -94,6 +96,12 @@ func (a *TorrentArchive) CreateTorrent(namespace string, d core.Digest) (storage
 			!(a.cads.InDownloadError(createErr) || a.cads.InCacheError(createErr)) {
 			return nil, fmt.Errorf("create download file: %s", createErr)
 		}
+		if createErr == nil && a.cads.EncryptionRequested(d.Hex()) {
+			if err := a.cads.InitEncryption(d.Hex(), mi.PieceLength(), mi.NumPieces()); err != nil {
+				return nil, fmt.Errorf("init encryption: %s", err)
+			}
+			a.stats.Counter("encrypted_torrents").Inc(1)
+		}
 		tm.MetaInfo = mi
 		if err := a.cads.Any().GetOrSetMetadata(d.Hex(), &tm); err != nil {
 			return nil, fmt.Errorf("get or set metainfo: %s", err)
@@ -105,9 +113,26 @@ func (a *TorrentArchive) CreateTorrent(namespace string, d core.Digest) (storage
 	if err != nil {
 		return nil, fmt.Errorf("initialize torrent: %s", err)
 	}
+	t.hint = hint
 	return t, nil
 }
 
+// downloadMetaInfo downloads the metainfo of d, along with its distribution
+// hint if the metainfo client supports hints.
+func (a *TorrentArchive) downloadMetaInfo(
+	namespace string, d core.Digest) (*core.MetaInfo, *core.DistributionHint, error) {
+
+	if hc, ok := a.metaInfoClient.(metainfoclient.HintClient); ok {
+		mi, hint, err := hc.DownloadWithHint(namespace, d)
+		if hint != nil {
+			a.stats.Counter("distribution_hints").Inc(1)
+		}
+		return mi, hint, err
+	}
+	mi, err := a.metaInfoClient.Download(namespace, d)
+	return mi, nil, err
+}
+
 // GetTorrent returns a Torrent for an existing metainfo / file on disk. Ignores namespace.
 func (a *TorrentArchive) GetTorrent(namespace string, d core.Digest) (storage.Torrent, error) {
 	var tm metadata.TorrentMeta
@@ -218,3 +218,29 @@ func TestTorrentArchiveGetTorrent(t *testing.T) {
 	require.NoError(err)
 	require.NotNil(tor)
 }
+
+func TestTorrentArchiveCreateTorrentCarriesDistributionHint(t *testing.T) {
+	require := require.New(t)
+
+	cads, cleanup := store.CADownloadStoreFixture()
+	defer cleanup()
+
+	mic := metainfoclient.NewTestClient()
+	archive := NewTorrentArchive(tally.NoopScope, cads, mic)
+
+	namespace := core.TagFixture()
+	mi := core.SizedBlobFixture(4, 1).MetaInfo
+	hint := &core.DistributionHint{Length: mi.Length(), Seeders: 2, MaxConnections: 5}
+
+	require.NoError(mic.Upload(mi))
+	mic.SetHint(mi.Digest(), hint)
+
+	tor, err := archive.CreateTorrent(namespace, mi.Digest())
+	require.NoError(err)
+	require.Equal(hint, tor.(storage.HintedTorrent).DistributionHint())
+
+	// Hints are only attached when metainfo is downloaded.
+	tor, err = archive.CreateTorrent(namespace, mi.Digest())
+	require.NoError(err)
+	require.Nil(tor.(storage.HintedTorrent).DistributionHint())
+}
@@ -118,6 +118,47 @@ func TestTorrentWriteComplete(t *testing.T) {
 	require.Equal(storage.ErrPieceComplete, tor.WritePiece(piecereader.NewBuffer(blob.Content[:1]), 0))
 }
 
+func TestTorrentWriteEncryptedPieces(t *testing.T) {
+	require := require.New(t)
+
+	cads, cleanup := store.EncryptedCADownloadStoreFixture()
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(7, 2)
+
+	prepareStore(cads, blob.MetaInfo)
+	require.NoError(cads.InitEncryption(
+		blob.Digest.Hex(), blob.MetaInfo.PieceLength(), blob.MetaInfo.NumPieces()))
+
+	tor, err := NewTorrent(cads, blob.MetaInfo)
+	require.NoError(err)
+
+	// Corrupt pieces are rejected before they are encrypted.
+	require.Error(tor.WritePiece(piecereader.NewBuffer([]byte("xx")), 0))
+	require.False(tor.HasPiece(0))
+
+	for i := 0; i < tor.NumPieces(); i++ {
+		start := int64(i) * blob.MetaInfo.PieceLength()
+		end := start + tor.PieceLength(i)
+		require.NoError(tor.WritePiece(piecereader.NewBuffer(blob.Content[start:end]), i))
+	}
+	require.True(tor.Complete())
+
+	r, err := tor.GetPieceReader(1)
+	require.NoError(err)
+	defer r.Close()
+	result, err := ioutil.ReadAll(r)
+	require.NoError(err)
+	require.Equal(blob.Content[2:4], result)
+
+	f, err := cads.Cache().GetFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	defer f.Close()
+	result, err = ioutil.ReadAll(f)
+	require.NoError(err)
+	require.Equal(blob.Content, result)
+}
+
 func TestTorrentWriteMultiplePieceConcurrent(t *testing.T) {
 	require := require.New(t)
 
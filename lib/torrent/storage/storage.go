@@ -56,6 +56,13 @@ type Torrent interface {
 	GetPieceReader(piece int) (PieceReader, error)
 }
 
+// HintedTorrent is implemented by Torrents which carry the distribution hint
+// received alongside their metainfo.
+type HintedTorrent interface {
+	// DistributionHint returns the hint of the torrent, or nil if it has none.
+	DistributionHint() *core.DistributionHint
+}
+
 // TorrentArchive creates and open torrent file
 type TorrentArchive interface {
 	Stat(namespace string, d core.Digest) (*TorrentInfo, error)
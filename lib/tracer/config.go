@@ -0,0 +1,45 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tracer
+
+// Config defines distributed tracing configuration. Spans are reported to a
+// jaeger agent.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// ServiceName is the service spans are reported under. Defaults to the
+	// name of the component being traced.
+	ServiceName string `yaml:"service_name"`
+
+	// SamplingRate is the fraction of requests which are traced, between 0
+	// and 1. Requests whose caller sampled them are always traced.
+	SamplingRate float64 `yaml:"sampling_rate"`
+
+	// AgentAddress is the host:port of the jaeger agent spans are reported
+	// to over udp.
+	AgentAddress string `yaml:"agent_address"`
+}
+
+func (c Config) applyDefaults(service string) Config {
+	if c.ServiceName == "" {
+		c.ServiceName = service
+	}
+	if c.SamplingRate == 0 {
+		c.SamplingRate = 0.01
+	}
+	if c.AgentAddress == "" {
+		c.AgentAddress = "localhost:6831"
+	}
+	return c
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tracer
+
+import (
+	"io"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber-go/tally"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+	jaegertally "github.com/uber/jaeger-lib/metrics/tally"
+)
+
+// New creates a tracer for service. Disabled tracers are no-ops, such that
+// instrumented code need not check whether tracing is enabled.
+func New(config Config, service string, stats tally.Scope) (opentracing.Tracer, io.Closer, error) {
+	if !config.Enabled {
+		return opentracing.NoopTracer{}, nopCloser{}, nil
+	}
+	config = config.applyDefaults(service)
+	cfg := jaegercfg.Configuration{
+		ServiceName: config.ServiceName,
+		Sampler: &jaegercfg.SamplerConfig{
+			Type:  "probabilistic",
+			Param: config.SamplingRate,
+		},
+		Reporter: &jaegercfg.ReporterConfig{
+			LocalAgentHostPort: config.AgentAddress,
+		},
+	}
+	return cfg.NewTracer(
+		jaegercfg.Logger(logger{}),
+		jaegercfg.Metrics(jaegertally.Wrap(stats.SubScope("tracer"))))
+}
+
+// logger adapts the global logger to jaeger.
+type logger struct{}
+
+func (logger) Error(msg string) {
+	log.Error(msg)
+}
+
+func (logger) Infof(msg string, args ...interface{}) {
+	log.Infof(msg, args...)
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,45 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tracer
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestNewDisabled(t *testing.T) {
+	require := require.New(t)
+
+	tracer, closer, err := New(Config{}, "kraken-test", tally.NoopScope)
+	require.NoError(err)
+	defer closer.Close()
+
+	require.Equal(opentracing.NoopTracer{}, tracer)
+}
+
+func TestNewEnabled(t *testing.T) {
+	require := require.New(t)
+
+	tracer, closer, err := New(Config{Enabled: true, SamplingRate: 1}, "kraken-test", tally.NoopScope)
+	require.NoError(err)
+	defer closer.Close()
+
+	require.NotEqual(opentracing.NoopTracer{}, tracer)
+
+	span := tracer.StartSpan("test")
+	span.Finish()
+}
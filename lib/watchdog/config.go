@@ -0,0 +1,60 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package watchdog
+
+import (
+	"time"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// Config defines Watchdog configuration.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Interval between checks of process memory and goroutines.
+	Interval time.Duration `yaml:"interval"`
+
+	// MaxRSS is the resident set size above which profiles are dumped. Zero
+	// disables the check.
+	MaxRSS datasize.ByteSize `yaml:"max_rss"`
+
+	// MaxGoroutines is the number of goroutines above which profiles are
+	// dumped. Zero disables the check.
+	MaxGoroutines int `yaml:"max_goroutines"`
+
+	// DumpDir is the directory profiles are dumped into.
+	DumpDir string `yaml:"dump_dir"`
+
+	// MaxDumps is the number of dumps kept in DumpDir. Older dumps are
+	// deleted.
+	MaxDumps int `yaml:"max_dumps"`
+
+	// Cooldown is the minimum time between two dumps, such that a process
+	// hovering around a threshold does not dump on every check.
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Interval == 0 {
+		c.Interval = 15 * time.Second
+	}
+	if c.MaxDumps == 0 {
+		c.MaxDumps = 5
+	}
+	if c.Cooldown == 0 {
+		c.Cooldown = 10 * time.Minute
+	}
+	return c
+}
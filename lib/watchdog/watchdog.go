@@ -0,0 +1,218 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package watchdog dumps heap and goroutine profiles when a process grows
+// suspiciously large, such that incidents which end in the process being
+// OOM killed can be diagnosed after the fact.
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// Watchdog periodically checks the resident set size and goroutine count of
+// the process, and dumps profiles into a ring buffer of directories when
+// either crosses its threshold.
+type Watchdog struct {
+	config Config
+	stats  tally.Scope
+	clk    clock.Clock
+
+	rss        func() (uint64, error)
+	goroutines func() int
+
+	lastDump time.Time
+}
+
+// New creates a new Watchdog.
+func New(config Config, stats tally.Scope) (*Watchdog, error) {
+	return newWatchdog(config, stats, clock.New())
+}
+
+func newWatchdog(config Config, stats tally.Scope, clk clock.Clock) (*Watchdog, error) {
+	config = config.applyDefaults()
+	if config.DumpDir == "" {
+		return nil, errors.New("dump_dir required")
+	}
+	if err := os.MkdirAll(config.DumpDir, 0775); err != nil {
+		return nil, fmt.Errorf("mkdir dump dir: %s", err)
+	}
+	return &Watchdog{
+		config: config,
+		stats: stats.Tagged(map[string]string{
+			"module": "watchdog",
+		}),
+		clk:        clk,
+		rss:        readRSS,
+		goroutines: runtime.NumGoroutine,
+	}, nil
+}
+
+// Run checks the process every interval. Never returns.
+func (w *Watchdog) Run() {
+	ticker := w.clk.Ticker(w.config.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		w.checkOnce()
+	}
+}
+
+// checkOnce checks the process against the configured thresholds, and dumps
+// profiles if any is crossed and no dump was taken within the cooldown.
+func (w *Watchdog) checkOnce() {
+	var reasons []string
+	rss, err := w.rss()
+	if err != nil {
+		log.Errorf("Watchdog error reading rss: %s", err)
+	} else {
+		w.stats.Gauge("rss_bytes").Update(float64(rss))
+		if w.config.MaxRSS > 0 && rss > uint64(w.config.MaxRSS) {
+			reasons = append(reasons, "rss")
+		}
+	}
+	n := w.goroutines()
+	w.stats.Gauge("goroutines").Update(float64(n))
+	if w.config.MaxGoroutines > 0 && n > w.config.MaxGoroutines {
+		reasons = append(reasons, "goroutines")
+	}
+	if len(reasons) == 0 {
+		return
+	}
+	for _, r := range reasons {
+		w.stats.Tagged(map[string]string{"reason": r}).Counter("alerts").Inc(1)
+	}
+
+	now := w.clk.Now()
+	if !w.lastDump.IsZero() && now.Sub(w.lastDump) < w.config.Cooldown {
+		w.stats.Counter("dumps_skipped").Inc(1)
+		return
+	}
+	w.lastDump = now
+
+	dir, err := w.dump(now, reasons)
+	if err != nil {
+		w.stats.Counter("dump_failures").Inc(1)
+		log.Errorf("Watchdog error dumping profiles: %s", err)
+		return
+	}
+	w.stats.Counter("dumps").Inc(1)
+	log.With(
+		"rss", rss,
+		"goroutines", n,
+		"reasons", reasons,
+		"dir", dir).Warn("Watchdog threshold crossed, dumped profiles")
+
+	if err := w.prune(); err != nil {
+		log.Errorf("Watchdog error pruning dumps: %s", err)
+	}
+}
+
+// dump writes heap and goroutine profiles into a new directory of the dump
+// dir. Directories are named after the time of the dump, such that they sort
+// oldest first.
+func (w *Watchdog) dump(now time.Time, reasons []string) (string, error) {
+	name := fmt.Sprintf(
+		"%s-%s", now.UTC().Format("20060102T150405.000Z"), strings.Join(reasons, "+"))
+	dir := filepath.Join(w.config.DumpDir, name)
+	if err := os.Mkdir(dir, 0775); err != nil {
+		return "", fmt.Errorf("mkdir: %s", err)
+	}
+	profiles := []struct {
+		name  string
+		file  string
+		debug int
+	}{
+		{"heap", "heap.pprof", 0},
+		// Full stacks of every goroutine, which are readable without pprof.
+		{"goroutine", "goroutine.txt", 2},
+	}
+	for _, p := range profiles {
+		if err := writeProfile(filepath.Join(dir, p.file), p.name, p.debug); err != nil {
+			return "", fmt.Errorf("%s: %s", p.name, err)
+		}
+	}
+	return dir, nil
+}
+
+func writeProfile(path, name string, debug int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create: %s", err)
+	}
+	defer f.Close()
+
+	if err := pprof.Lookup(name).WriteTo(f, debug); err != nil {
+		return fmt.Errorf("write: %s", err)
+	}
+	return nil
+}
+
+// prune deletes the oldest dumps beyond the configured number of dumps.
+func (w *Watchdog) prune() error {
+	infos, err := ioutil.ReadDir(w.config.DumpDir)
+	if err != nil {
+		return fmt.Errorf("read dump dir: %s", err)
+	}
+	var dumps []string
+	for _, info := range infos {
+		if info.IsDir() {
+			dumps = append(dumps, info.Name())
+		}
+	}
+	// ReadDir sorts by name, i.e. oldest first.
+	for len(dumps) > w.config.MaxDumps {
+		if err := os.RemoveAll(filepath.Join(w.config.DumpDir, dumps[0])); err != nil {
+			return fmt.Errorf("remove %s: %s", dumps[0], err)
+		}
+		dumps = dumps[1:]
+	}
+	return nil
+}
+
+// readRSS returns the resident set size of the process. Where /proc is not
+// available, the memory obtained from the OS by the Go runtime is used
+// instead, which overestimates rss.
+func readRSS() (uint64, error) {
+	b, err := ioutil.ReadFile("/proc/self/statm")
+	if os.IsNotExist(err) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return m.Sys, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("read statm: %s", err)
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("malformed statm: %q", b)
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse statm: %s", err)
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package watchdog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func newTestWatchdog(t *testing.T, config Config) (*Watchdog, *clock.Mock, func()) {
+	dir, err := ioutil.TempDir("/tmp", "watchdog")
+	require.NoError(t, err)
+
+	config.DumpDir = dir
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+	w, err := newWatchdog(config, tally.NoopScope, clk)
+	require.NoError(t, err)
+	w.rss = func() (uint64, error) { return 0, nil }
+	w.goroutines = func() int { return 1 }
+
+	return w, clk, func() { os.RemoveAll(dir) }
+}
+
+func listDumps(t *testing.T, w *Watchdog) []string {
+	infos, err := ioutil.ReadDir(w.config.DumpDir)
+	require.NoError(t, err)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestWatchdogNoDumpBelowThresholds(t *testing.T) {
+	w, _, cleanup := newTestWatchdog(t, Config{MaxRSS: 1024, MaxGoroutines: 10})
+	defer cleanup()
+
+	w.rss = func() (uint64, error) { return 1024, nil }
+	w.goroutines = func() int { return 10 }
+
+	w.checkOnce()
+
+	require.Empty(t, listDumps(t, w))
+}
+
+func TestWatchdogDumpsProfiles(t *testing.T) {
+	require := require.New(t)
+
+	w, _, cleanup := newTestWatchdog(t, Config{MaxRSS: 1024})
+	defer cleanup()
+
+	w.rss = func() (uint64, error) { return 2048, nil }
+
+	w.checkOnce()
+
+	dumps := listDumps(t, w)
+	require.Len(dumps, 1)
+	require.Contains(dumps[0], "-rss")
+	for _, f := range []string{"heap.pprof", "goroutine.txt"} {
+		info, err := os.Stat(filepath.Join(w.config.DumpDir, dumps[0], f))
+		require.NoError(err)
+		require.True(info.Size() > 0)
+	}
+}
+
+func TestWatchdogCooldown(t *testing.T) {
+	require := require.New(t)
+
+	w, clk, cleanup := newTestWatchdog(t, Config{MaxGoroutines: 10, Cooldown: time.Minute})
+	defer cleanup()
+
+	w.goroutines = func() int { return 11 }
+
+	w.checkOnce()
+	clk.Add(30 * time.Second)
+	w.checkOnce()
+	require.Len(listDumps(t, w), 1)
+
+	clk.Add(time.Minute)
+	w.checkOnce()
+	require.Len(listDumps(t, w), 2)
+}
+
+func TestWatchdogKeepsMaxDumps(t *testing.T) {
+	require := require.New(t)
+
+	w, clk, cleanup := newTestWatchdog(t, Config{
+		MaxGoroutines: 10,
+		MaxDumps:      2,
+		Cooldown:      time.Second,
+	})
+	defer cleanup()
+
+	w.goroutines = func() int { return 11 }
+
+	var all []string
+	for i := 0; i < 4; i++ {
+		w.checkOnce()
+		dumps := listDumps(t, w)
+		all = append(all, dumps[len(dumps)-1])
+		clk.Add(time.Second)
+	}
+	require.Equal(all[2:], listDumps(t, w))
+}
+
+func TestReadRSS(t *testing.T) {
+	rss, err := readRSS()
+	require.NoError(t, err)
+	require.True(t, rss > 0)
+}
@@ -18,6 +18,8 @@ type Config struct {
 	Backend string       `yaml:"backend"`
 	Statsd  StatsdConfig `yaml:"statsd"`
 	M3      M3Config     `yaml:"m3"`
+
+	Prometheus PrometheusConfig `yaml:"prometheus"`
 }
 
 // StatsdConfig defines statsd configuration.
@@ -32,3 +34,26 @@ type M3Config struct {
 	Service  string `yaml:"service"`
 	Env      string `yaml:"env"`
 }
+
+// PrometheusConfig defines prometheus configuration. Metrics are served for
+// scraping on a dedicated listener, or by the server listener of components
+// which mount the handler returned by NewWithHandler if no listen address is
+// configured.
+type PrometheusConfig struct {
+	ListenAddress string `yaml:"listen_address"`
+
+	// HandlerPath is the path metrics are served at on ListenAddress.
+	HandlerPath string `yaml:"handler_path"`
+
+	// TimerType is either "summary" or "histogram". Defaults to "histogram".
+	TimerType string `yaml:"timer_type"`
+}
+
+func (c *PrometheusConfig) applyDefaults() {
+	if c.HandlerPath == "" {
+		c.HandlerPath = "/metrics"
+	}
+	if c.TimerType == "" {
+		c.TimerType = "histogram"
+	}
+}
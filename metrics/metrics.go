@@ -17,6 +17,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"time"
 
@@ -26,14 +27,30 @@ import (
 )
 
 func init() {
-	register("statsd", newStatsdScope)
-	register("disabled", newDisabledScope)
-	register("m3", newM3Scope)
+	register("statsd", pushed(newStatsdScope))
+	register("disabled", pushed(newDisabledScope))
+	register("m3", pushed(newM3Scope))
+	register("prometheus", newPrometheusScope)
 }
 
 var _scopeFactories = make(map[string]scopeFactory)
 
-type scopeFactory func(config Config, cluster string) (tally.Scope, io.Closer, error)
+// scopeFactory creates a Scope reporting to a backend. If the backend is
+// scraped through the listener of the server, it also returns the handler
+// serving the metrics, else nil.
+type scopeFactory func(
+	config Config, cluster string) (tally.Scope, io.Closer, http.Handler, error)
+
+// pushed adapts the factory of a backend which metrics are pushed to, and
+// which therefore has no handler, into a scopeFactory.
+func pushed(
+	f func(config Config, cluster string) (tally.Scope, io.Closer, error)) scopeFactory {
+
+	return func(config Config, cluster string) (tally.Scope, io.Closer, http.Handler, error) {
+		s, c, err := f(config, cluster)
+		return s, c, nil, err
+	}
+}
 
 func register(name string, f scopeFactory) {
 	if _, ok := _scopeFactories[name]; ok {
@@ -43,14 +60,26 @@ func register(name string, f scopeFactory) {
 }
 
 // New creates a new metrics Scope from config. If no backend is configured, metrics
-// are disabled.
+// are disabled. Components serving metrics should use NewWithHandler instead.
 func New(config Config, cluster string) (tally.Scope, io.Closer, error) {
+	s, c, _, err := NewWithHandler(config, cluster)
+	return s, c, err
+}
+
+// NewWithHandler creates a new metrics Scope from config, along with the
+// handler serving its metrics if they are scraped through the server listener
+// rather than pushed or served on a dedicated listener. Components mount the
+// handler at /metrics on their server listener. The handler is nil if metrics
+// are not scraped through the server listener.
+func NewWithHandler(
+	config Config, cluster string) (tally.Scope, io.Closer, http.Handler, error) {
+
 	if config.Backend == "" {
 		config.Backend = "disabled"
 	}
 	f, ok := _scopeFactories[config.Backend]
 	if !ok || f == nil {
-		return nil, nil, fmt.Errorf("metrics backend %q not registered", config.Backend)
+		return nil, nil, nil, fmt.Errorf("metrics backend %q not registered", config.Backend)
 	}
 	return f(config, cluster)
 }
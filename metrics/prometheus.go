@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+	"github.com/uber-go/tally/prometheus"
+)
+
+// newPrometheusScope returns the handler serving metrics to prometheus if they
+// are not exposed on a dedicated listener.
+func newPrometheusScope(
+	config Config, cluster string) (tally.Scope, io.Closer, http.Handler, error) {
+
+	config.Prometheus.applyDefaults()
+
+	promConfig := prometheus.Configuration{
+		HandlerPath:   config.Prometheus.HandlerPath,
+		ListenAddress: config.Prometheus.ListenAddress,
+		TimerType:     config.Prometheus.TimerType,
+	}
+	r, err := promConfig.NewReporter(prometheus.ConfigurationOptions{
+		OnError: func(err error) {
+			log.Errorf("Error serving prometheus metrics: %s", err)
+		},
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var h http.Handler
+	if config.Prometheus.ListenAddress == "" {
+		// Servers mount the handler explicitly rather than relying on the
+		// reporter registering it with http.DefaultServeMux, which not every
+		// server serves.
+		log.Info("Prometheus metrics served by the server listener")
+		h = r.HTTPHandler()
+	}
+	var tags map[string]string
+	if cluster != "" {
+		tags = map[string]string{"cluster": cluster}
+	}
+	s, c := tally.NewRootScope(tally.ScopeOptions{
+		CachedReporter:  r,
+		Tags:            tags,
+		Separator:       prometheus.DefaultSeparator,
+		SanitizeOptions: &prometheus.DefaultSanitizerOpts,
+	}, time.Second)
+	return s, c, h, nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPrometheusScopeServesMetricsThroughHandler(t *testing.T) {
+	require := require.New(t)
+
+	// The reporter registers its handler with http.DefaultServeMux, so paths
+	// must be unique across tests.
+	config := Config{Prometheus: PrometheusConfig{HandlerPath: "/test-server-listener-metrics"}}
+
+	s, closer, h, err := newPrometheusScope(config, "test-cluster")
+	require.NoError(err)
+	require.NotNil(h)
+
+	s.Counter("prometheus_handler_test").Inc(3)
+
+	// Closing the scope reports its metrics.
+	require.NoError(closer.Close())
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(http.StatusOK, w.Code)
+	b, err := ioutil.ReadAll(w.Body)
+	require.NoError(err)
+	require.Contains(string(b), `prometheus_handler_test{cluster="test-cluster"} 3`)
+}
+
+func TestNewPrometheusScopeOnDedicatedListenerHasNoHandler(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Prometheus: PrometheusConfig{ListenAddress: "127.0.0.1:0"}}
+
+	_, closer, h, err := newPrometheusScope(config, "")
+	require.NoError(err)
+	defer closer.Close()
+	require.Nil(h)
+}
+
+func TestNewWithHandlerPushedBackendsHaveNoHandler(t *testing.T) {
+	require := require.New(t)
+
+	s, closer, h, err := NewWithHandler(Config{}, "")
+	require.NoError(err)
+	defer closer.Close()
+	require.NotNil(s)
+	require.Nil(h)
+}
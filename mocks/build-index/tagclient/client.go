@@ -36,18 +36,61 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 	return m.recorder
 }
 
+// AliasHistory mocks base method
+func (m *MockClient) AliasHistory(arg0 string) ([]tagmodels.Alias, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AliasHistory", arg0)
+	ret0, _ := ret[0].([]tagmodels.Alias)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AliasHistory indicates an expected call of AliasHistory
+func (mr *MockClientMockRecorder) AliasHistory(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AliasHistory", reflect.TypeOf((*MockClient)(nil).AliasHistory), arg0)
+}
+
+// DuplicateDelete mocks base method
+func (m *MockClient) DuplicateDelete(arg0 string, arg1 core.Digest, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DuplicateDelete", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DuplicateDelete indicates an expected call of DuplicateDelete
+func (mr *MockClientMockRecorder) DuplicateDelete(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicateDelete", reflect.TypeOf((*MockClient)(nil).DuplicateDelete), arg0, arg1, arg2)
+}
+
 // DuplicatePut mocks base method
-func (m *MockClient) DuplicatePut(arg0 string, arg1 core.Digest, arg2 time.Duration) error {
+func (m *MockClient) DuplicatePut(arg0 string, arg1 core.Digest, arg2 time.Duration, arg3 time.Time) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DuplicatePut", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "DuplicatePut", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DuplicatePut indicates an expected call of DuplicatePut
-func (mr *MockClientMockRecorder) DuplicatePut(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) DuplicatePut(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicatePut", reflect.TypeOf((*MockClient)(nil).DuplicatePut), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicatePut", reflect.TypeOf((*MockClient)(nil).DuplicatePut), arg0, arg1, arg2, arg3)
+}
+
+// DuplicatePutAlias mocks base method
+func (m *MockClient) DuplicatePutAlias(arg0 tagmodels.Alias) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DuplicatePutAlias", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DuplicatePutAlias indicates an expected call of DuplicatePutAlias
+func (mr *MockClientMockRecorder) DuplicatePutAlias(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicatePutAlias", reflect.TypeOf((*MockClient)(nil).DuplicatePutAlias), arg0)
 }
 
 // DuplicateReplicate mocks base method
@@ -79,6 +122,36 @@ func (mr *MockClientMockRecorder) Get(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockClient)(nil).Get), arg0)
 }
 
+// GetConsistent mocks base method
+func (m *MockClient) GetConsistent(arg0, arg1 string) (core.Digest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetConsistent", arg0, arg1)
+	ret0, _ := ret[0].(core.Digest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetConsistent indicates an expected call of GetConsistent
+func (mr *MockClientMockRecorder) GetConsistent(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConsistent", reflect.TypeOf((*MockClient)(nil).GetConsistent), arg0, arg1)
+}
+
+// GetAlias mocks base method
+func (m *MockClient) GetAlias(arg0 string) (tagmodels.Alias, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAlias", arg0)
+	ret0, _ := ret[0].(tagmodels.Alias)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAlias indicates an expected call of GetAlias
+func (mr *MockClientMockRecorder) GetAlias(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAlias", reflect.TypeOf((*MockClient)(nil).GetAlias), arg0)
+}
+
 // Has mocks base method
 func (m *MockClient) Has(arg0 string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -94,6 +167,21 @@ func (mr *MockClientMockRecorder) Has(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Has", reflect.TypeOf((*MockClient)(nil).Has), arg0)
 }
 
+// Lineage mocks base method
+func (m *MockClient) Lineage(arg0 string) (tagmodels.Lineage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lineage", arg0)
+	ret0, _ := ret[0].(tagmodels.Lineage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Lineage indicates an expected call of Lineage
+func (mr *MockClientMockRecorder) Lineage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lineage", reflect.TypeOf((*MockClient)(nil).Lineage), arg0)
+}
+
 // List mocks base method
 func (m *MockClient) List(arg0 string) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -109,6 +197,36 @@ func (mr *MockClientMockRecorder) List(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockClient)(nil).List), arg0)
 }
 
+// ListManifests mocks base method
+func (m *MockClient) ListManifests(arg0 string) ([]tagmodels.Manifest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListManifests", arg0)
+	ret0, _ := ret[0].([]tagmodels.Manifest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListManifests indicates an expected call of ListManifests
+func (mr *MockClientMockRecorder) ListManifests(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListManifests", reflect.TypeOf((*MockClient)(nil).ListManifests), arg0)
+}
+
+// ListManifestsWithPagination mocks base method
+func (m *MockClient) ListManifestsWithPagination(arg0 string, arg1 tagclient.ListFilter) (tagmodels.ManifestListResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListManifestsWithPagination", arg0, arg1)
+	ret0, _ := ret[0].(tagmodels.ManifestListResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListManifestsWithPagination indicates an expected call of ListManifestsWithPagination
+func (mr *MockClientMockRecorder) ListManifestsWithPagination(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListManifestsWithPagination", reflect.TypeOf((*MockClient)(nil).ListManifestsWithPagination), arg0, arg1)
+}
+
 // ListRepository mocks base method
 func (m *MockClient) ListRepository(arg0 string) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -183,6 +301,21 @@ func (mr *MockClientMockRecorder) Put(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockClient)(nil).Put), arg0, arg1)
 }
 
+// PutAlias mocks base method
+func (m *MockClient) PutAlias(arg0, arg1 string, arg2 int) (tagmodels.Alias, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutAlias", arg0, arg1, arg2)
+	ret0, _ := ret[0].(tagmodels.Alias)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PutAlias indicates an expected call of PutAlias
+func (mr *MockClientMockRecorder) PutAlias(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutAlias", reflect.TypeOf((*MockClient)(nil).PutAlias), arg0, arg1, arg2)
+}
+
 // PutAndReplicate mocks base method
 func (m *MockClient) PutAndReplicate(arg0 string, arg1 core.Digest) error {
 	m.ctrl.T.Helper()
@@ -49,6 +49,20 @@ func (mr *MockFileStoreMockRecorder) CreateCacheFile(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCacheFile", reflect.TypeOf((*MockFileStore)(nil).CreateCacheFile), arg0, arg1)
 }
 
+// DeleteCacheFile mocks base method
+func (m *MockFileStore) DeleteCacheFile(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCacheFile", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCacheFile indicates an expected call of DeleteCacheFile
+func (mr *MockFileStoreMockRecorder) DeleteCacheFile(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCacheFile", reflect.TypeOf((*MockFileStore)(nil).DeleteCacheFile), arg0)
+}
+
 // GetCacheFileReader mocks base method
 func (m *MockFileStore) GetCacheFileReader(arg0 string) (base.FileReader, error) {
 	m.ctrl.T.Helper()
@@ -6,6 +6,7 @@ package mocktagstore
 
 import (
 	gomock "github.com/golang/mock/gomock"
+	tagmodels "github.com/uber/kraken/build-index/tagmodels"
 	core "github.com/uber/kraken/core"
 	reflect "reflect"
 	time "time"
@@ -34,6 +35,21 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// Delete mocks base method
+func (m *MockStore) Delete(arg0 string) (core.Digest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret0, _ := ret[0].(core.Digest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockStoreMockRecorder) Delete(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockStore)(nil).Delete), arg0)
+}
+
 // Get mocks base method
 func (m *MockStore) Get(arg0 string) (core.Digest, error) {
 	m.ctrl.T.Helper()
@@ -49,6 +65,22 @@ func (mr *MockStoreMockRecorder) Get(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStore)(nil).Get), arg0)
 }
 
+// ListManifests mocks base method
+func (m *MockStore) ListManifests(arg0 string, arg1 int, arg2 string) ([]tagmodels.Manifest, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListManifests", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]tagmodels.Manifest)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListManifests indicates an expected call of ListManifests
+func (mr *MockStoreMockRecorder) ListManifests(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListManifests", reflect.TypeOf((*MockStore)(nil).ListManifests), arg0, arg1, arg2)
+}
+
 // Put mocks base method
 func (m *MockStore) Put(arg0 string, arg1 core.Digest, arg2 time.Duration) error {
 	m.ctrl.T.Helper()
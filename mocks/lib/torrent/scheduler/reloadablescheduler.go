@@ -8,6 +8,7 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
 	scheduler "github.com/uber/kraken/lib/torrent/scheduler"
+	conn "github.com/uber/kraken/lib/torrent/scheduler/conn"
 	connstate "github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	reflect "reflect"
 )
@@ -50,6 +51,21 @@ func (mr *MockReloadableSchedulerMockRecorder) BlacklistSnapshot() *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BlacklistSnapshot", reflect.TypeOf((*MockReloadableScheduler)(nil).BlacklistSnapshot))
 }
 
+// ConnSnapshot mocks base method
+func (m *MockReloadableScheduler) ConnSnapshot() ([]conn.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnSnapshot")
+	ret0, _ := ret[0].([]conn.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConnSnapshot indicates an expected call of ConnSnapshot
+func (mr *MockReloadableSchedulerMockRecorder) ConnSnapshot() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnSnapshot", reflect.TypeOf((*MockReloadableScheduler)(nil).ConnSnapshot))
+}
+
 // Download mocks base method
 func (m *MockReloadableScheduler) Download(arg0 string, arg1 core.Digest) error {
 	m.ctrl.T.Helper()
@@ -115,3 +131,18 @@ func (mr *MockReloadableSchedulerMockRecorder) Stop() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockReloadableScheduler)(nil).Stop))
 }
+
+// Summary mocks base method
+func (m *MockReloadableScheduler) Summary() (scheduler.Summary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Summary")
+	ret0, _ := ret[0].(scheduler.Summary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Summary indicates an expected call of Summary
+func (mr *MockReloadableSchedulerMockRecorder) Summary() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Summary", reflect.TypeOf((*MockReloadableScheduler)(nil).Summary))
+}
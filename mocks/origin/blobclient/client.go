@@ -105,6 +105,21 @@ func (mr *MockClientMockRecorder) ForceCleanup(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForceCleanup", reflect.TypeOf((*MockClient)(nil).ForceCleanup), arg0)
 }
 
+// GetBundle mocks base method
+func (m *MockClient) GetBundle(arg0 string, arg1 core.Digest) (*core.BundleIndex, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBundle", arg0, arg1)
+	ret0, _ := ret[0].(*core.BundleIndex)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBundle indicates an expected call of GetBundle
+func (mr *MockClientMockRecorder) GetBundle(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBundle", reflect.TypeOf((*MockClient)(nil).GetBundle), arg0, arg1)
+}
+
 // GetMetaInfo mocks base method
 func (m *MockClient) GetMetaInfo(arg0 string, arg1 core.Digest) (*core.MetaInfo, error) {
 	m.ctrl.T.Helper()
@@ -48,6 +48,21 @@ func (mr *MockClusterClientMockRecorder) DownloadBlob(arg0, arg1, arg2 interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadBlob", reflect.TypeOf((*MockClusterClient)(nil).DownloadBlob), arg0, arg1, arg2)
 }
 
+// GetBundle mocks base method
+func (m *MockClusterClient) GetBundle(arg0 string, arg1 core.Digest) (*core.BundleIndex, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBundle", arg0, arg1)
+	ret0, _ := ret[0].(*core.BundleIndex)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBundle indicates an expected call of GetBundle
+func (mr *MockClusterClientMockRecorder) GetBundle(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBundle", reflect.TypeOf((*MockClusterClient)(nil).GetBundle), arg0, arg1)
+}
+
 // GetMetaInfo mocks base method
 func (m *MockClusterClient) GetMetaInfo(arg0 string, arg1 core.Digest) (*core.MetaInfo, error) {
 	m.ctrl.T.Helper()
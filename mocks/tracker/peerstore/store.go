@@ -45,6 +45,22 @@ func (mr *MockStoreMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStore)(nil).Close))
 }
 
+// EstimatePeerCount mocks base method
+func (m *MockStore) EstimatePeerCount(arg0 core.InfoHash) (int, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EstimatePeerCount", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// EstimatePeerCount indicates an expected call of EstimatePeerCount
+func (mr *MockStoreMockRecorder) EstimatePeerCount(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EstimatePeerCount", reflect.TypeOf((*MockStore)(nil).EstimatePeerCount), arg0)
+}
+
 // GetPeers mocks base method
 func (m *MockStore) GetPeers(arg0 core.InfoHash, arg1 int) ([]*core.PeerInfo, error) {
 	m.ctrl.T.Helper()
@@ -60,6 +76,22 @@ func (mr *MockStoreMockRecorder) GetPeers(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeers", reflect.TypeOf((*MockStore)(nil).GetPeers), arg0, arg1)
 }
 
+// GetSeedersAndLeechers mocks base method
+func (m *MockStore) GetSeedersAndLeechers(arg0 core.InfoHash, arg1, arg2 int) ([]*core.PeerInfo, []*core.PeerInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSeedersAndLeechers", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*core.PeerInfo)
+	ret1, _ := ret[1].([]*core.PeerInfo)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetSeedersAndLeechers indicates an expected call of GetSeedersAndLeechers
+func (mr *MockStoreMockRecorder) GetSeedersAndLeechers(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSeedersAndLeechers", reflect.TypeOf((*MockStore)(nil).GetSeedersAndLeechers), arg0, arg1, arg2)
+}
+
 // UpdatePeer mocks base method
 func (m *MockStore) UpdatePeer(arg0 core.InfoHash, arg1 *core.PeerInfo) error {
 	m.ctrl.T.Helper()
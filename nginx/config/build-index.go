@@ -43,6 +43,18 @@ server {
     proxy_cache_valid   200 5m;
     proxy_cache_valid   any 1s;
     proxy_cache_lock    on;
+
+    # Gets presenting consistency tokens must observe puts made since the
+    # cached response, so they always reach build-index.
+    proxy_cache_bypass  $http_kraken_consistency_token;
+    proxy_no_cache      $http_kraken_consistency_token;
+  }
+
+  location /events {
+    proxy_pass http://build-index;
+
+    # Events are streamed as they are published.
+    proxy_buffering off;
   }
 
   location ~* ^/repositories/.*/tags$ {
@@ -46,6 +46,8 @@ type Client interface {
 	GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
 	OverwriteMetaInfo(d core.Digest, pieceLength int64) error
 
+	GetBundle(namespace string, manifest core.Digest) (*core.BundleIndex, error)
+
 	UploadBlob(namespace string, d core.Digest, blob io.Reader) error
 	DuplicateUploadBlob(namespace string, d core.Digest, blob io.Reader, delay time.Duration) error
 
@@ -60,9 +62,12 @@ type Client interface {
 
 // HTTPClient defines the Client implementation.
 type HTTPClient struct {
-	addr      string
-	chunkSize uint64
-	tls       *tls.Config
+	addr         string
+	chunkSize    uint64
+	chunkRetries int
+	progress     func(uploaded int64)
+	tls          *tls.Config
+	proxy        *httputil.Proxy
 }
 
 // Option allows setting optional HTTPClient parameters.
@@ -73,11 +78,29 @@ func WithChunkSize(s uint64) Option {
 	return func(c *HTTPClient) { c.chunkSize = s }
 }
 
+// WithChunkRetries configures an HTTPClient to retry each upload chunk up to n
+// times on network and retryable errors. Chunks are resent to the same upload,
+// such that uploads resume from the failed chunk.
+func WithChunkRetries(n int) Option {
+	return func(c *HTTPClient) { c.chunkRetries = n }
+}
+
+// WithUploadProgress configures an HTTPClient to call f with the total number
+// of bytes uploaded after each chunk of an upload.
+func WithUploadProgress(f func(uploaded int64)) Option {
+	return func(c *HTTPClient) { c.progress = f }
+}
+
 // WithTLS configures an HTTPClient with tls configuration.
 func WithTLS(tls *tls.Config) Option {
 	return func(c *HTTPClient) { c.tls = tls }
 }
 
+// WithProxy configures an HTTPClient to send requests through an egress proxy.
+func WithProxy(p *httputil.Proxy) Option {
+	return func(c *HTTPClient) { c.proxy = p }
+}
+
 // New returns a new HTTPClient scoped to addr.
 func New(addr string, opts ...Option) *HTTPClient {
 	c := &HTTPClient{
@@ -100,7 +123,8 @@ func (c *HTTPClient) Locations(d core.Digest) ([]string, error) {
 	r, err := httputil.Get(
 		fmt.Sprintf("http://%s/blobs/%s/locations", c.addr, d),
 		httputil.SendTimeout(5*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +160,8 @@ func (c *HTTPClient) stat(namespace string, d core.Digest, local bool) (*core.Bl
 	r, err := httputil.Head(
 		u,
 		httputil.SendTimeout(15*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		if httputil.IsNotFound(err) {
 			return nil, ErrBlobNotFound
@@ -159,22 +184,23 @@ func (c *HTTPClient) DeleteBlob(d core.Digest) error {
 	_, err := httputil.Delete(
 		fmt.Sprintf("http://%s/internal/blobs/%s", c.addr, d),
 		httputil.SendAcceptedCodes(http.StatusAccepted),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
 // TransferBlob uploads a blob to a single origin server. Unlike its cousin UploadBlob,
 // TransferBlob is an internal API which does not replicate the blob.
 func (c *HTTPClient) TransferBlob(d core.Digest, blob io.Reader) error {
-	tc := newTransferClient(c.addr, c.tls)
-	return runChunkedUpload(tc, d, blob, int64(c.chunkSize))
+	tc := newTransferClient(c.addr, c.tls, c.proxy)
+	return c.runChunkedUpload(tc, d, blob)
 }
 
 // UploadBlob uploads and replicates blob to the origin cluster, asynchronously
 // backing the blob up to the remote storage configured for namespace.
 func (c *HTTPClient) UploadBlob(namespace string, d core.Digest, blob io.Reader) error {
-	uc := newUploadClient(c.addr, namespace, _publicUpload, 0, c.tls)
-	return runChunkedUpload(uc, d, blob, int64(c.chunkSize))
+	uc := newUploadClient(c.addr, namespace, _publicUpload, 0, c.tls, c.proxy)
+	return c.runChunkedUpload(uc, d, blob)
 }
 
 // DuplicateUploadBlob duplicates an blob upload request, which will attempt to
@@ -182,8 +208,8 @@ func (c *HTTPClient) UploadBlob(namespace string, d core.Digest, blob io.Reader)
 func (c *HTTPClient) DuplicateUploadBlob(
 	namespace string, d core.Digest, blob io.Reader, delay time.Duration) error {
 
-	uc := newUploadClient(c.addr, namespace, _duplicateUpload, delay, c.tls)
-	return runChunkedUpload(uc, d, blob, int64(c.chunkSize))
+	uc := newUploadClient(c.addr, namespace, _duplicateUpload, delay, c.tls, c.proxy)
+	return c.runChunkedUpload(uc, d, blob)
 }
 
 // DownloadBlob downloads blob for d. If the blob of d is not available yet
@@ -193,7 +219,8 @@ func (c *HTTPClient) DuplicateUploadBlob(
 func (c *HTTPClient) DownloadBlob(namespace string, d core.Digest, dst io.Writer) error {
 	r, err := httputil.Get(
 		fmt.Sprintf("http://%s/namespace/%s/blobs/%s", c.addr, url.PathEscape(namespace), d),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		return err
 	}
@@ -211,7 +238,8 @@ func (c *HTTPClient) ReplicateToRemote(namespace string, d core.Digest, remoteDN
 	_, err := httputil.Post(
 		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/remote/%s",
 			c.addr, url.PathEscape(namespace), d, remoteDNS),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
@@ -224,7 +252,8 @@ func (c *HTTPClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInf
 		fmt.Sprintf("http://%s/internal/namespace/%s/blobs/%s/metainfo",
 			c.addr, url.PathEscape(namespace), d),
 		httputil.SendTimeout(15*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		return nil, err
 	}
@@ -240,12 +269,35 @@ func (c *HTTPClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInf
 	return mi, nil
 }
 
+// GetBundle returns the bundle of the small blobs of manifest. If the bundle is
+// still being built, returns a 202 httputil.StatusError, indicating that the
+// request should be retried later. If manifest does not exist or its image is
+// not bundled, returns a 404 httputil.StatusError.
+func (c *HTTPClient) GetBundle(namespace string, manifest core.Digest) (*core.BundleIndex, error) {
+	r, err := httputil.Get(
+		fmt.Sprintf("http://%s/internal/namespace/%s/blobs/%s/bundle",
+			c.addr, url.PathEscape(namespace), manifest),
+		httputil.SendTimeout(15*time.Second),
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	var index core.BundleIndex
+	if err := json.NewDecoder(r.Body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("decode bundle index: %s", err)
+	}
+	return &index, nil
+}
+
 // OverwriteMetaInfo overwrites existing metainfo for d with new metainfo
 // configured with pieceLength. Primarily intended for benchmarking purposes.
 func (c *HTTPClient) OverwriteMetaInfo(d core.Digest, pieceLength int64) error {
 	_, err := httputil.Post(
 		fmt.Sprintf("http://%s/internal/blobs/%s/metainfo?piece_length=%d", c.addr, d, pieceLength),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
@@ -255,7 +307,8 @@ func (c *HTTPClient) GetPeerContext() (core.PeerContext, error) {
 	r, err := httputil.Get(
 		fmt.Sprintf("http://%s/internal/peercontext", c.addr),
 		httputil.SendTimeout(5*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		return pctx, err
 	}
@@ -273,7 +326,8 @@ func (c *HTTPClient) ForceCleanup(ttl time.Duration) error {
 	_, err := httputil.Post(
 		fmt.Sprintf("http://%s/forcecleanup?%s", c.addr, v.Encode()),
 		httputil.SendTimeout(2*time.Minute),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
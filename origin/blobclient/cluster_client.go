@@ -81,6 +81,7 @@ type ClusterClient interface {
 	UploadBlob(namespace string, d core.Digest, blob io.Reader) error
 	DownloadBlob(namespace string, d core.Digest, dst io.Writer) error
 	GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
+	GetBundle(namespace string, manifest core.Digest) (*core.BundleIndex, error)
 	Stat(namespace string, d core.Digest) (*core.BlobInfo, error)
 	OverwriteMetaInfo(d core.Digest, pieceLength int64) error
 	Owners(d core.Digest) ([]core.PeerContext, error)
@@ -121,8 +122,9 @@ func (c *clusterClient) UploadBlob(namespace string, d core.Digest, blob io.Read
 	for _, client := range clients {
 		err = client.UploadBlob(namespace, d, blob)
 		// Allow retry on another origin if the current upstream is temporarily
-		// unavailable or under high load.
-		if httputil.IsNetworkError(err) || httputil.IsRetryable(err) {
+		// unavailable, under high load, or running out of disk space.
+		if httputil.IsNetworkError(err) || httputil.IsRetryable(err) ||
+			httputil.IsInsufficientStorage(err) {
 			continue
 		}
 		break
@@ -147,6 +149,26 @@ func (c *clusterClient) GetMetaInfo(namespace string, d core.Digest) (mi *core.M
 	return mi, err
 }
 
+// GetBundle returns the bundle of the small blobs of manifest. Does not handle
+// polling.
+func (c *clusterClient) GetBundle(
+	namespace string, manifest core.Digest) (index *core.BundleIndex, err error) {
+
+	clients, err := c.resolver.Resolve(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("resolve clients: %s", err)
+	}
+	for _, client := range clients {
+		index, err = client.GetBundle(namespace, manifest)
+		// Do not try the next replica on 202 errors.
+		if err != nil && !httputil.IsAccepted(err) {
+			continue
+		}
+		break
+	}
+	return index, err
+}
+
 // Stat checks availability of a blob in the cluster.
 func (c *clusterClient) Stat(namespace string, d core.Digest) (bi *core.BlobInfo, err error) {
 	clients, err := c.resolver.Resolve(d)
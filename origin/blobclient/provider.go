@@ -15,6 +15,7 @@ package blobclient
 
 import (
 	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/utils/httputil"
 )
 
 // Provider defines an interface for creating Client scoped to an origin addr.
@@ -46,12 +47,22 @@ type ClusterProvider interface {
 // HTTPClusterProvider provides ClusterClients backed by HTTP. Does not include
 // health checks.
 type HTTPClusterProvider struct {
-	opts []Option
+	opts    []Option
+	proxies map[string]*httputil.Proxy
 }
 
 // NewClusterProvider returns a new HTTPClusterProvider.
 func NewClusterProvider(opts ...Option) HTTPClusterProvider {
-	return HTTPClusterProvider{opts}
+	return HTTPClusterProvider{opts: opts}
+}
+
+// NewRemoteClusterProvider returns a new HTTPClusterProvider which reaches
+// each cluster through its proxy in proxies, keyed by dns. Clusters without a
+// proxy are reached directly.
+func NewRemoteClusterProvider(
+	proxies map[string]*httputil.Proxy, opts ...Option) HTTPClusterProvider {
+
+	return HTTPClusterProvider{opts, proxies}
 }
 
 // Provide creates a new ClusterClient.
@@ -60,5 +71,9 @@ func (p HTTPClusterProvider) Provide(dns string) (ClusterClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewClusterClient(NewClientResolver(NewProvider(p.opts...), hosts)), nil
+	opts := p.opts
+	if proxy, ok := p.proxies[dns]; ok {
+		opts = append(append([]Option{}, opts...), WithProxy(proxy))
+	}
+	return NewClusterClient(NewClientResolver(NewProvider(opts...), hosts)), nil
 }
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/uber/kraken/core"
@@ -29,57 +30,116 @@ import (
 
 // uploader provides methods for executing a chunked upload.
 type uploader interface {
-	start(d core.Digest) (uid string, err error)
+	// start begins an upload of d, which is length bytes long, or of unknown
+	// length if negative.
+	start(d core.Digest, length int64) (uid string, err error)
 	patch(d core.Digest, uid string, start, stop int64, chunk io.Reader) error
 	commit(d core.Digest, uid string) error
 }
 
-func runChunkedUpload(u uploader, d core.Digest, blob io.Reader, chunkSize int64) error {
-	if err := runChunkedUploadHelper(u, d, blob, chunkSize); err != nil && !httputil.IsConflict(err) {
+// _chunkRetryInterval is the base interval between retries of a failed chunk,
+// which grows linearly with each attempt.
+var _chunkRetryInterval = time.Second
+
+func (c *HTTPClient) runChunkedUpload(u uploader, d core.Digest, blob io.Reader) error {
+	err := runChunkedUploadHelper(u, d, blob, int64(c.chunkSize), c.chunkRetries, c.progress)
+	if err != nil && !httputil.IsConflict(err) {
 		return err
 	}
 	return nil
 }
 
-func runChunkedUploadHelper(u uploader, d core.Digest, blob io.Reader, chunkSize int64) error {
-	uid, err := u.start(d)
+func runChunkedUploadHelper(
+	u uploader, d core.Digest, blob io.Reader, chunkSize int64,
+	retries int, progress func(int64)) error {
+
+	uid, err := u.start(d, remainingLength(blob))
 	if err != nil {
 		return err
 	}
 	var pos int64
 	buf := make([]byte, chunkSize)
 	for {
-		n, err := blob.Read(buf)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
+		// Streamed blobs, e.g. from stdin, are read in small increments, so
+		// chunks are filled before they are sent.
+		n, err := io.ReadFull(blob, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
 			return fmt.Errorf("read blob: %s", err)
 		}
-		chunk := bytes.NewReader(buf[:n])
 		stop := pos + int64(n)
-		if err := u.patch(d, uid, pos, stop, chunk); err != nil {
+		if err := patchWithRetry(u, d, uid, pos, stop, buf[:n], retries); err != nil {
 			return err
 		}
 		pos = stop
+		if progress != nil {
+			progress(pos)
+		}
+		if n < len(buf) {
+			break
+		}
 	}
 	return u.commit(d, uid)
 }
 
+// remainingLength returns the number of unread bytes of blob, or -1 if unknown.
+func remainingLength(blob io.Reader) int64 {
+	r, ok := blob.(interface {
+		io.Seeker
+		Size() int64
+	})
+	if !ok {
+		return -1
+	}
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	return r.Size() - pos
+}
+
+// uploadLengthHeaders returns the headers announcing the length of an upload.
+func uploadLengthHeaders(length int64) map[string]string {
+	if length < 0 {
+		return nil
+	}
+	return map[string]string{"Upload-Length": strconv.FormatInt(length, 10)}
+}
+
+func patchWithRetry(
+	u uploader, d core.Digest, uid string, start, stop int64, chunk []byte, retries int) error {
+
+	for attempt := 0; ; attempt++ {
+		err := u.patch(d, uid, start, stop, bytes.NewReader(chunk))
+		if err == nil || attempt >= retries {
+			return err
+		}
+		if !httputil.IsNetworkError(err) && !httputil.IsRetryable(err) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt+1) * _chunkRetryInterval)
+	}
+}
+
 // transferClient executes chunked uploads for internal blob transfers.
 type transferClient struct {
-	addr string
-	tls  *tls.Config
+	addr  string
+	tls   *tls.Config
+	proxy *httputil.Proxy
 }
 
-func newTransferClient(addr string, tls *tls.Config) *transferClient {
-	return &transferClient{addr, tls}
+func newTransferClient(addr string, tls *tls.Config, proxy *httputil.Proxy) *transferClient {
+	return &transferClient{addr, tls, proxy}
 }
 
-func (c *transferClient) start(d core.Digest) (uid string, err error) {
+func (c *transferClient) start(d core.Digest, length int64) (uid string, err error) {
 	r, err := httputil.Post(
 		fmt.Sprintf("http://%s/internal/blobs/%s/uploads", c.addr, d),
-		httputil.SendTLS(c.tls))
+		httputil.SendHeaders(uploadLengthHeaders(length)),
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		return "", err
 	}
@@ -99,7 +159,8 @@ func (c *transferClient) patch(
 		httputil.SendHeaders(map[string]string{
 			"Content-Range": fmt.Sprintf("%d-%d", start, stop),
 		}),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
@@ -107,7 +168,8 @@ func (c *transferClient) commit(d core.Digest, uid string) error {
 	_, err := httputil.Put(
 		fmt.Sprintf("http://%s/internal/blobs/%s/uploads/%s", c.addr, d, uid),
 		httputil.SendTimeout(15*time.Minute),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
@@ -125,19 +187,23 @@ type uploadClient struct {
 	uploadType uploadType
 	delay      time.Duration
 	tls        *tls.Config
+	proxy      *httputil.Proxy
 }
 
 func newUploadClient(
-	addr string, namespace string, t uploadType, delay time.Duration, tls *tls.Config) *uploadClient {
+	addr string, namespace string, t uploadType, delay time.Duration,
+	tls *tls.Config, proxy *httputil.Proxy) *uploadClient {
 
-	return &uploadClient{addr, namespace, t, delay, tls}
+	return &uploadClient{addr, namespace, t, delay, tls, proxy}
 }
 
-func (c *uploadClient) start(d core.Digest) (uid string, err error) {
+func (c *uploadClient) start(d core.Digest, length int64) (uid string, err error) {
 	r, err := httputil.Post(
 		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/uploads",
 			c.addr, url.PathEscape(c.namespace), d),
-		httputil.SendTLS(c.tls))
+		httputil.SendHeaders(uploadLengthHeaders(length)),
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	if err != nil {
 		return "", err
 	}
@@ -158,7 +224,8 @@ func (c *uploadClient) patch(
 		httputil.SendHeaders(map[string]string{
 			"Content-Range": fmt.Sprintf("%d-%d", start, stop),
 		}),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
 
@@ -187,6 +254,7 @@ func (c *uploadClient) commit(d core.Digest, uid string) error {
 		fmt.Sprintf(template, c.addr, url.PathEscape(c.namespace), d, uid),
 		httputil.SendTimeout(15*time.Minute),
 		httputil.SendBody(body),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendProxy(c.proxy))
 	return err
 }
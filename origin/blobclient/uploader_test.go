@@ -0,0 +1,114 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyUploader fails the first patch of each chunk with a 503, and records
+// the content of successful patches.
+type flakyUploader struct {
+	failed    map[int64]bool
+	length    int64
+	content   bytes.Buffer
+	committed bool
+}
+
+func newFlakyUploader() *flakyUploader {
+	return &flakyUploader{failed: make(map[int64]bool)}
+}
+
+func (u *flakyUploader) start(d core.Digest, length int64) (string, error) {
+	u.length = length
+	return "uid", nil
+}
+
+func (u *flakyUploader) patch(d core.Digest, uid string, start, stop int64, chunk io.Reader) error {
+	b, err := ioutil.ReadAll(chunk)
+	if err != nil {
+		return err
+	}
+	if !u.failed[start] {
+		u.failed[start] = true
+		return httputil.StatusError{Status: http.StatusServiceUnavailable}
+	}
+	u.content.Write(b)
+	return nil
+}
+
+func (u *flakyUploader) commit(d core.Digest, uid string) error {
+	u.committed = true
+	return nil
+}
+
+func TestChunkedUploadRetriesFailedChunks(t *testing.T) {
+	require := require.New(t)
+
+	defer func(i time.Duration) { _chunkRetryInterval = i }(_chunkRetryInterval)
+	_chunkRetryInterval = 0
+
+	blob := randutil.Text(100)
+	u := newFlakyUploader()
+
+	var progress []int64
+	require.NoError(runChunkedUploadHelper(
+		u, core.DigestFixture(), bytes.NewReader(blob), 32, 1,
+		func(n int64) { progress = append(progress, n) }))
+	require.True(u.committed)
+	require.Equal(int64(100), u.length)
+	require.Equal(blob, u.content.Bytes())
+	require.Equal([]int64{32, 64, 96, 100}, progress)
+}
+
+func TestChunkedUploadLength(t *testing.T) {
+	require := require.New(t)
+
+	blob := randutil.Text(100)
+
+	r := bytes.NewReader(blob)
+	_, err := r.Seek(10, io.SeekStart)
+	require.NoError(err)
+	u := newFlakyUploader()
+	require.NoError(runChunkedUploadHelper(u, core.DigestFixture(), r, 32, 1, nil))
+	require.Equal(int64(90), u.length)
+
+	// Readers of unknown size upload without a length.
+	u = newFlakyUploader()
+	require.NoError(runChunkedUploadHelper(
+		u, core.DigestFixture(), struct{ io.Reader }{bytes.NewReader(blob)}, 32, 1, nil))
+	require.Equal(int64(-1), u.length)
+}
+
+func TestChunkedUploadFailsWithoutRetries(t *testing.T) {
+	require := require.New(t)
+
+	u := newFlakyUploader()
+
+	err := runChunkedUploadHelper(
+		u, core.DigestFixture(), bytes.NewReader(randutil.Text(100)), 32, 0, nil)
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+	require.False(u.committed)
+}
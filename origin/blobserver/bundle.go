@@ -0,0 +1,244 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/uber-go/tally"
+)
+
+// ringResolver resolves digests into clients of the origins which own them in
+// ring.
+type ringResolver struct {
+	ring     hashring.Ring
+	provider blobclient.Provider
+}
+
+func (r *ringResolver) Resolve(d core.Digest) ([]blobclient.Client, error) {
+	var clients []blobclient.Client
+	for _, addr := range r.ring.Locations(d) {
+		clients = append(clients, r.provider.Provide(addr))
+	}
+	return clients, nil
+}
+
+// bundler bundles the small blobs of images. Bundles are built asynchronously
+// by the origin owning the image manifest, uploaded to the cluster like any
+// other blob, and recorded in the metadata of the manifest.
+type bundler struct {
+	config  BundleConfig
+	stats   tally.Scope
+	cas     *store.CAStore
+	cluster blobclient.ClusterClient
+
+	mu      sync.Mutex
+	pending map[core.Digest]bool
+}
+
+func newBundler(
+	config BundleConfig,
+	stats tally.Scope,
+	cas *store.CAStore,
+	cluster blobclient.ClusterClient) *bundler {
+
+	return &bundler{
+		config:  config,
+		stats:   stats.SubScope("bundle"),
+		cas:     cas,
+		cluster: cluster,
+		pending: make(map[core.Digest]bool),
+	}
+}
+
+// get returns the bundle of manifest, which must exist locally. Returns a 202
+// handler error while the bundle is being built, and a 404 handler error if
+// the image is not bundled.
+func (b *bundler) get(namespace string, manifest core.Digest) (*core.BundleIndex, error) {
+	var md metadata.Bundle
+	if err := b.cas.GetCacheFileMetadata(manifest.Hex(), &md); err == nil {
+		return &md.Index, nil
+	} else if !os.IsNotExist(err) {
+		return nil, handler.Errorf("get bundle metadata: %s", err)
+	}
+	blobs, err := b.selectBlobs(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if len(blobs) < b.config.MinBlobs {
+		b.stats.Counter("not_bundled").Inc(1)
+		return nil, handler.Errorf("image not bundled").Status(http.StatusNotFound)
+	}
+	b.start(namespace, manifest, blobs)
+	return nil, handler.ErrorStatus(http.StatusAccepted)
+}
+
+// selectBlobs returns the small blobs referenced by manifest, in order.
+func (b *bundler) selectBlobs(manifest core.Digest) ([]core.BundleBlob, error) {
+	f, err := b.cas.GetCacheFileReader(manifest.Hex())
+	if err != nil {
+		return nil, handler.Errorf("get manifest: %s", err)
+	}
+	defer f.Close()
+	m, _, err := dockerutil.ParseManifestV2(f)
+	if err != nil {
+		return nil, handler.Errorf("parse manifest: %s", err).Status(http.StatusNotFound)
+	}
+	var blobs []core.BundleBlob
+	var size int64
+	seen := make(map[core.Digest]bool)
+	for _, desc := range m.References() {
+		d, err := core.ParseSHA256Digest(string(desc.Digest))
+		if err != nil {
+			return nil, handler.Errorf("parse digest: %s", err).Status(http.StatusNotFound)
+		}
+		if seen[d] || desc.Size <= 0 || uint64(desc.Size) > uint64(b.config.MaxBlobSize) {
+			continue
+		}
+		if uint64(size+desc.Size) > uint64(b.config.MaxBundleSize) {
+			continue
+		}
+		seen[d] = true
+		size += desc.Size
+		blobs = append(blobs, core.BundleBlob{Digest: d, Length: desc.Size})
+	}
+	return blobs, nil
+}
+
+// start starts building the bundle of manifest, unless already building.
+func (b *bundler) start(namespace string, manifest core.Digest, blobs []core.BundleBlob) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pending[manifest] {
+		return
+	}
+	b.pending[manifest] = true
+	go func() {
+		defer func() {
+			b.mu.Lock()
+			delete(b.pending, manifest)
+			b.mu.Unlock()
+		}()
+		timer := b.stats.Timer("build").Start()
+		if err := b.build(namespace, manifest, blobs); err != nil {
+			log.With("manifest", manifest).Errorf("Error building bundle: %s", err)
+			b.stats.Counter("build_errors").Inc(1)
+			return
+		}
+		timer.Stop()
+		b.stats.Counter("builds").Inc(1)
+	}()
+}
+
+// build writes the bundle of blobs, uploads it to the cluster, and records it
+// in the metadata of manifest.
+func (b *bundler) build(namespace string, manifest core.Digest, blobs []core.BundleBlob) error {
+	name := fmt.Sprintf("%s.bundle.%s", manifest.Hex(), uuid.Generate().String())
+	if err := b.cas.CreateUploadFile(name, 0); err != nil {
+		return fmt.Errorf("create upload file: %s", err)
+	}
+	defer b.cas.DeleteUploadFile(name)
+
+	f, err := b.cas.GetUploadFileReadWriter(name)
+	if err != nil {
+		return fmt.Errorf("get upload writer: %s", err)
+	}
+	defer f.Close()
+
+	entries, err := core.WriteBundle(f, blobs, func(d core.Digest, dst io.Writer) error {
+		return b.copyBlob(namespace, d, dst)
+	})
+	if err != nil {
+		return fmt.Errorf("write bundle: %s", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek: %s", err)
+	}
+	d, err := core.NewDigester().FromReader(f)
+	if err != nil {
+		return fmt.Errorf("digest bundle: %s", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek: %s", err)
+	}
+	if err := b.cluster.UploadBlob(namespace, d, f); err != nil {
+		return fmt.Errorf("upload bundle: %s", err)
+	}
+	index := core.BundleIndex{Digest: d, Entries: entries}
+	if _, err := b.cas.SetCacheFileMetadata(manifest.Hex(), metadata.NewBundle(index)); err != nil {
+		return fmt.Errorf("set bundle metadata: %s", err)
+	}
+	return nil
+}
+
+// copyBlob copies the blob of d to dst, preferring the local copy.
+func (b *bundler) copyBlob(namespace string, d core.Digest, dst io.Writer) error {
+	f, err := b.cas.GetCacheFileReader(d.Hex())
+	if os.IsNotExist(err) {
+		return b.cluster.DownloadBlob(namespace, d, dst)
+	} else if err != nil {
+		return fmt.Errorf("get cache file: %s", err)
+	}
+	defer f.Close()
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// getBundleHandler returns the bundle of the small blobs of an image manifest.
+// If the manifest is not available locally, a download of the manifest from
+// the storage backend is initiated, and the request must be retried.
+func (s *Server) getBundleHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	if s.bundler == nil {
+		return handler.Errorf("bundling disabled").Status(http.StatusNotFound)
+	}
+	if ok, err := blobExists(s.cas, d); err != nil {
+		return handler.Errorf("check blob: %s", err)
+	} else if !ok {
+		return s.startRemoteBlobDownload(namespace, d, true)
+	}
+	index, err := s.bundler.get(namespace, d)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(index); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
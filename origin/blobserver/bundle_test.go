@@ -0,0 +1,206 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/mocks/origin/blobclient"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// bundleManifestFixture creates an image manifest whose config is config and
+// whose layers are layers.
+func bundleManifestFixture(config *core.BlobFixture, layers ...*core.BlobFixture) (core.Digest, []byte) {
+	type descriptor struct {
+		MediaType string `json:"mediaType"`
+		Size      int64  `json:"size"`
+		Digest    string `json:"digest"`
+	}
+	m := struct {
+		SchemaVersion int          `json:"schemaVersion"`
+		MediaType     string       `json:"mediaType"`
+		Config        descriptor   `json:"config"`
+		Layers        []descriptor `json:"layers"`
+	}{
+		SchemaVersion: 2,
+		MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
+		Config: descriptor{
+			"application/vnd.docker.container.image.v1+json", config.Length(), config.Digest.String(),
+		},
+	}
+	for _, l := range layers {
+		m.Layers = append(m.Layers, descriptor{
+			"application/vnd.docker.image.rootfs.diff.tar.gzip", l.Length(), l.Digest.String(),
+		})
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	d, err := core.NewDigester().FromBytes(raw)
+	if err != nil {
+		panic(err)
+	}
+	return d, raw
+}
+
+type bundlerMocks struct {
+	cas     *store.CAStore
+	cluster *mockblobclient.MockClusterClient
+}
+
+func newBundlerMocks(t *testing.T) (*bundlerMocks, func()) {
+	var cleanup testutil.Cleanup
+
+	ctrl := gomock.NewController(t)
+	cleanup.Add(ctrl.Finish)
+
+	cas, c := store.CAStoreFixture()
+	cleanup.Add(c)
+
+	return &bundlerMocks{cas, mockblobclient.NewMockClusterClient(ctrl)}, cleanup.Run
+}
+
+func (m *bundlerMocks) new(config BundleConfig) *bundler {
+	return newBundler(config.applyDefaults(), tally.NoopScope, m.cas, m.cluster)
+}
+
+func TestBundlerBundlesSmallBlobs(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newBundlerMocks(t)
+	defer cleanup()
+
+	b := mocks.new(BundleConfig{MaxBlobSize: 64, MinBlobs: 3})
+
+	namespace := core.NamespaceFixture()
+	config := core.SizedBlobFixture(16, 4)
+	small1 := core.SizedBlobFixture(32, 4)
+	small2 := core.SizedBlobFixture(64, 4)
+	large := core.SizedBlobFixture(128, 4)
+	manifest, raw := bundleManifestFixture(config, small1, large, small2)
+
+	require.NoError(mocks.cas.CreateCacheFile(manifest.Hex(), bytes.NewReader(raw)))
+	require.NoError(mocks.cas.CreateCacheFile(config.Digest.Hex(), bytes.NewReader(config.Content)))
+
+	for _, blob := range []*core.BlobFixture{small1, small2} {
+		content := blob.Content
+		mocks.cluster.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+			func(namespace string, d core.Digest, dst io.Writer) error {
+				_, err := dst.Write(content)
+				return err
+			})
+	}
+
+	uploaded := make(chan *core.BlobFixture, 1)
+	mocks.cluster.EXPECT().UploadBlob(namespace, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, r io.Reader) error {
+			content, err := ioutil.ReadAll(r)
+			uploaded <- &core.BlobFixture{Content: content, Digest: d}
+			return err
+		})
+
+	_, err := b.get(namespace, manifest)
+	requireStatus(t, http.StatusAccepted, err)
+
+	var index *core.BundleIndex
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		index, err = b.get(namespace, manifest)
+		return err == nil
+	}))
+
+	bundle := <-uploaded
+	require.Equal(bundle.Digest, index.Digest)
+	d, err := core.NewDigester().FromBytes(bundle.Content)
+	require.NoError(err)
+	require.Equal(bundle.Digest, d)
+
+	entries, err := core.ReadBundleEntries(bytes.NewReader(bundle.Content))
+	require.NoError(err)
+	require.Equal(entries, index.Entries)
+
+	expected := []*core.BlobFixture{config, small1, small2}
+	require.Len(entries, len(expected))
+	for i, e := range entries {
+		require.Equal(expected[i].Digest, e.Digest)
+		require.Equal(expected[i].Content, bundle.Content[e.Offset:e.Offset+e.Length])
+	}
+}
+
+func TestBundlerDoesNotBundleImagesWithFewSmallBlobs(t *testing.T) {
+	mocks, cleanup := newBundlerMocks(t)
+	defer cleanup()
+
+	b := mocks.new(BundleConfig{MaxBlobSize: 64, MinBlobs: 3})
+
+	manifest, raw := bundleManifestFixture(
+		core.SizedBlobFixture(16, 4),
+		core.SizedBlobFixture(32, 4),
+		core.SizedBlobFixture(128, 4))
+	require.NoError(t, mocks.cas.CreateCacheFile(manifest.Hex(), bytes.NewReader(raw)))
+
+	_, err := b.get(core.NamespaceFixture(), manifest)
+	requireStatus(t, http.StatusNotFound, err)
+}
+
+func TestBundlerLimitsBundleSize(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newBundlerMocks(t)
+	defer cleanup()
+
+	b := mocks.new(BundleConfig{MaxBlobSize: 64, MaxBundleSize: 100})
+
+	config := core.SizedBlobFixture(16, 4)
+	layer1 := core.SizedBlobFixture(64, 4)
+	layer2 := core.SizedBlobFixture(64, 4)
+	layer3 := core.SizedBlobFixture(20, 4)
+	manifest, raw := bundleManifestFixture(config, layer1, layer2, layer3)
+	require.NoError(mocks.cas.CreateCacheFile(manifest.Hex(), bytes.NewReader(raw)))
+
+	blobs, err := b.selectBlobs(manifest)
+	require.NoError(err)
+	require.Equal([]core.BundleBlob{
+		{Digest: config.Digest, Length: config.Length()},
+		{Digest: layer1.Digest, Length: layer1.Length()},
+		{Digest: layer3.Digest, Length: layer3.Length()},
+	}, blobs)
+}
+
+func TestBundlerRejectsManifestLists(t *testing.T) {
+	mocks, cleanup := newBundlerMocks(t)
+	defer cleanup()
+
+	b := mocks.new(BundleConfig{})
+
+	manifest, raw := dockerutil.ManifestListFixture(core.DigestFixture())
+	require.NoError(t, mocks.cas.CreateCacheFile(manifest.Hex(), bytes.NewReader(raw)))
+
+	_, err := b.get(core.NamespaceFixture(), manifest)
+	requireStatus(t, http.StatusNotFound, err)
+}
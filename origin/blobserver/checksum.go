@@ -0,0 +1,106 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+)
+
+// _checksumHashes defines the algorithms supported for upload checksums.
+var _checksumHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// checksum is an expected "<algo>:<hex>" hash of uploaded content.
+type checksum struct {
+	algo string
+	hex  string
+}
+
+func (c checksum) String() string {
+	return fmt.Sprintf("%s:%s", c.algo, c.hex)
+}
+
+func digestChecksum(d core.Digest) checksum {
+	return checksum{d.Algo(), d.Hex()}
+}
+
+// parseChecksumHeader parses the optional Upload-Checksum header, which clients
+// may set on upload start to have content verified against a checksum in
+// addition to the blob digest. Returns nil if the header is not set.
+func parseChecksumHeader(h http.Header) (*checksum, error) {
+	raw := h.Get("Upload-Checksum")
+	if raw == "" {
+		return nil, nil
+	}
+	parts := strings.Split(raw, ":")
+	if len(parts) != 2 {
+		return nil, handler.Errorf(
+			"invalid Upload-Checksum %q: expected '<algo>:<hex>'", raw).Status(http.StatusBadRequest)
+	}
+	algo, hexsum := parts[0], strings.ToLower(parts[1])
+	newHash, ok := _checksumHashes[algo]
+	if !ok {
+		return nil, handler.Errorf(
+			"unsupported Upload-Checksum algo %q", algo).Status(http.StatusBadRequest)
+	}
+	if b, err := hex.DecodeString(hexsum); err != nil || len(b) != newHash().Size() {
+		return nil, handler.Errorf(
+			"invalid Upload-Checksum %q: malformed %s", raw, algo).Status(http.StatusBadRequest)
+	}
+	return &checksum{algo, hexsum}, nil
+}
+
+// checksumWriter computes hashes of written content for a set of checksums.
+type checksumWriter struct {
+	checksums []checksum
+	hashes    []hash.Hash
+}
+
+func newChecksumWriter(checksums []checksum) *checksumWriter {
+	w := &checksumWriter{checksums: checksums}
+	for _, c := range checksums {
+		w.hashes = append(w.hashes, _checksumHashes[c.algo]())
+	}
+	return w
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	for _, h := range w.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// verify returns a 400 error if any computed hash does not match its checksum.
+func (w *checksumWriter) verify() error {
+	for i, c := range w.checksums {
+		if computed := hex.EncodeToString(w.hashes[i].Sum(nil)); computed != c.hex {
+			return handler.Errorf(
+				"checksum mismatch: computed %s:%s, expected %s", c.algo, computed, c).
+				Status(http.StatusBadRequest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/utils/memsize"
+
+	"github.com/uber-go/tally"
+)
+
+const _coalesceReadChunkSize = memsize.MB
+
+// sharedRead is a single disk read of a blob, buffered in memory such that
+// any number of readers can stream it concurrently as it fills.
+type sharedRead struct {
+	size int64
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  []byte
+	done bool
+	err  error
+
+	// Protected by readCoalescer.mu.
+	refs int
+}
+
+func newSharedRead(size int64) *sharedRead {
+	r := &sharedRead{size: size, buf: make([]byte, 0, size)}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+// fill reads f into r.buf and closes f.
+func (r *sharedRead) fill(f base.FileReader) {
+	defer f.Close()
+
+	chunk := make([]byte, _coalesceReadChunkSize)
+	for {
+		n, err := f.Read(chunk)
+		r.mu.Lock()
+		r.buf = append(r.buf, chunk[:n]...)
+		if err != nil {
+			r.done = true
+			if err != io.EOF {
+				r.err = err
+			}
+		}
+		r.cond.Broadcast()
+		r.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeTo streams r.buf to dst as it fills, until the read completes.
+func (r *sharedRead) writeTo(dst io.Writer) error {
+	var offset int
+	for {
+		r.mu.Lock()
+		for offset == len(r.buf) && !r.done {
+			r.cond.Wait()
+		}
+		// Slices of buf are never modified after being appended, so they are
+		// safe to write outside of the lock.
+		b := r.buf[offset:]
+		done, err := r.done, r.err
+		r.mu.Unlock()
+
+		if _, werr := dst.Write(b); werr != nil {
+			return fmt.Errorf("write: %s", werr)
+		}
+		offset += len(b)
+		if done && offset == len(r.buf) {
+			if err != nil {
+				return fmt.Errorf("read: %s", err)
+			}
+			return nil
+		}
+	}
+}
+
+// readCoalescer deduplicates concurrent disk reads of the same blob. When many
+// agents fall back to origin for the same blob at once, the first download
+// reads the blob from disk and all concurrent downloads fan out from the same
+// in-memory buffer, which is released once the last download finishes.
+//
+// Blobs which are too large to buffer are copied directly from disk, which
+// allows the http server to use sendfile.
+type readCoalescer struct {
+	config CoalesceConfig
+	stats  tally.Scope
+
+	mu       sync.Mutex
+	reads    map[core.Digest]*sharedRead
+	buffered int64
+}
+
+func newReadCoalescer(config CoalesceConfig, stats tally.Scope) *readCoalescer {
+	return &readCoalescer{
+		config: config,
+		stats:  stats,
+		reads:  make(map[core.Digest]*sharedRead),
+	}
+}
+
+// copy writes the blob d, opened as f, to dst. Takes ownership of f.
+func (c *readCoalescer) copy(d core.Digest, f base.FileReader, dst io.Writer) error {
+	r, ok := c.acquire(d, f)
+	if !ok {
+		defer f.Close()
+		if _, err := io.Copy(dst, f); err != nil {
+			return fmt.Errorf("copy: %s", err)
+		}
+		return nil
+	}
+	defer c.release(d, r)
+	return r.writeTo(dst)
+}
+
+// acquire returns the shared read of d, starting one from f if there is none.
+// f is closed if an existing read is joined. Returns false if d should not be
+// coalesced, in which case the caller retains ownership of f.
+func (c *readCoalescer) acquire(d core.Digest, f base.FileReader) (*sharedRead, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if r, ok := c.reads[d]; ok {
+		f.Close()
+		r.refs++
+		c.stats.Counter("coalesced_reads").Inc(1)
+		return r, true
+	}
+	size := f.Size()
+	if size > int64(c.config.MaxBlobSize) || c.buffered+size > int64(c.config.MaxBufferedBytes) {
+		c.stats.Counter("uncoalesced_reads").Inc(1)
+		return nil, false
+	}
+	r := newSharedRead(size)
+	r.refs = 1
+	c.reads[d] = r
+	c.buffered += size
+	c.stats.Counter("disk_reads").Inc(1)
+	go r.fill(f)
+	return r, true
+}
+
+// release drops a reference to r, and stops sharing r once unreferenced. If
+// every reader failed before r was filled, the fill still runs to completion,
+// after which the buffer is garbage collected.
+func (c *readCoalescer) release(d core.Digest, r *sharedRead) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r.refs--
+	if r.refs == 0 && c.reads[d] == r {
+		delete(c.reads, d)
+		c.buffered -= r.size
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/randutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// blockingFileReader is a base.FileReader over an in-memory blob which blocks
+// reads until unblocked, and counts reads and closes.
+type blockingFileReader struct {
+	*bytes.Reader
+	size    int64
+	unblock chan struct{}
+	reads   *int32
+	closed  bool
+}
+
+func newBlockingFileReader(b []byte, unblock chan struct{}, reads *int32) *blockingFileReader {
+	return &blockingFileReader{bytes.NewReader(b), int64(len(b)), unblock, reads, false}
+}
+
+func (f *blockingFileReader) Read(p []byte) (int, error) {
+	<-f.unblock
+	atomic.AddInt32(f.reads, 1)
+	return f.Reader.Read(p)
+}
+
+func (f *blockingFileReader) Close() error {
+	f.closed = true
+	return nil
+}
+
+func (f *blockingFileReader) Size() int64 {
+	return f.size
+}
+
+func TestReadCoalescerSharesSingleDiskRead(t *testing.T) {
+	require := require.New(t)
+
+	config := CoalesceConfig{Enabled: true}.applyDefaults()
+	c := newReadCoalescer(config, tally.NoopScope)
+
+	blob := randutil.Text(3*_coalesceReadChunkSize + 17)
+	d := core.DigestFixture()
+	unblock := make(chan struct{})
+	var leaderReads, followerReads int32
+
+	// Start the leader first, such that all followers join its read.
+	var wg sync.WaitGroup
+	results := make([]*bytes.Buffer, 10)
+	for i := range results {
+		results[i] = new(bytes.Buffer)
+	}
+	leader := newBlockingFileReader(blob, unblock, &leaderReads)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		require.NoError(c.copy(d, leader, results[0]))
+	}()
+	require.NoError(testutil.PollUntilTrue(time.Second, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.reads[d] != nil
+	}))
+
+	for i := 1; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f := newBlockingFileReader(blob, unblock, &followerReads)
+			require.NoError(c.copy(d, f, results[i]))
+			require.True(f.closed)
+		}(i)
+	}
+	// Only unblock the leader once every follower has joined its read.
+	require.NoError(testutil.PollUntilTrue(time.Second, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.reads[d].refs == len(results)
+	}))
+	close(unblock)
+	wg.Wait()
+
+	for _, r := range results {
+		require.Equal(blob, r.Bytes())
+	}
+	require.Equal(int32(0), followerReads)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.Empty(c.reads)
+	require.Equal(int64(0), c.buffered)
+}
+
+func TestReadCoalescerCopiesLargeBlobsDirectly(t *testing.T) {
+	require := require.New(t)
+
+	config := CoalesceConfig{Enabled: true, MaxBlobSize: 10}.applyDefaults()
+	c := newReadCoalescer(config, tally.NoopScope)
+
+	blob := randutil.Text(11)
+	unblock := make(chan struct{})
+	close(unblock)
+	var reads int32
+	f := newBlockingFileReader(blob, unblock, &reads)
+
+	var dst bytes.Buffer
+	require.NoError(c.copy(core.DigestFixture(), f, &dst))
+	require.Equal(blob, dst.Bytes())
+	require.True(f.closed)
+	require.Empty(c.reads)
+}
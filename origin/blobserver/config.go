@@ -16,18 +16,226 @@ package blobserver
 import (
 	"time"
 
+	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/utils/listener"
+
+	"github.com/c2h5oh/datasize"
 )
 
 // Config defines the configuration used by Origin cluster for hashing blob digests.
 type Config struct {
-	Listener                  listener.Config `yaml:"listener"`
-	DuplicateWriteBackStagger time.Duration   `yaml:"duplicate_write_back_stagger"`
+	Listener                  listener.Config   `yaml:"listener"`
+	DuplicateWriteBackStagger time.Duration     `yaml:"duplicate_write_back_stagger"`
+	Coalesce                  CoalesceConfig    `yaml:"coalesce"`
+	Replication               ReplicationConfig `yaml:"replication"`
+	Repair                    RepairConfig      `yaml:"repair"`
+	Scrub                     ScrubConfig       `yaml:"scrub"`
+
+	// DiskHeadroom rejects new uploads once free disk space runs low.
+	DiskHeadroom DiskHeadroomConfig `yaml:"disk_headroom"`
+
+	// Bundle distributes the small blobs of each image as a single blob.
+	Bundle BundleConfig `yaml:"bundle"`
 }
 
 func (c Config) applyDefaults() Config {
 	if c.DuplicateWriteBackStagger == 0 {
 		c.DuplicateWriteBackStagger = 30 * time.Minute
 	}
+	c.Coalesce = c.Coalesce.applyDefaults()
+	c.Replication = c.Replication.applyDefaults()
+	c.Repair = c.Repair.applyDefaults()
+	c.Scrub = c.Scrub.applyDefaults()
+	c.DiskHeadroom = c.DiskHeadroom.applyDefaults()
+	c.Bundle = c.Bundle.applyDefaults()
+	return c
+}
+
+// CoalesceConfig defines configuration for coalescing concurrent downloads of
+// the same blob into a single disk read.
+type CoalesceConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxBlobSize is the largest blob which is buffered in memory. Larger blobs
+	// are always copied directly from disk.
+	MaxBlobSize datasize.ByteSize `yaml:"max_blob_size"`
+
+	// MaxBufferedBytes limits the total size of blobs buffered at once.
+	MaxBufferedBytes datasize.ByteSize `yaml:"max_buffered_bytes"`
+}
+
+func (c CoalesceConfig) applyDefaults() CoalesceConfig {
+	if c.MaxBlobSize == 0 {
+		c.MaxBlobSize = 512 * datasize.MB
+	}
+	if c.MaxBufferedBytes == 0 {
+		c.MaxBufferedBytes = 4 * datasize.GB
+	}
+	return c
+}
+
+// ReplicationConfig defines configuration for enforcing per-DC replication
+// factors of blobs.
+type ReplicationConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// DC is the name of the DC this origin cluster runs in.
+	DC string `yaml:"dc"`
+
+	// Remotes maps the names of other DCs to the hosts of their origin clusters.
+	Remotes map[string]hostlist.Config `yaml:"remotes"`
+
+	// Rules define the required replication factors per namespace. The first
+	// rule whose namespace regexp matches a blob's namespace applies. Blobs
+	// which match no rule are not enforced.
+	Rules []ReplicationRule `yaml:"rules"`
+
+	// Interval is the interval at which blobs are checked.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// ReplicationRule defines the number of origin replicas each blob of a
+// namespace must have in each DC.
+type ReplicationRule struct {
+	Namespace string         `yaml:"namespace"`
+	Replicas  map[string]int `yaml:"replicas"`
+}
+
+func (c ReplicationConfig) applyDefaults() ReplicationConfig {
+	if c.Interval == 0 {
+		c.Interval = 10 * time.Minute
+	}
+	return c
+}
+
+// RepairConfig defines configuration for repairing corrupt blobs.
+type RepairConfig struct {
+	// BackendTimeout is how long to wait for a corrupt blob to be downloaded
+	// from the storage backend.
+	BackendTimeout time.Duration `yaml:"backend_timeout"`
+
+	// BackendPollInterval is the interval at which backend downloads are
+	// checked for completion.
+	BackendPollInterval time.Duration `yaml:"backend_poll_interval"`
+
+	// JobRetention is how long finished repair jobs are kept for.
+	JobRetention time.Duration `yaml:"job_retention"`
+}
+
+func (c RepairConfig) applyDefaults() RepairConfig {
+	if c.BackendTimeout == 0 {
+		c.BackendTimeout = 10 * time.Minute
+	}
+	if c.BackendPollInterval == 0 {
+		c.BackendPollInterval = time.Second
+	}
+	if c.JobRetention == 0 {
+		c.JobRetention = time.Hour
+	}
+	return c
+}
+
+// ScrubConfig defines configuration for periodically verifying cached blobs
+// against their digests.
+type ScrubConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// FractionPerHour is the fraction of cached blobs verified each hour, e.g.
+	// 0.01 verifies every blob over roughly four days.
+	FractionPerHour float64 `yaml:"fraction_per_hour"`
+
+	// Interval is the interval at which batches of blobs are verified.
+	Interval time.Duration `yaml:"interval"`
+
+	// MaxBytesPerSec limits the rate at which blobs are read from disk, so that
+	// scrubbing does not compete with serving blobs.
+	MaxBytesPerSec datasize.ByteSize `yaml:"max_bytes_per_sec"`
+
+	// QuarantineDir is where copies of corrupt blobs are kept for inspection.
+	QuarantineDir string `yaml:"quarantine_dir"`
+
+	// QuarantineMaxBytes caps the size of QuarantineDir. The oldest copies are
+	// deleted to make room for new ones, and corrupt blobs larger than the cap
+	// are repaired without being quarantined.
+	QuarantineMaxBytes datasize.ByteSize `yaml:"quarantine_max_bytes"`
+
+	// QuarantineTTL is how long copies of corrupt blobs are kept.
+	QuarantineTTL time.Duration `yaml:"quarantine_ttl"`
+}
+
+func (c ScrubConfig) applyDefaults() ScrubConfig {
+	if c.FractionPerHour == 0 {
+		c.FractionPerHour = 0.01
+	}
+	if c.Interval == 0 {
+		c.Interval = time.Minute
+	}
+	if c.MaxBytesPerSec == 0 {
+		c.MaxBytesPerSec = 50 * datasize.MB
+	}
+	if c.QuarantineMaxBytes == 0 {
+		c.QuarantineMaxBytes = 10 * datasize.GB
+	}
+	if c.QuarantineTTL == 0 {
+		c.QuarantineTTL = 7 * 24 * time.Hour
+	}
+	return c
+}
+
+// DiskHeadroomConfig defines admission control of uploads by free disk space,
+// such that origins reject new uploads instead of filling their disks and
+// failing writes which are already in flight.
+type DiskHeadroomConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MinFreeBytes is the free disk space which must remain after an upload.
+	// Applies to every directory of the CAStore.
+	MinFreeBytes datasize.ByteSize `yaml:"min_free_bytes"`
+
+	// MinFreeRatio is the fraction of the disk which must remain free after an
+	// upload. Disabled if zero.
+	MinFreeRatio float64 `yaml:"min_free_ratio"`
+
+	// CheckInterval is how long free disk space is cached for. Uploads admitted
+	// in between checks are subtracted from the cached free space.
+	CheckInterval time.Duration `yaml:"check_interval"`
+}
+
+func (c DiskHeadroomConfig) applyDefaults() DiskHeadroomConfig {
+	if c.MinFreeBytes == 0 {
+		c.MinFreeBytes = 10 * datasize.GB
+	}
+	if c.CheckInterval == 0 {
+		c.CheckInterval = 5 * time.Second
+	}
+	return c
+}
+
+// BundleConfig defines bundling of the small blobs of images, such that agents
+// download them as a single torrent instead of one torrent per blob.
+type BundleConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxBlobSize is the largest blob which is bundled.
+	MaxBlobSize datasize.ByteSize `yaml:"max_blob_size"`
+
+	// MaxBundleSize limits the size of bundles. Small blobs which do not fit
+	// are left out of the bundle.
+	MaxBundleSize datasize.ByteSize `yaml:"max_bundle_size"`
+
+	// MinBlobs is the fewest small blobs an image must have to be bundled.
+	MinBlobs int `yaml:"min_blobs"`
+}
+
+func (c BundleConfig) applyDefaults() BundleConfig {
+	if c.MaxBlobSize == 0 {
+		c.MaxBlobSize = datasize.MB
+	}
+	if c.MaxBundleSize == 0 {
+		c.MaxBundleSize = 64 * datasize.MB
+	}
+	if c.MinBlobs == 0 {
+		c.MinBlobs = 4
+	}
 	return c
 }
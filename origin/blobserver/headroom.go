@@ -0,0 +1,141 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/c2h5oh/datasize"
+	"github.com/uber-go/tally"
+)
+
+// diskUsage is the free and total space of a filesystem, in bytes.
+type diskUsage struct {
+	free  uint64
+	total uint64
+}
+
+func statfs(dir string) (diskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return diskUsage{}, err
+	}
+	return diskUsage{
+		free:  uint64(st.Bavail) * uint64(st.Bsize),
+		total: uint64(st.Blocks) * uint64(st.Bsize),
+	}, nil
+}
+
+// diskHeadroom admits uploads only while enough disk space remains free in
+// every directory uploads are written to.
+type diskHeadroom struct {
+	config DiskHeadroomConfig
+	dirs   []string
+	clk    clock.Clock
+	stats  tally.Scope
+	statfs func(dir string) (diskUsage, error)
+
+	mu       sync.Mutex
+	usage    diskUsage // Of the fullest directory.
+	reserved uint64    // Bytes admitted since usage was checked.
+	checked  time.Time
+}
+
+func newDiskHeadroom(
+	config DiskHeadroomConfig, dirs []string, clk clock.Clock, stats tally.Scope) *diskHeadroom {
+
+	return &diskHeadroom{
+		config: config,
+		dirs:   dirs,
+		clk:    clk,
+		stats:  stats.SubScope("disk_headroom"),
+		statfs: statfs,
+	}
+}
+
+// check refreshes the usage of the fullest directory. Must be called with mu
+// held.
+func (h *diskHeadroom) check() error {
+	var fullest *diskUsage
+	for _, dir := range h.dirs {
+		u, err := h.statfs(dir)
+		if err != nil {
+			return fmt.Errorf("statfs %s: %s", dir, err)
+		}
+		if fullest == nil || u.free < fullest.free {
+			fullest = &u
+		}
+	}
+	if fullest != nil {
+		h.usage = *fullest
+	}
+	h.reserved = 0
+	h.checked = h.clk.Now()
+	h.stats.Gauge("free_bytes").Update(float64(h.usage.free))
+	return nil
+}
+
+// minFree returns the bytes which must remain free.
+func (h *diskHeadroom) minFree() uint64 {
+	min := uint64(h.config.MinFreeBytes)
+	if r := uint64(h.config.MinFreeRatio * float64(h.usage.total)); r > min {
+		min = r
+	}
+	return min
+}
+
+// admit returns a 507 error if an upload of length bytes would leave less
+// than the configured headroom free. length is negative if unknown, in which
+// case the upload is admitted while the headroom remains. Uploads are admitted
+// if disk usage cannot be checked, since uploads fail anyway once disks are
+// unusable.
+func (h *diskHeadroom) admit(length int64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.checked.IsZero() || h.clk.Now().Sub(h.checked) >= h.config.CheckInterval {
+		if err := h.check(); err != nil {
+			h.stats.Counter("check_errors").Inc(1)
+			log.Errorf("Error checking disk headroom, admitting upload: %s", err)
+			return nil
+		}
+	}
+	var size uint64
+	if length > 0 {
+		size = uint64(length)
+	}
+	var free uint64
+	if h.usage.free > h.reserved {
+		free = h.usage.free - h.reserved
+	}
+	min := h.minFree()
+	if free < size || free-size < min {
+		h.stats.Counter("rejected_uploads").Inc(1)
+		return handler.Errorf(
+			"insufficient disk headroom: %s free, %s upload, %s must remain free",
+			datasize.ByteSize(free).HR(),
+			datasize.ByteSize(size).HR(),
+			datasize.ByteSize(min).HR()).Status(http.StatusInsufficientStorage)
+	}
+	h.reserved += size
+	return nil
+}
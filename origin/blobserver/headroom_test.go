@@ -0,0 +1,181 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type fakeStatfs struct {
+	usage map[string]diskUsage
+	err   error
+	calls int
+}
+
+func (f *fakeStatfs) statfs(dir string) (diskUsage, error) {
+	f.calls++
+	if f.err != nil {
+		return diskUsage{}, f.err
+	}
+	return f.usage[dir], nil
+}
+
+func newTestDiskHeadroom(
+	config DiskHeadroomConfig, fs *fakeStatfs) (*diskHeadroom, *clock.Mock) {
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+	var dirs []string
+	for dir := range fs.usage {
+		dirs = append(dirs, dir)
+	}
+	h := newDiskHeadroom(config.applyDefaults(), dirs, clk, tally.NoopScope)
+	h.statfs = fs.statfs
+	return h, clk
+}
+
+func requireInsufficientStorage(t *testing.T, err error) {
+	require.Error(t, err)
+	herr, ok := err.(*handler.Error)
+	require.True(t, ok, "expected handler error, got %T", err)
+	require.Equal(t, http.StatusInsufficientStorage, herr.GetStatus())
+}
+
+func TestDiskHeadroomAdmitsUploadsAboveMinFree(t *testing.T) {
+	require := require.New(t)
+
+	fs := &fakeStatfs{usage: map[string]diskUsage{
+		"/upload": {free: 100, total: 1000},
+	}}
+	h, _ := newTestDiskHeadroom(DiskHeadroomConfig{MinFreeBytes: 50}, fs)
+
+	require.NoError(h.admit(50))
+	requireInsufficientStorage(t, h.admit(1))
+}
+
+func TestDiskHeadroomUsesFullestDir(t *testing.T) {
+	fs := &fakeStatfs{usage: map[string]diskUsage{
+		"/upload": {free: 1000, total: 1000},
+		"/cache":  {free: 60, total: 1000},
+	}}
+	h, _ := newTestDiskHeadroom(DiskHeadroomConfig{MinFreeBytes: 50}, fs)
+
+	requireInsufficientStorage(t, h.admit(20))
+}
+
+func TestDiskHeadroomMinFreeRatio(t *testing.T) {
+	require := require.New(t)
+
+	fs := &fakeStatfs{usage: map[string]diskUsage{
+		"/upload": {free: 300, total: 1000},
+	}}
+	h, _ := newTestDiskHeadroom(
+		DiskHeadroomConfig{MinFreeBytes: 1, MinFreeRatio: 0.2}, fs)
+
+	require.NoError(h.admit(100))
+	requireInsufficientStorage(t, h.admit(1))
+}
+
+func TestDiskHeadroomUnknownLengthAdmittedWhileHeadroomRemains(t *testing.T) {
+	require := require.New(t)
+
+	fs := &fakeStatfs{usage: map[string]diskUsage{
+		"/upload": {free: 100, total: 1000},
+	}}
+	h, _ := newTestDiskHeadroom(DiskHeadroomConfig{MinFreeBytes: 100}, fs)
+
+	require.NoError(h.admit(-1))
+
+	fs.usage["/upload"] = diskUsage{free: 99, total: 1000}
+	h.checked = time.Time{}
+	requireInsufficientStorage(t, h.admit(-1))
+}
+
+func TestDiskHeadroomReservesAdmittedUploadsUntilNextCheck(t *testing.T) {
+	require := require.New(t)
+
+	fs := &fakeStatfs{usage: map[string]diskUsage{
+		"/upload": {free: 100, total: 1000},
+	}}
+	h, clk := newTestDiskHeadroom(
+		DiskHeadroomConfig{MinFreeBytes: 10, CheckInterval: time.Second}, fs)
+
+	require.NoError(h.admit(60))
+	requireInsufficientStorage(t, h.admit(60))
+	require.Equal(1, fs.calls)
+
+	// The first upload completed elsewhere, freeing disk space.
+	clk.Add(time.Second)
+	require.NoError(h.admit(60))
+	require.Equal(2, fs.calls)
+}
+
+func TestDiskHeadroomAdmitsOnStatfsError(t *testing.T) {
+	require := require.New(t)
+
+	fs := &fakeStatfs{
+		usage: map[string]diskUsage{"/upload": {}},
+		err:   errors.New("some error"),
+	}
+	h, _ := newTestDiskHeadroom(DiskHeadroomConfig{MinFreeBytes: datasize.GB}, fs)
+
+	require.NoError(h.admit(100))
+}
+
+func TestDiskHeadroomStatfs(t *testing.T) {
+	require := require.New(t)
+
+	u, err := statfs("/")
+	require.NoError(err)
+	require.True(u.total >= u.free)
+}
+
+func TestUploadRejectedWithInsufficientDiskHeadroom(t *testing.T) {
+	require := require.New(t)
+
+	fs := &fakeStatfs{usage: map[string]diskUsage{
+		"/upload": {free: 100, total: 1000},
+	}}
+	h, _ := newTestDiskHeadroom(DiskHeadroomConfig{MinFreeBytes: 200}, fs)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp, func(s *Server) {
+		s.headroom = h
+	})
+	defer s.cleanup()
+
+	blob := core.NewBlobFixture()
+
+	err := cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content))
+	require.Error(err)
+	require.True(httputil.IsInsufficientStorage(err))
+
+	ok, err := blobExists(s.cas, blob.Digest)
+	require.NoError(err)
+	require.False(ok)
+}
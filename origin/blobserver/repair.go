@@ -0,0 +1,328 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/metainfogen"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// SwarmDownloader downloads blobs from the p2p swarm, verifying every piece
+// against the metainfo of the blob.
+type SwarmDownloader interface {
+	// Download downloads the blob of d. Closing the returned reader releases
+	// the downloaded blob.
+	Download(namespace string, d core.Digest) (io.ReadCloser, error)
+}
+
+// Repair job states.
+const (
+	RepairRunning   = "running"
+	RepairSucceeded = "succeeded"
+	RepairFailed    = "failed"
+)
+
+// Repair sources.
+const (
+	RepairSourceSwarm   = "swarm"
+	RepairSourceBackend = "backend"
+)
+
+// RepairJob describes the verification and repair of a single blob.
+type RepairJob struct {
+	Namespace string      `json:"namespace"`
+	Digest    core.Digest `json:"digest"`
+	State     string      `json:"state"`
+
+	// Corrupt is set if the local blob did not match its digest.
+	Corrupt bool `json:"corrupt"`
+
+	// Source is where the blob was repaired from, if it was corrupt.
+	Source string `json:"source,omitempty"`
+
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// repairer verifies blobs and replaces corrupt blobs, preferring the p2p swarm
+// over the storage backend.
+type repairer struct {
+	config            RepairConfig
+	stats             tally.Scope
+	clk               clock.Clock
+	cas               *store.CAStore
+	blobRefresher     *blobrefresh.Refresher
+	metaInfoGenerator *metainfogen.Generator
+	swarm             SwarmDownloader
+
+	mu   sync.Mutex
+	jobs map[core.Digest]*RepairJob
+}
+
+func newRepairer(
+	config RepairConfig,
+	stats tally.Scope,
+	clk clock.Clock,
+	cas *store.CAStore,
+	blobRefresher *blobrefresh.Refresher,
+	metaInfoGenerator *metainfogen.Generator,
+	swarm SwarmDownloader) *repairer {
+
+	return &repairer{
+		config:            config,
+		stats:             stats.SubScope("repair"),
+		clk:               clk,
+		cas:               cas,
+		blobRefresher:     blobRefresher,
+		metaInfoGenerator: metaInfoGenerator,
+		swarm:             swarm,
+		jobs:              make(map[core.Digest]*RepairJob),
+	}
+}
+
+// start starts a repair job for d, unless one is already running. Returns a
+// snapshot of the job.
+func (r *repairer) start(namespace string, d core.Digest) RepairJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cleanupFinishedJobs()
+
+	if job, ok := r.jobs[d]; ok && job.State == RepairRunning {
+		return *job
+	}
+	job := &RepairJob{
+		Namespace: namespace,
+		Digest:    d,
+		State:     RepairRunning,
+		StartedAt: r.clk.Now(),
+	}
+	r.jobs[d] = job
+	go r.run(job)
+	return *job
+}
+
+// get returns a snapshot of the latest repair job of d.
+func (r *repairer) get(d core.Digest) (RepairJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[d]
+	if !ok {
+		return RepairJob{}, false
+	}
+	return *job, true
+}
+
+// cleanupFinishedJobs must be called with r.mu held.
+func (r *repairer) cleanupFinishedJobs() {
+	for d, job := range r.jobs {
+		if job.FinishedAt != nil && r.clk.Now().Sub(*job.FinishedAt) > r.config.JobRetention {
+			delete(r.jobs, d)
+		}
+	}
+}
+
+func (r *repairer) run(job *RepairJob) {
+	corrupt, err := r.verify(job.Digest)
+	if err != nil {
+		r.finish(job, "", fmt.Errorf("verify: %s", err))
+		return
+	}
+	if !corrupt {
+		r.finish(job, "", nil)
+		return
+	}
+	log.With("blob", job.Digest.Hex()).Warn("Detected corrupt blob, repairing")
+	r.stats.Counter("corrupt_blobs").Inc(1)
+
+	r.mu.Lock()
+	job.Corrupt = true
+	r.mu.Unlock()
+
+	if r.swarm != nil {
+		err := r.repairFromSwarm(job.Namespace, job.Digest)
+		if err == nil {
+			r.finish(job, RepairSourceSwarm, nil)
+			return
+		}
+		log.With("blob", job.Digest.Hex()).Warnf(
+			"Error repairing blob from swarm, falling back to backend: %s", err)
+		r.stats.Counter("swarm_errors").Inc(1)
+	}
+	r.finish(job, RepairSourceBackend, r.repairFromBackend(job.Namespace, job.Digest))
+}
+
+func (r *repairer) finish(job *RepairJob, source string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clk.Now()
+	job.FinishedAt = &now
+	if err != nil {
+		log.With("blob", job.Digest.Hex()).Errorf("Error repairing blob: %s", err)
+		r.stats.Counter("failures").Inc(1)
+		job.State = RepairFailed
+		job.Error = err.Error()
+		return
+	}
+	job.State = RepairSucceeded
+	job.Source = source
+	if source != "" {
+		r.stats.Tagged(map[string]string{"source": source}).Counter("repaired_blobs").Inc(1)
+	}
+}
+
+// verify returns whether the cached blob of d does not match d.
+func (r *repairer) verify(d core.Digest) (corrupt bool, err error) {
+	f, err := r.cas.GetCacheFileReader(d.Hex())
+	if err != nil {
+		return false, fmt.Errorf("get cache reader: %s", err)
+	}
+	defer f.Close()
+
+	computed, err := core.NewDigester().FromReader(f)
+	if err != nil {
+		return false, fmt.Errorf("compute digest: %s", err)
+	}
+	return computed != d, nil
+}
+
+func (r *repairer) repairFromSwarm(namespace string, d core.Digest) error {
+	blob, err := r.swarm.Download(namespace, d)
+	if err != nil {
+		return fmt.Errorf("download: %s", err)
+	}
+	defer blob.Close()
+
+	return r.replace(d, blob)
+}
+
+// replace replaces the cached blob of d with blob, keeping the persist and
+// namespace metadata of the original blob.
+func (r *repairer) replace(d core.Digest, blob io.Reader) error {
+	name := d.Hex()
+
+	var pm metadata.Persist
+	if err := r.cas.GetCacheFileMetadata(name, &pm); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("get persist metadata: %s", err)
+	}
+	var nm metadata.Namespace
+	if err := r.cas.GetCacheFileMetadata(name, &nm); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("get namespace metadata: %s", err)
+	}
+	if err := r.cas.DeleteCacheFile(name); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete corrupt blob: %s", err)
+	}
+	if err := r.cas.CreateCacheFile(name, blob); err != nil {
+		return fmt.Errorf("create cache file: %s", err)
+	}
+	if pm.Value {
+		if _, err := r.cas.SetCacheFileMetadata(name, &pm); err != nil {
+			return fmt.Errorf("set persist metadata: %s", err)
+		}
+	}
+	if nm.Value != "" {
+		if _, err := r.cas.SetCacheFileMetadata(name, &nm); err != nil {
+			return fmt.Errorf("set namespace metadata: %s", err)
+		}
+	}
+	if err := r.metaInfoGenerator.Generate(d); err != nil {
+		return fmt.Errorf("generate metainfo: %s", err)
+	}
+	return nil
+}
+
+// repairFromBackend deletes the corrupt blob of d and downloads it again from
+// the storage backend configured for namespace.
+func (r *repairer) repairFromBackend(namespace string, d core.Digest) error {
+	if err := r.cas.DeleteCacheFile(d.Hex()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete corrupt blob: %s", err)
+	}
+	switch err := r.blobRefresher.Refresh(namespace, d); err {
+	case nil, blobrefresh.ErrPending:
+	case blobrefresh.ErrNotFound:
+		return errors.New("blob not found in backend")
+	default:
+		return fmt.Errorf("refresh: %s", err)
+	}
+	deadline := time.Now().Add(r.config.BackendTimeout)
+	for time.Now().Before(deadline) {
+		if _, err := r.cas.GetCacheFileStat(d.Hex()); err == nil {
+			return nil
+		}
+		time.Sleep(r.config.BackendPollInterval)
+	}
+	return errors.New("timed out waiting for backend download")
+}
+
+// startRepairHandler verifies the local blob and repairs it if it is corrupt.
+func (s *Server) startRepairHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	if ok, err := blobExists(s.cas, d); err != nil {
+		return handler.Errorf("check blob: %s", err)
+	} else if !ok {
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
+	job := s.repairer.start(namespace, d)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// getRepairHandler returns the latest repair job of a blob.
+func (s *Server) getRepairHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	job, ok := s.repairer.get(d)
+	if !ok {
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
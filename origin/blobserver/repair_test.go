@@ -0,0 +1,194 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/mockutil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+type fakeSwarmDownloader struct {
+	blob   *core.BlobFixture
+	err    error
+	closed int32
+}
+
+func (f *fakeSwarmDownloader) Download(namespace string, d core.Digest) (io.ReadCloser, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &fakeSwarmBlob{bytes.NewReader(f.blob.Content), f}, nil
+}
+
+type fakeSwarmBlob struct {
+	io.Reader
+	f *fakeSwarmDownloader
+}
+
+func (b *fakeSwarmBlob) Close() error {
+	atomic.StoreInt32(&b.f.closed, 1)
+	return nil
+}
+
+func startRepair(t *testing.T, addr, namespace string, d core.Digest) {
+	_, err := httputil.Post(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/repair", addr, url.PathEscape(namespace), d),
+		httputil.SendAcceptedCodes(202))
+	require.NoError(t, err)
+}
+
+func waitForRepair(t *testing.T, addr string, d core.Digest) RepairJob {
+	var job RepairJob
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		resp, err := httputil.Get(fmt.Sprintf("http://%s/blobs/%s/repair", addr, d))
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			return false
+		}
+		return job.State != RepairRunning
+	}))
+	return job
+}
+
+func TestRepairHealthyBlob(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	s := newTestServer(t, master1, hashRingNoReplica(), cp)
+	defer s.cleanup()
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+	require.NoError(cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+
+	startRepair(t, s.addr, namespace, blob.Digest)
+	job := waitForRepair(t, s.addr, blob.Digest)
+
+	require.Equal(RepairSucceeded, job.State)
+	require.False(job.Corrupt)
+	require.Empty(job.Source)
+}
+
+func TestRepairCorruptBlobFromSwarm(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+	swarm := &fakeSwarmDownloader{blob: blob}
+
+	cp := newTestClientProvider()
+	s := newTestServer(t, master1, hashRingNoReplica(), cp, WithSwarmDownloader(swarm))
+	defer s.cleanup()
+
+	require.NoError(cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+	store.CorruptCacheFile(s.cas, blob.Digest.Hex())
+
+	startRepair(t, s.addr, namespace, blob.Digest)
+	job := waitForRepair(t, s.addr, blob.Digest)
+
+	require.Equal(RepairSucceeded, job.State)
+	require.True(job.Corrupt)
+	require.Equal(RepairSourceSwarm, job.Source)
+	require.Equal(int32(1), atomic.LoadInt32(&swarm.closed))
+	ensureHasBlob(t, cp.Provide(master1), namespace, blob)
+}
+
+func TestRepairCorruptBlobFallsBackToBackend(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+	swarm := &fakeSwarmDownloader{err: errors.New("no peers")}
+
+	cp := newTestClientProvider()
+	s := newTestServer(t, master1, hashRingNoReplica(), cp, WithSwarmDownloader(swarm))
+	defer s.cleanup()
+
+	require.NoError(cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+	store.CorruptCacheFile(s.cas, blob.Digest.Hex())
+
+	backendClient := s.backendClient(namespace)
+	backendClient.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(blob.Info(), nil)
+	backendClient.EXPECT().Download(
+		namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
+
+	startRepair(t, s.addr, namespace, blob.Digest)
+	job := waitForRepair(t, s.addr, blob.Digest)
+
+	require.Equal(RepairSucceeded, job.State)
+	require.True(job.Corrupt)
+	require.Equal(RepairSourceBackend, job.Source)
+	ensureHasBlob(t, cp.Provide(master1), namespace, blob)
+}
+
+func TestRepairCorruptBlobFails(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+	s := newTestServer(t, master1, hashRingNoReplica(), cp)
+	defer s.cleanup()
+
+	require.NoError(cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+	store.CorruptCacheFile(s.cas, blob.Digest.Hex())
+
+	backendClient := s.backendClient(namespace)
+	backendClient.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(nil, errors.New("some error"))
+	backendClient.EXPECT().Download(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	startRepair(t, s.addr, namespace, blob.Digest)
+	job := waitForRepair(t, s.addr, blob.Digest)
+
+	require.Equal(RepairFailed, job.State)
+	require.True(job.Corrupt)
+	require.NotEmpty(job.Error)
+}
+
+func TestRepairBlobNotFound(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	s := newTestServer(t, master1, hashRingNoReplica(), cp)
+	defer s.cleanup()
+
+	d := core.DigestFixture()
+
+	_, err := httputil.Post(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/repair", s.addr, url.PathEscape(core.TagFixture()), d))
+	require.True(httputil.IsNotFound(err))
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/blobs/%s/repair", s.addr, d))
+	require.True(httputil.IsNotFound(err))
+}
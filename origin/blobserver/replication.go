@@ -0,0 +1,479 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/errutil"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// UnderReplicatedBlob describes a blob which has fewer replicas in a DC than
+// the rule of its namespace requires.
+type UnderReplicatedBlob struct {
+	Namespace string      `json:"namespace"`
+	Digest    core.Digest `json:"digest"`
+	DC        string      `json:"dc"`
+	Replicas  int         `json:"replicas"`
+	Required  int         `json:"required"`
+}
+
+// ReplicationReport summarizes the most recent replication pass of an origin.
+// Each origin only reports on the blobs it is responsible for, i.e. blobs for
+// which no higher ranked owner in the local DC holds a replica.
+type ReplicationReport struct {
+	LastRun  time.Time `json:"last_run"`
+	Checked  int       `json:"checked"`
+	Repaired int       `json:"repaired"`
+
+	// UnknownNamespace is the number of cached blobs whose namespace is not
+	// yet known, and which were therefore not checked.
+	UnknownNamespace int `json:"unknown_namespace"`
+
+	// UnderReplicated lists blobs which remained under-replicated after repair.
+	UnderReplicated []UnderReplicatedBlob `json:"under_replicated"`
+
+	// PlacementViolations lists blobs whose local replicas span fewer failure
+	// domains than their owners do. Only checked if failure domains are known.
+	PlacementViolations []PlacementViolation `json:"placement_violations"`
+}
+
+// PlacementViolation describes a blob whose replicas in the local DC share
+// failure domains, such that losing a single failure domain may lose more
+// replicas than necessary.
+type PlacementViolation struct {
+	Namespace string      `json:"namespace"`
+	Digest    core.Digest `json:"digest"`
+	Replicas  int         `json:"replicas"`
+
+	// Domains is the number of failure domains the replicas span, and
+	// Possible the number they could span given the owners of the blob.
+	Domains  int `json:"domains"`
+	Possible int `json:"possible"`
+}
+
+type replicationRule struct {
+	namespace *regexp.Regexp
+	replicas  map[string]int
+}
+
+// replicator periodically checks the replicas of every cached blob against
+// the per-DC replication factors of its namespace, and repairs blobs which are
+// under-replicated.
+type replicator struct {
+	config         ReplicationConfig
+	stats          tally.Scope
+	clk            clock.Clock
+	addr           string
+	hashRing       hashring.Ring
+	cas            *store.CAStore
+	clientProvider blobclient.Provider
+	rules          []replicationRule
+	remotes        map[string]hostlist.List
+	domain         func(addr string) string // Nil if failure domains unknown.
+
+	mu     sync.Mutex
+	report *ReplicationReport
+}
+
+func newReplicator(
+	config ReplicationConfig,
+	stats tally.Scope,
+	clk clock.Clock,
+	addr string,
+	hashRing hashring.Ring,
+	cas *store.CAStore,
+	clientProvider blobclient.Provider,
+	domain func(addr string) string) (*replicator, error) {
+
+	if config.DC == "" {
+		return nil, errors.New("dc required")
+	}
+	remotes := make(map[string]hostlist.List)
+	for dc, c := range config.Remotes {
+		l, err := hostlist.New(c)
+		if err != nil {
+			return nil, fmt.Errorf("remote %s: %s", dc, err)
+		}
+		remotes[dc] = l
+	}
+	var rules []replicationRule
+	for _, rule := range config.Rules {
+		re, err := regexp.Compile(rule.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %s", rule.Namespace, err)
+		}
+		for dc := range rule.Replicas {
+			if _, ok := remotes[dc]; !ok && dc != config.DC {
+				return nil, fmt.Errorf("rule %s: unknown dc %s", rule.Namespace, dc)
+			}
+		}
+		rules = append(rules, replicationRule{re, rule.Replicas})
+	}
+	return &replicator{
+		config:         config,
+		stats:          stats.SubScope("replication"),
+		clk:            clk,
+		addr:           addr,
+		hashRing:       hashRing,
+		cas:            cas,
+		clientProvider: clientProvider,
+		rules:          rules,
+		remotes:        remotes,
+		domain:         domain,
+	}, nil
+}
+
+func (r *replicator) run() {
+	ticker := r.clk.Ticker(r.config.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.runOnce()
+	}
+}
+
+// runOnce checks and repairs all cached blobs this origin is responsible for.
+func (r *replicator) runOnce() {
+	report := &ReplicationReport{
+		LastRun:             r.clk.Now(),
+		UnderReplicated:     []UnderReplicatedBlob{},
+		PlacementViolations: []PlacementViolation{},
+	}
+	names, err := r.cas.ListCacheFiles()
+	if err != nil {
+		log.Errorf("Error listing cache files for replication: %s", err)
+		return
+	}
+	for _, name := range names {
+		d, err := core.NewSHA256DigestFromHex(name)
+		if err != nil {
+			continue
+		}
+		var ns metadata.Namespace
+		if err := r.cas.GetCacheFileMetadata(name, &ns); err != nil {
+			if os.IsNotExist(err) {
+				report.UnknownNamespace++
+			} else {
+				log.With("blob", name).Errorf("Error getting namespace metadata: %s", err)
+			}
+			continue
+		}
+		rule, ok := r.match(ns.Value)
+		if !ok {
+			continue
+		}
+		if err := r.enforce(ns.Value, d, rule, report); err != nil {
+			log.With("blob", name).Errorf("Error enforcing replication: %s", err)
+		}
+	}
+	r.stats.Gauge("checked_blobs").Update(float64(report.Checked))
+	r.stats.Gauge("under_replicated_blobs").Update(float64(len(report.UnderReplicated)))
+	r.stats.Gauge("placement_violations").Update(float64(len(report.PlacementViolations)))
+
+	r.mu.Lock()
+	r.report = report
+	r.mu.Unlock()
+}
+
+func (r *replicator) match(namespace string) (replicationRule, bool) {
+	for _, rule := range r.rules {
+		if rule.namespace.MatchString(namespace) {
+			return rule, true
+		}
+	}
+	return replicationRule{}, false
+}
+
+// enforce repairs the replicas of d in every DC required by rule, recording
+// the outcome in report. Does nothing if a higher ranked local owner holds d,
+// since that owner is responsible for d instead.
+func (r *replicator) enforce(
+	namespace string, d core.Digest, rule replicationRule, report *ReplicationReport) error {
+
+	locs := r.hashRing.Locations(d)
+	rank := len(locs)
+	for i, loc := range locs {
+		if loc == r.addr {
+			rank = i
+		}
+	}
+	var holders, missing []string
+	for i, loc := range locs {
+		if loc == r.addr {
+			holders = append(holders, loc)
+			continue
+		}
+		ok, err := r.holds(loc, namespace, d)
+		if err != nil {
+			log.With("blob", d.Hex(), "origin", loc).Warnf("Error checking replica: %s", err)
+		}
+		if ok {
+			if i < rank {
+				return nil
+			}
+			holders = append(holders, loc)
+		} else {
+			missing = append(missing, loc)
+		}
+	}
+	report.Checked++
+
+	var errs []error
+	if want, ok := rule.replicas[r.config.DC]; ok {
+		for _, loc := range r.spread(missing, holders) {
+			if len(holders) >= want {
+				break
+			}
+			if err := r.transfer(loc, d); err != nil {
+				errs = append(errs, fmt.Errorf("transfer to %s: %s", loc, err))
+				continue
+			}
+			holders = append(holders, loc)
+		}
+		r.record(report, namespace, d, r.config.DC, len(holders), want, len(locs))
+	}
+	r.checkPlacement(report, namespace, d, holders, locs)
+	for dc, want := range rule.replicas {
+		if dc == r.config.DC {
+			continue
+		}
+		if err := r.enforceRemote(dc, want, namespace, d, report); err != nil {
+			errs = append(errs, fmt.Errorf("dc %s: %s", dc, err))
+		}
+	}
+	if len(errs) > 0 {
+		r.stats.Counter("repair_errors").Inc(int64(len(errs)))
+	}
+	return errutil.Join(errs)
+}
+
+// enforceRemote repairs the replicas of d in a remote DC by uploading d to the
+// first remote owner which is missing it, which in turn replicates d to the
+// rest of the owners in its cluster.
+func (r *replicator) enforceRemote(
+	dc string, want int, namespace string, d core.Digest, report *ReplicationReport) error {
+
+	locs, err := blobclient.Locations(r.clientProvider, r.remotes[dc], d)
+	if err != nil {
+		r.record(report, namespace, d, dc, 0, want, 0)
+		return fmt.Errorf("locations: %s", err)
+	}
+	have := 0
+	var missing []string
+	for _, loc := range locs {
+		ok, err := r.holds(loc, namespace, d)
+		if err != nil {
+			log.With("blob", d.Hex(), "origin", loc).Warnf("Error checking remote replica: %s", err)
+		}
+		if ok {
+			have++
+		} else {
+			missing = append(missing, loc)
+		}
+	}
+	if have < want && len(missing) > 0 {
+		f, err := r.cas.GetCacheFileReader(d.Hex())
+		if err != nil {
+			return fmt.Errorf("get cache reader: %s", err)
+		}
+		defer f.Close()
+		if err := r.clientProvider.Provide(missing[0]).UploadBlob(namespace, d, f); err != nil {
+			r.record(report, namespace, d, dc, have, want, len(locs))
+			return fmt.Errorf("upload to %s: %s", missing[0], err)
+		}
+		r.stats.Counter("repairs").Inc(1)
+		report.Repaired++
+		have = len(locs)
+	}
+	r.record(report, namespace, d, dc, have, want, len(locs))
+	return nil
+}
+
+// record adds d to report if it has fewer than want replicas. Logs a warning if
+// want exceeds the number of owners, since such rules can never be met.
+func (r *replicator) record(
+	report *ReplicationReport, namespace string, d core.Digest, dc string, have, want, owners int) {
+
+	if have >= want {
+		return
+	}
+	if owners > 0 && want > owners {
+		log.With("namespace", namespace, "dc", dc).Warnf(
+			"Required replicas %d exceed the %d owners of blob %s", want, owners, d.Hex())
+	}
+	report.UnderReplicated = append(report.UnderReplicated, UnderReplicatedBlob{
+		Namespace: namespace,
+		Digest:    d,
+		DC:        dc,
+		Replicas:  have,
+		Required:  want,
+	})
+}
+
+// failureDomain returns the failure domain of addr. Addresses whose failure
+// domain is unknown are treated as failure domains of their own.
+func (r *replicator) failureDomain(addr string) string {
+	if d := r.domain(addr); d != "" {
+		return d
+	}
+	return addr
+}
+
+func (r *replicator) countDomains(addrs []string) int {
+	domains := make(map[string]bool)
+	for _, addr := range addrs {
+		domains[r.failureDomain(addr)] = true
+	}
+	return len(domains)
+}
+
+// spread orders missing, the owners missing a replica, such that owners in
+// failure domains which hold no replica yet are repaired first.
+func (r *replicator) spread(missing, holders []string) []string {
+	if r.domain == nil {
+		return missing
+	}
+	held := make(map[string]bool)
+	for _, addr := range holders {
+		held[r.failureDomain(addr)] = true
+	}
+	var fresh, rest []string
+	for _, addr := range missing {
+		d := r.failureDomain(addr)
+		if held[d] {
+			rest = append(rest, addr)
+		} else {
+			held[d] = true
+			fresh = append(fresh, addr)
+		}
+	}
+	return append(fresh, rest...)
+}
+
+// checkPlacement adds d to report if holders, the owners holding a replica of
+// d, span fewer failure domains than they could given owners.
+func (r *replicator) checkPlacement(
+	report *ReplicationReport, namespace string, d core.Digest, holders, owners []string) {
+
+	if r.domain == nil || len(holders) < 2 {
+		return
+	}
+	domains := r.countDomains(holders)
+	possible := r.countDomains(owners)
+	if possible > len(holders) {
+		possible = len(holders)
+	}
+	if domains >= possible {
+		return
+	}
+	report.PlacementViolations = append(report.PlacementViolations, PlacementViolation{
+		Namespace: namespace,
+		Digest:    d,
+		Replicas:  len(holders),
+		Domains:   domains,
+		Possible:  possible,
+	})
+}
+
+func (r *replicator) holds(addr, namespace string, d core.Digest) (bool, error) {
+	_, err := r.clientProvider.Provide(addr).StatLocal(namespace, d)
+	if err == blobclient.ErrBlobNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *replicator) transfer(addr string, d core.Digest) error {
+	f, err := r.cas.GetCacheFileReader(d.Hex())
+	if err != nil {
+		return fmt.Errorf("get cache reader: %s", err)
+	}
+	defer f.Close()
+
+	if err := r.clientProvider.Provide(addr).TransferBlob(d, f); err != nil {
+		return err
+	}
+	r.stats.Counter("repairs").Inc(1)
+	return nil
+}
+
+// lastReport returns the report of the most recent replication pass.
+func (r *replicator) lastReport() *ReplicationReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.report == nil {
+		return &ReplicationReport{
+			UnderReplicated:     []UnderReplicatedBlob{},
+			PlacementViolations: []PlacementViolation{},
+		}
+	}
+	return r.report
+}
+
+// namespaceHook records the namespace of blobs downloaded from a storage
+// backend.
+type namespaceHook struct {
+	server    *Server
+	namespace string
+}
+
+func (h *namespaceHook) Run(d core.Digest) {
+	h.server.tagNamespace(h.namespace, d)
+}
+
+// tagNamespace records namespace as the namespace of d if replication is
+// enabled and d has no namespace yet.
+func (s *Server) tagNamespace(namespace string, d core.Digest) {
+	if s.replicator == nil {
+		return
+	}
+	if err := s.cas.GetOrSetCacheFileMetadata(d.Hex(), metadata.NewNamespace(namespace)); err != nil {
+		log.With("blob", d.Hex()).Errorf("Error setting namespace metadata: %s", err)
+	}
+}
+
+// replicationComplianceHandler returns the report of the most recent
+// replication pass.
+func (s *Server) replicationComplianceHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.replicator == nil {
+		return handler.Errorf("replication not enabled").Status(http.StatusNotFound)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.replicator.lastReport()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+func newTestReplicator(
+	t *testing.T, s *testServer, ring hashring.Ring, rules ...ReplicationRule) *replicator {
+
+	r, err := newReplicator(
+		ReplicationConfig{DC: "dc1", Rules: rules}.applyDefaults(),
+		tally.NoopScope, s.clk, s.host, ring, s.cas, s.cp, nil)
+	require.NoError(t, err)
+	return r
+}
+
+func seedBlob(t *testing.T, s *testServer, namespace string, blob *core.BlobFixture) {
+	require := require.New(t)
+
+	require.NoError(s.cp.Provide(s.host).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+	_, err := s.cas.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewNamespace(namespace))
+	require.NoError(err)
+}
+
+func TestReplicatorRepairsUnderReplicatedBlob(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingMaxReplica()
+	cp := newTestClientProvider()
+	namespace := core.TagFixture()
+
+	servers := make(map[string]*testServer)
+	for _, host := range []string{master1, master2, master3} {
+		s := newTestServer(t, host, ring, cp)
+		defer s.cleanup()
+		servers[host] = s
+	}
+
+	blob := computeBlobForHosts(ring, master1, master2, master3)
+	primary := servers[ring.Locations(blob.Digest)[0]]
+	seedBlob(t, primary, namespace, blob)
+
+	r := newTestReplicator(t, primary, ring, ReplicationRule{
+		Namespace: ".*",
+		Replicas:  map[string]int{"dc1": 3},
+	})
+	r.runOnce()
+
+	for host := range servers {
+		ensureHasBlob(t, cp.Provide(host), namespace, blob)
+	}
+	report := r.lastReport()
+	require.Equal(1, report.Checked)
+	require.Empty(report.UnderReplicated)
+}
+
+func TestReplicatorOnlyRepairsRequiredReplicas(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingMaxReplica()
+	cp := newTestClientProvider()
+	namespace := core.TagFixture()
+
+	servers := make(map[string]*testServer)
+	for _, host := range []string{master1, master2, master3} {
+		s := newTestServer(t, host, ring, cp)
+		defer s.cleanup()
+		servers[host] = s
+	}
+
+	blob := computeBlobForHosts(ring, master1, master2, master3)
+	primary := servers[ring.Locations(blob.Digest)[0]]
+	seedBlob(t, primary, namespace, blob)
+
+	r := newTestReplicator(t, primary, ring, ReplicationRule{
+		Namespace: ".*",
+		Replicas:  map[string]int{"dc1": 2},
+	})
+	r.runOnce()
+
+	var replicas int
+	for host := range servers {
+		if _, err := cp.Provide(host).StatLocal(namespace, blob.Digest); err == nil {
+			replicas++
+		}
+	}
+	require.Equal(2, replicas)
+	require.Empty(r.lastReport().UnderReplicated)
+}
+
+func TestReplicatorReportsUnsatisfiableRule(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	cp := newTestClientProvider()
+	namespace := core.TagFixture()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHosts(ring, master1)
+	seedBlob(t, s, namespace, blob)
+
+	r := newTestReplicator(t, s, ring, ReplicationRule{
+		Namespace: ".*",
+		Replicas:  map[string]int{"dc1": 2},
+	})
+	r.runOnce()
+
+	require.Equal([]UnderReplicatedBlob{{
+		Namespace: namespace,
+		Digest:    blob.Digest,
+		DC:        "dc1",
+		Replicas:  1,
+		Required:  2,
+	}}, r.lastReport().UnderReplicated)
+}
+
+// rackServers starts servers for all masters, and places the primary owner of
+// a blob and one other owner in rack1, and the remaining owner in rack2.
+func rackServers(t *testing.T, ring hashring.Ring, cp *testClientProvider) (
+	servers map[string]*testServer, blob *core.BlobFixture, domain func(string) string, cleanup func()) {
+
+	servers = make(map[string]*testServer)
+	var cleanups []func()
+	for _, host := range []string{master1, master2, master3} {
+		s := newTestServer(t, host, ring, cp)
+		cleanups = append(cleanups, s.cleanup)
+		servers[host] = s
+	}
+	blob = computeBlobForHosts(ring, master1, master2, master3)
+	locs := ring.Locations(blob.Digest)
+	racks := map[string]string{locs[0]: "rack1", locs[1]: "rack1", locs[2]: "rack2"}
+	domain = func(addr string) string { return racks[addr] }
+	cleanup = func() {
+		for _, f := range cleanups {
+			f()
+		}
+	}
+	return servers, blob, domain, cleanup
+}
+
+func TestReplicatorSpreadsRepairsAcrossFailureDomains(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingMaxReplica()
+	cp := newTestClientProvider()
+	namespace := core.TagFixture()
+
+	servers, blob, domain, cleanup := rackServers(t, ring, cp)
+	defer cleanup()
+
+	locs := ring.Locations(blob.Digest)
+	primary := servers[locs[0]]
+	seedBlob(t, primary, namespace, blob)
+
+	r, err := newReplicator(
+		ReplicationConfig{DC: "dc1", Rules: []ReplicationRule{{
+			Namespace: ".*",
+			Replicas:  map[string]int{"dc1": 2},
+		}}}.applyDefaults(),
+		tally.NoopScope, primary.clk, primary.host, ring, primary.cas, primary.cp, domain)
+	require.NoError(err)
+	r.runOnce()
+
+	// The owner in the other rack is repaired, despite being ranked lower.
+	ensureHasBlob(t, cp.Provide(locs[2]), namespace, blob)
+	_, err = cp.Provide(locs[1]).StatLocal(namespace, blob.Digest)
+	require.Equal(blobclient.ErrBlobNotFound, err)
+	require.Empty(r.lastReport().PlacementViolations)
+}
+
+func TestReplicatorReportsPlacementViolations(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingMaxReplica()
+	cp := newTestClientProvider()
+	namespace := core.TagFixture()
+
+	servers, blob, domain, cleanup := rackServers(t, ring, cp)
+	defer cleanup()
+
+	locs := ring.Locations(blob.Digest)
+	primary := servers[locs[0]]
+	seedBlob(t, primary, namespace, blob)
+	seedBlob(t, servers[locs[1]], namespace, blob)
+
+	r, err := newReplicator(
+		ReplicationConfig{DC: "dc1", Rules: []ReplicationRule{{
+			Namespace: ".*",
+			Replicas:  map[string]int{"dc1": 2},
+		}}}.applyDefaults(),
+		tally.NoopScope, primary.clk, primary.host, ring, primary.cas, primary.cp, domain)
+	require.NoError(err)
+	r.runOnce()
+
+	require.Equal([]PlacementViolation{{
+		Namespace: namespace,
+		Digest:    blob.Digest,
+		Replicas:  2,
+		Domains:   1,
+		Possible:  2,
+	}}, r.lastReport().PlacementViolations)
+}
+
+func TestReplicatorSkipsBlobsOwnedByHigherRankedReplica(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingSomeReplica()
+	cp := newTestClientProvider()
+	namespace := core.TagFixture()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+
+	blob := computeBlobForHosts(ring, master1, master2)
+	locs := ring.Locations(blob.Digest)
+	servers := map[string]*testServer{master1: s1, master2: s2}
+	primary, secondary := servers[locs[0]], servers[locs[1]]
+	seedBlob(t, primary, namespace, blob)
+	seedBlob(t, secondary, namespace, blob)
+
+	r := newTestReplicator(t, secondary, ring, ReplicationRule{
+		Namespace: ".*",
+		Replicas:  map[string]int{"dc1": 2},
+	})
+	r.runOnce()
+
+	require.Equal(0, r.lastReport().Checked)
+}
+
+func TestReplicatorSkipsBlobsWithoutNamespaceOrRule(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	unknown := computeBlobForHosts(ring, master1)
+	require.NoError(cp.Provide(master1).TransferBlob(unknown.Digest, bytes.NewReader(unknown.Content)))
+
+	unmatched := computeBlobForHosts(ring, master1)
+	seedBlob(t, s, "other-namespace", unmatched)
+
+	r := newTestReplicator(t, s, ring, ReplicationRule{
+		Namespace: "^labrat/.*",
+		Replicas:  map[string]int{"dc1": 2},
+	})
+	r.runOnce()
+
+	report := r.lastReport()
+	require.Equal(1, report.UnknownNamespace)
+	require.Equal(0, report.Checked)
+	require.Empty(report.UnderReplicated)
+}
+
+func TestNewReplicatorRejectsUnknownDC(t *testing.T) {
+	cp := newTestClientProvider()
+	s := newTestServer(t, master1, hashRingNoReplica(), cp)
+	defer s.cleanup()
+
+	_, err := newReplicator(
+		ReplicationConfig{
+			DC:    "dc1",
+			Rules: []ReplicationRule{{Namespace: ".*", Replicas: map[string]int{"dc2": 1}}},
+		},
+		tally.NoopScope, s.clk, s.host, hashRingNoReplica(), s.cas, cp, nil)
+	require.Error(t, err)
+}
+
+func TestReplicationComplianceHandlerDisabled(t *testing.T) {
+	cp := newTestClientProvider()
+	s := newTestServer(t, master1, hashRingNoReplica(), cp)
+	defer s.cleanup()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/replication/compliance", s.addr))
+	require.True(t, httputil.IsNotFound(err))
+}
@@ -0,0 +1,344 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+	"golang.org/x/time/rate"
+)
+
+// ScrubReport describes the progress of the scrubber through the blobs of an
+// origin.
+type ScrubReport struct {
+	LastRun time.Time `json:"last_run"`
+
+	// CycleStartedAt is when the scrubber last started from the first blob.
+	CycleStartedAt time.Time `json:"cycle_started_at"`
+
+	// Progress is the fraction of blobs scrubbed in the current cycle.
+	Progress float64 `json:"progress"`
+
+	// Scrubbed, Corrupt and Quarantined count blobs since the scrubber started.
+	Scrubbed    int `json:"scrubbed"`
+	Corrupt     int `json:"corrupt"`
+	Quarantined int `json:"quarantined"`
+}
+
+// scrubber periodically re-hashes a fraction of cached blobs, such that every
+// blob is eventually verified. Corrupt blobs are copied into a quarantine
+// directory and repaired.
+type scrubber struct {
+	config   ScrubConfig
+	stats    tally.Scope
+	clk      clock.Clock
+	cas      *store.CAStore
+	repairer *repairer
+	limiter  *rate.Limiter
+
+	mu     sync.Mutex
+	cursor string
+	report ScrubReport
+}
+
+func newScrubber(
+	config ScrubConfig,
+	stats tally.Scope,
+	clk clock.Clock,
+	cas *store.CAStore,
+	repairer *repairer) (*scrubber, error) {
+
+	if config.QuarantineDir == "" {
+		return nil, errors.New("quarantine_dir required")
+	}
+	if err := os.MkdirAll(config.QuarantineDir, 0775); err != nil {
+		return nil, fmt.Errorf("mkdir quarantine dir: %s", err)
+	}
+	bps := int(config.MaxBytesPerSec)
+	return &scrubber{
+		config:   config,
+		stats:    stats.SubScope("scrub"),
+		clk:      clk,
+		cas:      cas,
+		repairer: repairer,
+		limiter:  rate.NewLimiter(rate.Limit(bps), bps),
+		report:   ScrubReport{CycleStartedAt: clk.Now()},
+	}, nil
+}
+
+func (s *scrubber) run() {
+	ticker := s.clk.Ticker(s.config.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runOnce()
+	}
+}
+
+// runOnce scrubs the share of blobs due in one interval, resuming after the
+// last blob scrubbed.
+func (s *scrubber) runOnce() {
+	names, err := s.cas.ListCacheFiles()
+	if err != nil {
+		log.Errorf("Error listing cache files for scrubbing: %s", err)
+		return
+	}
+	sort.Strings(names)
+
+	s.mu.Lock()
+	cursor := s.cursor
+	s.mu.Unlock()
+
+	// Blobs which are due this interval, rounded up so that small stores are
+	// still scrubbed.
+	due := int(math.Ceil(
+		s.config.FractionPerHour * float64(len(names)) * s.config.Interval.Hours()))
+	if due > len(names) {
+		due = len(names)
+	}
+	start := sort.SearchStrings(names, cursor)
+	if start < len(names) && names[start] == cursor {
+		start++
+	}
+	for i := 0; i < due; i++ {
+		if start == len(names) {
+			start = 0
+			s.mu.Lock()
+			s.report.CycleStartedAt = s.clk.Now()
+			s.mu.Unlock()
+		}
+		name := names[start]
+		start++
+		if err := s.scrub(name); err != nil {
+			log.With("blob", name).Errorf("Error scrubbing blob: %s", err)
+			s.stats.Counter("errors").Inc(1)
+		}
+		s.mu.Lock()
+		s.cursor = name
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.LastRun = s.clk.Now()
+	if len(names) > 0 {
+		s.report.Progress = float64(start) / float64(len(names))
+	}
+	s.stats.Gauge("progress").Update(s.report.Progress)
+}
+
+// scrub verifies the cached blob of name, quarantining and repairing it if it
+// is corrupt.
+func (s *scrubber) scrub(name string) error {
+	d, err := core.NewSHA256DigestFromHex(name)
+	if err != nil {
+		return nil
+	}
+	corrupt, size, err := s.verify(d)
+	if os.IsNotExist(err) {
+		// Deleted by cleanup since the blobs were listed.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("verify: %s", err)
+	}
+	s.stats.Counter("scrubbed_blobs").Inc(1)
+	s.stats.Counter("scrubbed_bytes").Inc(size)
+	s.mu.Lock()
+	s.report.Scrubbed++
+	s.mu.Unlock()
+	if !corrupt {
+		return nil
+	}
+	log.With("blob", name).Warn("Scrubber detected corrupt blob")
+	s.stats.Counter("corrupt_blobs").Inc(1)
+	s.mu.Lock()
+	s.report.Corrupt++
+	s.mu.Unlock()
+
+	quarantined, err := s.quarantine(name, size)
+	if err != nil {
+		return fmt.Errorf("quarantine: %s", err)
+	}
+	if quarantined {
+		s.stats.Counter("quarantined_blobs").Inc(1)
+		s.mu.Lock()
+		s.report.Quarantined++
+		s.mu.Unlock()
+	} else {
+		s.stats.Counter("quarantine_skipped_blobs").Inc(1)
+	}
+
+	var ns metadata.Namespace
+	if err := s.cas.GetCacheFileMetadata(name, &ns); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("get namespace metadata: %s", err)
+		}
+		// Without a namespace the blob cannot be repaired, so it is removed
+		// instead and downloaded again from the backend on its next request.
+		if err := s.cas.DeleteCacheFile(name); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("delete corrupt blob: %s", err)
+		}
+		return nil
+	}
+	s.repairer.start(ns.Value, d)
+	return nil
+}
+
+// verify returns whether the cached blob of d does not match d, reading the
+// blob no faster than the configured rate.
+func (s *scrubber) verify(d core.Digest) (corrupt bool, size int64, err error) {
+	f, err := s.cas.GetCacheFileReader(d.Hex())
+	if err != nil {
+		return false, 0, err
+	}
+	defer f.Close()
+
+	r := &throttledReader{f, s.limiter}
+	digester := core.NewDigester()
+	size, err = io.Copy(ioutil.Discard, digester.Tee(r))
+	if err != nil {
+		return false, 0, fmt.Errorf("read: %s", err)
+	}
+	return digester.Digest() != d, size, nil
+}
+
+// quarantine copies the corrupt blob of name, which is size bytes, into the
+// quarantine directory, where it is kept for inspection after the blob is
+// repaired. The copy is read no faster than the configured rate. Returns false
+// if the blob does not fit into the quarantine directory.
+func (s *scrubber) quarantine(name string, size int64) (bool, error) {
+	if ok, err := s.pruneQuarantine(size); err != nil {
+		return false, fmt.Errorf("prune: %s", err)
+	} else if !ok {
+		return false, nil
+	}
+	f, err := s.cas.GetCacheFileReader(name)
+	if err != nil {
+		return false, fmt.Errorf("get cache reader: %s", err)
+	}
+	defer f.Close()
+
+	path := filepath.Join(s.config.QuarantineDir, name)
+	dst, err := os.Create(path)
+	if err != nil {
+		return false, fmt.Errorf("create: %s", err)
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, &throttledReader{f, s.limiter}); err != nil {
+		os.Remove(path)
+		return false, fmt.Errorf("copy: %s", err)
+	}
+	return true, nil
+}
+
+// pruneQuarantine deletes quarantined blobs older than the quarantine TTL, and
+// then the oldest quarantined blobs until size more bytes fit into the
+// quarantine directory. Returns false if size alone does not fit.
+func (s *scrubber) pruneQuarantine(size int64) (bool, error) {
+	max := int64(s.config.QuarantineMaxBytes)
+	if size > max {
+		return false, nil
+	}
+	infos, err := ioutil.ReadDir(s.config.QuarantineDir)
+	if err != nil {
+		return false, fmt.Errorf("read dir: %s", err)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	now := s.clk.Now()
+	var kept []os.FileInfo
+	var total int64
+	for _, info := range infos {
+		if now.Sub(info.ModTime()) > s.config.QuarantineTTL {
+			s.removeQuarantined(info.Name())
+			continue
+		}
+		kept = append(kept, info)
+		total += info.Size()
+	}
+	for len(kept) > 0 && total+size > max {
+		s.removeQuarantined(kept[0].Name())
+		total -= kept[0].Size()
+		kept = kept[1:]
+	}
+	return true, nil
+}
+
+func (s *scrubber) removeQuarantined(name string) {
+	if err := os.Remove(filepath.Join(s.config.QuarantineDir, name)); err != nil && !os.IsNotExist(err) {
+		log.With("blob", name).Errorf("Error removing quarantined blob: %s", err)
+		return
+	}
+	s.stats.Counter("quarantine_evictions").Inc(1)
+}
+
+// lastReport returns the progress of the scrubber.
+func (s *scrubber) lastReport() ScrubReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.report
+}
+
+// throttledReader limits the rate at which bytes are read from r.
+type throttledReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if burst := t.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.limiter.WaitN(context.Background(), n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// scrubStatusHandler returns the progress of the scrubber.
+func (s *Server) scrubStatusHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.scrubber == nil {
+		return handler.Errorf("scrubbing not enabled").Status(http.StatusNotFound)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.scrubber.lastReport()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/metainfogen"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func newTestScrubber(
+	t *testing.T, cas *store.CAStore, swarm SwarmDownloader) (*scrubber, func()) {
+
+	dir, err := ioutil.TempDir("/tmp", "quarantine")
+	require.NoError(t, err)
+
+	mg := metainfogen.Fixture(cas, 4)
+	br := blobrefresh.New(blobrefresh.Config{}, tally.NoopScope, cas, backend.ManagerFixture(), mg)
+	clk := clock.NewMock()
+	r := newRepairer(RepairConfig{}.applyDefaults(), tally.NoopScope, clk, cas, br, mg, swarm)
+
+	// Scrub every blob in each run.
+	config := ScrubConfig{FractionPerHour: 60, QuarantineDir: dir}.applyDefaults()
+	s, err := newScrubber(config, tally.NoopScope, clk, cas, r)
+	require.NoError(t, err)
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func TestScrubberQuarantinesAndRepairsCorruptBlobs(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	healthy := core.NewBlobFixture()
+	corrupt := core.NewBlobFixture()
+	for _, blob := range []*core.BlobFixture{healthy, corrupt} {
+		require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+		_, err := cas.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewNamespace("ns"))
+		require.NoError(err)
+	}
+	store.CorruptCacheFile(cas, corrupt.Digest.Hex())
+
+	s, stop := newTestScrubber(t, cas, &fakeSwarmDownloader{blob: corrupt})
+	defer stop()
+
+	s.runOnce()
+
+	report := s.lastReport()
+	require.Equal(2, report.Scrubbed)
+	require.Equal(1, report.Corrupt)
+	require.Equal(1, report.Quarantined)
+	require.Equal(1.0, report.Progress)
+
+	_, err := os.Stat(filepath.Join(s.config.QuarantineDir, corrupt.Digest.Hex()))
+	require.NoError(err)
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		job, ok := s.repairer.get(corrupt.Digest)
+		return ok && job.State == RepairSucceeded
+	}))
+	f, err := cas.GetCacheFileReader(corrupt.Digest.Hex())
+	require.NoError(err)
+	defer f.Close()
+	d, err := core.NewDigester().FromReader(f)
+	require.NoError(err)
+	require.Equal(corrupt.Digest, d)
+}
+
+func TestScrubberQuarantineEvictsExpiredAndOldestBlobs(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	s, stop := newTestScrubber(t, cas, &fakeSwarmDownloader{})
+	defer stop()
+
+	clk := s.clk.(*clock.Mock)
+	clk.Set(time.Now())
+	s.config.QuarantineMaxBytes = 10
+
+	write := func(name string, size int, age time.Duration) {
+		path := filepath.Join(s.config.QuarantineDir, name)
+		require.NoError(ioutil.WriteFile(path, make([]byte, size), 0644))
+		mtime := clk.Now().Add(-age)
+		require.NoError(os.Chtimes(path, mtime, mtime))
+	}
+	write("expired", 1, s.config.QuarantineTTL+time.Hour)
+	write("oldest", 4, 2*time.Hour)
+	write("newest", 4, time.Hour)
+
+	ok, err := s.pruneQuarantine(4)
+	require.NoError(err)
+	require.True(ok)
+
+	for name, exists := range map[string]bool{"expired": false, "oldest": false, "newest": true} {
+		_, err := os.Stat(filepath.Join(s.config.QuarantineDir, name))
+		require.Equal(exists, err == nil, name)
+	}
+
+	// Blobs larger than the quarantine are never quarantined.
+	ok, err = s.pruneQuarantine(11)
+	require.NoError(err)
+	require.False(ok)
+}
+
+func TestScrubberResumesAfterLastScrubbedBlob(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	for i := 0; i < 4; i++ {
+		blob := core.NewBlobFixture()
+		require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	}
+
+	s, stop := newTestScrubber(t, cas, nil)
+	defer stop()
+
+	// Scrub half of the blobs in each run.
+	s.config.Interval = time.Hour
+	s.config.FractionPerHour = 0.5
+
+	s.runOnce()
+	require.Equal(2, s.lastReport().Scrubbed)
+	require.Equal(0.5, s.lastReport().Progress)
+
+	s.runOnce()
+	require.Equal(4, s.lastReport().Scrubbed)
+	require.Equal(1.0, s.lastReport().Progress)
+
+	s.runOnce()
+	require.Equal(6, s.lastReport().Scrubbed)
+	require.Equal(0.5, s.lastReport().Progress)
+}
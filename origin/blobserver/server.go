@@ -15,6 +15,7 @@ package blobserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -66,7 +67,16 @@ type Server struct {
 	blobRefresher     *blobrefresh.Refresher
 	metaInfoGenerator *metainfogen.Generator
 	uploader          *uploader
+	headroom          *diskHeadroom
 	writeBackManager  persistedretry.Manager
+	coalescer         *readCoalescer
+	replicator        *replicator
+	repairer          *repairer
+	scrubber          *scrubber
+	bundler           *bundler // Nil if bundling disabled.
+	swarm             SwarmDownloader
+	domain            func(addr string) string
+	metrics           http.Handler // Nil if metrics are not scraped from s.
 
 	// This is an unfortunate coupling between the p2p client and the blob server.
 	// Tracker queries the origin cluster to discover which origins can seed
@@ -75,6 +85,28 @@ type Server struct {
 	pctx core.PeerContext
 }
 
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithSwarmDownloader configures a Server to repair corrupt blobs from the p2p
+// swarm before falling back to the storage backend.
+func WithSwarmDownloader(d SwarmDownloader) Option {
+	return func(s *Server) { s.swarm = d }
+}
+
+// WithFailureDomains configures a Server to report replicas which share
+// failure domains, e.g. racks, and to spread repaired replicas across them.
+// domain returns the failure domain of an origin address, or "" if unknown.
+func WithFailureDomains(domain func(addr string) string) Option {
+	return func(s *Server) { s.domain = domain }
+}
+
+// WithMetricsHandler configures the Server to serve metrics at /metrics using
+// h.
+func WithMetricsHandler(h http.Handler) Option {
+	return func(s *Server) { s.metrics = h }
+}
+
 // New initializes a new Server.
 func New(
 	config Config,
@@ -89,7 +121,8 @@ func New(
 	backends *backend.Manager,
 	blobRefresher *blobrefresh.Refresher,
 	metaInfoGenerator *metainfogen.Generator,
-	writeBackManager persistedretry.Manager) (*Server, error) {
+	writeBackManager persistedretry.Manager,
+	opts ...Option) (*Server, error) {
 
 	config = config.applyDefaults()
 
@@ -97,7 +130,12 @@ func New(
 		"module": "blobserver",
 	})
 
-	return &Server{
+	var coalescer *readCoalescer
+	if config.Coalesce.Enabled {
+		coalescer = newReadCoalescer(config.Coalesce, stats)
+	}
+
+	s := &Server{
 		config:            config,
 		stats:             stats,
 		clk:               clk,
@@ -109,10 +147,42 @@ func New(
 		backends:          backends,
 		blobRefresher:     blobRefresher,
 		metaInfoGenerator: metaInfoGenerator,
-		uploader:          newUploader(cas),
+		uploader:          newUploader(cas, clk),
 		writeBackManager:  writeBackManager,
+		coalescer:         coalescer,
 		pctx:              pctx,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	go s.uploader.run()
+	if config.DiskHeadroom.Enabled {
+		s.headroom = newDiskHeadroom(config.DiskHeadroom, cas.Dirs(), clk, stats)
+	}
+	s.repairer = newRepairer(
+		config.Repair, stats, clk, cas, blobRefresher, metaInfoGenerator, s.swarm)
+	if config.Replication.Enabled {
+		r, err := newReplicator(
+			config.Replication, stats, clk, addr, hashRing, cas, clientProvider, s.domain)
+		if err != nil {
+			return nil, fmt.Errorf("replication: %s", err)
+		}
+		s.replicator = r
+		go r.run()
+	}
+	if config.Bundle.Enabled {
+		cluster := blobclient.NewClusterClient(&ringResolver{hashRing, clientProvider})
+		s.bundler = newBundler(config.Bundle, stats, cas, cluster)
+	}
+	if config.Scrub.Enabled {
+		sc, err := newScrubber(config.Scrub, stats, clk, cas, s.repairer)
+		if err != nil {
+			return nil, fmt.Errorf("scrub: %s", err)
+		}
+		s.scrubber = sc
+		go sc.run()
+	}
+	return s, nil
 }
 
 // Addr returns the address the blob server is configured on.
@@ -130,6 +200,9 @@ func (s *Server) Handler() http.Handler {
 	// Public endpoints:
 
 	r.Get("/health", handler.Wrap(s.healthCheckHandler))
+	if s.metrics != nil {
+		r.Handle("/metrics", s.metrics)
+	}
 
 	r.Get("/blobs/{digest}/locations", handler.Wrap(s.getLocationsHandler))
 
@@ -143,6 +216,13 @@ func (s *Server) Handler() http.Handler {
 
 	r.Post("/forcecleanup", handler.Wrap(s.forceCleanupHandler))
 
+	r.Get("/replication/compliance", handler.Wrap(s.replicationComplianceHandler))
+
+	r.Post("/namespace/{namespace}/blobs/{digest}/repair", handler.Wrap(s.startRepairHandler))
+	r.Get("/blobs/{digest}/repair", handler.Wrap(s.getRepairHandler))
+
+	r.Get("/scrub/status", handler.Wrap(s.scrubStatusHandler))
+
 	// Internal endpoints:
 
 	r.Post("/internal/blobs/{digest}/uploads", handler.Wrap(s.startTransferHandler))
@@ -159,6 +239,8 @@ func (s *Server) Handler() http.Handler {
 
 	r.Get("/internal/namespace/{namespace}/blobs/{digest}/metainfo", handler.Wrap(s.getMetaInfoHandler))
 
+	r.Get("/internal/namespace/{namespace}/blobs/{digest}/bundle", handler.Wrap(s.getBundleHandler))
+
 	r.Put(
 		"/internal/duplicate/namespace/{namespace}/blobs/{digest}/uploads/{uid}",
 		handler.Wrap(s.duplicateCommitClusterUploadHandler))
@@ -168,6 +250,12 @@ func (s *Server) Handler() http.Handler {
 	return r
 }
 
+// Stop stops the background loops of s, e.g. the cleanup of abandoned
+// uploads.
+func (s *Server) Stop() {
+	s.uploader.stopCleanup()
+}
+
 // ListenAndServe is a blocking call which runs s.
 func (s *Server) ListenAndServe(h http.Handler) error {
 	log.Infof("Starting blob server on %s", s.config.Listener)
@@ -208,6 +296,9 @@ func (s *Server) statHandler(w http.ResponseWriter, r *http.Request) error {
 func (s *Server) stat(namespace string, d core.Digest, checkLocal bool) (*core.BlobInfo, error) {
 	fi, err := s.cas.GetCacheFileStat(d.Hex())
 	if err == nil {
+		// Replicas transferred within the cluster carry no namespace, so the
+		// namespace is learned from the replication checks of other owners.
+		s.tagNamespace(namespace, d)
 		return core.NewBlobInfo(fi.Size()), nil
 	} else if os.IsNotExist(err) {
 		if !checkLocal {
@@ -217,7 +308,7 @@ func (s *Server) stat(namespace string, d core.Digest, checkLocal bool) (*core.B
 			}
 			if bi, err := client.Stat(namespace, d.Hex()); err == nil {
 				return bi, nil
-			} else if err == backenderrors.ErrBlobNotFound {
+			} else if errors.Is(err, backenderrors.ErrBlobNotFound) {
 				return nil, os.ErrNotExist
 			} else {
 				return nil, fmt.Errorf("backend stat: %s", err)
@@ -325,7 +416,9 @@ func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) erro
 	if err != nil {
 		return err
 	}
-	w.Write(raw)
+	if _, err := w.Write(raw); err != nil {
+		return errutil.Wrap(err, "write metainfo", d.Hex())
+	}
 	return nil
 }
 
@@ -391,7 +484,7 @@ func (h *localReplicationHook) Run(d core.Digest) {
 func (s *Server) startRemoteBlobDownload(
 	namespace string, d core.Digest, replicateLocally bool) error {
 
-	var hooks []blobrefresh.PostHook
+	hooks := []blobrefresh.PostHook{&namespaceHook{s, namespace}}
 	if replicateLocally {
 		hooks = append(hooks, &localReplicationHook{s})
 	}
@@ -460,6 +553,12 @@ func (s *Server) downloadBlob(namespace string, d core.Digest, dst io.Writer) er
 	} else if err != nil {
 		return handler.Errorf("get cache file: %s", err)
 	}
+	if s.coalescer != nil {
+		if err := s.coalescer.copy(d, f, dst); err != nil {
+			return handler.Errorf("copy blob: %s", err)
+		}
+		return nil
+	}
 	defer f.Close()
 
 	if _, err := io.Copy(dst, f); err != nil {
@@ -489,7 +588,18 @@ func (s *Server) startTransferHandler(w http.ResponseWriter, r *http.Request) er
 	} else if ok {
 		return handler.ErrorStatus(http.StatusConflict)
 	}
-	uid, err := s.uploader.start(d)
+	c, err := parseChecksumHeader(r.Header)
+	if err != nil {
+		return err
+	}
+	length, err := parseUploadLength(r.Header)
+	if err != nil {
+		return err
+	}
+	if err := s.admitUpload(length); err != nil {
+		return err
+	}
+	uid, err := s.uploader.start(d, c, length)
 	if err != nil {
 		return err
 	}
@@ -548,6 +658,15 @@ func (s *Server) handleUploadConflict(err error, namespace string, d core.Digest
 	return err
 }
 
+// admitUpload rejects uploads of length bytes with 507 if they would run the
+// disks out of headroom, so clients may retry on other origins.
+func (s *Server) admitUpload(length int64) error {
+	if s.headroom == nil {
+		return nil
+	}
+	return s.headroom.admit(length)
+}
+
 // startClusterUploadHandler initializes an upload for external uploads.
 func (s *Server) startClusterUploadHandler(w http.ResponseWriter, r *http.Request) error {
 	d, err := httputil.ParseDigest(r, "digest")
@@ -558,7 +677,18 @@ func (s *Server) startClusterUploadHandler(w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		return err
 	}
-	uid, err := s.uploader.start(d)
+	c, err := parseChecksumHeader(r.Header)
+	if err != nil {
+		return err
+	}
+	length, err := parseUploadLength(r.Header)
+	if err != nil {
+		return err
+	}
+	if err := s.admitUpload(length); err != nil {
+		return err
+	}
+	uid, err := s.uploader.start(d, c, length)
 	if err != nil {
 		return s.handleUploadConflict(err, namespace, d)
 	}
@@ -661,6 +791,7 @@ func (s *Server) duplicateCommitClusterUploadHandler(w http.ResponseWriter, r *h
 }
 
 func (s *Server) writeBack(namespace string, d core.Digest, delay time.Duration) error {
+	s.tagNamespace(namespace, d)
 	if _, err := s.cas.SetCacheFileMetadata(d.Hex(), metadata.NewPersist(true)); err != nil {
 		return handler.Errorf("set persist metadata: %s", err)
 	}
@@ -489,6 +489,27 @@ func TestTransferBlobSmallChunkSize(t *testing.T) {
 	ensureHasBlob(t, client, namespace, blob)
 }
 
+func TestTransferBlobReportsProgress(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	blob := core.SizedBlobFixture(100, 1)
+	namespace := core.TagFixture()
+
+	var progress []int64
+	client := blobclient.New(
+		s.addr,
+		blobclient.WithChunkSize(32),
+		blobclient.WithUploadProgress(func(n int64) { progress = append(progress, n) }))
+
+	err := client.TransferBlob(blob.Digest, bytes.NewReader(blob.Content))
+	require.NoError(err)
+	require.Equal([]int64{32, 64, 96, 100}, progress)
+	ensureHasBlob(t, client, namespace, blob)
+}
+
 func TestOverwriteMetainfo(t *testing.T) {
 	require := require.New(t)
 
@@ -105,7 +105,7 @@ type testServer struct {
 }
 
 func newTestServer(
-	t *testing.T, host string, ring hashring.Ring, cp *testClientProvider) *testServer {
+	t *testing.T, host string, ring hashring.Ring, cp *testClientProvider, opts ...Option) *testServer {
 
 	var cleanup testutil.Cleanup
 	defer cleanup.Recover()
@@ -133,10 +133,11 @@ func newTestServer(
 
 	s, err := New(
 		Config{}, tally.NoopScope, clk, host, ring, cas, cp, clusterProvider, pctx,
-		bm, br, mg, writeBackManager)
+		bm, br, mg, writeBackManager, opts...)
 	if err != nil {
 		panic(err)
 	}
+	cleanup.Add(s.Stop)
 
 	addr, stop := testutil.StartServer(s.Handler())
 	cleanup.Add(stop)
@@ -17,23 +17,89 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/docker/distribution/uuid"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
 )
 
-// uploader executes a chunked upload.
+// _uploadStateCleanupInterval is the interval at which states of abandoned
+// uploads are dropped.
+const _uploadStateCleanupInterval = 5 * time.Minute
+
+// uploadState tracks the checksums of an upload as its chunks stream in.
+// Checksums can only be computed incrementally while chunks arrive in order,
+// so once a chunk arrives out of order (e.g. on retry), commit falls back to
+// hashing the full upload file. If the length of the upload is known, the
+// checksums are verified as soon as the last chunk arrives.
+type uploadState struct {
+	mu       sync.Mutex
+	offset   int64
+	length   int64
+	inOrder  bool
+	checksum *checksum
+	writer   *checksumWriter
+}
+
+func (s *uploadState) checksums(d core.Digest) []checksum {
+	cs := []checksum{digestChecksum(d)}
+	if s.checksum != nil {
+		cs = append(cs, *s.checksum)
+	}
+	return cs
+}
+
+// uploader executes a chunked upload. Uploads are verified against the blob
+// digest, and optionally an additional checksum, as chunks stream in, such
+// that corrupt uploads are rejected before they ever enter the CAS.
 type uploader struct {
 	cas *store.CAStore
+	clk clock.Clock
+
+	mu     sync.Mutex
+	states map[string]*uploadState
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+func newUploader(cas *store.CAStore, clk clock.Clock) *uploader {
+	return &uploader{
+		cas:    cas,
+		clk:    clk,
+		states: make(map[string]*uploadState),
+		stop:   make(chan struct{}),
+	}
+}
+
+// run cleans up abandoned upload states until stopped.
+func (u *uploader) run() {
+	ticker := u.clk.Ticker(_uploadStateCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-u.stop:
+			return
+		case <-ticker.C:
+			u.cleanupAbandonedStates()
+		}
+	}
 }
 
-func newUploader(cas *store.CAStore) *uploader {
-	return &uploader{cas}
+// stopCleanup stops run. Safe to call multiple times.
+func (u *uploader) stopCleanup() {
+	u.stopOnce.Do(func() { close(u.stop) })
 }
 
-func (u *uploader) start(d core.Digest) (uid string, err error) {
+// start begins an upload of d. If c is non-nil, the upload must also match c.
+// length is the total length of the upload, or negative if unknown.
+func (u *uploader) start(d core.Digest, c *checksum, length int64) (uid string, err error) {
 	if ok, err := blobExists(u.cas, d); err != nil {
 		return "", err
 	} else if ok {
@@ -43,9 +109,65 @@ func (u *uploader) start(d core.Digest) (uid string, err error) {
 	if err := u.cas.CreateUploadFile(uid, 0); err != nil {
 		return "", handler.Errorf("create upload file: %s", err)
 	}
+	state := &uploadState{length: length, inOrder: true, checksum: c}
+	state.writer = newChecksumWriter(state.checksums(d))
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.states[uid] = state
+
 	return uid, nil
 }
 
+// cleanupAbandonedStates drops states of uploads which were never committed
+// and whose files have since been cleaned up. Upload files are stat'd without
+// holding u.mu, such that uploads are not blocked on the sweep.
+func (u *uploader) cleanupAbandonedStates() {
+	u.mu.Lock()
+	uids := make([]string, 0, len(u.states))
+	for uid := range u.states {
+		uids = append(uids, uid)
+	}
+	u.mu.Unlock()
+
+	var abandoned []string
+	for _, uid := range uids {
+		if _, err := u.cas.GetUploadFileStat(uid); os.IsNotExist(err) {
+			abandoned = append(abandoned, uid)
+		}
+	}
+	if len(abandoned) == 0 {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, uid := range abandoned {
+		delete(u.states, uid)
+	}
+	log.Debugf("Dropped states of %d abandoned uploads", len(abandoned))
+}
+
+// getState returns the state of upload uid, or nil if uid was started before
+// the origin restarted.
+func (u *uploader) getState(uid string) *uploadState {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.states[uid]
+}
+
+func (u *uploader) removeState(uid string) *uploadState {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	s := u.states[uid]
+	delete(u.states, uid)
+	return s
+}
+
 func (u *uploader) patch(
 	d core.Digest, uid string, chunk io.Reader, start, end int64) error {
 
@@ -65,14 +187,96 @@ func (u *uploader) patch(
 	if _, err := f.Seek(start, 0); err != nil {
 		return handler.Errorf("seek offset %d: %s", start, err).Status(http.StatusBadRequest)
 	}
-	if _, err := io.CopyN(f, chunk, end-start); err != nil {
+
+	state := u.getState(uid)
+	if state == nil {
+		if _, err := io.CopyN(f, chunk, end-start); err != nil {
+			return handler.Errorf("copy: %s", err)
+		}
+		return nil
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.length >= 0 && end > state.length {
+		u.abort(uid)
+		return handler.Errorf(
+			"chunk end %d exceeds upload length %d", end, state.length).
+			Status(http.StatusBadRequest)
+	}
+	if state.inOrder && start != state.offset {
+		state.inOrder = false
+	}
+	var w io.Writer = f
+	if state.inOrder {
+		w = io.MultiWriter(f, state.writer)
+	}
+	if _, err := io.CopyN(w, chunk, end-start); err != nil {
+		// The hashes may have consumed a partial chunk.
+		state.inOrder = false
 		return handler.Errorf("copy: %s", err)
 	}
+	state.offset = end
+	if state.inOrder && end == state.length {
+		// The upload is complete, so corrupt uploads can be rejected before
+		// the client ever commits them.
+		if err := state.writer.verify(); err != nil {
+			u.abort(uid)
+			return err
+		}
+	}
 	return nil
 }
 
+// abort drops the state and file of upload uid, which is known to be corrupt.
+func (u *uploader) abort(uid string) {
+	u.removeState(uid)
+	u.cas.DeleteUploadFile(uid)
+}
+
+// verify checks the content of upload uid against d and any additional
+// checksum in state.
+func (u *uploader) verify(d core.Digest, uid string, state *uploadState) error {
+	if state != nil && state.inOrder {
+		return state.writer.verify()
+	}
+	// Checksums could not be computed incrementally, so hash the full file.
+	var checksums []checksum
+	if state != nil {
+		checksums = state.checksums(d)
+	} else {
+		checksums = []checksum{digestChecksum(d)}
+	}
+	f, err := u.cas.GetUploadFileReader(uid)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("get upload file: %s", err)
+	}
+	defer f.Close()
+	w := newChecksumWriter(checksums)
+	if _, err := io.Copy(w, f); err != nil {
+		return handler.Errorf("read upload file: %s", err)
+	}
+	return w.verify()
+}
+
 func (u *uploader) commit(d core.Digest, uid string) error {
-	if err := u.cas.MoveUploadFileToCache(uid, d.Hex()); err != nil {
+	state := u.removeState(uid)
+	if state != nil {
+		state.mu.Lock()
+		defer state.mu.Unlock()
+	}
+	if err := u.verify(d, uid, state); err != nil {
+		if herr, ok := err.(*handler.Error); ok && herr.GetStatus() == http.StatusBadRequest {
+			// Never keep corrupt uploads around.
+			u.cas.DeleteUploadFile(uid)
+		}
+		return err
+	}
+	if err := u.cas.MoveVerifiedUploadFileToCache(uid, d.Hex()); err != nil {
 		if os.IsNotExist(err) {
 			return handler.ErrorStatus(http.StatusNotFound)
 		}
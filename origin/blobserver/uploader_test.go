@@ -0,0 +1,253 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/utils/handler"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func requireStatus(t *testing.T, status int, err error) {
+	herr, ok := err.(*handler.Error)
+	require.True(t, ok, "expected handler error, got %v", err)
+	require.Equal(t, status, herr.GetStatus())
+}
+
+// uploadChunks uploads blob in two chunks, in the given order.
+func uploadChunks(
+	t *testing.T, u *uploader, d core.Digest, uid string, blob []byte, reverse bool) {
+
+	mid := int64(len(blob) / 2)
+	chunks := [][2]int64{{0, mid}, {mid, int64(len(blob))}}
+	if reverse {
+		chunks[0], chunks[1] = chunks[1], chunks[0]
+	}
+	for _, c := range chunks {
+		require.NoError(t, u.patch(d, uid, bytes.NewReader(blob[c[0]:c[1]]), c[0], c[1]))
+	}
+}
+
+func TestUploaderVerifiesDigest(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		require := require.New(t)
+
+		cas, cleanup := store.CAStoreFixture()
+		defer cleanup()
+
+		u := newUploader(cas, clock.New())
+		blob := core.NewBlobFixture()
+
+		uid, err := u.start(blob.Digest, nil, -1)
+		require.NoError(err)
+		uploadChunks(t, u, blob.Digest, uid, blob.Content, reverse)
+		require.NoError(u.commit(blob.Digest, uid))
+
+		ok, err := blobExists(cas, blob.Digest)
+		require.NoError(err)
+		require.True(ok)
+	}
+}
+
+func TestUploaderRejectsDigestMismatch(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		require := require.New(t)
+
+		cas, cleanup := store.CAStoreFixture()
+		defer cleanup()
+
+		u := newUploader(cas, clock.New())
+		blob := core.NewBlobFixture()
+		other := core.NewBlobFixture()
+
+		uid, err := u.start(blob.Digest, nil, -1)
+		require.NoError(err)
+		uploadChunks(t, u, blob.Digest, uid, other.Content, reverse)
+		requireStatus(t, http.StatusBadRequest, u.commit(blob.Digest, uid))
+
+		// The corrupt upload is cleaned up and never enters the CAS.
+		_, err = cas.GetUploadFileStat(uid)
+		require.True(os.IsNotExist(err))
+		ok, err := blobExists(cas, blob.Digest)
+		require.NoError(err)
+		require.False(ok)
+	}
+}
+
+func TestUploaderVerifiesAdditionalChecksum(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	u := newUploader(cas, clock.New())
+	blob := core.NewBlobFixture()
+
+	sum := sha512.Sum512(blob.Content)
+	valid := &checksum{"sha512", hex.EncodeToString(sum[:])}
+	invalid := &checksum{"sha512", hex.EncodeToString(make([]byte, sha512.Size))}
+
+	uid, err := u.start(blob.Digest, invalid, -1)
+	require.NoError(err)
+	uploadChunks(t, u, blob.Digest, uid, blob.Content, false)
+	requireStatus(t, http.StatusBadRequest, u.commit(blob.Digest, uid))
+
+	uid, err = u.start(blob.Digest, valid, -1)
+	require.NoError(err)
+	uploadChunks(t, u, blob.Digest, uid, blob.Content, false)
+	require.NoError(u.commit(blob.Digest, uid))
+}
+
+func TestUploaderRejectsCorruptUploadOnLastChunk(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	u := newUploader(cas, clock.New())
+	blob := core.NewBlobFixture()
+	other := core.NewBlobFixture()
+
+	uid, err := u.start(blob.Digest, nil, int64(len(other.Content)))
+	require.NoError(err)
+
+	mid := int64(len(other.Content) / 2)
+	end := int64(len(other.Content))
+	require.NoError(u.patch(blob.Digest, uid, bytes.NewReader(other.Content[:mid]), 0, mid))
+	requireStatus(t, http.StatusBadRequest,
+		u.patch(blob.Digest, uid, bytes.NewReader(other.Content[mid:]), mid, end))
+
+	// The corrupt upload is cleaned up without waiting for commit.
+	_, err = cas.GetUploadFileStat(uid)
+	require.True(os.IsNotExist(err))
+	require.Nil(u.getState(uid))
+}
+
+func TestUploaderRejectsChunksBeyondLength(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	u := newUploader(cas, clock.New())
+	blob := core.NewBlobFixture()
+	length := int64(len(blob.Content))
+
+	uid, err := u.start(blob.Digest, nil, length-1)
+	require.NoError(err)
+	requireStatus(t, http.StatusBadRequest,
+		u.patch(blob.Digest, uid, bytes.NewReader(blob.Content), 0, length))
+}
+
+func TestUploaderVerifiesKnownLengthUploads(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	u := newUploader(cas, clock.New())
+	blob := core.NewBlobFixture()
+
+	uid, err := u.start(blob.Digest, nil, int64(len(blob.Content)))
+	require.NoError(err)
+	uploadChunks(t, u, blob.Digest, uid, blob.Content, false)
+	require.NoError(u.commit(blob.Digest, uid))
+}
+
+func TestUploaderCleanupAbandonedStates(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	u := newUploader(cas, clock.New())
+	blob := core.NewBlobFixture()
+
+	abandoned, err := u.start(blob.Digest, nil, -1)
+	require.NoError(err)
+	active, err := u.start(blob.Digest, nil, -1)
+	require.NoError(err)
+	require.NoError(cas.DeleteUploadFile(abandoned))
+
+	u.cleanupAbandonedStates()
+
+	require.Nil(u.getState(abandoned))
+	require.NotNil(u.getState(active))
+}
+
+func TestParseChecksumHeader(t *testing.T) {
+	sum := sha512.Sum512([]byte("foo"))
+	valid := "sha512:" + hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		desc     string
+		header   string
+		expected *checksum
+		err      bool
+	}{
+		{"empty", "", nil, false},
+		{"valid", valid, &checksum{"sha512", hex.EncodeToString(sum[:])}, false},
+		{"unsupported algo", "md5:acbd18db4cc2f85cedef654fccc4a4d8", nil, true},
+		{"wrong length", "sha256:" + hex.EncodeToString(sum[:]), nil, true},
+		{"malformed", "sha512", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			h := http.Header{}
+			h.Set("Upload-Checksum", test.header)
+			c, err := parseChecksumHeader(h)
+			if test.err {
+				requireStatus(t, http.StatusBadRequest, err)
+				return
+			}
+			require.NoError(err)
+			require.Equal(test.expected, c)
+		})
+	}
+}
+
+func TestUploaderStopCleanupStopsRun(t *testing.T) {
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	u := newUploader(cas, clock.NewMock())
+
+	done := make(chan struct{})
+	go func() {
+		u.run()
+		close(done)
+	}()
+
+	u.stopCleanup()
+	u.stopCleanup()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after stopCleanup")
+	}
+}
@@ -53,6 +53,21 @@ func parseContentRange(h http.Header) (start, end int64, err error) {
 	return start, end, nil
 }
 
+// parseUploadLength parses the optional Upload-Length header, which clients may
+// set on upload start if the total length of the upload is known. Returns -1 if
+// the header is not set.
+func parseUploadLength(h http.Header) (int64, error) {
+	raw := h.Get("Upload-Length")
+	if raw == "" {
+		return -1, nil
+	}
+	length, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || length < 0 {
+		return 0, handler.Errorf("invalid Upload-Length %q", raw).Status(http.StatusBadRequest)
+	}
+	return length, nil
+}
+
 // blobExists returns true if cas has a cached blob for d.
 func blobExists(cas *store.CAStore, d core.Digest) (bool, error) {
 	if _, err := cas.GetCacheFileStat(d.Hex()); err != nil {
@@ -19,10 +19,13 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
@@ -32,11 +35,13 @@ import (
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/watchdog"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/origin/blobserver"
+	"github.com/uber/kraken/tracker/topology"
 	"github.com/uber/kraken/utils/configutil"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/log"
@@ -51,11 +56,14 @@ import (
 // Flags defines origin CLI flags.
 type Flags struct {
 	PeerIP             string
+	PeerNetworks       string
 	PeerPort           int
 	BlobServerHostName string
 	BlobServerPort     int
 	ConfigFile         string
 	Zone               string
+	Rack               string
+	DC                 string
 	KrakenCluster      string
 	SecretsFile        string
 }
@@ -65,6 +73,9 @@ func ParseFlags() *Flags {
 	var flags Flags
 	flag.StringVar(
 		&flags.PeerIP, "peer-ip", "", "ip which peer will announce itself as")
+	flag.StringVar(
+		&flags.PeerNetworks, "peer-networks", "",
+		"optional comma separated label=ip pairs of additional networks which multi-homed peer will announce")
 	flag.IntVar(
 		&flags.PeerPort, "peer-port", 0, "port which peer will announce itself as")
 	flag.StringVar(
@@ -75,6 +86,10 @@ func ParseFlags() *Flags {
 		&flags.ConfigFile, "config", "", "configuration file path")
 	flag.StringVar(
 		&flags.Zone, "zone", "", "zone/datacenter name")
+	flag.StringVar(
+		&flags.Rack, "rack", "", "optional rack name used by topology-aware trackers")
+	flag.StringVar(
+		&flags.DC, "dc", "", "optional datacenter name used by topology-aware trackers")
 	flag.StringVar(
 		&flags.KrakenCluster, "cluster", "", "cluster name (e.g. prod01-zone1)")
 	flag.StringVar(
@@ -144,17 +159,33 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	stats := overrides.metrics
+	var metricsHandler http.Handler
 	if stats == nil {
-		s, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+		s, closer, h, err := metrics.NewWithHandler(config.Metrics, flags.KrakenCluster)
 		if err != nil {
 			log.Fatalf("Failed to init metrics: %s", err)
 		}
 		stats = s
+		metricsHandler = h
 		defer closer.Close()
 	}
 
 	go metrics.EmitVersion(stats)
 
+	if config.Watchdog.Enabled {
+		w, err := watchdog.New(config.Watchdog, stats)
+		if err != nil {
+			log.Fatalf("Error creating watchdog: %s", err)
+		}
+		go w.Run()
+	}
+
+	if config.Debug.Enabled() {
+		go func() {
+			log.Fatal(debugserver.ListenAndServe(config.Debug, config))
+		}()
+	}
+
 	var hostname string
 	if flags.BlobServerHostName == "" {
 		var err error
@@ -185,6 +216,13 @@ func Run(flags *Flags, opts ...Option) {
 	if err != nil {
 		log.Fatalf("Failed to create peer context: %s", err)
 	}
+	pctx.Hostname = hostname
+	pctx.Rack = flags.Rack
+	pctx.DC = flags.DC
+	pctx.Networks, err = core.ParseNetworks(flags.PeerNetworks)
+	if err != nil {
+		log.Fatalf("Invalid peer networks: %s", err)
+	}
 
 	backendManager, err := backend.NewManager(config.Backends, config.Auth)
 	if err != nil {
@@ -235,11 +273,23 @@ func Run(flags *Flags, opts ...Option) {
 
 	healthCheckFilter := healthcheck.NewFilter(config.HealthCheck, healthcheck.Default(tls))
 
-	hashRing := hashring.New(
-		config.HashRing,
-		cluster,
-		healthCheckFilter,
-		hashring.WithWatcher(backend.NewBandwidthWatcher(backendManager)))
+	ringOpts := []hashring.Option{
+		hashring.WithWatcher(backend.NewBandwidthWatcher(backendManager)),
+	}
+	var serverOpts []blobserver.Option
+	if metricsHandler != nil {
+		serverOpts = append(serverOpts, blobserver.WithMetricsHandler(metricsHandler))
+	}
+	if !config.Topology.Empty() {
+		topo, err := topology.New(config.Topology, clock.New())
+		if err != nil {
+			log.Fatalf("Error loading topology: %s", err)
+		}
+		ringOpts = append(ringOpts, hashring.WithFailureDomains(topo.FailureDomain))
+		serverOpts = append(serverOpts, blobserver.WithFailureDomains(topo.FailureDomain))
+	}
+
+	hashRing := hashring.New(config.HashRing, cluster, healthCheckFilter, ringOpts...)
 	go hashRing.Monitor(nil)
 
 	addr := fmt.Sprintf("%s:%d", hostname, flags.BlobServerPort)
@@ -258,6 +308,16 @@ func Run(flags *Flags, opts ...Option) {
 		}
 	}
 
+	remoteProxies, err := config.RemoteProxies.Build()
+	if err != nil {
+		log.Fatalf("Error building remote proxies: %s", err)
+	}
+
+	if config.SwarmRepair.Enabled {
+		serverOpts = append(serverOpts, blobserver.WithSwarmDownloader(
+			newSwarmDownloader(config, flags, stats, netevents, tls)))
+	}
+
 	server, err := blobserver.New(
 		config.BlobServer,
 		stats,
@@ -266,12 +326,13 @@ func Run(flags *Flags, opts ...Option) {
 		hashRing,
 		cas,
 		blobclient.NewProvider(blobclient.WithTLS(tls)),
-		blobclient.NewClusterProvider(blobclient.WithTLS(tls)),
+		blobclient.NewRemoteClusterProvider(remoteProxies, blobclient.WithTLS(tls)),
 		pctx,
 		backendManager,
 		blobRefresher,
 		metaInfoGenerator,
-		writeBackManager)
+		writeBackManager,
+		serverOpts...)
 	if err != nil {
 		log.Fatalf("Error initializing blob server: %s", err)
 	}
@@ -280,6 +341,14 @@ func Run(flags *Flags, opts ...Option) {
 
 	go func() { log.Fatal(server.ListenAndServe(h)) }()
 
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+		<-sigs
+		server.Stop()
+		os.Exit(0)
+	}()
+
 	log.Info("Starting nginx...")
 	log.Fatal(nginx.Run(
 		config.Nginx,
@@ -17,6 +17,7 @@ import (
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
@@ -25,10 +26,13 @@ import (
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/lib/watchdog"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/origin/blobserver"
+	"github.com/uber/kraken/tracker/topology"
 	"github.com/uber/kraken/utils/httputil"
 
 	"go.uber.org/zap"
@@ -56,4 +60,23 @@ type Config struct {
 	WriteBack     persistedretry.Config    `yaml:"writeback"`
 	Nginx         nginx.Config             `yaml:"nginx"`
 	TLS           httputil.TLSConfig       `yaml:"tls"`
+	SwarmRepair   SwarmRepairConfig        `yaml:"swarm_repair"`
+	RemoteProxies httputil.ProxiesConfig   `yaml:"remote_proxies"`
+	Watchdog      watchdog.Config          `yaml:"watchdog"`
+	Debug         debugserver.Config       `yaml:"debug"`
+
+	// Topology locates origins within racks, such that the replicas of each
+	// blob are placed across racks.
+	Topology topology.Config `yaml:"topology"`
+}
+
+// SwarmRepairConfig defines configuration for repairing corrupt blobs from the
+// p2p swarm. Repairs are downloaded by a separate agent scheduler, which
+// announces to Tracker and listens on PeerPort.
+type SwarmRepairConfig struct {
+	Enabled   bool                           `yaml:"enabled"`
+	PeerPort  int                            `yaml:"peer_port"`
+	Tracker   upstream.PassiveHashRingConfig `yaml:"tracker"`
+	Scheduler scheduler.Config               `yaml:"scheduler"`
+	Store     store.CADownloadStoreConfig    `yaml:"store"`
 }
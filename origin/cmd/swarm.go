@@ -0,0 +1,100 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// swarmDownloader implements blobserver.SwarmDownloader by downloading blobs
+// through an agent scheduler.
+type swarmDownloader struct {
+	sched scheduler.Scheduler
+	cads  *store.CADownloadStore
+}
+
+// newSwarmDownloader creates an agent scheduler which downloads corrupt blobs
+// from the swarm on behalf of the origin.
+func newSwarmDownloader(
+	config Config,
+	flags *Flags,
+	stats tally.Scope,
+	netevents networkevent.Producer,
+	tls *tls.Config) *swarmDownloader {
+
+	if config.SwarmRepair.PeerPort == 0 {
+		log.Fatal("Swarm repair requires non-zero peer port")
+	}
+	stats = stats.SubScope("swarm_repair")
+
+	pctx, err := core.NewPeerContext(
+		config.PeerIDFactory,
+		flags.Zone,
+		flags.KrakenCluster,
+		flags.PeerIP,
+		config.SwarmRepair.PeerPort,
+		false)
+	if err != nil {
+		log.Fatalf("Failed to create swarm repair peer context: %s", err)
+	}
+	cads, err := store.NewCADownloadStore(config.SwarmRepair.Store, stats)
+	if err != nil {
+		log.Fatalf("Failed to create swarm repair store: %s", err)
+	}
+	trackers, err := config.SwarmRepair.Tracker.Build()
+	if err != nil {
+		log.Fatalf("Error building tracker upstream: %s", err)
+	}
+	go trackers.Monitor(nil)
+
+	sched, err := scheduler.NewAgentScheduler(
+		config.SwarmRepair.Scheduler, stats, pctx, cads, netevents, trackers, tls)
+	if err != nil {
+		log.Fatalf("Error creating swarm repair scheduler: %s", err)
+	}
+	return &swarmDownloader{sched, cads}
+}
+
+func (s *swarmDownloader) Download(namespace string, d core.Digest) (io.ReadCloser, error) {
+	if err := s.sched.Download(namespace, d); err != nil {
+		return nil, fmt.Errorf("scheduler: %s", err)
+	}
+	f, err := s.cads.GetCacheFileReader(d.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("get cache reader: %s", err)
+	}
+	return &swarmBlob{f, s.sched, d}, nil
+}
+
+// swarmBlob stops seeding and removes the downloaded blob once closed.
+type swarmBlob struct {
+	store.FileReader
+	sched scheduler.Scheduler
+	d     core.Digest
+}
+
+func (b *swarmBlob) Close() error {
+	b.FileReader.Close()
+	return b.sched.RemoveTorrent(b.d)
+}
@@ -20,10 +20,12 @@ import (
 	"net/http"
 
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/dockerregistry/transfer"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/lib/watchdog"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/origin/blobclient"
@@ -33,6 +35,7 @@ import (
 	"github.com/uber/kraken/utils/flagutil"
 	"github.com/uber/kraken/utils/log"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
@@ -121,17 +124,38 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	stats := overrides.metrics
+	var metricsHandler http.Handler
 	if stats == nil {
-		s, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+		s, closer, h, err := metrics.NewWithHandler(config.Metrics, flags.KrakenCluster)
 		if err != nil {
 			log.Fatalf("Failed to init metrics: %s", err)
 		}
 		stats = s
+		metricsHandler = h
 		defer closer.Close()
 	}
 
+	if metricsHandler != nil && flags.ServerPort == 0 {
+		// The proxy server is the only listener metrics could be scraped from.
+		log.Fatal("Prometheus metrics without a listen_address require a server port")
+	}
+
 	go metrics.EmitVersion(stats)
 
+	if config.Watchdog.Enabled {
+		w, err := watchdog.New(config.Watchdog, stats)
+		if err != nil {
+			log.Fatalf("Error creating watchdog: %s", err)
+		}
+		go w.Run()
+	}
+
+	if config.Debug.Enabled() {
+		go func() {
+			log.Fatal(debugserver.ListenAndServe(config.Debug, config))
+		}()
+	}
+
 	cas, err := store.NewCAStore(config.CAStore, stats)
 	if err != nil {
 		log.Fatalf("Failed to create store: %s", err)
@@ -157,11 +181,22 @@ func Run(flags *Flags, opts ...Option) {
 
 	tagClient := tagclient.NewClusterClient(buildIndexes, tls)
 
-	transferer := transfer.NewReadWriteTransferer(stats, tagClient, originCluster, cas)
+	var transferer transfer.ImageTransferer = transfer.NewReadWriteTransferer(
+		stats, tagClient, originCluster, cas)
+	if config.TagCache.Enabled {
+		log.Info("Tag cache enabled")
+		tc := transfer.NewTagCachingTransferer(config.TagCache, stats, transferer, clock.New())
+		tc.Subscribe(buildIndexes, tls)
+		transferer = tc
+	}
 
 	// Open preheat function only if server-port was defined.
 	if flags.ServerPort != 0 {
-		server := proxyserver.New(stats, originCluster)
+		var serverOpts []proxyserver.Option
+		if metricsHandler != nil {
+			serverOpts = append(serverOpts, proxyserver.WithMetricsHandler(metricsHandler))
+		}
+		server := proxyserver.New(stats, originCluster, serverOpts...)
 		addr := fmt.Sprintf(":%d", flags.ServerPort)
 		log.Infof("Starting http server on %s", addr)
 		go func() {
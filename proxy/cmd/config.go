@@ -14,9 +14,12 @@
 package cmd
 
 import (
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/dockerregistry"
+	"github.com/uber/kraken/lib/dockerregistry/transfer"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/lib/watchdog"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/proxy/registryoverride"
@@ -36,4 +39,7 @@ type Config struct {
 	RegistryOverride registryoverride.Config `yaml:"registryoverride"`
 	Nginx            nginx.Config            `yaml:"nginx"`
 	TLS              httputil.TLSConfig      `yaml:"tls"`
+	TagCache         transfer.TagCacheConfig `yaml:"tag_cache"`
+	Watchdog         watchdog.Config         `yaml:"watchdog"`
+	Debug            debugserver.Config      `yaml:"debug"`
 }
@@ -29,16 +29,32 @@ import (
 type Server struct {
 	stats          tally.Scope
 	preheatHandler *PreheatHandler
+	metrics        http.Handler // Nil if metrics are not scraped from s.
+}
+
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithMetricsHandler configures the Server to serve metrics at /metrics using
+// h.
+func WithMetricsHandler(h http.Handler) Option {
+	return func(s *Server) { s.metrics = h }
 }
 
 // New creates a new Server.
 func New(
 	stats tally.Scope,
-	client blobclient.ClusterClient) *Server {
+	client blobclient.ClusterClient,
+	opts ...Option) *Server {
 
-	return &Server{
-		stats.Tagged(map[string]string{"module": "proxyserver"}),
-		NewPreheatHandler(client)}
+	s := &Server{
+		stats:          stats.Tagged(map[string]string{"module": "proxyserver"}),
+		preheatHandler: NewPreheatHandler(client),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Handler returns the HTTP handler.
@@ -49,6 +65,9 @@ func (s *Server) Handler() http.Handler {
 	r.Use(middleware.LatencyTimer(s.stats))
 
 	r.Get("/health", handler.Wrap(s.healthHandler))
+	if s.metrics != nil {
+		r.Handle("/metrics", s.metrics)
+	}
 
 	r.Post("/registry/notifications", handler.Wrap(s.preheatHandler.Handle))
 
@@ -48,6 +48,25 @@ func TestHealth(t *testing.T) {
 	require.Equal("OK\n", string(b))
 }
 
+func TestMetricsHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "some_metric 1")
+	})
+	addr := mocks.startServer(WithMetricsHandler(metrics))
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/metrics", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal("some_metric 1", string(b))
+}
+
 func TestPreheatInvalidEventBody(t *testing.T) {
 	require := require.New(t)
 
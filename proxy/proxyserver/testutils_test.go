@@ -43,8 +43,8 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 	}, cleanup.Run
 }
 
-func (m *serverMocks) startServer() string {
-	s := New(tally.NoopScope, m.originClient)
+func (m *serverMocks) startServer(opts ...Option) string {
+	s := New(tally.NoopScope, m.originClient, opts...)
 	addr, stop := testutil.StartServer(s.Handler())
 	m.cleanup.Add(stop)
 	return addr
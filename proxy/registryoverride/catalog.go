@@ -0,0 +1,95 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registryoverride
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/stringset"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// repoCatalog caches the sorted names of every repository with tags.
+type repoCatalog struct {
+	ttl       time.Duration
+	clk       clock.Clock
+	tagClient tagclient.Client
+
+	mu      sync.Mutex
+	repos   []string
+	updated time.Time
+}
+
+func newRepoCatalog(ttl time.Duration, clk clock.Clock, tagClient tagclient.Client) *repoCatalog {
+	return &repoCatalog{ttl: ttl, clk: clk, tagClient: tagClient}
+}
+
+// list returns the names of all repositories in lexical order. Concurrent
+// callers wait for a single refresh. If a refresh fails, the previous catalog
+// is served until the next refresh.
+func (c *repoCatalog) list() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clk.Now()
+	if c.repos != nil && now.Sub(c.updated) < c.ttl {
+		return c.repos, nil
+	}
+	tags, err := c.tagClient.List("")
+	if err != nil {
+		if c.repos != nil {
+			log.Errorf("Error refreshing catalog, serving stale catalog: %s", err)
+			c.updated = now
+			return c.repos, nil
+		}
+		return nil, fmt.Errorf("list tags: %s", err)
+	}
+	repos := stringset.New()
+	for _, tag := range tags {
+		parts := strings.Split(tag, ":")
+		if len(parts) != 2 {
+			log.With("tag", tag).Errorf("Invalid tag format, expected repo:tag")
+			continue
+		}
+		repos.Add(parts[0])
+	}
+	c.repos = repos.ToSlice()
+	sort.Strings(c.repos)
+	c.updated = now
+	return c.repos, nil
+}
+
+// page returns up to n repositories which sort after last, and whether more
+// repositories follow.
+func (c *repoCatalog) page(last string, n int) ([]string, bool, error) {
+	repos, err := c.list()
+	if err != nil {
+		return nil, false, err
+	}
+	start := sort.Search(len(repos), func(i int) bool { return repos[i] > last })
+	end := start + n
+	if end > len(repos) {
+		end = len(repos)
+	}
+	// Copied such that callers cannot modify the cached catalog.
+	page := append([]string{}, repos[start:end]...)
+	return page, end < len(repos), nil
+}
@@ -13,9 +13,48 @@
 // limitations under the License.
 package registryoverride
 
-import "github.com/uber/kraken/utils/listener"
+import (
+	"time"
+
+	"github.com/uber/kraken/utils/listener"
+)
 
 // Config defines Server configuration.
 type Config struct {
 	Listener listener.Config `yaml:"listener"`
+
+	Catalog CatalogConfig `yaml:"catalog"`
+}
+
+func (c Config) applyDefaults() Config {
+	c.Catalog = c.Catalog.applyDefaults()
+	return c
+}
+
+// CatalogConfig defines configuration of the repository catalog served by
+// GET /v2/_catalog.
+type CatalogConfig struct {
+	// TTL is how long the catalog is cached. The catalog is derived by listing
+	// every tag in build-index, so refreshing it is expensive.
+	TTL time.Duration `yaml:"ttl"`
+
+	// DefaultPageSize is the number of repositories returned per page if the
+	// client does not specify one.
+	DefaultPageSize int `yaml:"default_page_size"`
+
+	// MaxPageSize caps the number of repositories returned per page.
+	MaxPageSize int `yaml:"max_page_size"`
+}
+
+func (c CatalogConfig) applyDefaults() CatalogConfig {
+	if c.TTL == 0 {
+		c.TTL = time.Minute
+	}
+	if c.DefaultPageSize == 0 {
+		c.DefaultPageSize = 100
+	}
+	if c.MaxPageSize == 0 {
+		c.MaxPageSize = 1000
+	}
+	return c
 }
@@ -16,29 +16,33 @@ package registryoverride
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/pressly/chi"
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/listener"
 	"github.com/uber/kraken/utils/log"
-	"github.com/uber/kraken/utils/stringset"
 )
 
 // Server overrides Docker registry endpoints.
 type Server struct {
 	config    Config
 	tagClient tagclient.Client
+	catalog   *repoCatalog
 }
 
 // NewServer creates a new Server.
 func NewServer(config Config, tagClient tagclient.Client) *Server {
-	return &Server{config, tagClient}
+	config = config.applyDefaults()
+	return &Server{
+		config:    config,
+		tagClient: tagClient,
+		catalog:   newRepoCatalog(config.Catalog.TTL, clock.New(), tagClient),
+	}
 }
 
 // Handler returns a handler for s.
@@ -58,82 +62,53 @@ type catalogResponse struct {
 	Repositories []string `json:"repositories"`
 }
 
-// catalogHandler handles catalog request.
-// https://docs.docker.com/registry/spec/api/#pagination for more reference.
+// catalogHandler lists repositories in lexical order, paginated as specified
+// by https://docs.docker.com/registry/spec/api/#pagination: n is the maximum
+// number of repositories returned, and last is the last repository of the
+// previous page. A Link header points at the next page, if any.
 func (s *Server) catalogHandler(w http.ResponseWriter, r *http.Request) error {
-	limitQ := "n"
-	offsetQ := "last"
-
-	// Build request for ListWithPagination.
-	var filter tagclient.ListFilter
-	u := r.URL
-	q := u.Query()
+	q := r.URL.Query()
+	n := s.config.Catalog.DefaultPageSize
+	var last string
 	for k, v := range q {
 		if len(v) != 1 {
 			return handler.Errorf(
 				"invalid query %s:%s", k, v).Status(http.StatusBadRequest)
 		}
 		switch k {
-		case limitQ:
-			limitCount, err := strconv.Atoi(v[0])
-			if err != nil {
-				return handler.Errorf(
-					"invalid limit %s: %s", v, err).Status(http.StatusBadRequest)
-			}
-			if limitCount == 0 {
-				return handler.Errorf(
-					"invalid limit %d", limitCount).Status(http.StatusBadRequest)
+		case "n":
+			limit, err := strconv.Atoi(v[0])
+			if err != nil || limit <= 0 {
+				return handler.Errorf("invalid n %s", v[0]).Status(http.StatusBadRequest)
 			}
-			filter.Limit = limitCount
-		case offsetQ:
-			filter.Offset = v[0]
+			n = limit
+		case "last":
+			last = v[0]
 		default:
 			return handler.Errorf("invalid query %s", k).Status(http.StatusBadRequest)
 		}
 	}
-
-	// List with pagination.
-	listResp, err := s.tagClient.ListWithPagination("", filter)
-	if err != nil {
-		return handler.Errorf("list: %s", err)
-	}
-	repos := stringset.New()
-	for _, tag := range listResp.Result {
-		parts := strings.Split(tag, ":")
-		if len(parts) != 2 {
-			log.With("tag", tag).Errorf("Invalid tag format, expected repo:tag")
-			continue
-		}
-		repos.Add(parts[0])
+	if n > s.config.Catalog.MaxPageSize {
+		n = s.config.Catalog.MaxPageSize
 	}
 
-	// Build Link for response.
-	offset, err := listResp.GetOffset()
-	if err != nil && err != io.EOF {
-		return handler.Errorf("invalid offset %s", err)
+	repos, more, err := s.catalog.page(last, n)
+	if err != nil {
+		return handler.Errorf("catalog: %s", err)
 	}
-	if offset != "" {
-		nextUrl, err := url.Parse(u.String())
-		if err != nil {
-			return handler.Errorf(
-				"invalid url string: %s", err).Status(http.StatusBadRequest)
+	if more {
+		next := url.URL{
+			Path: r.URL.Path,
+			RawQuery: url.Values{
+				"n":    {strconv.Itoa(n)},
+				"last": {repos[len(repos)-1]},
+			}.Encode(),
 		}
-		val, err := url.ParseQuery(nextUrl.RawQuery)
-		if err != nil {
-			return handler.Errorf(
-				"invalid url string: %s", err).Status(http.StatusBadRequest)
-		}
-		val.Set(offsetQ, offset)
-		nextUrl.RawQuery = val.Encode()
-
-		// Set header (https://docs.docker.com/registry/spec/api/#pagination),
-		// except the host and scheme.
-		// Link: <<url>?n=2&last=b>; rel="next"
-		w.Header().Set("Link", fmt.Sprintf("%s; rel=\"next\"", nextUrl.String()))
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
 	}
 
-	resp := catalogResponse{Repositories: repos.ToSlice()}
-	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(catalogResponse{Repositories: repos}); err != nil {
 		return handler.Errorf("json encode: %s", err)
 	}
 	return nil
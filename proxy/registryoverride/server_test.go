@@ -0,0 +1,154 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registryoverride
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	mocktagclient "github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func getCatalog(t *testing.T, url string) (*http.Response, catalogResponse) {
+	resp, err := httputil.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var r catalogResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&r))
+	return resp, r
+}
+
+func TestCatalogPagination(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tagClient := mocktagclient.NewMockClient(ctrl)
+
+	tagClient.EXPECT().List("").Return([]string{
+		"c:latest", "a:v1", "b/x:v1", "a:v2", "malformed", "d:v1",
+	}, nil).Times(1)
+
+	s := NewServer(Config{}, tagClient)
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	resp, r := getCatalog(t, fmt.Sprintf("http://%s/v2/_catalog?n=2", addr))
+	require.Equal([]string{"a", "b/x"}, r.Repositories)
+	require.Equal(`</v2/_catalog?last=b%2Fx&n=2>; rel="next"`, resp.Header.Get("Link"))
+
+	resp, r = getCatalog(t, fmt.Sprintf("http://%s/v2/_catalog?last=b%%2Fx&n=2", addr))
+	require.Equal([]string{"c", "d"}, r.Repositories)
+	require.Empty(resp.Header.Get("Link"))
+
+	resp, r = getCatalog(t, fmt.Sprintf("http://%s/v2/_catalog?last=d", addr))
+	require.Equal([]string{}, r.Repositories)
+	require.Empty(resp.Header.Get("Link"))
+}
+
+func TestCatalogInvalidQuery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s := NewServer(Config{}, mocktagclient.NewMockClient(ctrl))
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	for _, q := range []string{"n=0", "n=-1", "n=abc", "foo=bar", "n=1&n=2"} {
+		t.Run(q, func(t *testing.T) {
+			_, err := httputil.Get(fmt.Sprintf("http://%s/v2/_catalog?%s", addr, q))
+			require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
+
+func TestCatalogMaxPageSize(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tagClient := mocktagclient.NewMockClient(ctrl)
+
+	tagClient.EXPECT().List("").Return([]string{"a:1", "b:1", "c:1"}, nil)
+
+	s := NewServer(Config{Catalog: CatalogConfig{MaxPageSize: 2}}, tagClient)
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	resp, r := getCatalog(t, fmt.Sprintf("http://%s/v2/_catalog?n=50", addr))
+	require.Equal([]string{"a", "b"}, r.Repositories)
+	require.Equal(`</v2/_catalog?last=b&n=2>; rel="next"`, resp.Header.Get("Link"))
+}
+
+func TestRepoCatalogRefresh(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tagClient := mocktagclient.NewMockClient(ctrl)
+	clk := clock.NewMock()
+
+	c := newRepoCatalog(time.Minute, clk, tagClient)
+
+	tagClient.EXPECT().List("").Return([]string{"a:1"}, nil)
+	repos, err := c.list()
+	require.NoError(err)
+	require.Equal([]string{"a"}, repos)
+
+	// Cached.
+	clk.Add(30 * time.Second)
+	repos, err = c.list()
+	require.NoError(err)
+	require.Equal([]string{"a"}, repos)
+
+	clk.Add(time.Minute)
+	tagClient.EXPECT().List("").Return([]string{"a:1", "b:1"}, nil)
+	repos, err = c.list()
+	require.NoError(err)
+	require.Equal([]string{"a", "b"}, repos)
+
+	// Stale catalog is served on error.
+	clk.Add(time.Minute)
+	tagClient.EXPECT().List("").Return(nil, errors.New("some error"))
+	repos, err = c.list()
+	require.NoError(err)
+	require.Equal([]string{"a", "b"}, repos)
+}
+
+func TestRepoCatalogError(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tagClient := mocktagclient.NewMockClient(ctrl)
+
+	c := newRepoCatalog(time.Minute, clock.NewMock(), tagClient)
+
+	tagClient.EXPECT().List("").Return(nil, errors.New("some error"))
+	_, err := c.list()
+	require.Error(err)
+}
@@ -0,0 +1,427 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cluster boots a tracker, origins and agents within a single process,
+// such that end-to-end distribution can be tested without containers. All
+// components talk over real loopback networking, and all storage lives in
+// temporary directories which are removed on Close.
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uber/kraken/agent/agentclient"
+	"github.com/uber/kraken/agent/agentserver"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/lib/backend/testfs"
+	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/metainfogen"
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/writeback"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/torrent/scheduler/conn"
+	"github.com/uber/kraken/localdb"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/origin/blobserver"
+	"github.com/uber/kraken/tracker/originstore"
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/tracker/trackerserver"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// Config defines Cluster configuration.
+type Config struct {
+	// NumOrigins is the number of origins in the origin cluster.
+	NumOrigins int
+
+	// NumAgents is the number of agents.
+	NumAgents int
+
+	// MaxReplica is the number of origins each blob is replicated to.
+	MaxReplica int
+
+	// PieceLength is the piece length of all torrents. Small piece lengths
+	// spread small blobs over many pieces, such that agents exchange pieces
+	// amongst themselves.
+	PieceLength int
+
+	// AnnounceInterval is the interval at which agents announce to the tracker.
+	AnnounceInterval time.Duration
+}
+
+func (c *Config) applyDefaults() {
+	if c.NumOrigins == 0 {
+		c.NumOrigins = 1
+	}
+	if c.NumAgents == 0 {
+		c.NumAgents = 3
+	}
+	if c.MaxReplica == 0 {
+		c.MaxReplica = c.NumOrigins
+	}
+	if c.PieceLength == 0 {
+		c.PieceLength = 4
+	}
+	if c.AnnounceInterval == 0 {
+		c.AnnounceInterval = 250 * time.Millisecond
+	}
+}
+
+// Link is a directed link between two nodes of a Cluster, identified by name.
+type Link struct {
+	Source string
+	Dest   string
+}
+
+func (l Link) String() string {
+	return fmt.Sprintf("%s->%s", l.Source, l.Dest)
+}
+
+// Origin is an origin running within a Cluster.
+type Origin struct {
+	Name string
+	Addr string
+	PCtx core.PeerContext
+	CAS  *store.CAStore
+}
+
+// Agent is an agent running within a Cluster.
+type Agent struct {
+	Name string
+	Addr string
+	PCtx core.PeerContext
+	CADS *store.CADownloadStore
+}
+
+// Cluster is a tracker, origin cluster and set of agents running in-process.
+type Cluster struct {
+	config      Config
+	trackerAddr string
+	origins     []*Origin
+	agents      []*Agent
+	cluster     blobclient.ClusterClient
+	netevents   *networkevent.TestProducer
+	names       map[string]string
+	cleanup     testutil.Cleanup
+}
+
+// New boots a new Cluster. Callers must call Close once done with the Cluster.
+func New(config Config) (c *Cluster, err error) {
+	config.applyDefaults()
+
+	c = &Cluster{
+		config:    config,
+		netevents: networkevent.NewTestProducer(),
+		names:     make(map[string]string),
+	}
+	defer func() {
+		if err != nil {
+			c.Close()
+		}
+	}()
+
+	// All origins share the same storage backend, which stands in for the
+	// remote storage of a production cluster.
+	fs := testfs.NewServer()
+	c.cleanup.Add(fs.Cleanup)
+	fsAddr, stop := testutil.StartServer(fs.Handler())
+	c.cleanup.Add(stop)
+
+	// Origins must know the full hash ring before any of them start, so
+	// listeners are bound upfront.
+	var listeners []net.Listener
+	var originAddrs []string
+	for i := 0; i < config.NumOrigins; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("listen: %s", err)
+		}
+		c.cleanup.Add(func() { l.Close() })
+		listeners = append(listeners, l)
+		originAddrs = append(originAddrs, l.Addr().String())
+	}
+	origins := hostlist.Fixture(originAddrs...)
+	c.cluster = blobclient.NewClusterClient(
+		blobclient.NewClientResolver(blobclient.NewProvider(), origins))
+
+	for i, l := range listeners {
+		o, err := c.startOrigin(i, l, origins, fsAddr)
+		if err != nil {
+			return nil, fmt.Errorf("start origin %d: %s", i, err)
+		}
+		c.origins = append(c.origins, o)
+	}
+
+	c.trackerAddr = c.startTracker(origins)
+
+	for i := 0; i < config.NumAgents; i++ {
+		a, err := c.startAgent(i)
+		if err != nil {
+			return nil, fmt.Errorf("start agent %d: %s", i, err)
+		}
+		c.agents = append(c.agents, a)
+	}
+
+	return c, nil
+}
+
+// Close stops all components of c and removes their storage.
+func (c *Cluster) Close() {
+	c.cleanup.Run()
+}
+
+// TrackerAddr returns the address of the tracker.
+func (c *Cluster) TrackerAddr() string {
+	return c.trackerAddr
+}
+
+// Origins returns the origins of c.
+func (c *Cluster) Origins() []*Origin {
+	return c.origins
+}
+
+// Agents returns the agents of c.
+func (c *Cluster) Agents() []*Agent {
+	return c.agents
+}
+
+// Push uploads blob to the origin cluster under namespace.
+func (c *Cluster) Push(namespace string, blob []byte) (core.Digest, error) {
+	d, err := core.NewDigester().FromBytes(blob)
+	if err != nil {
+		return core.Digest{}, fmt.Errorf("digest: %s", err)
+	}
+	if err := c.cluster.UploadBlob(namespace, d, bytes.NewReader(blob)); err != nil {
+		return core.Digest{}, fmt.Errorf("upload blob: %s", err)
+	}
+	return d, nil
+}
+
+// Pull downloads d through agent i, returning the blob content.
+func (c *Cluster) Pull(i int, namespace string, d core.Digest) ([]byte, error) {
+	r, err := agentclient.New(c.agents[i].Addr).Download(namespace, d)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// BytesTransferred returns the number of bytes of d received over each link
+// of c so far, keyed by the names of the sending and receiving nodes.
+func (c *Cluster) BytesTransferred(namespace string, d core.Digest) (map[Link]int64, error) {
+	mi, err := c.cluster.GetMetaInfo(namespace, d)
+	if err != nil {
+		return nil, fmt.Errorf("get metainfo: %s", err)
+	}
+	h := mi.InfoHash().String()
+
+	result := make(map[Link]int64)
+	for _, e := range c.netevents.Events() {
+		if e.Name != networkevent.ReceivePiece || e.Torrent != h {
+			continue
+		}
+		l := Link{Source: c.name(e.Peer), Dest: c.name(e.Self)}
+		result[l] += mi.GetPieceLength(e.Piece)
+	}
+	return result, nil
+}
+
+func (c *Cluster) name(peerID string) string {
+	if name, ok := c.names[peerID]; ok {
+		return name
+	}
+	return peerID
+}
+
+func (c *Cluster) register(name string, pctx core.PeerContext) {
+	c.names[pctx.PeerID.String()] = name
+}
+
+func (c *Cluster) schedulerConfig() scheduler.Config {
+	return scheduler.Config{
+		SeederTTI:          time.Minute,
+		LeecherTTI:         time.Minute,
+		PreemptionInterval: 500 * time.Millisecond,
+		ConnTTI:            10 * time.Second,
+		ConnTTL:            5 * time.Minute,
+		Conn:               conn.ConfigFixture(),
+		TorrentLog:         log.Config{Disable: true},
+	}
+}
+
+func (c *Cluster) startOrigin(
+	i int, l net.Listener, origins hostlist.List, fsAddr string) (*Origin, error) {
+
+	name := fmt.Sprintf("origin-%d", i)
+	addr := l.Addr().String()
+
+	pctx, err := peerContext(true)
+	if err != nil {
+		return nil, err
+	}
+	c.register(name, pctx)
+
+	cas, cleanup := store.CAStoreFixture()
+	c.cleanup.Add(cleanup)
+
+	backendClient, err := testfs.NewClient(testfs.Config{
+		Addr:     fsAddr,
+		Root:     "root",
+		NamePath: namepath.Identity,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("testfs client: %s", err)
+	}
+	backends := backend.ManagerFixture()
+	if err := backends.Register(".*", backendClient); err != nil {
+		return nil, fmt.Errorf("register backend: %s", err)
+	}
+
+	db, cleanup := localdb.Fixture()
+	c.cleanup.Add(cleanup)
+
+	writeBackManager, err := persistedretry.NewManager(
+		persistedretry.Config{},
+		tally.NoopScope,
+		writeback.NewStore(db),
+		writeback.NewExecutor(tally.NoopScope, cas, backends))
+	if err != nil {
+		return nil, fmt.Errorf("new write-back manager: %s", err)
+	}
+	c.cleanup.Add(writeBackManager.Close)
+
+	mg := metainfogen.Fixture(cas, c.config.PieceLength)
+	br := blobrefresh.New(blobrefresh.Config{}, tally.NoopScope, cas, backends, mg)
+
+	sched, err := scheduler.NewOriginScheduler(
+		c.schedulerConfig(), tally.NoopScope, pctx, cas, c.netevents, br)
+	if err != nil {
+		return nil, fmt.Errorf("new scheduler: %s", err)
+	}
+	c.cleanup.Add(sched.Stop)
+
+	ring := hashring.New(
+		hashring.Config{MaxReplica: c.config.MaxReplica},
+		origins,
+		healthcheck.IdentityFilter{})
+
+	server, err := blobserver.New(
+		blobserver.Config{},
+		tally.NoopScope,
+		clock.New(),
+		addr,
+		ring,
+		cas,
+		blobclient.NewProvider(),
+		blobclient.NewClusterProvider(),
+		pctx,
+		backends,
+		br,
+		mg,
+		writeBackManager)
+	if err != nil {
+		return nil, fmt.Errorf("new blobserver: %s", err)
+	}
+	s := &http.Server{Handler: server.Handler()}
+	go s.Serve(l)
+	c.cleanup.Add(func() { s.Close() })
+
+	return &Origin{Name: name, Addr: addr, PCtx: pctx, CAS: cas}, nil
+}
+
+func (c *Cluster) startTracker(origins hostlist.List) string {
+	server, err := trackerserver.New(
+		trackerserver.Config{AnnounceInterval: c.config.AnnounceInterval},
+		tally.NoopScope,
+		peerhandoutpolicy.DefaultPriorityPolicyFixture(),
+		nil,
+		peerstore.NewLocalStore(peerstore.LocalConfig{}, clock.New()),
+		originstore.New(originstore.Config{}, clock.New(), origins, blobclient.NewProvider()),
+		c.cluster)
+	if err != nil {
+		panic(err)
+	}
+	addr, stop := testutil.StartServer(server.Handler())
+	c.cleanup.Add(stop)
+	return addr
+}
+
+func (c *Cluster) startAgent(i int) (*Agent, error) {
+	name := fmt.Sprintf("agent-%d", i)
+
+	pctx, err := peerContext(false)
+	if err != nil {
+		return nil, err
+	}
+	c.register(name, pctx)
+
+	cads, cleanup := store.CADownloadStoreFixture()
+	c.cleanup.Add(cleanup)
+
+	sched, err := scheduler.NewAgentScheduler(
+		c.schedulerConfig(),
+		tally.NoopScope,
+		pctx,
+		cads,
+		c.netevents,
+		hashring.NoopPassiveRing(hostlist.Fixture(c.trackerAddr)),
+		nil)
+	if err != nil {
+		return nil, fmt.Errorf("new scheduler: %s", err)
+	}
+	c.cleanup.Add(sched.Stop)
+
+	server := agentserver.New(agentserver.Config{}, tally.NoopScope, cads, sched, nil, nil)
+	addr, stop := testutil.StartServer(server.Handler())
+	c.cleanup.Add(stop)
+
+	return &Agent{Name: name, Addr: addr, PCtx: pctx, CADS: cads}, nil
+}
+
+// peerContext returns a loopback peer context on a free port.
+func peerContext(origin bool) (core.PeerContext, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return core.PeerContext{}, fmt.Errorf("listen: %s", err)
+	}
+	defer l.Close()
+	_, portStr, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		return core.PeerContext{}, fmt.Errorf("split host port: %s", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return core.PeerContext{}, fmt.Errorf("parse port: %s", err)
+	}
+	return core.NewPeerContext(core.RandomPeerIDFactory, "zone1", "test", "127.0.0.1", port, origin)
+}
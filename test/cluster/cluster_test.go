@@ -0,0 +1,100 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cluster
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const namespace = "test/namespace"
+
+func init() {
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.OutputPaths = []string{}
+	log.ConfigureLogger(zapConfig)
+}
+
+func TestClusterDistributesBlobToAllAgents(t *testing.T) {
+	require := require.New(t)
+
+	c, err := New(Config{NumOrigins: 2, NumAgents: 4})
+	require.NoError(err)
+	defer c.Close()
+
+	blob := randutil.Text(256)
+
+	d, err := c.Push(namespace, blob)
+	require.NoError(err)
+
+	results := make([][]byte, len(c.Agents()))
+	errs := make([]error, len(c.Agents()))
+	var wg sync.WaitGroup
+	for i := range c.Agents() {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = c.Pull(i, namespace, d)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range c.Agents() {
+		require.NoError(errs[i])
+		require.Equal(string(blob), string(results[i]))
+	}
+
+	links, err := c.BytesTransferred(namespace, d)
+	require.NoError(err)
+
+	received := make(map[string]int64)
+	for l, n := range links {
+		require.True(strings.HasPrefix(l.Dest, "agent-"), "unexpected link %s", l)
+		received[l.Dest] += n
+	}
+	require.Len(received, len(c.Agents()))
+	for _, a := range c.Agents() {
+		require.Equal(int64(len(blob)), received[a.Name], a.Name)
+	}
+}
+
+func TestClusterSingleAgentPullsFromOrigins(t *testing.T) {
+	require := require.New(t)
+
+	c, err := New(Config{NumOrigins: 1, NumAgents: 1})
+	require.NoError(err)
+	defer c.Close()
+
+	blob := randutil.Text(64)
+
+	d, err := c.Push(namespace, blob)
+	require.NoError(err)
+
+	result, err := c.Pull(0, namespace, d)
+	require.NoError(err)
+	require.Equal(string(blob), string(result))
+
+	links, err := c.BytesTransferred(namespace, d)
+	require.NoError(err)
+	require.Equal(map[Link]int64{
+		{Source: "origin-0", Dest: "agent-0"}: int64(len(blob)),
+	}, links)
+}
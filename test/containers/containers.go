@@ -0,0 +1,191 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package containers runs throwaway docker containers of services which cannot
+// be faked in-process, e.g. Redis or S3, for acceptance tests. Tests which use
+// containers are gated behind the "acceptance" build tag, and require a local
+// docker daemon.
+package containers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Config defines Container configuration.
+type Config struct {
+	Image string
+
+	// Port is the container port which is published on loopback.
+	Port int
+
+	Env map[string]string
+
+	// Entrypoint and Cmd optionally override those of Image.
+	Entrypoint string
+	Cmd        []string
+
+	// Ready returns nil once the service listening on addr can serve requests.
+	Ready func(addr string) error
+
+	// Timeout bounds how long Start waits for the container to become ready.
+	Timeout time.Duration
+}
+
+func (c *Config) applyDefaults() {
+	if c.Ready == nil {
+		c.Ready = func(string) error { return nil }
+	}
+	if c.Timeout == 0 {
+		c.Timeout = time.Minute
+	}
+}
+
+// Container is a running docker container.
+type Container struct {
+	id   string
+	addr string
+}
+
+// Start runs a new container and blocks until it is ready.
+func Start(config Config) (*Container, error) {
+	config.applyDefaults()
+
+	if config.Image == "" {
+		return nil, errors.New("no image configured")
+	}
+	if config.Port == 0 {
+		return nil, errors.New("no port configured")
+	}
+
+	args := []string{"run", "-d", "-p", fmt.Sprintf("127.0.0.1::%d", config.Port)}
+	for k, v := range config.Env {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
+	}
+	if config.Entrypoint != "" {
+		args = append(args, "--entrypoint", config.Entrypoint)
+	}
+	args = append(args, config.Image)
+	args = append(args, config.Cmd...)
+
+	id, err := docker(args...)
+	if err != nil {
+		return nil, fmt.Errorf("run: %s", err)
+	}
+	c := &Container{id: id}
+
+	addr, err := docker("port", id, strconv.Itoa(config.Port))
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("port: %s", err)
+	}
+	// Daemons which publish on both address families print one line each.
+	c.addr = strings.SplitN(addr, "\n", 2)[0]
+
+	deadline := time.Now().Add(config.Timeout)
+	for {
+		err := config.Ready(c.addr)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			logs, _ := docker("logs", id)
+			c.Close()
+			return nil, fmt.Errorf("%s not ready after %s: %s\n%s", config.Image, config.Timeout, err, logs)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return c, nil
+}
+
+// Addr returns the loopback address the container port is published on.
+func (c *Container) Addr() string {
+	return c.addr
+}
+
+// Close removes the container.
+func (c *Container) Close() {
+	docker("rm", "-f", "-v", c.id)
+}
+
+// StartRedis runs a new Redis container.
+func StartRedis() (*Container, error) {
+	return Start(Config{
+		Image: "redis:5.0",
+		Port:  6379,
+		Ready: func(addr string) error {
+			conn, err := redis.Dial("tcp", addr)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			_, err = conn.Do("PING")
+			return err
+		},
+	})
+}
+
+// Minio credentials and bucket created by StartMinio.
+const (
+	MinioAccessKey = "kraken-access-key"
+	MinioSecretKey = "kraken-secret-key"
+	MinioBucket    = "kraken"
+)
+
+// StartMinio runs a new S3-compatible minio container with MinioBucket
+// already created.
+func StartMinio() (*Container, error) {
+	return Start(Config{
+		Image:      "minio/minio:RELEASE.2019-10-12T01-39-57Z",
+		Port:       9000,
+		Entrypoint: "sh",
+		Cmd: []string{
+			"-c", fmt.Sprintf("mkdir -p /data/%s && minio server /data", MinioBucket),
+		},
+		Env: map[string]string{
+			"MINIO_ACCESS_KEY": MinioAccessKey,
+			"MINIO_SECRET_KEY": MinioSecretKey,
+		},
+		Ready: func(addr string) error {
+			resp, err := http.Get(fmt.Sprintf("http://%s/minio/health/ready", addr))
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("status %d", resp.StatusCode)
+			}
+			return nil
+		},
+	})
+}
+
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
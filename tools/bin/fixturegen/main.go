@@ -0,0 +1,105 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/tracker/peerstore/peergen"
+	"github.com/uber/kraken/utils/configutil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// writeTorrents writes the namespace, digest, infohash and swarm size of each
+// torrent to path, one per line.
+func writeTorrents(path string, torrents []peergen.Torrent) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, t := range torrents {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", t.Namespace, t.Digest, t.InfoHash.Hex(), len(t.Peers))
+	}
+	return w.Flush()
+}
+
+// kraken-fixturegen populates the peer store of a tracker config with
+// synthetic swarms, for load tests and validating store queries against
+// realistic data.
+func main() {
+	configFile := flag.String("config", "", "tracker configuration file, whose peerstore is populated")
+	torrents := flag.Int("torrents", 1000, "number of torrents")
+	namespaces := flag.Int("namespaces", 10, "number of namespaces torrents are spread across")
+	hosts := flag.Int("hosts", 1000, "number of agent hosts peers are drawn from")
+	maxPeers := flag.Int("max-peers", 500, "max number of agent peers per torrent")
+	skew := flag.Float64("skew", 1.2, "zipf exponent of swarm sizes, must exceed 1")
+	seederRatio := flag.Float64("seeder-ratio", 0.8, "fraction of agent peers which are seeders")
+	origins := flag.Int("origins", 3, "number of origin peers per torrent")
+	seed := flag.Int64("seed", 0, "seed of generated swarms")
+	batchSize := flag.Int("batch-size", 1000, "number of peers written per batch")
+	out := flag.String("out", "", "optional file to write generated torrents to, one per line")
+	flag.Parse()
+
+	if *configFile == "" {
+		log.Fatal("-config required")
+	}
+	var config struct {
+		PeerStore peerstore.Config `yaml:"peerstore"`
+	}
+	if err := configutil.Load(*configFile, &config); err != nil {
+		log.Fatalf("Error loading config: %s", err)
+	}
+
+	generated, err := peergen.Generate(peergen.Config{
+		Torrents:    *torrents,
+		Namespaces:  *namespaces,
+		Hosts:       *hosts,
+		MaxPeers:    *maxPeers,
+		Skew:        *skew,
+		SeederRatio: *seederRatio,
+		Origins:     *origins,
+		Seed:        *seed,
+	})
+	if err != nil {
+		log.Fatalf("Error generating swarms: %s", err)
+	}
+
+	s, err := peerstore.New(config.PeerStore, tally.NoopScope)
+	if err != nil {
+		log.Fatalf("Error creating peer store: %s", err)
+	}
+	defer s.Close()
+
+	start := time.Now()
+	n, err := peergen.Populate(s, generated, *batchSize)
+	if err != nil {
+		log.Fatalf("Error populating peer store after %d peers: %s", n, err)
+	}
+	log.Infof("Wrote %d peers of %d torrents in %s", n, len(generated), time.Since(start))
+
+	if *out != "" {
+		if err := writeTorrents(*out, generated); err != nil {
+			log.Fatalf("Error writing torrents: %s", err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/uber/kraken/lib/auth"
+	"github.com/uber/kraken/tracker/trackerserver"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+func getPolicy(tracker, namespace, token string) (*trackerserver.PolicyResponse, error) {
+	u := url.URL{
+		Scheme:   "http",
+		Host:     tracker,
+		Path:     "/admin/policy",
+		RawQuery: url.Values{"namespace": {namespace}}.Encode(),
+	}
+	resp, err := httputil.Get(
+		u.String(),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendHeaders(auth.BearerHeader(token)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var policy trackerserver.PolicyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return nil, fmt.Errorf("json decode: %s", err)
+	}
+	return &policy, nil
+}
+
+// formatValue renders v compactly on a single line, with map keys sorted.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "{" + formatParams(v) + "}"
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = formatValue(e)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func formatParams(params map[string]interface{}) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + formatValue(params[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+// printPolicy writes policy as a table of stages, in the order they apply.
+func printPolicy(w io.Writer, policy *trackerserver.PolicyResponse) error {
+	fmt.Fprintf(w, "Handout policy of namespace %q:\n\n", policy.Namespace)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSTAGE\tENABLED\tPARAMS")
+	for i, s := range policy.Stages {
+		enabled := "no"
+		if s.Enabled {
+			enabled = "yes"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", i+1, s.Stage, enabled, formatParams(s.Params))
+	}
+	return tw.Flush()
+}
+
+// kraken-handoutpolicy prints the peer handout policy a tracker applies to
+// announces of a namespace, with defaults applied and per-namespace overrides
+// resolved.
+func main() {
+	tracker := flag.String("tracker", "", "tracker address, as host:port")
+	namespace := flag.String("namespace", "", "namespace to resolve the policy of")
+	raw := flag.Bool("json", false, "print the raw json response")
+	token := flag.String(
+		"token", os.Getenv("KRAKEN_TRACKER_TOKEN"),
+		"bearer token granting admin scope, if the tracker requires authentication")
+	flag.Parse()
+
+	if *tracker == "" {
+		log.Fatal("-tracker required")
+	}
+
+	policy, err := getPolicy(*tracker, *namespace, *token)
+	if err != nil {
+		log.Fatalf("Error getting policy: %s", err)
+	}
+	if *raw {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(policy)
+	} else {
+		err = printPolicy(os.Stdout, policy)
+	}
+	if err != nil {
+		log.Fatalf("Error printing policy: %s", err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/osutil"
+)
+
+// readBlobs reads the digests of blobs to pull from path.
+func readBlobs(path string) ([]blob, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	digests, err := osutil.ReadLines(f)
+	if err != nil {
+		return nil, err
+	}
+	return realBlobs(digests)
+}
+
+// kraken-loadgen simulates a deploy wave against a real tracker, in which many
+// agents pull the same images within a short period of time, and reports the
+// latency and error rate of each tracker operation.
+func main() {
+	tracker := flag.String("tracker", "", "tracker address, as host:port")
+	namespace := flag.String("namespace", "loadgen", "namespace blobs are pulled from")
+	agents := flag.Int("agents", 1000, "number of simulated agents")
+	images := flag.Int("images", 1, "number of synthetic images pulled by each agent")
+	layers := flag.Int("layers", 10, "number of layers per synthetic image")
+	digestFile := flag.String(
+		"digests", "", "optional file of blob digests to pull instead of synthetic images, one per line")
+	spread := flag.Duration("spread", time.Minute, "period over which agents join the wave")
+	downloadTime := flag.Duration(
+		"download-time", 5*time.Second, "max simulated time to download each blob")
+	maxInflight := flag.Int("max-inflight", 1000, "max number of agents pulling concurrently")
+	tokenSecret := flag.String("token-secret", "", "optional announce token secret")
+	seed := flag.Int64("seed", 0, "seed of synthetic image digests")
+	flag.Parse()
+
+	if *tracker == "" {
+		log.Fatal("-tracker required")
+	}
+	if *agents <= 0 || *maxInflight <= 0 {
+		log.Fatal("-agents and -max-inflight must be positive")
+	}
+
+	var blobs []blob
+	var err error
+	if *digestFile != "" {
+		blobs, err = readBlobs(*digestFile)
+	} else {
+		blobs, err = syntheticBlobs(*seed, *images, *layers)
+	}
+	if err != nil {
+		log.Fatalf("Error generating blobs: %s", err)
+	}
+	if len(blobs) == 0 {
+		log.Fatal("No blobs to pull")
+	}
+
+	hosts, err := hostlist.New(hostlist.Config{Static: []string{*tracker}})
+	if err != nil {
+		log.Fatalf("Error creating tracker host list: %s", err)
+	}
+	ring := hashring.NoopPassiveRing(hosts)
+
+	w := &wave{
+		config: waveConfig{
+			namespace:    *namespace,
+			agents:       *agents,
+			spread:       *spread,
+			downloadTime: *downloadTime,
+			maxInflight:  *maxInflight,
+			token: announcetoken.Config{
+				Enabled: *tokenSecret != "",
+				Secret:  *tokenSecret,
+			},
+		},
+		ring:     ring,
+		metainfo: metainfoclient.New(ring, nil),
+		blobs:    blobs,
+		recorder: newRecorder(),
+	}
+
+	rand.Seed(time.Now().UnixNano())
+	log.Infof("Simulating %d agents pulling %d blobs over %s", *agents, len(blobs), *spread)
+	start := time.Now()
+	w.run()
+	elapsed := time.Since(start)
+	log.Infof("Wave completed in %s", elapsed)
+
+	w.recorder.report(os.Stdout, elapsed)
+}
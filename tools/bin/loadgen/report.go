@@ -0,0 +1,91 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// recorder collects the latency and outcome of each request, by operation.
+type recorder struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+	}
+}
+
+// time runs f and records its latency and outcome under op.
+func (r *recorder) time(op string, f func() error) error {
+	start := time.Now()
+	err := f()
+	t := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.latencies[op] = append(r.latencies[op], t)
+	if err != nil {
+		r.errors[op]++
+	}
+	return err
+}
+
+// percentile returns the p-th percentile of sorted, which must not be empty.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+// report writes a table of request counts, error rates and latency
+// percentiles per operation to w.
+func (r *recorder) report(w io.Writer, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ops := make([]string, 0, len(r.latencies))
+	for op := range r.latencies {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\trequests\terrors\terror rate\tqps\tp50\tp90\tp99\tmax\t")
+	for _, op := range ops {
+		l := r.latencies[op]
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		n := len(l)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f%%\t%.1f\t%s\t%s\t%s\t%s\t\n",
+			op,
+			n,
+			r.errors[op],
+			100*float64(r.errors[op])/float64(n),
+			float64(n)/elapsed.Seconds(),
+			percentile(l, 0.5).Round(time.Microsecond),
+			percentile(l, 0.9).Round(time.Microsecond),
+			percentile(l, 0.99).Round(time.Microsecond),
+			l[n-1].Round(time.Microsecond))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		desc     string
+		sorted   []time.Duration
+		p        float64
+		expected time.Duration
+	}{
+		{"single", []time.Duration{time.Second}, 0.99, time.Second},
+		{"min", sorted, 0, time.Millisecond},
+		{"p50", sorted, 0.5, 50 * time.Millisecond},
+		{"p90", sorted, 0.9, 90 * time.Millisecond},
+		{"p99", sorted, 0.99, 99 * time.Millisecond},
+		{"max", sorted, 1, 100 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require.Equal(t, test.expected, percentile(test.sorted, test.p))
+		})
+	}
+}
+
+func TestRecorderReport(t *testing.T) {
+	require := require.New(t)
+
+	r := newRecorder()
+	for i := 0; i < 4; i++ {
+		r.time("announce", func() error { return nil })
+	}
+	err := errors.New("some error")
+	require.Equal(err, r.time("announce", func() error { return err }))
+	require.NoError(r.time("metainfo", func() error { return nil }))
+
+	var b bytes.Buffer
+	r.report(&b, time.Second)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(lines, 3)
+	require.Equal(
+		[]string{"op", "requests", "errors", "error", "rate", "qps", "p50", "p90", "p99", "max"},
+		strings.Fields(lines[0]))
+
+	// Operations are sorted, with counts, error rates and qps per op.
+	require.Equal([]string{"announce", "5", "1", "20.00%", "5.0"}, strings.Fields(lines[1])[:5])
+	require.Equal([]string{"metainfo", "1", "0", "0.00%", "1.0"}, strings.Fields(lines[2])[:5])
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/utils/log"
+)
+
+// blob is a single blob pulled by every simulated agent.
+type blob struct {
+	digest   core.Digest
+	infoHash core.InfoHash
+
+	// fetchMetaInfo indicates the blob exists, such that its metainfo can be
+	// fetched from the tracker rather than synthesized.
+	fetchMetaInfo bool
+}
+
+// syntheticBlobs returns the layers of images synthetic images, which do not
+// exist in any origin. Each run with the same seed produces the same blobs.
+func syntheticBlobs(seed int64, images, layers int) ([]blob, error) {
+	var blobs []blob
+	for i := 0; i < images; i++ {
+		for j := 0; j < layers; j++ {
+			raw := fmt.Sprintf("kraken-loadgen-%d-%d-%d", seed, i, j)
+			d, err := core.NewDigester().FromBytes([]byte(raw))
+			if err != nil {
+				return nil, fmt.Errorf("digest: %s", err)
+			}
+			blobs = append(blobs, blob{
+				digest:   d,
+				infoHash: core.NewInfoHashFromBytes([]byte(raw)),
+			})
+		}
+	}
+	return blobs, nil
+}
+
+// realBlobs returns blobs for the given digests, which must exist in the
+// namespace being pulled from.
+func realBlobs(digests []string) ([]blob, error) {
+	var blobs []blob
+	for _, s := range digests {
+		d, err := core.ParseSHA256Digest(s)
+		if err != nil {
+			return nil, fmt.Errorf("parse digest %q: %s", s, err)
+		}
+		blobs = append(blobs, blob{digest: d, fetchMetaInfo: true})
+	}
+	return blobs, nil
+}
+
+// waveConfig defines a simulated deploy wave.
+type waveConfig struct {
+	namespace    string
+	agents       int
+	spread       time.Duration
+	downloadTime time.Duration
+	maxInflight  int
+	token        announcetoken.Config
+}
+
+// wave simulates agents joining a deploy over a spread of time, each pulling
+// every blob: fetching its metainfo, announcing as a leecher, and announcing as
+// a seeder once its simulated download completes.
+type wave struct {
+	config   waveConfig
+	ring     hashring.PassiveRing
+	metainfo metainfoclient.Client
+	blobs    []blob
+	recorder *recorder
+}
+
+func (w *wave) run() {
+	schedule(w.config.agents, w.config.spread, w.config.maxInflight, func(i int) {
+		if err := w.runAgent(i); err != nil {
+			log.Errorf("Agent %d failed: %s", i, err)
+		}
+	})
+}
+
+// schedule runs f for each of agents agents, which join at random offsets
+// over spread, with at most maxInflight running at once. Blocks until every
+// agent is done.
+func schedule(agents int, spread time.Duration, maxInflight int, f func(i int)) {
+	inflight := make(chan struct{}, maxInflight)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < agents; i++ {
+		// Agents join uniformly over the spread, as a rolling deploy would
+		// start containers.
+		var offset time.Duration
+		if spread > 0 {
+			offset = time.Duration(rand.Int63n(int64(spread)))
+		}
+		wg.Add(1)
+		go func(i int, offset time.Duration) {
+			defer wg.Done()
+			time.Sleep(time.Until(start.Add(offset)))
+			inflight <- struct{}{}
+			defer func() { <-inflight }()
+			f(i)
+		}(i, offset)
+	}
+	wg.Wait()
+}
+
+func (w *wave) runAgent(i int) error {
+	peerID, err := core.RandomPeerID()
+	if err != nil {
+		return fmt.Errorf("peer id: %s", err)
+	}
+	pctx := core.PeerContext{
+		IP:     fmt.Sprintf("10.%d.%d.%d", (i>>16)&0xff, (i>>8)&0xff, i&0xff),
+		Port:   16000,
+		PeerID: peerID,
+		Zone:   "loadgen",
+	}
+	client := announceclient.New(pctx, w.ring, nil, announceclient.WithToken(w.config.token))
+
+	for _, b := range w.blobs {
+		h := b.infoHash
+		if b.fetchMetaInfo {
+			var mi *core.MetaInfo
+			err := w.recorder.time("metainfo", func() (err error) {
+				mi, err = w.metainfo.Download(w.config.namespace, b.digest)
+				return err
+			})
+			if err != nil {
+				continue
+			}
+			h = mi.InfoHash()
+		}
+		err := w.recorder.time("announce", func() error {
+			_, _, err := client.Announce(w.config.namespace, b.digest, h, false, announceclient.V2)
+			return err
+		})
+		if err != nil {
+			continue
+		}
+		if w.config.downloadTime > 0 {
+			time.Sleep(time.Duration(rand.Int63n(int64(w.config.downloadTime))))
+		}
+		w.recorder.time("announce_complete", func() error {
+			_, _, err := client.Announce(w.config.namespace, b.digest, h, true, announceclient.V2)
+			return err
+		})
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleRunsEveryAgent(t *testing.T) {
+	require := require.New(t)
+
+	var mu sync.Mutex
+	ran := make(map[int]int)
+	schedule(50, 0, 10, func(i int) {
+		mu.Lock()
+		defer mu.Unlock()
+		ran[i]++
+	})
+
+	require.Len(ran, 50)
+	for i := 0; i < 50; i++ {
+		require.Equal(1, ran[i], "agent %d", i)
+	}
+}
+
+func TestScheduleLimitsInflightAgents(t *testing.T) {
+	require := require.New(t)
+
+	maxInflight := 3
+
+	var mu sync.Mutex
+	var inflight, peak int
+	schedule(20, 0, maxInflight, func(int) {
+		mu.Lock()
+		inflight++
+		if inflight > peak {
+			peak = inflight
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+	})
+
+	require.Equal(maxInflight, peak)
+}
+
+func TestScheduleSpreadsAgentsOverSpread(t *testing.T) {
+	require := require.New(t)
+
+	spread := 200 * time.Millisecond
+
+	var mu sync.Mutex
+	var joined []time.Duration
+	start := time.Now()
+	schedule(20, spread, 20, func(int) {
+		mu.Lock()
+		defer mu.Unlock()
+		joined = append(joined, time.Since(start))
+	})
+
+	require.Len(joined, 20)
+
+	// Agents do not all join at once, and none join much later than the
+	// spread.
+	var first, last time.Duration = spread, 0
+	for _, d := range joined {
+		if d < first {
+			first = d
+		}
+		if d > last {
+			last = d
+		}
+		require.True(d < spread+100*time.Millisecond, "joined after %s", d)
+	}
+	require.True(last-first > spread/10, "joined within %s", last-first)
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/memsize"
+)
+
+// spool copies src into a temporary file while digesting it, since the digest
+// of a blob determines which origins it is uploaded to, and thus must be known
+// before the upload starts. Returns the file rewound to the start.
+func spool(src io.Reader) (*os.File, core.Digest, error) {
+	f, err := ioutil.TempFile("", "kraken-upload")
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("temp file: %s", err)
+	}
+	os.Remove(f.Name())
+	digester := core.NewDigester()
+	if _, err := io.Copy(f, digester.Tee(src)); err != nil {
+		f.Close()
+		return nil, core.Digest{}, fmt.Errorf("copy: %s", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, core.Digest{}, fmt.Errorf("seek: %s", err)
+	}
+	return f, digester.Digest(), nil
+}
+
+// digestFile digests f and rewinds it to the start.
+func digestFile(f *os.File) (core.Digest, error) {
+	d, err := core.NewDigester().FromReader(f)
+	if err != nil {
+		return core.Digest{}, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return core.Digest{}, fmt.Errorf("seek: %s", err)
+	}
+	return d, nil
+}
+
+// reportProgress prints the number of bytes uploaded every interval until
+// done is closed.
+func reportProgress(uploaded *int64, size int64, interval time.Duration, done chan struct{}) {
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n := atomic.LoadInt64(uploaded)
+			var pct float64
+			if size > 0 {
+				pct = 100 * float64(n) / float64(size)
+			}
+			rate := float64(n) / time.Since(start).Seconds()
+			fmt.Fprintf(os.Stderr, "uploaded %s / %s (%.1f%%), %s/s\n",
+				memsize.Format(uint64(n)), memsize.Format(uint64(size)), pct,
+				memsize.Format(uint64(rate)))
+		case <-done:
+			return
+		}
+	}
+}
+
+// kraken-upload uploads a blob from a file or stdin to an origin cluster, and
+// waits until its torrent is registered, i.e. until agents can download it.
+// The digest of the blob is printed to stdout, such that build systems can
+// pipe artifacts straight into kraken:
+//
+//	tar c build/ | kraken-upload -origins origin.example.com:15002 -namespace artifacts
+func main() {
+	origins := flag.String("origins", "", "comma-separated origin addresses, as host:port")
+	namespace := flag.String("namespace", "", "namespace of the blob")
+	file := flag.String("file", "-", "file to upload, or - for stdin")
+	chunkSize := flag.Uint64("chunk-size", 32*memsize.MB, "size of upload chunks in bytes")
+	chunkRetries := flag.Int("chunk-retries", 5, "number of retries of each failed chunk")
+	retries := flag.Int("retries", 2, "number of restarts of failed uploads")
+	progressInterval := flag.Duration("progress-interval", 5*time.Second, "interval progress is printed at")
+	flag.Parse()
+
+	if *origins == "" {
+		log.Fatal("-origins required")
+	}
+	if *namespace == "" {
+		log.Fatal("-namespace required")
+	}
+
+	var f *os.File
+	var d core.Digest
+	var err error
+	if *file == "-" {
+		f, d, err = spool(os.Stdin)
+	} else {
+		f, err = os.Open(*file)
+		if err == nil {
+			d, err = digestFile(f)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Error reading blob: %s", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Fatalf("Error stating blob: %s", err)
+	}
+	size := info.Size()
+
+	hosts, err := hostlist.New(hostlist.Config{Static: strings.Split(*origins, ",")})
+	if err != nil {
+		log.Fatalf("Error creating origin host list: %s", err)
+	}
+	var uploaded int64
+	cluster := blobclient.NewClusterClient(blobclient.NewClientResolver(
+		blobclient.NewProvider(
+			blobclient.WithChunkSize(*chunkSize),
+			blobclient.WithChunkRetries(*chunkRetries),
+			blobclient.WithUploadProgress(func(n int64) { atomic.StoreInt64(&uploaded, n) })),
+		hosts))
+
+	done := make(chan struct{})
+	go reportProgress(&uploaded, size, *progressInterval, done)
+
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		err = cluster.UploadBlob(*namespace, d, f)
+		if err == nil || attempt >= *retries {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "upload failed, restarting: %s\n", err)
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			log.Fatalf("Error rewinding blob: %s", err)
+		}
+		atomic.StoreInt64(&uploaded, 0)
+	}
+	close(done)
+	if err != nil {
+		log.Fatalf("Error uploading blob: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "uploaded %s in %s\n",
+		memsize.Format(uint64(size)), time.Since(start).Round(time.Millisecond))
+
+	// Origins generate metainfo asynchronously once uploads are committed.
+	// GetMetaInfo polls until it exists, after which the blob is available
+	// to agents through the tracker.
+	mi, err := cluster.GetMetaInfo(*namespace, d)
+	if err != nil {
+		log.Fatalf("Error registering torrent: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "registered torrent %s with %d pieces\n", mi.InfoHash(), mi.NumPieces())
+
+	fmt.Println(d)
+}
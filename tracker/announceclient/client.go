@@ -16,15 +16,19 @@ package announceclient
 import (
 	"bytes"
 	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"time"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/auth"
 	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/tracker/announcetoken"
 	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/andres-erbsen/clock"
 )
 
 // ErrDisabled is returned when announce is disabled.
@@ -36,6 +40,133 @@ type Request struct {
 	Digest   *core.Digest   `json:"digest"` // Optional (for now).
 	InfoHash core.InfoHash  `json:"info_hash"`
 	Peer     *core.PeerInfo `json:"peer"`
+
+	// Namespace is the namespace of the announced torrent, which trackers use
+	// to decide whether the announce requires a token and to apply
+	// per-namespace handout policies. Omitted by older peers.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Token is only required when the tracker enforces announce tokens.
+	Token *announcetoken.Token `json:"token,omitempty"`
+
+	// Load is an optional hint of how busy the announcing peer currently is.
+	Load *LoadHint `json:"load,omitempty"`
+
+	// Transfer optionally reports the bytes the announcing peer transferred
+	// for the announced torrent, which trackers account per namespace.
+	Transfer *Transfer `json:"transfer,omitempty"`
+
+	// Protocol is the newest protocol version spoken by the announcing peer.
+	// Peers which predate protocol negotiation omit it.
+	Protocol int `json:"protocol,omitempty"`
+
+	// AddressFamilies lists the address families the announcing peer can
+	// connect over. If omitted, trackers assume the family of the connection
+	// the announce was received on.
+	AddressFamilies []string `json:"address_families,omitempty"`
+}
+
+// LoadHint describes the current load of an announcing peer. UploadSaturation
+// and DiskPressure are fractions in [0, 1].
+type LoadHint struct {
+	UploadSaturation float64 `json:"upload_saturation"`
+	DiskPressure     float64 `json:"disk_pressure"`
+
+	// Uploaded is the number of bytes the peer uploaded since it started,
+	// from which trackers derive its upload throughput.
+	Uploaded int64 `json:"uploaded,omitempty"`
+}
+
+// Transfer describes the bytes a peer uploaded and downloaded for a torrent
+// since it started the torrent. Counters restart from zero when the peer
+// restarts the torrent.
+type Transfer struct {
+	Uploaded   int64 `json:"uploaded"`
+	Downloaded int64 `json:"downloaded"`
+}
+
+// Max returns the highest load dimension of h.
+func (h LoadHint) Max() float64 {
+	if h.UploadSaturation > h.DiskPressure {
+		return h.UploadSaturation
+	}
+	return h.DiskPressure
+}
+
+// maxFieldLength caps the length of string fields in announce requests.
+const maxFieldLength = 255
+
+// Validate checks that r is well formed, such that trackers can reject
+// malformed requests before acting on them.
+func (r *Request) Validate() error {
+	if len(r.Name) > maxFieldLength {
+		return fmt.Errorf("name exceeds %d bytes", maxFieldLength)
+	}
+	if r.Peer == nil {
+		return errors.New("missing peer")
+	}
+	if r.Peer.IP == "" {
+		return errors.New("missing peer ip")
+	}
+	if r.Peer.Port < 0 || r.Peer.Port > 65535 {
+		return fmt.Errorf("invalid peer port %d", r.Peer.Port)
+	}
+	if len(r.Namespace) > maxFieldLength {
+		return fmt.Errorf("namespace exceeds %d bytes", maxFieldLength)
+	}
+	for field, v := range map[string]string{
+		"ip":       r.Peer.IP,
+		"hostname": r.Peer.Hostname,
+		"zone":     r.Peer.Zone,
+		"rack":     r.Peer.Rack,
+		"dc":       r.Peer.DC,
+		"ipv6":     r.Peer.IPv6,
+	} {
+		if len(v) > maxFieldLength {
+			return fmt.Errorf("peer %s exceeds %d bytes", field, maxFieldLength)
+		}
+	}
+	if r.Peer.IPv6 != "" && core.AddressFamily(r.Peer.IPv6) != core.IPv6 {
+		return fmt.Errorf("invalid peer ipv6 %q", r.Peer.IPv6)
+	}
+	if len(r.Peer.Networks) > core.MaxNetworks {
+		return fmt.Errorf("peer announces more than %d networks", core.MaxNetworks)
+	}
+	for label, ip := range r.Peer.Networks {
+		if !core.ValidNetworkLabel(label) {
+			return fmt.Errorf("invalid peer network label %q", label)
+		}
+		if core.AddressFamily(ip) == "" {
+			return fmt.Errorf("invalid peer ip %q for network %s", ip, label)
+		}
+	}
+	for _, f := range r.AddressFamilies {
+		if f != core.IPv4 && f != core.IPv6 {
+			return fmt.Errorf("unknown address family %q", f)
+		}
+	}
+	if r.Load != nil {
+		for _, v := range []float64{r.Load.UploadSaturation, r.Load.DiskPressure} {
+			if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+				return fmt.Errorf("invalid load hint %v", v)
+			}
+		}
+		if r.Load.Uploaded < 0 {
+			return fmt.Errorf("invalid uploaded bytes %d", r.Load.Uploaded)
+		}
+	}
+	if r.Transfer != nil && (r.Transfer.Uploaded < 0 || r.Transfer.Downloaded < 0) {
+		return fmt.Errorf("invalid transfer %+v", *r.Transfer)
+	}
+	return nil
+}
+
+// GetProtocol is a backwards compatible accessor of the request protocol.
+func (r *Request) GetProtocol() int {
+	if r.Protocol == 0 {
+		return Protocol1
+	}
+	return r.Protocol
 }
 
 // GetDigest is a backwards compatible accessor of the request digest.
@@ -54,11 +185,47 @@ func (r *Request) GetDigest() (core.Digest, error) {
 type Response struct {
 	Peers    []*core.PeerInfo `json:"peers"`
 	Interval time.Duration    `json:"interval"`
+
+	// MinInterval is the shortest interval the peer may announce at. Trackers
+	// which do not bound the interval omit it.
+	MinInterval time.Duration `json:"min_interval,omitempty"`
+
+	// Stale is set when the tracker's peer store is unavailable and Peers were
+	// served from a cache.
+	Stale bool `json:"stale,omitempty"`
+
+	// Explanations annotates each peer in Peers with the reasons it was handed
+	// out. Only set when the tracker has handout explanations enabled.
+	Explanations []PeerExplanation `json:"explanations,omitempty"`
+
+	// Protocol is the protocol version negotiated for the announce, which
+	// Peers conform to. Trackers which predate protocol negotiation omit it.
+	Protocol int `json:"protocol,omitempty"`
+
+	// CompactPeerList replaces Peers when compact peer lists were requested
+	// and all peers could be encoded.
+	*CompactPeerList
+}
+
+// GetInterval returns the interval the peer should next announce at, which is
+// never shorter than MinInterval.
+func (r *Response) GetInterval() time.Duration {
+	if r.Interval < r.MinInterval {
+		return r.MinInterval
+	}
+	return r.Interval
+}
+
+// PeerExplanation describes why a peer was included in a handout.
+type PeerExplanation struct {
+	PeerID  core.PeerID `json:"peer_id"`
+	Reasons []string    `json:"reasons"`
 }
 
 // Client defines a client for announcing and getting peers.
 type Client interface {
 	Announce(
+		namespace string,
 		d core.Digest,
 		h core.InfoHash,
 		complete bool,
@@ -66,14 +233,66 @@ type Client interface {
 }
 
 type client struct {
-	pctx core.PeerContext
-	ring hashring.PassiveRing
-	tls  *tls.Config
+	pctx     core.PeerContext
+	ring     hashring.PassiveRing
+	tls      *tls.Config
+	tokens   *announcetoken.Generator
+	load     func() *LoadHint
+	transfer func(core.InfoHash) *Transfer
+	compact  bool
+	bearer   string
+}
+
+// Option allows setting optional client parameters.
+type Option func(*client)
+
+// WithToken configures the client to attach announce tokens to each request.
+func WithToken(config announcetoken.Config) Option {
+	return func(c *client) { c.tokens = announcetoken.NewGenerator(config, clock.New()) }
+}
+
+// WithBearerToken configures the client to authenticate each request with
+// token, for trackers which require authentication.
+func WithBearerToken(token string) Option {
+	return func(c *client) { c.bearer = token }
+}
+
+// WithLoadHint configures the client to attach the hint returned by load to
+// each request. A nil hint is omitted.
+func WithLoadHint(load func() *LoadHint) Option {
+	return func(c *client) { c.load = load }
+}
+
+// WithTransfer configures the client to attach the transfer returned by
+// transfer for the announced torrent to each request. A nil transfer is
+// omitted.
+func WithTransfer(transfer func(core.InfoHash) *Transfer) Option {
+	return func(c *client) { c.transfer = transfer }
+}
+
+// WithCompactPeers configures the client to request compact peer lists, which
+// are roughly an order of magnitude smaller than full peer lists in large
+// swarms. Compact peers only carry peer ids and addresses, and are ordered by
+// address family. Trackers which do not support compact peer lists, or cannot
+// encode every peer compactly, answer with full peer lists.
+func WithCompactPeers() Option {
+	return func(c *client) { c.compact = true }
 }
 
 // New creates a new client.
-func New(pctx core.PeerContext, ring hashring.PassiveRing, tls *tls.Config) Client {
-	return &client{pctx, ring, tls}
+func New(
+	pctx core.PeerContext, ring hashring.PassiveRing, tls *tls.Config, opts ...Option) Client {
+
+	c := &client{
+		pctx:   pctx,
+		ring:   ring,
+		tls:    tls,
+		tokens: announcetoken.NewGenerator(announcetoken.Config{}, clock.New()),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // Announce versionss.
@@ -82,6 +301,24 @@ const (
 	V2 = 2
 )
 
+// Announce protocol versions. Unlike announce versions, which select the
+// announce endpoint, protocol versions define the semantics of requests and
+// responses. Each announce is answered in the newest protocol spoken by both
+// the peer and the tracker, such that agents and trackers can be upgraded
+// independently.
+const (
+	// Protocol1 peers predate protocol negotiation, and only connect to peers
+	// by IP.
+	Protocol1 = 1
+
+	// Protocol2 peers connect to peers by hostname if present, so handouts may
+	// omit peer IPs.
+	Protocol2 = 2
+
+	// CurrentProtocol is the newest protocol version.
+	CurrentProtocol = Protocol2
+)
+
 func getEndpoint(version int, addr string, h core.InfoHash) (method, url string) {
 	if version == V1 {
 		return "GET", fmt.Sprintf("http://%s/announce", addr)
@@ -89,32 +326,57 @@ func getEndpoint(version int, addr string, h core.InfoHash) (method, url string)
 	return "POST", fmt.Sprintf("http://%s/announce/%s", addr, h.String())
 }
 
-// Announce announces the torrent identified by (d, h) with the number of
-// downloaded bytes. Returns a list of all other peers announcing for said torrent,
-// sorted by priority, and the interval for the next announce.
+// Announce announces the torrent identified by (d, h) within namespace with the
+// number of downloaded bytes. Returns a list of all other peers announcing for
+// said torrent, sorted by priority, and the interval for the next announce.
 func (c *client) Announce(
+	namespace string,
 	d core.Digest,
 	h core.InfoHash,
 	complete bool,
 	version int) (peers []*core.PeerInfo, interval time.Duration, err error) {
 
-	body, err := json.Marshal(&Request{
-		Name:     d.Hex(), // For backwards compatability. TODO(codyg): Remove.
-		Digest:   &d,
-		InfoHash: h,
-		Peer:     core.PeerInfoFromContext(c.pctx, complete),
-	})
+	token, err := c.tokens.Generate(namespace, h, c.pctx.PeerID)
 	if err != nil {
-		return nil, 0, fmt.Errorf("marshal request: %s", err)
+		return nil, 0, fmt.Errorf("generate token: %s", err)
+	}
+	var load *LoadHint
+	if c.load != nil {
+		load = c.load()
+	}
+	var transfer *Transfer
+	if c.transfer != nil {
+		transfer = c.transfer(h)
+	}
+	req := &Request{
+		Name:      d.Hex(), // For backwards compatability. TODO(codyg): Remove.
+		Digest:    &d,
+		InfoHash:  h,
+		Peer:      core.PeerInfoFromContext(c.pctx, complete),
+		Namespace: namespace,
+		Token:     token,
+		Load:      load,
+		Transfer:  transfer,
+		Protocol:  CurrentProtocol,
+
+		AddressFamilies: c.pctx.AddressFamilies(),
+	}
+	body, err := req.Encode()
+	if err != nil {
+		return nil, 0, fmt.Errorf("encode request: %s", err)
 	}
 	var httpResp *http.Response
 	for _, addr := range c.ring.Locations(d) {
 		method, url := getEndpoint(version, addr, h)
+		if c.compact {
+			url += "?compact=1"
+		}
 		httpResp, err = httputil.Send(
 			method,
 			url,
 			httputil.SendBody(bytes.NewReader(body)),
 			httputil.SendTimeout(10*time.Second),
+			httputil.SendHeaders(auth.BearerHeader(c.bearer)),
 			httputil.SendTLS(c.tls))
 		if err != nil {
 			if httputil.IsNetworkError(err) {
@@ -124,11 +386,15 @@ func (c *client) Announce(
 			return nil, 0, err
 		}
 		defer httpResp.Body.Close()
-		var resp Response
-		if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		resp, err := DecodeResponse(httpResp.Body)
+		if err != nil {
 			return nil, 0, fmt.Errorf("decode response: %s", err)
 		}
-		return resp.Peers, resp.Interval, nil
+		peers, err := resp.GetPeers()
+		if err != nil {
+			return nil, 0, fmt.Errorf("expand compact peers: %s", err)
+		}
+		return peers, resp.GetInterval(), nil
 	}
 	return nil, 0, err
 }
@@ -144,7 +410,8 @@ func Disabled() Client {
 
 // Announce always returns error.
 func (c DisabledClient) Announce(
-	d core.Digest, h core.InfoHash, complete bool, version int) ([]*core.PeerInfo, time.Duration, error) {
+	namespace string, d core.Digest, h core.InfoHash, complete bool,
+	version int) ([]*core.PeerInfo, time.Duration, error) {
 
 	return nil, 0, ErrDisabled
 }
@@ -0,0 +1,59 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Encode encodes r for the announce endpoints.
+func (r *Request) Encode() ([]byte, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+	return b, nil
+}
+
+// DecodeRequest decodes and validates an announce request encoded by Encode,
+// such that trackers can reject malformed requests before acting on them.
+func DecodeRequest(b []byte) (*Request, error) {
+	r := new(Request)
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid request: %s", err)
+	}
+	return r, nil
+}
+
+// Encode writes r to w.
+func (r *Response) Encode(w io.Writer) error {
+	if err := json.NewEncoder(w).Encode(r); err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	return nil
+}
+
+// DecodeResponse reads a response written by Encode from r.
+func DecodeResponse(r io.Reader) (*Response, error) {
+	resp := new(Response)
+	if err := json.NewDecoder(r).Decode(resp); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requestFixture() *Request {
+	d := core.DigestFixture()
+	p := core.PeerInfoFixture()
+	p.Zone = "zone1"
+	p.Rack = "rack1"
+	p.DC = "dc1"
+	return &Request{
+		Digest:          &d,
+		InfoHash:        core.InfoHashFixture(),
+		Peer:            p,
+		Namespace:       core.NamespaceFixture(),
+		Load:            &LoadHint{UploadSaturation: 0.5},
+		Transfer:        &Transfer{Uploaded: 10, Downloaded: 20},
+		Protocol:        CurrentProtocol,
+		AddressFamilies: []string{core.IPv4},
+	}
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	req := requestFixture()
+
+	b, err := req.Encode()
+	require.NoError(err)
+
+	result, err := DecodeRequest(b)
+	require.NoError(err)
+	require.Equal(req, result)
+}
+
+func TestDecodeRequestErrors(t *testing.T) {
+	tooLong := requestFixture()
+	tooLong.Peer.Rack = strings.Repeat("a", maxFieldLength+1)
+
+	tooLongBody, err := tooLong.Encode()
+	require.NoError(t, err)
+
+	negativeTransfer := requestFixture()
+	negativeTransfer.Transfer.Downloaded = -1
+
+	negativeTransferBody, err := negativeTransfer.Encode()
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc string
+		body []byte
+	}{
+		{"malformed json", []byte("{")},
+		{"missing peer", []byte("{}")},
+		{"peer field too long", tooLongBody},
+		{"negative transfer", negativeTransferBody},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := DecodeRequest(test.body)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	resp := &Response{
+		Peers:    []*core.PeerInfo{core.PeerInfoFixture(), core.PeerInfoFixture()},
+		Interval: 3 * time.Second,
+		Protocol: CurrentProtocol,
+	}
+
+	var b bytes.Buffer
+	require.NoError(resp.Encode(&b))
+
+	result, err := DecodeResponse(&b)
+	require.NoError(err)
+	require.Equal(resp, result)
+}
+
+func TestResponseGetIntervalHonorsMinInterval(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(3*time.Second, (&Response{Interval: 3 * time.Second}).GetInterval())
+	require.Equal(5*time.Second, (&Response{
+		Interval:    3 * time.Second,
+		MinInterval: 5 * time.Second,
+	}).GetInterval())
+}
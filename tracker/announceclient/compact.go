@@ -0,0 +1,111 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/uber/kraken/core"
+)
+
+// Sizes of each peer in compact peer lists.
+const (
+	compactAddrSize  = net.IPv4len + 2
+	compactAddr6Size = net.IPv6len + 2
+	compactIDSize    = len(core.PeerID{})
+)
+
+// CompactPeerList is a peer list in compact form. IPv4 peers are encoded in
+// the standard 6 bytes per peer of BEP 23, and IPv6 peers in the 18 bytes per
+// peer of BEP 7, i.e. the address followed by the port in network byte order.
+// Kraken peers identify each other by peer id, so the ids of the peers of each
+// list are encoded separately, in the same order.
+type CompactPeerList struct {
+	Peers    []byte `json:"compact_peers,omitempty"`
+	PeerIDs  []byte `json:"compact_peer_ids,omitempty"`
+	Peers6   []byte `json:"compact_peers6,omitempty"`
+	PeerIDs6 []byte `json:"compact_peer_ids6,omitempty"`
+}
+
+// CompactPeers encodes peers into a CompactPeerList. Returns false if any peer
+// cannot be encoded, i.e. it is addressed by hostname.
+func CompactPeers(peers []*core.PeerInfo) (*CompactPeerList, bool) {
+	l := new(CompactPeerList)
+	for _, p := range peers {
+		if p.Hostname != "" || p.Port < 0 || p.Port > 65535 {
+			return nil, false
+		}
+		ip := net.ParseIP(p.IP)
+		if ip == nil {
+			return nil, false
+		}
+		port := []byte{byte(p.Port >> 8), byte(p.Port)}
+		if ip4 := ip.To4(); ip4 != nil {
+			l.Peers = append(append(l.Peers, ip4...), port...)
+			l.PeerIDs = append(l.PeerIDs, p.PeerID[:]...)
+		} else {
+			l.Peers6 = append(append(l.Peers6, ip.To16()...), port...)
+			l.PeerIDs6 = append(l.PeerIDs6, p.PeerID[:]...)
+		}
+	}
+	return l, true
+}
+
+// Expand decodes the peers of l. Compact peers only carry peer ids and
+// addresses. IPv4 peers precede IPv6 peers, so the relative order of peers of
+// different families is lost.
+func (l *CompactPeerList) Expand() ([]*core.PeerInfo, error) {
+	peers, err := expandPeers(l.Peers, l.PeerIDs, compactAddrSize)
+	if err != nil {
+		return nil, err
+	}
+	peers6, err := expandPeers(l.Peers6, l.PeerIDs6, compactAddr6Size)
+	if err != nil {
+		return nil, fmt.Errorf("peers6: %s", err)
+	}
+	return append(peers, peers6...), nil
+}
+
+func expandPeers(addrs []byte, ids []byte, size int) ([]*core.PeerInfo, error) {
+	if len(addrs)%size != 0 {
+		return nil, fmt.Errorf("compact peers length %d not a multiple of %d", len(addrs), size)
+	}
+	n := len(addrs) / size
+	if len(ids) != n*compactIDSize {
+		return nil, fmt.Errorf("%d bytes of compact peer ids for %d peers", len(ids), n)
+	}
+	peers := make([]*core.PeerInfo, n)
+	for i := 0; i < n; i++ {
+		a := addrs[i*size : (i+1)*size]
+		var id core.PeerID
+		copy(id[:], ids[i*compactIDSize:(i+1)*compactIDSize])
+		peers[i] = &core.PeerInfo{
+			PeerID: id,
+			IP:     net.IP(a[:size-2]).String(),
+			Port:   int(binary.BigEndian.Uint16(a[size-2:])),
+		}
+	}
+	return peers, nil
+}
+
+// GetPeers returns the peers of r, expanding compact peers if the tracker
+// answered in compact form.
+func (r *Response) GetPeers() ([]*core.PeerInfo, error) {
+	if r.CompactPeerList == nil {
+		return r.Peers, nil
+	}
+	return r.CompactPeerList.Expand()
+}
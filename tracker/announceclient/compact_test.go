@@ -0,0 +1,115 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactPeersRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	var peers []*core.PeerInfo
+	for i := 0; i < 5; i++ {
+		p := core.PeerInfoFixture()
+		peers = append(peers, &core.PeerInfo{PeerID: p.PeerID, IP: p.IP, Port: p.Port})
+	}
+
+	l, ok := CompactPeers(peers)
+	require.True(ok)
+	require.Len(l.Peers, 6*len(peers))
+	require.Len(l.PeerIDs, 20*len(peers))
+	require.Empty(l.Peers6)
+
+	result, err := l.Expand()
+	require.NoError(err)
+	require.Equal(peers, result)
+}
+
+func TestCompactPeersEncodesStandardFormat(t *testing.T) {
+	require := require.New(t)
+
+	p := &core.PeerInfo{PeerID: core.PeerIDFixture(), IP: "10.1.2.3", Port: 8080}
+	p6 := &core.PeerInfo{PeerID: core.PeerIDFixture(), IP: "2001:db8::1", Port: 8080}
+
+	l, ok := CompactPeers([]*core.PeerInfo{p6, p})
+	require.True(ok)
+	require.Equal([]byte{10, 1, 2, 3, 0x1f, 0x90}, l.Peers)
+	require.Equal(p.PeerID[:], l.PeerIDs)
+	require.Equal([]byte{
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0x1f, 0x90,
+	}, l.Peers6)
+	require.Equal(p6.PeerID[:], l.PeerIDs6)
+
+	// IPv4 peers precede IPv6 peers.
+	result, err := l.Expand()
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p, p6}, result)
+}
+
+func TestCompactPeersRejectsUnencodablePeers(t *testing.T) {
+	tests := []struct {
+		desc string
+		peer *core.PeerInfo
+	}{
+		{"hostname", &core.PeerInfo{IP: "10.0.0.1", Hostname: "agent1.example.com", Port: 80}},
+		{"no ip", &core.PeerInfo{Hostname: "agent1.example.com", Port: 80}},
+		{"invalid ip", &core.PeerInfo{IP: "not an ip", Port: 80}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, ok := CompactPeers([]*core.PeerInfo{core.PeerInfoFixture(), test.peer})
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestCompactPeerListExpandRejectsMalformedLists(t *testing.T) {
+	tests := []struct {
+		desc string
+		list CompactPeerList
+	}{
+		{"truncated peer", CompactPeerList{Peers: make([]byte, 7), PeerIDs: make([]byte, 20)}},
+		{"missing peer id", CompactPeerList{Peers: make([]byte, 12), PeerIDs: make([]byte, 20)}},
+		{"truncated peer6", CompactPeerList{Peers6: make([]byte, 17), PeerIDs6: make([]byte, 20)}},
+		{"peer6 ids in peer ids", CompactPeerList{Peers6: make([]byte, 18), PeerIDs: make([]byte, 20)}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := test.list.Expand()
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestResponseGetPeersPrefersCompactPeers(t *testing.T) {
+	require := require.New(t)
+
+	p := &core.PeerInfo{PeerID: core.PeerIDFixture(), IP: "10.1.2.3", Port: 8080}
+	l, ok := CompactPeers([]*core.PeerInfo{p})
+	require.True(ok)
+
+	peers, err := (&Response{CompactPeerList: l}).GetPeers()
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+
+	full := []*core.PeerInfo{core.PeerInfoFixture()}
+	peers, err = (&Response{Peers: full}).GetPeers()
+	require.NoError(err)
+	require.Equal(full, peers)
+}
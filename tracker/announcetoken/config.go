@@ -0,0 +1,62 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announcetoken
+
+import "time"
+
+// Config defines announce token configuration. The same config should be
+// shared between agents and trackers, since both must agree on Secret.
+//
+// NOTE: Tokens are neither generated nor verified unless Enabled is true.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Secret is the shared HMAC key used to sign tokens. Should be supplied
+	// via secrets file.
+	Secret string `yaml:"secret"`
+
+	// Namespaces are regexes of the restricted namespaces, announces of which
+	// must carry a token. Required by verifiers. Announces of all other
+	// namespaces are not verified, unless they announce a torrent which was
+	// seen in a restricted namespace within the RestrictionTTL.
+	Namespaces []string `yaml:"namespaces"`
+
+	// MaxClockSkew is the max difference between a token's timestamp and the
+	// verifier's clock. Nonces are remembered for twice this duration, after
+	// which the timestamp check alone rejects replays.
+	//
+	// Trackers backed by the redis peer store share used nonces, so a token is
+	// accepted once by the whole cluster. Other trackers only remember nonces
+	// in memory, so a captured token may be replayed once against every other
+	// replica, and against restarted trackers, until its timestamp falls
+	// outside the skew.
+	MaxClockSkew time.Duration `yaml:"max_clock_skew"`
+
+	// RestrictionTTL is how long a torrent announced, or whose metainfo was
+	// requested, in a restricted namespace keeps requiring tokens when
+	// announced in other namespaces. Should exceed the peer TTL, so that the
+	// peers of restricted swarms are never handed out without a token. Like
+	// nonces, restricted torrents are shared through the redis peer store.
+	RestrictionTTL time.Duration `yaml:"restriction_ttl"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.MaxClockSkew == 0 {
+		c.MaxClockSkew = 30 * time.Second
+	}
+	if c.RestrictionTTL == 0 {
+		c.RestrictionTTL = 24 * time.Hour
+	}
+	return c
+}
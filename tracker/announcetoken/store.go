@@ -0,0 +1,117 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announcetoken
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+
+	"github.com/uber/kraken/core"
+)
+
+// ErrNoStore is returned by Store implementations which wrap a store that
+// cannot keep announce token state.
+var ErrNoStore = errors.New("store does not support announce tokens")
+
+// Store keeps the used nonces and restricted torrents of Verifier. A Store
+// shared by all trackers keeps a token from being replayed against other
+// replicas, and keeps restricted torrents restricted across restarts.
+type Store interface {
+	// UseNonce marks nonce as used for ttl. Returns false if nonce was
+	// already used.
+	UseNonce(nonce string, ttl time.Duration) (bool, error)
+
+	// RestrictTorrent marks h as restricted for ttl.
+	RestrictTorrent(h core.InfoHash, ttl time.Duration) error
+
+	// RestrictedTorrent returns whether h is restricted.
+	RestrictedTorrent(h core.InfoHash) (bool, error)
+}
+
+// localStore is an in-memory Store, which Verifier checks before any shared
+// Store.
+type localStore struct {
+	clk             clock.Clock
+	cleanupInterval time.Duration
+
+	mu          sync.Mutex
+	nonces      map[string]time.Time
+	restricted  map[core.InfoHash]time.Time
+	lastCleanup time.Time
+}
+
+func newLocalStore(clk clock.Clock, cleanupInterval time.Duration) *localStore {
+	return &localStore{
+		clk:             clk,
+		cleanupInterval: cleanupInterval,
+		nonces:          make(map[string]time.Time),
+		restricted:      make(map[core.InfoHash]time.Time),
+		lastCleanup:     clk.Now(),
+	}
+}
+
+func (s *localStore) UseNonce(nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clk.Now()
+	s.cleanup(now)
+
+	if expiresAt, ok := s.nonces[nonce]; ok && !now.After(expiresAt) {
+		return false, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+func (s *localStore) RestrictTorrent(h core.InfoHash, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clk.Now()
+	s.cleanup(now)
+
+	s.restricted[h] = now.Add(ttl)
+	return nil
+}
+
+func (s *localStore) RestrictedTorrent(h core.InfoHash) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.restricted[h]
+	return ok && !s.clk.Now().After(expiresAt), nil
+}
+
+// cleanup removes expired nonces and restricted torrents at most once per
+// cleanup interval. Must be called with s.mu held.
+func (s *localStore) cleanup(now time.Time) {
+	if now.Sub(s.lastCleanup) < s.cleanupInterval {
+		return
+	}
+	for nonce, expiresAt := range s.nonces {
+		if now.After(expiresAt) {
+			delete(s.nonces, nonce)
+		}
+	}
+	for h, expiresAt := range s.restricted {
+		if now.After(expiresAt) {
+			delete(s.restricted, h)
+		}
+	}
+	s.lastCleanup = now
+}
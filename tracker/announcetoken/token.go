@@ -0,0 +1,294 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announcetoken
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/log"
+)
+
+// Token errors.
+var (
+	ErrMissing          = errors.New("announce token missing")
+	ErrExpired          = errors.New("announce token timestamp outside allowed skew")
+	ErrReplayed         = errors.New("announce token nonce already used")
+	ErrInvalidSignature = errors.New("announce token signature invalid")
+)
+
+// Token authenticates a single announce. Each token binds a random nonce and
+// timestamp to the announced namespace, torrent and peer, such that a captured
+// token cannot be used for other namespaces, other torrents, other peers, or
+// replayed.
+type Token struct {
+	Nonce     string `json:"nonce"`
+	Timestamp int64  `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+func sign(
+	secret, namespace string, h core.InfoHash, peerID core.PeerID, nonce string, ts int64) string {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	// Namespaces may contain colons, so the namespace goes last.
+	fmt.Fprintf(mac, "%s:%s:%s:%d:%s", h.Hex(), peerID.String(), nonce, ts, namespace)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Generator creates tokens for outgoing announces.
+type Generator struct {
+	config Config
+	clk    clock.Clock
+}
+
+// NewGenerator creates a new Generator.
+func NewGenerator(config Config, clk clock.Clock) *Generator {
+	return &Generator{config.applyDefaults(), clk}
+}
+
+// Generate returns a new token for peerID announcing h in namespace. Returns
+// nil if tokens are disabled.
+func (g *Generator) Generate(namespace string, h core.InfoHash, peerID core.PeerID) (*Token, error) {
+	if !g.config.Enabled {
+		return nil, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("read nonce: %s", err)
+	}
+	nonce := hex.EncodeToString(b)
+	ts := g.clk.Now().Unix()
+	return &Token{
+		Nonce:     nonce,
+		Timestamp: ts,
+		Signature: sign(g.config.Secret, namespace, h, peerID, nonce, ts),
+	}, nil
+}
+
+// Verifier validates tokens on incoming announces and remembers used nonces
+// to reject replays.
+//
+// Since the namespace of an announce is chosen by the peer, Verifier also
+// remembers which torrents were announced, or had their metainfo requested, in
+// restricted namespaces, and keeps requiring tokens for them regardless of the
+// namespace they are announced in.
+//
+// Used nonces and restricted torrents are kept in memory, and in a Store shared
+// by all trackers if configured. If the shared Store fails, Verifier falls back
+// to memory for nonces, and requires tokens for every torrent.
+type Verifier struct {
+	config     Config
+	clk        clock.Clock
+	stats      tally.Scope
+	namespaces []*regexp.Regexp
+	local      *localStore
+
+	mu    sync.Mutex
+	store Store // Nil if not shared.
+}
+
+// Option allows setting optional Verifier parameters.
+type Option func(*Verifier)
+
+// WithStore configures a Verifier to share used nonces and restricted torrents
+// through s, such that they are shared by all trackers and survive restarts.
+func WithStore(s Store) Option {
+	return func(v *Verifier) { v.store = s }
+}
+
+// WithStats configures Verifier stats.
+func WithStats(stats tally.Scope) Option {
+	return func(v *Verifier) { v.stats = stats }
+}
+
+// NewVerifier creates a new Verifier. Returns an error if config enables
+// verification without a secret or restricted namespaces.
+func NewVerifier(config Config, clk clock.Clock, opts ...Option) (*Verifier, error) {
+	config = config.applyDefaults()
+	v := &Verifier{
+		config: config,
+		clk:    clk,
+		stats:  tally.NoopScope,
+		local:  newLocalStore(clk, config.MaxClockSkew),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	v.stats = v.stats.SubScope("announce_token")
+	if !config.Enabled {
+		return v, nil
+	}
+	if config.Secret == "" {
+		return nil, errors.New("secret required")
+	}
+	if len(config.Namespaces) == 0 {
+		return nil, errors.New("namespaces required")
+	}
+	for _, ns := range config.Namespaces {
+		re, err := regexp.Compile(ns)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %q: %s", ns, err)
+		}
+		v.namespaces = append(v.namespaces, re)
+	}
+	return v, nil
+}
+
+// Enabled returns whether v requires tokens.
+func (v *Verifier) Enabled() bool {
+	return v.config.Enabled
+}
+
+// Restricted returns whether announces of namespace must carry a token.
+func (v *Verifier) Restricted(namespace string) bool {
+	if !v.config.Enabled {
+		return false
+	}
+	for _, re := range v.namespaces {
+		if re.MatchString(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// RestrictedTorrent returns whether announces of h in namespace must carry a
+// token, i.e. whether namespace is restricted or h was recently seen in a
+// restricted namespace.
+func (v *Verifier) RestrictedTorrent(namespace string, h core.InfoHash) bool {
+	return v.Restricted(namespace) || (v.config.Enabled && v.restrictedTorrent(h))
+}
+
+// Observe records that the metainfo of h was requested in namespace, such
+// that announces of h require tokens if namespace is restricted. Agents request
+// metainfo before announcing, so torrents are restricted before their first
+// announce, independent of the namespace the announce claims.
+func (v *Verifier) Observe(namespace string, h core.InfoHash) {
+	if v.Restricted(namespace) {
+		v.restrictTorrent(h)
+	}
+}
+
+// Verify checks that t is a valid, unused token for peerID announcing h in
+// namespace. Announces of unrestricted namespaces are accepted, unless h was
+// recently seen in a restricted namespace.
+func (v *Verifier) Verify(namespace string, h core.InfoHash, peerID core.PeerID, t *Token) error {
+	if !v.config.Enabled {
+		return nil
+	}
+	restricted := v.Restricted(namespace)
+	if !restricted && !v.restrictedTorrent(h) {
+		return nil
+	}
+	if t == nil {
+		return ErrMissing
+	}
+	now := v.clk.Now()
+	ts := time.Unix(t.Timestamp, 0)
+	if ts.Before(now.Add(-v.config.MaxClockSkew)) || ts.After(now.Add(v.config.MaxClockSkew)) {
+		return ErrExpired
+	}
+	expected := sign(v.config.Secret, namespace, h, peerID, t.Nonce, t.Timestamp)
+	if !hmac.Equal([]byte(expected), []byte(t.Signature)) {
+		return ErrInvalidSignature
+	}
+	if !v.useNonce(t.Nonce) {
+		return ErrReplayed
+	}
+	if restricted {
+		v.restrictTorrent(h)
+	}
+	return nil
+}
+
+func (v *Verifier) getStore() Store {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.store
+}
+
+// storeFailed logs a shared store error. If the store does not support
+// announce tokens, v stops using it for good.
+func (v *Verifier) storeFailed(op string, err error) {
+	if err == ErrNoStore {
+		log.Info("Peer store does not support announce tokens, keeping them in memory")
+		v.mu.Lock()
+		v.store = nil
+		v.mu.Unlock()
+		return
+	}
+	v.stats.Counter("store_errors").Inc(1)
+	log.Errorf("Error %s in announce token store: %s", op, err)
+}
+
+// useNonce marks nonce as used, returning false if it was already used.
+// Nonces are remembered for twice the skew, after which the timestamp check
+// alone rejects replays.
+func (v *Verifier) useNonce(nonce string) bool {
+	ttl := 2 * v.config.MaxClockSkew
+	if ok, _ := v.local.UseNonce(nonce, ttl); !ok {
+		return false
+	}
+	s := v.getStore()
+	if s == nil {
+		return true
+	}
+	ok, err := s.UseNonce(nonce, ttl)
+	if err != nil {
+		// Only replays against other trackers go unnoticed.
+		v.storeFailed("using nonce", err)
+		return true
+	}
+	return ok
+}
+
+func (v *Verifier) restrictTorrent(h core.InfoHash) {
+	v.local.RestrictTorrent(h, v.config.RestrictionTTL)
+	if s := v.getStore(); s != nil {
+		if err := s.RestrictTorrent(h, v.config.RestrictionTTL); err != nil {
+			v.storeFailed("restricting torrent", err)
+		}
+	}
+}
+
+// restrictedTorrent returns whether h was recently seen in a restricted
+// namespace. Torrents are considered restricted if the shared store fails.
+func (v *Verifier) restrictedTorrent(h core.InfoHash) bool {
+	if ok, _ := v.local.RestrictedTorrent(h); ok {
+		return true
+	}
+	s := v.getStore()
+	if s == nil {
+		return false
+	}
+	ok, err := s.RestrictedTorrent(h)
+	if err != nil {
+		v.storeFailed("checking restricted torrent", err)
+		return err != ErrNoStore
+	}
+	return ok
+}
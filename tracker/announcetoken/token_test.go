@@ -0,0 +1,309 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announcetoken
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+)
+
+func testConfig() Config {
+	return Config{
+		Enabled:      true,
+		Secret:       "some secret",
+		Namespaces:   []string{"restricted/.*"},
+		MaxClockSkew: 10 * time.Second,
+	}
+}
+
+const _restricted = "restricted/repo"
+
+func newTestVerifier(t *testing.T, config Config, clk clock.Clock) *Verifier {
+	v, err := NewVerifier(config, clk)
+	require.NoError(t, err)
+	return v
+}
+
+func TestVerifierAcceptsValidToken(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	g := NewGenerator(testConfig(), clk)
+	v := newTestVerifier(t, testConfig(), clk)
+
+	h := core.InfoHashFixture()
+	peerID := core.PeerIDFixture()
+
+	token, err := g.Generate(_restricted, h, peerID)
+	require.NoError(err)
+	require.NoError(v.Verify(_restricted, h, peerID, token))
+}
+
+func TestVerifierRejectsReplayedToken(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	g := NewGenerator(testConfig(), clk)
+	v := newTestVerifier(t, testConfig(), clk)
+
+	h := core.InfoHashFixture()
+	peerID := core.PeerIDFixture()
+
+	token, err := g.Generate(_restricted, h, peerID)
+	require.NoError(err)
+	require.NoError(v.Verify(_restricted, h, peerID, token))
+	require.Equal(ErrReplayed, v.Verify(_restricted, h, peerID, token))
+
+	// Once the nonce is forgotten, the timestamp check must still reject it.
+	clk.Add(3 * testConfig().MaxClockSkew)
+	require.Equal(ErrExpired, v.Verify(_restricted, h, peerID, token))
+}
+
+func TestVerifierRejectsTokenForDifferentTorrentOrPeer(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	g := NewGenerator(testConfig(), clk)
+	v := newTestVerifier(t, testConfig(), clk)
+
+	h := core.InfoHashFixture()
+	peerID := core.PeerIDFixture()
+
+	token, err := g.Generate(_restricted, h, peerID)
+	require.NoError(err)
+
+	require.Equal(ErrInvalidSignature, v.Verify(_restricted, core.InfoHashFixture(), peerID, token))
+	require.Equal(ErrInvalidSignature, v.Verify(_restricted, h, core.PeerIDFixture(), token))
+	require.Equal(ErrInvalidSignature, v.Verify("restricted/other", h, peerID, token))
+}
+
+func TestVerifierRejectsWrongSecret(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	config := testConfig()
+	config.Secret = "other secret"
+	g := NewGenerator(config, clk)
+	v := newTestVerifier(t, testConfig(), clk)
+
+	h := core.InfoHashFixture()
+	peerID := core.PeerIDFixture()
+
+	token, err := g.Generate(_restricted, h, peerID)
+	require.NoError(err)
+	require.Equal(ErrInvalidSignature, v.Verify(_restricted, h, peerID, token))
+}
+
+func TestVerifierRequiresToken(t *testing.T) {
+	require := require.New(t)
+
+	v := newTestVerifier(t, testConfig(), clock.New())
+	require.Equal(ErrMissing, v.Verify(_restricted, core.InfoHashFixture(), core.PeerIDFixture(), nil))
+}
+
+func TestDisabled(t *testing.T) {
+	require := require.New(t)
+
+	g := NewGenerator(Config{}, clock.New())
+	v := newTestVerifier(t, Config{}, clock.New())
+
+	token, err := g.Generate(_restricted, core.InfoHashFixture(), core.PeerIDFixture())
+	require.NoError(err)
+	require.Nil(token)
+	require.NoError(v.Verify(_restricted, core.InfoHashFixture(), core.PeerIDFixture(), nil))
+}
+
+func TestVerifierAcceptsUnrestrictedNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	v := newTestVerifier(t, testConfig(), clock.New())
+	require.NoError(v.Verify("public/repo", core.InfoHashFixture(), core.PeerIDFixture(), nil))
+}
+
+func TestVerifierRestrictsTorrentsAnnouncedInRestrictedNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	config := testConfig()
+	config.RestrictionTTL = time.Minute
+	g := NewGenerator(config, clk)
+	v := newTestVerifier(t, config, clk)
+
+	h := core.InfoHashFixture()
+	peerID := core.PeerIDFixture()
+
+	token, err := g.Generate(_restricted, h, peerID)
+	require.NoError(err)
+	require.NoError(v.Verify(_restricted, h, peerID, token))
+
+	// Announcing a restricted torrent in an unrestricted namespace requires a
+	// token for that namespace.
+	require.Equal(ErrMissing, v.Verify("public/repo", h, peerID, nil))
+
+	token, err = g.Generate(_restricted, h, peerID)
+	require.NoError(err)
+	require.Equal(ErrInvalidSignature, v.Verify("public/repo", h, peerID, token))
+
+	token, err = g.Generate("public/repo", h, peerID)
+	require.NoError(err)
+	require.NoError(v.Verify("public/repo", h, peerID, token))
+
+	// Restrictions expire once the torrent is no longer announced in
+	// restricted namespaces.
+	clk.Add(2 * time.Minute)
+	require.NoError(v.Verify("public/repo", h, peerID, nil))
+}
+
+func TestVerifierRestrictsTorrentsObservedInRestrictedNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	v := newTestVerifier(t, testConfig(), clock.New())
+
+	h := core.InfoHashFixture()
+
+	v.Observe("public/repo", h)
+	require.False(v.RestrictedTorrent("public/repo", h))
+
+	v.Observe(_restricted, h)
+	require.True(v.RestrictedTorrent("public/repo", h))
+	require.Equal(ErrMissing, v.Verify("public/repo", h, core.PeerIDFixture(), nil))
+}
+
+func TestVerifiersShareStore(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	store := newLocalStore(clk, time.Minute)
+
+	g := NewGenerator(testConfig(), clk)
+	v1, err := NewVerifier(testConfig(), clk, WithStore(store))
+	require.NoError(err)
+	v2, err := NewVerifier(testConfig(), clk, WithStore(store))
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	peerID := core.PeerIDFixture()
+
+	token, err := g.Generate(_restricted, h, peerID)
+	require.NoError(err)
+	require.NoError(v1.Verify(_restricted, h, peerID, token))
+
+	// Tokens cannot be replayed against other trackers, and torrents restricted
+	// by one tracker are restricted on all of them.
+	require.Equal(ErrReplayed, v2.Verify(_restricted, h, peerID, token))
+	require.Equal(ErrMissing, v2.Verify("public/repo", h, peerID, nil))
+
+	// Nor against restarted trackers.
+	v3, err := NewVerifier(testConfig(), clk, WithStore(store))
+	require.NoError(err)
+	require.Equal(ErrReplayed, v3.Verify(_restricted, h, peerID, token))
+	require.True(v3.RestrictedTorrent("public/repo", h))
+}
+
+type failingStore struct {
+	err error
+}
+
+func (s failingStore) UseNonce(string, time.Duration) (bool, error) {
+	return false, s.err
+}
+
+func (s failingStore) RestrictTorrent(core.InfoHash, time.Duration) error {
+	return s.err
+}
+
+func (s failingStore) RestrictedTorrent(core.InfoHash) (bool, error) {
+	return false, s.err
+}
+
+func TestVerifierFallsBackToMemoryWithoutStoreSupport(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	g := NewGenerator(testConfig(), clk)
+	v, err := NewVerifier(testConfig(), clk, WithStore(failingStore{ErrNoStore}))
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	peerID := core.PeerIDFixture()
+
+	require.NoError(v.Verify("public/repo", h, peerID, nil))
+
+	token, err := g.Generate(_restricted, h, peerID)
+	require.NoError(err)
+	require.NoError(v.Verify(_restricted, h, peerID, token))
+	require.Equal(ErrReplayed, v.Verify(_restricted, h, peerID, token))
+	require.Nil(v.getStore())
+}
+
+func TestVerifierRestrictsAllTorrentsOnStoreErrors(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	g := NewGenerator(testConfig(), clk)
+	v, err := NewVerifier(testConfig(), clk, WithStore(failingStore{errors.New("some error")}))
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	peerID := core.PeerIDFixture()
+
+	require.Equal(ErrMissing, v.Verify("public/repo", h, peerID, nil))
+
+	// Nonces are still remembered in memory.
+	token, err := g.Generate("public/repo", h, peerID)
+	require.NoError(err)
+	require.NoError(v.Verify("public/repo", h, peerID, token))
+	require.Equal(ErrReplayed, v.Verify("public/repo", h, peerID, token))
+}
+
+func TestNewVerifierRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		modify func(*Config)
+	}{
+		{"empty secret", func(c *Config) { c.Secret = "" }},
+		{"no namespaces", func(c *Config) { c.Namespaces = nil }},
+		{"invalid namespace", func(c *Config) { c.Namespaces = []string{"("} }},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			config := testConfig()
+			test.modify(&config)
+			_, err := NewVerifier(config, clock.New())
+			require.Error(t, err)
+		})
+	}
+}
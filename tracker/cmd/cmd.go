@@ -14,21 +14,33 @@
 package cmd
 
 import (
+	"crypto/tls"
 	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/tracer"
 	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/lib/watchdog"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/tracker/topology"
+	"github.com/uber/kraken/tracker/trackergrpc"
 	"github.com/uber/kraken/tracker/trackerserver"
+	"github.com/uber/kraken/tracker/udptracker"
 	"github.com/uber/kraken/utils/configutil"
 	"github.com/uber/kraken/utils/log"
 
 	"github.com/andres-erbsen/clock"
+	"github.com/opentracing/opentracing-go"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
@@ -110,18 +122,41 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	stats := overrides.metrics
+	var metricsHandler http.Handler
 	if stats == nil {
-		s, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+		s, closer, h, err := metrics.NewWithHandler(config.Metrics, flags.KrakenCluster)
 		if err != nil {
 			log.Fatalf("Failed to init metrics: %s", err)
 		}
 		stats = s
+		metricsHandler = h
 		defer closer.Close()
 	}
 
 	go metrics.EmitVersion(stats)
 
-	peerStore, err := peerstore.New(config.PeerStore)
+	t, closer, err := tracer.New(config.Tracer, "kraken-tracker", stats)
+	if err != nil {
+		log.Fatalf("Failed to init tracer: %s", err)
+	}
+	defer closer.Close()
+	opentracing.SetGlobalTracer(t)
+
+	if config.Watchdog.Enabled {
+		w, err := watchdog.New(config.Watchdog, stats)
+		if err != nil {
+			log.Fatalf("Error creating watchdog: %s", err)
+		}
+		go w.Run()
+	}
+
+	if config.Debug.Enabled() {
+		go func() {
+			log.Fatal(debugserver.ListenAndServe(config.Debug, config))
+		}()
+	}
+
+	peerStore, err := peerstore.New(config.PeerStore, stats)
 	if err != nil {
 		log.Fatalf("Could not create PeerStore: %s", err)
 	}
@@ -140,7 +175,20 @@ func Run(flags *Flags, opts ...Option) {
 	originStore := originstore.New(
 		config.OriginStore, clock.New(), origins, blobclient.NewProvider(blobclient.WithTLS(tls)))
 
-	policy, err := peerhandoutpolicy.NewPriorityPolicy(stats, config.PeerHandoutPolicy.Priority)
+	var topo *topology.Map
+	if !config.Topology.Empty() {
+		topo, err = topology.New(config.Topology, clock.New())
+		if err != nil {
+			log.Fatalf("Could not load topology: %s", err)
+		}
+		defer topo.Close()
+	}
+
+	policy, err := peerhandoutpolicy.NewPriorityPolicy(
+		stats, config.PeerHandoutPolicy.Priority,
+		peerhandoutpolicy.WithTopology(topo),
+		peerhandoutpolicy.WithCostConfig(config.PeerHandoutPolicy.Cost),
+		peerhandoutpolicy.WithPreferredNetworks(config.TrackerServer.PreferredNetworks))
 	if err != nil {
 		log.Fatalf("Could not load peer handout policy: %s", err)
 	}
@@ -148,11 +196,69 @@ func Run(flags *Flags, opts ...Option) {
 	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
 	originCluster := blobclient.NewClusterClient(r)
 
-	server := trackerserver.New(
-		config.TrackerServer, stats, policy, peerStore, originStore, originCluster)
+	if config.TrackerServer.Freshness.PeerTTL == 0 {
+		config.TrackerServer.Freshness.PeerTTL = config.PeerStore.TTL()
+	}
+
+	var serverOpts []trackerserver.Option
+	if metricsHandler != nil {
+		serverOpts = append(serverOpts, trackerserver.WithMetricsHandler(metricsHandler))
+	}
+	server, err := trackerserver.New(
+		config.TrackerServer, stats, policy, topo, peerStore, originStore, originCluster,
+		serverOpts...)
+	if err != nil {
+		log.Fatalf("Error creating tracker server: %s", err)
+	}
+	go server.WarmUp()
+	go server.Reap()
 	go func() {
 		log.Fatal(server.ListenAndServe())
 	}()
+	if config.UDPTracker.Enabled {
+		backend, err := server.UDPBackend()
+		if err != nil {
+			log.Fatalf("Error creating udp tracker backend: %s", err)
+		}
+		udpServer, err := udptracker.New(config.UDPTracker, stats, backend)
+		if err != nil {
+			log.Fatalf("Error creating udp tracker server: %s", err)
+		}
+		go func() {
+			log.Fatal(udpServer.ListenAndServe())
+		}()
+	}
+	if config.GRPC.Enabled {
+		if config.TrackerServer.Auth.Enabled && config.GRPC.Insecure {
+			// Bearer tokens would be sent in plaintext.
+			log.Fatal("Tracker authentication requires grpc tls, grpc.insecure must not be set")
+		}
+		serverTLS, err := grpcTLS(config)
+		if err != nil {
+			log.Fatalf("Error building server tls config: %s", err)
+		}
+		grpcServer, err := trackergrpc.New(config.GRPC, stats, server.GRPCService(), serverTLS)
+		if err != nil {
+			log.Fatalf("Error creating grpc tracker server: %s", err)
+		}
+		go func() {
+			log.Fatal(grpcServer.ListenAndServe())
+		}()
+	}
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+		<-sigs
+		server.Stop()
+		server.Drain()
+		os.Exit(0)
+	}()
+
+	if config.TrackerServer.TLS.Enabled {
+		// The tracker server terminates TLS itself and is reached directly.
+		log.Info("Tracker server tls enabled, not starting nginx")
+		select {}
+	}
 
 	log.Info("Starting nginx...")
 	log.Fatal(nginx.Run(config.Nginx, map[string]interface{}{
@@ -161,3 +267,12 @@ func Run(flags *Flags, opts ...Option) {
 			config.TrackerServer.Listener.Net, config.TrackerServer.Listener.Addr)},
 		nginx.WithTLS(config.TLS)))
 }
+
+// grpcTLS returns the tls config the grpc server authenticates clients with,
+// or nil if the grpc server is insecure.
+func grpcTLS(config Config) (*tls.Config, error) {
+	if config.GRPC.Insecure {
+		return nil, nil
+	}
+	return config.TLS.BuildServer()
+}
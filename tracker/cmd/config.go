@@ -16,13 +16,19 @@ package cmd
 import (
 	"go.uber.org/zap"
 
+	"github.com/uber/kraken/lib/debugserver"
+	"github.com/uber/kraken/lib/tracer"
 	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/lib/watchdog"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/tracker/topology"
+	"github.com/uber/kraken/tracker/trackergrpc"
 	"github.com/uber/kraken/tracker/trackerserver"
+	"github.com/uber/kraken/tracker/udptracker"
 	"github.com/uber/kraken/utils/httputil"
 )
 
@@ -33,8 +39,14 @@ type Config struct {
 	OriginStore       originstore.Config       `yaml:"originstore"`
 	TrackerServer     trackerserver.Config     `yaml:"trackerserver"`
 	PeerHandoutPolicy peerhandoutpolicy.Config `yaml:"peerhandoutpolicy"`
+	Topology          topology.Config          `yaml:"topology"`
 	Origin            upstream.ActiveConfig    `yaml:"origin"`
 	Metrics           metrics.Config           `yaml:"metrics"`
 	Nginx             nginx.Config             `yaml:"nginx"`
 	TLS               httputil.TLSConfig       `yaml:"tls"`
+	Watchdog          watchdog.Config          `yaml:"watchdog"`
+	Debug             debugserver.Config       `yaml:"debug"`
+	UDPTracker        udptracker.Config        `yaml:"udp_tracker"`
+	GRPC              trackergrpc.Config       `yaml:"grpc"`
+	Tracer            tracer.Config            `yaml:"tracer"`
 }
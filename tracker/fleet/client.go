@@ -0,0 +1,70 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package fleet
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// Client reports agent state to trackers.
+type Client interface {
+	Report(r *Report) error
+}
+
+type client struct {
+	ring hashring.PassiveRing
+	tls  *tls.Config
+}
+
+// NewClient creates a new Client.
+func NewClient(ring hashring.PassiveRing, tls *tls.Config) Client {
+	return &client{ring, tls}
+}
+
+// Report sends r to the tracker which owns r.PeerID, such that each agent
+// consistently reports to the same tracker.
+func (c *client) Report(r *Report) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal report: %s", err)
+	}
+	d, err := core.NewDigester().FromBytes([]byte(r.PeerID.String()))
+	if err != nil {
+		return fmt.Errorf("digest peer id: %s", err)
+	}
+	for _, addr := range c.ring.Locations(d) {
+		_, err = httputil.Post(
+			fmt.Sprintf("http://%s/agents/heartbeat", addr),
+			httputil.SendBody(bytes.NewReader(body)),
+			httputil.SendTimeout(10*time.Second),
+			httputil.SendTLS(c.tls))
+		if err != nil {
+			if httputil.IsNetworkError(err) {
+				c.ring.Failed(addr)
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package fleet
+
+import (
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// Report is the self-reported state of an agent.
+type Report struct {
+	PeerID  core.PeerID `json:"peer_id"`
+	IP      string      `json:"ip"`
+	Zone    string      `json:"zone"`
+	Cluster string      `json:"cluster"`
+	Version string      `json:"version"`
+
+	// Protocol is the newest announce protocol version the agent speaks. Zero
+	// if the agent predates protocol negotiation.
+	Protocol int `json:"protocol,omitempty"`
+
+	// CacheUtilization is the fraction of the cache disk in use.
+	CacheUtilization float64 `json:"cache_utilization"`
+
+	ActiveTorrents int `json:"active_torrents"`
+
+	// DownloadErrors is the number of failed downloads since the agent's
+	// scheduler started.
+	DownloadErrors int64 `json:"download_errors"`
+}
+
+// AgentStatus is the last Report received from an agent.
+type AgentStatus struct {
+	Report
+	LastSeen time.Time `json:"last_seen"`
+
+	// Stale is set if the agent has not reported within the heartbeat TTL.
+	Stale bool `json:"stale"`
+}
+
+// Overview aggregates the state of all agents reporting to a tracker.
+type Overview struct {
+	// Agents are sorted by download errors in descending order, such that
+	// sick agents come first.
+	Agents []AgentStatus `json:"agents"`
+	Total  int           `json:"total"`
+	Stale  int           `json:"stale"`
+
+	// Versions maps each version to the number of agents running it.
+	Versions map[string]int `json:"versions"`
+
+	// Protocols maps each announce protocol version to the number of agents
+	// speaking it, such that operators can tell when it is safe to raise the
+	// tracker's minimum protocol.
+	Protocols map[int]int `json:"protocols"`
+}
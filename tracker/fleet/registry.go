@@ -0,0 +1,108 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package fleet
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+
+	"github.com/uber/kraken/core"
+)
+
+// RegistryConfig defines Registry configuration.
+type RegistryConfig struct {
+	// HeartbeatTTL is the duration after which agents which have not reported
+	// are considered stale.
+	HeartbeatTTL time.Duration `yaml:"heartbeat_ttl"`
+
+	// Retention is the duration after which agents which have not reported are
+	// forgotten.
+	Retention time.Duration `yaml:"retention"`
+}
+
+func (c RegistryConfig) applyDefaults() RegistryConfig {
+	if c.HeartbeatTTL == 0 {
+		c.HeartbeatTTL = 5 * time.Minute
+	}
+	if c.Retention == 0 {
+		c.Retention = time.Hour
+	}
+	return c
+}
+
+// Registry keeps the latest Report of each agent in memory.
+type Registry struct {
+	config RegistryConfig
+	clk    clock.Clock
+
+	mu     sync.Mutex
+	agents map[core.PeerID]*AgentStatus
+}
+
+// NewRegistry creates a new Registry.
+func NewRegistry(config RegistryConfig, clk clock.Clock) *Registry {
+	return &Registry{
+		config: config.applyDefaults(),
+		clk:    clk,
+		agents: make(map[core.PeerID]*AgentStatus),
+	}
+}
+
+// Update records r as the latest report of its agent.
+func (r *Registry) Update(report *Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.agents[report.PeerID] = &AgentStatus{Report: *report, LastSeen: r.clk.Now()}
+}
+
+// Overview returns an aggregate of all agents which have reported within the
+// retention period.
+func (r *Registry) Overview() *Overview {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clk.Now()
+	o := &Overview{
+		Agents:    []AgentStatus{},
+		Versions:  make(map[string]int),
+		Protocols: make(map[int]int),
+	}
+	for id, a := range r.agents {
+		age := now.Sub(a.LastSeen)
+		if age > r.config.Retention {
+			delete(r.agents, id)
+			continue
+		}
+		status := *a
+		status.Stale = age > r.config.HeartbeatTTL
+		if status.Stale {
+			o.Stale++
+		}
+		o.Versions[status.Version]++
+		o.Protocols[status.Protocol]++
+		o.Agents = append(o.Agents, status)
+	}
+	o.Total = len(o.Agents)
+	sort.Slice(o.Agents, func(i, j int) bool {
+		if o.Agents[i].DownloadErrors != o.Agents[j].DownloadErrors {
+			return o.Agents[i].DownloadErrors > o.Agents[j].DownloadErrors
+		}
+		return o.Agents[i].PeerID.LessThan(o.Agents[j].PeerID)
+	})
+	return o
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package fleet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+)
+
+func reportFixture(version string, downloadErrors int64) *Report {
+	return &Report{
+		PeerID:         core.PeerIDFixture(),
+		IP:             "localhost",
+		Version:        version,
+		ActiveTorrents: 1,
+		DownloadErrors: downloadErrors,
+	}
+}
+
+func TestRegistryOverviewSortsByDownloadErrors(t *testing.T) {
+	require := require.New(t)
+
+	r := NewRegistry(RegistryConfig{}, clock.NewMock())
+
+	healthy := reportFixture("v1", 0)
+	sick := reportFixture("v2", 10)
+	sick.Protocol = 2
+	r.Update(healthy)
+	r.Update(sick)
+
+	o := r.Overview()
+	require.Equal(2, o.Total)
+	require.Equal(0, o.Stale)
+	require.Equal(map[string]int{"v1": 1, "v2": 1}, o.Versions)
+	require.Equal(map[int]int{0: 1, 2: 1}, o.Protocols)
+	require.Len(o.Agents, 2)
+	require.Equal(sick.PeerID, o.Agents[0].PeerID)
+	require.Equal(healthy.PeerID, o.Agents[1].PeerID)
+}
+
+func TestRegistryOverviewKeepsLatestReport(t *testing.T) {
+	require := require.New(t)
+
+	r := NewRegistry(RegistryConfig{}, clock.NewMock())
+
+	report := reportFixture("v1", 0)
+	r.Update(report)
+	updated := *report
+	updated.Version = "v2"
+	r.Update(&updated)
+
+	o := r.Overview()
+	require.Equal(1, o.Total)
+	require.Equal(map[string]int{"v2": 1}, o.Versions)
+}
+
+func TestRegistryOverviewMarksStaleAndForgetsExpiredAgents(t *testing.T) {
+	require := require.New(t)
+
+	config := RegistryConfig{
+		HeartbeatTTL: time.Minute,
+		Retention:    time.Hour,
+	}
+	clk := clock.NewMock()
+	r := NewRegistry(config, clk)
+
+	old := reportFixture("v1", 0)
+	r.Update(old)
+
+	clk.Add(2 * time.Minute)
+	fresh := reportFixture("v1", 0)
+	r.Update(fresh)
+
+	o := r.Overview()
+	require.Equal(2, o.Total)
+	require.Equal(1, o.Stale)
+	for _, a := range o.Agents {
+		require.Equal(a.PeerID == old.PeerID, a.Stale)
+	}
+
+	clk.Add(time.Hour - time.Minute)
+
+	o = r.Overview()
+	require.Equal(1, o.Total)
+	require.Equal(fresh.PeerID, o.Agents[0].PeerID)
+	require.True(o.Agents[0].Stale)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package fleet
+
+import (
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+)
+
+// ReporterConfig defines Reporter configuration.
+type ReporterConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (c ReporterConfig) applyDefaults() ReporterConfig {
+	if c.Interval == 0 {
+		c.Interval = time.Minute
+	}
+	return c
+}
+
+// Reporter periodically reports agent state to trackers.
+type Reporter struct {
+	config  ReporterConfig
+	client  Client
+	collect func() (*Report, error)
+}
+
+// NewReporter creates a new Reporter which sends the result of collect on each
+// heartbeat.
+func NewReporter(config ReporterConfig, client Client, collect func() (*Report, error)) *Reporter {
+	return &Reporter{config.applyDefaults(), client, collect}
+}
+
+// Run is a blocking call which reports on every interval. Returns immediately
+// if reporting is disabled.
+func (r *Reporter) Run() {
+	if !r.config.Enabled {
+		return
+	}
+	for {
+		if err := r.report(); err != nil {
+			log.Warnf("Error reporting agent state to tracker: %s", err)
+		}
+		time.Sleep(r.config.Interval)
+	}
+}
+
+func (r *Reporter) report() error {
+	report, err := r.collect()
+	if err != nil {
+		return err
+	}
+	return r.client.Report(report)
+}
@@ -15,6 +15,7 @@ package metainfoclient
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -25,6 +26,7 @@ import (
 	"github.com/cenkalti/backoff"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/auth"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/utils/httputil"
 )
@@ -34,24 +36,66 @@ var (
 	ErrNotFound = errors.New("metainfo not found")
 )
 
+// DistributionHintHeader is the response header trackers attach distribution
+// hints to, as json.
+const DistributionHintHeader = "Kraken-Distribution-Hint"
+
 // Client defines operations on torrent metainfo.
 type Client interface {
 	Download(namespace string, d core.Digest) (*core.MetaInfo, error)
 }
 
+// HintClient is implemented by Clients which also return the distribution
+// hint attached to metainfo, if any.
+type HintClient interface {
+	DownloadWithHint(
+		namespace string, d core.Digest) (*core.MetaInfo, *core.DistributionHint, error)
+}
+
+// BundleClient is implemented by Clients which also look up the bundles of the
+// small blobs of images.
+type BundleClient interface {
+	GetBundle(namespace string, manifest core.Digest) (*core.BundleIndex, error)
+}
+
 type client struct {
-	ring hashring.PassiveRing
-	tls  *tls.Config
+	ring   hashring.PassiveRing
+	tls    *tls.Config
+	bearer string
+}
+
+// Option allows setting optional client parameters.
+type Option func(*client)
+
+// WithBearerToken configures the client to authenticate each request with
+// token, for trackers which require authentication.
+func WithBearerToken(token string) Option {
+	return func(c *client) { c.bearer = token }
 }
 
 // New returns a new Client.
-func New(ring hashring.PassiveRing, tls *tls.Config) Client {
-	return &client{ring, tls}
+func New(ring hashring.PassiveRing, tls *tls.Config, opts ...Option) Client {
+	c := &client{ring: ring, tls: tls}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // Download returns the MetaInfo associated with name. Returns ErrNotFound if
 // no torrent exists under name.
 func (c *client) Download(namespace string, d core.Digest) (*core.MetaInfo, error) {
+	mi, _, err := c.DownloadWithHint(namespace, d)
+	return mi, err
+}
+
+// DownloadWithHint returns the MetaInfo associated with name, and the
+// distribution hint attached to it by the tracker. The hint is nil if the
+// tracker did not attach one. Returns ErrNotFound if no torrent exists under
+// name.
+func (c *client) DownloadWithHint(
+	namespace string, d core.Digest) (*core.MetaInfo, *core.DistributionHint, error) {
+
 	var resp *http.Response
 	var err error
 	for _, addr := range c.ring.Locations(d) {
@@ -68,6 +112,7 @@ func (c *client) Download(namespace string, d core.Digest) (*core.MetaInfo, erro
 				Clock:               backoff.SystemClock,
 			},
 			httputil.SendTimeout(10*time.Second),
+			httputil.SendHeaders(auth.BearerHeader(c.bearer)),
 			httputil.SendTLS(c.tls))
 		if err != nil {
 			if httputil.IsNetworkError(err) {
@@ -75,20 +120,74 @@ func (c *client) Download(namespace string, d core.Digest) (*core.MetaInfo, erro
 				continue
 			}
 			if httputil.IsNotFound(err) {
-				return nil, ErrNotFound
+				return nil, nil, ErrNotFound
 			}
-			return nil, err
+			return nil, nil, err
 		}
 		defer resp.Body.Close()
 		b, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return nil, fmt.Errorf("read body: %s", err)
+			return nil, nil, fmt.Errorf("read body: %s", err)
 		}
 		mi, err := core.DeserializeMetaInfo(b)
 		if err != nil {
-			return nil, fmt.Errorf("deserialize metainfo: %s", err)
+			return nil, nil, fmt.Errorf("deserialize metainfo: %s", err)
+		}
+		return mi, parseHint(resp.Header.Get(DistributionHintHeader)), nil
+	}
+	return nil, nil, err
+}
+
+// GetBundle returns the bundle of the small blobs of the image of manifest.
+// Returns ErrNotFound if the image is not bundled.
+func (c *client) GetBundle(namespace string, manifest core.Digest) (*core.BundleIndex, error) {
+	var resp *http.Response
+	var err error
+	for _, addr := range c.ring.Locations(manifest) {
+		resp, err = httputil.PollAccepted(
+			fmt.Sprintf(
+				"http://%s/namespace/%s/blobs/%s/bundle",
+				addr, url.PathEscape(namespace), manifest),
+			&backoff.ExponentialBackOff{
+				InitialInterval:     time.Second,
+				RandomizationFactor: 0.05,
+				Multiplier:          1.3,
+				MaxInterval:         5 * time.Second,
+				MaxElapsedTime:      5 * time.Minute,
+				Clock:               backoff.SystemClock,
+			},
+			httputil.SendTimeout(10*time.Second),
+			httputil.SendHeaders(auth.BearerHeader(c.bearer)),
+			httputil.SendTLS(c.tls))
+		if err != nil {
+			if httputil.IsNetworkError(err) {
+				c.ring.Failed(addr)
+				continue
+			}
+			if httputil.IsNotFound(err) {
+				return nil, ErrNotFound
+			}
+			return nil, err
 		}
-		return mi, nil
+		defer resp.Body.Close()
+		var index core.BundleIndex
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			return nil, fmt.Errorf("decode bundle index: %s", err)
+		}
+		return &index, nil
 	}
 	return nil, err
 }
+
+// parseHint parses a distribution hint header. Malformed hints are ignored,
+// since hints are advisory.
+func parseHint(s string) *core.DistributionHint {
+	if s == "" {
+		return nil
+	}
+	var hint core.DistributionHint
+	if err := json.Unmarshal([]byte(s), &hint); err != nil {
+		return nil
+	}
+	return &hint
+}
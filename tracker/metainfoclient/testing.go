@@ -23,12 +23,32 @@ import (
 // TestClient is a thread-safe, in-memory client for simulating downloads.
 type TestClient struct {
 	sync.Mutex
-	m map[core.Digest]*core.MetaInfo
+	m       map[core.Digest]*core.MetaInfo
+	hints   map[core.Digest]*core.DistributionHint
+	bundles map[core.Digest]*core.BundleIndex
 }
 
 // NewTestClient returns a new TestClient.
 func NewTestClient() *TestClient {
-	return &TestClient{m: make(map[core.Digest]*core.MetaInfo)}
+	return &TestClient{
+		m:       make(map[core.Digest]*core.MetaInfo),
+		hints:   make(map[core.Digest]*core.DistributionHint),
+		bundles: make(map[core.Digest]*core.BundleIndex),
+	}
+}
+
+// SetHint sets the distribution hint returned alongside the metainfo of d.
+func (c *TestClient) SetHint(d core.Digest, hint *core.DistributionHint) {
+	c.Lock()
+	defer c.Unlock()
+	c.hints[d] = hint
+}
+
+// SetBundle sets the bundle of the image of manifest.
+func (c *TestClient) SetBundle(manifest core.Digest, index *core.BundleIndex) {
+	c.Lock()
+	defer c.Unlock()
+	c.bundles[manifest] = index
 }
 
 // Upload "uploads" metainfo that can then be subsequently downloaded. Upload
@@ -45,11 +65,31 @@ func (c *TestClient) Upload(mi *core.MetaInfo) error {
 
 // Download returns the metainfo for digest. Ignores namespace.
 func (c *TestClient) Download(namespace string, d core.Digest) (*core.MetaInfo, error) {
+	mi, _, err := c.DownloadWithHint(namespace, d)
+	return mi, err
+}
+
+// DownloadWithHint returns the metainfo and distribution hint for digest.
+// Ignores namespace.
+func (c *TestClient) DownloadWithHint(
+	namespace string, d core.Digest) (*core.MetaInfo, *core.DistributionHint, error) {
+
 	c.Lock()
 	defer c.Unlock()
 	mi, ok := c.m[d]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	return mi, c.hints[d], nil
+}
+
+// GetBundle returns the bundle set for manifest. Ignores namespace.
+func (c *TestClient) GetBundle(namespace string, manifest core.Digest) (*core.BundleIndex, error) {
+	c.Lock()
+	defer c.Unlock()
+	index, ok := c.bundles[manifest]
 	if !ok {
 		return nil, ErrNotFound
 	}
-	return mi, nil
+	return index, nil
 }
@@ -0,0 +1,117 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metainfostore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+)
+
+type localEntry struct {
+	mi      *core.MetaInfo
+	expires time.Time
+}
+
+// LocalStore is an in-memory Store.
+type LocalStore struct {
+	config Config
+	clk    clock.Clock
+
+	mu         sync.Mutex
+	lru        *list.List // Of *localEntry, most recently used first.
+	digests    map[core.Digest]*list.Element
+	infoHashes map[core.InfoHash]*list.Element
+}
+
+// NewLocalStore returns a new LocalStore.
+func NewLocalStore(config Config, clk clock.Clock) *LocalStore {
+	return &LocalStore{
+		config:     config.applyDefaults(),
+		clk:        clk,
+		lru:        list.New(),
+		digests:    make(map[core.Digest]*list.Element),
+		infoHashes: make(map[core.InfoHash]*list.Element),
+	}
+}
+
+// Get returns the metainfo of the blob d.
+func (s *LocalStore) Get(d core.Digest) (*core.MetaInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.get(s.digests[d])
+}
+
+// GetByInfoHash returns the metainfo of the torrent h.
+func (s *LocalStore) GetByInfoHash(h core.InfoHash) (*core.MetaInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.get(s.infoHashes[h])
+}
+
+func (s *LocalStore) get(e *list.Element) (*core.MetaInfo, error) {
+	if e == nil {
+		return nil, ErrNotFound
+	}
+	entry := e.Value.(*localEntry)
+	if !s.clk.Now().Before(entry.expires) {
+		s.remove(e)
+		return nil, ErrNotFound
+	}
+	s.lru.MoveToFront(e)
+	return entry.mi, nil
+}
+
+// Put stores mi.
+func (s *LocalStore) Put(mi *core.MetaInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.digests[mi.Digest()]; ok {
+		s.remove(e)
+	}
+	e := s.lru.PushFront(&localEntry{mi, s.clk.Now().Add(s.config.TTL)})
+	s.digests[mi.Digest()] = e
+	s.infoHashes[mi.InfoHash()] = e
+	for s.lru.Len() > s.config.MaxEntries {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+// Delete removes the metainfo of the blob d.
+func (s *LocalStore) Delete(d core.Digest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.digests[d]; ok {
+		s.remove(e)
+	}
+	return nil
+}
+
+func (s *LocalStore) remove(e *list.Element) {
+	mi := e.Value.(*localEntry).mi
+	s.lru.Remove(e)
+	delete(s.digests, mi.Digest())
+	if s.infoHashes[mi.InfoHash()] == e {
+		delete(s.infoHashes, mi.InfoHash())
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metainfostore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStorePutAndGet(t *testing.T) {
+	require := require.New(t)
+
+	s := NewLocalStore(Config{}, clock.NewMock())
+
+	mi := core.MetaInfoFixture()
+
+	_, err := s.Get(mi.Digest())
+	require.Equal(ErrNotFound, err)
+	_, err = s.GetByInfoHash(mi.InfoHash())
+	require.Equal(ErrNotFound, err)
+
+	require.NoError(s.Put(mi))
+
+	result, err := s.Get(mi.Digest())
+	require.NoError(err)
+	require.Equal(mi, result)
+
+	result, err = s.GetByInfoHash(mi.InfoHash())
+	require.NoError(err)
+	require.Equal(mi, result)
+}
+
+func TestLocalStoreDelete(t *testing.T) {
+	require := require.New(t)
+
+	s := NewLocalStore(Config{}, clock.NewMock())
+
+	mi := core.MetaInfoFixture()
+	require.NoError(s.Put(mi))
+	require.NoError(s.Delete(mi.Digest()))
+
+	_, err := s.Get(mi.Digest())
+	require.Equal(ErrNotFound, err)
+	_, err = s.GetByInfoHash(mi.InfoHash())
+	require.Equal(ErrNotFound, err)
+
+	// Deleting missing metainfo is a no-op.
+	require.NoError(s.Delete(mi.Digest()))
+}
+
+func TestLocalStoreExpires(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s := NewLocalStore(Config{TTL: time.Hour}, clk)
+
+	mi := core.MetaInfoFixture()
+	require.NoError(s.Put(mi))
+
+	clk.Add(59 * time.Minute)
+	_, err := s.Get(mi.Digest())
+	require.NoError(err)
+
+	// Writes extend the TTL.
+	require.NoError(s.Put(mi))
+	clk.Add(59 * time.Minute)
+	_, err = s.GetByInfoHash(mi.InfoHash())
+	require.NoError(err)
+
+	clk.Add(time.Minute)
+	_, err = s.Get(mi.Digest())
+	require.Equal(ErrNotFound, err)
+	_, err = s.GetByInfoHash(mi.InfoHash())
+	require.Equal(ErrNotFound, err)
+}
+
+func TestLocalStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	require := require.New(t)
+
+	s := NewLocalStore(Config{MaxEntries: 2}, clock.NewMock())
+
+	mi1 := core.MetaInfoFixture()
+	mi2 := core.MetaInfoFixture()
+	mi3 := core.MetaInfoFixture()
+
+	require.NoError(s.Put(mi1))
+	require.NoError(s.Put(mi2))
+
+	// Marks mi1 as recently used, such that mi2 is evicted.
+	_, err := s.Get(mi1.Digest())
+	require.NoError(err)
+
+	require.NoError(s.Put(mi3))
+
+	_, err = s.Get(mi1.Digest())
+	require.NoError(err)
+	_, err = s.Get(mi2.Digest())
+	require.Equal(ErrNotFound, err)
+	_, err = s.GetByInfoHash(mi2.InfoHash())
+	require.Equal(ErrNotFound, err)
+	_, err = s.Get(mi3.Digest())
+	require.NoError(err)
+}
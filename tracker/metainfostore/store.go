@@ -0,0 +1,72 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metainfostore stores torrent metainfo on trackers, such that peers
+// which only know the name of a blob, or the infohash of its torrent, can
+// fetch its metainfo without trackers asking origins each time.
+package metainfostore
+
+import (
+	"errors"
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// ErrNotFound is returned when no metainfo is stored.
+var ErrNotFound = errors.New("metainfo not found")
+
+// Config defines Store configuration.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is how long metainfo is stored after it was last written.
+	TTL time.Duration `yaml:"ttl"`
+
+	// MaxEntries bounds the number of stored metainfo. The least recently
+	// used metainfo is evicted first.
+	MaxEntries int `yaml:"max_entries"`
+
+	// AllowUploads allows clients to store metainfo, e.g. origins pushing
+	// metainfo as they generate it. Otherwise, only metainfo fetched from
+	// origins is stored.
+	AllowUploads bool `yaml:"allow_uploads"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.TTL == 0 {
+		c.TTL = 24 * time.Hour
+	}
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 100000
+	}
+	return c
+}
+
+// Store stores torrent metainfo, keyed by both blob digest and infohash.
+type Store interface {
+	// Get returns the metainfo of the blob d. Returns ErrNotFound if none is
+	// stored.
+	Get(d core.Digest) (*core.MetaInfo, error)
+
+	// GetByInfoHash returns the metainfo of the torrent h. Returns
+	// ErrNotFound if none is stored.
+	GetByInfoHash(h core.InfoHash) (*core.MetaInfo, error)
+
+	// Put stores mi, replacing any metainfo stored for the same blob.
+	Put(mi *core.MetaInfo) error
+
+	// Delete removes the metainfo of the blob d, if any is stored.
+	Delete(d core.Digest) error
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package multitracker routes the torrents of agents which serve several
+// clusters to the trackers of those clusters, by namespace. Each tracker keeps
+// its own swarms, hash ring, announce tokens and TLS credentials, such that
+// torrents of one cluster are never announced to the trackers of another.
+package multitracker
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// Config defines an additional tracker cluster.
+type Config struct {
+	// Name identifies the tracker cluster in logs.
+	Name string `yaml:"name"`
+
+	// Namespaces are regexes of the namespaces whose torrents are announced to
+	// this tracker cluster.
+	Namespaces []string `yaml:"namespaces"`
+
+	// Tracker configures the hosts of the tracker cluster.
+	Tracker upstream.PassiveHashRingConfig `yaml:"tracker"`
+
+	// AnnounceToken configures the announce tokens the tracker cluster
+	// enforces. Secrets should be supplied via secrets file.
+	AnnounceToken announcetoken.Config `yaml:"announce_token"`
+
+	// BearerToken authenticates requests to the tracker cluster, if it
+	// requires authentication. Should be supplied via secrets file.
+	BearerToken string `yaml:"bearer_token"`
+
+	// TLS optionally overrides the client TLS credentials of the agent, for
+	// tracker clusters which trust a different CA.
+	TLS *httputil.TLSConfig `yaml:"tls"`
+}
+
+// Tracker is a built tracker cluster.
+type Tracker struct {
+	Name          string
+	Ring          hashring.PassiveRing
+	TLS           *tls.Config
+	AnnounceToken announcetoken.Config
+	BearerToken   string
+
+	namespaces []*regexp.Regexp
+}
+
+// Match returns true if torrents of namespace are announced to t.
+func (t Tracker) Match(namespace string) bool {
+	for _, re := range t.namespaces {
+		if re.MatchString(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// Build builds the trackers of configs. Trackers without TLS overrides use
+// defaultTLS.
+func Build(configs []Config, defaultTLS *tls.Config) ([]Tracker, error) {
+	var trackers []Tracker
+	names := make(map[string]bool)
+	for _, c := range configs {
+		if c.Name == "" {
+			return nil, errors.New("tracker name required")
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate tracker %q", c.Name)
+		}
+		names[c.Name] = true
+		if len(c.Namespaces) == 0 {
+			return nil, fmt.Errorf("tracker %q: namespaces required", c.Name)
+		}
+		t := Tracker{
+			Name:          c.Name,
+			TLS:           defaultTLS,
+			AnnounceToken: c.AnnounceToken,
+			BearerToken:   c.BearerToken,
+		}
+		for _, n := range c.Namespaces {
+			re, err := regexp.Compile(n)
+			if err != nil {
+				return nil, fmt.Errorf("tracker %q: invalid namespace %q: %s", c.Name, n, err)
+			}
+			t.namespaces = append(t.namespaces, re)
+		}
+		ring, err := c.Tracker.Build()
+		if err != nil {
+			return nil, fmt.Errorf("tracker %q: build ring: %s", c.Name, err)
+		}
+		t.Ring = ring
+		if c.TLS != nil {
+			t.TLS, err = c.TLS.BuildClient()
+			if err != nil {
+				return nil, fmt.Errorf("tracker %q: build tls: %s", c.Name, err)
+			}
+		}
+		trackers = append(trackers, t)
+	}
+	return trackers, nil
+}
+
+// route returns the index of the first tracker matching namespace, or -1 if
+// no tracker matches.
+func route(trackers []Tracker, namespace string) int {
+	for i, t := range trackers {
+		if t.Match(namespace) {
+			return i
+		}
+	}
+	return -1
+}
+
+type announceRouter struct {
+	trackers []Tracker
+	clients  []announceclient.Client
+	fallback announceclient.Client
+}
+
+// NewAnnounceClient returns an announceclient.Client which announces torrents
+// to the first of trackers matching their namespace, using clients created by
+// newClient. Torrents matching no tracker are announced with fallback.
+func NewAnnounceClient(
+	fallback announceclient.Client,
+	trackers []Tracker,
+	newClient func(Tracker) announceclient.Client) announceclient.Client {
+
+	if len(trackers) == 0 {
+		return fallback
+	}
+	r := &announceRouter{trackers: trackers, fallback: fallback}
+	for _, t := range trackers {
+		r.clients = append(r.clients, newClient(t))
+	}
+	return r
+}
+
+func (r *announceRouter) Announce(
+	namespace string,
+	d core.Digest,
+	h core.InfoHash,
+	complete bool,
+	version int) ([]*core.PeerInfo, time.Duration, error) {
+
+	c := r.fallback
+	if i := route(r.trackers, namespace); i >= 0 {
+		c = r.clients[i]
+	}
+	return c.Announce(namespace, d, h, complete, version)
+}
+
+type metaInfoRouter struct {
+	trackers []Tracker
+	clients  []metainfoclient.Client
+	fallback metainfoclient.Client
+}
+
+// NewMetaInfoClient returns a metainfoclient.Client which downloads metainfo
+// from the first of trackers matching its namespace, using clients created by
+// newClient. Metainfo of namespaces matching no tracker is downloaded with
+// fallback.
+func NewMetaInfoClient(
+	fallback metainfoclient.Client,
+	trackers []Tracker,
+	newClient func(Tracker) metainfoclient.Client) metainfoclient.Client {
+
+	if len(trackers) == 0 {
+		return fallback
+	}
+	r := &metaInfoRouter{trackers: trackers, fallback: fallback}
+	for _, t := range trackers {
+		r.clients = append(r.clients, newClient(t))
+	}
+	return r
+}
+
+func (r *metaInfoRouter) client(namespace string) metainfoclient.Client {
+	if i := route(r.trackers, namespace); i >= 0 {
+		return r.clients[i]
+	}
+	return r.fallback
+}
+
+func (r *metaInfoRouter) Download(namespace string, d core.Digest) (*core.MetaInfo, error) {
+	return r.client(namespace).Download(namespace, d)
+}
+
+// DownloadWithHint forwards distribution hints of clients which return them.
+func (r *metaInfoRouter) DownloadWithHint(
+	namespace string, d core.Digest) (*core.MetaInfo, *core.DistributionHint, error) {
+
+	c := r.client(namespace)
+	if hc, ok := c.(metainfoclient.HintClient); ok {
+		return hc.DownloadWithHint(namespace, d)
+	}
+	mi, err := c.Download(namespace, d)
+	return mi, nil, err
+}
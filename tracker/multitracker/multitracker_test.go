@@ -0,0 +1,161 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package multitracker
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/mocks/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/tracker/metainfoclient"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func trackerConfig(name string, namespaces ...string) Config {
+	return Config{
+		Name:       name,
+		Namespaces: namespaces,
+		Tracker: upstream.PassiveHashRingConfig{
+			Hosts: hostlist.Config{Static: []string{name + ":80"}},
+		},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	require := require.New(t)
+
+	defaultTLS := &tls.Config{}
+
+	c := trackerConfig("b", "^b/")
+	c.AnnounceToken = announcetoken.Config{Enabled: true, Secret: "secret"}
+
+	trackers, err := Build([]Config{trackerConfig("a", "^a/", "^shared/"), c}, defaultTLS)
+	require.NoError(err)
+	require.Len(trackers, 2)
+
+	require.Equal("a", trackers[0].Name)
+	require.True(trackers[0].Match("a/foo"))
+	require.True(trackers[0].Match("shared/foo"))
+	require.False(trackers[0].Match("b/foo"))
+	require.Equal([]string{"a:80"}, trackers[0].Ring.Locations(core.DigestFixture()))
+	require.Equal(defaultTLS, trackers[0].TLS)
+
+	require.True(trackers[1].Match("b/foo"))
+	require.Equal("secret", trackers[1].AnnounceToken.Secret)
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		configs []Config
+	}{
+		{"missing name", []Config{trackerConfig("", "a")}},
+		{"duplicate name", []Config{trackerConfig("a", "a"), trackerConfig("a", "b")}},
+		{"missing namespaces", []Config{trackerConfig("a")}},
+		{"invalid namespace", []Config{trackerConfig("a", "(")}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := Build(test.configs, nil)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestAnnounceClientRoutesByNamespace(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	trackers, err := Build(
+		[]Config{trackerConfig("a", "^a/"), trackerConfig("b", "^b/", "^a/")}, nil)
+	require.NoError(err)
+
+	fallback := mockannounceclient.NewMockClient(ctrl)
+	clients := map[string]*mockannounceclient.MockClient{
+		"a": mockannounceclient.NewMockClient(ctrl),
+		"b": mockannounceclient.NewMockClient(ctrl),
+	}
+	c := NewAnnounceClient(fallback, trackers, func(t Tracker) announceclient.Client {
+		return clients[t.Name]
+	})
+
+	d := core.DigestFixture()
+	h := core.InfoHashFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	// Namespaces matching several trackers are routed to the first.
+	clients["a"].EXPECT().Announce("a/foo", d, h, false, announceclient.V2).Return(peers, time.Second, nil)
+	clients["b"].EXPECT().Announce("b/foo", d, h, true, announceclient.V2).Return(nil, time.Second, nil)
+	fallback.EXPECT().Announce("c/foo", d, h, false, announceclient.V2).Return(nil, time.Duration(0), errors.New("some error"))
+
+	result, _, err := c.Announce("a/foo", d, h, false, announceclient.V2)
+	require.NoError(err)
+	require.Equal(peers, result)
+
+	_, _, err = c.Announce("b/foo", d, h, true, announceclient.V2)
+	require.NoError(err)
+
+	_, _, err = c.Announce("c/foo", d, h, false, announceclient.V2)
+	require.Error(err)
+}
+
+func TestAnnounceClientWithoutTrackersReturnsFallback(t *testing.T) {
+	fallback := announceclient.Disabled()
+	require.Equal(t, fallback, NewAnnounceClient(fallback, nil, nil))
+}
+
+func TestMetaInfoClientRoutesByNamespace(t *testing.T) {
+	require := require.New(t)
+
+	trackers, err := Build([]Config{trackerConfig("a", "^a/")}, nil)
+	require.NoError(err)
+
+	fallback := metainfoclient.NewTestClient()
+	a := metainfoclient.NewTestClient()
+	c := NewMetaInfoClient(fallback, trackers, func(Tracker) metainfoclient.Client { return a })
+
+	mi1 := core.MetaInfoFixture()
+	mi2 := core.MetaInfoFixture()
+	hint := &core.DistributionHint{}
+	require.NoError(a.Upload(mi1))
+	a.SetHint(mi1.Digest(), hint)
+	require.NoError(fallback.Upload(mi2))
+
+	result, err := c.Download("a/foo", mi1.Digest())
+	require.NoError(err)
+	require.Equal(mi1, result)
+
+	_, err = c.Download("a/foo", mi2.Digest())
+	require.Equal(metainfoclient.ErrNotFound, err)
+
+	result, err = c.Download("b/foo", mi2.Digest())
+	require.NoError(err)
+	require.Equal(mi2, result)
+
+	result, resultHint, err := c.(metainfoclient.HintClient).DownloadWithHint("a/foo", mi1.Digest())
+	require.NoError(err)
+	require.Equal(mi1, result)
+	require.Equal(hint, resultHint)
+}
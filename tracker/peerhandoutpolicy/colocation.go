@@ -0,0 +1,190 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// CoLocationConfig defines configuration for spreading leechers which share a
+// host, e.g. replicas of the same service, across different remote peers,
+// such that the host's downlink is not spent fetching the same pieces from the
+// same seeders twice.
+type CoLocationConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is how long a remote peer handed out to a leecher stays claimed for
+	// that leecher's host. Claims are renewed on every announce.
+	TTL time.Duration `yaml:"ttl"`
+
+	// ClaimedPeers is the number of remote peers at the front of each handout
+	// which are claimed for the announcing leecher.
+	ClaimedPeers int `yaml:"claimed_peers"`
+}
+
+func (c CoLocationConfig) applyDefaults() CoLocationConfig {
+	if c.TTL == 0 {
+		c.TTL = 30 * time.Second
+	}
+	if c.ClaimedPeers == 0 {
+		c.ClaimedPeers = 5
+	}
+	return c
+}
+
+type coLocationKey struct {
+	h    core.InfoHash
+	host string
+}
+
+type coLocationClaim struct {
+	leecher core.PeerID
+	expires time.Time
+}
+
+// CoLocationTracker tracks which remote peers were handed out to in-flight
+// leechers of each host.
+type CoLocationTracker struct {
+	config CoLocationConfig
+	clk    clock.Clock
+
+	mu        sync.Mutex
+	claims    map[coLocationKey]map[core.PeerID]coLocationClaim
+	lastSweep time.Time
+}
+
+// NewCoLocationTracker creates a new CoLocationTracker.
+func NewCoLocationTracker(config CoLocationConfig, clk clock.Clock) *CoLocationTracker {
+	return &CoLocationTracker{
+		config:    config.applyDefaults(),
+		clk:       clk,
+		claims:    make(map[coLocationKey]map[core.PeerID]coLocationClaim),
+		lastSweep: clk.Now(),
+	}
+}
+
+// Config returns the configuration of the CoLocationTracker, with defaults applied.
+func (t *CoLocationTracker) Config() CoLocationConfig {
+	return t.config
+}
+
+// peerHost identifies the machine of p.
+func peerHost(p *core.PeerInfo) string {
+	if p.Hostname != "" {
+		return p.Hostname
+	}
+	return p.IP
+}
+
+// Apply orders peers for leecher such that other peers on leecher's host come
+// first, and remote peers claimed by other in-flight leechers on the same
+// host come last. Peers are otherwise kept in order. If record is set, the
+// first unclaimed remote peers are claimed for leecher, otherwise Apply only
+// previews the handout. labels, which annotate peers by index, are reordered
+// alongside peers, and are dropped if they do not annotate every peer. Returns
+// the number of peers moved.
+func (t *CoLocationTracker) Apply(
+	h core.InfoHash,
+	leecher *core.PeerInfo,
+	peers []*core.PeerInfo,
+	labels []string,
+	record bool) ([]*core.PeerInfo, []string, int) {
+
+	local := peerHost(leecher)
+	if local == "" {
+		return peers, labels, 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clk.Now()
+	t.sweep(now)
+
+	key := coLocationKey{h, local}
+	claims := t.claims[key]
+
+	// Siblings on the same host, unclaimed remote peers, and remote peers
+	// claimed by siblings, in that order.
+	var tiers [3][]int
+	for i, p := range peers {
+		if peerHost(p) == local {
+			tiers[0] = append(tiers[0], i)
+			continue
+		}
+		if c, ok := claims[p.PeerID]; ok && c.leecher != leecher.PeerID && now.Before(c.expires) {
+			tiers[2] = append(tiers[2], i)
+			continue
+		}
+		tiers[1] = append(tiers[1], i)
+	}
+
+	if record {
+		if claims == nil {
+			claims = make(map[core.PeerID]coLocationClaim)
+			t.claims[key] = claims
+		}
+		for j, i := range tiers[1] {
+			if j >= t.config.ClaimedPeers {
+				break
+			}
+			claims[peers[i].PeerID] = coLocationClaim{leecher.PeerID, now.Add(t.config.TTL)}
+		}
+	}
+
+	if len(labels) != len(peers) {
+		labels = nil
+	}
+	resultPeers := make([]*core.PeerInfo, 0, len(peers))
+	var resultLabels []string
+	if labels != nil {
+		resultLabels = make([]string, 0, len(labels))
+	}
+	var moved int
+	for _, tier := range tiers {
+		for _, i := range tier {
+			if i != len(resultPeers) {
+				moved++
+			}
+			resultPeers = append(resultPeers, peers[i])
+			if labels != nil {
+				resultLabels = append(resultLabels, labels[i])
+			}
+		}
+	}
+	return resultPeers, resultLabels, moved
+}
+
+// sweep drops expired claims at most once per TTL.
+func (t *CoLocationTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.config.TTL {
+		return
+	}
+	t.lastSweep = now
+	for key, claims := range t.claims {
+		for id, c := range claims {
+			if !now.Before(c.expires) {
+				delete(claims, id)
+			}
+		}
+		if len(claims) == 0 {
+			delete(t.claims, key)
+		}
+	}
+}
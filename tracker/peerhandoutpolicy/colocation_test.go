@@ -0,0 +1,132 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func coLocatedPeerFixture(host string) *core.PeerInfo {
+	p := core.PeerInfoFixture()
+	p.Hostname = host
+	return p
+}
+
+func TestCoLocationTrackerSpreadsCoLocatedLeechers(t *testing.T) {
+	require := require.New(t)
+
+	tracker := NewCoLocationTracker(
+		CoLocationConfig{TTL: time.Minute, ClaimedPeers: 2}, clock.NewMock())
+
+	h := core.InfoHashFixture()
+	l1 := coLocatedPeerFixture("host-a")
+	l2 := coLocatedPeerFixture("host-a")
+	r1 := coLocatedPeerFixture("host-b")
+	r2 := coLocatedPeerFixture("host-c")
+	r3 := coLocatedPeerFixture("host-d")
+
+	peers := []*core.PeerInfo{r1, r2, r3}
+	labels := []string{"r1", "r2", "r3"}
+
+	result, resultLabels, n := tracker.Apply(h, l1, peers, labels, true)
+	require.Equal(0, n)
+	require.Equal(peers, result)
+	require.Equal(labels, resultLabels)
+
+	// The second leecher on host-a is handed the sibling first, and the
+	// seeders claimed by the sibling last.
+	result, resultLabels, n = tracker.Apply(
+		h, l2, []*core.PeerInfo{r1, r2, l1, r3}, []string{"r1", "r2", "l1", "r3"}, true)
+	require.Equal(4, n)
+	require.Equal([]*core.PeerInfo{l1, r3, r1, r2}, result)
+	require.Equal([]string{"l1", "r3", "r1", "r2"}, resultLabels)
+
+	// Leechers are never deprioritized against their own claims.
+	result, _, n = tracker.Apply(h, l1, peers, labels, true)
+	require.Equal(0, n)
+	require.Equal(peers, result)
+}
+
+func TestCoLocationTrackerIgnoresOtherHostsAndTorrents(t *testing.T) {
+	require := require.New(t)
+
+	tracker := NewCoLocationTracker(
+		CoLocationConfig{TTL: time.Minute, ClaimedPeers: 1}, clock.NewMock())
+
+	h := core.InfoHashFixture()
+	r1 := coLocatedPeerFixture("host-b")
+	r2 := coLocatedPeerFixture("host-c")
+	peers := []*core.PeerInfo{r1, r2}
+
+	tracker.Apply(h, coLocatedPeerFixture("host-a"), peers, nil, true)
+
+	result, _, n := tracker.Apply(h, coLocatedPeerFixture("host-z"), peers, nil, true)
+	require.Equal(0, n)
+	require.Equal(peers, result)
+
+	result, _, n = tracker.Apply(
+		core.InfoHashFixture(), coLocatedPeerFixture("host-a"), peers, nil, true)
+	require.Equal(0, n)
+	require.Equal(peers, result)
+}
+
+func TestCoLocationTrackerClaimsExpire(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	tracker := NewCoLocationTracker(
+		CoLocationConfig{TTL: time.Minute, ClaimedPeers: 1}, clk)
+
+	h := core.InfoHashFixture()
+	r1 := coLocatedPeerFixture("host-b")
+	r2 := coLocatedPeerFixture("host-c")
+	peers := []*core.PeerInfo{r1, r2}
+
+	tracker.Apply(h, coLocatedPeerFixture("host-a"), peers, nil, true)
+
+	// Previews do not claim peers.
+	l2 := coLocatedPeerFixture("host-a")
+	result, _, _ := tracker.Apply(h, l2, peers, nil, false)
+	require.Equal([]*core.PeerInfo{r2, r1}, result)
+	result, _, _ = tracker.Apply(h, coLocatedPeerFixture("host-a"), peers, nil, false)
+	require.Equal([]*core.PeerInfo{r2, r1}, result)
+
+	clk.Add(time.Minute)
+
+	result, _, n := tracker.Apply(h, l2, peers, nil, false)
+	require.Equal(0, n)
+	require.Equal(peers, result)
+}
+
+func TestCoLocationTrackerFallsBackToIP(t *testing.T) {
+	require := require.New(t)
+
+	tracker := NewCoLocationTracker(CoLocationConfig{}, clock.NewMock())
+
+	leecher := core.PeerInfoFixture()
+	sibling := core.PeerInfoFixture()
+	sibling.IP = leecher.IP
+	remote := core.PeerInfoFixture()
+
+	result, _, n := tracker.Apply(
+		core.InfoHashFixture(), leecher, []*core.PeerInfo{remote, sibling}, nil, false)
+	require.Equal(2, n)
+	require.Equal([]*core.PeerInfo{sibling, remote}, result)
+}
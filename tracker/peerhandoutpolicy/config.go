@@ -16,4 +16,7 @@ package peerhandoutpolicy
 // Config defines configuration for the peer handout policy.
 type Config struct {
 	Priority string `yaml:"priority"`
+
+	// Cost configures the "cost" priority policy.
+	Cost CostConfig `yaml:"cost"`
 }
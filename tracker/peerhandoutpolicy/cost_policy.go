@@ -0,0 +1,77 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/topology"
+)
+
+const _costPolicy = "cost"
+
+// CostConfig defines the relative cost of transferring data from a peer, used
+// by the cost policy to hand out the cheapest peers first.
+type CostConfig struct {
+	// CrossRack, CrossZone and CrossDC are the costs of downloading from a
+	// peer in a different rack, zone or datacenter than the source.
+	CrossRack int `yaml:"cross_rack"`
+	CrossZone int `yaml:"cross_zone"`
+	CrossDC   int `yaml:"cross_dc"`
+
+	// BandwidthClasses adds a cost per peer bandwidth class, such that peers on
+	// slower links are handed out after faster ones at the same distance.
+	BandwidthClasses map[string]int `yaml:"bandwidth_classes"`
+}
+
+func (c CostConfig) applyDefaults() CostConfig {
+	if c.CrossRack == 0 {
+		c.CrossRack = 1
+	}
+	if c.CrossZone == 0 {
+		c.CrossZone = 10
+	}
+	if c.CrossDC == 0 {
+		c.CrossDC = 100
+	}
+	return c
+}
+
+// costAssignmentPolicy prioritizes peers by the cost of transferring data
+// from them to the source. Labels peers by locality, since costs are
+// unbounded.
+type costAssignmentPolicy struct {
+	topology *topology.Map
+	config   CostConfig
+}
+
+func newCostAssignmentPolicy(t *topology.Map, config CostConfig) assignmentPolicy {
+	return &costAssignmentPolicy{t, config.applyDefaults()}
+}
+
+func (p *costAssignmentPolicy) assignPriority(source, peer *core.PeerInfo) (int, string) {
+	l := p.topology.Locate(peer)
+	tier := localityTier(p.topology.Locate(source), l)
+
+	var cost int
+	switch tier {
+	case _sameZone:
+		cost = p.config.CrossRack
+	case _sameDC:
+		cost = p.config.CrossZone
+	case _remote:
+		cost = p.config.CrossDC
+	}
+	cost += p.config.BandwidthClasses[l.BandwidthClass]
+	return cost, _localityLabels[tier]
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestCostPriorityPolicy(t *testing.T) {
+	require := require.New(t)
+
+	policy, err := NewPriorityPolicy(
+		tally.NoopScope, _costPolicy,
+		WithTopology(topologyFixture()),
+		WithCostConfig(CostConfig{
+			CrossDC:          20,
+			BandwidthClasses: map[string]int{"1g": 15},
+		}))
+	require.NoError(err)
+
+	other := peerOnHost("other-peer")
+	slow := peerOnHost("dc-peer")
+	fast := peerOnHost("dc-peer-2")
+	rack := peerOnHost("rack-peer")
+
+	// The cross-zone peer on a slow link costs more than the cross-dc peer.
+	peers := policy.SortPeers(peerOnHost("source"), []*core.PeerInfo{slow, other, fast, rack})
+	require.Equal([]*core.PeerInfo{rack, fast, other, slow}, peers)
+}
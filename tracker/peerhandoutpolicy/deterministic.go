@@ -0,0 +1,50 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/uber/kraken/core"
+)
+
+// DeterministicConfig defines configuration for deterministic handouts, which
+// produce identical peer lists for identical inputs. Should only be used for
+// testing and debugging.
+type DeterministicConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Seed is mixed into the per-request seed. Changing it changes all
+	// handouts while preserving determinism.
+	Seed int64 `yaml:"seed"`
+}
+
+// HandoutSeed returns the seed used for shuffling the handout of h to the
+// requesting peer.
+func HandoutSeed(base int64, h core.InfoHash, peerID core.PeerID) int64 {
+	f := fnv.New64a()
+	f.Write(h.Bytes())
+	f.Write(peerID[:])
+	return base ^ int64(f.Sum64())
+}
+
+// DeterministicShuffle orders peers by peer id, then shuffles them using seed,
+// such that the result only depends on the set of peers and seed.
+func DeterministicShuffle(peers []*core.PeerInfo, seed int64) []*core.PeerInfo {
+	result := core.SortedByPeerID(peers)
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(result), func(i, j int) { result[i], result[j] = result[j], result[i] })
+	return result
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestDeterministicShuffleIgnoresInputOrder(t *testing.T) {
+	require := require.New(t)
+
+	policy, err := NewPriorityPolicy(tally.NoopScope, _completenessPolicy)
+	require.NoError(err)
+
+	peers := make([]*core.PeerInfo, 50)
+	for i := range peers {
+		peers[i] = core.PeerInfoFixture()
+		peers[i].Complete = i%3 == 0
+	}
+	source := core.PeerInfoFixture()
+	seed := HandoutSeed(0, core.InfoHashFixture(), source.PeerID)
+
+	var prev []*core.PeerInfo
+	for i := 0; i < 10; i++ {
+		shuffled := make([]*core.PeerInfo, len(peers))
+		copy(shuffled, peers)
+		rand.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		result := policy.SortPeers(source, DeterministicShuffle(shuffled, seed))
+		if prev != nil {
+			require.Equal(prev, result)
+		}
+		prev = result
+	}
+}
+
+func TestHandoutSeedDiffersPerRequest(t *testing.T) {
+	require := require.New(t)
+
+	h := core.InfoHashFixture()
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	require.Equal(HandoutSeed(0, h, p1), HandoutSeed(0, h, p1))
+	require.NotEqual(HandoutSeed(0, h, p1), HandoutSeed(0, h, p2))
+	require.NotEqual(HandoutSeed(0, h, p1), HandoutSeed(1, h, p1))
+}
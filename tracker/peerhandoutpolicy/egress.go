@@ -0,0 +1,176 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/topology"
+	"github.com/uber/kraken/utils/log"
+)
+
+// EgressConfig defines configuration for avoiding paid transfers, such as
+// cross-AZ and cross-region egress in cloud deployments. Zones and
+// datacenters are resolved through the tracker topology, where a datacenter
+// corresponds to a cloud region and a zone to an availability zone.
+type EgressConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MinLocalSeeders is the number of seeders in the zone of the announcing
+	// peer at which paid sources, including origins, are withheld from its
+	// handouts. Below it, paid sources are handed out after free ones.
+	MinLocalSeeders int `yaml:"min_local_seeders"`
+
+	// Weights is the relative cost of each kind of paid transfer.
+	Weights EgressWeights `yaml:"weights"`
+
+	// Namespaces overrides Weights for namespaces matching a regex. The first
+	// match wins.
+	Namespaces []NamespaceEgressWeights `yaml:"namespaces"`
+}
+
+// EgressWeights defines the relative cost of downloading from a peer. Zero
+// weights make the transfer free.
+type EgressWeights struct {
+	CrossZone float64 `yaml:"cross_zone"`
+	CrossDC   float64 `yaml:"cross_dc"`
+
+	// Origin is added to the cost of origins, which pull blobs from the
+	// storage backend.
+	Origin float64 `yaml:"origin"`
+}
+
+// NamespaceEgressWeights overrides egress weights for namespaces matching the
+// Namespace regex.
+type NamespaceEgressWeights struct {
+	Namespace string        `yaml:"namespace"`
+	Weights   EgressWeights `yaml:"weights"`
+}
+
+func (c EgressConfig) applyDefaults() EgressConfig {
+	if c.MinLocalSeeders == 0 {
+		c.MinLocalSeeders = 3
+	}
+	if c.Weights == (EgressWeights{}) {
+		c.Weights = EgressWeights{CrossZone: 1, CrossDC: 10, Origin: 5}
+	}
+	return c
+}
+
+type namespaceEgressWeights struct {
+	regexp  *regexp.Regexp
+	weights EgressWeights
+}
+
+// EgressPolicy orders and trims handouts to minimize paid transfers.
+type EgressPolicy struct {
+	config     EgressConfig
+	topology   *topology.Map
+	namespaces []namespaceEgressWeights
+}
+
+// NewEgressPolicy creates a new EgressPolicy which locates peers using t. t may
+// be nil, in which case only the zones peers announce are known.
+func NewEgressPolicy(config EgressConfig, t *topology.Map) *EgressPolicy {
+	config = config.applyDefaults()
+	p := &EgressPolicy{
+		config:   config,
+		topology: t,
+	}
+	for _, n := range config.Namespaces {
+		re, err := regexp.Compile(n.Namespace)
+		if err != nil {
+			log.Errorf("Ignoring egress weights of invalid namespace %q: %s", n.Namespace, err)
+			continue
+		}
+		p.namespaces = append(p.namespaces, namespaceEgressWeights{re, n.Weights})
+	}
+	return p
+}
+
+// Config returns the configuration of the EgressPolicy, with defaults applied.
+func (p *EgressPolicy) Config() EgressConfig {
+	return p.config
+}
+
+func (p *EgressPolicy) weights(namespace string) EgressWeights {
+	w, _ := p.Weights(namespace)
+	return w
+}
+
+// Weights returns the egress weights applied to handouts of namespace, and the
+// regex of the namespace override they were taken from, which is empty if the
+// default weights apply.
+func (p *EgressPolicy) Weights(namespace string) (EgressWeights, string) {
+	for _, n := range p.namespaces {
+		if n.regexp.MatchString(namespace) {
+			return n.weights, n.regexp.String()
+		}
+	}
+	return p.config.Weights, ""
+}
+
+func (p *EgressPolicy) cost(w EgressWeights, source topology.Location, peer *core.PeerInfo) float64 {
+	var cost float64
+	switch localityTier(source, p.topology.Locate(peer)) {
+	case _sameDC:
+		cost = w.CrossZone
+	case _remote:
+		cost = w.CrossDC
+	}
+	if peer.Origin {
+		cost += w.Origin
+	}
+	return cost
+}
+
+// Apply orders peers by the cost of downloading from them to source within
+// namespace, cheapest first. If enough free seeders are available, peers which
+// cost anything are withheld. labels, which annotate peers by index, are
+// reordered alongside peers. Returns the number of peers withheld.
+func (p *EgressPolicy) Apply(
+	namespace string,
+	source *core.PeerInfo,
+	peers []*core.PeerInfo,
+	labels []string) ([]*core.PeerInfo, []string, int) {
+
+	w := p.weights(namespace)
+	loc := p.topology.Locate(source)
+
+	costs := make([]float64, len(peers))
+	order := make([]int, len(peers))
+	var localSeeders int
+	for i, peer := range peers {
+		costs[i] = p.cost(w, loc, peer)
+		order[i] = i
+		if costs[i] == 0 && peer.Complete && !peer.Origin {
+			localSeeders++
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return costs[order[i]] < costs[order[j]] })
+
+	withhold := localSeeders >= p.config.MinLocalSeeders
+	resultPeers := make([]*core.PeerInfo, 0, len(peers))
+	resultLabels := make([]string, 0, len(labels))
+	for _, i := range order {
+		if withhold && costs[i] > 0 {
+			continue
+		}
+		resultPeers = append(resultPeers, peers[i])
+		resultLabels = append(resultLabels, labels[i])
+	}
+	return resultPeers, resultLabels, len(peers) - len(resultPeers)
+}
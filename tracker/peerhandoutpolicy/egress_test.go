@@ -0,0 +1,107 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func zonePeer(zone string, complete bool) *core.PeerInfo {
+	p := core.PeerInfoFixture()
+	p.Zone = zone
+	p.Complete = complete
+	return p
+}
+
+func labelsFor(peers []*core.PeerInfo) []string {
+	labels := make([]string, len(peers))
+	for i, p := range peers {
+		labels[i] = p.PeerID.String()
+	}
+	return labels
+}
+
+func TestEgressPolicyWithholdsPaidPeersWhenLocalSeedersSuffice(t *testing.T) {
+	require := require.New(t)
+
+	policy := NewEgressPolicy(EgressConfig{MinLocalSeeders: 2}, nil)
+
+	remote := zonePeer("z2", true)
+	origin := zonePeer("z1", true)
+	origin.Origin = true
+	local1 := zonePeer("z1", true)
+	local2 := zonePeer("z1", true)
+	leecher := zonePeer("z1", false)
+
+	peers := []*core.PeerInfo{remote, origin, local1, leecher, local2}
+	result, labels, withheld := policy.Apply(
+		core.NamespaceFixture(), zonePeer("z1", false), peers, labelsFor(peers))
+	require.Equal([]*core.PeerInfo{local1, leecher, local2}, result)
+	require.Equal(labelsFor(result), labels)
+	require.Equal(2, withheld)
+}
+
+func TestEgressPolicyOrdersPaidPeersWhenLocalSeedersInsufficient(t *testing.T) {
+	require := require.New(t)
+
+	policy := NewEgressPolicy(EgressConfig{
+		MinLocalSeeders: 2,
+		Weights:         EgressWeights{CrossDC: 10, Origin: 5},
+	}, topologyFixture())
+
+	// other-peer is in another datacenter, and origins in the same zone cost
+	// less than it.
+	remote := peerOnHost("other-peer")
+	remote.Complete = true
+	origin := peerOnHost("rack-peer")
+	origin.Origin = true
+	local := peerOnHost("zone-peer")
+	local.Complete = true
+
+	peers := []*core.PeerInfo{remote, origin, local}
+	result, _, withheld := policy.Apply(
+		core.NamespaceFixture(), peerOnHost("source"), peers, labelsFor(peers))
+	require.Equal([]*core.PeerInfo{local, origin, remote}, result)
+	require.Equal(0, withheld)
+}
+
+func TestEgressPolicyNamespaceWeights(t *testing.T) {
+	require := require.New(t)
+
+	policy := NewEgressPolicy(EgressConfig{
+		MinLocalSeeders: 1,
+		Namespaces: []NamespaceEgressWeights{{
+			Namespace: "^free/.*",
+			Weights:   EgressWeights{},
+		}},
+	}, nil)
+
+	source := zonePeer("z1", false)
+	remote := zonePeer("z2", true)
+	local := zonePeer("z1", true)
+	peers := []*core.PeerInfo{remote, local}
+
+	// Transfers are free within the namespace, so nothing is withheld.
+	result, _, withheld := policy.Apply("free/repo", source, peers, labelsFor(peers))
+	require.Equal([]*core.PeerInfo{remote, local}, result)
+	require.Equal(0, withheld)
+
+	result, _, withheld = policy.Apply("paid/repo", source, peers, labelsFor(peers))
+	require.Equal([]*core.PeerInfo{local}, result)
+	require.Equal(1, withheld)
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// FreshnessConfig defines configuration for withholding peers which have not
+// announced recently. Such peers have likely left the swarm, but are handed out
+// until their records expire from the peer store. Requires a peer store which
+// tracks last seen times, i.e. with track_last_seen enabled.
+type FreshnessConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// PeerTTL is how long the peer store keeps peers after their last
+	// announce. Defaults to the TTL of the configured peer store.
+	PeerTTL time.Duration `yaml:"peer_ttl"`
+
+	// StaleRatio is the fraction of PeerTTL after which peers which have not
+	// announced are stale.
+	StaleRatio float64 `yaml:"stale_ratio"`
+
+	// Deprioritize moves stale peers to the end of handouts instead of
+	// withholding them, such that they are only handed out if too few fresh
+	// peers are available.
+	Deprioritize bool `yaml:"deprioritize"`
+}
+
+func (c FreshnessConfig) applyDefaults() FreshnessConfig {
+	if c.PeerTTL == 0 {
+		c.PeerTTL = 5 * time.Hour
+	}
+	if c.StaleRatio <= 0 || c.StaleRatio > 1 {
+		c.StaleRatio = 0.5
+	}
+	return c
+}
+
+// FreshnessPolicy withholds or deprioritizes peers whose last announce is older
+// than a fraction of the peer TTL. Peers without a last seen time, e.g. origins,
+// are always fresh.
+type FreshnessPolicy struct {
+	config FreshnessConfig
+	clk    clock.Clock
+}
+
+// NewFreshnessPolicy creates a new FreshnessPolicy.
+func NewFreshnessPolicy(config FreshnessConfig, clk clock.Clock) *FreshnessPolicy {
+	return &FreshnessPolicy{config.applyDefaults(), clk}
+}
+
+// Config returns the configuration of the FreshnessPolicy, with defaults
+// applied.
+func (p *FreshnessPolicy) Config() FreshnessConfig {
+	return p.config
+}
+
+// MaxAge returns how long after their last announce peers become stale.
+func (p *FreshnessPolicy) MaxAge() time.Duration {
+	return time.Duration(float64(p.config.PeerTTL) * p.config.StaleRatio)
+}
+
+// Apply withholds stale peers, or moves them to the end of peers if configured
+// to deprioritize them, preserving relative order otherwise. labels, which
+// annotate peers by index, are filtered alongside peers. Returns the number of
+// stale peers.
+func (p *FreshnessPolicy) Apply(
+	peers []*core.PeerInfo, labels []string) ([]*core.PeerInfo, []string, int) {
+
+	cutoff := p.clk.Now().Add(-p.MaxAge())
+	var (
+		fresh, stale             []*core.PeerInfo
+		freshLabels, staleLabels []string
+	)
+	for i, peer := range peers {
+		if !peer.LastSeen.IsZero() && peer.LastSeen.Before(cutoff) {
+			stale = append(stale, peer)
+			staleLabels = append(staleLabels, labels[i])
+		} else {
+			fresh = append(fresh, peer)
+			freshLabels = append(freshLabels, labels[i])
+		}
+	}
+	if p.config.Deprioritize {
+		return append(fresh, stale...), append(freshLabels, staleLabels...), len(stale)
+	}
+	return fresh, freshLabels, len(stale)
+}
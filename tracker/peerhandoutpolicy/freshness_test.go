@@ -0,0 +1,81 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func freshnessPeersFixture(clk clock.Clock) ([]*core.PeerInfo, []string) {
+	peers := []*core.PeerInfo{
+		core.PeerInfoFixture(),
+		core.PeerInfoFixture(),
+		core.PeerInfoFixture(),
+		core.OriginPeerInfoFixture(),
+	}
+	peers[0].LastSeen = clk.Now().Add(-150 * time.Minute)
+	peers[1].LastSeen = clk.Now().Add(-time.Minute)
+	peers[2].LastSeen = clk.Now().Add(-3 * time.Hour)
+	// Origins have no last seen time.
+	return peers, []string{"a", "b", "c", "d"}
+}
+
+func TestFreshnessPolicyWithholdsStalePeers(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Date(2019, time.November, 1, 12, 0, 0, 0, time.UTC))
+	policy := NewFreshnessPolicy(FreshnessConfig{PeerTTL: 4 * time.Hour, StaleRatio: 0.5}, clk)
+	require.Equal(2*time.Hour, policy.MaxAge())
+
+	peers, labels := freshnessPeersFixture(clk)
+
+	result, resultLabels, n := policy.Apply(peers, labels)
+	require.Equal(2, n)
+	require.Equal([]*core.PeerInfo{peers[1], peers[3]}, result)
+	require.Equal([]string{"b", "d"}, resultLabels)
+}
+
+func TestFreshnessPolicyDeprioritizesStalePeers(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Date(2019, time.November, 1, 12, 0, 0, 0, time.UTC))
+	policy := NewFreshnessPolicy(FreshnessConfig{
+		PeerTTL:      4 * time.Hour,
+		StaleRatio:   0.5,
+		Deprioritize: true,
+	}, clk)
+
+	peers, labels := freshnessPeersFixture(clk)
+
+	result, resultLabels, n := policy.Apply(peers, labels)
+	require.Equal(2, n)
+	require.Equal([]*core.PeerInfo{peers[1], peers[3], peers[0], peers[2]}, result)
+	require.Equal([]string{"b", "d", "a", "c"}, resultLabels)
+}
+
+func TestFreshnessPolicyDefaults(t *testing.T) {
+	require := require.New(t)
+
+	policy := NewFreshnessPolicy(FreshnessConfig{StaleRatio: 2}, clock.NewMock())
+	require.Equal(5*time.Hour, policy.Config().PeerTTL)
+	require.Equal(0.5, policy.Config().StaleRatio)
+}
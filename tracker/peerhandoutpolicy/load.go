@@ -0,0 +1,142 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// LoadAwareConfig defines configuration for deprioritizing peers which
+// advertise high load in their announces.
+type LoadAwareConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Threshold is the load, in [0, 1], above which a peer is moved to the end
+	// of handouts.
+	Threshold float64 `yaml:"threshold"`
+
+	// HalfLife is how quickly advertised load decays when a peer stops
+	// reporting it, such that temporarily busy peers return to rotation.
+	HalfLife time.Duration `yaml:"half_life"`
+}
+
+func (c LoadAwareConfig) applyDefaults() LoadAwareConfig {
+	if c.Threshold == 0 {
+		c.Threshold = 0.8
+	}
+	if c.HalfLife == 0 {
+		c.HalfLife = 30 * time.Second
+	}
+	return c
+}
+
+// _negligibleLoad is the decayed load below which records are discarded.
+const _negligibleLoad = 0.01
+
+type loadRecord struct {
+	load    float64
+	updated time.Time
+}
+
+// LoadTracker remembers the most recent load advertised by each peer.
+type LoadTracker struct {
+	config LoadAwareConfig
+	clk    clock.Clock
+
+	mu        sync.Mutex
+	loads     map[core.PeerID]loadRecord
+	lastSweep time.Time
+}
+
+// NewLoadTracker creates a new LoadTracker.
+func NewLoadTracker(config LoadAwareConfig, clk clock.Clock) *LoadTracker {
+	return &LoadTracker{
+		config:    config.applyDefaults(),
+		clk:       clk,
+		loads:     make(map[core.PeerID]loadRecord),
+		lastSweep: clk.Now(),
+	}
+}
+
+// Config returns the configuration of the LoadTracker, with defaults applied.
+func (t *LoadTracker) Config() LoadAwareConfig {
+	return t.config
+}
+
+// Update records load as the current load of peerID.
+func (t *LoadTracker) Update(peerID core.PeerID, load float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clk.Now()
+	t.loads[peerID] = loadRecord{load, now}
+
+	// Periodically discard peers whose load has decayed away, so peers which
+	// leave the cluster are not remembered forever.
+	if now.Sub(t.lastSweep) >= t.config.HalfLife {
+		for id, r := range t.loads {
+			if t.decay(r, now) < _negligibleLoad {
+				delete(t.loads, id)
+			}
+		}
+		t.lastSweep = now
+	}
+}
+
+// Load returns the decayed load of peerID. Peers which never advertised load
+// have zero load.
+func (t *LoadTracker) Load(peerID core.PeerID) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.loads[peerID]
+	if !ok {
+		return 0
+	}
+	return t.decay(r, t.clk.Now())
+}
+
+func (t *LoadTracker) decay(r loadRecord, now time.Time) float64 {
+	halves := float64(now.Sub(r.updated)) / float64(t.config.HalfLife)
+	return r.load * math.Pow(0.5, halves)
+}
+
+// Deprioritize moves peers whose load exceeds the configured threshold to the
+// end of peers, preserving relative order otherwise. labels, which annotate
+// peers by index, are reordered alongside peers. Returns the number of peers
+// deprioritized.
+func (t *LoadTracker) Deprioritize(
+	peers []*core.PeerInfo, labels []string) ([]*core.PeerInfo, []string, int) {
+
+	var (
+		idle, busy             []*core.PeerInfo
+		idleLabels, busyLabels []string
+	)
+	for i, p := range peers {
+		if t.Load(p.PeerID) > t.config.Threshold {
+			busy = append(busy, p)
+			busyLabels = append(busyLabels, labels[i])
+		} else {
+			idle = append(idle, p)
+			idleLabels = append(idleLabels, labels[i])
+		}
+	}
+	return append(idle, busy...), append(idleLabels, busyLabels...), len(busy)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTrackerDecaysLoad(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	tracker := NewLoadTracker(LoadAwareConfig{HalfLife: time.Minute}, clk)
+
+	p := core.PeerIDFixture()
+	require.Equal(0.0, tracker.Load(p))
+
+	tracker.Update(p, 1)
+	require.Equal(1.0, tracker.Load(p))
+
+	clk.Add(time.Minute)
+	require.InDelta(0.5, tracker.Load(p), 0.0001)
+
+	clk.Add(time.Minute)
+	require.InDelta(0.25, tracker.Load(p), 0.0001)
+}
+
+func TestLoadTrackerDeprioritizesOverloadedPeers(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	tracker := NewLoadTracker(LoadAwareConfig{Threshold: 0.8, HalfLife: time.Minute}, clk)
+
+	peers := []*core.PeerInfo{
+		core.PeerInfoFixture(),
+		core.PeerInfoFixture(),
+		core.PeerInfoFixture(),
+		core.PeerInfoFixture(),
+	}
+	labels := []string{"a", "b", "c", "d"}
+
+	tracker.Update(peers[0].PeerID, 0.95)
+	tracker.Update(peers[1].PeerID, 0.5)
+	tracker.Update(peers[2].PeerID, 0.9)
+
+	result, resultLabels, n := tracker.Deprioritize(peers, labels)
+	require.Equal(2, n)
+	require.Equal([]*core.PeerInfo{peers[1], peers[3], peers[0], peers[2]}, result)
+	require.Equal([]string{"b", "d", "a", "c"}, resultLabels)
+
+	// Once load decays below the threshold, peers return to their original
+	// position.
+	clk.Add(time.Minute)
+
+	result, resultLabels, n = tracker.Deprioritize(peers, labels)
+	require.Equal(0, n)
+	require.Equal(peers, result)
+	require.Equal(labels, resultLabels)
+}
+
+func TestLoadTrackerDiscardsDecayedPeers(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	tracker := NewLoadTracker(LoadAwareConfig{HalfLife: time.Minute}, clk)
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	tracker.Update(p1, 1)
+	clk.Add(10 * time.Minute)
+	tracker.Update(p2, 1)
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	require.NotContains(tracker.loads, p1)
+	require.Contains(tracker.loads, p2)
+}
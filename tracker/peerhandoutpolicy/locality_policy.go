@@ -0,0 +1,61 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/topology"
+)
+
+const _localityPolicy = "locality"
+
+// Locality tiers, from nearest to farthest.
+const (
+	_sameRack = iota
+	_sameZone
+	_sameDC
+	_remote
+)
+
+var _localityLabels = []string{"same_rack", "same_zone", "same_dc", "remote"}
+
+// localityTier returns how close the peer at l is to the source at source.
+// Unknown locations are always remote.
+func localityTier(source, l topology.Location) int {
+	switch {
+	case l.Rack != "" && l.Rack == source.Rack && l.DC == source.DC && l.Zone == source.Zone:
+		return _sameRack
+	case l.Zone != "" && l.Zone == source.Zone:
+		return _sameZone
+	case l.DC != "" && l.DC == source.DC:
+		return _sameDC
+	default:
+		return _remote
+	}
+}
+
+// localityAssignmentPolicy prioritizes peers nearest to the source: same
+// rack, then same zone, then same datacenter, then everything else.
+type localityAssignmentPolicy struct {
+	topology *topology.Map
+}
+
+func newLocalityAssignmentPolicy(t *topology.Map) assignmentPolicy {
+	return &localityAssignmentPolicy{t}
+}
+
+func (p *localityAssignmentPolicy) assignPriority(source, peer *core.PeerInfo) (int, string) {
+	tier := localityTier(p.topology.Locate(source), p.topology.Locate(peer))
+	return tier, _localityLabels[tier]
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/topology"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func topologyFixture() *topology.Map {
+	m, err := topology.New(topology.Config{
+		Hosts: map[string]topology.Location{
+			"source":     {Rack: "r1", Zone: "z1", DC: "dc1"},
+			"rack-peer":  {Rack: "r1", Zone: "z1", DC: "dc1"},
+			"zone-peer":  {Rack: "r2", Zone: "z1", DC: "dc1"},
+			"dc-peer":    {Rack: "r3", Zone: "z2", DC: "dc1", BandwidthClass: "1g"},
+			"dc-peer-2":  {Rack: "r4", Zone: "z2", DC: "dc1", BandwidthClass: "10g"},
+			"other-peer": {Rack: "r1", Zone: "z3", DC: "dc2"},
+		},
+	}, clock.New())
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func peerOnHost(hostname string) *core.PeerInfo {
+	p := core.PeerInfoFixture()
+	p.Hostname = hostname
+	return p
+}
+
+func TestLocalityPriorityPolicy(t *testing.T) {
+	require := require.New(t)
+
+	policy, err := NewPriorityPolicy(
+		tally.NoopScope, _localityPolicy, WithTopology(topologyFixture()))
+	require.NoError(err)
+
+	other := peerOnHost("other-peer")
+	dc := peerOnHost("dc-peer")
+	zone := peerOnHost("zone-peer")
+	rack := peerOnHost("rack-peer")
+
+	peers, labels := policy.SortPeersWithLabels(
+		peerOnHost("source"), []*core.PeerInfo{other, dc, zone, rack})
+	require.Equal([]*core.PeerInfo{rack, zone, dc, other}, peers)
+	require.Equal([]string{"same_rack", "same_zone", "same_dc", "remote"}, labels)
+}
+
+func TestLocalityPriorityPolicyFallsBackToAnnouncedZone(t *testing.T) {
+	require := require.New(t)
+
+	policy, err := NewPriorityPolicy(tally.NoopScope, _localityPolicy)
+	require.NoError(err)
+
+	source := core.PeerInfoFixture()
+	source.Zone = "z1"
+	remote := core.PeerInfoFixture()
+	remote.Zone = "z2"
+	local := core.PeerInfoFixture()
+	local.Zone = "z1"
+
+	peers, labels := policy.SortPeersWithLabels(source, []*core.PeerInfo{remote, local})
+	require.Equal([]*core.PeerInfo{local, remote}, peers)
+	require.Equal([]string{"same_zone", "remote"}, labels)
+}
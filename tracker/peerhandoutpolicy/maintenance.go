@@ -0,0 +1,158 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// MaintenanceConfig defines configuration for withholding hosts under
+// maintenance from handouts.
+type MaintenanceConfig struct {
+	// MaxDuration caps the maintenance window of each host, such that hosts
+	// which operators forget about return to rotation.
+	MaxDuration time.Duration `yaml:"max_duration"`
+}
+
+func (c MaintenanceConfig) applyDefaults() MaintenanceConfig {
+	if c.MaxDuration == 0 {
+		c.MaxDuration = 24 * time.Hour
+	}
+	return c
+}
+
+// MaintenanceList tracks hosts under maintenance, e.g. awaiting a reboot. Peers
+// on such hosts are withheld from handouts until their window ends, such that
+// other peers do not start transfers from them which would fail midway. Peers
+// under maintenance still receive handouts, so their own downloads complete.
+type MaintenanceList struct {
+	config MaintenanceConfig
+	clk    clock.Clock
+
+	mu    sync.Mutex
+	hosts map[string]time.Time
+}
+
+// NewMaintenanceList creates a new MaintenanceList.
+func NewMaintenanceList(config MaintenanceConfig, clk clock.Clock) *MaintenanceList {
+	return &MaintenanceList{
+		config: config.applyDefaults(),
+		clk:    clk,
+		hosts:  make(map[string]time.Time),
+	}
+}
+
+// Config returns the configuration of the MaintenanceList, with defaults applied.
+func (l *MaintenanceList) Config() MaintenanceConfig {
+	return l.config
+}
+
+// Start places host under maintenance for d, capped at the configured max
+// duration. host is matched against peer ips and hostnames. Returns when the
+// window ends.
+func (l *MaintenanceList) Start(host string, d time.Duration) time.Time {
+	if d > l.config.MaxDuration {
+		d = l.config.MaxDuration
+	}
+	until := l.clk.Now().Add(d)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.hosts[host] = until
+	return until
+}
+
+// End returns host to rotation. Returns false if host was not under
+// maintenance.
+func (l *MaintenanceList) End(host string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep()
+	_, ok := l.hosts[host]
+	delete(l.hosts, host)
+	return ok
+}
+
+// List returns all hosts under maintenance and when their windows end.
+func (l *MaintenanceList) List() map[string]time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep()
+	result := make(map[string]time.Time, len(l.hosts))
+	for host, until := range l.hosts {
+		result[host] = until
+	}
+	return result
+}
+
+// sweep discards ended windows. Must be called with l.mu held.
+func (l *MaintenanceList) sweep() {
+	now := l.clk.Now()
+	for host, until := range l.hosts {
+		if !now.Before(until) {
+			delete(l.hosts, host)
+		}
+	}
+}
+
+// underMaintenance returns whether any address of p is under maintenance. Must
+// be called with l.mu held.
+func (l *MaintenanceList) underMaintenance(p *core.PeerInfo) bool {
+	hosts := []string{p.IP, p.IPv6, p.Hostname}
+	for _, ip := range p.Networks {
+		hosts = append(hosts, ip)
+	}
+	for _, h := range hosts {
+		if h == "" {
+			continue
+		}
+		if _, ok := l.hosts[h]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply removes peers on hosts under maintenance from peers. labels, which
+// annotate peers by index, are filtered alongside peers. Returns the number of
+// peers withheld.
+func (l *MaintenanceList) Apply(
+	peers []*core.PeerInfo, labels []string) ([]*core.PeerInfo, []string, int) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep()
+	if len(l.hosts) == 0 {
+		return peers, labels, 0
+	}
+	resultPeers := make([]*core.PeerInfo, 0, len(peers))
+	resultLabels := make([]string, 0, len(labels))
+	for i, p := range peers {
+		if l.underMaintenance(p) {
+			continue
+		}
+		resultPeers = append(resultPeers, p)
+		resultLabels = append(resultLabels, labels[i])
+	}
+	return resultPeers, resultLabels, len(peers) - len(resultPeers)
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceListWithholdsPeers(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	l := NewMaintenanceList(MaintenanceConfig{}, clk)
+
+	byIP := core.PeerInfoFixture()
+	byHostname := core.PeerInfoFixture()
+	byHostname.Hostname = "agent1.example.com"
+	byNetwork := core.PeerInfoFixture()
+	byNetwork.Networks = map[string]string{"storage": "10.1.0.1"}
+	other := core.PeerInfoFixture()
+
+	peers := []*core.PeerInfo{byIP, byHostname, other, byNetwork}
+	labels := []string{"a", "b", "c", "d"}
+
+	l.Start(byIP.IP, time.Minute)
+	l.Start("agent1.example.com", 2*time.Minute)
+	l.Start("10.1.0.1", 2*time.Minute)
+
+	result, resultLabels, n := l.Apply(peers, labels)
+	require.Equal([]*core.PeerInfo{other}, result)
+	require.Equal([]string{"c"}, resultLabels)
+	require.Equal(3, n)
+
+	// Windows end independently.
+	clk.Add(time.Minute)
+	result, resultLabels, n = l.Apply(peers, labels)
+	require.Equal([]*core.PeerInfo{byIP, other}, result)
+	require.Equal([]string{"a", "c"}, resultLabels)
+	require.Equal(2, n)
+
+	require.True(l.End("agent1.example.com"))
+	require.False(l.End("agent1.example.com"))
+	require.Equal(map[string]time.Time{
+		"10.1.0.1": clk.Now().Add(time.Minute),
+	}, l.List())
+}
+
+func TestMaintenanceListCapsDuration(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	l := NewMaintenanceList(MaintenanceConfig{MaxDuration: time.Hour}, clk)
+
+	require.Equal(clk.Now().Add(time.Hour), l.Start("agent1.example.com", 48*time.Hour))
+}
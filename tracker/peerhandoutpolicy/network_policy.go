@@ -0,0 +1,50 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import "github.com/uber/kraken/core"
+
+const _networkPolicy = "network"
+
+// sharedNetwork returns the index of the first network in networks which both
+// source and peer announced an address on, or len(networks) if none.
+func sharedNetwork(networks []string, source, peer *core.PeerInfo) int {
+	for i, n := range networks {
+		_, a := source.Networks[n]
+		_, b := peer.Networks[n]
+		if a && b {
+			return i
+		}
+	}
+	return len(networks)
+}
+
+// networkAssignmentPolicy prioritizes peers which share a preferred network
+// with the source, in the preference order of networks, such that multi-homed
+// peers transfer over e.g. a dedicated storage network when possible.
+type networkAssignmentPolicy struct {
+	networks []string
+}
+
+func newNetworkAssignmentPolicy(networks []string) assignmentPolicy {
+	return &networkAssignmentPolicy{networks}
+}
+
+func (p *networkAssignmentPolicy) assignPriority(source, peer *core.PeerInfo) (int, string) {
+	i := sharedNetwork(p.networks, source, peer)
+	if i == len(p.networks) {
+		return i, "no_shared_network"
+	}
+	return i, "network_" + p.networks[i]
+}
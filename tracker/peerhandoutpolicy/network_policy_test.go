@@ -0,0 +1,69 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func peerOnNetworks(networks ...string) *core.PeerInfo {
+	p := core.PeerInfoFixture()
+	p.Networks = make(map[string]string)
+	for _, n := range networks {
+		p.Networks[n] = "10.9.0.1"
+	}
+	return p
+}
+
+func TestNetworkPriorityPolicy(t *testing.T) {
+	require := require.New(t)
+
+	policy, err := NewPriorityPolicy(
+		tally.NoopScope, _networkPolicy, WithPreferredNetworks([]string{"storage", "backup"}))
+	require.NoError(err)
+
+	source := peerOnNetworks("storage", "backup")
+	none := peerOnNetworks()
+	other := peerOnNetworks("service")
+	backup := peerOnNetworks("backup")
+	storage := peerOnNetworks("storage", "backup")
+
+	peers, labels := policy.SortPeersWithLabels(
+		source, []*core.PeerInfo{none, backup, other, storage})
+	require.Equal([]*core.PeerInfo{storage, backup, none, other}, peers)
+	require.Equal([]string{
+		"network_storage", "network_backup", "no_shared_network", "no_shared_network",
+	}, labels)
+}
+
+func TestNetworkPriorityPolicyIgnoresSourceOffNetwork(t *testing.T) {
+	require := require.New(t)
+
+	policy, err := NewPriorityPolicy(
+		tally.NoopScope, _networkPolicy, WithPreferredNetworks([]string{"storage"}))
+	require.NoError(err)
+
+	source := peerOnNetworks()
+	a := peerOnNetworks("storage")
+	b := peerOnNetworks()
+
+	peers, labels := policy.SortPeersWithLabels(source, []*core.PeerInfo{a, b})
+	require.Equal([]*core.PeerInfo{a, b}, peers)
+	require.Equal([]string{"no_shared_network", "no_shared_network"}, labels)
+}
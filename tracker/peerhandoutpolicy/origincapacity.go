@@ -0,0 +1,115 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// OriginCapacityConfig defines configuration for capping how many leechers each
+// origin is handed out to, such that pushing a new blob does not send every
+// leecher in the cluster to the origins seeding it at once.
+type OriginCapacityConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxLeechers is the number of handouts each origin appears in per
+	// Interval. Once reached, origins are withheld from handouts until the
+	// next interval, and leechers download from regular peers instead. Note,
+	// each tracker enforces the cap independently.
+	MaxLeechers int `yaml:"max_leechers"`
+
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (c OriginCapacityConfig) applyDefaults() OriginCapacityConfig {
+	if c.MaxLeechers == 0 {
+		c.MaxLeechers = 50
+	}
+	if c.Interval == 0 {
+		c.Interval = 10 * time.Second
+	}
+	return c
+}
+
+// OriginCapacityLimiter counts handouts of each origin within fixed intervals.
+type OriginCapacityLimiter struct {
+	config OriginCapacityConfig
+	clk    clock.Clock
+
+	mu          sync.Mutex
+	windowStart time.Time
+	handouts    map[core.PeerID]int
+}
+
+// NewOriginCapacityLimiter creates a new OriginCapacityLimiter.
+func NewOriginCapacityLimiter(config OriginCapacityConfig, clk clock.Clock) *OriginCapacityLimiter {
+	return &OriginCapacityLimiter{
+		config:      config.applyDefaults(),
+		clk:         clk,
+		windowStart: clk.Now(),
+		handouts:    make(map[core.PeerID]int),
+	}
+}
+
+// Config returns the configuration of the OriginCapacityLimiter, with defaults applied.
+func (l *OriginCapacityLimiter) Config() OriginCapacityConfig {
+	return l.config
+}
+
+// Apply withholds origins which reached their capacity in the current interval
+// from peers. If count is set, a handout is counted against every origin kept,
+// otherwise Apply only previews the handout. Regular peers are kept in order.
+// labels, which annotate peers by index, are filtered alongside peers, and are
+// dropped if they do not annotate every peer. Returns the number of origins
+// withheld.
+func (l *OriginCapacityLimiter) Apply(
+	peers []*core.PeerInfo, labels []string, count bool) ([]*core.PeerInfo, []string, int) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now := l.clk.Now(); now.Sub(l.windowStart) >= l.config.Interval {
+		l.windowStart = now
+		l.handouts = make(map[core.PeerID]int)
+	}
+
+	if len(labels) != len(peers) {
+		labels = nil
+	}
+	resultPeers := make([]*core.PeerInfo, 0, len(peers))
+	var resultLabels []string
+	if labels != nil {
+		resultLabels = make([]string, 0, len(labels))
+	}
+	for i, p := range peers {
+		if p.Origin {
+			if l.handouts[p.PeerID] >= l.config.MaxLeechers {
+				continue
+			}
+			if count {
+				l.handouts[p.PeerID]++
+			}
+		}
+		resultPeers = append(resultPeers, p)
+		if labels != nil {
+			resultLabels = append(resultLabels, labels[i])
+		}
+	}
+	return resultPeers, resultLabels, len(peers) - len(resultPeers)
+}
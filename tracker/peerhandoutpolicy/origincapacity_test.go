@@ -0,0 +1,109 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginCapacityLimiterWithholdsOriginsAtCapacity(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	limiter := NewOriginCapacityLimiter(
+		OriginCapacityConfig{MaxLeechers: 2, Interval: time.Minute}, clk)
+
+	origin := core.OriginPeerInfoFixture()
+	peer := core.PeerInfoFixture()
+	peers := []*core.PeerInfo{origin, peer}
+	labels := []string{"origin", "peer"}
+
+	for i := 0; i < 2; i++ {
+		result, resultLabels, n := limiter.Apply(peers, labels, true)
+		require.Equal(0, n)
+		require.Equal(peers, result)
+		require.Equal(labels, resultLabels)
+	}
+
+	// Overflow spills to regular peers.
+	result, resultLabels, n := limiter.Apply(peers, labels, true)
+	require.Equal(1, n)
+	require.Equal([]*core.PeerInfo{peer}, result)
+	require.Equal([]string{"peer"}, resultLabels)
+
+	// Previews neither count nor bypass capacity.
+	result, _, n = limiter.Apply(peers, labels, false)
+	require.Equal(1, n)
+	require.Equal([]*core.PeerInfo{peer}, result)
+
+	// Capacity is restored in the next interval.
+	clk.Add(time.Minute)
+
+	result, _, n = limiter.Apply(peers, labels, true)
+	require.Equal(0, n)
+	require.Equal(peers, result)
+}
+
+func TestOriginCapacityLimiterCountsOriginsIndependently(t *testing.T) {
+	require := require.New(t)
+
+	limiter := NewOriginCapacityLimiter(
+		OriginCapacityConfig{MaxLeechers: 1, Interval: time.Minute}, clock.NewMock())
+
+	o1 := core.OriginPeerInfoFixture()
+	o2 := core.OriginPeerInfoFixture()
+
+	_, _, n := limiter.Apply([]*core.PeerInfo{o1}, []string{"o1"}, true)
+	require.Equal(0, n)
+
+	result, _, n := limiter.Apply([]*core.PeerInfo{o1, o2}, []string{"o1", "o2"}, true)
+	require.Equal(1, n)
+	require.Equal([]*core.PeerInfo{o2}, result)
+}
+
+func TestOriginCapacityLimiterPreviewsDoNotCount(t *testing.T) {
+	require := require.New(t)
+
+	limiter := NewOriginCapacityLimiter(
+		OriginCapacityConfig{MaxLeechers: 1, Interval: time.Minute}, clock.NewMock())
+
+	origin := core.OriginPeerInfoFixture()
+
+	for i := 0; i < 3; i++ {
+		_, _, n := limiter.Apply([]*core.PeerInfo{origin}, []string{"origin"}, false)
+		require.Equal(0, n)
+	}
+	_, _, n := limiter.Apply([]*core.PeerInfo{origin}, []string{"origin"}, true)
+	require.Equal(0, n)
+}
+
+func TestOriginCapacityLimiterDropsMismatchedLabels(t *testing.T) {
+	require := require.New(t)
+
+	limiter := NewOriginCapacityLimiter(
+		OriginCapacityConfig{MaxLeechers: 1, Interval: time.Minute}, clock.NewMock())
+
+	peers := []*core.PeerInfo{core.OriginPeerInfoFixture(), core.PeerInfoFixture()}
+
+	result, labels, n := limiter.Apply(peers, []string{"origin"}, true)
+	require.Equal(0, n)
+	require.Equal(peers, result)
+	require.Nil(labels)
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/uber-go/tally"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/topology"
 )
 
 type peerPriorityInfo struct {
@@ -28,20 +29,56 @@ type peerPriorityInfo struct {
 	label    string
 }
 
-// assignmentPolicy defines the policy for assigning priority to peers.
+// assignmentPolicy defines the policy for assigning priority to peers handed
+// out to source.
 type assignmentPolicy interface {
-	assignPriority(peer *core.PeerInfo) (priority int, label string)
+	assignPriority(source, peer *core.PeerInfo) (priority int, label string)
 }
 
 // PriorityPolicy wraps an assignmentPolicy and uses it to sort lists of peers.
 type PriorityPolicy struct {
+	name   string
 	stats  tally.Scope
 	policy assignmentPolicy
 }
 
+type options struct {
+	topology *topology.Map
+	cost     CostConfig
+	networks []string
+}
+
+// Option defines an optional NewPriorityPolicy parameter.
+type Option func(*options)
+
+// WithTopology locates peers using t in topology-aware policies. Without it,
+// such policies only consider the zone peers announce.
+func WithTopology(t *topology.Map) Option {
+	return func(o *options) { o.topology = t }
+}
+
+// WithCostConfig configures the cost policy.
+func WithCostConfig(c CostConfig) Option {
+	return func(o *options) { o.cost = c }
+}
+
+// WithPreferredNetworks configures the preference order of networks in the
+// network policy.
+func WithPreferredNetworks(networks []string) Option {
+	return func(o *options) { o.networks = networks }
+}
+
 // NewPriorityPolicy returns a PriorityPolicy that assigns priorities using the given priority policy.
-func NewPriorityPolicy(stats tally.Scope, priorityPolicy string) (*PriorityPolicy, error) {
+func NewPriorityPolicy(
+	stats tally.Scope, priorityPolicy string, opts ...Option) (*PriorityPolicy, error) {
+
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	p := &PriorityPolicy{
+		name: priorityPolicy,
 		stats: stats.Tagged(map[string]string{
 			"module":   "peerhandoutpolicy",
 			"priority": priorityPolicy,
@@ -53,6 +90,12 @@ func NewPriorityPolicy(stats tally.Scope, priorityPolicy string) (*PriorityPolic
 		p.policy = newDefaultAssignmentPolicy()
 	case _completenessPolicy:
 		p.policy = newCompletenessAssignmentPolicy()
+	case _localityPolicy:
+		p.policy = newLocalityAssignmentPolicy(o.topology)
+	case _costPolicy:
+		p.policy = newCostAssignmentPolicy(o.topology, o.cost)
+	case _networkPolicy:
+		p.policy = newNetworkAssignmentPolicy(o.networks)
 	default:
 		return nil, fmt.Errorf("priority policy %q not found", priorityPolicy)
 	}
@@ -60,27 +103,44 @@ func NewPriorityPolicy(stats tally.Scope, priorityPolicy string) (*PriorityPolic
 	return p, nil
 }
 
+// Name returns the name of the priority policy p assigns priorities with.
+func (p *PriorityPolicy) Name() string {
+	return p.name
+}
+
 // SortPeers returns the given list of peers sorted by the priority assigned to them
 // by the priorityPolicy. Excludes the source peer from the list.
 func (p *PriorityPolicy) SortPeers(source *core.PeerInfo, peers []*core.PeerInfo) []*core.PeerInfo {
+	sorted, _ := p.SortPeersWithLabels(source, peers)
+	return sorted
+}
+
+// SortPeersWithLabels is identical to SortPeers, but also returns the priority
+// label assigned to each returned peer.
+func (p *PriorityPolicy) SortPeersWithLabels(
+	source *core.PeerInfo, peers []*core.PeerInfo) ([]*core.PeerInfo, []string) {
 
 	peerPriorities := make([]*peerPriorityInfo, 0, len(peers))
 	for k := 0; k < len(peers); k++ {
 		if peers[k] != source {
-			priority, label := p.policy.assignPriority(peers[k])
+			priority, label := p.policy.assignPriority(source, peers[k])
 			peerPriorities = append(peerPriorities,
 				&peerPriorityInfo{peers[k], priority, label})
 		}
 	}
 
-	sort.Slice(peerPriorities, func(i, j int) bool {
+	// Stable sort such that peers of equal priority retain their input order,
+	// which deterministic handouts rely on.
+	sort.SliceStable(peerPriorities, func(i, j int) bool {
 		return peerPriorities[i].priority < peerPriorities[j].priority
 	})
 
+	labels := make([]string, len(peerPriorities))
 	priorityCounts := make(map[string]int)
 	for k := 0; k < len(peerPriorities); k++ {
 		p := peerPriorities[k]
 		peers[k] = p.peer
+		labels[k] = p.label
 		if _, ok := priorityCounts[p.label]; ok {
 			priorityCounts[p.label]++
 		} else {
@@ -95,5 +155,5 @@ func (p *PriorityPolicy) SortPeers(source *core.PeerInfo, peers []*core.PeerInfo
 		}).Gauge("count").Update(float64(count))
 	}
 
-	return peers
+	return peers, labels
 }
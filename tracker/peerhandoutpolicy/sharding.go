@@ -0,0 +1,119 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"hash/fnv"
+	"sort"
+
+	"github.com/uber/kraken/core"
+)
+
+// ShardingConfig defines configuration for sharded handouts, which map each
+// leecher to a small, stable subset of the seeders of each torrent.
+type ShardingConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// SeedersPerLeecher is the number of seeders handed out to each leecher.
+	SeedersPerLeecher int `yaml:"seeders_per_leecher"`
+}
+
+func (c ShardingConfig) applyDefaults() ShardingConfig {
+	if c.SeedersPerLeecher == 0 {
+		c.SeedersPerLeecher = 3
+	}
+	return c
+}
+
+// ShardingPolicy assigns seeders to leechers by rendezvous hashing: each
+// leecher is handed out the seeders with the highest scores for the pair of
+// torrent and leecher. Assignments only change for the seeders which join or
+// leave a swarm, such that leechers keep reusing connections to the same
+// seeders across announces, and each seeder serves an even share of leechers.
+type ShardingPolicy struct {
+	config ShardingConfig
+}
+
+// NewShardingPolicy creates a new ShardingPolicy.
+func NewShardingPolicy(config ShardingConfig) *ShardingPolicy {
+	return &ShardingPolicy{config.applyDefaults()}
+}
+
+// Config returns the configuration of the ShardingPolicy, with defaults applied.
+func (p *ShardingPolicy) Config() ShardingConfig {
+	return p.config
+}
+
+// rendezvousScore returns the score of seeder for source downloading h.
+func rendezvousScore(h core.InfoHash, source, seeder core.PeerID) uint64 {
+	f := fnv.New64a()
+	f.Write(h.Bytes())
+	f.Write(source[:])
+	f.Write(seeder[:])
+	// FNV poorly mixes its final bytes, which differ the least between
+	// seeders, so scores are finalized with splitmix64.
+	x := f.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Apply withholds the seeders of h which are outside the shard of source.
+// Origins and leechers are never withheld, and the order of the remaining
+// peers is preserved. labels, which annotate peers by index, are filtered
+// alongside peers. Returns the number of seeders withheld.
+func (p *ShardingPolicy) Apply(
+	h core.InfoHash,
+	source *core.PeerInfo,
+	peers []*core.PeerInfo,
+	labels []string) ([]*core.PeerInfo, []string, int) {
+
+	type scored struct {
+		index int
+		score uint64
+	}
+	var seeders []scored
+	for i, peer := range peers {
+		if peer.Complete && !peer.Origin {
+			seeders = append(seeders, scored{i, rendezvousScore(h, source.PeerID, peer.PeerID)})
+		}
+	}
+	if len(seeders) <= p.config.SeedersPerLeecher {
+		return peers, labels, 0
+	}
+	sort.Slice(seeders, func(i, j int) bool {
+		if seeders[i].score != seeders[j].score {
+			return seeders[i].score > seeders[j].score
+		}
+		return peers[seeders[i].index].PeerID.LessThan(peers[seeders[j].index].PeerID)
+	})
+	withheld := make(map[int]bool)
+	for _, s := range seeders[p.config.SeedersPerLeecher:] {
+		withheld[s.index] = true
+	}
+
+	resultPeers := make([]*core.PeerInfo, 0, len(peers)-len(withheld))
+	resultLabels := make([]string, 0, len(peers)-len(withheld))
+	for i, peer := range peers {
+		if withheld[i] {
+			continue
+		}
+		resultPeers = append(resultPeers, peer)
+		resultLabels = append(resultLabels, labels[i])
+	}
+	return resultPeers, resultLabels, len(withheld)
+}
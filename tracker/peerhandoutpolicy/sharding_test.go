@@ -0,0 +1,164 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func seederFixtures(n int) []*core.PeerInfo {
+	seeders := make([]*core.PeerInfo, n)
+	for i := range seeders {
+		seeders[i] = core.PeerInfoFixture()
+		seeders[i].Complete = true
+	}
+	return seeders
+}
+
+func shardedSeeders(peers []*core.PeerInfo) map[core.PeerID]bool {
+	result := make(map[core.PeerID]bool)
+	for _, p := range peers {
+		if p.Complete && !p.Origin {
+			result[p.PeerID] = true
+		}
+	}
+	return result
+}
+
+func TestShardingPolicyWithholdsSeedersOutsideShard(t *testing.T) {
+	require := require.New(t)
+
+	policy := NewShardingPolicy(ShardingConfig{SeedersPerLeecher: 2})
+
+	h := core.InfoHashFixture()
+	source := core.PeerInfoFixture()
+
+	origin := core.PeerInfoFixture()
+	origin.Origin = true
+	origin.Complete = true
+	leecher := core.PeerInfoFixture()
+
+	peers := append(seederFixtures(5), origin, leecher)
+	result, labels, withheld := policy.Apply(h, source, peers, labelsFor(peers))
+	require.Equal(3, withheld)
+	require.Len(result, 4)
+	require.Equal(labelsFor(result), labels)
+	require.Contains(result, origin)
+	require.Contains(result, leecher)
+	require.Len(shardedSeeders(result), 2)
+
+	// Remaining peers keep their order.
+	prev := -1
+	for _, p := range result {
+		for i := range peers {
+			if peers[i] == p {
+				require.True(i > prev)
+				prev = i
+			}
+		}
+	}
+}
+
+func TestShardingPolicyNoopWithFewSeeders(t *testing.T) {
+	require := require.New(t)
+
+	policy := NewShardingPolicy(ShardingConfig{SeedersPerLeecher: 3})
+
+	peers := append(seederFixtures(3), core.PeerInfoFixture())
+	result, _, withheld := policy.Apply(
+		core.InfoHashFixture(), core.PeerInfoFixture(), peers, labelsFor(peers))
+	require.Equal(0, withheld)
+	require.Equal(peers, result)
+}
+
+func TestShardingPolicyIsStable(t *testing.T) {
+	require := require.New(t)
+
+	policy := NewShardingPolicy(ShardingConfig{SeedersPerLeecher: 3})
+
+	h := core.InfoHashFixture()
+	source := core.PeerInfoFixture()
+	seeders := seederFixtures(10)
+
+	apply := func(peers []*core.PeerInfo) map[core.PeerID]bool {
+		result, _, _ := policy.Apply(h, source, peers, labelsFor(peers))
+		return shardedSeeders(result)
+	}
+
+	shard := apply(seeders)
+	require.Len(shard, 3)
+
+	// Order of the input does not matter.
+	reversed := make([]*core.PeerInfo, len(seeders))
+	for i, p := range seeders {
+		reversed[len(seeders)-1-i] = p
+	}
+	require.Equal(shard, apply(reversed))
+
+	// Seeders outside the shard leaving does not change it.
+	var remaining []*core.PeerInfo
+	var left *core.PeerInfo
+	for _, p := range seeders {
+		if left == nil && !shard[p.PeerID] {
+			left = p
+			continue
+		}
+		remaining = append(remaining, p)
+	}
+	require.Equal(shard, apply(remaining))
+
+	// A seeder of the shard leaving only replaces that seeder.
+	remaining = nil
+	var removed core.PeerID
+	for _, p := range seeders {
+		if removed == (core.PeerID{}) && shard[p.PeerID] {
+			removed = p.PeerID
+			continue
+		}
+		remaining = append(remaining, p)
+	}
+	next := apply(remaining)
+	require.Len(next, 3)
+	for id := range shard {
+		if id != removed {
+			require.True(next[id])
+		}
+	}
+}
+
+func TestShardingPolicySpreadsLeechersEvenly(t *testing.T) {
+	require := require.New(t)
+
+	policy := NewShardingPolicy(ShardingConfig{SeedersPerLeecher: 2})
+
+	h := core.InfoHashFixture()
+	seeders := seederFixtures(10)
+
+	counts := make(map[core.PeerID]int)
+	for i := 0; i < 1000; i++ {
+		result, _, _ := policy.Apply(h, core.PeerInfoFixture(), seeders, labelsFor(seeders))
+		for id := range shardedSeeders(result) {
+			counts[id]++
+		}
+	}
+	// Each seeder expects 1000 * 2 / 10 = 200 leechers.
+	require.Len(counts, len(seeders))
+	for _, n := range counts {
+		require.InDelta(200, n, 60)
+	}
+}
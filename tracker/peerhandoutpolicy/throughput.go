@@ -0,0 +1,279 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// ThroughputConfig defines configuration for weighting handouts by the upload
+// throughput of peers, derived from the uploaded bytes peers report in their
+// announces.
+type ThroughputConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// HalfLife is how quickly old throughput samples lose their weight in the
+	// smoothed throughput of a peer.
+	HalfLife time.Duration `yaml:"half_life"`
+
+	// MaxIdle is how long the throughput of a peer which stopped reporting is
+	// remembered.
+	MaxIdle time.Duration `yaml:"max_idle"`
+
+	// MinBytesPerSec is the weight of peers with unknown or lower throughput,
+	// such that new and idle peers are still handed out occasionally.
+	MinBytesPerSec float64 `yaml:"min_bytes_per_sec"`
+}
+
+func (c ThroughputConfig) applyDefaults() ThroughputConfig {
+	if c.HalfLife == 0 {
+		c.HalfLife = time.Minute
+	}
+	if c.MaxIdle == 0 {
+		c.MaxIdle = 10 * time.Minute
+	}
+	if c.MinBytesPerSec == 0 {
+		c.MinBytesPerSec = 1024 * 1024
+	}
+	return c
+}
+
+// ThroughputTracker derives the upload throughput of each peer from the
+// deltas between the uploaded byte counts of its announces. Throughput is kept
+// in a peer store if one is configured, such that it is shared by all trackers
+// and survives restarts, and in memory otherwise.
+type ThroughputTracker struct {
+	config ThroughputConfig
+	clk    clock.Clock
+
+	mu        sync.Mutex
+	store     peerstore.ThroughputStore // Nil if throughput is kept in memory.
+	records   map[core.PeerID]peerstore.ThroughputRecord
+	lastSweep time.Time
+}
+
+// ThroughputOption allows setting optional ThroughputTracker parameters.
+type ThroughputOption func(*ThroughputTracker)
+
+// WithThroughputStore keeps throughput in s instead of in memory. Trackers
+// which update the same peer concurrently may drop each other's samples, which
+// only delays the smoothed throughput. If s does not persist throughput, or
+// fails, throughput is kept in memory.
+func WithThroughputStore(s peerstore.ThroughputStore) ThroughputOption {
+	return func(t *ThroughputTracker) { t.store = s }
+}
+
+// NewThroughputTracker creates a new ThroughputTracker.
+func NewThroughputTracker(
+	config ThroughputConfig, clk clock.Clock, opts ...ThroughputOption) *ThroughputTracker {
+
+	t := &ThroughputTracker{
+		config:    config.applyDefaults(),
+		clk:       clk,
+		records:   make(map[core.PeerID]peerstore.ThroughputRecord),
+		lastSweep: clk.Now(),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Config returns the configuration of the ThroughputTracker, with defaults applied.
+func (t *ThroughputTracker) Config() ThroughputConfig {
+	return t.config
+}
+
+// Update records that peerID has uploaded the given number of bytes in total.
+// Counters which go backwards, e.g. because the peer restarted, restart the
+// measurement without discarding the known throughput.
+func (t *ThroughputTracker) Update(peerID core.PeerID, uploaded int64) {
+	now := t.clk.Now()
+	if s := t.getStore(); s != nil {
+		err := t.updateStore(s, peerID, uploaded, now)
+		if err == nil {
+			return
+		}
+		t.storeFailed(err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.records[peerID]
+	t.records[peerID] = t.advance(r, ok, uploaded, now)
+
+	// Periodically discard peers which stopped reporting, so peers which
+	// leave the cluster are not remembered forever.
+	if now.Sub(t.lastSweep) >= t.config.MaxIdle {
+		for id, r := range t.records {
+			if now.Sub(r.Updated) > t.config.MaxIdle {
+				delete(t.records, id)
+			}
+		}
+		t.lastSweep = now
+	}
+}
+
+func (t *ThroughputTracker) updateStore(
+	s peerstore.ThroughputStore, peerID core.PeerID, uploaded int64, now time.Time) error {
+
+	records, err := s.GetThroughput([]core.PeerID{peerID})
+	if err != nil {
+		return err
+	}
+	r, ok := records[peerID]
+	return s.SetThroughput(peerID, t.advance(r, ok, uploaded, now), t.config.MaxIdle)
+}
+
+// advance returns record r, which exists if ok, updated with an announce of
+// uploaded bytes at now.
+func (t *ThroughputTracker) advance(
+	r peerstore.ThroughputRecord, ok bool, uploaded int64, now time.Time) peerstore.ThroughputRecord {
+
+	if ok && uploaded >= r.Uploaded {
+		if elapsed := now.Sub(r.Updated); elapsed > 0 {
+			sample := float64(uploaded-r.Uploaded) / elapsed.Seconds()
+			// Exponentially weighted average, where each sample weighs by the
+			// time it covers.
+			w := 1 - math.Pow(0.5, float64(elapsed)/float64(t.config.HalfLife))
+			r.Rate += w * (sample - r.Rate)
+		}
+	}
+	r.Uploaded = uploaded
+	r.Updated = now
+	return r
+}
+
+func (t *ThroughputTracker) getStore() peerstore.ThroughputStore {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.store
+}
+
+// storeFailed falls back to memory for the current call, or for good if the
+// store does not persist throughput.
+func (t *ThroughputTracker) storeFailed(err error) {
+	if err != peerstore.ErrNoThroughput {
+		log.Errorf("Error accessing throughput in peer store: %s", err)
+		return
+	}
+	log.Info("Peer store does not persist throughput, keeping throughput in memory")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.store = nil
+}
+
+// Rate returns the smoothed upload throughput of peerID in bytes per second.
+// Peers which never reported uploads, or stopped reporting, have zero
+// throughput.
+func (t *ThroughputTracker) Rate(peerID core.PeerID) float64 {
+	return t.rates([]core.PeerID{peerID})[peerID]
+}
+
+// rates returns the smoothed upload throughput of each of ids which is known,
+// reading all of them from the store in a single round trip.
+func (t *ThroughputTracker) rates(ids []core.PeerID) map[core.PeerID]float64 {
+	now := t.clk.Now()
+	var records map[core.PeerID]peerstore.ThroughputRecord
+	if s := t.getStore(); s != nil {
+		var err error
+		records, err = s.GetThroughput(ids)
+		if err != nil {
+			t.storeFailed(err)
+			records = nil
+		}
+	}
+	if records == nil {
+		t.mu.Lock()
+		records = make(map[core.PeerID]peerstore.ThroughputRecord, len(ids))
+		for _, id := range ids {
+			if r, ok := t.records[id]; ok {
+				records[id] = r
+			}
+		}
+		t.mu.Unlock()
+	}
+	rates := make(map[core.PeerID]float64, len(records))
+	for id, r := range records {
+		if now.Sub(r.Updated) <= t.config.MaxIdle {
+			rates[id] = r.Rate
+		}
+	}
+	return rates
+}
+
+// Apply reorders each run of equally labeled peers, i.e. peers of the same
+// priority, by weighted random sampling without replacement, where each peer
+// weighs its throughput. Faster peers are thus handed out first with high
+// probability, without every leecher converging onto the single fastest
+// peer. random returns values in [0, 1). labels, which annotate peers by
+// index, are reordered alongside peers. Returns the number of peers whose
+// throughput is known.
+func (t *ThroughputTracker) Apply(
+	peers []*core.PeerInfo,
+	labels []string,
+	random func() float64) ([]*core.PeerInfo, []string, int) {
+
+	type keyed struct {
+		peer  *core.PeerInfo
+		label string
+		key   float64
+	}
+	ids := make([]core.PeerID, len(peers))
+	for i, p := range peers {
+		ids[i] = p.PeerID
+	}
+	rates := t.rates(ids)
+
+	resultPeers := make([]*core.PeerInfo, 0, len(peers))
+	resultLabels := make([]string, 0, len(labels))
+	var known int
+	for start := 0; start < len(peers); {
+		end := start + 1
+		for end < len(peers) && labels[end] == labels[start] {
+			end++
+		}
+		run := make([]keyed, 0, end-start)
+		for i := start; i < end; i++ {
+			rate := rates[peers[i].PeerID]
+			if rate > 0 {
+				known++
+			}
+			w := math.Max(rate, t.config.MinBytesPerSec)
+			// Efraimidis-Spirakis: sorting by u^(1/w) descending samples
+			// without replacement proportionally to w. Keys are compared in
+			// log space, since u^(1/w) rounds to 1 for large w.
+			run = append(run, keyed{peers[i], labels[i], math.Log(random()) / w})
+		}
+		sort.SliceStable(run, func(i, j int) bool { return run[i].key > run[j].key })
+		for _, k := range run {
+			resultPeers = append(resultPeers, k.peer)
+			resultLabels = append(resultLabels, k.label)
+		}
+		start = end
+	}
+	return resultPeers, resultLabels, known
+}
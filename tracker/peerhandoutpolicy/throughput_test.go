@@ -0,0 +1,176 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThroughputTrackerRate(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	tracker := NewThroughputTracker(ThroughputConfig{HalfLife: time.Second}, clk)
+
+	p := core.PeerIDFixture()
+	require.Equal(0.0, tracker.Rate(p))
+
+	// The first report only establishes a baseline.
+	tracker.Update(p, 1000)
+	require.Equal(0.0, tracker.Rate(p))
+
+	// A sample covering one half life moves the rate halfway to the sample.
+	clk.Add(time.Second)
+	tracker.Update(p, 3000)
+	require.InDelta(1000, tracker.Rate(p), 0.0001)
+
+	// Restarted peers report lower counters, which keep the known rate.
+	clk.Add(time.Second)
+	tracker.Update(p, 0)
+	require.InDelta(1000, tracker.Rate(p), 0.0001)
+
+	clk.Add(time.Second)
+	tracker.Update(p, 5000)
+	require.InDelta(3000, tracker.Rate(p), 0.0001)
+}
+
+func TestThroughputTrackerForgetsIdlePeers(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	tracker := NewThroughputTracker(ThroughputConfig{HalfLife: time.Second, MaxIdle: time.Minute}, clk)
+
+	p := core.PeerIDFixture()
+	tracker.Update(p, 0)
+	clk.Add(time.Second)
+	tracker.Update(p, 1000)
+	require.True(tracker.Rate(p) > 0)
+
+	clk.Add(2 * time.Minute)
+	require.Equal(0.0, tracker.Rate(p))
+}
+
+func TestThroughputTrackerApplyPrefersFastPeersWithinPriority(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	tracker := NewThroughputTracker(ThroughputConfig{HalfLife: time.Second, MinBytesPerSec: 1}, clk)
+
+	fast := core.PeerInfoFixture()
+	slow := core.PeerInfoFixture()
+	remote := core.PeerInfoFixture()
+	for _, p := range []*core.PeerInfo{fast, slow, remote} {
+		tracker.Update(p.PeerID, 1)
+	}
+	clk.Add(time.Second)
+	tracker.Update(fast.PeerID, 1000001)
+	tracker.Update(slow.PeerID, 101)
+	tracker.Update(remote.PeerID, 100000001)
+
+	peers := []*core.PeerInfo{slow, fast, remote}
+	labels := []string{"same_zone", "same_zone", "remote"}
+
+	r := rand.New(rand.NewSource(0))
+	var fastFirst int
+	for i := 0; i < 100; i++ {
+		result, resultLabels, known := tracker.Apply(peers, labels, r.Float64)
+		require.Equal(3, known)
+		require.Equal(labels, resultLabels)
+		// Priorities are preserved regardless of throughput.
+		require.Equal(remote, result[2])
+		if result[0] == fast {
+			fastFirst++
+		}
+	}
+	// fast weighs 10000 times more than slow.
+	require.True(fastFirst > 95)
+}
+
+// memThroughputStore is an in-memory peerstore.ThroughputStore.
+type memThroughputStore struct {
+	records map[core.PeerID]peerstore.ThroughputRecord
+	err     error
+}
+
+func newMemThroughputStore() *memThroughputStore {
+	return &memThroughputStore{records: make(map[core.PeerID]peerstore.ThroughputRecord)}
+}
+
+func (s *memThroughputStore) GetThroughput(
+	ids []core.PeerID) (map[core.PeerID]peerstore.ThroughputRecord, error) {
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	records := make(map[core.PeerID]peerstore.ThroughputRecord)
+	for _, id := range ids {
+		if r, ok := s.records[id]; ok {
+			records[id] = r
+		}
+	}
+	return records, nil
+}
+
+func (s *memThroughputStore) SetThroughput(
+	id core.PeerID, r peerstore.ThroughputRecord, ttl time.Duration) error {
+
+	if s.err != nil {
+		return s.err
+	}
+	s.records[id] = r
+	return nil
+}
+
+func TestThroughputTrackerSharesThroughputViaStore(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	store := newMemThroughputStore()
+	config := ThroughputConfig{HalfLife: time.Second}
+	t1 := NewThroughputTracker(config, clk, WithThroughputStore(store))
+	t2 := NewThroughputTracker(config, clk, WithThroughputStore(store))
+
+	p := core.PeerIDFixture()
+	t1.Update(p, 1000)
+	clk.Add(time.Second)
+	t2.Update(p, 3000)
+
+	require.InDelta(1000, t1.Rate(p), 0.0001)
+	require.InDelta(1000, t2.Rate(p), 0.0001)
+}
+
+func TestThroughputTrackerFallsBackToMemory(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	store := newMemThroughputStore()
+	store.err = peerstore.ErrNoThroughput
+	tracker := NewThroughputTracker(
+		ThroughputConfig{HalfLife: time.Second}, clk, WithThroughputStore(store))
+
+	p := core.PeerIDFixture()
+	tracker.Update(p, 1000)
+	clk.Add(time.Second)
+	tracker.Update(p, 3000)
+
+	require.InDelta(1000, tracker.Rate(p), 0.0001)
+}
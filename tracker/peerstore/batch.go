@@ -0,0 +1,333 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announcetoken"
+)
+
+var _batchSizeBuckets = tally.MustMakeExponentialValueBuckets(1, 2, 12)
+
+type queuedUpdate struct {
+	update   PeerUpdate
+	queuedAt time.Time
+	done     chan error
+
+	// gen is the new generation of the peer, set before done is signaled if
+	// the batch was written by a VersionedBatchUpdater.
+	gen uint64
+}
+
+// GroupCommitStore wraps a Store which supports batched writes, and groups
+// concurrent UpdatePeer calls into a single write. A batch is committed once it
+// reaches MaxBatchSize, or MaxDelay after its first write was queued, whichever
+// happens first. Callers block until their batch is committed, and receive the
+// error of the batch.
+type GroupCommitStore struct {
+	Store
+
+	config  BatchConfig
+	batcher BatchUpdater
+	clk     clock.Clock
+	stats   tally.Scope
+
+	mu      sync.Mutex
+	pending []*queuedUpdate
+	timer   *clock.Timer
+}
+
+// NewGroupCommitStore creates a new GroupCommitStore which wraps store.
+func NewGroupCommitStore(
+	config BatchConfig,
+	stats tally.Scope,
+	store interface {
+		Store
+		BatchUpdater
+	},
+	clk clock.Clock) *GroupCommitStore {
+
+	config.applyDefaults()
+
+	stats = stats.Tagged(map[string]string{
+		"module": "peerstore",
+	})
+
+	return &GroupCommitStore{
+		Store:   store,
+		config:  config,
+		batcher: store,
+		clk:     clk,
+		stats:   stats,
+	}
+}
+
+// Close implements Store. Queued writes are committed before the underlying
+// store is closed.
+func (s *GroupCommitStore) Close() {
+	s.mu.Lock()
+	batch := s.takeBatch()
+	s.mu.Unlock()
+
+	s.commit(batch)
+	s.Store.Close()
+}
+
+// UpdatePeer implements Store.
+func (s *GroupCommitStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
+	_, err := s.queue(h, p)
+	return err
+}
+
+// UpdateVersionedPeer implements VersionedStore if the underlying store does.
+// Versioned writes are batched along with regular writes.
+func (s *GroupCommitStore) UpdateVersionedPeer(h core.InfoHash, p *core.PeerInfo) (uint64, error) {
+	if _, ok := s.batcher.(VersionedBatchUpdater); !ok {
+		return 0, ErrNoGenerations
+	}
+	u, err := s.queue(h, p)
+	if err != nil {
+		return 0, err
+	}
+	return u.gen, nil
+}
+
+// queue adds a write of p to the pending batch, and blocks until the batch is
+// committed.
+func (s *GroupCommitStore) queue(h core.InfoHash, p *core.PeerInfo) (*queuedUpdate, error) {
+	u := &queuedUpdate{
+		update:   PeerUpdate{h, p},
+		queuedAt: s.clk.Now(),
+		done:     make(chan error, 1),
+	}
+
+	s.mu.Lock()
+	s.pending = append(s.pending, u)
+	var batch []*queuedUpdate
+	if len(s.pending) >= s.config.MaxBatchSize {
+		batch = s.takeBatch()
+	} else if s.timer == nil {
+		s.timer = s.clk.AfterFunc(s.config.MaxDelay, s.commitPending)
+	}
+	s.mu.Unlock()
+
+	// The write which fills a batch commits it, rather than handing off to
+	// another goroutine.
+	s.commit(batch)
+
+	return u, <-u.done
+}
+
+// HottestInfoHashes implements HotInfoHashLister if the underlying store does.
+func (s *GroupCommitStore) HottestInfoHashes(n int) ([]core.InfoHash, error) {
+	l, ok := s.Store.(HotInfoHashLister)
+	if !ok {
+		return nil, errors.New("underlying store does not count announces")
+	}
+	return l.HottestInfoHashes(n)
+}
+
+// Scrape implements Scraper if the underlying store does.
+func (s *GroupCommitStore) Scrape(hashes []core.InfoHash) ([]SwarmStats, error) {
+	sc, ok := s.Store.(Scraper)
+	if !ok {
+		return nil, ErrNoScrape
+	}
+	return sc.Scrape(hashes)
+}
+
+// Usage implements Compactor if the underlying store does.
+func (s *GroupCommitStore) Usage() (Usage, error) {
+	c, ok := s.Store.(Compactor)
+	if !ok {
+		return nil, ErrNoCompaction
+	}
+	return c.Usage()
+}
+
+// Compact implements Compactor if the underlying store does.
+func (s *GroupCommitStore) Compact() (int, error) {
+	c, ok := s.Store.(Compactor)
+	if !ok {
+		return 0, ErrNoCompaction
+	}
+	return c.Compact()
+}
+
+// DeleteExpiredPeers implements ExpiredPeerDeleter if the underlying store
+// does.
+func (s *GroupCommitStore) DeleteExpiredPeers() (int, error) {
+	d, ok := s.Store.(ExpiredPeerDeleter)
+	if !ok {
+		return 0, ErrNoExpiredPeerDeletion
+	}
+	return d.DeleteExpiredPeers()
+}
+
+// DeleteTorrent implements TorrentDeleter if the underlying store does. Writes
+// of h queued before the deletion may still be committed after it.
+func (s *GroupCommitStore) DeleteTorrent(h core.InfoHash) (int, error) {
+	d, ok := s.Store.(TorrentDeleter)
+	if !ok {
+		return 0, ErrNoDeletion
+	}
+	return d.DeleteTorrent(h)
+}
+
+// GetThroughput implements ThroughputStore if the underlying store does.
+func (s *GroupCommitStore) GetThroughput(ids []core.PeerID) (map[core.PeerID]ThroughputRecord, error) {
+	t, ok := s.Store.(ThroughputStore)
+	if !ok {
+		return nil, ErrNoThroughput
+	}
+	return t.GetThroughput(ids)
+}
+
+// SetThroughput implements ThroughputStore if the underlying store does.
+func (s *GroupCommitStore) SetThroughput(
+	id core.PeerID, r ThroughputRecord, ttl time.Duration) error {
+
+	t, ok := s.Store.(ThroughputStore)
+	if !ok {
+		return ErrNoThroughput
+	}
+	return t.SetThroughput(id, r, ttl)
+}
+
+// UseNonce implements announcetoken.Store if the underlying store does.
+func (s *GroupCommitStore) UseNonce(nonce string, ttl time.Duration) (bool, error) {
+	t, ok := s.Store.(announcetoken.Store)
+	if !ok {
+		return false, announcetoken.ErrNoStore
+	}
+	return t.UseNonce(nonce, ttl)
+}
+
+// RestrictTorrent implements announcetoken.Store if the underlying store does.
+func (s *GroupCommitStore) RestrictTorrent(h core.InfoHash, ttl time.Duration) error {
+	t, ok := s.Store.(announcetoken.Store)
+	if !ok {
+		return announcetoken.ErrNoStore
+	}
+	return t.RestrictTorrent(h, ttl)
+}
+
+// RestrictedTorrent implements announcetoken.Store if the underlying store
+// does.
+func (s *GroupCommitStore) RestrictedTorrent(h core.InfoHash) (bool, error) {
+	t, ok := s.Store.(announcetoken.Store)
+	if !ok {
+		return false, announcetoken.ErrNoStore
+	}
+	return t.RestrictedTorrent(h)
+}
+
+// GetInfoHashesByHost implements PeerIndex if the underlying store does.
+func (s *GroupCommitStore) GetInfoHashesByHost(host string) ([]core.InfoHash, error) {
+	i, ok := s.Store.(PeerIndex)
+	if !ok {
+		return nil, ErrNoPeerIndex
+	}
+	return i.GetInfoHashesByHost(host)
+}
+
+// GetPeersByZone implements PeerIndex if the underlying store does.
+func (s *GroupCommitStore) GetPeersByZone(
+	h core.InfoHash, zone string) ([]*core.PeerInfo, error) {
+
+	i, ok := s.Store.(PeerIndex)
+	if !ok {
+		return nil, ErrNoPeerIndex
+	}
+	return i.GetPeersByZone(h, zone)
+}
+
+// GetPeerGeneration implements VersionedStore if the underlying store does.
+func (s *GroupCommitStore) GetPeerGeneration(h core.InfoHash, id core.PeerID) (uint64, error) {
+	v, ok := s.Store.(VersionedStore)
+	if !ok {
+		return 0, ErrNoGenerations
+	}
+	return v.GetPeerGeneration(h, id)
+}
+
+// CompareAndUpdatePeer implements VersionedStore if the underlying store does.
+// Compare-and-set writes are not batched.
+func (s *GroupCommitStore) CompareAndUpdatePeer(
+	h core.InfoHash, p *core.PeerInfo, gen uint64) (uint64, error) {
+
+	v, ok := s.Store.(VersionedStore)
+	if !ok {
+		return 0, ErrNoGenerations
+	}
+	return v.CompareAndUpdatePeer(h, p, gen)
+}
+
+// takeBatch removes and returns all pending writes. Must be called with s.mu
+// held.
+func (s *GroupCommitStore) takeBatch() []*queuedUpdate {
+	batch := s.pending
+	s.pending = nil
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	return batch
+}
+
+func (s *GroupCommitStore) commitPending() {
+	s.mu.Lock()
+	batch := s.takeBatch()
+	s.mu.Unlock()
+
+	s.commit(batch)
+}
+
+func (s *GroupCommitStore) commit(batch []*queuedUpdate) {
+	if len(batch) == 0 {
+		return
+	}
+	start := s.clk.Now()
+	updates := make([]PeerUpdate, len(batch))
+	for i, u := range batch {
+		updates[i] = u.update
+		s.stats.Timer("batch_wait").Record(start.Sub(u.queuedAt))
+	}
+	s.stats.Histogram("batch_size", _batchSizeBuckets).RecordValue(float64(len(batch)))
+
+	var gens []uint64
+	var err error
+	if vb, ok := s.batcher.(VersionedBatchUpdater); ok {
+		gens, err = vb.UpdateVersionedPeers(updates)
+	} else {
+		err = s.batcher.UpdatePeers(updates)
+	}
+	s.stats.Timer("batch_commit").Record(s.clk.Now().Sub(start))
+	if err != nil {
+		s.stats.Counter("batch_errors").Inc(1)
+	}
+	for i, u := range batch {
+		if err == nil && gens != nil {
+			u.gen = gens[i]
+		}
+		u.done <- err
+	}
+}
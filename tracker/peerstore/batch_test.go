@@ -0,0 +1,209 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+)
+
+// batchTestStore records the batches it is asked to write.
+type batchTestStore struct {
+	Store
+
+	mu      sync.Mutex
+	batches [][]PeerUpdate
+	err     error
+}
+
+func newBatchTestStore() *batchTestStore {
+	return &batchTestStore{Store: NewTestStore()}
+}
+
+func (s *batchTestStore) UpdatePeers(updates []PeerUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, updates)
+	if s.err != nil {
+		return s.err
+	}
+	for _, u := range updates {
+		if err := s.Store.UpdatePeer(u.InfoHash, u.Peer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *batchTestStore) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sizes []int
+	for _, b := range s.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+// updateConcurrently calls UpdatePeer for each peer, returning a channel of
+// their errors.
+func updateConcurrently(s Store, h core.InfoHash, peers []*core.PeerInfo) chan error {
+	errc := make(chan error, len(peers))
+	for _, p := range peers {
+		go func(p *core.PeerInfo) { errc <- s.UpdatePeer(h, p) }(p)
+	}
+	return errc
+}
+
+func TestGroupCommitStoreCommitsFullBatch(t *testing.T) {
+	require := require.New(t)
+
+	underlying := newBatchTestStore()
+	s := NewGroupCommitStore(
+		BatchConfig{MaxBatchSize: 3, MaxDelay: time.Hour},
+		tally.NoopScope, underlying, clock.NewMock())
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	peers := []*core.PeerInfo{
+		core.PeerInfoFixture(), core.PeerInfoFixture(), core.PeerInfoFixture(),
+	}
+	errc := updateConcurrently(s, h, peers)
+	for range peers {
+		require.NoError(<-errc)
+	}
+	require.Equal([]int{3}, underlying.batchSizes())
+
+	result, err := s.GetPeers(h, 3)
+	require.NoError(err)
+	require.ElementsMatch(peers, result)
+}
+
+func TestGroupCommitStoreCommitsPartialBatchAfterMaxDelay(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	underlying := newBatchTestStore()
+	s := NewGroupCommitStore(
+		BatchConfig{MaxBatchSize: 10, MaxDelay: 5 * time.Millisecond},
+		tally.NoopScope, underlying, clk)
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture(), core.PeerInfoFixture()}
+	errc := updateConcurrently(s, h, peers)
+
+	// Wait for both writes to be queued.
+	for {
+		s.mu.Lock()
+		n := len(s.pending)
+		s.mu.Unlock()
+		if n == len(peers) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.Empty(underlying.batchSizes())
+
+	clk.Add(5 * time.Millisecond)
+
+	for range peers {
+		require.NoError(<-errc)
+	}
+	require.Equal([]int{2}, underlying.batchSizes())
+}
+
+func TestGroupCommitStoreReturnsBatchErrorToAllWriters(t *testing.T) {
+	require := require.New(t)
+
+	underlying := newBatchTestStore()
+	underlying.err = errors.New("some error")
+	s := NewGroupCommitStore(
+		BatchConfig{MaxBatchSize: 2, MaxDelay: time.Hour},
+		tally.NoopScope, underlying, clock.NewMock())
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture(), core.PeerInfoFixture()}
+	errc := updateConcurrently(s, h, peers)
+	for range peers {
+		require.Equal(underlying.err, <-errc)
+	}
+}
+
+func TestGroupCommitStoreCloseCommitsPendingWrites(t *testing.T) {
+	require := require.New(t)
+
+	underlying := newBatchTestStore()
+	s := NewGroupCommitStore(
+		BatchConfig{MaxBatchSize: 10, MaxDelay: time.Hour},
+		tally.NoopScope, underlying, clock.NewMock())
+
+	h := core.InfoHashFixture()
+	errc := updateConcurrently(s, h, []*core.PeerInfo{core.PeerInfoFixture()})
+
+	for {
+		s.mu.Lock()
+		n := len(s.pending)
+		s.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Close()
+
+	require.NoError(<-errc)
+	require.Equal([]int{1}, underlying.batchSizes())
+}
+
+func TestRedisStoreUpdatePeersWritesAllUpdates(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	config.IndexPeers = true
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+	p2.Complete = true
+
+	require.NoError(s.UpdatePeers([]PeerUpdate{{h1, p1}, {h1, p2}, {h2, p1}}))
+
+	peers, err := s.GetPeers(h1, 10)
+	require.NoError(err)
+	require.ElementsMatch([]*core.PeerInfo{p1, p2}, peers)
+
+	peers, err = s.GetPeers(h2, 10)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p1}, peers)
+
+	hashes, err := s.GetInfoHashesByHost(p1.IP)
+	require.NoError(err)
+	require.ElementsMatch([]core.InfoHash{h1, h2}, hashes)
+}
@@ -20,21 +20,72 @@ import (
 // Config defines Store configuration.
 //
 // NOTE: By default, the LocalStore implementation is used. Redis configuration
-// is ignored unless RedisConfig.Enabled is true.
+// is ignored unless RedisConfig.Enabled is true, and both are ignored if Driver
+// is set.
 type Config struct {
-	Local LocalConfig `yaml:"local"`
-	Redis RedisConfig `yaml:"redis"`
+	Local     LocalConfig     `yaml:"local"`
+	Redis     RedisConfig     `yaml:"redis"`
+	Partition PartitionConfig `yaml:"partition"`
+	Batch     BatchConfig     `yaml:"batch"`
+
+	// Driver selects a Store registered via Register, which is created from
+	// DriverConfig.
+	Driver       string      `yaml:"driver"`
+	DriverConfig interface{} `yaml:"driver_config"`
 }
 
 // LocalConfig defines LocalStore configuration.
 type LocalConfig struct {
 	TTL time.Duration `yaml:"ttl"`
+
+	// TTLJitter adds a random duration in [0, TTLJitter) to the TTL of each
+	// peer, such that peers which announced together do not all expire at
+	// the same time.
+	TTLJitter time.Duration `yaml:"ttl_jitter"`
+
+	// ExpiryBatchSize limits the number of expired peers removed before the
+	// cleanup pauses for ExpiryBatchInterval, releasing locks to announces.
+	ExpiryBatchSize     int           `yaml:"expiry_batch_size"`
+	ExpiryBatchInterval time.Duration `yaml:"expiry_batch_interval"`
+
+	// LockShards is the number of locks torrents and hosts are sharded
+	// across, such that announces for different torrents rarely contend.
+	LockShards int `yaml:"lock_shards"`
+
+	// TrackLastSeen records when each peer last announced, such that
+	// trackers can withhold peers which are about to expire.
+	TrackLastSeen bool `yaml:"track_last_seen"`
+}
+
+// TTL returns how long peers are stored after their last announce, or 0 if
+// unknown, e.g. for stores created by drivers. TTL jitter is not included.
+func (c Config) TTL() time.Duration {
+	if c.Driver != "" {
+		return 0
+	}
+	if c.Redis.Enabled {
+		redis := c.Redis
+		redis.applyDefaults()
+		return redis.PeerSetWindowSize * time.Duration(redis.MaxPeerSetWindows)
+	}
+	local := c.Local
+	local.applyDefaults()
+	return local.TTL
 }
 
 func (c *LocalConfig) applyDefaults() {
 	if c.TTL == 0 {
 		c.TTL = 5 * time.Hour
 	}
+	if c.ExpiryBatchSize == 0 {
+		c.ExpiryBatchSize = 1000
+	}
+	if c.ExpiryBatchInterval == 0 {
+		c.ExpiryBatchInterval = 10 * time.Millisecond
+	}
+	if c.LockShards == 0 {
+		c.LockShards = 256
+	}
 }
 
 // RedisConfig defines RedisStore configuration.
@@ -50,6 +101,52 @@ type RedisConfig struct {
 	MaxIdleConns      int           `yaml:"max_idle_conns"`
 	MaxActiveConns    int           `yaml:"max_active_conns"`
 	IdleConnTimeout   time.Duration `yaml:"idle_conn_timeout"`
+
+	// TTLJitter adds a random duration in [0, TTLJitter) to the expiry of
+	// peer keys, such that keys written in the same window do not all expire
+	// at the same time. Rounded down to whole seconds.
+	TTLJitter time.Duration `yaml:"ttl_jitter"`
+
+	// TrackAnnounceCounts enables counting announces per infohash, such that
+	// restarted trackers can warm up the most popular torrents first.
+	TrackAnnounceCounts bool `yaml:"track_announce_counts"`
+
+	// IndexPeers enables maintaining secondary indexes of peers by host and
+	// by zone, at the cost of additional writes per announce.
+	IndexPeers bool `yaml:"index_peers"`
+
+	// TrackLastSeen records when each peer last announced, such that
+	// trackers can withhold peers which are about to expire. Costs an
+	// additional write per announce and an additional round trip per
+	// handout.
+	TrackLastSeen bool `yaml:"track_last_seen"`
+
+	// KeyPrefix is prepended to every key, such that multiple tracker clusters
+	// can share a Redis deployment.
+	KeyPrefix string `yaml:"key_prefix"`
+
+	// Sentinel discovers the Redis master through Redis Sentinel. Addr is
+	// ignored if configured.
+	Sentinel RedisSentinelConfig `yaml:"sentinel"`
+}
+
+// RedisSentinelConfig defines Redis Sentinel configuration.
+type RedisSentinelConfig struct {
+	// Addrs are the addresses of the sentinels, which are asked for the
+	// master in order.
+	Addrs []string `yaml:"addrs"`
+
+	// MasterName is the name the sentinels monitor the master under.
+	MasterName string `yaml:"master_name"`
+
+	// RoleCheckInterval is how long pooled connections may idle before they
+	// are checked to still be connected to the master, such that connections
+	// to demoted masters are dropped after failovers.
+	RoleCheckInterval time.Duration `yaml:"role_check_interval"`
+}
+
+func (c RedisSentinelConfig) enabled() bool {
+	return len(c.Addrs) > 0
 }
 
 func (c *RedisConfig) applyDefaults() {
@@ -77,4 +174,58 @@ func (c *RedisConfig) applyDefaults() {
 	if c.IdleConnTimeout == 0 {
 		c.IdleConnTimeout = 60 * time.Second
 	}
+	if c.Sentinel.RoleCheckInterval == 0 {
+		c.Sentinel.RoleCheckInterval = time.Second
+	}
+}
+
+// PartitionConfig defines PartitionTolerantStore configuration. If disabled,
+// storage errors are surfaced directly to callers.
+type PartitionConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// StaleTTL is the max age of cached peers served while the store is
+	// unavailable.
+	StaleTTL time.Duration `yaml:"stale_ttl"`
+
+	// MaxPendingWrites limits the number of distinct peer writes queued while
+	// the store is unavailable.
+	MaxPendingWrites int `yaml:"max_pending_writes"`
+
+	// ReconcileInterval is the interval at which queued writes are replayed.
+	ReconcileInterval time.Duration `yaml:"reconcile_interval"`
+}
+
+func (c *PartitionConfig) applyDefaults() {
+	if c.StaleTTL == 0 {
+		c.StaleTTL = 10 * time.Minute
+	}
+	if c.MaxPendingWrites == 0 {
+		c.MaxPendingWrites = 100000
+	}
+	if c.ReconcileInterval == 0 {
+		c.ReconcileInterval = 5 * time.Second
+	}
+}
+
+// BatchConfig defines GroupCommitStore configuration. Only applies to the Redis
+// store, since the local store does not benefit from batching.
+type BatchConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxBatchSize is the number of queued writes which triggers a commit.
+	MaxBatchSize int `yaml:"max_batch_size"`
+
+	// MaxDelay is the longest a write waits for its batch to fill before the
+	// batch is committed.
+	MaxDelay time.Duration `yaml:"max_delay"`
+}
+
+func (c *BatchConfig) applyDefaults() {
+	if c.MaxBatchSize == 0 {
+		c.MaxBatchSize = 100
+	}
+	if c.MaxDelay == 0 {
+		c.MaxDelay = 5 * time.Millisecond
+	}
 }
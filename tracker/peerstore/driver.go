@@ -0,0 +1,46 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"fmt"
+
+	"github.com/uber-go/tally"
+)
+
+var _drivers = make(map[string]Driver)
+
+// Driver creates Stores which are not built into Kraken. Drivers register
+// themselves in init functions, such that compiling a driver package into the
+// tracker makes it selectable by name through Config.Driver.
+type Driver interface {
+	// Create creates a Store from config, which is the raw Config.DriverConfig
+	// yaml, typically re-marshalled into a driver-specific struct.
+	Create(config interface{}, stats tally.Scope) (Store, error)
+}
+
+// Register registers driver under name. Registering a name twice replaces the
+// previous driver.
+func Register(name string, driver Driver) {
+	_drivers[name] = driver
+}
+
+// getDriver returns the driver registered under name.
+func getDriver(name string) (Driver, error) {
+	driver, ok := _drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("no peer store driver registered with name %s", name)
+	}
+	return driver, nil
+}
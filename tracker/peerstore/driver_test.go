@@ -0,0 +1,109 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"gopkg.in/yaml.v2"
+)
+
+type testDriverConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// testDriver creates LocalStores, recording the config it was created with.
+type testDriver struct {
+	config testDriverConfig
+}
+
+func (d *testDriver) Create(config interface{}, stats tally.Scope) (Store, error) {
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, &d.config); err != nil {
+		return nil, err
+	}
+	if d.config.TTL < 0 {
+		return nil, errors.New("negative ttl")
+	}
+	return NewLocalStore(LocalConfig{TTL: d.config.TTL}, clock.New()), nil
+}
+
+func TestNewWithRegisteredDriver(t *testing.T) {
+	require := require.New(t)
+
+	driver := &testDriver{}
+	Register("test", driver)
+
+	var config Config
+	require.NoError(yaml.Unmarshal([]byte(`
+driver: test
+driver_config:
+  ttl: 1h
+`), &config))
+
+	s, err := New(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	require.Equal(time.Hour, driver.config.TTL)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestNewWithDriverAppliesPartitionTolerance(t *testing.T) {
+	require := require.New(t)
+
+	Register("test", &testDriver{})
+
+	s, err := New(Config{
+		Driver:    "test",
+		Partition: PartitionConfig{Enabled: true},
+	}, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	_, ok := s.(*PartitionTolerantStore)
+	require.True(ok)
+}
+
+func TestNewWithUnknownDriver(t *testing.T) {
+	_, err := New(Config{Driver: "unknown"}, tally.NoopScope)
+	require.Error(t, err)
+}
+
+func TestNewWithFailingDriver(t *testing.T) {
+	Register("test", &testDriver{})
+
+	_, err := New(Config{
+		Driver:       "test",
+		DriverConfig: map[string]interface{}{"ttl": "-1h"},
+	}, tally.NoopScope)
+	require.Error(t, err)
+}
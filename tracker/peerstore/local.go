@@ -15,12 +15,14 @@ package peerstore
 
 import (
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/uber/kraken/core"
 	_ "github.com/uber/kraken/utils/randutil" // For seeded global rand.
+	"github.com/uber/kraken/utils/syncutil"
 )
 
 const (
@@ -38,17 +40,35 @@ type LocalStore struct {
 	stopOnce sync.Once
 	stop     chan struct{}
 
-	mu         sync.RWMutex
-	peerGroups map[core.InfoHash]*peerGroup
+	// Peer groups are sharded by infohash, such that announces for different
+	// torrents do not contend on a single lock when creating groups.
+	groupLocks syncutil.ShardedLocks
+	peerGroups []map[core.InfoHash]*peerGroup
+
+	// hosts indexes the torrents each host announced for, along with when
+	// the host's most recent announce for the torrent expires. Sharded by
+	// host.
+	hostLocks syncutil.ShardedLocks
+	hosts     []map[string]map[core.InfoHash]time.Time
 }
 
 type peerGroup struct {
 	mu sync.RWMutex
 
-	// Same peerEntry references in both, just indexed differently.
-	peerList []*peerEntry
+	// Same peerEntry references in the lists and the map, just indexed
+	// differently. Seeders and leechers are kept in separate lists such that
+	// each can be sampled independently.
+	seeders  []*peerEntry
+	leechers []*peerEntry
 	peerMap  map[core.PeerID]*peerEntry
 
+	// zones indexes the same peerEntry references by zone.
+	zones map[string]map[core.PeerID]*peerEntry
+
+	// completed holds the ids of non-origin peers which announced as
+	// complete, for as long as the group exists.
+	completed map[core.PeerID]struct{}
+
 	lastExpiresAt time.Time
 	deleted       bool
 }
@@ -56,9 +76,98 @@ type peerGroup struct {
 type peerEntry struct {
 	id        core.PeerID
 	ip        string
+	ipv6      string
+	networks  map[string]string
 	port      int
+	hostname  string
+	zone      string
+	rack      string
+	dc        string
 	complete  bool
 	expiresAt time.Time
+
+	// lastSeen is zero unless last seen times are tracked.
+	lastSeen time.Time
+
+	// generation is incremented by every write of the entry.
+	generation uint64
+
+	// index is the position of the entry within its seeders / leechers list.
+	index int
+}
+
+func (g *peerGroup) list(complete bool) *[]*peerEntry {
+	if complete {
+		return &g.seeders
+	}
+	return &g.leechers
+}
+
+// add appends e to the list matching its completeness. Must be called with
+// g.mu held.
+func (g *peerGroup) add(e *peerEntry) {
+	l := g.list(e.complete)
+	e.index = len(*l)
+	*l = append(*l, e)
+}
+
+// remove removes e from the list matching its completeness. Must be called
+// with g.mu held.
+func (g *peerGroup) remove(e *peerEntry) {
+	l := g.list(e.complete)
+	last := (*l)[len(*l)-1]
+	(*l)[e.index] = last
+	last.index = e.index
+	*l = (*l)[:len(*l)-1]
+}
+
+// indexZone adds e to the zone index. Must be called with g.mu held.
+func (g *peerGroup) indexZone(e *peerEntry) {
+	if e.zone == "" {
+		return
+	}
+	z, ok := g.zones[e.zone]
+	if !ok {
+		z = make(map[core.PeerID]*peerEntry)
+		g.zones[e.zone] = z
+	}
+	z[e.id] = e
+}
+
+// unindexZone removes e from the zone index. Must be called with g.mu held.
+func (g *peerGroup) unindexZone(e *peerEntry) {
+	z, ok := g.zones[e.zone]
+	if !ok {
+		return
+	}
+	delete(z, e.id)
+	if len(z) == 0 {
+		delete(g.zones, e.zone)
+	}
+}
+
+// get returns the i-th entry across both lists, seeders first.
+func (g *peerGroup) get(i int) *peerEntry {
+	if i < len(g.seeders) {
+		return g.seeders[i]
+	}
+	return g.leechers[i-len(g.seeders)]
+}
+
+func (g *peerGroup) size() int {
+	return len(g.seeders) + len(g.leechers)
+}
+
+func (e *peerEntry) peerInfo() *core.PeerInfo {
+	p := core.NewPeerInfo(e.id, e.ip, e.port, false /* origin */, e.complete)
+	p.Hostname = e.hostname
+	p.Zone = e.zone
+	p.Rack = e.rack
+	p.DC = e.dc
+	p.IPv6 = e.ipv6
+	p.Networks = e.networks
+	p.LastSeen = e.lastSeen
+	return p
 }
 
 // NewLocalStore creates a new LocalStore.
@@ -70,7 +179,16 @@ func NewLocalStore(config LocalConfig, clk clock.Clock) *LocalStore {
 		cleanupExpiredPeerEntriesTicker: time.NewTicker(_cleanupExpiredPeerEntriesInterval),
 		cleanupExpiredPeerGroupsTicker:  time.NewTicker(_cleanupExpiredPeerGroupsInterval),
 		stop:                            make(chan struct{}),
-		peerGroups:                      make(map[core.InfoHash]*peerGroup),
+		groupLocks:                      syncutil.NewShardedLocks(config.LockShards),
+		hostLocks:                       syncutil.NewShardedLocks(config.LockShards),
+	}
+	s.peerGroups = make([]map[core.InfoHash]*peerGroup, s.groupLocks.Len())
+	for i := range s.peerGroups {
+		s.peerGroups[i] = make(map[core.InfoHash]*peerGroup)
+	}
+	s.hosts = make([]map[string]map[core.InfoHash]time.Time, s.hostLocks.Len())
+	for i := range s.hosts {
+		s.hosts[i] = make(map[string]map[core.InfoHash]time.Time)
 	}
 	go s.cleanupTask()
 	return s
@@ -83,9 +201,7 @@ func (s *LocalStore) Close() {
 
 // GetPeers implements Store.
 func (s *LocalStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
-	s.mu.RLock()
-	g, ok := s.peerGroups[h]
-	s.mu.RUnlock()
+	g, ok := s.getPeerGroup(h)
 	if !ok {
 		return nil, nil
 	}
@@ -93,8 +209,8 @@ func (s *LocalStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
-	if len(g.peerList) < n {
-		n = len(g.peerList)
+	if g.size() < n {
+		n = g.size()
 	}
 	if n <= 0 {
 		return nil, nil
@@ -103,40 +219,251 @@ func (s *LocalStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 	result := make([]*core.PeerInfo, 0, n)
 
 	// Select n random indexes.
-	indexes := rand.Perm(len(g.peerList))
+	indexes := rand.Perm(g.size())
 	indexes = indexes[:n]
 
 	for _, i := range indexes {
 		// Note, we elect to return slightly expired entries rather than iterate
 		// until we find n valid entries.
-		e := g.peerList[i]
-		result = append(result, core.NewPeerInfo(e.id, e.ip, e.port, false /* origin */, e.complete))
+		result = append(result, g.get(i).peerInfo())
 	}
 	return result, nil
 }
 
+// GetSeedersAndLeechers implements Store.
+func (s *LocalStore) GetSeedersAndLeechers(
+	h core.InfoHash, nSeeders, nLeechers int) (seeders, leechers []*core.PeerInfo, err error) {
+
+	g, ok := s.getPeerGroup(h)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return sampleEntries(g.seeders, nSeeders), sampleEntries(g.leechers, nLeechers), nil
+}
+
+func sampleEntries(entries []*peerEntry, n int) []*core.PeerInfo {
+	if len(entries) < n {
+		n = len(entries)
+	}
+	if n <= 0 {
+		return nil
+	}
+	result := make([]*core.PeerInfo, 0, n)
+	for _, i := range rand.Perm(len(entries))[:n] {
+		result = append(result, entries[i].peerInfo())
+	}
+	return result
+}
+
+// EstimatePeerCount implements Store. Counts are exact, but may include
+// expired peers which have not yet been cleaned up.
+func (s *LocalStore) EstimatePeerCount(h core.InfoHash) (seeders, leechers int, err error) {
+	g, ok := s.getPeerGroup(h)
+	if !ok {
+		return 0, 0, nil
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return len(g.seeders), len(g.leechers), nil
+}
+
+// Scrape implements Scraper. Like EstimatePeerCount, counts may include
+// expired peers which have not yet been cleaned up.
+func (s *LocalStore) Scrape(hashes []core.InfoHash) ([]SwarmStats, error) {
+	stats := make([]SwarmStats, len(hashes))
+	for i, h := range hashes {
+		g, ok := s.getPeerGroup(h)
+		if !ok {
+			continue
+		}
+		g.mu.RLock()
+		stats[i] = SwarmStats{
+			Seeders:   len(g.seeders),
+			Leechers:  len(g.leechers),
+			Completed: len(g.completed),
+		}
+		g.mu.RUnlock()
+	}
+	return stats, nil
+}
+
 // UpdatePeer implements Store.
 func (s *LocalStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
 	g := s.getOrInitLockedPeerGroup(h)
 	defer g.mu.Unlock()
 
+	s.updateEntry(g, h, p)
+	return nil
+}
+
+// GetPeerGeneration implements VersionedStore.
+func (s *LocalStore) GetPeerGeneration(h core.InfoHash, id core.PeerID) (uint64, error) {
+	g, ok := s.getPeerGroup(h)
+	if !ok {
+		return 0, nil
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.generation(id), nil
+}
+
+// UpdateVersionedPeer implements VersionedStore.
+func (s *LocalStore) UpdateVersionedPeer(h core.InfoHash, p *core.PeerInfo) (uint64, error) {
+	g := s.getOrInitLockedPeerGroup(h)
+	defer g.mu.Unlock()
+
+	return s.updateEntry(g, h, p), nil
+}
+
+// CompareAndUpdatePeer implements VersionedStore.
+func (s *LocalStore) CompareAndUpdatePeer(
+	h core.InfoHash, p *core.PeerInfo, gen uint64) (uint64, error) {
+
+	g := s.getOrInitLockedPeerGroup(h)
+	defer g.mu.Unlock()
+
+	if g.generation(p.PeerID) != gen {
+		return 0, ErrGenerationConflict
+	}
+	return s.updateEntry(g, h, p), nil
+}
+
+// generation returns the generation of the entry of id, or 0 if there is no
+// such entry. Must be called with g.mu held.
+func (g *peerGroup) generation(id core.PeerID) uint64 {
+	if e, ok := g.peerMap[id]; ok {
+		return e.generation
+	}
+	return 0
+}
+
+// updateEntry writes p to g, returning the new generation of its entry. Must
+// be called with g.mu held.
+func (s *LocalStore) updateEntry(g *peerGroup, h core.InfoHash, p *core.PeerInfo) uint64 {
 	e, ok := g.peerMap[p.PeerID]
 	if !ok {
-		e = &peerEntry{}
-		g.peerList = append(g.peerList, e)
+		e = &peerEntry{complete: p.Complete}
+		g.add(e)
 		g.peerMap[p.PeerID] = e
+	} else if e.complete != p.Complete {
+		g.remove(e)
+		e.complete = p.Complete
+		g.add(e)
+	}
+	if ok && e.zone != p.Zone {
+		g.unindexZone(e)
 	}
 	e.id = p.PeerID
 	e.ip = p.IP
+	e.ipv6 = p.IPv6
+	e.networks = p.Networks
 	e.port = p.Port
-	e.complete = p.Complete
-	e.expiresAt = s.clk.Now().Add(s.config.TTL)
+	e.hostname = p.Hostname
+	e.zone = p.Zone
+	e.rack = p.Rack
+	e.dc = p.DC
+	now := s.clk.Now()
+	e.expiresAt = now.Add(s.ttl())
+	if s.config.TrackLastSeen {
+		e.lastSeen = now
+	}
+	e.generation++
+	g.indexZone(e)
+	if p.Complete && !p.Origin {
+		g.completed[p.PeerID] = struct{}{}
+	}
+
+	s.indexHosts(h, p, e.expiresAt)
 
 	// Allows cleanupExpiredPeerGroups to quickly determine when the last
-	// peerEntry expires.
-	g.lastExpiresAt = e.expiresAt
+	// peerEntry expires. Since TTLs are jittered, a later update does not
+	// necessarily expire later.
+	if e.expiresAt.After(g.lastExpiresAt) {
+		g.lastExpiresAt = e.expiresAt
+	}
 
-	return nil
+	return e.generation
+}
+
+// ttl returns the jittered TTL of a peer entry.
+func (s *LocalStore) ttl() time.Duration {
+	if s.config.TTLJitter <= 0 {
+		return s.config.TTL
+	}
+	return s.config.TTL + time.Duration(rand.Int63n(int64(s.config.TTLJitter)))
+}
+
+func (s *LocalStore) indexHosts(h core.InfoHash, p *core.PeerInfo, expiresAt time.Time) {
+	for _, host := range peerHosts(p) {
+		s.indexHost(h, host, expiresAt)
+	}
+}
+
+func (s *LocalStore) indexHost(h core.InfoHash, host string, expiresAt time.Time) {
+	i := s.hostLocks.Shard([]byte(host))
+	mu := s.hostLocks.Get(i)
+	mu.Lock()
+	defer mu.Unlock()
+
+	hashes, ok := s.hosts[i][host]
+	if !ok {
+		hashes = make(map[core.InfoHash]time.Time)
+		s.hosts[i][host] = hashes
+	}
+	hashes[h] = expiresAt
+}
+
+// GetInfoHashesByHost implements PeerIndex.
+func (s *LocalStore) GetInfoHashesByHost(host string) ([]core.InfoHash, error) {
+	i := s.hostLocks.Shard([]byte(host))
+	mu := s.hostLocks.Get(i)
+	mu.RLock()
+	defer mu.RUnlock()
+
+	now := s.clk.Now()
+	var result []core.InfoHash
+	for h, expiresAt := range s.hosts[i][host] {
+		if now.Before(expiresAt) {
+			result = append(result, h)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Hex() < result[j].Hex() })
+	return result, nil
+}
+
+// GetPeersByZone implements PeerIndex.
+func (s *LocalStore) GetPeersByZone(h core.InfoHash, zone string) ([]*core.PeerInfo, error) {
+	g, ok := s.getPeerGroup(h)
+	if !ok {
+		return nil, nil
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var result []*core.PeerInfo
+	for _, e := range g.zones[zone] {
+		result = append(result, e.peerInfo())
+	}
+	return core.SortedByPeerID(result), nil
+}
+
+func (s *LocalStore) getPeerGroup(h core.InfoHash) (*peerGroup, bool) {
+	i := s.groupLocks.Shard(h.Bytes())
+	mu := s.groupLocks.Get(i)
+	mu.RLock()
+	defer mu.RUnlock()
+
+	g, ok := s.peerGroups[i][h]
+	return g, ok
 }
 
 func (s *LocalStore) getOrInitLockedPeerGroup(h core.InfoHash) *peerGroup {
@@ -145,25 +472,36 @@ func (s *LocalStore) getOrInitLockedPeerGroup(h core.InfoHash) *peerGroup {
 	// executes getOrInitLockedPeerGroup and B executes
 	// cleanupExpiredPeerGroups:
 	//
-	// A: locks s.mu, reads g from s.peerGroups, unlocks s.mu
-	// B: locks s.mu, locks g.mu, deletes g from s.peerGroups, unlocks g.mu
+	// A: locks shard, reads g from s.peerGroups, unlocks shard
+	// B: locks shard, locks g.mu, deletes g from s.peerGroups, unlocks g.mu
 	// A: locks g.mu
 	//
 	// At this point, A is holding onto a peerGroup reference which has been
 	// deleted from the peerGroups map, and thus has no choice but to attempt to
 	// reload a new peerGroup. Since the cleanup interval is quite large, it is
 	// *extremely* unlikely this for-loop will execute more than twice.
+	i := s.groupLocks.Shard(h.Bytes())
+	mu := s.groupLocks.Get(i)
 	for {
-		s.mu.Lock()
-		g, ok := s.peerGroups[h]
+		// Most announces are for existing groups, so try a read lock first.
+		mu.RLock()
+		g, ok := s.peerGroups[i][h]
+		mu.RUnlock()
+
 		if !ok {
-			g = &peerGroup{
-				peerMap:       make(map[core.PeerID]*peerEntry),
-				lastExpiresAt: s.clk.Now().Add(s.config.TTL),
+			mu.Lock()
+			g, ok = s.peerGroups[i][h]
+			if !ok {
+				g = &peerGroup{
+					peerMap:       make(map[core.PeerID]*peerEntry),
+					zones:         make(map[string]map[core.PeerID]*peerEntry),
+					completed:     make(map[core.PeerID]struct{}),
+					lastExpiresAt: s.clk.Now().Add(s.config.TTL),
+				}
+				s.peerGroups[i][h] = g
 			}
-			s.peerGroups[h] = g
+			mu.Unlock()
 		}
-		s.mu.Unlock()
 
 		g.mu.Lock()
 		if g.deleted {
@@ -180,74 +518,152 @@ func (s *LocalStore) cleanupTask() {
 		case <-s.cleanupExpiredPeerEntriesTicker.C:
 			s.cleanupExpiredPeerEntries()
 		case <-s.cleanupExpiredPeerGroupsTicker.C:
-			s.cleanupExpiredPeerGroups()
+			s.cleanupExpiredPeerGroups(false)
 		case <-s.stop:
 			return
 		}
 	}
 }
 
-func (s *LocalStore) cleanupExpiredPeerEntries() {
-	s.mu.RLock()
-	groups := make([]*peerGroup, 0, len(s.peerGroups))
-	for _, g := range s.peerGroups {
-		groups = append(groups, g)
+// cleanupExpiredPeerEntries removes expired peer entries in batches of
+// ExpiryBatchSize, pausing for ExpiryBatchInterval between batches such that
+// mass expiry does not starve announces of group locks. Returns the number of
+// hosts removed from the host index.
+func (s *LocalStore) cleanupExpiredPeerEntries() int {
+	var groups []*peerGroup
+	for i := range s.peerGroups {
+		mu := s.groupLocks.Get(i)
+		mu.RLock()
+		for _, g := range s.peerGroups[i] {
+			groups = append(groups, g)
+		}
+		mu.RUnlock()
 	}
-	s.mu.RUnlock()
 
+	budget := s.config.ExpiryBatchSize
 	for _, g := range groups {
-		var expired []int
+		expired := s.expiredEntries(g)
+		for len(expired) > 0 {
+			if budget == 0 {
+				if !s.pauseExpiry() {
+					return 0
+				}
+				budget = s.config.ExpiryBatchSize
+			}
+			n := len(expired)
+			if n > budget {
+				n = budget
+			}
+			s.removeExpiredEntries(g, expired[:n])
+			expired = expired[n:]
+			budget -= n
+		}
+	}
 
-		g.mu.RLock()
-		for i, e := range g.peerList {
+	return s.cleanupExpiredHosts()
+}
+
+// expiredEntries returns the expired entries of g.
+func (s *LocalStore) expiredEntries(g *peerGroup) []*peerEntry {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var expired []*peerEntry
+	for _, l := range [][]*peerEntry{g.seeders, g.leechers} {
+		for _, e := range l {
 			if s.clk.Now().After(e.expiresAt) {
-				expired = append(expired, i)
+				expired = append(expired, e)
 			}
 		}
-		g.mu.RUnlock()
+	}
+	return expired
+}
 
-		if len(expired) == 0 {
-			// Fast path -- no need to acquire a write lock if there are no
-			// expired entries.
+func (s *LocalStore) removeExpiredEntries(g *peerGroup, expired []*peerEntry) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, e := range expired {
+		if g.peerMap[e.id] != e {
+			// Technically we're the only goroutine deleting peer entries,
+			// but let's play it safe.
 			continue
 		}
 
-		g.mu.Lock()
-		for j := len(expired) - 1; j >= 0; j-- {
-			// Loop over expired indexes in reverse orders to perform fast slice
-			// element removal.
-			i := expired[j]
-
-			if i >= len(g.peerList) {
-				// Technically we're the only goroutine deleting peer entries,
-				// but let's play it safe.
-				continue
-			}
-			e := g.peerList[i]
+		// Must re-check the expiresAt timestamp in case an update occurred
+		// before we could acquire the write lock.
+		if s.clk.Now().Before(e.expiresAt) {
+			continue
+		}
 
-			// Must re-check the expiresAt timestamp in case an update occurred
-			// before we could acquire the write lock.
-			if s.clk.Now().Before(e.expiresAt) {
-				continue
-			}
+		g.remove(e)
+		g.unindexZone(e)
+		delete(g.peerMap, e.id)
+	}
+}
 
-			// Remove the expired index.
-			g.peerList[i] = g.peerList[len(g.peerList)-1]
-			g.peerList = g.peerList[:len(g.peerList)-1]
+// pauseExpiry waits out the interval between expiry batches. Returns false if
+// the store was closed in the meantime.
+func (s *LocalStore) pauseExpiry() bool {
+	select {
+	case <-s.clk.After(s.config.ExpiryBatchInterval):
+		return true
+	case <-s.stop:
+		return false
+	}
+}
 
-			delete(g.peerMap, e.id)
+// cleanupExpiredHosts removes expired host index entries, returning the number
+// of hosts removed.
+func (s *LocalStore) cleanupExpiredHosts() int {
+	var removed int
+	for i := range s.hosts {
+		removed += s.cleanupExpiredHostShard(i)
+	}
+	return removed
+}
+
+func (s *LocalStore) cleanupExpiredHostShard(i int) int {
+	mu := s.hostLocks.Get(i)
+	mu.Lock()
+	defer mu.Unlock()
+
+	var removed int
+	now := s.clk.Now()
+	for host, hashes := range s.hosts[i] {
+		for h, expiresAt := range hashes {
+			if now.After(expiresAt) {
+				delete(hashes, h)
+			}
+		}
+		if len(hashes) == 0 {
+			delete(s.hosts[i], host)
+			removed++
 		}
-		g.mu.Unlock()
 	}
+	return removed
 }
 
-func (s *LocalStore) cleanupExpiredPeerGroups() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// cleanupExpiredPeerGroups removes expired peer groups, returning the number of
+// groups removed. If removeEmpty is set, groups without any peers are removed
+// even if they have not expired yet.
+func (s *LocalStore) cleanupExpiredPeerGroups(removeEmpty bool) int {
+	var removed int
+	for i := range s.peerGroups {
+		removed += s.cleanupExpiredPeerGroupShard(i, removeEmpty)
+	}
+	return removed
+}
+
+func (s *LocalStore) cleanupExpiredPeerGroupShard(i int, removeEmpty bool) int {
+	mu := s.groupLocks.Get(i)
+	mu.Lock()
+	defer mu.Unlock()
 
-	for h, g := range s.peerGroups {
+	var removed int
+	for h, g := range s.peerGroups[i] {
 		g.mu.RLock()
-		valid := s.clk.Now().Before(g.lastExpiresAt)
+		valid := !s.removable(g, removeEmpty)
 		g.mu.RUnlock()
 
 		if valid {
@@ -257,12 +673,108 @@ func (s *LocalStore) cleanupExpiredPeerGroups() {
 		}
 
 		g.mu.Lock()
-		// Must re-check the lastExpiresAt timestamp in case an update
-		// occurred before we could acquire the write lock.
-		if s.clk.Now().After(g.lastExpiresAt) {
-			delete(s.peerGroups, h)
+		// Must re-check the group in case an update occurred before we could
+		// acquire the write lock.
+		if s.removable(g, removeEmpty) {
+			delete(s.peerGroups[i], h)
 			g.deleted = true
+			removed++
 		}
 		g.mu.Unlock()
 	}
+	return removed
+}
+
+// removable returns whether g can be removed. Must be called with g.mu held.
+func (s *LocalStore) removable(g *peerGroup, removeEmpty bool) bool {
+	return s.clk.Now().After(g.lastExpiresAt) || (removeEmpty && g.size() == 0)
+}
+
+// Usage implements Compactor. Torrents are reported as keys of the "torrents"
+// keyspace with peers as records, and hosts as keys of the "hosts" keyspace
+// with the torrents they announced for as records.
+func (s *LocalStore) Usage() (Usage, error) {
+	var torrents, hosts KeyspaceUsage
+	for i := range s.peerGroups {
+		mu := s.groupLocks.Get(i)
+		mu.RLock()
+		for _, g := range s.peerGroups[i] {
+			g.mu.RLock()
+			torrents.Keys++
+			torrents.Records += g.size()
+			g.mu.RUnlock()
+		}
+		mu.RUnlock()
+	}
+	for i := range s.hosts {
+		mu := s.hostLocks.Get(i)
+		mu.Lock()
+		for _, hashes := range s.hosts[i] {
+			hosts.Keys++
+			hosts.Records += len(hashes)
+		}
+		mu.Unlock()
+	}
+	return Usage{"torrents": torrents, "hosts": hosts}, nil
+}
+
+// Compact implements Compactor. Expired peers are removed, followed by any
+// torrents and hosts left without peers.
+func (s *LocalStore) Compact() (int, error) {
+	return s.DeleteExpiredPeers()
+}
+
+// DeleteExpiredPeers implements ExpiredPeerDeleter. Expired peers are removed,
+// followed by any torrents and hosts left without peers. Since all records of
+// LocalStore belong to peers, this is equivalent to Compact.
+func (s *LocalStore) DeleteExpiredPeers() (int, error) {
+	removed := s.cleanupExpiredPeerEntries()
+	removed += s.cleanupExpiredPeerGroups(true)
+	return removed, nil
+}
+
+// DeleteTorrent implements TorrentDeleter. The peer group of h is removed
+// along with its host index entries.
+func (s *LocalStore) DeleteTorrent(h core.InfoHash) (int, error) {
+	i := s.groupLocks.Shard(h.Bytes())
+	mu := s.groupLocks.Get(i)
+	mu.Lock()
+	g, ok := s.peerGroups[i][h]
+	if !ok {
+		mu.Unlock()
+		return 0, nil
+	}
+	g.mu.Lock()
+	delete(s.peerGroups[i], h)
+	g.deleted = true
+	removed := len(g.peerMap)
+	hosts := make(map[string]bool)
+	for _, e := range g.peerMap {
+		for _, host := range peerHosts(e.peerInfo()) {
+			hosts[host] = true
+		}
+	}
+	g.mu.Unlock()
+	mu.Unlock()
+
+	for host := range hosts {
+		s.unindexHost(h, host)
+	}
+	return removed, nil
+}
+
+func (s *LocalStore) unindexHost(h core.InfoHash, host string) {
+	i := s.hostLocks.Shard([]byte(host))
+	mu := s.hostLocks.Get(i)
+	mu.Lock()
+	defer mu.Unlock()
+
+	hashes, ok := s.hosts[i][host]
+	if !ok {
+		return
+	}
+	delete(hashes, h)
+	if len(hashes) == 0 {
+		delete(s.hosts[i], host)
+	}
 }
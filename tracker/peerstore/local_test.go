@@ -14,6 +14,8 @@
 package peerstore
 
 import (
+	"fmt"
+	"math/rand"
 	"sync"
 	"testing"
 	"time"
@@ -21,6 +23,7 @@ import (
 	"github.com/andres-erbsen/clock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/testutil"
 )
 
 func TestLocalStoreExpiration(t *testing.T) {
@@ -70,7 +73,7 @@ func TestLocalStoreExpiration(t *testing.T) {
 	// Manually triggered for testing purposes. Nothing has expired, so
 	// should be a noop.
 	s.cleanupExpiredPeerEntries()
-	s.cleanupExpiredPeerGroups()
+	s.cleanupExpiredPeerGroups(false)
 
 	peers, err = s.GetPeers(h1, 3)
 	require.NoError(t, err)
@@ -106,9 +109,154 @@ func TestLocalStoreExpiration(t *testing.T) {
 
 	// Unfortunately we must reach into the LocalStore's private state
 	// to determine whether cleanup actually occurred.
-	require.Contains(t, s.peerGroups, h1)
-	s.cleanupExpiredPeerGroups()
-	require.NotContains(t, s.peerGroups, h1)
+	_, ok := s.getPeerGroup(h1)
+	require.True(t, ok)
+	s.cleanupExpiredPeerGroups(false)
+	_, ok = s.getPeerGroup(h1)
+	require.False(t, ok)
+}
+
+func TestLocalStoreTTLJitter(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Date(2019, time.November, 1, 1, 0, 0, 0, time.UTC)
+	clk := clock.NewMock()
+	clk.Set(now)
+
+	ttl := 10 * time.Minute
+	jitter := 5 * time.Minute
+
+	s := NewLocalStore(LocalConfig{TTL: ttl, TTLJitter: jitter}, clk)
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+
+	expirations := make(map[time.Time]bool)
+	var last time.Time
+	for i := 0; i < 50; i++ {
+		p := core.PeerInfoFixture()
+		require.NoError(s.UpdatePeer(h, p))
+
+		g, ok := s.getPeerGroup(h)
+		require.True(ok)
+		e := g.peerMap[p.PeerID]
+		require.False(e.expiresAt.Before(now.Add(ttl)))
+		require.True(e.expiresAt.Before(now.Add(ttl + jitter)))
+		expirations[e.expiresAt] = true
+		if e.expiresAt.After(last) {
+			last = e.expiresAt
+		}
+	}
+	require.True(len(expirations) > 1)
+
+	// The group must outlive its latest expiring peer, regardless of the
+	// order in which peers were updated.
+	g, ok := s.getPeerGroup(h)
+	require.True(ok)
+	require.Equal(last, g.lastExpiresAt)
+
+	clk.Set(last)
+	s.cleanupExpiredPeerGroups(false)
+	_, ok = s.getPeerGroup(h)
+	require.True(ok)
+}
+
+func TestLocalStoreExpiresPeersInBatches(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Date(2019, time.November, 1, 1, 0, 0, 0, time.UTC)
+	clk := clock.NewMock()
+	clk.Set(now)
+
+	s := NewLocalStore(LocalConfig{
+		TTL:                 10 * time.Minute,
+		ExpiryBatchSize:     2,
+		ExpiryBatchInterval: time.Millisecond,
+	}, clk)
+	defer s.Close()
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+	for i := 0; i < 5; i++ {
+		require.NoError(s.UpdatePeer(h1, core.PeerInfoFixture()))
+		require.NoError(s.UpdatePeer(h2, core.PeerInfoFixture()))
+	}
+
+	clk.Add(10*time.Minute + 1)
+
+	// Batches pause on the store clock, so advance it until cleanup finishes.
+	done := make(chan struct{})
+	go func() {
+		s.cleanupExpiredPeerEntries()
+		close(done)
+	}()
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		clk.Add(time.Millisecond)
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}))
+
+	for _, h := range []core.InfoHash{h1, h2} {
+		peers, err := s.GetPeers(h, 5)
+		require.NoError(err)
+		require.Empty(peers)
+	}
+}
+
+func TestLocalStoreExpiryStopsOnClose(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Date(2019, time.November, 1, 1, 0, 0, 0, time.UTC)
+	clk := clock.NewMock()
+	clk.Set(now)
+
+	s := NewLocalStore(LocalConfig{
+		TTL:                 10 * time.Minute,
+		ExpiryBatchSize:     1,
+		ExpiryBatchInterval: time.Hour,
+	}, clk)
+
+	h := core.InfoHashFixture()
+	for i := 0; i < 3; i++ {
+		require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+	}
+
+	clk.Add(10*time.Minute + 1)
+
+	s.Close()
+
+	// Only the first batch is removed before the pause observes the close.
+	s.cleanupExpiredPeerEntries()
+
+	peers, err := s.GetPeers(h, 3)
+	require.NoError(err)
+	require.Len(peers, 2)
+}
+
+func TestLocalStoreTracksLastSeen(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Date(2019, time.November, 1, 1, 0, 0, 0, time.UTC))
+
+	s := NewLocalStore(LocalConfig{TrackLastSeen: true}, clk)
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h, p))
+	clk.Add(time.Minute)
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Len(peers, 1)
+	require.Equal(clk.Now(), peers[0].LastSeen)
 }
 
 func TestLocalStoreConcurrency(t *testing.T) {
@@ -143,3 +291,389 @@ func TestLocalStoreConcurrency(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestLocalStoreGetSeedersAndLeechers(t *testing.T) {
+	require := require.New(t)
+
+	s := NewLocalStore(LocalConfig{}, clock.New())
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+
+	var seeders, leechers []*core.PeerInfo
+	for i := 0; i < 5; i++ {
+		p := core.PeerInfoFixture()
+		p.Complete = true
+		seeders = append(seeders, p)
+		require.NoError(s.UpdatePeer(h, p))
+	}
+	for i := 0; i < 10; i++ {
+		p := core.PeerInfoFixture()
+		leechers = append(leechers, p)
+		require.NoError(s.UpdatePeer(h, p))
+	}
+
+	resultSeeders, resultLeechers, err := s.GetSeedersAndLeechers(h, 10, 3)
+	require.NoError(err)
+	require.ElementsMatch(seeders, resultSeeders)
+	require.Len(resultLeechers, 3)
+	for _, p := range resultLeechers {
+		require.False(p.Complete)
+	}
+
+	// A leecher which completes moves to the seeders.
+	leechers[0].Complete = true
+	require.NoError(s.UpdatePeer(h, leechers[0]))
+
+	resultSeeders, resultLeechers, err = s.GetSeedersAndLeechers(h, 10, 10)
+	require.NoError(err)
+	require.ElementsMatch(append(seeders, leechers[0]), resultSeeders)
+	require.ElementsMatch(leechers[1:], resultLeechers)
+}
+
+func TestLocalStoreEstimatePeerCount(t *testing.T) {
+	require := require.New(t)
+
+	s := NewLocalStore(LocalConfig{}, clock.New())
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+
+	seeders, leechers, err := s.EstimatePeerCount(h)
+	require.NoError(err)
+	require.Equal(0, seeders)
+	require.Equal(0, leechers)
+
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p))
+	require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+
+	p.Complete = true
+	require.NoError(s.UpdatePeer(h, p))
+
+	seeders, leechers, err = s.EstimatePeerCount(h)
+	require.NoError(err)
+	require.Equal(1, seeders)
+	require.Equal(1, leechers)
+}
+
+func TestLocalStoreScrape(t *testing.T) {
+	require := require.New(t)
+
+	s := NewLocalStore(LocalConfig{}, clock.New())
+	defer s.Close()
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h1, p))
+	require.NoError(s.UpdatePeer(h1, core.PeerInfoFixture()))
+	require.NoError(s.UpdatePeer(h1, core.OriginPeerInfoFixture()))
+
+	p.Complete = true
+	require.NoError(s.UpdatePeer(h1, p))
+	require.NoError(s.UpdatePeer(h1, p))
+
+	stats, err := s.Scrape([]core.InfoHash{h1, h2})
+	require.NoError(err)
+	require.Equal([]SwarmStats{
+		// Origins are never counted as completed.
+		{Seeders: 2, Leechers: 1, Completed: 1},
+		{},
+	}, stats)
+}
+
+func TestLocalStorePeerIndexes(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s := NewLocalStore(LocalConfig{TTL: 10 * time.Minute}, clk)
+	defer s.Close()
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	p1 := core.PeerInfoFixture()
+	p1.Hostname = "agent1.example.com"
+	p1.Zone = "zone1"
+	p2 := core.PeerInfoFixture()
+	p2.Zone = "zone2"
+
+	require.NoError(s.UpdatePeer(h1, p1))
+	require.NoError(s.UpdatePeer(h2, p1))
+	require.NoError(s.UpdatePeer(h1, p2))
+
+	for _, host := range []string{p1.IP, p1.Hostname} {
+		hashes, err := s.GetInfoHashesByHost(host)
+		require.NoError(err)
+		require.ElementsMatch([]core.InfoHash{h1, h2}, hashes)
+	}
+	hashes, err := s.GetInfoHashesByHost(p2.IP)
+	require.NoError(err)
+	require.Equal([]core.InfoHash{h1}, hashes)
+
+	peers, err := s.GetPeersByZone(h1, "zone1")
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p1}, peers)
+
+	// Peers which move zones are re-indexed.
+	p2.Zone = "zone1"
+	require.NoError(s.UpdatePeer(h1, p2))
+
+	peers, err = s.GetPeersByZone(h1, "zone1")
+	require.NoError(err)
+	require.ElementsMatch([]*core.PeerInfo{p1, p2}, peers)
+
+	peers, err = s.GetPeersByZone(h1, "zone2")
+	require.NoError(err)
+	require.Empty(peers)
+
+	// Expired peers are removed from indexes.
+	clk.Add(10*time.Minute + 1)
+	s.cleanupExpiredPeerEntries()
+
+	hashes, err = s.GetInfoHashesByHost(p1.IP)
+	require.NoError(err)
+	require.Empty(hashes)
+
+	peers, err = s.GetPeersByZone(h1, "zone1")
+	require.NoError(err)
+	require.Empty(peers)
+}
+
+func TestLocalStoreDeleteTorrent(t *testing.T) {
+	require := require.New(t)
+
+	s := NewLocalStore(LocalConfig{}, clock.NewMock())
+	defer s.Close()
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	p1 := core.PeerInfoFixture()
+	p1.Hostname = "agent1.example.com"
+	p1.Zone = "zone1"
+	p2 := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h1, p1))
+	require.NoError(s.UpdatePeer(h1, p2))
+	require.NoError(s.UpdatePeer(h2, p1))
+
+	removed, err := s.DeleteTorrent(h1)
+	require.NoError(err)
+	require.Equal(2, removed)
+
+	peers, err := s.GetPeers(h1, 10)
+	require.NoError(err)
+	require.Empty(peers)
+
+	peers, err = s.GetPeersByZone(h1, "zone1")
+	require.NoError(err)
+	require.Empty(peers)
+
+	// Other torrents of the same hosts are untouched.
+	hashes, err := s.GetInfoHashesByHost(p1.Hostname)
+	require.NoError(err)
+	require.Equal([]core.InfoHash{h2}, hashes)
+
+	hashes, err = s.GetInfoHashesByHost(p2.IP)
+	require.NoError(err)
+	require.Empty(hashes)
+
+	// Peers announcing again are stored as usual.
+	require.NoError(s.UpdatePeer(h1, p1))
+	peers, err = s.GetPeers(h1, 10)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p1}, peers)
+
+	removed, err = s.DeleteTorrent(core.InfoHashFixture())
+	require.NoError(err)
+	require.Equal(0, removed)
+}
+
+func TestLocalStoreConcurrentUpdatesAcrossShards(t *testing.T) {
+	require := require.New(t)
+
+	s := NewLocalStore(LocalConfig{LockShards: 4}, clock.New())
+	defer s.Close()
+
+	hashes := make([]core.InfoHash, 32)
+	for i := range hashes {
+		hashes[i] = core.InfoHashFixture()
+	}
+
+	var wg sync.WaitGroup
+	for _, h := range hashes {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(h core.InfoHash) {
+				defer wg.Done()
+				require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+			}(h)
+		}
+	}
+	wg.Wait()
+
+	for _, h := range hashes {
+		seeders, leechers, err := s.EstimatePeerCount(h)
+		require.NoError(err)
+		require.Equal(0, seeders)
+		require.Equal(10, leechers)
+	}
+}
+
+func BenchmarkLocalStoreUpdatePeer(b *testing.B) {
+	for _, shards := range []int{1, 256} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			s := NewLocalStore(LocalConfig{LockShards: shards}, clock.New())
+			defer s.Close()
+
+			// Announces are spread across many torrents, each with a few peers,
+			// and interleaved with handout reads.
+			hashes := make([]core.InfoHash, 1024)
+			for i := range hashes {
+				hashes[i] = core.InfoHashFixture()
+			}
+			peers := make([]*core.PeerInfo, 16)
+			for i := range peers {
+				peers[i] = core.PeerInfoFixture()
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Int()
+				for pb.Next() {
+					h := hashes[i%len(hashes)]
+					if err := s.UpdatePeer(h, peers[i%len(peers)]); err != nil {
+						b.Fatal(err)
+					}
+					if _, err := s.GetPeers(h, 5); err != nil {
+						b.Fatal(err)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestLocalStoreUsageAndCompact(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s := NewLocalStore(LocalConfig{TTL: 10 * time.Minute}, clk)
+	defer s.Close()
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+	h3 := core.InfoHashFixture()
+
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h1, p1))
+	require.NoError(s.UpdatePeer(h2, p1))
+	require.NoError(s.UpdatePeer(h1, p2))
+
+	// Leave an empty group behind for h3.
+	s.getOrInitLockedPeerGroup(h3).mu.Unlock()
+
+	usage, err := s.Usage()
+	require.NoError(err)
+	require.Equal(Usage{
+		"torrents": {Keys: 3, Records: 3},
+		"hosts":    {Keys: 2, Records: 3},
+	}, usage)
+
+	clk.Add(5 * time.Minute)
+	require.NoError(s.UpdatePeer(h1, p2))
+	clk.Add(5*time.Minute + 1)
+
+	// p1 has expired, leaving h2 and h3 without peers.
+	removed, err := s.Compact()
+	require.NoError(err)
+	require.Equal(3, removed)
+
+	usage, err = s.Usage()
+	require.NoError(err)
+	require.Equal(Usage{
+		"torrents": {Keys: 1, Records: 1},
+		"hosts":    {Keys: 1, Records: 1},
+	}, usage)
+
+	peers, err := s.GetPeers(h1, 2)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p2}, peers)
+}
+
+func TestLocalStoreDeleteExpiredPeers(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s := NewLocalStore(LocalConfig{TTL: 10 * time.Minute}, clk)
+	defer s.Close()
+
+	expired := core.InfoHashFixture()
+	live := core.InfoHashFixture()
+
+	require.NoError(s.UpdatePeer(expired, core.PeerInfoFixture()))
+	clk.Add(10*time.Minute + 1)
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(live, p))
+
+	// The torrent and host of the expired peer.
+	removed, err := s.DeleteExpiredPeers()
+	require.NoError(err)
+	require.Equal(2, removed)
+
+	usage, err := s.Usage()
+	require.NoError(err)
+	require.Equal(Usage{
+		"torrents": {Keys: 1, Records: 1},
+		"hosts":    {Keys: 1, Records: 1},
+	}, usage)
+
+	peers, err := s.GetPeers(live, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestLocalStoreCompareAndUpdatePeer(t *testing.T) {
+	require := require.New(t)
+
+	s := NewLocalStore(LocalConfig{}, clock.New())
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	gen, err := s.GetPeerGeneration(h, p.PeerID)
+	require.NoError(err)
+	require.Equal(uint64(0), gen)
+
+	gen, err = s.CompareAndUpdatePeer(h, p, 0)
+	require.NoError(err)
+	require.Equal(uint64(1), gen)
+
+	// Unconditional writes also increment the generation.
+	require.NoError(s.UpdatePeer(h, p))
+
+	// A writer which last observed generation 1 is stale.
+	p.Complete = true
+	_, err = s.CompareAndUpdatePeer(h, p, 1)
+	require.Equal(ErrGenerationConflict, err)
+
+	seeders, leechers, err := s.GetSeedersAndLeechers(h, 10, 10)
+	require.NoError(err)
+	require.Empty(seeders)
+	require.Len(leechers, 1)
+
+	gen, err = s.CompareAndUpdatePeer(h, p, 2)
+	require.NoError(err)
+	require.Equal(uint64(3), gen)
+
+	seeders, _, err = s.GetSeedersAndLeechers(h, 10, 10)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, seeders)
+}
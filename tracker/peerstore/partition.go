@@ -0,0 +1,606 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/utils/log"
+)
+
+// ErrPendingWritesFull is returned when the underlying store is unavailable
+// and no more writes can be queued for reconciliation.
+var ErrPendingWritesFull = errors.New("pending writes queue is full")
+
+// StaleError is returned by PartitionTolerantStore.GetPeers when the
+// underlying store is unavailable and previously cached peers are returned
+// instead. Callers may use the returned peers, but should treat them as stale.
+type StaleError struct {
+	Err error
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("serving stale peers: %s", e.Err)
+}
+
+// IsStale returns true if err is a StaleError.
+func IsStale(err error) bool {
+	_, ok := err.(*StaleError)
+	return ok
+}
+
+type cachedPeers struct {
+	peers     []*core.PeerInfo
+	updatedAt time.Time
+}
+
+// pendingWrite is a queued write of peer, conditioned on gen, the last
+// generation of the peer known to be written before the write was queued.
+type pendingWrite struct {
+	peer *core.PeerInfo
+	gen  uint64
+}
+
+type knownGeneration struct {
+	gen       uint64
+	updatedAt time.Time
+}
+
+// PartitionTolerantStore wraps a Store and defines explicit behavior for when
+// the Store is unavailable:
+//
+//   - GetPeers serves the last successfully read peers (merged with any
+//     queued writes) for up to StaleTTL, returning a StaleError.
+//   - UpdatePeer queues writes, keeping only the latest write per peer.
+//   - Queued writes are replayed against the Store once it recovers.
+//
+// If the Store versions peers, queued writes are replayed with
+// compare-and-set against the generation of the peer last written before the
+// write was queued, such that writes of the peer by other trackers during the
+// partition win over the replay. Generations are remembered for StaleTTL; a
+// write of a peer with no remembered generation only replays if the peer has
+// no record, and is otherwise dropped until the peer announces again.
+type PartitionTolerantStore struct {
+	config PartitionConfig
+	store  Store
+	clk    clock.Clock
+	stats  tally.Scope
+
+	stopOnce sync.Once
+	stop     chan struct{}
+
+	mu          sync.Mutex
+	partitioned bool
+	cache       map[core.InfoHash]*cachedPeers
+	pending     map[core.InfoHash]map[core.PeerID]*pendingWrite
+	numPending  int
+	generations map[core.InfoHash]map[core.PeerID]*knownGeneration
+}
+
+// NewPartitionTolerantStore creates a new PartitionTolerantStore which wraps
+// store.
+func NewPartitionTolerantStore(
+	config PartitionConfig,
+	stats tally.Scope,
+	store Store,
+	clk clock.Clock) *PartitionTolerantStore {
+
+	config.applyDefaults()
+
+	stats = stats.Tagged(map[string]string{
+		"module": "peerstore",
+	})
+
+	s := &PartitionTolerantStore{
+		config:      config,
+		store:       store,
+		clk:         clk,
+		stats:       stats,
+		stop:        make(chan struct{}),
+		cache:       make(map[core.InfoHash]*cachedPeers),
+		pending:     make(map[core.InfoHash]map[core.PeerID]*pendingWrite),
+		generations: make(map[core.InfoHash]map[core.PeerID]*knownGeneration),
+	}
+	go s.reconcileTask()
+	return s
+}
+
+// Close implements Store.
+func (s *PartitionTolerantStore) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.store.Close()
+}
+
+// GetPeers implements Store.
+func (s *PartitionTolerantStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
+	peers, err := s.store.GetPeers(h, n)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.setPartitioned(false)
+		s.cache[h] = &cachedPeers{peers, s.clk.Now()}
+		return peers, nil
+	}
+	return s.stalePeers(h, n, err)
+}
+
+// stalePeers returns at most n cached and pending peers of h, along with a
+// StaleError wrapping err. If there are no such peers, returns err. Must be
+// called with s.mu held.
+func (s *PartitionTolerantStore) stalePeers(
+	h core.InfoHash, n int, err error) ([]*core.PeerInfo, error) {
+
+	s.setPartitioned(true)
+
+	merged := make(map[core.PeerID]*core.PeerInfo)
+	if c, ok := s.cache[h]; ok && s.clk.Now().Sub(c.updatedAt) < s.config.StaleTTL {
+		for _, p := range c.peers {
+			merged[p.PeerID] = p
+		}
+	}
+	for id, w := range s.pending[h] {
+		merged[id] = w.peer
+	}
+	if len(merged) == 0 {
+		return nil, err
+	}
+	result := make([]*core.PeerInfo, 0, len(merged))
+	for _, p := range merged {
+		if len(result) == n {
+			break
+		}
+		result = append(result, p)
+	}
+	s.stats.Counter("stale_reads").Inc(1)
+	return result, &StaleError{err}
+}
+
+// GetSeedersAndLeechers implements Store. Stale peers are served under the same
+// conditions as GetPeers.
+func (s *PartitionTolerantStore) GetSeedersAndLeechers(
+	h core.InfoHash, nSeeders, nLeechers int) (seeders, leechers []*core.PeerInfo, err error) {
+
+	seeders, leechers, err = s.store.GetSeedersAndLeechers(h, nSeeders, nLeechers)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.setPartitioned(false)
+		return seeders, leechers, nil
+	}
+	peers, err := s.stalePeers(h, nSeeders+nLeechers, err)
+	if !IsStale(err) {
+		return nil, nil, err
+	}
+	seeders, leechers = nil, nil
+	for _, p := range peers {
+		if p.Complete && len(seeders) < nSeeders {
+			seeders = append(seeders, p)
+		} else if !p.Complete && len(leechers) < nLeechers {
+			leechers = append(leechers, p)
+		}
+	}
+	return seeders, leechers, err
+}
+
+// EstimatePeerCount implements Store. Counts are not served while the
+// underlying store is unavailable.
+func (s *PartitionTolerantStore) EstimatePeerCount(
+	h core.InfoHash) (seeders, leechers int, err error) {
+
+	return s.store.EstimatePeerCount(h)
+}
+
+// HottestInfoHashes implements HotInfoHashLister if the underlying store does.
+func (s *PartitionTolerantStore) HottestInfoHashes(n int) ([]core.InfoHash, error) {
+	l, ok := s.store.(HotInfoHashLister)
+	if !ok {
+		return nil, errors.New("underlying store does not count announces")
+	}
+	return l.HottestInfoHashes(n)
+}
+
+// Scrape implements Scraper if the underlying store does.
+func (s *PartitionTolerantStore) Scrape(hashes []core.InfoHash) ([]SwarmStats, error) {
+	sc, ok := s.store.(Scraper)
+	if !ok {
+		return nil, ErrNoScrape
+	}
+	return sc.Scrape(hashes)
+}
+
+// Usage implements Compactor if the underlying store does.
+func (s *PartitionTolerantStore) Usage() (Usage, error) {
+	c, ok := s.store.(Compactor)
+	if !ok {
+		return nil, ErrNoCompaction
+	}
+	return c.Usage()
+}
+
+// Compact implements Compactor if the underlying store does.
+func (s *PartitionTolerantStore) Compact() (int, error) {
+	c, ok := s.store.(Compactor)
+	if !ok {
+		return 0, ErrNoCompaction
+	}
+	return c.Compact()
+}
+
+// DeleteExpiredPeers implements ExpiredPeerDeleter if the underlying store
+// does.
+func (s *PartitionTolerantStore) DeleteExpiredPeers() (int, error) {
+	d, ok := s.store.(ExpiredPeerDeleter)
+	if !ok {
+		return 0, ErrNoExpiredPeerDeletion
+	}
+	return d.DeleteExpiredPeers()
+}
+
+// DeleteTorrent implements TorrentDeleter if the underlying store does. Cached
+// peers, queued writes and known generations of h are dropped as well, such
+// that deleted peers are neither served stale nor replayed.
+func (s *PartitionTolerantStore) DeleteTorrent(h core.InfoHash) (int, error) {
+	d, ok := s.store.(TorrentDeleter)
+	if !ok {
+		return 0, ErrNoDeletion
+	}
+	s.mu.Lock()
+	delete(s.cache, h)
+	s.numPending -= len(s.pending[h])
+	delete(s.pending, h)
+	delete(s.generations, h)
+	s.mu.Unlock()
+
+	return d.DeleteTorrent(h)
+}
+
+// GetThroughput implements ThroughputStore if the underlying store does.
+func (s *PartitionTolerantStore) GetThroughput(ids []core.PeerID) (map[core.PeerID]ThroughputRecord, error) {
+	t, ok := s.store.(ThroughputStore)
+	if !ok {
+		return nil, ErrNoThroughput
+	}
+	return t.GetThroughput(ids)
+}
+
+// SetThroughput implements ThroughputStore if the underlying store does.
+func (s *PartitionTolerantStore) SetThroughput(
+	id core.PeerID, r ThroughputRecord, ttl time.Duration) error {
+
+	t, ok := s.store.(ThroughputStore)
+	if !ok {
+		return ErrNoThroughput
+	}
+	return t.SetThroughput(id, r, ttl)
+}
+
+// UseNonce implements announcetoken.Store if the underlying store does.
+func (s *PartitionTolerantStore) UseNonce(nonce string, ttl time.Duration) (bool, error) {
+	t, ok := s.store.(announcetoken.Store)
+	if !ok {
+		return false, announcetoken.ErrNoStore
+	}
+	return t.UseNonce(nonce, ttl)
+}
+
+// RestrictTorrent implements announcetoken.Store if the underlying store does.
+func (s *PartitionTolerantStore) RestrictTorrent(h core.InfoHash, ttl time.Duration) error {
+	t, ok := s.store.(announcetoken.Store)
+	if !ok {
+		return announcetoken.ErrNoStore
+	}
+	return t.RestrictTorrent(h, ttl)
+}
+
+// RestrictedTorrent implements announcetoken.Store if the underlying store
+// does.
+func (s *PartitionTolerantStore) RestrictedTorrent(h core.InfoHash) (bool, error) {
+	t, ok := s.store.(announcetoken.Store)
+	if !ok {
+		return false, announcetoken.ErrNoStore
+	}
+	return t.RestrictedTorrent(h)
+}
+
+// GetInfoHashesByHost implements PeerIndex if the underlying store does.
+func (s *PartitionTolerantStore) GetInfoHashesByHost(host string) ([]core.InfoHash, error) {
+	i, ok := s.store.(PeerIndex)
+	if !ok {
+		return nil, ErrNoPeerIndex
+	}
+	return i.GetInfoHashesByHost(host)
+}
+
+// GetPeersByZone implements PeerIndex if the underlying store does.
+func (s *PartitionTolerantStore) GetPeersByZone(
+	h core.InfoHash, zone string) ([]*core.PeerInfo, error) {
+
+	i, ok := s.store.(PeerIndex)
+	if !ok {
+		return nil, ErrNoPeerIndex
+	}
+	return i.GetPeersByZone(h, zone)
+}
+
+// UpdateVersionedPeer implements VersionedStore if the underlying store does.
+// Versioned writes are not queued.
+func (s *PartitionTolerantStore) UpdateVersionedPeer(
+	h core.InfoHash, p *core.PeerInfo) (uint64, error) {
+
+	v, ok := s.store.(VersionedStore)
+	if !ok {
+		return 0, ErrNoGenerations
+	}
+	return v.UpdateVersionedPeer(h, p)
+}
+
+// GetPeerGeneration implements VersionedStore if the underlying store does.
+func (s *PartitionTolerantStore) GetPeerGeneration(
+	h core.InfoHash, id core.PeerID) (uint64, error) {
+
+	v, ok := s.store.(VersionedStore)
+	if !ok {
+		return 0, ErrNoGenerations
+	}
+	return v.GetPeerGeneration(h, id)
+}
+
+// CompareAndUpdatePeer implements VersionedStore if the underlying store does.
+// Compare-and-set writes are never queued, since their expected generation
+// would be stale by the time they are replayed.
+func (s *PartitionTolerantStore) CompareAndUpdatePeer(
+	h core.InfoHash, p *core.PeerInfo, gen uint64) (uint64, error) {
+
+	v, ok := s.store.(VersionedStore)
+	if !ok {
+		return 0, ErrNoGenerations
+	}
+	newGen, err := v.CompareAndUpdatePeer(h, p, gen)
+	if err == ErrGenerationConflict {
+		s.stats.Counter("generation_conflicts").Inc(1)
+	}
+	return newGen, err
+}
+
+// UpdatePeer implements Store. If the underlying store is unavailable, the
+// write is queued and nil is returned.
+func (s *PartitionTolerantStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
+	gen, err := s.write(h, p)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.setPartitioned(false)
+		s.setGeneration(h, p.PeerID, gen)
+		return nil
+	}
+	s.setPartitioned(true)
+
+	w := &pendingWrite{peer: p, gen: s.generation(h, p.PeerID)}
+	if qerr := s.enqueue(h, w); qerr != nil {
+		s.stats.Counter("dropped_writes").Inc(1)
+		return fmt.Errorf("store: %s, queue: %s", err, qerr)
+	}
+	s.stats.Counter("queued_writes").Inc(1)
+	return nil
+}
+
+// Partitioned returns whether the underlying store is currently considered
+// unavailable.
+func (s *PartitionTolerantStore) Partitioned() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.partitioned
+}
+
+// write writes p to the underlying store, returning the new generation of p if
+// the underlying store versions peers, else 0.
+func (s *PartitionTolerantStore) write(h core.InfoHash, p *core.PeerInfo) (uint64, error) {
+	if v, ok := s.store.(VersionedStore); ok {
+		gen, err := v.UpdateVersionedPeer(h, p)
+		if err != ErrNoGenerations {
+			return gen, err
+		}
+	}
+	return 0, s.store.UpdatePeer(h, p)
+}
+
+// generation returns the last known generation of peer id of h, or 0 if
+// unknown. Must be called with s.mu held.
+func (s *PartitionTolerantStore) generation(h core.InfoHash, id core.PeerID) uint64 {
+	if k, ok := s.generations[h][id]; ok {
+		return k.gen
+	}
+	return 0
+}
+
+// setGeneration records gen as the last known generation of peer id of h. A
+// zero gen clears the known generation. Must be called with s.mu held.
+func (s *PartitionTolerantStore) setGeneration(h core.InfoHash, id core.PeerID, gen uint64) {
+	g, ok := s.generations[h]
+	if gen == 0 {
+		if ok {
+			delete(g, id)
+			if len(g) == 0 {
+				delete(s.generations, h)
+			}
+		}
+		return
+	}
+	if !ok {
+		g = make(map[core.PeerID]*knownGeneration)
+		s.generations[h] = g
+	}
+	g[id] = &knownGeneration{gen, s.clk.Now()}
+}
+
+// enqueue must be called with s.mu held. Overwrites the peer of any older
+// pending write for the same peer, but keeps its generation, since no write
+// of the peer has succeeded since.
+func (s *PartitionTolerantStore) enqueue(h core.InfoHash, w *pendingWrite) error {
+	g, ok := s.pending[h]
+	if !ok {
+		g = make(map[core.PeerID]*pendingWrite)
+		s.pending[h] = g
+	}
+	id := w.peer.PeerID
+	if prev, ok := g[id]; ok {
+		prev.peer = w.peer
+		return nil
+	}
+	if s.numPending >= s.config.MaxPendingWrites {
+		return ErrPendingWritesFull
+	}
+	s.numPending++
+	g[id] = w
+	return nil
+}
+
+// setPartitioned must be called with s.mu held.
+func (s *PartitionTolerantStore) setPartitioned(partitioned bool) {
+	if s.partitioned == partitioned {
+		return
+	}
+	s.partitioned = partitioned
+	if partitioned {
+		log.Warn("Peer store unavailable, serving stale peers and queueing writes")
+		s.stats.Gauge("partitioned").Update(1)
+	} else {
+		log.Info("Peer store recovered")
+		s.stats.Gauge("partitioned").Update(0)
+	}
+}
+
+func (s *PartitionTolerantStore) reconcileTask() {
+	ticker := s.clk.Ticker(s.config.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.reconcile()
+			s.cleanupStaleCache()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// reconcile replays pending writes against the underlying store. Writes which
+// fail are re-queued, unless a newer write for the same peer arrived in the
+// meantime.
+func (s *PartitionTolerantStore) reconcile() {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[core.InfoHash]map[core.PeerID]*pendingWrite)
+	s.numPending = 0
+	s.mu.Unlock()
+
+	var replayed, conflicts, failed, dropped int
+	for h, g := range pending {
+		for id, w := range g {
+			gen, err := s.replay(h, w)
+			if err == ErrGenerationConflict {
+				// Another writer updated the peer since our write was
+				// queued, and its write is newer than ours.
+				s.mu.Lock()
+				s.setGeneration(h, id, 0)
+				s.mu.Unlock()
+				conflicts++
+				continue
+			}
+			if err != nil {
+				s.mu.Lock()
+				s.setPartitioned(true)
+				var qerr error
+				if _, ok := s.pending[h][id]; !ok {
+					qerr = s.enqueue(h, w)
+				}
+				s.mu.Unlock()
+				if qerr != nil {
+					// New writes filled the queue while replaying.
+					log.With("hash", h, "peer_id", id).Errorf(
+						"Error re-queueing peer write: store: %s, queue: %s", err, qerr)
+					dropped++
+				}
+				failed++
+				continue
+			}
+			s.mu.Lock()
+			s.setGeneration(h, id, gen)
+			s.mu.Unlock()
+			replayed++
+		}
+	}
+	if replayed > 0 || conflicts > 0 || failed > 0 {
+		log.With(
+			"replayed", replayed,
+			"conflicts", conflicts,
+			"failed", failed,
+			"dropped", dropped).Info("Reconciled pending peer writes")
+		s.stats.Counter("reconciled_writes").Inc(int64(replayed))
+		s.stats.Counter("generation_conflicts").Inc(int64(conflicts))
+		s.stats.Counter("dropped_writes").Inc(int64(dropped))
+	}
+}
+
+// replay writes a queued write, returning the new generation of the peer if
+// the underlying store versions peers. Versioned writes are conditioned on the
+// generation recorded when the write was queued, such that the replay does not
+// clobber writes from other trackers during the partition.
+func (s *PartitionTolerantStore) replay(h core.InfoHash, w *pendingWrite) (uint64, error) {
+	if v, ok := s.store.(VersionedStore); ok {
+		gen, err := v.CompareAndUpdatePeer(h, w.peer, w.gen)
+		if err != ErrNoGenerations {
+			return gen, err
+		}
+	}
+	return 0, s.store.UpdatePeer(h, w.peer)
+}
+
+func (s *PartitionTolerantStore) cleanupStaleCache() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clk.Now()
+	for h, c := range s.cache {
+		if now.Sub(c.updatedAt) >= s.config.StaleTTL {
+			delete(s.cache, h)
+		}
+	}
+	for h, g := range s.generations {
+		for id, k := range g {
+			if now.Sub(k.updatedAt) >= s.config.StaleTTL {
+				delete(g, id)
+			}
+		}
+		if len(g) == 0 {
+			delete(s.generations, h)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+)
+
+func newPartitionTolerantStoreFixture(
+	config PartitionConfig) (*PartitionTolerantStore, *PartitionTestStore, *clock.Mock) {
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+	underlying := NewPartitionTestStore()
+	return NewPartitionTolerantStore(config, tally.NoopScope, underlying, clk), underlying, clk
+}
+
+func TestPartitionTolerantStoreServesStalePeers(t *testing.T) {
+	require := require.New(t)
+
+	s, underlying, _ := newPartitionTolerantStoreFixture(PartitionConfig{})
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p1 := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p1))
+
+	peers, err := s.GetPeers(h, 10)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p1}, peers)
+
+	underlying.SetPartitioned(true)
+
+	// Writes are queued and merged into stale reads.
+	p2 := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p2))
+
+	peers, err = s.GetPeers(h, 10)
+	require.True(IsStale(err))
+	require.ElementsMatch([]*core.PeerInfo{p1, p2}, peers)
+	require.True(s.Partitioned())
+
+	// Unknown torrents have nothing to serve.
+	_, err = s.GetPeers(core.InfoHashFixture(), 10)
+	require.Equal(ErrTestPartition, err)
+}
+
+func TestPartitionTolerantStoreStaleTTL(t *testing.T) {
+	require := require.New(t)
+
+	config := PartitionConfig{StaleTTL: time.Minute}
+	s, underlying, clk := newPartitionTolerantStoreFixture(config)
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+	_, err := s.GetPeers(h, 10)
+	require.NoError(err)
+
+	underlying.SetPartitioned(true)
+	clk.Add(config.StaleTTL + 1)
+
+	_, err = s.GetPeers(h, 10)
+	require.Equal(ErrTestPartition, err)
+}
+
+func TestPartitionTolerantStoreReconcilesQueuedWrites(t *testing.T) {
+	require := require.New(t)
+
+	s, underlying, _ := newPartitionTolerantStoreFixture(PartitionConfig{})
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	underlying.SetPartitioned(true)
+	require.NoError(s.UpdatePeer(h, p))
+
+	// Replay fails while still partitioned, and the write remains queued.
+	s.reconcile()
+
+	underlying.SetPartitioned(false)
+	s.reconcile()
+
+	peers, err := underlying.GetPeers(h, 10)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestPartitionTolerantStoreMaxPendingWrites(t *testing.T) {
+	require := require.New(t)
+
+	s, underlying, _ := newPartitionTolerantStoreFixture(PartitionConfig{MaxPendingWrites: 1})
+	defer s.Close()
+
+	underlying.SetPartitioned(true)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p))
+
+	// Updating the same peer does not consume more queue space.
+	p.Complete = true
+	require.NoError(s.UpdatePeer(h, p))
+
+	require.Error(s.UpdatePeer(h, core.PeerInfoFixture()))
+}
+
+// hookedPartitionTestStore is a PartitionTestStore which runs a hook on the
+// next write, for testing writes which arrive during reconciliation.
+type hookedPartitionTestStore struct {
+	*PartitionTestStore
+	hook func()
+}
+
+func (s *hookedPartitionTestStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
+	if hook := s.hook; hook != nil {
+		s.hook = nil
+		hook()
+	}
+	return s.PartitionTestStore.UpdatePeer(h, p)
+}
+
+func TestPartitionTolerantStoreReconcileCountsDroppedWrites(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	underlying := &hookedPartitionTestStore{PartitionTestStore: NewPartitionTestStore()}
+	s := NewPartitionTolerantStore(
+		PartitionConfig{MaxPendingWrites: 1}, stats, underlying, clock.NewMock())
+	defer s.Close()
+
+	underlying.SetPartitioned(true)
+
+	h := core.InfoHashFixture()
+	require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+
+	// A new write fills the queue while the pending write is replayed, so the
+	// failed replay cannot be re-queued.
+	underlying.hook = func() {
+		require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+	}
+	s.reconcile()
+
+	require.Equal(int64(1), stats.Snapshot().Counters()["dropped_writes+"].Value())
+}
+
+// partitionVersionedStore is a LocalStore which can simulate being
+// unavailable, for testing replay of versioned writes.
+type partitionVersionedStore struct {
+	*LocalStore
+	partitioned bool
+}
+
+func (s *partitionVersionedStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
+	if s.partitioned {
+		return ErrTestPartition
+	}
+	return s.LocalStore.UpdatePeer(h, p)
+}
+
+func (s *partitionVersionedStore) UpdateVersionedPeer(
+	h core.InfoHash, p *core.PeerInfo) (uint64, error) {
+
+	if s.partitioned {
+		return 0, ErrTestPartition
+	}
+	return s.LocalStore.UpdateVersionedPeer(h, p)
+}
+
+func (s *partitionVersionedStore) CompareAndUpdatePeer(
+	h core.InfoHash, p *core.PeerInfo, gen uint64) (uint64, error) {
+
+	if s.partitioned {
+		return 0, ErrTestPartition
+	}
+	return s.LocalStore.CompareAndUpdatePeer(h, p, gen)
+}
+
+func TestPartitionTolerantStoreReplayYieldsToConcurrentWrites(t *testing.T) {
+	require := require.New(t)
+
+	underlying := &partitionVersionedStore{LocalStore: NewLocalStore(LocalConfig{}, clock.New())}
+	s := NewPartitionTolerantStore(PartitionConfig{}, tally.NoopScope, underlying, clock.NewMock())
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p1))
+	require.NoError(s.UpdatePeer(h, p2))
+
+	underlying.partitioned = true
+
+	// Queued writes which would mark both peers as complete.
+	stale1 := *p1
+	stale1.Complete = true
+	require.NoError(s.UpdatePeer(h, &stale1))
+	stale2 := *p2
+	stale2.Complete = true
+	require.NoError(s.UpdatePeer(h, &stale2))
+
+	// Meanwhile, another tracker writes p1.
+	_, err := underlying.LocalStore.UpdateVersionedPeer(h, p1)
+	require.NoError(err)
+
+	underlying.partitioned = false
+	s.reconcile()
+
+	// The write of p1 by the other tracker wins, whereas p2 is replayed.
+	seeders, leechers, err := underlying.GetSeedersAndLeechers(h, 10, 10)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{&stale2}, seeders)
+	require.Equal([]*core.PeerInfo{p1}, leechers)
+}
+
+func TestPartitionTolerantStoreDeleteTorrentDropsStaleState(t *testing.T) {
+	require := require.New(t)
+
+	s, underlying, _ := newPartitionTolerantStoreFixture(PartitionConfig{})
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+	_, err := s.GetPeers(h, 10)
+	require.NoError(err)
+
+	underlying.SetPartitioned(true)
+	require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+
+	// Deletion fails while partitioned, but deleted peers are neither served
+	// stale nor replayed.
+	_, err = s.DeleteTorrent(h)
+	require.Equal(ErrTestPartition, err)
+
+	_, err = s.GetPeers(h, 10)
+	require.Equal(ErrTestPartition, err)
+
+	underlying.SetPartitioned(false)
+	s.reconcile()
+
+	removed, err := s.DeleteTorrent(h)
+	require.NoError(err)
+	require.Equal(1, removed)
+
+	_, err = underlying.GetPeers(h, 10)
+	require.Error(err)
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package peergen generates synthetic swarms and populates peer stores with
+// them, such that load tests and store queries run against realistic data.
+package peergen
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+)
+
+// Config defines the shape of generated swarms.
+type Config struct {
+	// Torrents is the number of generated torrents.
+	Torrents int `yaml:"torrents"`
+
+	// Namespaces is the number of namespaces torrents are spread across.
+	Namespaces int `yaml:"namespaces"`
+
+	// Hosts is the number of agent hosts peers are drawn from. Each host joins
+	// many swarms, like agents pulling many layers.
+	Hosts int `yaml:"hosts"`
+
+	// MaxPeers bounds the number of agent peers of each torrent.
+	MaxPeers int `yaml:"max_peers"`
+
+	// Skew is the zipf exponent of swarm sizes, which must exceed 1. Larger
+	// values concentrate peers in fewer, hotter torrents.
+	Skew float64 `yaml:"skew"`
+
+	// SeederRatio is the fraction of agent peers which completed their
+	// torrent.
+	SeederRatio float64 `yaml:"seeder_ratio"`
+
+	// Origins is the number of origin peers seeding each torrent.
+	Origins int `yaml:"origins"`
+
+	// Zones are assigned to hosts round robin.
+	Zones []string `yaml:"zones"`
+
+	// Seed seeds all randomness, such that the same config always generates
+	// the same swarms.
+	Seed int64 `yaml:"seed"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Torrents == 0 {
+		c.Torrents = 1000
+	}
+	if c.Namespaces == 0 {
+		c.Namespaces = 10
+	}
+	if c.Hosts == 0 {
+		c.Hosts = 1000
+	}
+	if c.MaxPeers == 0 {
+		c.MaxPeers = 500
+	}
+	if c.Skew == 0 {
+		c.Skew = 1.2
+	}
+	if c.SeederRatio == 0 {
+		c.SeederRatio = 0.8
+	}
+	if c.Origins == 0 {
+		c.Origins = 3
+	}
+	if len(c.Zones) == 0 {
+		c.Zones = []string{"zone1", "zone2", "zone3"}
+	}
+	return c
+}
+
+func (c Config) validate() error {
+	if c.Skew <= 1 {
+		return errors.New("skew must exceed 1")
+	}
+	if c.SeederRatio < 0 || c.SeederRatio > 1 {
+		return errors.New("seeder ratio must be within [0, 1]")
+	}
+	if c.MaxPeers > c.Hosts {
+		return fmt.Errorf("max peers %d exceeds %d hosts", c.MaxPeers, c.Hosts)
+	}
+	return nil
+}
+
+// Torrent is a generated torrent and its swarm.
+type Torrent struct {
+	Namespace string
+	Digest    core.Digest
+	InfoHash  core.InfoHash
+	Peers     []*core.PeerInfo
+}
+
+// Generate returns the torrents described by config. Swarm sizes follow a
+// zipf distribution, such that few torrents have many peers, and most have
+// few.
+func Generate(config Config) ([]Torrent, error) {
+	config = config.applyDefaults()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	r := rand.New(rand.NewSource(config.Seed))
+	sizes := rand.NewZipf(r, config.Skew, 1, uint64(config.MaxPeers-1))
+
+	hosts, err := generateHosts(config)
+	if err != nil {
+		return nil, err
+	}
+	origins, err := generateOrigins(config)
+	if err != nil {
+		return nil, err
+	}
+
+	torrents := make([]Torrent, config.Torrents)
+	for i := range torrents {
+		raw := fmt.Sprintf("kraken-peergen-%d-%d", config.Seed, i)
+		d, err := core.NewDigester().FromBytes([]byte(raw))
+		if err != nil {
+			return nil, fmt.Errorf("digest: %s", err)
+		}
+		t := Torrent{
+			Namespace: fmt.Sprintf("peergen-%d", i%config.Namespaces),
+			Digest:    d,
+			InfoHash:  core.NewInfoHashFromBytes([]byte(raw)),
+		}
+		n := int(sizes.Uint64()) + 1
+		for _, j := range sample(r, n, len(hosts)) {
+			p := *hosts[j]
+			p.Complete = r.Float64() < config.SeederRatio
+			t.Peers = append(t.Peers, &p)
+		}
+		t.Peers = append(t.Peers, origins...)
+		torrents[i] = t
+	}
+	return torrents, nil
+}
+
+func generateHosts(config Config) ([]*core.PeerInfo, error) {
+	hosts := make([]*core.PeerInfo, config.Hosts)
+	for i := range hosts {
+		hostname := fmt.Sprintf("peergen-agent-%d", i)
+		pid, err := core.HashedPeerID(hostname)
+		if err != nil {
+			return nil, fmt.Errorf("peer id: %s", err)
+		}
+		p := core.NewPeerInfo(pid, ip(10, i), 16001, false, false)
+		p.Hostname = hostname
+		p.Zone = config.Zones[i%len(config.Zones)]
+		hosts[i] = p
+	}
+	return hosts, nil
+}
+
+func generateOrigins(config Config) ([]*core.PeerInfo, error) {
+	origins := make([]*core.PeerInfo, config.Origins)
+	for i := range origins {
+		hostname := fmt.Sprintf("peergen-origin-%d", i)
+		pid, err := core.HashedPeerID(hostname)
+		if err != nil {
+			return nil, fmt.Errorf("peer id: %s", err)
+		}
+		p := core.NewPeerInfo(pid, ip(11, i), 15001, true, true)
+		p.Hostname = hostname
+		p.Zone = config.Zones[i%len(config.Zones)]
+		origins[i] = p
+	}
+	return origins, nil
+}
+
+// sample returns n distinct random integers in [0, m), in O(n) time using
+// Floyd's algorithm.
+func sample(r *rand.Rand, n, m int) []int {
+	chosen := make(map[int]bool, n)
+	result := make([]int, 0, n)
+	for j := m - n; j < m; j++ {
+		t := r.Intn(j + 1)
+		if chosen[t] {
+			t = j
+		}
+		chosen[t] = true
+		result = append(result, t)
+	}
+	return result
+}
+
+// ip returns the i-th address of the /8 network prefix.
+func ip(prefix, i int) string {
+	return fmt.Sprintf("%d.%d.%d.%d", prefix, (i>>16)&0xff, (i>>8)&0xff, i&0xff)
+}
+
+// Populate writes the peers of torrents to s, in batches of batchSize if s is
+// a peerstore.BatchUpdater. Returns the number of peers written.
+func Populate(s peerstore.Store, torrents []Torrent, batchSize int) (int, error) {
+	b, ok := s.(peerstore.BatchUpdater)
+	if !ok || batchSize <= 0 {
+		var n int
+		for _, t := range torrents {
+			for _, p := range t.Peers {
+				if err := s.UpdatePeer(t.InfoHash, p); err != nil {
+					return n, fmt.Errorf("update peer: %s", err)
+				}
+				n++
+			}
+		}
+		return n, nil
+	}
+	var n int
+	batch := make([]peerstore.PeerUpdate, 0, batchSize)
+	flush := func() error {
+		if err := b.UpdatePeers(batch); err != nil {
+			return fmt.Errorf("update peers: %s", err)
+		}
+		n += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for _, t := range torrents {
+		for _, p := range t.Peers {
+			batch = append(batch, peerstore.PeerUpdate{InfoHash: t.InfoHash, Peer: p})
+			if len(batch) == batchSize {
+				if err := flush(); err != nil {
+					return n, err
+				}
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peergen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/tracker/peerstore"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Torrents: 50, Hosts: 100, MaxPeers: 20, Seed: 7}
+
+	t1, err := Generate(config)
+	require.NoError(err)
+	t2, err := Generate(config)
+	require.NoError(err)
+	require.Equal(t1, t2)
+
+	config.Seed = 8
+	t3, err := Generate(config)
+	require.NoError(err)
+	require.NotEqual(t1[0].InfoHash, t3[0].InfoHash)
+}
+
+func TestGenerateShape(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		Torrents:   200,
+		Namespaces: 4,
+		Hosts:      100,
+		MaxPeers:   50,
+		Origins:    2,
+	}
+	torrents, err := Generate(config)
+	require.NoError(err)
+	require.Len(torrents, 200)
+
+	namespaces := make(map[string]int)
+	infohashes := make(map[string]bool)
+	var largest int
+	for _, tor := range torrents {
+		namespaces[tor.Namespace]++
+		infohashes[tor.InfoHash.Hex()] = true
+
+		require.True(len(tor.Peers) > config.Origins)
+		require.True(len(tor.Peers) <= config.MaxPeers+config.Origins)
+
+		ids := make(map[string]bool)
+		var origins int
+		for _, p := range tor.Peers {
+			require.False(ids[p.PeerID.String()], "duplicate peer in swarm")
+			ids[p.PeerID.String()] = true
+			if p.Origin {
+				origins++
+			}
+		}
+		require.Equal(config.Origins, origins)
+
+		if len(tor.Peers) > largest {
+			largest = len(tor.Peers)
+		}
+	}
+	require.Len(namespaces, 4)
+	require.Len(infohashes, 200)
+
+	// Swarm sizes are skewed: the hottest swarm is much larger than the median.
+	require.True(largest > 10)
+}
+
+func TestGenerateInvalidConfig(t *testing.T) {
+	for _, config := range []Config{
+		{Skew: 0.5},
+		{SeederRatio: 1.5},
+		{Hosts: 10, MaxPeers: 20},
+	} {
+		_, err := Generate(config)
+		require.Error(t, err)
+	}
+}
+
+// batchStore records the batches it is asked to write.
+type batchStore struct {
+	peerstore.Store
+	batches []int
+}
+
+func (s *batchStore) UpdatePeers(updates []peerstore.PeerUpdate) error {
+	s.batches = append(s.batches, len(updates))
+	for _, u := range updates {
+		if err := s.UpdatePeer(u.InfoHash, u.Peer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func generateForPopulate(t *testing.T) ([]Torrent, int) {
+	torrents, err := Generate(Config{Torrents: 20, Hosts: 30, MaxPeers: 10})
+	require.NoError(t, err)
+	var total int
+	for _, tor := range torrents {
+		total += len(tor.Peers)
+	}
+	return torrents, total
+}
+
+func requirePopulated(t *testing.T, s peerstore.Store, torrents []Torrent) {
+	for _, tor := range torrents {
+		peers, err := s.GetPeers(tor.InfoHash, len(tor.Peers))
+		require.NoError(t, err)
+		require.Len(t, peers, len(tor.Peers))
+	}
+}
+
+func TestPopulate(t *testing.T) {
+	require := require.New(t)
+
+	torrents, total := generateForPopulate(t)
+
+	s := peerstore.NewTestStore()
+	n, err := Populate(s, torrents, 10)
+	require.NoError(err)
+	require.Equal(total, n)
+	requirePopulated(t, s, torrents)
+}
+
+func TestPopulateBatches(t *testing.T) {
+	require := require.New(t)
+
+	torrents, total := generateForPopulate(t)
+
+	s := &batchStore{Store: peerstore.NewTestStore()}
+	n, err := Populate(s, torrents, 7)
+	require.NoError(err)
+	require.Equal(total, n)
+	requirePopulated(t, s, torrents)
+
+	var sum int
+	for i, b := range s.batches {
+		if i < len(s.batches)-1 {
+			require.Equal(7, b)
+		}
+		sum += b
+	}
+	require.Equal(total, sum)
+}
@@ -14,10 +14,16 @@
 package peerstore
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/utils/log"
@@ -27,41 +33,213 @@ import (
 	"github.com/garyburd/redigo/redis"
 )
 
-func peerSetKey(h core.InfoHash, window int64) string {
-	return fmt.Sprintf("peerset:%s:%d", h.String(), window)
+// Seeders and leechers are stored in separate sets, such that callers can
+// sample each independently and count them without reading every member.
+//
+// NOTE: Peers written under the legacy "peerset:<hash>:<window>" schema are not
+// read, and will simply expire.
+func peerSetKey(h core.InfoHash, complete bool, window int64) string {
+	kind := "leechers"
+	if complete {
+		kind = "seeders"
+	}
+	return fmt.Sprintf("peerset:%s:%s:%d", h.String(), kind, window)
+}
+
+// Announce counts are tracked per window in a sorted set keyed by infohash.
+func announceCountKey(window int64) string {
+	return fmt.Sprintf("announces:%d", window)
+}
+
+// Host indexes are tracked per window in a set of infohashes keyed by host.
+func hostIndexKey(host string, window int64) string {
+	return fmt.Sprintf("hostindex:%s:%d", host, window)
 }
 
+// Zone indexes are tracked per window in a set of peers keyed by infohash and
+// zone, mirroring peer sets.
+func zoneIndexKey(h core.InfoHash, zone string, complete bool, window int64) string {
+	var kind string
+	if complete {
+		kind = "seeders"
+	} else {
+		kind = "leechers"
+	}
+	return fmt.Sprintf("zoneindex:%s:%s:%s:%d", h.String(), zone, kind, window)
+}
+
+// Peer generations are tracked in a counter per peer, incremented by every
+// write of the peer. Generations are not windowed, since compare-and-set writes
+// must observe every prior write, but expire along with the last window the
+// peer was written to. Keying generations per peer means compare-and-set writes
+// only conflict with writes of the same peer, not with every announce of the
+// torrent.
+func generationKey(h core.InfoHash, id core.PeerID) string {
+	return fmt.Sprintf("peergen:%s:%s", h.String(), id.String())
+}
+
+// Peer throughput is stored as a JSON record per peer, shared by all torrents
+// of the peer, which expires once the peer stops reporting uploads.
+func throughputKey(id core.PeerID) string {
+	return fmt.Sprintf("throughput:%s", id.String())
+}
+
+// Used announce token nonces and restricted torrents are stored as plain keys,
+// which expire with the ttls given by the announce token verifier.
+func tokenNonceKey(nonce string) string {
+	return fmt.Sprintf("tokennonce:%s", nonce)
+}
+
+func restrictedKey(h core.InfoHash) string {
+	return fmt.Sprintf("restricted:%s", h.String())
+}
+
+// Completed peers are tracked in a set of peer ids keyed by infohash.
+// Completions are not windowed, since peers only complete once, and expire
+// _completedTTL after the last one.
+func completedKey(h core.InfoHash) string {
+	return fmt.Sprintf("completed:%s", h.String())
+}
+
+const _completedTTL = 24 * time.Hour
+
+// Last seen times are tracked in a sorted set of peer ids keyed by infohash,
+// scored by the unix time of each peer's last announce. Last seen times are not
+// windowed, since handouts must read the most recent one regardless of which
+// window a peer was sampled from. Members older than the peer TTL are trimmed
+// by every write.
+func lastSeenKey(h core.InfoHash) string {
+	return fmt.Sprintf("lastseen:%s", h.String())
+}
+
+// serializePeer encodes p as 'pid:ip:port', with ':hostname', ':zone', ':ipv6',
+// ':networks', ':rack' and ':dc' appended as needed to encode every set field.
+// IPv6 addresses are encoded as hex, since they contain colons.
 func serializePeer(p *core.PeerInfo) string {
-	var completeBit int
-	if p.Complete {
-		completeBit = 1
+	s := fmt.Sprintf("%s:%s:%d", p.PeerID.String(), encodeIP(p.IP), p.Port)
+	optional := []string{
+		p.Hostname, p.Zone, encodeIP(p.IPv6), encodeNetworks(p), p.Rack, p.DC,
 	}
-	return fmt.Sprintf("%s:%s:%d:%d", p.PeerID.String(), p.IP, p.Port, completeBit)
+	for len(optional) > 0 && optional[len(optional)-1] == "" {
+		optional = optional[:len(optional)-1]
+	}
+	for _, f := range optional {
+		s += ":" + f
+	}
+	return s
+}
+
+// encodeIP hex encodes ip if it contains colons.
+func encodeIP(ip string) string {
+	if !strings.Contains(ip, ":") {
+		return ip
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return hex.EncodeToString(parsed.To16())
+	}
+	return ip
+}
+
+// decodeIP reverses encodeIP.
+func decodeIP(s string) string {
+	if len(s) != 2*net.IPv6len {
+		return s
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return s
+	}
+	return net.IP(b).String()
+}
+
+// encodeNetworks encodes the networks of p as 'label=ip,label=ip', sorted by
+// label. Labels never contain ':', '=' or ','.
+func encodeNetworks(p *core.PeerInfo) string {
+	var pairs []string
+	for _, label := range sortedNetworks(p) {
+		pairs = append(pairs, label+"="+encodeIP(p.Networks[label]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// decodeNetworks reverses encodeNetworks.
+func decodeNetworks(s string) (map[string]string, error) {
+	networks := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid network %q", pair)
+		}
+		networks[parts[0]] = decodeIP(parts[1])
+	}
+	return networks, nil
 }
 
 type peerIdentity struct {
-	peerID core.PeerID
-	ip     string
-	port   int
+	peerID   core.PeerID
+	ip       string
+	port     int
+	hostname string
+	zone     string
+	ipv6     string
+	networks string
+	rack     string
+	dc       string
 }
 
-func deserializePeer(s string) (id peerIdentity, complete bool, err error) {
+func (id peerIdentity) peerInfo(complete bool) *core.PeerInfo {
+	p := core.NewPeerInfo(id.peerID, id.ip, id.port, false, complete)
+	p.Hostname = id.hostname
+	p.Zone = id.zone
+	p.Rack = id.rack
+	p.DC = id.dc
+	p.IPv6 = id.ipv6
+	if id.networks != "" {
+		// Validated by deserializePeer.
+		p.Networks, _ = decodeNetworks(id.networks)
+	}
+	return p
+}
+
+func deserializePeer(s string) (id peerIdentity, err error) {
 	parts := strings.Split(s, ":")
-	if len(parts) != 4 {
-		return id, false, fmt.Errorf("invalid peer encoding: expected 'pid:ip:port:complete'")
+	if len(parts) < 3 || len(parts) > 9 {
+		return id, fmt.Errorf(
+			"invalid peer encoding: " +
+				"expected 'pid:ip:port[:hostname[:zone[:ipv6[:networks[:rack[:dc]]]]]]'")
 	}
 	peerID, err := core.NewPeerID(parts[0])
 	if err != nil {
-		return id, false, fmt.Errorf("parse peer id: %s", err)
+		return id, fmt.Errorf("parse peer id: %s", err)
 	}
-	ip := parts[1]
+	ip := decodeIP(parts[1])
 	port, err := strconv.Atoi(parts[2])
 	if err != nil {
-		return id, false, fmt.Errorf("parse port: %s", err)
+		return id, fmt.Errorf("parse port: %s", err)
+	}
+	var hostname, zone, ipv6, networks, rack, dc string
+	if len(parts) > 3 {
+		hostname = parts[3]
 	}
-	id = peerIdentity{peerID, ip, port}
-	complete = parts[3] == "1"
-	return id, complete, nil
+	if len(parts) > 4 {
+		zone = parts[4]
+	}
+	if len(parts) > 5 {
+		ipv6 = decodeIP(parts[5])
+	}
+	if len(parts) > 6 && parts[6] != "" {
+		networks = parts[6]
+		if _, err := decodeNetworks(networks); err != nil {
+			return id, fmt.Errorf("parse networks: %s", err)
+		}
+	}
+	if len(parts) > 7 {
+		rack = parts[7]
+	}
+	if len(parts) > 8 {
+		dc = parts[8]
+	}
+	return peerIdentity{peerID, ip, port, hostname, zone, ipv6, networks, rack, dc}, nil
 }
 
 // RedisStore is a Store backed by Redis.
@@ -75,28 +253,48 @@ type RedisStore struct {
 func NewRedisStore(config RedisConfig, clk clock.Clock) (*RedisStore, error) {
 	config.applyDefaults()
 
-	if config.Addr == "" {
+	if config.Sentinel.enabled() {
+		if config.Sentinel.MasterName == "" {
+			return nil, errors.New("invalid config: missing sentinel master_name")
+		}
+	} else if config.Addr == "" {
 		return nil, errors.New("invalid config: missing addr")
 	}
 
+	opts := []redis.DialOption{
+		redis.DialConnectTimeout(config.DialTimeout),
+		redis.DialReadTimeout(config.ReadTimeout),
+		redis.DialWriteTimeout(config.WriteTimeout),
+	}
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", config.Addr, opts...)
+		},
+		MaxIdle:     config.MaxIdleConns,
+		MaxActive:   config.MaxActiveConns,
+		IdleTimeout: config.IdleConnTimeout,
+		Wait:        true,
+	}
+	if config.Sentinel.enabled() {
+		pool.Dial = func() (redis.Conn, error) {
+			addr, err := sentinelMaster(config.Sentinel, opts)
+			if err != nil {
+				return nil, err
+			}
+			return redis.Dial("tcp", addr, opts...)
+		}
+		pool.TestOnBorrow = func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < config.Sentinel.RoleCheckInterval {
+				return nil
+			}
+			return checkMasterRole(c)
+		}
+	}
+
 	s := &RedisStore{
 		config: config,
-		pool: &redis.Pool{
-			Dial: func() (redis.Conn, error) {
-				// TODO Add options
-				return redis.Dial(
-					"tcp",
-					config.Addr,
-					redis.DialConnectTimeout(config.DialTimeout),
-					redis.DialReadTimeout(config.ReadTimeout),
-					redis.DialWriteTimeout(config.WriteTimeout))
-			},
-			MaxIdle:     config.MaxIdleConns,
-			MaxActive:   config.MaxActiveConns,
-			IdleTimeout: config.IdleConnTimeout,
-			Wait:        true,
-		},
-		clk: clk,
+		pool:   pool,
+		clk:    clk,
 	}
 
 	// Ensure we can connect to Redis.
@@ -112,6 +310,11 @@ func NewRedisStore(config RedisConfig, clk clock.Clock) (*RedisStore, error) {
 // Close implements Store.
 func (s *RedisStore) Close() {}
 
+// key prefixes k with the configured key prefix.
+func (s *RedisStore) key(k string) string {
+	return s.config.KeyPrefix + k
+}
+
 func (s *RedisStore) curPeerSetWindow() int64 {
 	t := s.clk.Now().Unix()
 	return t - (t % int64(s.config.PeerSetWindowSize.Seconds()))
@@ -126,54 +329,364 @@ func (s *RedisStore) peerSetWindows() []int64 {
 	return ws
 }
 
+// expireAt returns the unix time at which keys written in window w expire,
+// plus a random duration below the configured TTL jitter, such that keys of
+// torrents announced in the same window do not all expire at once.
+func (s *RedisStore) expireAt(w int64) int64 {
+	e := w + int64(s.config.PeerSetWindowSize.Seconds())*int64(s.config.MaxPeerSetWindows)
+	if j := int64(s.config.TTLJitter.Seconds()); j > 0 {
+		e += rand.Int63n(j)
+	}
+	return e
+}
+
 // UpdatePeer writes p to Redis with a TTL.
 func (s *RedisStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
+	return s.UpdatePeers([]PeerUpdate{{h, p}})
+}
+
+// UpdatePeers implements BatchUpdater. All updates are pipelined in a single
+// round trip.
+func (s *RedisStore) UpdatePeers(updates []PeerUpdate) error {
+	_, err := s.UpdateVersionedPeers(updates)
+	return err
+}
+
+// UpdateVersionedPeer implements VersionedStore.
+func (s *RedisStore) UpdateVersionedPeer(h core.InfoHash, p *core.PeerInfo) (uint64, error) {
+	gens, err := s.UpdateVersionedPeers([]PeerUpdate{{h, p}})
+	if err != nil {
+		return 0, err
+	}
+	return gens[0], nil
+}
+
+// UpdateVersionedPeers implements VersionedBatchUpdater. All updates are
+// pipelined in a single round trip.
+func (s *RedisStore) UpdateVersionedPeers(updates []PeerUpdate) ([]uint64, error) {
 	c := s.pool.Get()
 	defer c.Close()
 
 	w := s.curPeerSetWindow()
-	expireAt := w + int64(s.config.PeerSetWindowSize.Seconds())*int64(s.config.MaxPeerSetWindows)
+	expireAt := s.expireAt(w)
+
+	var cmds [][]interface{}
+	offsets := make([]int, len(updates))
+	for i, u := range updates {
+		offsets[i] = len(cmds)
+		cmds = append(cmds, s.updateCommands(u.InfoHash, u.Peer, w, expireAt)...)
+	}
+	replies, err := pipelineReplies(c, cmds)
+	if err != nil {
+		return nil, err
+	}
+	gens := make([]uint64, len(updates))
+	for i, o := range offsets {
+		gens[i], err = redis.Uint64(replies[o], nil)
+		if err != nil {
+			return nil, fmt.Errorf("INCR: %s", err)
+		}
+	}
+	return gens, nil
+}
 
-	// Add p to the current window.
-	k := peerSetKey(h, w)
+// GetPeerGeneration implements VersionedStore.
+func (s *RedisStore) GetPeerGeneration(h core.InfoHash, id core.PeerID) (uint64, error) {
+	c := s.pool.Get()
+	defer c.Close()
 
-	if err := c.Send("SADD", k, serializePeer(p)); err != nil {
-		return fmt.Errorf("send SADD: %s", err)
+	return s.getGeneration(c, h, id)
+}
+
+func (s *RedisStore) getGeneration(c redis.Conn, h core.InfoHash, id core.PeerID) (uint64, error) {
+	gen, err := redis.Uint64(c.Do("GET", s.key(generationKey(h, id))))
+	if err == redis.ErrNil {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("GET: %s", err)
 	}
-	if err := c.Send("EXPIREAT", k, expireAt); err != nil {
-		return fmt.Errorf("send EXPIREAT: %s", err)
+	return gen, nil
+}
+
+// CompareAndUpdatePeer implements VersionedStore. The generation of p is
+// watched, such that the write is aborted if another writer updates p between
+// reading and writing the generation. Writes of other peers of h do not abort
+// the write.
+func (s *RedisStore) CompareAndUpdatePeer(
+	h core.InfoHash, p *core.PeerInfo, gen uint64) (uint64, error) {
+
+	c := s.pool.Get()
+	defer c.Close()
+
+	if _, err := c.Do("WATCH", s.key(generationKey(h, p.PeerID))); err != nil {
+		return 0, fmt.Errorf("WATCH: %s", err)
+	}
+	cur, err := s.getGeneration(c, h, p.PeerID)
+	if err != nil {
+		c.Do("UNWATCH")
+		return 0, err
+	}
+	if cur != gen {
+		c.Do("UNWATCH")
+		return 0, ErrGenerationConflict
+	}
+
+	w := s.curPeerSetWindow()
+
+	if err := c.Send("MULTI"); err != nil {
+		return 0, fmt.Errorf("send MULTI: %s", err)
+	}
+	for _, cmd := range s.updateCommands(h, p, w, s.expireAt(w)) {
+		if err := c.Send(cmd[0].(string), cmd[1:]...); err != nil {
+			return 0, fmt.Errorf("send %s: %s", cmd[0], err)
+		}
+	}
+	replies, err := redis.Values(c.Do("EXEC"))
+	if err == redis.ErrNil {
+		// The watched generation changed before EXEC.
+		return 0, ErrGenerationConflict
+	} else if err != nil {
+		return 0, fmt.Errorf("EXEC: %s", err)
+	}
+	newGen, err := redis.Uint64(replies[0], nil)
+	if err != nil {
+		return 0, fmt.Errorf("INCR: %s", err)
+	}
+	return newGen, nil
+}
+
+// updateCommands returns the commands which add p to window w.
+func (s *RedisStore) updateCommands(
+	h core.InfoHash, p *core.PeerInfo, w, expireAt int64) [][]interface{} {
+
+	k := s.key(peerSetKey(h, p.Complete, w))
+	gk := s.key(generationKey(h, p.PeerID))
+	member := serializePeer(p)
+
+	// The generation is incremented first, such that writers can read the new
+	// generation from the first reply.
+	cmds := [][]interface{}{
+		{"INCR", gk},
+		{"EXPIREAT", gk, expireAt},
+		{"SADD", k, member},
+		{"EXPIREAT", k, expireAt},
+	}
+	if p.Complete {
+		// Peers never transition from complete to incomplete, so we only need
+		// to clean up the leecher set of the current window.
+		cmds = append(cmds, []interface{}{"SREM", s.key(peerSetKey(h, false, w)), member})
+		if !p.Origin {
+			ck := s.key(completedKey(h))
+			cmds = append(cmds,
+				[]interface{}{"SADD", ck, p.PeerID.String()},
+				[]interface{}{"EXPIRE", ck, int64(_completedTTL.Seconds())})
+		}
+	}
+	if s.config.TrackAnnounceCounts {
+		ck := s.key(announceCountKey(w))
+		cmds = append(cmds,
+			[]interface{}{"ZINCRBY", ck, 1, h.String()},
+			[]interface{}{"EXPIREAT", ck, expireAt})
+	}
+	if s.config.IndexPeers {
+		cmds = append(cmds, s.indexCommands(h, p, member, w, expireAt)...)
+	}
+	if s.config.TrackLastSeen {
+		lk := s.key(lastSeenKey(h))
+		now := s.clk.Now().Unix()
+		ttl := int64(s.config.PeerSetWindowSize.Seconds()) * int64(s.config.MaxPeerSetWindows)
+		cmds = append(cmds,
+			[]interface{}{"ZADD", lk, now, p.PeerID.String()},
+			[]interface{}{"ZREMRANGEBYSCORE", lk, "-inf", now - ttl},
+			[]interface{}{"EXPIREAT", lk, expireAt})
+	}
+	return cmds
+}
+
+// indexCommands returns the commands which add p to the host and zone indexes
+// of window w.
+func (s *RedisStore) indexCommands(
+	h core.InfoHash, p *core.PeerInfo, member string, w, expireAt int64) [][]interface{} {
+
+	var cmds [][]interface{}
+	for _, host := range peerHosts(p) {
+		k := s.key(hostIndexKey(host, w))
+		cmds = append(cmds,
+			[]interface{}{"SADD", k, h.String()},
+			[]interface{}{"EXPIREAT", k, expireAt})
+	}
+	if p.Zone != "" {
+		k := s.key(zoneIndexKey(h, p.Zone, p.Complete, w))
+		cmds = append(cmds,
+			[]interface{}{"SADD", k, member},
+			[]interface{}{"EXPIREAT", k, expireAt})
+		if p.Complete {
+			cmds = append(cmds, []interface{}{"SREM", s.key(zoneIndexKey(h, p.Zone, false, w)), member})
+		}
+	}
+	return cmds
+}
+
+// pipeline sends cmds over c in a single round trip.
+func pipeline(c redis.Conn, cmds [][]interface{}) error {
+	_, err := pipelineReplies(c, cmds)
+	return err
+}
+
+// pipelineReplies sends cmds over c in a single round trip, returning the reply
+// of each command.
+func pipelineReplies(c redis.Conn, cmds [][]interface{}) ([]interface{}, error) {
+	for _, cmd := range cmds {
+		if err := c.Send(cmd[0].(string), cmd[1:]...); err != nil {
+			return nil, fmt.Errorf("send %s: %s", cmd[0], err)
+		}
 	}
 	if err := c.Flush(); err != nil {
-		return fmt.Errorf("flush: %s", err)
+		return nil, fmt.Errorf("flush: %s", err)
 	}
-	if _, err := c.Receive(); err != nil {
-		return fmt.Errorf("SADD: %s", err)
+	replies := make([]interface{}, len(cmds))
+	for i, cmd := range cmds {
+		r, err := c.Receive()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", cmd[0], err)
+		}
+		replies[i] = r
 	}
-	if _, err := c.Receive(); err != nil {
-		return fmt.Errorf("EXPIREAT: %s", err)
+	return replies, nil
+}
+
+// GetInfoHashesByHost implements PeerIndex. Returns ErrNoPeerIndex if peers
+// are not indexed.
+func (s *RedisStore) GetInfoHashesByHost(host string) ([]core.InfoHash, error) {
+	if !s.config.IndexPeers {
+		return nil, ErrNoPeerIndex
 	}
-	return nil
+
+	c := s.pool.Get()
+	defer c.Close()
+
+	seen := make(map[core.InfoHash]bool)
+	var result []core.InfoHash
+	for _, w := range s.peerSetWindows() {
+		members, err := redis.Strings(c.Do("SMEMBERS", s.key(hostIndexKey(host, w))))
+		if err != nil {
+			return nil, fmt.Errorf("SMEMBERS: %s", err)
+		}
+		for _, raw := range members {
+			h, err := core.NewInfoHashFromHex(raw)
+			if err != nil {
+				log.Errorf("Error parsing host index infohash %q: %s", raw, err)
+				continue
+			}
+			if !seen[h] {
+				seen[h] = true
+				result = append(result, h)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Hex() < result[j].Hex() })
+	return result, nil
 }
 
-// GetPeers returns at most n PeerInfos associated with h.
-func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
+// GetPeersByZone implements PeerIndex. Returns ErrNoPeerIndex if peers are
+// not indexed.
+func (s *RedisStore) GetPeersByZone(h core.InfoHash, zone string) ([]*core.PeerInfo, error) {
+	if !s.config.IndexPeers {
+		return nil, ErrNoPeerIndex
+	}
+
+	c := s.pool.Get()
+	defer c.Close()
+
+	// Seeders are read first, such that peers which completed since their
+	// leecher entry was written are reported as seeders.
+	seen := make(map[core.PeerID]bool)
+	var result []*core.PeerInfo
+	for _, complete := range []bool{true, false} {
+		for _, w := range s.peerSetWindows() {
+			members, err := redis.Strings(c.Do("SMEMBERS", s.key(zoneIndexKey(h, zone, complete, w))))
+			if err != nil {
+				return nil, fmt.Errorf("SMEMBERS: %s", err)
+			}
+			for _, raw := range members {
+				id, err := deserializePeer(raw)
+				if err != nil {
+					log.Errorf("Error deserializing peer %q: %s", raw, err)
+					continue
+				}
+				if !seen[id.peerID] {
+					seen[id.peerID] = true
+					result = append(result, id.peerInfo(complete))
+				}
+			}
+		}
+	}
+	return core.SortedByPeerID(result), nil
+}
+
+// HottestInfoHashes implements HotInfoHashLister. Counts are summed over the
+// current and previous windows, considering only the top n of each window.
+// Returns an error if announce counts are not tracked.
+func (s *RedisStore) HottestInfoHashes(n int) ([]core.InfoHash, error) {
+	if !s.config.TrackAnnounceCounts {
+		return nil, errors.New("announce counts not tracked")
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+
 	c := s.pool.Get()
 	defer c.Close()
 
-	// Try to sample n peers from each window in randomized order until we have
-	// collected n distinct peers. This achieves random sampling across multiple
-	// windows.
-	// TODO(codyg): One limitation of random window sampling is we're no longer
-	// guaranteed to include the latest completion bits. A simple way to mitigate
-	// this is to decrease the number of windows.
+	cur := s.curPeerSetWindow()
+	windows := []int64{cur, cur - int64(s.config.PeerSetWindowSize.Seconds())}
+
+	counts := make(map[core.InfoHash]int64)
+	for _, w := range windows {
+		result, err := redis.Int64Map(
+			c.Do("ZREVRANGE", s.key(announceCountKey(w)), 0, n-1, "WITHSCORES"))
+		if err != nil {
+			return nil, fmt.Errorf("ZREVRANGE: %s", err)
+		}
+		for raw, count := range result {
+			h, err := core.NewInfoHashFromHex(raw)
+			if err != nil {
+				log.Errorf("Error parsing announce count infohash %q: %s", raw, err)
+				continue
+			}
+			counts[h] += count
+		}
+	}
+	hashes := make([]core.InfoHash, 0, len(counts))
+	for h := range counts {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return counts[hashes[i]] > counts[hashes[j]]
+	})
+	if len(hashes) > n {
+		hashes = hashes[:n]
+	}
+	return hashes, nil
+}
+
+// samplePeerSets tries to sample n peers from each window in randomized order
+// until we have collected n distinct peers. This achieves random sampling
+// across multiple windows.
+// TODO(codyg): One limitation of random window sampling is we're no longer
+// guaranteed to include the latest completion bits. A simple way to mitigate
+// this is to decrease the number of windows.
+func (s *RedisStore) samplePeerSets(
+	c redis.Conn, h core.InfoHash, complete bool, n int) (map[peerIdentity]bool, error) {
+
 	windows := s.peerSetWindows()
 	randutil.ShuffleInt64s(windows)
 
-	// Eliminate duplicates from other windows and collapses complete bits.
+	// Eliminates duplicates from other windows.
 	selected := make(map[peerIdentity]bool)
 
 	for i := 0; len(selected) < n && i < len(windows); i++ {
-		k := peerSetKey(h, windows[i])
+		k := s.key(peerSetKey(h, complete, windows[i]))
 		result, err := redis.Strings(c.Do("SRANDMEMBER", k, n-len(selected)))
 		if err == redis.ErrNil {
 			continue
@@ -181,19 +694,501 @@ func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 			return nil, err
 		}
 		for _, s := range result {
-			id, complete, err := deserializePeer(s)
+			id, err := deserializePeer(s)
 			if err != nil {
 				log.Errorf("Error deserializing peer %q: %s", s, err)
 				continue
 			}
-			selected[id] = selected[id] || complete
+			selected[id] = true
 		}
 	}
+	return selected, nil
+}
 
-	var peers []*core.PeerInfo
-	for id, complete := range selected {
-		p := core.NewPeerInfo(id.peerID, id.ip, id.port, false, complete)
-		peers = append(peers, p)
+// GetPeers returns at most n PeerInfos associated with h.
+func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
+	seeders, leechers, err := s.GetSeedersAndLeechers(h, n, n)
+	if err != nil {
+		return nil, err
+	}
+	peers := append(seeders, leechers...)
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	if len(peers) > n {
+		peers = peers[:n]
 	}
 	return peers, nil
 }
+
+// GetSeedersAndLeechers returns at most nSeeders seeders and nLeechers
+// leechers associated with h.
+func (s *RedisStore) GetSeedersAndLeechers(
+	h core.InfoHash, nSeeders, nLeechers int) (seeders, leechers []*core.PeerInfo, err error) {
+
+	c := s.pool.Get()
+	defer c.Close()
+
+	selectedSeeders, err := s.samplePeerSets(c, h, true, nSeeders)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sample seeders: %s", err)
+	}
+	selectedLeechers, err := s.samplePeerSets(c, h, false, nLeechers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sample leechers: %s", err)
+	}
+	for id := range selectedSeeders {
+		seeders = append(seeders, id.peerInfo(true))
+	}
+	for id := range selectedLeechers {
+		if selectedSeeders[id] {
+			// Peer has completed since its leecher entry was written.
+			continue
+		}
+		leechers = append(leechers, id.peerInfo(false))
+	}
+	if s.config.TrackLastSeen {
+		// Last seen times only inform handouts, so peers are still returned
+		// without them.
+		peers := append(append([]*core.PeerInfo(nil), seeders...), leechers...)
+		if err := s.setLastSeen(c, h, peers); err != nil {
+			log.With("hash", h).Errorf("Error reading last seen times: %s", err)
+		}
+	}
+	return seeders, leechers, nil
+}
+
+// setLastSeen sets the LastSeen time of each of peers of h. Peers without a
+// record are left unchanged.
+func (s *RedisStore) setLastSeen(c redis.Conn, h core.InfoHash, peers []*core.PeerInfo) error {
+	if len(peers) == 0 {
+		return nil
+	}
+	k := s.key(lastSeenKey(h))
+	cmds := make([][]interface{}, len(peers))
+	for i, p := range peers {
+		cmds[i] = []interface{}{"ZSCORE", k, p.PeerID.String()}
+	}
+	replies, err := pipelineReplies(c, cmds)
+	if err != nil {
+		return err
+	}
+	for i, r := range replies {
+		if r == nil {
+			continue
+		}
+		sec, err := redis.Float64(r, nil)
+		if err != nil {
+			return fmt.Errorf("ZSCORE: %s", err)
+		}
+		peers[i].LastSeen = time.Unix(int64(sec), 0)
+	}
+	return nil
+}
+
+// EstimatePeerCount estimates swarm size using the cardinality of the current
+// and previous windows, which Redis tracks in constant time. Since active peers
+// announce into every window, the larger of the two windows approximates the
+// active swarm while ignoring peers which stopped announcing long ago.
+func (s *RedisStore) EstimatePeerCount(h core.InfoHash) (seeders, leechers int, err error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	cur := s.curPeerSetWindow()
+	windows := []int64{cur, cur - int64(s.config.PeerSetWindowSize.Seconds())}
+
+	for _, w := range windows {
+		for _, complete := range []bool{true, false} {
+			if err := c.Send("SCARD", s.key(peerSetKey(h, complete, w))); err != nil {
+				return 0, 0, fmt.Errorf("send SCARD: %s", err)
+			}
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return 0, 0, fmt.Errorf("flush: %s", err)
+	}
+	for range windows {
+		for _, complete := range []bool{true, false} {
+			n, err := redis.Int(c.Receive())
+			if err != nil {
+				return 0, 0, fmt.Errorf("SCARD: %s", err)
+			}
+			if complete && n > seeders {
+				seeders = n
+			} else if !complete && n > leechers {
+				leechers = n
+			}
+		}
+	}
+	return seeders, leechers, nil
+}
+
+// Scrape implements Scraper. Seeders and leechers are estimated as in
+// EstimatePeerCount, and completed peers are counted exactly. All hashes are
+// counted in a single round trip.
+func (s *RedisStore) Scrape(hashes []core.InfoHash) ([]SwarmStats, error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	cur := s.curPeerSetWindow()
+	windows := []int64{cur, cur - int64(s.config.PeerSetWindowSize.Seconds())}
+
+	for _, h := range hashes {
+		for _, w := range windows {
+			for _, complete := range []bool{true, false} {
+				if err := c.Send("SCARD", s.key(peerSetKey(h, complete, w))); err != nil {
+					return nil, fmt.Errorf("send SCARD: %s", err)
+				}
+			}
+		}
+		if err := c.Send("SCARD", s.key(completedKey(h))); err != nil {
+			return nil, fmt.Errorf("send SCARD: %s", err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, fmt.Errorf("flush: %s", err)
+	}
+	stats := make([]SwarmStats, len(hashes))
+	for i := range hashes {
+		for range windows {
+			for _, complete := range []bool{true, false} {
+				n, err := redis.Int(c.Receive())
+				if err != nil {
+					return nil, fmt.Errorf("SCARD: %s", err)
+				}
+				if complete && n > stats[i].Seeders {
+					stats[i].Seeders = n
+				} else if !complete && n > stats[i].Leechers {
+					stats[i].Leechers = n
+				}
+			}
+		}
+		n, err := redis.Int(c.Receive())
+		if err != nil {
+			return nil, fmt.Errorf("SCARD: %s", err)
+		}
+		stats[i].Completed = n
+	}
+	return stats, nil
+}
+
+// DeleteTorrent implements TorrentDeleter. The peer sets of h are read first,
+// such that the generations and index entries of its peers can be removed
+// along with them in a single round trip.
+func (s *RedisStore) DeleteTorrent(h core.InfoHash) (int, error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	windows := s.peerSetWindows()
+
+	cmds := [][]interface{}{
+		{"DEL", s.key(completedKey(h))},
+		{"DEL", s.key(lastSeenKey(h))},
+	}
+	ids := make(map[core.PeerID]bool)
+	for _, w := range windows {
+		for _, complete := range []bool{true, false} {
+			k := s.key(peerSetKey(h, complete, w))
+			members, err := redis.Strings(c.Do("SMEMBERS", k))
+			if err != nil {
+				return 0, fmt.Errorf("SMEMBERS: %s", err)
+			}
+			cmds = append(cmds, []interface{}{"DEL", k})
+			zones := make(map[string]bool)
+			for _, m := range members {
+				id, err := deserializePeer(m)
+				if err != nil {
+					log.Errorf("Error deserializing peer %q: %s", m, err)
+					continue
+				}
+				if !ids[id.peerID] {
+					ids[id.peerID] = true
+					cmds = append(cmds, []interface{}{"DEL", s.key(generationKey(h, id.peerID))})
+				}
+				if !s.config.IndexPeers {
+					continue
+				}
+				for _, host := range peerHosts(id.peerInfo(complete)) {
+					cmds = append(cmds, []interface{}{"SREM", s.key(hostIndexKey(host, w)), h.String()})
+				}
+				if id.zone != "" && !zones[id.zone] {
+					zones[id.zone] = true
+					cmds = append(cmds, []interface{}{"DEL", s.key(zoneIndexKey(h, id.zone, complete, w))})
+				}
+			}
+		}
+		if s.config.TrackAnnounceCounts {
+			cmds = append(cmds, []interface{}{"ZREM", s.key(announceCountKey(w)), h.String()})
+		}
+	}
+	if err := pipeline(c, cmds); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// GetThroughput implements ThroughputStore.
+func (s *RedisStore) GetThroughput(ids []core.PeerID) (map[core.PeerID]ThroughputRecord, error) {
+	records := make(map[core.PeerID]ThroughputRecord)
+	if len(ids) == 0 {
+		return records, nil
+	}
+	c := s.pool.Get()
+	defer c.Close()
+
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = s.key(throughputKey(id))
+	}
+	values, err := redis.Values(c.Do("MGET", keys...))
+	if err != nil {
+		return nil, fmt.Errorf("MGET: %s", err)
+	}
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		b, err := redis.Bytes(v, nil)
+		if err != nil {
+			return nil, fmt.Errorf("MGET: %s", err)
+		}
+		var r ThroughputRecord
+		if err := json.Unmarshal(b, &r); err != nil {
+			log.With("peer_id", ids[i]).Errorf("Error unmarshaling throughput record: %s", err)
+			continue
+		}
+		records[ids[i]] = r
+	}
+	return records, nil
+}
+
+// SetThroughput implements ThroughputStore.
+func (s *RedisStore) SetThroughput(id core.PeerID, r ThroughputRecord, ttl time.Duration) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	c := s.pool.Get()
+	defer c.Close()
+
+	if _, err := c.Do("SET", s.key(throughputKey(id)), b, "PX", int64(ttl/time.Millisecond)); err != nil {
+		return fmt.Errorf("SET: %s", err)
+	}
+	return nil
+}
+
+// UseNonce implements announcetoken.Store.
+func (s *RedisStore) UseNonce(nonce string, ttl time.Duration) (bool, error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	_, err := redis.String(c.Do("SET", s.key(tokenNonceKey(nonce)), 1, "PX", int64(ttl/time.Millisecond), "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("SET: %s", err)
+	}
+	return true, nil
+}
+
+// RestrictTorrent implements announcetoken.Store.
+func (s *RedisStore) RestrictTorrent(h core.InfoHash, ttl time.Duration) error {
+	c := s.pool.Get()
+	defer c.Close()
+
+	if _, err := c.Do("SET", s.key(restrictedKey(h)), 1, "PX", int64(ttl/time.Millisecond)); err != nil {
+		return fmt.Errorf("SET: %s", err)
+	}
+	return nil
+}
+
+// RestrictedTorrent implements announcetoken.Store.
+func (s *RedisStore) RestrictedTorrent(h core.InfoHash) (bool, error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	ok, err := redis.Bool(c.Do("EXISTS", s.key(restrictedKey(h))))
+	if err != nil {
+		return false, fmt.Errorf("EXISTS: %s", err)
+	}
+	return ok, nil
+}
+
+// _keyspaces maps keyspace names to the prefixes of their keys.
+var _keyspaces = map[string]string{
+	"peersets":   "peerset:",
+	"announces":  "announces:",
+	"hostindex":  "hostindex:",
+	"zoneindex":  "zoneindex:",
+	"peergen":    "peergen:",
+	"completed":  "completed:",
+	"throughput": "throughput:",
+	"lastseen":   "lastseen:",
+	"tokennonce": "tokennonce:",
+	"restricted": "restricted:",
+}
+
+// _cardCommands maps keyspace names to the command which counts the records of
+// a key, for keyspaces not stored as sets.
+var _cardCommands = map[string]string{
+	"announces":  "ZCARD",
+	"lastseen":   "ZCARD",
+	"peergen":    "EXISTS",
+	"throughput": "EXISTS",
+	"tokennonce": "EXISTS",
+	"restricted": "EXISTS",
+}
+
+// scan calls f with every key matching prefix.
+func scan(c redis.Conn, prefix string, f func(key string) error) error {
+	cursor := "0"
+	for {
+		result, err := redis.Values(c.Do("SCAN", cursor, "MATCH", prefix+"*", "COUNT", 1000))
+		if err != nil {
+			return fmt.Errorf("SCAN: %s", err)
+		}
+		if len(result) != 2 {
+			return fmt.Errorf("SCAN: unexpected reply length %d", len(result))
+		}
+		cursor, err = redis.String(result[0], nil)
+		if err != nil {
+			return fmt.Errorf("SCAN cursor: %s", err)
+		}
+		keys, err := redis.Strings(result[1], nil)
+		if err != nil {
+			return fmt.Errorf("SCAN keys: %s", err)
+		}
+		for _, k := range keys {
+			if err := f(k); err != nil {
+				return err
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// Usage implements Compactor. Keys are scanned, so Usage is expensive and
+// should only be called by admin jobs.
+func (s *RedisStore) Usage() (Usage, error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	usage := make(Usage)
+	for name, prefix := range _keyspaces {
+		card, ok := _cardCommands[name]
+		if !ok {
+			card = "SCARD"
+		}
+		var u KeyspaceUsage
+		err := scan(c, s.key(prefix), func(k string) error {
+			n, err := redis.Int(c.Do(card, k))
+			if err != nil {
+				return fmt.Errorf("%s: %s", card, err)
+			}
+			u.Keys++
+			u.Records += n
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		usage[name] = u
+	}
+	return usage, nil
+}
+
+// Compact implements Compactor. Keys are removed if they belong to a window
+// which is no longer read, were written under the legacy peer set schema, or
+// are missing a TTL, e.g. due to a partially applied pipeline.
+func (s *RedisStore) Compact() (int, error) {
+	return s.deleteKeys(s.orphaned)
+}
+
+// DeleteExpiredPeers implements ExpiredPeerDeleter. Peers are stored in
+// windowed keys, so keys are removed if they belong to a window which is no
+// longer read. Unlike Compact, legacy keys and keys missing a TTL are kept.
+func (s *RedisStore) DeleteExpiredPeers() (int, error) {
+	return s.deleteKeys(func(c redis.Conn, k string, oldest int64) (bool, error) {
+		w, ok := keyWindow(k)
+		return ok && w < oldest, nil
+	})
+}
+
+// deleteKeys removes all keys of the store for which match returns true, where
+// oldest is the oldest window still read, returning the number of keys
+// removed.
+func (s *RedisStore) deleteKeys(
+	match func(c redis.Conn, k string, oldest int64) (bool, error)) (int, error) {
+
+	c := s.pool.Get()
+	defer c.Close()
+
+	windows := s.peerSetWindows()
+	oldest := windows[len(windows)-1]
+
+	var matched []string
+	for _, prefix := range _keyspaces {
+		err := scan(c, s.key(prefix), func(k string) error {
+			ok, err := match(c, k, oldest)
+			if err != nil {
+				return err
+			}
+			if ok {
+				matched = append(matched, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	var removed int
+	for _, k := range matched {
+		n, err := redis.Int(c.Do("DEL", k))
+		if err != nil {
+			return removed, fmt.Errorf("DEL: %s", err)
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+// orphaned returns whether k can be removed, where oldest is the oldest window
+// still read.
+func (s *RedisStore) orphaned(c redis.Conn, k string, oldest int64) (bool, error) {
+	if isLegacyPeerSetKey(strings.TrimPrefix(k, s.config.KeyPrefix)) {
+		return true, nil
+	}
+	w, ok := keyWindow(k)
+	if !ok {
+		// Not written by this store.
+		return false, nil
+	}
+	if w < oldest {
+		return true, nil
+	}
+	ttl, err := redis.Int64(c.Do("TTL", k))
+	if err != nil {
+		return false, fmt.Errorf("TTL: %s", err)
+	}
+	// TTL returns -1 for keys which exist without an expiry.
+	return ttl == -1, nil
+}
+
+// keyWindow returns the window k was written in, or false if k is not
+// windowed.
+func keyWindow(k string) (int64, bool) {
+	i := strings.LastIndex(k, ":")
+	w, err := strconv.ParseInt(k[i+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return w, true
+}
+
+// isLegacyPeerSetKey returns whether k follows the legacy
+// "peerset:<hash>:<window>" schema.
+func isLegacyPeerSetKey(k string) bool {
+	return strings.HasPrefix(k, "peerset:") && strings.Count(k, ":") == 2
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build acceptance
+// +build acceptance
+
+package peerstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/test/containers"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// _redisAddr is the address of the Redis container which the Redis suite runs
+// against in acceptance tests.
+var _redisAddr string
+
+func TestMain(m *testing.M) {
+	c, err := containers.StartRedis()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "start redis: %s\n", err)
+		os.Exit(1)
+	}
+	_redisAddr = c.Addr()
+	code := m.Run()
+	c.Close()
+	os.Exit(code)
+}
+
+// redisConfigFixture flushes the shared Redis, such that tests which inspect
+// the keyspace do not observe keys written by previous tests.
+func redisConfigFixture() RedisConfig {
+	conn, err := redis.Dial("tcp", _redisAddr)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Do("FLUSHALL"); err != nil {
+		panic(err)
+	}
+	return RedisConfig{
+		Addr:              _redisAddr,
+		PeerSetWindowSize: 30 * time.Second,
+		MaxPeerSetWindows: 4,
+	}
+}
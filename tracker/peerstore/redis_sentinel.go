@@ -0,0 +1,77 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/uber/kraken/utils/errutil"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// sentinelMaster returns the address of the master monitored under
+// config.MasterName, according to the first sentinel which knows it.
+func sentinelMaster(config RedisSentinelConfig, opts []redis.DialOption) (string, error) {
+	var errs []error
+	for _, addr := range config.Addrs {
+		master, err := querySentinel(addr, config.MasterName, opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sentinel %s: %s", addr, err))
+			continue
+		}
+		return master, nil
+	}
+	return "", fmt.Errorf("resolve master %s: %s", config.MasterName, errutil.Join(errs))
+}
+
+func querySentinel(addr, name string, opts []redis.DialOption) (string, error) {
+	c, err := redis.Dial("tcp", addr, opts...)
+	if err != nil {
+		return "", fmt.Errorf("dial: %s", err)
+	}
+	defer c.Close()
+
+	reply, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", name))
+	if err == redis.ErrNil {
+		return "", fmt.Errorf("unknown master")
+	} else if err != nil {
+		return "", fmt.Errorf("SENTINEL: %s", err)
+	}
+	if len(reply) != 2 {
+		return "", fmt.Errorf("SENTINEL: unexpected reply %v", reply)
+	}
+	return net.JoinHostPort(reply[0], reply[1]), nil
+}
+
+// checkMasterRole returns an error if c is not connected to a master, e.g.
+// because the master was demoted by a failover.
+func checkMasterRole(c redis.Conn) error {
+	reply, err := redis.Values(c.Do("ROLE"))
+	if err != nil {
+		return fmt.Errorf("ROLE: %s", err)
+	}
+	if len(reply) == 0 {
+		return fmt.Errorf("ROLE: empty reply")
+	}
+	role, err := redis.String(reply[0], nil)
+	if err != nil {
+		return fmt.Errorf("ROLE: %s", err)
+	}
+	if role != "master" {
+		return fmt.Errorf("connected to %s, not master", role)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+const _testMasterName = "kraken"
+
+// fakeSentinel answers SENTINEL get-master-addr-by-name for _testMasterName
+// with a fixed master address.
+type fakeSentinel struct {
+	l      net.Listener
+	master string
+}
+
+func startFakeSentinel(t *testing.T, master string) (addr string, stop func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSentinel{l, master}
+	go s.serve()
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func (s *fakeSentinel) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSentinel) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		var reply string
+		if len(args) == 3 &&
+			strings.EqualFold(args[0], "SENTINEL") &&
+			args[1] == "get-master-addr-by-name" &&
+			args[2] == _testMasterName {
+
+			host, port, _ := net.SplitHostPort(s.master)
+			reply = fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host), host, len(port), port)
+		} else {
+			// Sentinels reply with a null array for unknown masters.
+			reply = "*-1\r\n"
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func unreachableAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestRedisStoreSentinelDiscoversMaster(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	sentinel, stop := startFakeSentinel(t, config.Addr)
+	defer stop()
+
+	config.Sentinel = RedisSentinelConfig{
+		Addrs:      []string{unreachableAddr(t), sentinel},
+		MasterName: _testMasterName,
+	}
+	config.Addr = ""
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestRedisStoreSentinelUnknownMaster(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	sentinel, stop := startFakeSentinel(t, config.Addr)
+	defer stop()
+
+	config.Sentinel = RedisSentinelConfig{
+		Addrs:      []string{sentinel},
+		MasterName: "unknown",
+	}
+
+	_, err := NewRedisStore(config, clock.New())
+	require.Error(err)
+}
+
+func TestRedisStoreSentinelRequiresMasterName(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	config.Sentinel = RedisSentinelConfig{Addrs: []string{config.Addr}}
+
+	_, err := NewRedisStore(config, clock.New())
+	require.Error(err)
+}
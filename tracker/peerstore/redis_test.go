@@ -14,28 +14,18 @@
 package peerstore
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/uber/kraken/core"
 
-	"github.com/alicebob/miniredis"
 	"github.com/andres-erbsen/clock"
+	"github.com/garyburd/redigo/redis"
 	"github.com/stretchr/testify/require"
 )
 
-func redisConfigFixture() RedisConfig {
-	s, err := miniredis.Run()
-	if err != nil {
-		panic(err)
-	}
-	return RedisConfig{
-		Addr:              s.Addr(),
-		PeerSetWindowSize: 30 * time.Second,
-		MaxPeerSetWindows: 4,
-	}
-}
-
 func TestRedisStoreGetPeersPopulatesPeerInfoFields(t *testing.T) {
 	require := require.New(t)
 
@@ -56,6 +46,102 @@ func TestRedisStoreGetPeersPopulatesPeerInfoFields(t *testing.T) {
 	require.Equal(peers, []*core.PeerInfo{p})
 }
 
+func TestRedisStoreGetPeersPopulatesHostname(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+
+	p := core.PeerInfoFixture()
+	p.Hostname = "agent1.example.com"
+
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal(peers, []*core.PeerInfo{p})
+}
+
+func TestRedisStoreGetPeersPopulatesIPv6(t *testing.T) {
+	tests := []struct {
+		desc     string
+		ip       string
+		ipv6     string
+		hostname string
+	}{
+		{"dual-stack", "10.0.0.1", "2001:db8::1", ""},
+		{"dual-stack with hostname", "10.0.0.1", "2001:db8::1", "agent1.example.com"},
+		{"ipv6 only", "2001:db8::2", "", "agent2.example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			s, err := NewRedisStore(redisConfigFixture(), clock.New())
+			require.NoError(err)
+
+			h := core.InfoHashFixture()
+
+			p := core.PeerInfoFixture()
+			p.IP = test.ip
+			p.IPv6 = test.ipv6
+			p.Hostname = test.hostname
+
+			require.NoError(s.UpdatePeer(h, p))
+
+			peers, err := s.GetPeers(h, 1)
+			require.NoError(err)
+			require.Equal(peers, []*core.PeerInfo{p})
+		})
+	}
+}
+
+func TestRedisStoreGetPeersPopulatesNetworks(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewRedisStore(redisConfigFixture(), clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+
+	p := core.PeerInfoFixture()
+	p.Zone = "zone1"
+	p.Networks = map[string]string{
+		"storage": "10.1.0.1",
+		"service": "2001:db8::1",
+	}
+
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal(peers, []*core.PeerInfo{p})
+}
+
+func TestRedisStoreGetPeersPopulatesRackAndDC(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewRedisStore(redisConfigFixture(), clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+
+	// Rack and dc are encoded after networks, which are left empty.
+	p := core.PeerInfoFixture()
+	p.Rack = "rack1"
+	p.DC = "dc1"
+
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal(peers, []*core.PeerInfo{p})
+}
+
 func TestRedisStoreGetPeersFromMultipleWindows(t *testing.T) {
 	require := require.New(t)
 
@@ -179,3 +265,608 @@ func TestRedisStorePeerExpiration(t *testing.T) {
 	require.NoError(err)
 	require.Empty(result)
 }
+
+func TestRedisStoreExpiryIsJittered(t *testing.T) {
+	require := require.New(t)
+
+	s := &RedisStore{config: RedisConfig{
+		PeerSetWindowSize: 30 * time.Second,
+		MaxPeerSetWindows: 4,
+		TTLJitter:         time.Minute,
+	}}
+	for i := 0; i < 100; i++ {
+		e := s.expireAt(1000)
+		require.True(e >= 1120 && e < 1180, "expireAt %d", e)
+	}
+}
+
+func TestRedisStoreThroughput(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewRedisStore(redisConfigFixture(), clock.New())
+	require.NoError(err)
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+	r := ThroughputRecord{Uploaded: 1000, Rate: 10, Updated: time.Unix(1000, 0).UTC()}
+	require.NoError(s.SetThroughput(p1, r, time.Minute))
+
+	records, err := s.GetThroughput([]core.PeerID{p1, p2})
+	require.NoError(err)
+	require.Len(records, 1)
+	require.Equal(r, records[p1])
+}
+
+func TestRedisStoreAnnounceTokens(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewRedisStore(redisConfigFixture(), clock.New())
+	require.NoError(err)
+
+	ok, err := s.UseNonce("some nonce", time.Minute)
+	require.NoError(err)
+	require.True(ok)
+
+	ok, err = s.UseNonce("some nonce", time.Minute)
+	require.NoError(err)
+	require.False(ok)
+
+	h := core.InfoHashFixture()
+
+	ok, err = s.RestrictedTorrent(h)
+	require.NoError(err)
+	require.False(ok)
+
+	require.NoError(s.RestrictTorrent(h, time.Minute))
+
+	ok, err = s.RestrictedTorrent(h)
+	require.NoError(err)
+	require.True(ok)
+}
+
+func TestRedisStoreTracksLastSeen(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	config.TrackLastSeen = true
+
+	clk := clock.NewMock()
+	clk.Set(time.Now().Truncate(time.Second))
+
+	s, err := NewRedisStore(config, clk)
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+
+	t1 := clk.Now()
+	require.NoError(s.UpdatePeer(h, p1))
+	clk.Add(5 * time.Second)
+	t2 := clk.Now()
+	require.NoError(s.UpdatePeer(h, p2))
+
+	peers, err := s.GetPeers(h, 2)
+	require.NoError(err)
+	lastSeen := make(map[core.PeerID]time.Time)
+	for _, p := range peers {
+		lastSeen[p.PeerID] = p.LastSeen
+	}
+	require.True(t1.Equal(lastSeen[p1.PeerID]))
+	require.True(t2.Equal(lastSeen[p2.PeerID]))
+}
+
+func TestRedisStoreOmitsLastSeenUnlessTracked(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewRedisStore(redisConfigFixture(), clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Len(peers, 1)
+	require.True(peers[0].LastSeen.IsZero())
+}
+
+func TestRedisStoreGetSeedersAndLeechers(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+
+	var seeders, leechers []*core.PeerInfo
+	for i := 0; i < 5; i++ {
+		p := core.PeerInfoFixture()
+		p.Complete = true
+		seeders = append(seeders, p)
+		require.NoError(s.UpdatePeer(h, p))
+	}
+	for i := 0; i < 10; i++ {
+		p := core.PeerInfoFixture()
+		leechers = append(leechers, p)
+		require.NoError(s.UpdatePeer(h, p))
+	}
+
+	resultSeeders, resultLeechers, err := s.GetSeedersAndLeechers(h, 10, 3)
+	require.NoError(err)
+	require.ElementsMatch(seeders, resultSeeders)
+	require.Len(resultLeechers, 3)
+	for _, p := range resultLeechers {
+		require.False(p.Complete)
+	}
+
+	// A leecher which completes is only returned as a seeder.
+	leechers[0].Complete = true
+	require.NoError(s.UpdatePeer(h, leechers[0]))
+
+	resultSeeders, resultLeechers, err = s.GetSeedersAndLeechers(h, 10, 10)
+	require.NoError(err)
+	require.Len(resultSeeders, 6)
+	require.Len(resultLeechers, 9)
+}
+
+func TestRedisStoreScrape(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewRedisStore(redisConfigFixture(), clock.New())
+	require.NoError(err)
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h1, p))
+	require.NoError(s.UpdatePeer(h1, core.PeerInfoFixture()))
+	require.NoError(s.UpdatePeer(h1, core.OriginPeerInfoFixture()))
+
+	p.Complete = true
+	require.NoError(s.UpdatePeer(h1, p))
+	require.NoError(s.UpdatePeer(h1, p))
+
+	stats, err := s.Scrape([]core.InfoHash{h1, h2})
+	require.NoError(err)
+	require.Equal([]SwarmStats{
+		// Origins are never counted as completed.
+		{Seeders: 2, Leechers: 1, Completed: 1},
+		{},
+	}, stats)
+}
+
+func TestRedisStoreEstimatePeerCount(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	config.PeerSetWindowSize = 10 * time.Second
+	config.MaxPeerSetWindows = 3
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	s, err := NewRedisStore(config, clk)
+	require.NoError(err)
+
+	// Reset time to the beginning of a window.
+	clk.Set(time.Unix(s.curPeerSetWindow(), 0))
+
+	h := core.InfoHashFixture()
+
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+	require.NoError(s.UpdatePeer(h, seeder))
+	for i := 0; i < 3; i++ {
+		require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+	}
+
+	seeders, leechers, err := s.EstimatePeerCount(h)
+	require.NoError(err)
+	require.Equal(1, seeders)
+	require.Equal(3, leechers)
+
+	// Peers which announce again in the next window are not double counted.
+	clk.Add(config.PeerSetWindowSize)
+	require.NoError(s.UpdatePeer(h, seeder))
+
+	seeders, leechers, err = s.EstimatePeerCount(h)
+	require.NoError(err)
+	require.Equal(1, seeders)
+	require.Equal(3, leechers)
+
+	// Peers which stopped announcing eventually drop out of the estimate.
+	clk.Add(2 * config.PeerSetWindowSize)
+
+	seeders, leechers, err = s.EstimatePeerCount(h)
+	require.NoError(err)
+	require.Equal(0, seeders)
+	require.Equal(0, leechers)
+}
+
+func TestRedisStoreHottestInfoHashes(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	config.TrackAnnounceCounts = true
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	hot := core.InfoHashFixture()
+	warm := core.InfoHashFixture()
+	cold := core.InfoHashFixture()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(s.UpdatePeer(hot, core.PeerInfoFixture()))
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(s.UpdatePeer(warm, core.PeerInfoFixture()))
+	}
+	require.NoError(s.UpdatePeer(cold, core.PeerInfoFixture()))
+
+	hashes, err := s.HottestInfoHashes(2)
+	require.NoError(err)
+	require.Equal([]core.InfoHash{hot, warm}, hashes)
+}
+
+func TestRedisStoreHottestInfoHashesRequiresTracking(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewRedisStore(redisConfigFixture(), clock.New())
+	require.NoError(err)
+
+	_, err = s.HottestInfoHashes(10)
+	require.Error(err)
+}
+
+func TestRedisStorePeerIndexes(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	config.IndexPeers = true
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	p1 := core.PeerInfoFixture()
+	p1.Hostname = "agent1.example.com"
+	p1.Zone = "zone1"
+	p2 := core.PeerInfoFixture()
+	p2.Zone = "zone2"
+
+	require.NoError(s.UpdatePeer(h1, p1))
+	require.NoError(s.UpdatePeer(h2, p1))
+	require.NoError(s.UpdatePeer(h1, p2))
+
+	for _, host := range []string{p1.IP, p1.Hostname} {
+		hashes, err := s.GetInfoHashesByHost(host)
+		require.NoError(err)
+		require.ElementsMatch([]core.InfoHash{h1, h2}, hashes)
+	}
+	hashes, err := s.GetInfoHashesByHost(p2.IP)
+	require.NoError(err)
+	require.Equal([]core.InfoHash{h1}, hashes)
+
+	peers, err := s.GetPeersByZone(h1, "zone1")
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p1}, peers)
+
+	// Completed peers are reported as seeders only.
+	p1.Complete = true
+	require.NoError(s.UpdatePeer(h1, p1))
+
+	peers, err = s.GetPeersByZone(h1, "zone1")
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p1}, peers)
+}
+
+func TestRedisStoreDeleteTorrent(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	config.TrackAnnounceCounts = true
+	config.IndexPeers = true
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	p1 := core.PeerInfoFixture()
+	p1.Zone = "zone1"
+	p1.Complete = true
+	p2 := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h1, p1))
+	require.NoError(s.UpdatePeer(h1, p2))
+	require.NoError(s.UpdatePeer(h2, p1))
+
+	removed, err := s.DeleteTorrent(h1)
+	require.NoError(err)
+	require.Equal(2, removed)
+
+	peers, err := s.GetPeers(h1, 10)
+	require.NoError(err)
+	require.Empty(peers)
+
+	peers, err = s.GetPeersByZone(h1, "zone1")
+	require.NoError(err)
+	require.Empty(peers)
+
+	gen, err := s.GetPeerGeneration(h1, p1.PeerID)
+	require.NoError(err)
+	require.Equal(uint64(0), gen)
+
+	stats, err := s.Scrape([]core.InfoHash{h1})
+	require.NoError(err)
+	require.Equal([]SwarmStats{{}}, stats)
+
+	hashes, err := s.GetInfoHashesByHost(p1.IP)
+	require.NoError(err)
+	require.Equal([]core.InfoHash{h2}, hashes)
+
+	hot, err := s.HottestInfoHashes(10)
+	require.NoError(err)
+	require.Equal([]core.InfoHash{h2}, hot)
+}
+
+func TestRedisStorePeerIndexesRequireIndexing(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewRedisStore(redisConfigFixture(), clock.New())
+	require.NoError(err)
+
+	_, err = s.GetInfoHashesByHost("agent1.example.com")
+	require.Equal(ErrNoPeerIndex, err)
+
+	_, err = s.GetPeersByZone(core.InfoHashFixture(), "zone1")
+	require.Equal(ErrNoPeerIndex, err)
+}
+
+func TestRedisStoreUsageAndCompact(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	config.TrackAnnounceCounts = true
+	config.IndexPeers = true
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p))
+
+	c, err := redis.Dial("tcp", config.Addr)
+	require.NoError(err)
+	defer c.Close()
+
+	windows := s.peerSetWindows()
+	stale := windows[len(windows)-1] - int64(config.PeerSetWindowSize.Seconds())
+
+	// Legacy peer set.
+	_, err = c.Do("SADD", fmt.Sprintf("peerset:%s:%d", h, windows[0]), "legacy")
+	require.NoError(err)
+	// Window which is no longer read.
+	_, err = c.Do("SADD", peerSetKey(h, true, stale), "stale")
+	require.NoError(err)
+	_, err = c.Do("EXPIRE", peerSetKey(h, true, stale), 3600)
+	require.NoError(err)
+	// Missing TTL.
+	_, err = c.Do("SADD", hostIndexKey("agent1.example.com", windows[0]), h.String())
+	require.NoError(err)
+	// Not written by the store.
+	_, err = c.Do("SADD", "hostindex:unrelated", "x")
+	require.NoError(err)
+
+	usage, err := s.Usage()
+	require.NoError(err)
+	require.Equal(Usage{
+		"peersets":   {Keys: 3, Records: 3},
+		"announces":  {Keys: 1, Records: 1},
+		"hostindex":  {Keys: 3, Records: 3},
+		"zoneindex":  {Keys: 0, Records: 0},
+		"peergen":    {Keys: 1, Records: 1},
+		"completed":  {Keys: 0, Records: 0},
+		"throughput": {Keys: 0, Records: 0},
+		"lastseen":   {Keys: 0, Records: 0},
+		"tokennonce": {Keys: 0, Records: 0},
+		"restricted": {Keys: 0, Records: 0},
+	}, usage)
+
+	removed, err := s.Compact()
+	require.NoError(err)
+	require.Equal(3, removed)
+
+	usage, err = s.Usage()
+	require.NoError(err)
+	require.Equal(Usage{
+		"peersets":   {Keys: 1, Records: 1},
+		"announces":  {Keys: 1, Records: 1},
+		"hostindex":  {Keys: 2, Records: 2},
+		"zoneindex":  {Keys: 0, Records: 0},
+		"peergen":    {Keys: 1, Records: 1},
+		"completed":  {Keys: 0, Records: 0},
+		"throughput": {Keys: 0, Records: 0},
+		"lastseen":   {Keys: 0, Records: 0},
+		"tokennonce": {Keys: 0, Records: 0},
+		"restricted": {Keys: 0, Records: 0},
+	}, usage)
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestRedisStoreDeleteExpiredPeersKeepsOrphanedKeys(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p))
+
+	c, err := redis.Dial("tcp", config.Addr)
+	require.NoError(err)
+	defer c.Close()
+
+	windows := s.peerSetWindows()
+	stale := windows[len(windows)-1] - int64(config.PeerSetWindowSize.Seconds())
+
+	// Window which is no longer read.
+	_, err = c.Do("SADD", peerSetKey(h, true, stale), "stale")
+	require.NoError(err)
+	_, err = c.Do("EXPIRE", peerSetKey(h, true, stale), 3600)
+	require.NoError(err)
+	// Missing TTL, which only Compact removes.
+	_, err = c.Do("SADD", hostIndexKey("agent1.example.com", windows[0]), h.String())
+	require.NoError(err)
+
+	removed, err := s.DeleteExpiredPeers()
+	require.NoError(err)
+	require.Equal(1, removed)
+
+	n, err := redis.Int(c.Do("EXISTS", hostIndexKey("agent1.example.com", windows[0])))
+	require.NoError(err)
+	require.Equal(1, n)
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestRedisStoreCompareAndUpdatePeer(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	gen, err := s.GetPeerGeneration(h, p.PeerID)
+	require.NoError(err)
+	require.Equal(uint64(0), gen)
+
+	gen, err = s.CompareAndUpdatePeer(h, p, 0)
+	require.NoError(err)
+	require.Equal(uint64(1), gen)
+
+	// Unconditional writes also increment the generation.
+	require.NoError(s.UpdatePeer(h, p))
+
+	gen, err = s.GetPeerGeneration(h, p.PeerID)
+	require.NoError(err)
+	require.Equal(uint64(2), gen)
+
+	// A writer which last observed generation 1 is stale.
+	p.Complete = true
+	_, err = s.CompareAndUpdatePeer(h, p, 1)
+	require.Equal(ErrGenerationConflict, err)
+
+	_, leechers, err := s.GetSeedersAndLeechers(h, 10, 10)
+	require.NoError(err)
+	require.Len(leechers, 1)
+
+	gen, err = s.CompareAndUpdatePeer(h, p, 2)
+	require.NoError(err)
+	require.Equal(uint64(3), gen)
+
+	seeders, _, err := s.GetSeedersAndLeechers(h, 10, 10)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, seeders)
+}
+
+func TestRedisStoreCompareAndUpdatePeerIgnoresOtherPeers(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+
+	gens, err := s.UpdateVersionedPeers([]PeerUpdate{{h, p1}, {h, p2}})
+	require.NoError(err)
+	require.Equal([]uint64{1, 1}, gens)
+
+	gen, err := s.UpdateVersionedPeer(h, p2)
+	require.NoError(err)
+	require.Equal(uint64(2), gen)
+
+	// Writes of p2 do not conflict with writes of p1.
+	gen, err = s.CompareAndUpdatePeer(h, p1, 1)
+	require.NoError(err)
+	require.Equal(uint64(2), gen)
+
+	// Generations expire along with the peer.
+	c, err := redis.Dial("tcp", config.Addr)
+	require.NoError(err)
+	defer c.Close()
+
+	ttl, err := redis.Int(c.Do("TTL", generationKey(h, p1.PeerID)))
+	require.NoError(err)
+	require.True(ttl > 0)
+}
+
+func TestRedisStoreKeyPrefixIsolatesStores(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	config.KeyPrefix = "cluster1:"
+	s1, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	config.KeyPrefix = "cluster2:"
+	s2, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(s1.UpdatePeer(h, p))
+
+	peers, err := s1.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+
+	peers, err = s2.GetPeers(h, 1)
+	require.NoError(err)
+	require.Empty(peers)
+
+	c, err := redis.Dial("tcp", config.Addr)
+	require.NoError(err)
+	defer c.Close()
+
+	var keys []string
+	require.NoError(scan(c, "", func(k string) error {
+		keys = append(keys, k)
+		return nil
+	}))
+	require.NotEmpty(keys)
+	for _, k := range keys {
+		require.True(strings.HasPrefix(k, "cluster1:"), k)
+	}
+
+	usage, err := s2.Usage()
+	require.NoError(err)
+	require.Equal(0, usage["peersets"].Keys)
+}
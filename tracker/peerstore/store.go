@@ -14,9 +14,14 @@
 package peerstore
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/utils/log"
 )
@@ -29,20 +34,258 @@ type Store interface {
 	// GetPeers returns at most n random peers announcing for h.
 	GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 
+	// GetSeedersAndLeechers returns at most nSeeders random seeders and at
+	// most nLeechers random leechers announcing for h.
+	GetSeedersAndLeechers(
+		h core.InfoHash, nSeeders, nLeechers int) (seeders, leechers []*core.PeerInfo, err error)
+
+	// EstimatePeerCount returns the approximate number of seeders and leechers
+	// announcing for h, without reading individual peer records.
+	EstimatePeerCount(h core.InfoHash) (seeders, leechers int, err error)
+
 	// UpdatePeer updates peer fields.
 	UpdatePeer(h core.InfoHash, peer *core.PeerInfo) error
 }
 
+// HotInfoHashLister is implemented by Stores which count announces, and thus
+// can report which torrents are currently the most popular.
+type HotInfoHashLister interface {
+	// HottestInfoHashes returns at most n infohashes with the most recent
+	// announces, in descending order of announce count.
+	HottestInfoHashes(n int) ([]core.InfoHash, error)
+}
+
+// SwarmStats counts the peers of a single torrent.
+type SwarmStats struct {
+	Seeders  int
+	Leechers int
+
+	// Completed is the number of distinct non-origin peers which announced
+	// as complete. Stores may forget peers which completed long ago.
+	Completed int
+}
+
+// ErrNoScrape is returned by Scraper methods when the Store cannot count
+// peers of many torrents at once.
+var ErrNoScrape = errors.New("scrape not supported")
+
+// Scraper is implemented by Stores which can count the peers of many torrents
+// in a single round trip.
+type Scraper interface {
+	// Scrape returns the stats of each of hashes, in order. Torrents without
+	// peers have zero stats.
+	Scrape(hashes []core.InfoHash) ([]SwarmStats, error)
+}
+
+// PeerUpdate is a single peer write.
+type PeerUpdate struct {
+	InfoHash core.InfoHash
+	Peer     *core.PeerInfo
+}
+
+// BatchUpdater is implemented by Stores which can write many peers in a single
+// round trip.
+type BatchUpdater interface {
+	// UpdatePeers writes all updates. Writes are not atomic: if an error is
+	// returned, some updates may have been applied.
+	UpdatePeers(updates []PeerUpdate) error
+}
+
+// VersionedBatchUpdater is implemented by BatchUpdaters which version peer
+// records, and can return the new generation of every written peer.
+type VersionedBatchUpdater interface {
+	// UpdateVersionedPeers writes all updates, returning the new generation
+	// of each peer in the order of updates.
+	UpdateVersionedPeers(updates []PeerUpdate) ([]uint64, error)
+}
+
+// ErrNoPeerIndex is returned by PeerIndex methods when the Store does not
+// maintain secondary indexes.
+var ErrNoPeerIndex = errors.New("peer indexes not maintained")
+
+// PeerIndex is implemented by Stores which maintain secondary indexes of
+// peers, such that peers can be looked up by host or zone without scanning
+// every torrent.
+type PeerIndex interface {
+	// GetInfoHashesByHost returns all infohashes which host announced for
+	// recently. host is matched against both peer ips and hostnames.
+	GetInfoHashesByHost(host string) ([]core.InfoHash, error)
+
+	// GetPeersByZone returns all peers in zone which announced for h
+	// recently.
+	GetPeersByZone(h core.InfoHash, zone string) ([]*core.PeerInfo, error)
+}
+
+// ErrNoGenerations is returned by VersionedStore methods when the Store does
+// not version peer records.
+var ErrNoGenerations = errors.New("peer generations not maintained")
+
+// ErrGenerationConflict is returned by VersionedStore.CompareAndUpdatePeer when
+// the peer was written since the expected generation was observed, e.g. by
+// another tracker during storage failover.
+var ErrGenerationConflict = errors.New("peer generation conflict")
+
+// VersionedStore is implemented by Stores which version each peer record with
+// a generation number, incremented by every write, such that stale writers
+// can detect they are about to clobber newer peer state.
+type VersionedStore interface {
+	// GetPeerGeneration returns the generation of the record of peer id
+	// announcing for h, or 0 if the peer has no record.
+	GetPeerGeneration(h core.InfoHash, id core.PeerID) (uint64, error)
+
+	// UpdateVersionedPeer writes peer unconditionally, returning the new
+	// generation of its record.
+	UpdateVersionedPeer(h core.InfoHash, peer *core.PeerInfo) (uint64, error)
+
+	// CompareAndUpdatePeer writes peer only if the generation of its record
+	// is still gen, returning the new generation. Returns
+	// ErrGenerationConflict otherwise.
+	CompareAndUpdatePeer(h core.InfoHash, peer *core.PeerInfo, gen uint64) (uint64, error)
+}
+
+// ErrNoThroughput is returned by ThroughputStore methods when the Store does
+// not persist peer throughput.
+var ErrNoThroughput = errors.New("throughput not persisted")
+
+// ThroughputRecord is the smoothed upload throughput of a peer, derived from
+// the uploaded byte counts of its announces.
+type ThroughputRecord struct {
+	// Uploaded is the uploaded byte count of the last announce.
+	Uploaded int64 `json:"uploaded"`
+
+	// Rate is the smoothed throughput in bytes per second.
+	Rate float64 `json:"rate"`
+
+	// Updated is when the last announce was recorded.
+	Updated time.Time `json:"updated"`
+}
+
+// ThroughputStore is implemented by Stores which persist the throughput of
+// peers, such that throughput is shared by all trackers and survives tracker
+// restarts.
+type ThroughputStore interface {
+	// GetThroughput returns the records of those of ids which have one.
+	GetThroughput(ids []core.PeerID) (map[core.PeerID]ThroughputRecord, error)
+
+	// SetThroughput writes the record of id, which expires after ttl.
+	SetThroughput(id core.PeerID, r ThroughputRecord, ttl time.Duration) error
+}
+
+// KeyspaceUsage describes the records stored under a single keyspace.
+type KeyspaceUsage struct {
+	// Keys is the number of top-level keys, e.g. torrents or hosts.
+	Keys int `json:"keys"`
+
+	// Records is the number of records across all keys, e.g. peers.
+	Records int `json:"records"`
+}
+
+// Usage maps keyspace names to their usage.
+type Usage map[string]KeyspaceUsage
+
+// ErrNoCompaction is returned by Compactor methods when the Store does not
+// support compaction.
+var ErrNoCompaction = errors.New("compaction not supported")
+
+// Compactor is implemented by Stores which can report their storage usage and
+// remove expired or orphaned records on demand, instead of waiting for them to
+// be cleaned up in the background.
+type Compactor interface {
+	// Usage returns the current storage usage of each keyspace.
+	Usage() (Usage, error)
+
+	// Compact removes expired and orphaned records, returning the number of
+	// keys removed.
+	Compact() (removed int, err error)
+}
+
+// ErrNoExpiredPeerDeletion is returned by ExpiredPeerDeleter methods when the
+// Store cannot remove expired peers on demand.
+var ErrNoExpiredPeerDeletion = errors.New("expired peer deletion not supported")
+
+// ExpiredPeerDeleter is implemented by Stores which can remove expired peers
+// on demand, instead of waiting for them to be cleaned up in the background.
+type ExpiredPeerDeleter interface {
+	// DeleteExpiredPeers removes peers which have not announced within the TTL
+	// of the Store, along with any torrents and hosts left without peers,
+	// returning the number of keys removed.
+	DeleteExpiredPeers() (removed int, err error)
+}
+
+// ErrNoDeletion is returned by TorrentDeleter methods when the Store cannot
+// remove torrents on demand.
+var ErrNoDeletion = errors.New("torrent deletion not supported")
+
+// TorrentDeleter is implemented by Stores which can remove every peer of a
+// torrent on demand, e.g. when operators purge a bad image, instead of waiting
+// for the peers to expire.
+type TorrentDeleter interface {
+	// DeleteTorrent removes all peers of h, along with any records indexing
+	// them, returning the number of distinct peers removed. Peers which
+	// announce for h again are stored as usual.
+	DeleteTorrent(h core.InfoHash) (removed int, err error)
+}
+
+// peerHosts returns the hosts p is indexed under.
+func peerHosts(p *core.PeerInfo) []string {
+	var hosts []string
+	if p.IP != "" {
+		hosts = append(hosts, p.IP)
+	}
+	if p.IPv6 != "" {
+		hosts = append(hosts, p.IPv6)
+	}
+	if p.Hostname != "" && p.Hostname != p.IP {
+		hosts = append(hosts, p.Hostname)
+	}
+	for _, label := range sortedNetworks(p) {
+		hosts = append(hosts, p.Networks[label])
+	}
+	return hosts
+}
+
+// sortedNetworks returns the network labels of p in sorted order.
+func sortedNetworks(p *core.PeerInfo) []string {
+	labels := make([]string, 0, len(p.Networks))
+	for label := range p.Networks {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
 // New creates a new Store implementation based on config.
-func New(config Config) (Store, error) {
-	if config.Redis.Enabled {
+func New(config Config, stats tally.Scope) (Store, error) {
+	var s Store
+	if config.Driver != "" {
+		log.Infof("Peer store driver %s enabled", config.Driver)
+		driver, err := getDriver(config.Driver)
+		if err != nil {
+			return nil, err
+		}
+		ds, err := driver.Create(config.DriverConfig, stats)
+		if err != nil {
+			return nil, fmt.Errorf("new %s store: %s", config.Driver, err)
+		}
+		s = ds
+	} else if config.Redis.Enabled {
 		log.Info("Redis peer store enabled")
-		s, err := NewRedisStore(config.Redis, clock.New())
+		rs, err := NewRedisStore(config.Redis, clock.New())
 		if err != nil {
 			return nil, fmt.Errorf("new redis store: %s", err)
 		}
-		return s, nil
+		s = rs
+		if config.Batch.Enabled {
+			log.Info("Peer store group commit enabled")
+			s = NewGroupCommitStore(config.Batch, stats, rs, clock.New())
+		}
+	} else {
+		log.Info("Defaulting to local peer store")
+		s = NewLocalStore(config.Local, clock.New())
+	}
+	if config.Partition.Enabled {
+		log.Info("Peer store partition tolerance enabled")
+		s = NewPartitionTolerantStore(config.Partition, stats, s, clock.New())
 	}
-	log.Info("Defaulting to local peer store")
-	return NewLocalStore(config.Local, clock.New()), nil
+	return s, nil
 }
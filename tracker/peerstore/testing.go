@@ -68,3 +68,118 @@ func (s *testStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
 	}
 	return copies, nil
 }
+
+func (s *testStore) EstimatePeerCount(h core.InfoHash) (seeders, leechers int, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, p := range s.torrents[h] {
+		if p.Complete {
+			seeders++
+		} else {
+			leechers++
+		}
+	}
+	return seeders, leechers, nil
+}
+
+func (s *testStore) GetSeedersAndLeechers(
+	h core.InfoHash, nSeeders, nLeechers int) (seeders, leechers []*core.PeerInfo, err error) {
+
+	peers, err := s.GetPeers(h, nSeeders+nLeechers)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, p := range peers {
+		if p.Complete && len(seeders) < nSeeders {
+			seeders = append(seeders, p)
+		} else if !p.Complete && len(leechers) < nLeechers {
+			leechers = append(leechers, p)
+		}
+	}
+	return seeders, leechers, nil
+}
+
+func (s *testStore) DeleteTorrent(h core.InfoHash) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	n := len(s.torrents[h])
+	delete(s.torrents, h)
+	return n, nil
+}
+
+// ErrTestPartition is returned by PartitionTestStore while partitioned.
+var ErrTestPartition = errors.New("test store partitioned")
+
+// PartitionTestStore is a test store which can simulate the backing storage
+// becoming unavailable, for testing failover semantics.
+type PartitionTestStore struct {
+	Store
+
+	mu          sync.Mutex
+	partitioned bool
+}
+
+// NewPartitionTestStore returns a new PartitionTestStore backed by an in-memory
+// test store.
+func NewPartitionTestStore() *PartitionTestStore {
+	return &PartitionTestStore{Store: NewTestStore()}
+}
+
+// SetPartitioned toggles whether all operations fail with ErrTestPartition.
+func (s *PartitionTestStore) SetPartitioned(partitioned bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.partitioned = partitioned
+}
+
+func (s *PartitionTestStore) isPartitioned() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.partitioned
+}
+
+// UpdatePeer implements Store.
+func (s *PartitionTestStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
+	if s.isPartitioned() {
+		return ErrTestPartition
+	}
+	return s.Store.UpdatePeer(h, p)
+}
+
+// GetPeers implements Store.
+func (s *PartitionTestStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
+	if s.isPartitioned() {
+		return nil, ErrTestPartition
+	}
+	return s.Store.GetPeers(h, n)
+}
+
+// GetSeedersAndLeechers implements Store.
+func (s *PartitionTestStore) GetSeedersAndLeechers(
+	h core.InfoHash, nSeeders, nLeechers int) (seeders, leechers []*core.PeerInfo, err error) {
+
+	if s.isPartitioned() {
+		return nil, nil, ErrTestPartition
+	}
+	return s.Store.GetSeedersAndLeechers(h, nSeeders, nLeechers)
+}
+
+// EstimatePeerCount implements Store.
+func (s *PartitionTestStore) EstimatePeerCount(h core.InfoHash) (seeders, leechers int, err error) {
+	if s.isPartitioned() {
+		return 0, 0, ErrTestPartition
+	}
+	return s.Store.EstimatePeerCount(h)
+}
+
+// DeleteTorrent implements TorrentDeleter.
+func (s *PartitionTestStore) DeleteTorrent(h core.InfoHash) (int, error) {
+	if s.isPartitioned() {
+		return 0, ErrTestPartition
+	}
+	return s.Store.(TorrentDeleter).DeleteTorrent(h)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package topology
+
+import "time"
+
+// Config defines how host locations are loaded. Static hosts are overlaid by
+// hosts loaded from File, then by hosts loaded from URL, such that a static
+// entry can fill in hosts missing from the inventory.
+type Config struct {
+	// Hosts statically maps hostnames (or ips) to locations.
+	Hosts map[string]Location `yaml:"hosts"`
+
+	// File is the path of a YAML file mapping hosts to locations.
+	File string `yaml:"file"`
+
+	// URL serves a JSON object mapping hosts to locations, e.g. a CMDB or
+	// cloud inventory export.
+	URL string `yaml:"url"`
+
+	// RefreshInterval is how often File and URL are reloaded. Zero disables
+	// reloading.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	// Timeout bounds requests to URL.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+// Empty returns true if no host sources are configured.
+func (c Config) Empty() bool {
+	return len(c.Hosts) == 0 && c.File == "" && c.URL == ""
+}
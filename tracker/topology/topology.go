@@ -0,0 +1,198 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"gopkg.in/yaml.v2"
+)
+
+// Location describes where a host runs within the cluster.
+type Location struct {
+	Rack string `yaml:"rack" json:"rack,omitempty"`
+	DC   string `yaml:"dc" json:"dc,omitempty"`
+	Zone string `yaml:"zone" json:"zone,omitempty"`
+
+	// BandwidthClass labels the network capacity of the host, e.g. "10g".
+	BandwidthClass string `yaml:"bandwidth_class" json:"bandwidth_class,omitempty"`
+}
+
+// Map caches host locations loaded from the configured sources.
+type Map struct {
+	config Config
+	clk    clock.Clock
+
+	mu       sync.RWMutex
+	hosts    map[string]Location
+	loadedAt time.Time
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// New creates a new Map, loading all configured sources. If RefreshInterval
+// is set, sources are reloaded in the background until Close is called.
+func New(config Config, clk clock.Clock) (*Map, error) {
+	config = config.applyDefaults()
+	m := &Map{
+		config: config,
+		clk:    clk,
+		stop:   make(chan struct{}),
+	}
+	if err := m.Refresh(); err != nil {
+		return nil, err
+	}
+	if config.RefreshInterval > 0 && (config.File != "" || config.URL != "") {
+		go m.refreshTask()
+	}
+	return m, nil
+}
+
+// Close stops background refreshes.
+func (m *Map) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// Refresh reloads host locations from all sources. On error, the previously
+// loaded locations are kept.
+func (m *Map) Refresh() error {
+	hosts := make(map[string]Location)
+	for h, l := range m.config.Hosts {
+		hosts[h] = l
+	}
+	if m.config.File != "" {
+		b, err := ioutil.ReadFile(m.config.File)
+		if err != nil {
+			return fmt.Errorf("read file: %s", err)
+		}
+		var fileHosts map[string]Location
+		if err := yaml.Unmarshal(b, &fileHosts); err != nil {
+			return fmt.Errorf("unmarshal file: %s", err)
+		}
+		for h, l := range fileHosts {
+			hosts[h] = l
+		}
+	}
+	if m.config.URL != "" {
+		resp, err := httputil.Get(m.config.URL, httputil.SendTimeout(m.config.Timeout))
+		if err != nil {
+			return fmt.Errorf("get url: %s", err)
+		}
+		defer resp.Body.Close()
+		var urlHosts map[string]Location
+		if err := json.NewDecoder(resp.Body).Decode(&urlHosts); err != nil {
+			return fmt.Errorf("decode url response: %s", err)
+		}
+		for h, l := range urlHosts {
+			hosts[h] = l
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hosts = hosts
+	m.loadedAt = m.clk.Now()
+	return nil
+}
+
+func (m *Map) refreshTask() {
+	ticker := m.clk.Ticker(m.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Refresh(); err != nil {
+				log.Errorf("Error refreshing topology, keeping stale locations: %s", err)
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Lookup returns the location of host.
+func (m *Map) Lookup(host string) (Location, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	l, ok := m.hosts[host]
+	return l, ok
+}
+
+// Hosts returns a copy of all known host locations, along with when they
+// were loaded.
+func (m *Map) Hosts() (map[string]Location, time.Time) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hosts := make(map[string]Location, len(m.hosts))
+	for h, l := range m.hosts {
+		hosts[h] = l
+	}
+	return hosts, m.loadedAt
+}
+
+// Locate returns the location of p, looked up by hostname and then by ip.
+// Falls back to the rack, zone and datacenter p announced for any the
+// topology does not know. Safe to call on a nil Map, in which case only the
+// announced location is used.
+func (m *Map) Locate(p *core.PeerInfo) Location {
+	var l Location
+	if m != nil {
+		var ok bool
+		if p.Hostname != "" {
+			l, ok = m.Lookup(p.Hostname)
+		}
+		if !ok && p.IP != "" {
+			l, _ = m.Lookup(p.IP)
+		}
+	}
+	if l.Rack == "" {
+		l.Rack = p.Rack
+	}
+	if l.Zone == "" {
+		l.Zone = p.Zone
+	}
+	if l.DC == "" {
+		l.DC = p.DC
+	}
+	return l
+}
+
+// FailureDomain returns the rack of the host of addr, qualified by its
+// datacenter, or "" if the rack of the host is unknown. addr may carry a port.
+func (m *Map) FailureDomain(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	l, ok := m.Lookup(host)
+	if !ok || l.Rack == "" {
+		return ""
+	}
+	return l.DC + "/" + l.Rack
+}
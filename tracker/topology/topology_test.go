@@ -0,0 +1,152 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package topology
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapOverlaysSources(t *testing.T) {
+	require := require.New(t)
+
+	file, cleanup := testutil.TempFile([]byte(`
+host-a:
+  rack: r1
+  dc: dc1
+host-b:
+  rack: r2
+  dc: dc1
+`))
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"host-b": {"rack": "r3", "dc": "dc2", "bandwidth_class": "10g"}}`)
+	}))
+	defer stop()
+
+	m, err := New(Config{
+		Hosts: map[string]Location{
+			"host-a": {Rack: "r0"},
+			"host-c": {DC: "dc3"},
+		},
+		File: file,
+		URL:  "http://" + addr,
+	}, clock.New())
+	require.NoError(err)
+	defer m.Close()
+
+	hosts, _ := m.Hosts()
+	require.Equal(map[string]Location{
+		"host-a": {Rack: "r1", DC: "dc1"},
+		"host-b": {Rack: "r3", DC: "dc2", BandwidthClass: "10g"},
+		"host-c": {DC: "dc3"},
+	}, hosts)
+}
+
+func TestMapRefreshKeepsStaleLocationsOnError(t *testing.T) {
+	require := require.New(t)
+
+	file, cleanup := testutil.TempFile([]byte(`host-a: {rack: r1}`))
+	defer cleanup()
+
+	m, err := New(Config{File: file}, clock.New())
+	require.NoError(err)
+	defer m.Close()
+
+	require.NoError(os.Remove(file))
+	require.Error(m.Refresh())
+
+	l, ok := m.Lookup("host-a")
+	require.True(ok)
+	require.Equal("r1", l.Rack)
+}
+
+func TestMapLocate(t *testing.T) {
+	m, err := New(Config{
+		Hosts: map[string]Location{
+			"host-a":   {Rack: "r1", DC: "dc1", Zone: "z1"},
+			"10.0.0.2": {Rack: "r2", DC: "dc1"},
+		},
+	}, clock.New())
+	require.NoError(t, err)
+	defer m.Close()
+
+	peer := func(hostname, ip, zone string) *core.PeerInfo {
+		p := core.PeerInfoFixture()
+		p.Hostname = hostname
+		p.IP = ip
+		p.Zone = zone
+		return p
+	}
+	announced := func(p *core.PeerInfo, rack, dc string) *core.PeerInfo {
+		p.Rack = rack
+		p.DC = dc
+		return p
+	}
+
+	tests := []struct {
+		desc     string
+		m        *Map
+		peer     *core.PeerInfo
+		expected Location
+	}{
+		{"by hostname", m, peer("host-a", "10.0.0.1", "z9"), Location{Rack: "r1", DC: "dc1", Zone: "z1"}},
+		{"by ip", m, peer("", "10.0.0.2", "z2"), Location{Rack: "r2", DC: "dc1", Zone: "z2"}},
+		{"unknown", m, peer("host-x", "10.0.0.3", "z3"), Location{Zone: "z3"}},
+		{"nil map", nil, peer("host-a", "10.0.0.1", "z4"), Location{Zone: "z4"}},
+		{
+			"announced rack and dc",
+			m,
+			announced(peer("host-x", "10.0.0.3", "z3"), "r5", "dc5"),
+			Location{Rack: "r5", DC: "dc5", Zone: "z3"},
+		}, {
+			"topology overrides announced rack and dc",
+			m,
+			announced(peer("", "10.0.0.2", "z2"), "r5", "dc5"),
+			Location{Rack: "r2", DC: "dc1", Zone: "z2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require.Equal(t, test.expected, test.m.Locate(test.peer))
+		})
+	}
+}
+
+func TestMapFailureDomain(t *testing.T) {
+	require := require.New(t)
+
+	m, err := New(Config{
+		Hosts: map[string]Location{
+			"host-a": {Rack: "r1", DC: "dc1"},
+			"host-b": {DC: "dc1"},
+		},
+	}, clock.New())
+	require.NoError(err)
+	defer m.Close()
+
+	require.Equal("dc1/r1", m.FailureDomain("host-a:15002"))
+	require.Equal("dc1/r1", m.FailureDomain("host-a"))
+	require.Equal("", m.FailureDomain("host-b:15002"))
+	require.Equal("", m.FailureDomain("host-c:15002"))
+}
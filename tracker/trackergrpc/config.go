@@ -0,0 +1,39 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackergrpc
+
+import "time"
+
+// Config defines gRPC tracker configuration.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Addr is the address the tracker listens on for gRPC requests.
+	Addr string `yaml:"addr"`
+
+	// Insecure serves plaintext gRPC instead of requiring mutual TLS. Only
+	// intended for development clusters.
+	Insecure bool `yaml:"insecure"`
+
+	// MaxRequestTimeout bounds how long a single request is served, regardless
+	// of the deadline set by the client.
+	MaxRequestTimeout time.Duration `yaml:"max_request_timeout"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.MaxRequestTimeout == 0 {
+		c.MaxRequestTimeout = 30 * time.Second
+	}
+	return c
+}
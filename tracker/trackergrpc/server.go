@@ -0,0 +1,137 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackergrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"path"
+
+	trackerpb "github.com/uber/kraken/gen/go/proto/tracker"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// Authorizer is implemented by services which authorize each request before it
+// is answered.
+type Authorizer interface {
+	// Authorize returns an error unless the request of ctx may call method,
+	// the full gRPC method name. On success, returns ctx with the identity of
+	// the caller attached, if any.
+	Authorize(ctx context.Context, method string) (context.Context, error)
+}
+
+// Server serves tracker metadata operations over gRPC.
+type Server struct {
+	config Config
+	stats  tally.Scope
+	grpc   *grpc.Server
+	auth   Authorizer // Nil if service does not authorize requests.
+}
+
+// New creates a new Server which answers requests with service. Clients must
+// authenticate with certificates trusted by tls, unless config is insecure. If
+// service implements Authorizer, requests are authorized before reaching it.
+func New(
+	config Config,
+	stats tally.Scope,
+	service trackerpb.TrackerServer,
+	tls *tls.Config) (*Server, error) {
+
+	config = config.applyDefaults()
+
+	stats = stats.Tagged(map[string]string{
+		"module": "trackergrpc",
+	})
+
+	s := &Server{config: config, stats: stats}
+	if a, ok := service.(Authorizer); ok {
+		s.auth = a
+	}
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(s.intercept)}
+	if !config.Insecure {
+		if tls == nil {
+			return nil, errors.New("server tls required unless insecure")
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tls)))
+	}
+	s.grpc = grpc.NewServer(opts...)
+	trackerpb.RegisterTrackerServer(s.grpc, service)
+	return s, nil
+}
+
+// ListenAndServe is a blocking call which runs s.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	log.Infof("Starting grpc tracker server on %s", l.Addr())
+	return s.grpc.Serve(l)
+}
+
+// Serve serves requests received on l until Stop is called.
+func (s *Server) Serve(l net.Listener) error {
+	return s.grpc.Serve(l)
+}
+
+// Stop waits for pending requests to finish, and stops s.
+func (s *Server) Stop() {
+	s.grpc.GracefulStop()
+}
+
+// intercept bounds the deadline of each request, authorizes it, and emits per
+// method latencies and status codes.
+func (s *Server) intercept(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	h grpc.UnaryHandler) (interface{}, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.MaxRequestTimeout)
+	defer cancel()
+
+	stats := s.stats.Tagged(map[string]string{
+		"method": path.Base(info.FullMethod),
+	})
+	timer := stats.Timer("latency").Start()
+	resp, err := s.handle(ctx, req, info, h)
+	timer.Stop()
+	stats.Tagged(map[string]string{
+		"code": status.Code(err).String(),
+	}).Counter("requests").Inc(1)
+	return resp, err
+}
+
+func (s *Server) handle(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	h grpc.UnaryHandler) (interface{}, error) {
+
+	if s.auth != nil {
+		var err error
+		ctx, err = s.auth.Authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h(ctx, req)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+)
+
+// requesterFamilies returns the address families the peer announcing req can
+// connect over: those it advertises, or else the family of the connection the
+// announce was received on. Returns nil if unknown, in which case all families
+// are considered usable.
+func requesterFamilies(r *http.Request, req *announceclient.Request) []string {
+	if len(req.AddressFamilies) > 0 {
+		return req.AddressFamilies
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() {
+		// Loopback connections come from a local proxy, e.g. nginx, and say
+		// nothing about the peer.
+		return nil
+	}
+	return []string{core.AddressFamily(host)}
+}
+
+// parseFamilies parses a comma separated list of address families. Returns nil
+// if s is empty.
+func parseFamilies(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// familyUsable returns whether f is among the usable families, where nil means
+// all families are usable.
+func familyUsable(usable []string, f string) bool {
+	if usable == nil {
+		return true
+	}
+	for _, u := range usable {
+		if u == f {
+			return true
+		}
+	}
+	return false
+}
+
+// selectAddresses returns copies of peers whose IP is set to their most
+// preferred address in the usable families of the requester, which speaks the
+// given protocol version. Peers without a usable address are dropped, unless
+// they are handed out by hostname. Peers without any valid IP keep their IP.
+// Handed out peers never carry IPv6 or Networks.
+func (s *Server) selectAddresses(
+	peers []*core.PeerInfo,
+	labels []string,
+	usable []string,
+	protocol int) ([]*core.PeerInfo, []string, int) {
+
+	byHostname := s.config.HandoutAddressing != AddressByIP &&
+		protocol >= announceclient.Protocol2
+
+	resultPeers := make([]*core.PeerInfo, 0, len(peers))
+	resultLabels := make([]string, 0, len(labels))
+	var dropped int
+	for i, p := range peers {
+		ips := p.IPs()
+		c := *p
+		c.IPv6 = ""
+		c.Networks = nil
+		if len(ips) > 0 {
+			c.IP = ""
+			for _, f := range s.config.AddressFamilies {
+				if ip, ok := ips[f]; ok && familyUsable(usable, f) {
+					c.IP = ip
+					break
+				}
+			}
+			if c.IP == "" && !(byHostname && c.Hostname != "") {
+				dropped++
+				continue
+			}
+		}
+		resultPeers = append(resultPeers, &c)
+		resultLabels = append(resultLabels, labels[i])
+	}
+	return resultPeers, resultLabels, dropped
+}
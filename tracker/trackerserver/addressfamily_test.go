@@ -0,0 +1,219 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnounceSelectsAddressFamilies(t *testing.T) {
+	dual := core.PeerInfoFixture()
+	dual.IP = "10.0.0.1"
+	dual.IPv6 = "2001:db8::1"
+	v4 := core.PeerInfoFixture()
+	v4.IP = "10.0.0.2"
+	v6 := core.PeerInfoFixture()
+	v6.IP = "2001:db8::3"
+
+	withIP := func(p *core.PeerInfo, ip string) *core.PeerInfo {
+		c := *p
+		c.IP = ip
+		c.IPv6 = ""
+		return &c
+	}
+
+	tests := []struct {
+		desc          string
+		preference    []string
+		requesterIPv6 string
+		expected      []*core.PeerInfo
+	}{
+		{
+			"ipv4 requester",
+			nil,
+			"",
+			[]*core.PeerInfo{withIP(dual, dual.IP), v4},
+		}, {
+			"dual-stack requester prefers ipv4 by default",
+			nil,
+			"2001:db8::ff",
+			[]*core.PeerInfo{withIP(dual, dual.IP), v4, v6},
+		}, {
+			"dual-stack requester with ipv6 preference",
+			[]string{core.IPv6, core.IPv4},
+			"2001:db8::ff",
+			[]*core.PeerInfo{withIP(dual, dual.IPv6), v4, v6},
+		}, {
+			"ipv4 disabled",
+			[]string{core.IPv6},
+			"2001:db8::ff",
+			[]*core.PeerInfo{withIP(dual, dual.IPv6), v6},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, Config{AddressFamilies: test.preference})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			h := blob.MetaInfo.InfoHash()
+			pctx := core.PeerContextFixture()
+			pctx.IPv6 = test.requesterIPv6
+
+			mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil)
+			mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(
+				[]*core.PeerInfo{dual, v4, v6}, nil)
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+			result, _, err := newAnnounceClient(pctx, addr).Announce(
+				core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+			require.NoError(err)
+			require.Equal(test.expected, result)
+		})
+	}
+}
+
+func TestAnnounceKeepsUnreachablePeersAddressedByHostname(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{HandoutAddressing: AddressByHostname})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	named := core.PeerInfoFixture()
+	named.IP = "2001:db8::1"
+	named.Hostname = "agent1.example.com"
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	pctx := core.PeerContextFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{named}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	result, _, err := newAnnounceClient(pctx, addr).Announce(
+		core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+	require.Len(result, 1)
+	require.Equal("", result[0].IP)
+	require.Equal(named.Hostname, result[0].Hostname)
+}
+
+func TestRequesterFamilies(t *testing.T) {
+	tests := []struct {
+		desc       string
+		remoteAddr string
+		advertised []string
+		expected   []string
+	}{
+		{"advertised", "10.0.0.1:1234", []string{core.IPv6}, []string{core.IPv6}},
+		{"ipv4 source", "10.0.0.1:1234", nil, []string{core.IPv4}},
+		{"ipv6 source", "[2001:db8::1]:1234", nil, []string{core.IPv6}},
+		{"loopback source", "127.0.0.1:1234", nil, nil},
+		{"unix socket", "@", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: test.remoteAddr}
+			req := &announceclient.Request{AddressFamilies: test.advertised}
+			require.Equal(t, test.expected, requesterFamilies(r, req))
+		})
+	}
+}
+
+func TestAnnouncePrefersNetworks(t *testing.T) {
+	multi := core.PeerInfoFixture()
+	multi.IP = "10.0.0.1"
+	multi.Networks = map[string]string{"storage": "10.1.0.1", "backup": "2001:db8::1"}
+	single := core.PeerInfoFixture()
+	single.IP = "10.0.0.2"
+
+	withIP := func(p *core.PeerInfo, ip string) *core.PeerInfo {
+		c := *p
+		c.IP = ip
+		c.Networks = nil
+		return &c
+	}
+
+	tests := []struct {
+		desc       string
+		preference []string
+		requester  map[string]string
+		expected   []*core.PeerInfo
+	}{
+		{
+			"no preference",
+			nil,
+			map[string]string{"storage": "10.1.0.9"},
+			[]*core.PeerInfo{withIP(multi, multi.IP), single},
+		}, {
+			"requester on preferred network",
+			[]string{"storage"},
+			map[string]string{"storage": "10.1.0.9"},
+			[]*core.PeerInfo{withIP(multi, "10.1.0.1"), single},
+		}, {
+			"requester off preferred network",
+			[]string{"storage"},
+			map[string]string{"backup": "2001:db8::9"},
+			[]*core.PeerInfo{withIP(multi, multi.IP), single},
+		}, {
+			"network of unusable family",
+			[]string{"backup", "storage"},
+			map[string]string{"backup": "2001:db8::9"},
+			[]*core.PeerInfo{withIP(multi, multi.IP), single},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, Config{PreferredNetworks: test.preference})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			h := blob.MetaInfo.InfoHash()
+			pctx := core.PeerContextFixture()
+			pctx.Networks = test.requester
+
+			mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil)
+			mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(
+				[]*core.PeerInfo{multi, single}, nil)
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+			result, _, err := newAnnounceClient(pctx, addr).Announce(
+				core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+			require.NoError(err)
+			require.Equal(test.expected, result)
+		})
+	}
+}
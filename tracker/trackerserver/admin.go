@@ -0,0 +1,73 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/uber/kraken/lib/auth"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// AdminTokenHeader carries an admin token, which authorizes destructive
+// operations such as purging torrents.
+const AdminTokenHeader = "Kraken-Admin-Token"
+
+// AdminConfig defines who may perform destructive operations. Such operations
+// are rejected unless tokens are configured.
+type AdminConfig struct {
+	// Tokens maps the names of admin token holders to their tokens. Every use
+	// of a token is audit logged with the holder name.
+	Tokens map[string]string `yaml:"tokens"`
+}
+
+// holder returns the holder of admin token.
+func (c AdminConfig) holder(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	for holder, t := range c.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return holder, true
+		}
+	}
+	return "", false
+}
+
+// checkAdmin returns the holder of the admin token presented by r. Requests
+// authorized by a bearer token granting ScopeAdmin need no admin token, and
+// are held by the subject of their bearer token. Returns 403 if admin
+// operations are disabled, and 401 if the token is missing or unknown.
+func (s *Server) checkAdmin(r *http.Request) (string, error) {
+	if claims := auth.FromContext(r.Context()); claims != nil && claims.HasScope(ScopeAdmin) {
+		return claims.Subject, nil
+	}
+	if len(s.config.Admin.Tokens) == 0 {
+		return "", handler.Errorf("admin operations disabled").Status(http.StatusForbidden)
+	}
+	holder, ok := s.config.Admin.holder(r.Header.Get(AdminTokenHeader))
+	if !ok {
+		s.stats.Counter("unauthorized_admin_requests").Inc(1)
+		log.With(
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote_addr", r.RemoteAddr).Warn("Rejected unauthorized admin request")
+		return "", handler.Errorf(
+			"admin operations require a %s header", AdminTokenHeader).
+			Status(http.StatusUnauthorized)
+	}
+	return holder, nil
+}
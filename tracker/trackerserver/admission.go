@@ -0,0 +1,195 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// requestClass determines how requests are admitted under overload.
+type requestClass string
+
+const (
+	// classCritical requests are cheap and on the download path, e.g.
+	// announces. They may use all capacity, and queue for up to MaxWait when
+	// none is available.
+	classCritical requestClass = "critical"
+
+	// classCatalog requests are expensive inspection queries, e.g. fleet
+	// overviews and index lookups. They are capped below the total capacity,
+	// and rejected immediately when their pool is exhausted.
+	classCatalog requestClass = "catalog"
+)
+
+// AdmissionConfig defines concurrency limits which keep capacity reserved for
+// critical requests.
+type AdmissionConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxConcurrent limits the number of requests served concurrently.
+	MaxConcurrent int `yaml:"max_concurrent"`
+
+	// MaxCatalogConcurrent limits the number of catalog requests served
+	// concurrently. The remaining MaxConcurrent - MaxCatalogConcurrent slots
+	// are reserved for critical requests.
+	MaxCatalogConcurrent int `yaml:"max_catalog_concurrent"`
+
+	// EndpointLimits further limits the concurrency of individual endpoints,
+	// keyed by route pattern, e.g. "/agents".
+	EndpointLimits map[string]int `yaml:"endpoint_limits"`
+
+	// MaxWait is how long critical requests wait for capacity before being
+	// rejected.
+	MaxWait time.Duration `yaml:"max_wait"`
+}
+
+func (c AdmissionConfig) applyDefaults() AdmissionConfig {
+	if c.MaxConcurrent == 0 {
+		c.MaxConcurrent = 2000
+	}
+	if c.MaxCatalogConcurrent == 0 {
+		c.MaxCatalogConcurrent = 50
+	}
+	if c.MaxCatalogConcurrent >= c.MaxConcurrent {
+		log.Warnf(
+			"Catalog concurrency %d leaves no reserved capacity, limiting to %d",
+			c.MaxCatalogConcurrent, c.MaxConcurrent/2)
+		c.MaxCatalogConcurrent = c.MaxConcurrent / 2
+	}
+	if c.MaxWait == 0 {
+		c.MaxWait = time.Second
+	}
+	return c
+}
+
+// admissionController admits requests into bounded concurrency pools. Every
+// request holds a slot of the total pool, catalog requests additionally hold a
+// slot of the catalog pool, and requests to limited endpoints hold a slot of
+// the endpoint's pool.
+type admissionController struct {
+	config    AdmissionConfig
+	stats     tally.Scope
+	total     chan struct{}
+	catalog   chan struct{}
+	endpoints map[string]chan struct{}
+}
+
+func newAdmissionController(config AdmissionConfig, stats tally.Scope) *admissionController {
+	config = config.applyDefaults()
+	a := &admissionController{
+		config:    config,
+		stats:     stats.SubScope("admission"),
+		total:     make(chan struct{}, config.MaxConcurrent),
+		catalog:   make(chan struct{}, config.MaxCatalogConcurrent),
+		endpoints: make(map[string]chan struct{}),
+	}
+	for endpoint, limit := range config.EndpointLimits {
+		if limit <= 0 {
+			log.Warnf("Ignoring invalid concurrency limit %d of endpoint %s", limit, endpoint)
+			continue
+		}
+		a.endpoints[endpoint] = make(chan struct{}, limit)
+	}
+	return a
+}
+
+// tryAcquire takes a slot of pool without waiting.
+func tryAcquire(pool chan struct{}) bool {
+	select {
+	case pool <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquire admits a request of class to endpoint. Returns a function which
+// releases the request's slots, or an error if the request was rejected.
+func (a *admissionController) acquire(endpoint string, class requestClass) (func(), error) {
+	var held []chan struct{}
+	release := func() {
+		for _, pool := range held {
+			<-pool
+		}
+	}
+	reject := func(reason string, code int) (func(), error) {
+		release()
+		a.stats.Tagged(map[string]string{
+			"class":  string(class),
+			"reason": reason,
+		}).Counter("rejected").Inc(1)
+		return nil, handler.Errorf("%s capacity exhausted", reason).
+			Status(code).
+			Header("Retry-After", "1")
+	}
+
+	if pool, ok := a.endpoints[endpoint]; ok {
+		if !tryAcquire(pool) {
+			return reject("endpoint", http.StatusTooManyRequests)
+		}
+		held = append(held, pool)
+	}
+	if class == classCatalog {
+		// Catalog requests never wait, since queueing them only delays
+		// shedding load.
+		if !tryAcquire(a.catalog) {
+			return reject("catalog", http.StatusTooManyRequests)
+		}
+		held = append(held, a.catalog)
+		if !tryAcquire(a.total) {
+			return reject("total", http.StatusTooManyRequests)
+		}
+		held = append(held, a.total)
+		return release, nil
+	}
+
+	select {
+	case a.total <- struct{}{}:
+	default:
+		start := time.Now()
+		timer := time.NewTimer(a.config.MaxWait)
+		defer timer.Stop()
+		select {
+		case a.total <- struct{}{}:
+			a.stats.Timer("wait").Record(time.Since(start))
+		case <-timer.C:
+			return reject("total", http.StatusServiceUnavailable)
+		}
+	}
+	held = append(held, a.total)
+	return release, nil
+}
+
+// admit wraps h such that it is only served once admitted as class. Requests
+// are served unconditionally if admission control is disabled.
+func (s *Server) admit(endpoint string, class requestClass, h http.Handler) http.Handler {
+	if s.admission == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := s.admission.acquire(endpoint, class)
+		if err != nil {
+			handler.Wrap(func(http.ResponseWriter, *http.Request) error { return err })(w, r)
+			return
+		}
+		defer release()
+		h.ServeHTTP(w, r)
+	})
+}
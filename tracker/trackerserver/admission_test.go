@@ -0,0 +1,165 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func requireStatus(t *testing.T, code int, err error) {
+	var e *handler.Error
+	require.Error(t, err)
+	require.True(t, errors.As(err, &e), "unexpected error: %s", err)
+	require.Equal(t, code, e.GetStatus())
+}
+
+func TestAdmissionReservesCapacityForCriticalRequests(t *testing.T) {
+	require := require.New(t)
+
+	a := newAdmissionController(AdmissionConfig{
+		MaxConcurrent:        2,
+		MaxCatalogConcurrent: 1,
+		MaxWait:              10 * time.Millisecond,
+	}, tally.NoopScope)
+
+	releaseCatalog, err := a.acquire("/agents", classCatalog)
+	require.NoError(err)
+
+	// The catalog pool is exhausted, but the reserved slot is still free.
+	_, err = a.acquire("/topology", classCatalog)
+	requireStatus(t, http.StatusTooManyRequests, err)
+
+	releaseCritical, err := a.acquire("/announce", classCritical)
+	require.NoError(err)
+
+	// All capacity is in use, so critical requests time out waiting.
+	_, err = a.acquire("/announce", classCritical)
+	requireStatus(t, http.StatusServiceUnavailable, err)
+
+	releaseCatalog()
+
+	release, err := a.acquire("/announce", classCritical)
+	require.NoError(err)
+	release()
+	releaseCritical()
+}
+
+func TestAdmissionCriticalRequestsWaitForCapacity(t *testing.T) {
+	require := require.New(t)
+
+	a := newAdmissionController(AdmissionConfig{
+		MaxConcurrent:        2,
+		MaxCatalogConcurrent: 1,
+		MaxWait:              5 * time.Second,
+	}, tally.NoopScope)
+
+	release1, err := a.acquire("/announce", classCritical)
+	require.NoError(err)
+	release2, err := a.acquire("/announce", classCritical)
+	require.NoError(err)
+	defer release2()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release1()
+	}()
+
+	release3, err := a.acquire("/announce", classCritical)
+	require.NoError(err)
+	release3()
+}
+
+func TestAdmissionEndpointLimits(t *testing.T) {
+	require := require.New(t)
+
+	a := newAdmissionController(AdmissionConfig{
+		MaxConcurrent:        10,
+		MaxCatalogConcurrent: 5,
+		EndpointLimits:       map[string]int{"/agents": 1, "/topology": -1},
+	}, tally.NoopScope)
+
+	release, err := a.acquire("/agents", classCatalog)
+	require.NoError(err)
+
+	_, err = a.acquire("/agents", classCatalog)
+	requireStatus(t, http.StatusTooManyRequests, err)
+
+	// Rejected requests must not leak slots of other pools.
+	for i := 0; i < 4; i++ {
+		_, err := a.acquire("/topology", classCatalog)
+		require.NoError(err)
+	}
+
+	release()
+
+	release, err = a.acquire("/agents", classCatalog)
+	require.NoError(err)
+	release()
+}
+
+func TestAdmissionCatalogLimitLeavesReservedCapacity(t *testing.T) {
+	config := AdmissionConfig{MaxConcurrent: 10, MaxCatalogConcurrent: 10}.applyDefaults()
+	require.Equal(t, 5, config.MaxCatalogConcurrent)
+}
+
+func TestServerShedsCatalogRequestsUnderOverload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{
+		Admission: AdmissionConfig{
+			Enabled:              true,
+			MaxConcurrent:        2,
+			MaxCatalogConcurrent: 1,
+		},
+	})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		mocks.config,
+		mocks.stats,
+		mocks.policy,
+		mocks.topology,
+		mocks.peerStore,
+		mocks.originStore,
+		mocks.originCluster)
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/agents", addr))
+	require.NoError(err)
+
+	// Occupy the catalog pool.
+	release, err := s.admission.acquire("/topology", classCatalog)
+	require.NoError(err)
+	defer release()
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/agents", addr))
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+
+	// Health checks bypass admission control.
+	_, err = httputil.Get(fmt.Sprintf("http://%s/health", addr))
+	require.NoError(err)
+}
@@ -14,35 +14,35 @@
 package trackerserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/tracker/peerstore"
 	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/requestid"
+
+	"github.com/uber-go/tally"
 )
 
 func (s *Server) announceHandlerV1(w http.ResponseWriter, r *http.Request) error {
-	req := new(announceclient.Request)
-	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-		return handler.Errorf("json decode request: %s", err)
-	}
-	d, err := req.GetDigest()
-	if err != nil {
-		return handler.Errorf("get request digest: %s", err)
-	}
-	resp, err := s.announce(d, req.InfoHash, req.Peer)
+	req, err := s.decodeAnnounceRequest(r)
 	if err != nil {
 		return err
 	}
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		return handler.Errorf("json encode response: %s", err)
-	}
-	return nil
+	return s.serveAnnounce(w, r, req, req.InfoHash)
 }
 
 func (s *Server) announceHandlerV2(w http.ResponseWriter, r *http.Request) error {
@@ -52,64 +52,498 @@ func (s *Server) announceHandlerV2(w http.ResponseWriter, r *http.Request) error
 	}
 	h, err := core.NewInfoHashFromHex(infohash)
 	if err != nil {
-		return fmt.Errorf("parse infohash: %s", err)
+		return handler.Errorf("parse infohash: %s", err).Status(http.StatusBadRequest)
 	}
-	req := new(announceclient.Request)
-	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-		return handler.Errorf("json decode request: %s", err)
+	req, err := s.decodeAnnounceRequest(r)
+	if err != nil {
+		return err
+	}
+	return s.serveAnnounce(w, r, req, h)
+}
+
+// serveAnnounce answers req, which announces h. V1 announces carry h in the
+// request body, whereas V2 announces carry it in the path.
+func (s *Server) serveAnnounce(
+	w http.ResponseWriter, r *http.Request, req *announceclient.Request, h core.InfoHash) error {
+
+	if err := s.limitPeer(req.Peer.PeerID.String()); err != nil {
+		return err
 	}
 	d, err := req.GetDigest()
 	if err != nil {
-		return handler.Errorf("get request digest: %s", err)
+		return handler.Errorf("get request digest: %s", err).Status(http.StatusBadRequest)
+	}
+	if err := s.validatePort(req); err != nil {
+		return err
+	}
+	if err := s.verifyToken(h, req); err != nil {
+		return err
+	}
+	protocol, err := s.negotiateProtocol(req)
+	if err != nil {
+		return err
+	}
+	s.recordLoad(req)
+	s.recordTransfer(req, h)
+	resp, err := s.announce(
+		r.Context(), req.Namespace, d, h, req.Peer, protocol, requesterFamilies(r, req))
+	if err != nil {
+		return err
+	}
+	s.maybeCompact(r, resp)
+	if err := resp.Encode(w); err != nil {
+		return handler.Errorf("encode response: %s", err)
+	}
+	return nil
+}
+
+// maybeCompact replaces the peers of resp with compact peer lists if r
+// requested them. Handouts which cannot be encoded compactly, i.e. because
+// peers are addressed by hostname, and handouts carrying explanations, are
+// left untouched.
+func (s *Server) maybeCompact(r *http.Request, resp *announceclient.Response) {
+	if r.URL.Query().Get("compact") != "1" || resp.Explanations != nil {
+		return
+	}
+	l, ok := announceclient.CompactPeers(resp.Peers)
+	if !ok {
+		s.stats.Counter("compact_announce_fallbacks").Inc(1)
+		return
+	}
+	s.stats.Counter("compact_announces").Inc(1)
+	resp.Peers = nil
+	resp.CompactPeerList = l
+}
+
+// decodeAnnounceRequest decodes and validates the announce request in the body
+// of r.
+func (s *Server) decodeAnnounceRequest(r *http.Request) (*announceclient.Request, error) {
+	b, err := s.readBody(r)
+	if err != nil {
+		return nil, err
 	}
-	resp, err := s.announce(d, h, req.Peer)
+	req, err := announceclient.DecodeRequest(b)
+	if err != nil {
+		return nil, handler.Errorf("decode request: %s", err).Status(http.StatusBadRequest)
+	}
+	return req, nil
+}
+
+// decodeBody decodes the json body of r into v, rejecting bodies larger than
+// the configured limit before decoding them.
+func (s *Server) decodeBody(r *http.Request, v interface{}) error {
+	b, err := s.readBody(r)
 	if err != nil {
 		return err
 	}
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		return handler.Errorf("json encode response: %s", err)
+	if err := json.Unmarshal(b, v); err != nil {
+		return handler.Errorf("json decode request: %s", err).Status(http.StatusBadRequest)
 	}
 	return nil
 }
 
+// readBody reads the body of r, rejecting bodies larger than the configured
+// limit.
+func (s *Server) readBody(r *http.Request) ([]byte, error) {
+	limit := int64(s.config.MaxRequestBodySize)
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, handler.Errorf("read body: %s", err)
+	}
+	if int64(len(b)) > limit {
+		return nil, handler.Errorf(
+			"request body exceeds %s", s.config.MaxRequestBodySize).
+			Status(http.StatusRequestEntityTooLarge)
+	}
+	return b, nil
+}
+
+func (s *Server) validatePort(req *announceclient.Request) error {
+	if s.ports == nil {
+		return nil
+	}
+	if err := s.ports.validate(req.Peer.Port); err != nil {
+		s.stats.Counter("announce_port_rejected").Inc(1)
+		return handler.Errorf("validate peer port: %s", err).Status(http.StatusBadRequest)
+	}
+	return nil
+}
+
+func (s *Server) verifyToken(h core.InfoHash, req *announceclient.Request) error {
+	if err := s.tokens.Verify(req.Namespace, h, req.Peer.PeerID, req.Token); err != nil {
+		s.stats.Counter("announce_token_rejected").Inc(1)
+		return handler.Errorf("verify token: %s", err).Status(http.StatusForbidden)
+	}
+	return nil
+}
+
+// negotiateProtocol returns the newest protocol version spoken by both the
+// tracker and the peer announcing req.
+func (s *Server) negotiateProtocol(req *announceclient.Request) (int, error) {
+	protocol := req.GetProtocol()
+	if protocol < s.config.MinProtocol {
+		s.stats.Counter("announce_protocol_rejected").Inc(1)
+		return 0, handler.Errorf(
+			"unsupported protocol %d, tracker supports protocols %d to %d",
+			protocol, s.config.MinProtocol, announceclient.CurrentProtocol).
+			Status(http.StatusBadRequest)
+	}
+	if protocol > announceclient.CurrentProtocol {
+		protocol = announceclient.CurrentProtocol
+	}
+	s.stats.Tagged(map[string]string{
+		"protocol": strconv.Itoa(protocol),
+	}).Counter("announces").Inc(1)
+	return protocol, nil
+}
+
+// recordLoad remembers the load hint attached to req, if any.
+func (s *Server) recordLoad(req *announceclient.Request) {
+	if req.Load == nil || req.Peer == nil {
+		return
+	}
+	if s.load != nil {
+		s.load.Update(req.Peer.PeerID, req.Load.Max())
+	}
+	// Peers which predate upload reporting omit uploaded bytes.
+	if s.throughput != nil && req.Load.Uploaded > 0 {
+		s.throughput.Update(req.Peer.PeerID, req.Load.Uploaded)
+	}
+}
+
 func (s *Server) announce(
-	d core.Digest, h core.InfoHash, peer *core.PeerInfo) (*announceclient.Response, error) {
+	ctx context.Context,
+	namespace string,
+	d core.Digest,
+	h core.InfoHash,
+	peer *core.PeerInfo,
+	protocol int,
+	families []string) (resp *announceclient.Response, err error) {
+
+	span, ctx := s.startSpan(ctx, "announce", h, d)
+	span.SetTag("peer_id", peer.PeerID.String())
+	defer func() { finishSpan(span, err) }()
 
-	if err := s.peerStore.UpdatePeer(h, peer); err != nil {
-		log.With(
+	traced := s.traces.traced(h, d)
+	var trace *handoutTrace
+	if s.config.ExplainHandout || traced {
+		trace = new(handoutTrace)
+	}
+	start := time.Now()
+	updateSpan, _ := s.startSpan(ctx, "peerstore.update_peer", h, d)
+	updateErr := s.peerStore.UpdatePeer(h, peer)
+	finishSpan(updateSpan, updateErr)
+	if updateErr != nil {
+		log.With(append([]interface{}{
 			"hash", h,
-			"peer_id", peer.PeerID).Errorf("Error updating peer: %s", err)
+			"peer_id", peer.PeerID}, requestid.LogFields(ctx)...)...).Errorf(
+			"Error updating peer: %s", updateErr)
+		trace.record("update", "error: %s", updateErr)
+		s.countStorageError(storePeers, "update_peer")
+	}
+	trace.span("update", start)
+	swarmSize := -1
+	if s.config.EmitSwarmSize || s.config.AdaptiveInterval.Enabled {
+		swarmSize = s.estimateSwarmSize(ctx, h)
+	}
+	peers, stale, err := s.getPeerHandout(ctx, namespace, d, h, peer, protocol, families, trace)
+	if traced {
+		s.logTracedAnnounce(ctx, namespace, d, h, peer, protocol, families, peers, err, trace, start)
 	}
-	peers, err := s.getPeerHandout(d, h, peer)
 	if err != nil {
 		return nil, err
 	}
-	return &announceclient.Response{
-		Peers:    peers,
-		Interval: s.config.AnnounceInterval,
-	}, nil
+	interval, minInterval := s.announceInterval(peer, peers, swarmSize)
+	resp = &announceclient.Response{
+		Peers:       peers,
+		Interval:    interval,
+		MinInterval: minInterval,
+		Stale:       stale,
+		Protocol:    protocol,
+	}
+	if s.config.ExplainHandout {
+		resp.Explanations = make([]announceclient.PeerExplanation, len(peers))
+		for i, p := range peers {
+			resp.Explanations[i] = announceclient.PeerExplanation{
+				PeerID:  p.PeerID,
+				Reasons: explainPeer(p, trace.labels[i], stale),
+			}
+		}
+	}
+	return resp, nil
 }
 
+// logTracedAnnounce logs everything known about an announce of a traced
+// torrent, regardless of the configured log level.
+func (s *Server) logTracedAnnounce(
+	ctx context.Context,
+	namespace string,
+	d core.Digest,
+	h core.InfoHash,
+	peer *core.PeerInfo,
+	protocol int,
+	families []string,
+	peers []*core.PeerInfo,
+	err error,
+	trace *handoutTrace,
+	start time.Time) {
+
+	s.stats.Counter("traced_requests").Inc(1)
+	handout := make([]string, len(peers))
+	for i, p := range peers {
+		handout[i] = fmt.Sprintf("%s@%s", p.PeerID, p.Addr())
+	}
+	logger := log.With(append([]interface{}{
+		"hash", h,
+		"digest", d,
+		"namespace", namespace,
+		"peer_id", peer.PeerID,
+		"ip", peer.IP,
+		"hostname", peer.Hostname,
+		"zone", peer.Zone,
+		"complete", peer.Complete,
+		"protocol", protocol,
+		"families", families,
+		"handout", handout,
+		"labels", trace.labels,
+		"decisions", trace.decisions,
+		"spans", trace.spans,
+		"duration", time.Since(start)}, requestid.LogFields(ctx)...)...)
+	if err != nil {
+		logger.Infof("Traced announce failed: %s", err)
+		return
+	}
+	logger.Info("Traced announce")
+}
+
+// getPeerHandout computes the peers handed out to peer, which speaks the given
+// protocol version and connects over the given address families (nil if
+// unknown). Decisions taken along the way are recorded in trace, which may be
+// nil.
 func (s *Server) getPeerHandout(
-	d core.Digest, h core.InfoHash, peer *core.PeerInfo) ([]*core.PeerInfo, error) {
+	ctx context.Context,
+	namespace string,
+	d core.Digest,
+	h core.InfoHash,
+	peer *core.PeerInfo,
+	protocol int,
+	families []string,
+	trace *handoutTrace) (peers []*core.PeerInfo, stale bool, err error) {
 
 	if peer.Complete {
 		// If the peer is announcing as complete, don't return a peer handout since
 		// the peer does not need it.
-		return nil, nil
+		trace.record("complete", "peer is complete, no handout needed")
+		return nil, false, nil
 	}
 	var errs []error
-	peers, err := s.peerStore.GetPeers(h, s.config.PeerHandoutLimit)
-	if err != nil {
+	start := time.Now()
+	peersSpan, _ := s.startSpan(ctx, "peerstore.get_peers", h, d)
+	peers, err = s.getPeers(h)
+	finishSpan(peersSpan, err)
+	trace.span("peerstore", start)
+	if peerstore.IsStale(err) {
+		log.With(append([]interface{}{"hash", h}, requestid.LogFields(ctx)...)...).Warnf(
+			"Handing out stale peers: %s", err)
+		stale = true
+		trace.record("peerstore", "served %d stale peers: %s", len(peers), err)
+		s.countStorageError(storePeers, "get_peers")
+	} else if err != nil {
 		errs = append(errs, fmt.Errorf("peer store: %s", err))
+		trace.record("peerstore", "error: %s", err)
+		s.countStorageError(storePeers, "get_peers")
+	} else {
+		trace.record("peerstore", "returned %d peers", len(peers))
 	}
+	start = time.Now()
+	originsSpan, _ := s.startSpan(ctx, "originstore.get_origins", h, d)
 	origins, err := s.originStore.GetOrigins(d)
+	finishSpan(originsSpan, err)
+	trace.span("originstore", start)
 	if err != nil {
 		errs = append(errs, fmt.Errorf("origin store: %s", err))
+		s.countStorageError(storeOrigins, "get_origins")
+		trace.record("originstore", "error: %s", err)
+	} else {
+		trace.record("originstore", "returned %d origins", len(origins))
 	}
 	peers = append(peers, origins...)
 	if len(peers) == 0 {
-		return nil, handler.Errorf("no peers available: %s", errutil.Join(errs))
+		return nil, false, handler.Errorf("no peers available: %s", errutil.Join(errs))
+	}
+	policySpan, _ := s.startSpan(ctx, "handout_policy", h, d)
+	defer func() {
+		policySpan.SetTag("handout_size", len(peers))
+		policySpan.Finish()
+	}()
+	if s.config.DeterministicHandout.Enabled {
+		seed := peerhandoutpolicy.HandoutSeed(s.config.DeterministicHandout.Seed, h, peer.PeerID)
+		log.With("hash", h, "peer_id", peer.PeerID, "seed", seed).Info("Deterministic handout")
+		peers = peerhandoutpolicy.DeterministicShuffle(peers, seed)
+		trace.record("deterministic", "shuffled with seed %d", seed)
+	}
+	// Sort before addressing, such that policies can locate peers by
+	// hostname regardless of how they are handed out.
+	peers, labels := s.policy.SortPeersWithLabels(peer, peers)
+	if s.freshness != nil {
+		// Applied before egress, such that stale seeders do not count
+		// towards the local seeders egress requires.
+		var n int
+		peers, labels, n = s.freshness.Apply(peers, labels)
+		if n > 0 {
+			s.stats.Counter("stale_peers_withheld").Inc(int64(n))
+		}
+		trace.record("freshness", "found %d peers not seen for %s", n, s.freshness.MaxAge())
+	}
+	if s.egress != nil {
+		var n int
+		peers, labels, n = s.egress.Apply(namespace, peer, peers, labels)
+		if n > 0 {
+			s.stats.Counter("egress_peers_withheld").Inc(int64(n))
+		}
+		trace.record("egress", "withheld %d paid peers", n)
+	}
+	peers, labels, n := s.maintenance.Apply(peers, labels)
+	if n > 0 {
+		s.stats.Counter("maintenance_peers_withheld").Inc(int64(n))
+		trace.record("maintenance", "withheld %d peers under maintenance", n)
+	}
+	if s.sharding != nil {
+		var n int
+		peers, labels, n = s.sharding.Apply(h, peer, peers, labels)
+		if n > 0 {
+			s.stats.Counter("sharded_seeders_withheld").Inc(int64(n))
+		}
+		trace.record("sharding", "withheld %d seeders outside shard", n)
+	}
+	if s.coLocation != nil {
+		// Applied before addressing, which may strip the hostnames that
+		// co-located peers are matched by.
+		var n int
+		peers, labels, n = s.coLocation.Apply(h, peer, peers, labels, !trace.isPreview())
+		if n > 0 {
+			s.stats.Counter("co_located_peers_reordered").Inc(int64(n))
+		}
+		trace.record("co_location", "reordered %d peers by co-located leechers", n)
+	}
+	peers, n = s.preferNetworks(peers, peer, families)
+	if n > 0 {
+		s.stats.Counter("preferred_network_peers").Inc(int64(n))
+		trace.record("network", "addressed %d peers by preferred network", n)
+	}
+	peers, labels, n = s.selectAddresses(peers, labels, families, protocol)
+	if n > 0 {
+		s.stats.Counter("unreachable_family_peers_dropped").Inc(int64(n))
+		trace.record("address_family", "dropped %d peers unreachable over %v", n, families)
+	}
+	peers = s.address(peers, protocol)
+	if s.throughput != nil {
+		random := rand.Float64
+		if s.config.DeterministicHandout.Enabled {
+			seed := peerhandoutpolicy.HandoutSeed(s.config.DeterministicHandout.Seed, h, peer.PeerID)
+			random = rand.New(rand.NewSource(seed)).Float64
+		}
+		var n int
+		peers, labels, n = s.throughput.Apply(peers, labels, random)
+		trace.record("throughput", "weighted %d peers by known throughput", n)
+	}
+	if s.load != nil {
+		var n int
+		peers, labels, n = s.load.Deprioritize(peers, labels)
+		if n > 0 {
+			s.stats.Counter("overloaded_peers_deprioritized").Inc(int64(n))
+		}
+		trace.record("load", "deprioritized %d overloaded peers", n)
+	}
+	if s.origins != nil {
+		// Applied last, such that only origins which are actually handed out
+		// count against their capacity.
+		var n int
+		peers, labels, n = s.origins.Apply(peers, labels, !trace.isPreview())
+		if n > 0 {
+			s.stats.Counter("origins_at_capacity_withheld").Inc(int64(n))
+		}
+		trace.record("origin_capacity", "withheld %d origins at capacity", n)
+	}
+	trace.recordLabels(labels)
+	if !trace.isPreview() {
+		s.stats.Histogram("handout_size", _handoutSizeBuckets).RecordValue(float64(len(peers)))
+	}
+	return peers, stale, nil
+}
+
+// address returns copies of peers which only carry the address fields allowed
+// by the handout addressing mode. Peers speaking protocols which predate
+// hostname addressing are always handed out IPs.
+func (s *Server) address(peers []*core.PeerInfo, protocol int) []*core.PeerInfo {
+	mode := s.config.HandoutAddressing
+	if protocol < announceclient.Protocol2 {
+		mode = AddressByIP
+	}
+	if mode == AddressByBoth {
+		return peers
+	}
+	result := make([]*core.PeerInfo, len(peers))
+	for i, p := range peers {
+		c := *p
+		switch mode {
+		case AddressByHostname:
+			if c.Hostname != "" {
+				c.IP = ""
+			}
+		default:
+			c.Hostname = ""
+		}
+		result[i] = &c
+	}
+	return result
+}
+
+// getPeers returns the peers of h, from the peer cache if possible. Stale peers
+// handed out by the peer store are not cached.
+func (s *Server) getPeers(h core.InfoHash) ([]*core.PeerInfo, error) {
+	if s.peers == nil {
+		return s.getPeersFromStore(h)
+	}
+	if peers, ok := s.peers.get(h); ok {
+		return peers, nil
+	}
+	peers, err := s.getPeersFromStore(h)
+	if err == nil {
+		s.peers.set(h, peers)
+	}
+	return peers, err
+}
+
+func (s *Server) getPeersFromStore(h core.InfoHash) ([]*core.PeerInfo, error) {
+	if s.config.SeederHandoutLimit <= 0 {
+		return s.peerStore.GetPeers(h, s.config.PeerHandoutLimit)
+	}
+	nLeechers := s.config.PeerHandoutLimit - s.config.SeederHandoutLimit
+	if nLeechers < 0 {
+		nLeechers = 0
+	}
+	seeders, leechers, err := s.peerStore.GetSeedersAndLeechers(
+		h, s.config.SeederHandoutLimit, nLeechers)
+	return append(seeders, leechers...), err
+}
+
+var _swarmSizeBuckets = tally.MustMakeExponentialValueBuckets(1, 2, 16)
+
+// estimateSwarmSize returns the estimated number of peers announcing h, or -1
+// if the estimate failed.
+func (s *Server) estimateSwarmSize(ctx context.Context, h core.InfoHash) int {
+	span, _ := s.startSpan(ctx, "peerstore.estimate_peer_count", h, core.Digest{})
+	seeders, leechers, err := s.peerStore.EstimatePeerCount(h)
+	finishSpan(span, err)
+	if err != nil {
+		log.With("hash", h).Errorf("Error estimating peer count: %s", err)
+		s.countStorageError(storePeers, "estimate_peer_count")
+		return -1
+	}
+	if s.config.EmitSwarmSize {
+		s.stats.Histogram("swarm_seeders", _swarmSizeBuckets).RecordValue(float64(seeders))
+		s.stats.Histogram("swarm_leechers", _swarmSizeBuckets).RecordValue(float64(leechers))
 	}
-	return s.policy.SortPeers(peer, peers), nil
+	return seeders + leechers
 }
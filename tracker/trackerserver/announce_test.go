@@ -14,8 +14,13 @@
 package trackerserver
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -23,10 +28,15 @@ import (
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/requestid"
 	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 )
 
 func newAnnounceClient(pctx core.PeerContext, addr string) announceclient.Client {
@@ -60,7 +70,7 @@ func TestAnnounceSinglePeerResponse(t *testing.T) {
 				blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
 
 			result, interval, err := client.Announce(
-				blob.Digest, blob.MetaInfo.InfoHash(), false, version)
+				core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, version)
 			require.NoError(err)
 			require.Equal(peers, result)
 			require.Equal(config.AnnounceInterval, interval)
@@ -92,11 +102,50 @@ func TestAnnounceUnavailablePeerStoreCanStillProvideOrigins(t *testing.T) {
 	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
 
 	result, _, err := client.Announce(
-		blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+		core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
 	require.NoError(err)
 	require.Equal(origins, result)
 }
 
+func TestAnnounceCountsStorageErrors(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	blob := core.NewBlobFixture()
+	origins := []*core.PeerInfo{core.OriginPeerInfoFixture()}
+
+	client := newAnnounceClient(pctx, addr)
+
+	storeErr := errors.New("some storage error")
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(storeErr)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return(nil, storeErr)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
+
+	_, _, err := client.Announce(
+		core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+	require.NoError(err)
+
+	errs := make(map[string]int64)
+	for _, c := range mocks.stats.(tally.TestScope).Snapshot().Counters() {
+		if c.Name() == "storage_errors" {
+			errs[c.Tags()["store"]+"."+c.Tags()["operation"]] = c.Value()
+		}
+	}
+	require.Equal(map[string]int64{
+		"peerstore.update_peer": 1,
+		"peerstore.get_peers":   1,
+	}, errs)
+}
+
 func TestAnnouceUnavailableOriginClusterCanStillProvidePeers(t *testing.T) {
 	require := require.New(t)
 
@@ -120,7 +169,7 @@ func TestAnnouceUnavailableOriginClusterCanStillProvidePeers(t *testing.T) {
 	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, errors.New("some error"))
 
 	result, _, err := client.Announce(
-		blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+		core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
 	require.NoError(err)
 	require.Equal(peers, result)
 }
@@ -168,3 +217,707 @@ func TestAnnounceRequestGetDigestBackwardsCompatibility(t *testing.T) {
 		})
 	}
 }
+
+func TestAnnounceTokenEnforcement(t *testing.T) {
+	require := require.New(t)
+
+	tokenConfig := announcetoken.Config{
+		Enabled:    true,
+		Secret:     "some secret",
+		Namespaces: []string{"namespace-foo/.*"},
+	}
+
+	mocks, cleanup := newServerMocks(t, Config{AnnounceToken: tokenConfig})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	pctx := core.PeerContextFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	// Announces of restricted namespaces without a token are rejected.
+	_, _, err := newAnnounceClient(pctx, addr).Announce(
+		core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+	require.Error(err)
+	require.True(httputil.IsForbidden(err))
+
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+
+	client := announceclient.New(
+		pctx,
+		hashring.NoopPassiveRing(hostlist.Fixture(addr)),
+		nil,
+		announceclient.WithToken(tokenConfig))
+
+	result, _, err := client.Announce(
+		core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+	require.NoError(err)
+	require.Equal(peers, result)
+
+	// Announces of other namespaces need no token.
+	other := core.NewBlobFixture()
+
+	mocks.originStore.EXPECT().GetOrigins(other.Digest).Return(nil, nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		other.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+	mocks.peerStore.EXPECT().UpdatePeer(
+		other.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+
+	result, _, err = newAnnounceClient(pctx, addr).Announce(
+		"public/repo", other.Digest, other.MetaInfo.InfoHash(), false, announceclient.V2)
+	require.NoError(err)
+	require.Equal(peers, result)
+}
+
+func TestAnnounceTokenEnforcementForRestrictedTorrentsInOtherNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	tokenConfig := announcetoken.Config{
+		Enabled:    true,
+		Secret:     "some secret",
+		Namespaces: []string{"namespace-foo/.*"},
+	}
+
+	mocks, cleanup := newServerMocks(t, Config{AnnounceToken: tokenConfig})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	pctx := core.PeerContextFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	client := announceclient.New(
+		pctx,
+		hashring.NoopPassiveRing(hostlist.Fixture(addr)),
+		nil,
+		announceclient.WithToken(tokenConfig))
+
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil).Times(2)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(peers, nil).Times(2)
+	mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil).Times(2)
+
+	_, _, err := client.Announce(core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+
+	// The torrent was announced in a restricted namespace, so announcing it
+	// in an unrestricted namespace without a token does not reveal its peers.
+	_, _, err = newAnnounceClient(pctx, addr).Announce(
+		"public/repo", blob.Digest, h, false, announceclient.V2)
+	require.Error(err)
+	require.True(httputil.IsForbidden(err))
+
+	// Agents holding the secret may still announce it in other namespaces.
+	result, _, err := client.Announce("public/repo", blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+	require.Equal(peers, result)
+}
+
+func TestAnnounceTokenEnforcementForTorrentsRequestedInRestrictedNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	tokenConfig := announcetoken.Config{
+		Enabled:    true,
+		Secret:     "some secret",
+		Namespaces: []string{"namespace-foo/.*"},
+	}
+
+	mocks, cleanup := newServerMocks(t, Config{AnnounceToken: tokenConfig})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.NamespaceFixture()
+	mi := core.MetaInfoFixture()
+	pctx := core.PeerContextFixture()
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	_, err := newMetaInfoClient(addr).Download(namespace, mi.Digest())
+	require.NoError(err)
+
+	// The metainfo was requested in a restricted namespace, so even the first
+	// announce of the torrent requires a token in any namespace.
+	_, _, err = newAnnounceClient(pctx, addr).Announce(
+		"public/repo", mi.Digest(), mi.InfoHash(), false, announceclient.V2)
+	require.Error(err)
+	require.True(httputil.IsForbidden(err))
+}
+
+func TestNewRejectsAnnounceTokenWithoutSecret(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{
+		AnnounceToken: announcetoken.Config{
+			Enabled:    true,
+			Namespaces: []string{".*"},
+		},
+	})
+	defer cleanup()
+
+	_, err := New(
+		mocks.config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+	require.Error(t, err)
+}
+
+func TestAnnounceExplainHandout(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{ExplainHandout: true})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		mocks.config,
+		mocks.stats,
+		mocks.policy,
+		mocks.topology,
+		mocks.peerStore,
+		mocks.originStore,
+		mocks.originCluster)
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peer := core.PeerInfoFixture()
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+	origin := core.OriginPeerInfoFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, peer).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{seeder}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return([]*core.PeerInfo{origin}, nil)
+
+	resp, err := s.announce(
+		context.Background(), core.NamespaceFixture(), blob.Digest, h, peer, announceclient.CurrentProtocol, nil)
+	require.NoError(err)
+	require.Equal([]announceclient.PeerExplanation{{
+		PeerID:  seeder.PeerID,
+		Reasons: []string{"seeder", "priority:default"},
+	}, {
+		PeerID:  origin.PeerID,
+		Reasons: []string{"origin", "priority:default"},
+	}}, resp.Explanations)
+}
+
+func TestAnnounceDeprioritizesOverloadedPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{
+		LoadAware: peerhandoutpolicy.LoadAwareConfig{Enabled: true, Threshold: 0.8},
+	})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	busy := core.PeerContextFixture()
+	busyClient := announceclient.New(
+		busy,
+		hashring.NoopPassiveRing(hostlist.Fixture(addr)),
+		nil,
+		announceclient.WithLoadHint(func() *announceclient.LoadHint {
+			return &announceclient.LoadHint{UploadSaturation: 0.95, DiskPressure: 0.1}
+		}))
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(busy, true)).Return(nil)
+
+	_, _, err := busyClient.Announce(
+		core.NamespaceFixture(), blob.Digest, h, true, announceclient.V2)
+	require.NoError(err)
+
+	busyPeer := core.PeerInfoFromContext(busy, true)
+	idlePeer := core.PeerInfoFixture()
+	idlePeer.Complete = true
+
+	pctx := core.PeerContextFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(
+		[]*core.PeerInfo{busyPeer, idlePeer}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	result, _, err := newAnnounceClient(pctx, addr).Announce(
+		core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{idlePeer, busyPeer}, result)
+}
+
+func TestAnnounceWithholdsPaidPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{
+		Egress: peerhandoutpolicy.EgressConfig{Enabled: true, MinLocalSeeders: 1},
+	})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	local := core.PeerInfoFixture()
+	local.Zone = "zone1"
+	local.Complete = true
+	remote := core.PeerInfoFixture()
+	remote.Zone = "zone2"
+	remote.Complete = true
+	origin := core.OriginPeerInfoFixture()
+
+	pctx := core.PeerContextFixture()
+	pctx.Zone = "zone1"
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(
+		[]*core.PeerInfo{remote, local}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return([]*core.PeerInfo{origin}, nil)
+
+	result, _, err := newAnnounceClient(pctx, addr).Announce(
+		core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{local}, result)
+}
+
+func TestAnnounceShardsSeeders(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{
+		Sharding: peerhandoutpolicy.ShardingConfig{Enabled: true, SeedersPerLeecher: 2},
+	})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	var seeders []*core.PeerInfo
+	for i := 0; i < 6; i++ {
+		p := core.PeerInfoFixture()
+		p.Complete = true
+		seeders = append(seeders, p)
+	}
+	leecher := core.PeerInfoFixture()
+
+	pctx := core.PeerContextFixture()
+	client := newAnnounceClient(pctx, addr)
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil).Times(2)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(
+		append([]*core.PeerInfo{leecher}, seeders...), nil).Times(2)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil).Times(2)
+
+	result, _, err := client.Announce(
+		core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+	require.Len(result, 3)
+	require.Contains(result, leecher)
+
+	// Subsequent announces hand out the same shard.
+	again, _, err := client.Announce(
+		core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+	require.Equal(result, again)
+}
+
+func TestAnnounceCapsOriginHandouts(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{
+		OriginCapacity: peerhandoutpolicy.OriginCapacityConfig{
+			Enabled:     true,
+			MaxLeechers: 1,
+			Interval:    time.Hour,
+		},
+	})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	peer := core.PeerInfoFixture()
+	origin := core.OriginPeerInfoFixture()
+
+	pctx := core.PeerContextFixture()
+	client := newAnnounceClient(pctx, addr)
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil).Times(2)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{peer}, nil).Times(2)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return([]*core.PeerInfo{origin}, nil).Times(2)
+
+	result, _, err := client.Announce(
+		core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+	require.Len(result, 2)
+	require.Contains(result, origin)
+
+	// The origin reached its capacity, so only the regular peer is handed out.
+	result, _, err = client.Announce(
+		core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{peer}, result)
+}
+
+func TestAnnounceHandoutAddressing(t *testing.T) {
+	named := core.PeerInfoFixture()
+	named.Hostname = "agent1.example.com"
+	unnamed := core.PeerInfoFixture()
+
+	withFields := func(p *core.PeerInfo, ip, hostname string) *core.PeerInfo {
+		c := *p
+		c.IP = ip
+		c.Hostname = hostname
+		return &c
+	}
+
+	tests := []struct {
+		mode     string
+		expected []*core.PeerInfo
+	}{
+		{AddressByIP, []*core.PeerInfo{
+			withFields(named, named.IP, ""),
+			unnamed,
+		}},
+		{AddressByHostname, []*core.PeerInfo{
+			withFields(named, "", named.Hostname),
+			unnamed,
+		}},
+		{AddressByBoth, []*core.PeerInfo{named, unnamed}},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, Config{HandoutAddressing: test.mode})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			h := blob.MetaInfo.InfoHash()
+			pctx := core.PeerContextFixture()
+
+			mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil)
+			mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(
+				[]*core.PeerInfo{named, unnamed}, nil)
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+			result, _, err := newAnnounceClient(pctx, addr).Announce(
+				core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+			require.NoError(err)
+			require.Equal(test.expected, result)
+		})
+	}
+}
+
+func TestAnnounceRejectsMalformedRequests(t *testing.T) {
+	h := core.InfoHashFixture()
+	peer := core.PeerInfoFixture()
+
+	validRequest := func() *announceclient.Request {
+		return &announceclient.Request{Name: core.DigestFixture().Hex(), InfoHash: h, Peer: peer}
+	}
+	marshal := func(req *announceclient.Request) string {
+		b, err := json.Marshal(req)
+		if err != nil {
+			panic(err)
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		desc   string
+		body   string
+		status int
+	}{
+		{"invalid json", "{", http.StatusBadRequest},
+		{"missing peer", `{"name":"` + core.DigestFixture().Hex() + `"}`, http.StatusBadRequest},
+		{"invalid port", func() string {
+			req := validRequest()
+			req.Peer = &core.PeerInfo{PeerID: peer.PeerID, IP: peer.IP, Port: 1 << 20}
+			return marshal(req)
+		}(), http.StatusBadRequest},
+		{"long hostname", func() string {
+			req := validRequest()
+			req.Peer = &core.PeerInfo{
+				PeerID: peer.PeerID, IP: peer.IP, Port: peer.Port, Hostname: strings.Repeat("a", 256),
+			}
+			return marshal(req)
+		}(), http.StatusBadRequest},
+		{"negative load", func() string {
+			req := validRequest()
+			req.Load = &announceclient.LoadHint{UploadSaturation: -1}
+			return marshal(req)
+		}(), http.StatusBadRequest},
+		{"invalid name", func() string {
+			req := validRequest()
+			req.Name = "foo"
+			return marshal(req)
+		}(), http.StatusBadRequest},
+		{"oversized body", `{"name":"` + strings.Repeat("a", 128*1024) + `"}`,
+			http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newServerMocks(t, Config{})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			_, err := httputil.Post(
+				fmt.Sprintf("http://%s/announce/%s", addr, h.Hex()),
+				httputil.SendBody(strings.NewReader(test.body)))
+			require.True(t, httputil.IsStatus(err, test.status), "unexpected error: %v", err)
+		})
+	}
+}
+
+func TestAnnounceNegotiatesProtocol(t *testing.T) {
+	named := core.PeerInfoFixture()
+	named.Hostname = "agent1.example.com"
+	ipOnly := *named
+	ipOnly.Hostname = ""
+	hostnameOnly := *named
+	hostnameOnly.IP = ""
+
+	tests := []struct {
+		desc       string
+		protocol   int
+		negotiated int
+		expected   *core.PeerInfo
+	}{
+		{"legacy peer", 0, announceclient.Protocol1, &ipOnly},
+		{"previous protocol", announceclient.Protocol1, announceclient.Protocol1, &ipOnly},
+		{"current protocol", announceclient.Protocol2, announceclient.Protocol2, &hostnameOnly},
+		{"newer protocol", announceclient.CurrentProtocol + 1, announceclient.CurrentProtocol, &hostnameOnly},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, Config{HandoutAddressing: AddressByHostname})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			h := blob.MetaInfo.InfoHash()
+			peer := core.PeerInfoFixture()
+
+			mocks.peerStore.EXPECT().UpdatePeer(h, peer).Return(nil)
+			mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{named}, nil)
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+			body, err := json.Marshal(&announceclient.Request{
+				Digest:   &blob.Digest,
+				InfoHash: h,
+				Peer:     peer,
+				Protocol: test.protocol,
+			})
+			require.NoError(err)
+			httpResp, err := httputil.Post(
+				fmt.Sprintf("http://%s/announce/%s", addr, h.Hex()),
+				httputil.SendBody(bytes.NewReader(body)))
+			require.NoError(err)
+			defer httpResp.Body.Close()
+
+			var resp announceclient.Response
+			require.NoError(json.NewDecoder(httpResp.Body).Decode(&resp))
+			require.Equal(test.negotiated, resp.Protocol)
+			require.Equal([]*core.PeerInfo{test.expected}, resp.Peers)
+		})
+	}
+}
+
+func TestAnnounceRejectsUnsupportedProtocol(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{MinProtocol: announceclient.Protocol2})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	body, err := json.Marshal(&announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: h,
+		Peer:     core.PeerInfoFixture(),
+	})
+	require.NoError(t, err)
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/announce/%s", addr, h.Hex()),
+		httputil.SendBody(bytes.NewReader(body)))
+	require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+}
+
+func TestAnnounceErrorsCarryRequestID(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{MinProtocol: announceclient.Protocol2})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	body, err := json.Marshal(&announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: h,
+		Peer:     core.PeerInfoFixture(),
+	})
+	require.NoError(err)
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/announce/%s", addr, h.Hex()),
+		httputil.SendBody(bytes.NewReader(body)),
+		httputil.SendHeaders(map[string]string{requestid.Header: "abc123"}))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+	serr := err.(httputil.StatusError)
+	require.Equal("abc123", serr.Header.Get(requestid.Header))
+	require.Contains(serr.ResponseDump, "(request id abc123)")
+}
+
+func TestAnnounceCompactPeers(t *testing.T) {
+	for _, version := range []int{announceclient.V1, announceclient.V2} {
+		t.Run(fmt.Sprintf("V%d", version), func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, Config{})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			pctx := core.PeerContextFixture()
+
+			client := announceclient.New(
+				pctx, hashring.NoopPassiveRing(hostlist.Fixture(addr)), nil,
+				announceclient.WithCompactPeers())
+
+			peers := []*core.PeerInfo{core.PeerInfoFixture(), core.PeerInfoFixture()}
+
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+			mocks.peerStore.EXPECT().GetPeers(
+				blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+			mocks.peerStore.EXPECT().UpdatePeer(
+				blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+
+			result, _, err := client.Announce(
+				core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, version)
+			require.NoError(err)
+
+			// Compact peers only carry ids and addresses.
+			var expected []*core.PeerInfo
+			for _, p := range peers {
+				expected = append(expected, &core.PeerInfo{PeerID: p.PeerID, IP: p.IP, Port: p.Port})
+			}
+			require.Equal(expected, result)
+		})
+	}
+}
+
+func TestAnnounceCompactPeersFallsBackToFullPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{HandoutAddressing: AddressByBoth})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peer := core.PeerInfoFixture()
+
+	other := core.PeerInfoFixture()
+	other.Hostname = "agent1.example.com"
+
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{other}, nil)
+	mocks.peerStore.EXPECT().UpdatePeer(h, peer).Return(nil)
+
+	body, err := json.Marshal(&announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: h,
+		Peer:     peer,
+		Protocol: announceclient.CurrentProtocol,
+	})
+	require.NoError(err)
+	httpResp, err := httputil.Post(
+		fmt.Sprintf("http://%s/announce/%s?compact=1", addr, h.Hex()),
+		httputil.SendBody(bytes.NewReader(body)))
+	require.NoError(err)
+	defer httpResp.Body.Close()
+
+	var resp announceclient.Response
+	require.NoError(json.NewDecoder(httpResp.Body).Decode(&resp))
+	require.Nil(resp.CompactPeerList)
+	require.Equal([]*core.PeerInfo{other}, resp.Peers)
+}
+
+func TestAnnounceCompactPeersIncludesIPv6Peers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peer := core.PeerInfoFixture()
+
+	p4 := &core.PeerInfo{PeerID: core.PeerIDFixture(), IP: "10.0.0.1", Port: 8080}
+	p6 := &core.PeerInfo{PeerID: core.PeerIDFixture(), IP: "2001:db8::1", Port: 8080}
+
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{p6, p4}, nil)
+	mocks.peerStore.EXPECT().UpdatePeer(h, peer).Return(nil)
+
+	body, err := json.Marshal(&announceclient.Request{
+		Digest:          &blob.Digest,
+		InfoHash:        h,
+		Peer:            peer,
+		Protocol:        announceclient.CurrentProtocol,
+		AddressFamilies: []string{core.IPv4, core.IPv6},
+	})
+	require.NoError(err)
+	httpResp, err := httputil.Post(
+		fmt.Sprintf("http://%s/announce/%s?compact=1", addr, h.Hex()),
+		httputil.SendBody(bytes.NewReader(body)))
+	require.NoError(err)
+	defer httpResp.Body.Close()
+
+	var resp announceclient.Response
+	require.NoError(json.NewDecoder(httpResp.Body).Decode(&resp))
+	require.Nil(resp.Peers)
+	require.NotNil(resp.CompactPeerList)
+	require.Len(resp.CompactPeerList.Peers, 6)
+	require.Len(resp.CompactPeerList.Peers6, 18)
+
+	peers, err := resp.GetPeers()
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p4, p6}, peers)
+}
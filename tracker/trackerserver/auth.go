@@ -0,0 +1,44 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"github.com/uber/kraken/utils/handler"
+)
+
+// Scopes which bearer tokens must grant to call tracker endpoints, if
+// authentication is enabled.
+const (
+	// ScopeNone marks read-only endpoints, which never require a token.
+	// Endpoints revealing the peers of torrents are never ScopeNone.
+	ScopeNone = ""
+
+	// ScopeAnnounce authorizes announces, heartbeats, and metainfo downloads.
+	ScopeAnnounce = "announce"
+
+	// ScopeMetaInfoWrite authorizes uploading metainfo.
+	ScopeMetaInfoWrite = "metainfo:write"
+
+	// ScopeAdmin authorizes maintenance, tracing, purging torrents, peer
+	// lookups, announce previews, and the admin and debug endpoints.
+	ScopeAdmin = "admin"
+)
+
+// authorize returns h guarded by scope.
+func (s *Server) authorize(scope string, h handler.ErrHandler) handler.ErrHandler {
+	if s.auth == nil || scope == ScopeNone {
+		return h
+	}
+	return s.auth.Wrap(scope, h)
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/auth"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+const authSecret = "secret"
+
+func authConfigFixture() auth.Config {
+	return auth.Config{
+		Enabled: true,
+		Keys:    []auth.KeyConfig{{Algorithm: auth.HS256, Secret: authSecret}},
+	}
+}
+
+// bearerHeader returns an Authorization header carrying an HS256 token of
+// subject granting scopes.
+func bearerHeader(t *testing.T, subject string, scopes ...string) map[string]string {
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := encode(map[string]string{"alg": auth.HS256}) + "." + encode(map[string]interface{}{
+		"sub":   subject,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": strings.Join(scopes, " "),
+	})
+	mac := hmac.New(sha256.New, []byte(authSecret))
+	mac.Write([]byte(signed))
+	token := signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+func TestAuthEndpointScopes(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{Auth: authConfigFixture()})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	announcer := httputil.SendHeaders(bearerHeader(t, "agent", ScopeAnnounce))
+	admin := httputil.SendHeaders(bearerHeader(t, "operator", ScopeAdmin))
+
+	// Health checks and read-only endpoints never require tokens.
+	_, err := httputil.Get(fmt.Sprintf("http://%s/health", addr))
+	require.NoError(err)
+	_, err = httputil.Get(fmt.Sprintf("http://%s/maintenance", addr))
+	require.NoError(err)
+
+	metainfo := fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s/metainfo",
+		addr, url.PathEscape(core.TagFixture()), core.DigestFixture())
+
+	_, err = httputil.Put(metainfo)
+	require.True(httputil.IsStatus(err, http.StatusUnauthorized))
+
+	_, err = httputil.Put(metainfo, announcer)
+	require.True(httputil.IsForbidden(err))
+
+	_, err = httputil.Put(fmt.Sprintf("http://%s/hosts/foo/maintenance", addr), announcer)
+	require.True(httputil.IsForbidden(err))
+
+	profiler := fmt.Sprintf("http://%s/debug/pprof/", addr)
+
+	_, err = httputil.Get(profiler)
+	require.True(httputil.IsStatus(err, http.StatusUnauthorized))
+
+	_, err = httputil.Get(profiler, announcer)
+	require.True(httputil.IsForbidden(err))
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/admin/traces", addr), admin)
+	require.NoError(err)
+}
+
+func TestAuthPeerLookupsRequireAdminScope(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{Auth: authConfigFixture()})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	h := core.InfoHashFixture()
+	announcer := httputil.SendHeaders(bearerHeader(t, "agent", ScopeAnnounce))
+
+	for _, path := range []string{
+		fmt.Sprintf("/announce/preview?infohash=%s&digest=%s", h.Hex(), core.DigestFixture().Hex()),
+		fmt.Sprintf("/infohashes/%s/zones/zone1/peers", h.Hex()),
+		"/hosts/foo/infohashes",
+	} {
+		t.Run(path, func(t *testing.T) {
+			require := require.New(t)
+
+			u := fmt.Sprintf("http://%s%s", addr, path)
+
+			_, err := httputil.Get(u)
+			require.True(httputil.IsStatus(err, http.StatusUnauthorized))
+
+			_, err = httputil.Get(u, announcer)
+			require.True(httputil.IsForbidden(err))
+		})
+	}
+}
+
+func TestAuthOptionalAnnounceScope(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Auth: authConfigFixture()}
+	config.Auth.Optional = []string{ScopeAnnounce}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	metainfo := fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s/metainfo",
+		addr, url.PathEscape(core.TagFixture()), core.DigestFixture())
+
+	// Announce scope is optional, so the request passes authentication and
+	// fails validation.
+	_, err := httputil.Get(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/invalid/metainfo",
+			addr, url.PathEscape(core.TagFixture())))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	_, err = httputil.Put(metainfo)
+	require.True(httputil.IsStatus(err, http.StatusUnauthorized))
+}
+
+func TestDeleteInfoHashWithAdminBearerToken(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{Auth: authConfigFixture()})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	u := fmt.Sprintf("http://%s/infohash?infohash=%s", addr, core.InfoHashFixture().Hex())
+
+	_, err := httputil.Delete(u, httputil.SendHeaders(bearerHeader(t, "agent", ScopeAnnounce)))
+	require.True(httputil.IsForbidden(err))
+
+	// Bearer tokens granting admin scope replace admin tokens. Mock peer store
+	// does not support deletion.
+	_, err = httputil.Delete(u, httputil.SendHeaders(bearerHeader(t, "operator", ScopeAdmin)))
+	require.True(httputil.IsStatus(err, http.StatusNotImplemented))
+}
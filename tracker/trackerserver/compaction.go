@@ -0,0 +1,108 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// compactionResponse reports peer store usage before and after a compaction.
+type compactionResponse struct {
+	Before  peerstore.Usage `json:"before"`
+	After   peerstore.Usage `json:"after"`
+	Removed int             `json:"removed"`
+}
+
+func (s *Server) compactor() (peerstore.Compactor, error) {
+	c, ok := s.peerStore.(peerstore.Compactor)
+	if !ok {
+		return nil, handler.Errorf("%s", peerstore.ErrNoCompaction).Status(http.StatusNotImplemented)
+	}
+	return c, nil
+}
+
+func compactionError(err error) error {
+	if err == peerstore.ErrNoCompaction {
+		return handler.Errorf("%s", err).Status(http.StatusNotImplemented)
+	}
+	return handler.Errorf("peer store: %s", err)
+}
+
+// emitUsage reports usage as gauges tagged by keyspace and stage, where stage
+// distinguishes usage measured before and after compaction.
+func (s *Server) emitUsage(usage peerstore.Usage, stage string) {
+	for name, u := range usage {
+		scope := s.stats.Tagged(map[string]string{
+			"keyspace": name,
+			"stage":    stage,
+		})
+		scope.Gauge("peerstore_keys").Update(float64(u.Keys))
+		scope.Gauge("peerstore_records").Update(float64(u.Records))
+	}
+}
+
+// peerStoreUsageHandler returns the storage usage of each peer store keyspace.
+func (s *Server) peerStoreUsageHandler(w http.ResponseWriter, r *http.Request) error {
+	c, err := s.compactor()
+	if err != nil {
+		return err
+	}
+	usage, err := c.Usage()
+	if err != nil {
+		return compactionError(err)
+	}
+	s.emitUsage(usage, "current")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(usage); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
+// peerStoreCompactHandler removes expired and orphaned peer store records,
+// returning usage before and after compaction.
+func (s *Server) peerStoreCompactHandler(w http.ResponseWriter, r *http.Request) error {
+	c, err := s.compactor()
+	if err != nil {
+		return err
+	}
+	var resp compactionResponse
+	resp.Before, err = c.Usage()
+	if err != nil {
+		return compactionError(err)
+	}
+	resp.Removed, err = c.Compact()
+	if err != nil {
+		return compactionError(err)
+	}
+	resp.After, err = c.Usage()
+	if err != nil {
+		return compactionError(err)
+	}
+	s.emitUsage(resp.Before, "before")
+	s.emitUsage(resp.After, "after")
+	s.stats.Counter("peerstore_compacted_keys").Inc(int64(resp.Removed))
+	log.Infof("Compacted peer store: removed %d keys", resp.Removed)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerStoreCompactionEndpoints(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	store := peerstore.NewLocalStore(peerstore.LocalConfig{}, clock.New())
+	defer store.Close()
+
+	s := newTestServer(
+		t,
+		mocks.config, mocks.stats, mocks.policy, mocks.topology, store, mocks.originStore, mocks.originCluster)
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	require.NoError(store.UpdatePeer(core.InfoHashFixture(), core.PeerInfoFixture()))
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/admin/peerstore/usage", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var usage peerstore.Usage
+	require.NoError(json.NewDecoder(resp.Body).Decode(&usage))
+	require.Equal(peerstore.KeyspaceUsage{Keys: 1, Records: 1}, usage["torrents"])
+
+	resp, err = httputil.Post(fmt.Sprintf("http://%s/admin/peerstore/compact", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	// Nothing has expired.
+	var result compactionResponse
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(0, result.Removed)
+	require.Equal(result.Before, result.After)
+	require.Equal(peerstore.KeyspaceUsage{Keys: 1, Records: 1}, result.After["torrents"])
+}
+
+func TestPeerStoreCompactionEndpointsUnsupportedStore(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/admin/peerstore/usage", addr))
+	require.True(httputil.IsStatus(err, http.StatusNotImplemented))
+
+	_, err = httputil.Post(fmt.Sprintf("http://%s/admin/peerstore/compact", addr))
+	require.True(httputil.IsStatus(err, http.StatusNotImplemented))
+}
@@ -16,7 +16,32 @@ package trackerserver
 import (
 	"time"
 
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/auth"
+	"github.com/uber/kraken/lib/middleware"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/tracker/fleet"
+	"github.com/uber/kraken/tracker/metainfostore"
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/listener"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// Handout addressing modes.
+const (
+	// AddressByIP hands out peer IPs only.
+	AddressByIP = "ip"
+
+	// AddressByHostname hands out peer hostnames only. Peers which did not
+	// announce a hostname are still addressed by IP.
+	AddressByHostname = "hostname"
+
+	// AddressByBoth hands out both IPs and hostnames. Agents connect to the
+	// hostname if present.
+	AddressByBoth = "both"
 )
 
 // Config defines configuration for the tracker service.
@@ -27,9 +52,162 @@ type Config struct {
 	// Limits the number of peers returned on each announce.
 	PeerHandoutLimit int `yaml:"announce_limit"`
 
+	// Limits the number of seeders returned on each announce. If set, each
+	// announce returns up to SeederHandoutLimit seeders, with leechers filling
+	// the remainder of PeerHandoutLimit. Otherwise, peers are sampled without
+	// regard to completeness.
+	SeederHandoutLimit int `yaml:"seeder_handout_limit"`
+
+	// AnnounceInterval is the interval peers are told to announce at.
 	AnnounceInterval time.Duration `yaml:"announce_interval"`
 
+	// AdaptiveInterval scales AnnounceInterval by the size and health of the
+	// swarm of each announcing peer.
+	AdaptiveInterval AdaptiveIntervalConfig `yaml:"adaptive_interval"`
+
+	// HandoutAddressing controls how handed out peers are addressed. Must be
+	// one of AddressByIP, AddressByHostname, or AddressByBoth. Defaults to
+	// AddressByIP.
+	HandoutAddressing string `yaml:"handout_addressing"`
+
+	// AddressFamilies is the preference order of address families handed out
+	// for dual-stack peers, e.g. ["ipv6", "ipv4"]. Each peer is handed out
+	// with its most preferred address the requesting peer can connect over.
+	// Families omitted are never handed out. Defaults to ["ipv4", "ipv6"].
+	AddressFamilies []string `yaml:"address_families"`
+
+	// PreferredNetworks is the preference order of labeled networks, e.g.
+	// ["storage"], which multi-homed peers are handed out by. A peer is handed
+	// out by its address on a network only if the requesting peer announced
+	// an address on the same network.
+	PreferredNetworks []string `yaml:"preferred_networks"`
+
+	// DeterministicHandout makes handouts reproducible for identical peer store
+	// contents. Note, peer stores sample randomly when a swarm exceeds
+	// PeerHandoutLimit, so handouts of such swarms are not reproducible.
+	DeterministicHandout peerhandoutpolicy.DeterministicConfig `yaml:"deterministic_handout"`
+
+	// EmitSwarmSize enables emitting estimated swarm size histograms on each
+	// announce. Estimates are cheap, but still cost a peer store round trip.
+	EmitSwarmSize bool `yaml:"emit_swarm_size"`
+
+	// ExplainHandout annotates announce responses with the reasons each peer
+	// was handed out. Intended for tuning handout policies, not for production
+	// traffic, since it inflates response sizes.
+	ExplainHandout bool `yaml:"explain_handout"`
+
+	// LoadAware deprioritizes peers which advertise high load in their
+	// announces.
+	LoadAware peerhandoutpolicy.LoadAwareConfig `yaml:"load_aware"`
+
+	// Throughput hands out peers with higher upload throughput, derived from
+	// the uploaded bytes in their load hints, first.
+	Throughput peerhandoutpolicy.ThroughputConfig `yaml:"throughput"`
+
+	// Egress withholds peers in other zones and origins from handouts when
+	// enough seeders are available in the zone of the announcing peer.
+	Egress peerhandoutpolicy.EgressConfig `yaml:"egress"`
+
+	// Sharding hands out each leecher a stable subset of seeders per torrent,
+	// chosen by rendezvous hashing of peer ids.
+	Sharding peerhandoutpolicy.ShardingConfig `yaml:"sharding"`
+
+	// CoLocation hands out leechers which share a host different remote
+	// peers, and each other first.
+	CoLocation peerhandoutpolicy.CoLocationConfig `yaml:"co_location"`
+
+	// OriginCapacity caps how many leechers each origin is handed out to per
+	// interval, handing out regular peers instead once reached.
+	OriginCapacity peerhandoutpolicy.OriginCapacityConfig `yaml:"origin_capacity"`
+
+	// Freshness withholds peers which have not announced for a fraction of the
+	// peer TTL, and have thus likely left the swarm.
+	Freshness peerhandoutpolicy.FreshnessConfig `yaml:"freshness"`
+
+	// Maintenance configures withholding hosts which operators placed under
+	// maintenance from handouts.
+	Maintenance peerhandoutpolicy.MaintenanceConfig `yaml:"maintenance"`
+
+	// Tracing configures logging every request of individual torrents, which
+	// operators enable via the admin API.
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// DistributionHints attaches suggestions of how to download each blob to
+	// its metainfo, based on the current swarm.
+	DistributionHints DistributionHintConfig `yaml:"distribution_hints"`
+
+	// MetaInfoStore stores metainfo on the tracker, such that metainfo is
+	// served without asking origins, and can be fetched by infohash.
+	MetaInfoStore metainfostore.Config `yaml:"metainfo_store"`
+
+	// Admin authorizes destructive operations, such as purging torrents.
+	Admin AdminConfig `yaml:"admin"`
+
+	// Compression compresses json responses of catalog endpoints, e.g. peer
+	// and fleet dumps.
+	Compression middleware.CompressConfig `yaml:"compression"`
+
+	// Admission limits request concurrency, reserving capacity for announces
+	// over expensive catalog queries.
+	Admission AdmissionConfig `yaml:"admission"`
+
+	// RateLimit limits the rate of announce and metainfo requests per peer
+	// and per source IP.
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+
+	// WarmUp preloads peers of popular torrents into the peer cache on
+	// startup before reporting ready.
+	WarmUp WarmUpConfig `yaml:"warm_up"`
+
+	// PeerCache caches the peers of torrents in memory, such that announces
+	// of the same torrent do not all hit the peer store.
+	PeerCache PeerCacheConfig `yaml:"peer_cache"`
+
+	// Usage accounts the bytes peers transfer per namespace, for attributing
+	// infrastructure cost.
+	Usage UsageConfig `yaml:"usage"`
+
+	// Reaper periodically deletes expired peers from the peer store.
+	Reaper ReaperConfig `yaml:"reaper"`
+
+	// DrainPeriod is how long the tracker keeps serving after it starts
+	// reporting not ready on shutdown, such that load balancers can remove it
+	// before it stops accepting connections.
+	DrainPeriod time.Duration `yaml:"drain_period"`
+
+	// Fleet configures tracking of agents which report their state via
+	// heartbeats.
+	Fleet fleet.RegistryConfig `yaml:"fleet"`
+
 	Listener listener.Config `yaml:"listener"`
+
+	// TLS terminates TLS on Listener, such that trackers can be reached
+	// without nginx. Configuring client CAs requires agents and origins to
+	// present certificates, i.e. mutual TLS.
+	TLS httputil.ServerTLSConfig `yaml:"tls"`
+
+	// MinProtocol is the oldest announce protocol version accepted from peers.
+	// Defaults to the version preceding announceclient.CurrentProtocol, such
+	// that agents one version behind keep working during upgrades.
+	MinProtocol int `yaml:"min_protocol"`
+
+	// MaxRequestBodySize caps the size of announce and heartbeat request
+	// bodies. Larger requests are rejected with 413.
+	MaxRequestBodySize datasize.ByteSize `yaml:"max_request_body_size"`
+
+	// PortValidation rejects announces of peers listening on disallowed
+	// ports, e.g. privileged ports or ports outside of the ranges agents are
+	// deployed with.
+	PortValidation PortValidationConfig `yaml:"port_validation"`
+
+	// AnnounceToken requires announces of restricted namespaces to carry a
+	// signed, single-use token, such that captured announce requests cannot be
+	// replayed to obtain peers.
+	AnnounceToken announcetoken.Config `yaml:"announce_token"`
+
+	// Auth requires requests to carry bearer tokens granting the scope of
+	// their endpoint, e.g. ScopeMetaInfoWrite to upload metainfo.
+	Auth auth.Config `yaml:"auth"`
 }
 
 func (c Config) applyDefaults() Config {
@@ -39,8 +217,76 @@ func (c Config) applyDefaults() Config {
 	if c.PeerHandoutLimit == 0 {
 		c.PeerHandoutLimit = 50
 	}
+	if c.HandoutAddressing == "" {
+		c.HandoutAddressing = AddressByIP
+	}
+	if len(c.AddressFamilies) == 0 {
+		c.AddressFamilies = []string{core.IPv4, core.IPv6}
+	}
 	if c.AnnounceInterval == 0 {
 		c.AnnounceInterval = 3 * time.Second
 	}
+	if c.DrainPeriod == 0 {
+		c.DrainPeriod = 10 * time.Second
+	}
+	if c.MinProtocol == 0 {
+		c.MinProtocol = announceclient.CurrentProtocol - 1
+	}
+	if c.MaxRequestBodySize == 0 {
+		c.MaxRequestBodySize = 64 * datasize.KB
+	}
+	c.AdaptiveInterval = c.AdaptiveInterval.applyDefaults()
+	c.WarmUp = c.WarmUp.applyDefaults()
+	c.Reaper = c.Reaper.applyDefaults()
+	c.DistributionHints = c.DistributionHints.applyDefaults()
+	return c
+}
+
+// WarmUpConfig defines tracker warm-up configuration. Warm-up requires a peer
+// store which counts announces, e.g. Redis with track_announce_counts enabled,
+// and the peer cache, which warm-up fills. Warm-up is skipped if the peer cache
+// is disabled.
+type WarmUpConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// NumInfoHashes is the number of most announced torrents to preload.
+	NumInfoHashes int `yaml:"num_infohashes"`
+
+	// Timeout bounds warm-up, after which the tracker reports ready regardless.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c WarmUpConfig) applyDefaults() WarmUpConfig {
+	if c.NumInfoHashes == 0 {
+		c.NumInfoHashes = 1000
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 30 * time.Second
+	}
+	return c
+}
+
+// ReaperConfig defines periodic deletion of expired peers. Reaping requires a
+// peer store which supports deleting expired peers. Peers expire according to
+// the TTL of the peer store.
+type ReaperConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Interval between reaps.
+	Interval time.Duration `yaml:"interval"`
+
+	// Jitter adds a random duration in [0, Jitter) to each interval, such that
+	// trackers sharing a peer store do not reap it at once. Defaults to
+	// half of Interval. Negative values disable jitter.
+	Jitter time.Duration `yaml:"jitter"`
+}
+
+func (c ReaperConfig) applyDefaults() ReaperConfig {
+	if c.Interval == 0 {
+		c.Interval = 10 * time.Minute
+	}
+	if c.Jitter == 0 {
+		c.Jitter = c.Interval / 2
+	}
 	return c
 }
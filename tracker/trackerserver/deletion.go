@@ -0,0 +1,127 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/metainfostore"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// deleteInfoHashResponse reports a purged torrent.
+type deleteInfoHashResponse struct {
+	InfoHash string `json:"infohash"`
+
+	// Peers is the number of distinct peers removed from the peer store.
+	Peers int `json:"peers"`
+}
+
+// deleteInfoHashHandler purges a torrent, identified by either an infohash
+// query param, or the namespace and name query params of its blob. All peers
+// of the torrent are removed from the peer store, along with any stored
+// metainfo. Origins are not notified, so blobs which still exist on origins
+// are seeded again once origins announce.
+func (s *Server) deleteInfoHashHandler(w http.ResponseWriter, r *http.Request) error {
+	holder, err := s.checkAdmin(r)
+	if err != nil {
+		return err
+	}
+	d, h, err := s.resolveDeletion(r)
+	if err != nil {
+		return err
+	}
+	deleter, ok := s.peerStore.(peerstore.TorrentDeleter)
+	if !ok {
+		return handler.Errorf("%s", peerstore.ErrNoDeletion).Status(http.StatusNotImplemented)
+	}
+	removed, err := deleter.DeleteTorrent(h)
+	if err != nil {
+		if err == peerstore.ErrNoDeletion {
+			return handler.Errorf("%s", err).Status(http.StatusNotImplemented)
+		}
+		return handler.Errorf("delete torrent: %s", err)
+	}
+	if s.peers != nil {
+		s.peers.evict(h)
+	}
+	logger := log.With("hash", h, "peers", removed, "holder", holder, "remote_addr", r.RemoteAddr)
+	if d != (core.Digest{}) {
+		logger = logger.With("digest", d)
+		if s.metaInfos != nil {
+			if err := s.metaInfos.Delete(d); err != nil {
+				return handler.Errorf("delete metainfo: %s", err)
+			}
+		}
+	}
+	s.stats.Counter("deleted_torrents").Inc(1)
+	s.stats.Counter("deleted_peers").Inc(int64(removed))
+	logger.Warn("Torrent deleted")
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deleteInfoHashResponse{h.Hex(), removed}); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
+// resolveDeletion returns the infohash of the torrent to delete, along with the
+// digest of its blob if known. Torrents named by blob are resolved via their
+// metainfo, which must still be stored or available from origins.
+func (s *Server) resolveDeletion(r *http.Request) (core.Digest, core.InfoHash, error) {
+	q := r.URL.Query()
+	if raw := q.Get("infohash"); raw != "" {
+		h, err := core.NewInfoHashFromHex(raw)
+		if err != nil {
+			return core.Digest{}, core.InfoHash{}, handler.Errorf(
+				"parse infohash: %s", err).Status(http.StatusBadRequest)
+		}
+		var d core.Digest
+		if s.metaInfos != nil {
+			mi, err := s.metaInfos.GetByInfoHash(h)
+			if err == nil {
+				d = mi.Digest()
+			} else if err != metainfostore.ErrNotFound {
+				return core.Digest{}, core.InfoHash{}, handler.Errorf("get metainfo: %s", err)
+			}
+		}
+		return d, h, nil
+	}
+	namespace := q.Get("namespace")
+	name := q.Get("name")
+	if namespace == "" || name == "" {
+		return core.Digest{}, core.InfoHash{}, handler.Errorf(
+			"either infohash, or namespace and name query params required").
+			Status(http.StatusBadRequest)
+	}
+	d, err := parseName(name)
+	if err != nil {
+		return core.Digest{}, core.InfoHash{}, handler.Errorf(
+			"parse name: %s", err).Status(http.StatusBadRequest)
+	}
+	mi, err := s.getMetaInfo(r.Context(), namespace, d)
+	if err != nil {
+		if serr, ok := err.(httputil.StatusError); ok {
+			return core.Digest{}, core.InfoHash{}, handler.Errorf(
+				"origin: %s", serr.ResponseDump).Status(serr.Status)
+		}
+		return core.Digest{}, core.InfoHash{}, handler.Errorf("get metainfo: %s", err)
+	}
+	return d, mi.InfoHash(), nil
+}
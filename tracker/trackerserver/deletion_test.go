@@ -0,0 +1,176 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/metainfostore"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminConfigHolder(t *testing.T) {
+	require := require.New(t)
+
+	c := AdminConfig{Tokens: map[string]string{"ops": "secret"}}
+
+	holder, ok := c.holder("secret")
+	require.True(ok)
+	require.Equal("ops", holder)
+
+	_, ok = c.holder("wrong")
+	require.False(ok)
+
+	_, ok = c.holder("")
+	require.False(ok)
+}
+
+func TestDeleteInfoHashRequiresAdmin(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	u := fmt.Sprintf("http://%s/infohash?infohash=%s", addr, core.InfoHashFixture().Hex())
+
+	// Disabled without tokens.
+	_, err := httputil.Delete(u, httputil.SendHeaders(map[string]string{AdminTokenHeader: "secret"}))
+	require.True(httputil.IsForbidden(err))
+
+	mocks.config.Admin = AdminConfig{Tokens: map[string]string{"ops": "secret"}}
+
+	addr, stop = testutil.StartServer(mocks.handler())
+	defer stop()
+
+	u = fmt.Sprintf("http://%s/infohash?infohash=%s", addr, core.InfoHashFixture().Hex())
+
+	_, err = httputil.Delete(u)
+	require.True(httputil.IsStatus(err, http.StatusUnauthorized))
+
+	_, err = httputil.Delete(u, httputil.SendHeaders(map[string]string{AdminTokenHeader: "wrong"}))
+	require.True(httputil.IsStatus(err, http.StatusUnauthorized))
+
+	// Mock peer store does not support deletion.
+	_, err = httputil.Delete(u, httputil.SendHeaders(map[string]string{AdminTokenHeader: "secret"}))
+	require.True(httputil.IsStatus(err, http.StatusNotImplemented))
+}
+
+func TestDeleteInfoHashByName(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		Admin:         AdminConfig{Tokens: map[string]string{"ops": "secret"}},
+		MetaInfoStore: metainfostore.Config{Enabled: true},
+	}
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	store := peerstore.NewLocalStore(peerstore.LocalConfig{}, clock.New())
+	defer store.Close()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology, store, mocks.originStore, mocks.originCluster)
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+	h := mi.InfoHash()
+
+	require.NoError(store.UpdatePeer(h, core.PeerInfoFixture()))
+	require.NoError(store.UpdatePeer(h, core.PeerInfoFixture()))
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	_, err := httputil.Get(
+		fmt.Sprintf("http://%s/infohashes/%s/metainfo", addr, h.Hex()))
+	require.True(httputil.IsNotFound(err))
+
+	resp, err := httputil.Delete(
+		fmt.Sprintf("http://%s/infohash?%s", addr, url.Values{
+			"namespace": {namespace},
+			"name":      {mi.Digest().Hex()},
+		}.Encode()),
+		httputil.SendHeaders(map[string]string{AdminTokenHeader: "secret"}))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var result deleteInfoHashResponse
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(deleteInfoHashResponse{InfoHash: h.Hex(), Peers: 2}, result)
+
+	peers, err := store.GetPeers(h, 10)
+	require.NoError(err)
+	require.Empty(peers)
+
+	_, err = httputil.Get(
+		fmt.Sprintf("http://%s/infohashes/%s/metainfo", addr, h.Hex()))
+	require.True(httputil.IsNotFound(err))
+}
+
+func TestDeleteInfoHashByInfoHash(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Admin: AdminConfig{Tokens: map[string]string{"ops": "secret"}}}
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	store := peerstore.NewLocalStore(peerstore.LocalConfig{}, clock.New())
+	defer store.Close()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology, store, mocks.originStore, mocks.originCluster)
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	h := core.InfoHashFixture()
+	require.NoError(store.UpdatePeer(h, core.PeerInfoFixture()))
+
+	headers := httputil.SendHeaders(map[string]string{AdminTokenHeader: "secret"})
+
+	_, err := httputil.Delete(fmt.Sprintf("http://%s/infohash?infohash=invalid", addr), headers)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	_, err = httputil.Delete(fmt.Sprintf("http://%s/infohash", addr), headers)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	resp, err := httputil.Delete(fmt.Sprintf("http://%s/infohash?infohash=%s", addr, h.Hex()), headers)
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var result deleteInfoHashResponse
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(1, result.Peers)
+
+	peers, err := store.GetPeers(h, 10)
+	require.NoError(err)
+	require.Empty(peers)
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/tracker/fleet"
+	"github.com/uber/kraken/utils/handler"
+)
+
+func (s *Server) agentHeartbeatHandler(w http.ResponseWriter, r *http.Request) error {
+	var report fleet.Report
+	if err := s.decodeBody(r, &report); err != nil {
+		return err
+	}
+	s.fleet.Update(&report)
+	return nil
+}
+
+// fleetOverviewHandler returns the state of all agents reporting to this
+// tracker.
+func (s *Server) fleetOverviewHandler(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.fleet.Overview()); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
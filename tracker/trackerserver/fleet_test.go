@@ -0,0 +1,79 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/fleet"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentHeartbeatAppearsInFleetOverview(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	report := &fleet.Report{
+		PeerID:         core.PeerIDFixture(),
+		IP:             "localhost",
+		Version:        "v1",
+		ActiveTorrents: 3,
+		DownloadErrors: 2,
+	}
+	body, err := json.Marshal(report)
+	require.NoError(err)
+
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/agents/heartbeat", addr),
+		httputil.SendBody(bytes.NewReader(body)))
+	require.NoError(err)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/agents", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var o fleet.Overview
+	require.NoError(json.NewDecoder(resp.Body).Decode(&o))
+	require.Equal(1, o.Total)
+	require.Equal(map[string]int{"v1": 1}, o.Versions)
+	require.Equal(*report, o.Agents[0].Report)
+	require.False(o.Agents[0].Stale)
+}
+
+func TestAgentHeartbeatInvalidBody(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err := httputil.Post(
+		fmt.Sprintf("http://%s/agents/heartbeat", addr),
+		httputil.SendBody(bytes.NewReader([]byte("not json"))))
+	require.True(httputil.IsStatus(err, 400))
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gofuzz
+// +build gofuzz
+
+package trackerserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/uber/kraken/core"
+)
+
+var (
+	_fuzzHandler  = Fixture().Handler()
+	_fuzzInfoHash = core.NewInfoHashFromBytes([]byte("fuzz"))
+)
+
+// Fuzz is a go-fuzz target for announce request parsing. Malformed requests
+// must be rejected with 4xx, never panic or fail with 5xx.
+func Fuzz(data []byte) int {
+	r := httptest.NewRequest(
+		http.MethodPost, "/announce/"+_fuzzInfoHash.Hex(), bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	_fuzzHandler.ServeHTTP(w, r)
+	if w.Code >= 500 {
+		panic(fmt.Sprintf("announce failed with %d: %s", w.Code, w.Body))
+	}
+	if w.Code != http.StatusOK {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,326 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/uber/kraken/core"
+	trackerpb "github.com/uber/kraken/gen/go/proto/tracker"
+	"github.com/uber/kraken/lib/auth"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/tracker/trackergrpc"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcpeer "google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcService answers gRPC metadata requests with the same storage, handout
+// policy and validation as the HTTP API.
+type grpcService struct {
+	s *Server
+}
+
+var _ trackergrpc.Authorizer = grpcService{}
+
+// GRPCService returns a trackerpb.TrackerServer which serves requests from s.
+func (s *Server) GRPCService() trackerpb.TrackerServer {
+	return grpcService{s}
+}
+
+// _grpcScopes are the scopes which bearer tokens must grant to call each gRPC
+// method, matching the scopes of the equivalent HTTP endpoints.
+var _grpcScopes = map[string]string{
+	"GetMetaInfo":       ScopeAnnounce,
+	"Announce":          ScopeAnnounce,
+	"Scrape":            ScopeNone,
+	"GetHostInfoHashes": ScopeAdmin,
+}
+
+// Authorize authorizes gRPC requests with the bearer token carried in their
+// "authorization" metadata, if authentication is enabled. Methods without a
+// known scope require ScopeAdmin.
+func (g grpcService) Authorize(ctx context.Context, method string) (context.Context, error) {
+	if g.s.auth == nil {
+		return ctx, nil
+	}
+	scope, ok := _grpcScopes[path.Base(method)]
+	if !ok {
+		scope = ScopeAdmin
+	}
+	if scope == ScopeNone {
+		return ctx, nil
+	}
+	var h string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			h = v[0]
+		}
+	}
+	claims, err := g.s.auth.AuthorizeHeader(h, scope)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if claims != nil {
+		ctx = auth.NewContext(ctx, claims)
+	}
+	return ctx, nil
+}
+
+// GetMetaInfo returns the metainfo of the requested blob.
+func (g grpcService) GetMetaInfo(
+	ctx context.Context, req *trackerpb.GetMetaInfoRequest) (*trackerpb.GetMetaInfoResponse, error) {
+
+	if req.Namespace == "" {
+		return nil, status.Error(codes.InvalidArgument, "namespace required")
+	}
+	d, err := core.ParseSHA256Digest(req.Digest)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "parse digest: %s", err)
+	}
+	mi, err := g.s.getMetaInfo(ctx, req.Namespace, d)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	b, err := mi.Serialize()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "serialize metainfo: %s", err)
+	}
+	return &trackerpb.GetMetaInfoResponse{
+		InfoHash: mi.InfoHash().Hex(),
+		Metainfo: b,
+	}, nil
+}
+
+// Announce records the requesting peer and returns its handout. Peers are
+// handed out in the address families the request lists, or in any family if
+// none are listed.
+func (g grpcService) Announce(
+	ctx context.Context, req *trackerpb.AnnounceRequest) (*trackerpb.AnnounceResponse, error) {
+
+	d, err := core.ParseSHA256Digest(req.Digest)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "parse digest: %s", err)
+	}
+	h, err := core.NewInfoHashFromHex(req.InfoHash)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "parse infohash: %s", err)
+	}
+	if req.Peer == nil {
+		return nil, status.Error(codes.InvalidArgument, "peer required")
+	}
+	peer, err := peerFromProto(req.Peer)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "parse peer: %s", err)
+	}
+	if err := g.s.limitAnnounce(peer.PeerID.String(), grpcSourceIP(ctx)); err != nil {
+		return nil, grpcError(err)
+	}
+	areq := &announceclient.Request{
+		Name:      d.Hex(),
+		Digest:    &d,
+		InfoHash:  h,
+		Peer:      peer,
+		Namespace: req.Namespace,
+		Protocol:  announceclient.CurrentProtocol,
+		Transfer: &announceclient.Transfer{
+			Uploaded:   req.Uploaded,
+			Downloaded: req.Downloaded,
+		},
+		AddressFamilies: req.AddressFamilies,
+	}
+	if req.Token != nil {
+		areq.Token = &announcetoken.Token{
+			Nonce:     req.Token.Nonce,
+			Timestamp: req.Token.Timestamp,
+			Signature: req.Token.Signature,
+		}
+	}
+	if err := areq.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid request: %s", err)
+	}
+	if err := g.s.validatePort(areq); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := g.s.verifyToken(h, areq); err != nil {
+		return nil, grpcError(err)
+	}
+	protocol, err := g.s.negotiateProtocol(areq)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	g.s.recordTransfer(areq, h)
+	resp, err := g.s.announce(ctx, req.Namespace, d, h, peer, protocol, req.AddressFamilies)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	peers := make([]*trackerpb.Peer, len(resp.Peers))
+	for i, p := range resp.Peers {
+		peers[i] = peerToProto(p)
+	}
+	g.s.stats.Counter("grpc_announces").Inc(1)
+	return &trackerpb.AnnounceResponse{
+		Peers:      peers,
+		IntervalMs: int64(resp.GetInterval() / time.Millisecond),
+	}, nil
+}
+
+// Scrape returns the stats of the requested infohashes, as served by the HTTP
+// scrape endpoints.
+func (g grpcService) Scrape(
+	ctx context.Context, req *trackerpb.ScrapeRequest) (*trackerpb.ScrapeResponse, error) {
+
+	if len(req.InfoHashes) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no infohashes")
+	}
+	if len(req.InfoHashes) > _maxScrapeInfoHashes {
+		return nil, status.Errorf(
+			codes.InvalidArgument, "%d infohashes exceeds %d", len(req.InfoHashes), _maxScrapeInfoHashes)
+	}
+	hashes := make([]core.InfoHash, len(req.InfoHashes))
+	for i, v := range req.InfoHashes {
+		h, err := core.NewInfoHashFromHex(v)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "parse infohash: %s", err)
+		}
+		hashes[i] = h
+	}
+	stats, err := g.s.scrape(hashes)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "scrape: %s", err)
+	}
+	g.s.stats.Counter("scraped_infohashes").Inc(int64(len(hashes)))
+	resp := &trackerpb.ScrapeResponse{Stats: make([]*trackerpb.SwarmStats, len(stats))}
+	for i, st := range stats {
+		resp.Stats[i] = &trackerpb.SwarmStats{
+			Seeders:   int32(st.Seeders),
+			Leechers:  int32(st.Leechers),
+			Completed: int32(st.Completed),
+		}
+	}
+	return resp, nil
+}
+
+// GetHostInfoHashes returns the infohashes which the requested host recently
+// announced for.
+func (g grpcService) GetHostInfoHashes(
+	ctx context.Context,
+	req *trackerpb.GetHostInfoHashesRequest) (*trackerpb.GetHostInfoHashesResponse, error) {
+
+	if req.Host == "" {
+		return nil, status.Error(codes.InvalidArgument, "host required")
+	}
+	i, err := g.s.peerIndex()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	hashes, err := i.GetInfoHashesByHost(req.Host)
+	if err != nil {
+		return nil, grpcError(peerIndexError(err))
+	}
+	resp := &trackerpb.GetHostInfoHashesResponse{InfoHashes: make([]string, len(hashes))}
+	for j, h := range hashes {
+		resp.InfoHashes[j] = h.Hex()
+	}
+	return resp, nil
+}
+
+func peerFromProto(p *trackerpb.Peer) (*core.PeerInfo, error) {
+	id, err := core.NewPeerID(p.PeerId)
+	if err != nil {
+		return nil, err
+	}
+	return &core.PeerInfo{
+		PeerID:   id,
+		IP:       p.Ip,
+		Port:     int(p.Port),
+		Origin:   p.Origin,
+		Complete: p.Complete,
+		Hostname: p.Hostname,
+		Zone:     p.Zone,
+		Rack:     p.Rack,
+		DC:       p.Dc,
+	}, nil
+}
+
+func peerToProto(p *core.PeerInfo) *trackerpb.Peer {
+	return &trackerpb.Peer{
+		PeerId:   p.PeerID.String(),
+		Ip:       p.IP,
+		Port:     int32(p.Port),
+		Complete: p.Complete,
+		Origin:   p.Origin,
+		Hostname: p.Hostname,
+		Zone:     p.Zone,
+		Rack:     p.Rack,
+		Dc:       p.DC,
+	}
+}
+
+// grpcSourceIP returns the IP the grpc request of ctx was sent from. Returns
+// empty string if unknown.
+func grpcSourceIP(ctx context.Context) string {
+	p, ok := grpcpeer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// grpcError converts errors of the HTTP handlers, and errors received from
+// origins, into gRPC status errors.
+func grpcError(err error) error {
+	var s int
+	switch e := err.(type) {
+	case *handler.Error:
+		s = e.GetStatus()
+	case httputil.StatusError:
+		s = e.Status
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+	var code codes.Code
+	switch s {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		code = codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	default:
+		code = codes.Internal
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	trackerpb "github.com/uber/kraken/gen/go/proto/tracker"
+	"github.com/uber/kraken/lib/auth"
+	"github.com/uber/kraken/tracker/trackergrpc"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCGetMetaInfo(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		Config{}, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+	raw, err := mi.Serialize()
+	require.NoError(err)
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	resp, err := s.GRPCService().GetMetaInfo(context.Background(), &trackerpb.GetMetaInfoRequest{
+		Namespace: namespace,
+		Digest:    mi.Digest().String(),
+	})
+	require.NoError(err)
+	require.Equal(mi.InfoHash().Hex(), resp.InfoHash)
+	require.Equal(raw, resp.Metainfo)
+}
+
+func TestGRPCGetMetaInfoErrors(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		Config{}, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	namespace := core.TagFixture()
+	d := core.DigestFixture()
+
+	_, err := s.GRPCService().GetMetaInfo(context.Background(), &trackerpb.GetMetaInfoRequest{
+		Namespace: namespace,
+		Digest:    "not a digest",
+	})
+	require.Equal(codes.InvalidArgument, status.Code(err))
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, d).Return(
+		nil, httputil.StatusError{Status: http.StatusNotFound})
+
+	_, err = s.GRPCService().GetMetaInfo(context.Background(), &trackerpb.GetMetaInfoRequest{
+		Namespace: namespace,
+		Digest:    d.String(),
+	})
+	require.Equal(codes.NotFound, status.Code(err))
+}
+
+func TestGRPCAnnounce(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{AnnounceInterval: 5 * time.Second}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peer := core.PeerInfoFixture()
+	other := core.PeerInfoFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, peer).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{other}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	resp, err := s.GRPCService().Announce(context.Background(), &trackerpb.AnnounceRequest{
+		Namespace: core.NamespaceFixture(),
+		Digest:    blob.Digest.String(),
+		InfoHash:  h.Hex(),
+		Peer:      peerToProto(peer),
+	})
+	require.NoError(err)
+	require.Equal(int64(5000), resp.IntervalMs)
+	require.Len(resp.Peers, 1)
+	require.Equal(other.PeerID.String(), resp.Peers[0].PeerId)
+}
+
+func TestGRPCAnnounceRejectsDisallowedPort(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{PortValidation: PortValidationConfig{Enabled: true}}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	blob := core.NewBlobFixture()
+	peer := core.PeerInfoFixture()
+	peer.Port = 22
+
+	_, err := s.GRPCService().Announce(context.Background(), &trackerpb.AnnounceRequest{
+		Namespace: core.NamespaceFixture(),
+		Digest:    blob.Digest.String(),
+		InfoHash:  blob.MetaInfo.InfoHash().Hex(),
+		Peer:      peerToProto(peer),
+	})
+	require.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCAnnounceRateLimitsPeers(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{RateLimit: RateLimitConfig{Enabled: true, PeerPerSecond: 0.001, PeerBurst: 1}}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peer := core.PeerInfoFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, peer).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(nil, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	req := &trackerpb.AnnounceRequest{
+		Namespace: core.NamespaceFixture(),
+		Digest:    blob.Digest.String(),
+		InfoHash:  h.Hex(),
+		Peer:      peerToProto(peer),
+	}
+	_, err := s.GRPCService().Announce(context.Background(), req)
+	require.NoError(err)
+
+	_, err = s.GRPCService().Announce(context.Background(), req)
+	require.Equal(codes.ResourceExhausted, status.Code(err))
+}
+
+func TestGRPCScrape(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		Config{}, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	mocks.peerStore.EXPECT().EstimatePeerCount(h1).Return(3, 7, nil)
+	mocks.peerStore.EXPECT().EstimatePeerCount(h2).Return(0, 1, nil)
+
+	resp, err := s.GRPCService().Scrape(context.Background(), &trackerpb.ScrapeRequest{
+		InfoHashes: []string{h1.Hex(), h2.Hex()},
+	})
+	require.NoError(err)
+	require.Equal([]*trackerpb.SwarmStats{
+		{Seeders: 3, Leechers: 7},
+		{Seeders: 0, Leechers: 1},
+	}, resp.Stats)
+}
+
+func TestGRPCAuthorizeScopes(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Auth: authConfigFixture()}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	a := s.GRPCService().(trackergrpc.Authorizer)
+
+	withToken := func(scopes ...string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			"authorization", bearerHeader(t, "client", scopes...)["Authorization"]))
+	}
+
+	_, err := a.Authorize(context.Background(), "/tracker.Tracker/Scrape")
+	require.NoError(err)
+
+	_, err = a.Authorize(context.Background(), "/tracker.Tracker/Announce")
+	require.Equal(codes.Unauthenticated, status.Code(err))
+
+	ctx, err := a.Authorize(withToken(ScopeAnnounce), "/tracker.Tracker/Announce")
+	require.NoError(err)
+	require.Equal("client", auth.FromContext(ctx).Subject)
+
+	_, err = a.Authorize(withToken(ScopeAnnounce), "/tracker.Tracker/GetHostInfoHashes")
+	require.Equal(codes.PermissionDenied, status.Code(err))
+
+	_, err = a.Authorize(withToken(ScopeAdmin), "/tracker.Tracker/GetHostInfoHashes")
+	require.NoError(err)
+
+	_, err = a.Authorize(withToken(ScopeAnnounce), "/tracker.Tracker/Unknown")
+	require.Equal(codes.PermissionDenied, status.Code(err))
+}
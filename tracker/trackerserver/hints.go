@@ -0,0 +1,87 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// DistributionHintConfig defines configuration for the distribution hints
+// attached to metainfo responses.
+type DistributionHintConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MinConnections and MaxConnections bound the suggested number of
+	// connections per torrent, which otherwise follows the swarm size.
+	MinConnections int `yaml:"min_connections"`
+	MaxConnections int `yaml:"max_connections"`
+
+	// StallTimeout is the suggested stall timeout of blobs which are already
+	// seeded.
+	StallTimeout time.Duration `yaml:"stall_timeout"`
+
+	// ColdThroughput is the expected per-second rate at which origins fetch
+	// blobs from their storage backend. Blobs without seeders are suggested
+	// a longer stall timeout, since origins fetch the whole blob before
+	// seeding it.
+	ColdThroughput datasize.ByteSize `yaml:"cold_throughput"`
+}
+
+func (c DistributionHintConfig) applyDefaults() DistributionHintConfig {
+	if c.MinConnections == 0 {
+		c.MinConnections = 5
+	}
+	if c.MaxConnections == 0 {
+		c.MaxConnections = 20
+	}
+	if c.MaxConnections < c.MinConnections {
+		c.MaxConnections = c.MinConnections
+	}
+	if c.StallTimeout == 0 {
+		c.StallTimeout = 5 * time.Minute
+	}
+	if c.ColdThroughput == 0 {
+		c.ColdThroughput = 50 * datasize.MB
+	}
+	return c
+}
+
+// distributionHint suggests how peers should download a blob of the given
+// length, whose swarm has the given size.
+func (c DistributionHintConfig) distributionHint(
+	length int64, seeders, leechers int) *core.DistributionHint {
+
+	conns := seeders + leechers
+	if conns < c.MinConnections {
+		conns = c.MinConnections
+	}
+	if conns > c.MaxConnections {
+		conns = c.MaxConnections
+	}
+	stall := c.StallTimeout
+	if seeders == 0 {
+		stall += time.Duration(float64(length) / float64(c.ColdThroughput) * float64(time.Second))
+	}
+	return &core.DistributionHint{
+		Length:         length,
+		Seeders:        seeders,
+		Leechers:       leechers,
+		MaxConnections: conns,
+		StallTimeout:   stall,
+	}
+}
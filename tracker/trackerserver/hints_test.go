@@ -0,0 +1,57 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistributionHint(t *testing.T) {
+	config := DistributionHintConfig{
+		MinConnections: 5,
+		MaxConnections: 20,
+		StallTimeout:   time.Minute,
+		ColdThroughput: 10 * datasize.MB,
+	}.applyDefaults()
+
+	tests := []struct {
+		desc          string
+		length        int64
+		seeders       int
+		leechers      int
+		expectedConns int
+		expectedStall time.Duration
+	}{
+		{"small swarm", int64(100 * datasize.MB), 1, 1, 5, time.Minute},
+		{"medium swarm", int64(100 * datasize.MB), 4, 8, 12, time.Minute},
+		{"large swarm", int64(100 * datasize.MB), 50, 200, 20, time.Minute},
+		{"cold blob", int64(100 * datasize.MB), 0, 3, 5, time.Minute + 10*time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			hint := config.distributionHint(test.length, test.seeders, test.leechers)
+			require.Equal(test.length, hint.Length)
+			require.Equal(test.seeders, hint.Seeders)
+			require.Equal(test.leechers, hint.Leechers)
+			require.Equal(test.expectedConns, hint.MaxConnections)
+			require.Equal(test.expectedStall, hint.StallTimeout)
+		})
+	}
+}
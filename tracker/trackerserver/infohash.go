@@ -0,0 +1,154 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// _maxBatchInfoHashNames bounds the number of names resolved per request.
+const _maxBatchInfoHashNames = 1000
+
+// _batchInfoHashWorkers bounds the number of metainfo lookups per request
+// which run concurrently.
+const _batchInfoHashWorkers = 16
+
+// batchInfoHashRequest lists the names of blobs within Namespace to resolve.
+type batchInfoHashRequest struct {
+	Namespace string   `json:"namespace"`
+	Names     []string `json:"names"`
+}
+
+// batchInfoHashHandler returns the hex infohash of each name, such that clients
+// resolve every layer of an image in a single round trip. Names are blob
+// digests, either as hex or as "sha256:<hex>", given either as repeated name
+// query parameters along with a namespace query parameter, or as a json body.
+// Names of blobs which do not exist, or whose metainfo is still being
+// generated, are omitted from the response.
+func (s *Server) batchInfoHashHandler(w http.ResponseWriter, r *http.Request) error {
+	req := batchInfoHashRequest{
+		Namespace: r.URL.Query().Get("namespace"),
+		Names:     r.URL.Query()["name"],
+	}
+	if len(req.Names) == 0 {
+		if err := s.decodeBody(r, &req); err != nil {
+			return err
+		}
+	}
+	if req.Namespace == "" {
+		return handler.Errorf("namespace required").Status(http.StatusBadRequest)
+	}
+	if len(req.Names) == 0 {
+		return handler.Errorf("no names").Status(http.StatusBadRequest)
+	}
+	if len(req.Names) > _maxBatchInfoHashNames {
+		return handler.Errorf(
+			"%d names exceeds %d", len(req.Names), _maxBatchInfoHashNames).
+			Status(http.StatusBadRequest)
+	}
+	digests := make([]core.Digest, len(req.Names))
+	for i, name := range req.Names {
+		d, err := parseName(name)
+		if err != nil {
+			return handler.Errorf("parse name %q: %s", name, err).Status(http.StatusBadRequest)
+		}
+		digests[i] = d
+	}
+
+	hashes, err := s.resolveInfoHashes(r.Context(), req.Namespace, digests)
+	if err != nil {
+		if serr, ok := err.(httputil.StatusError); ok {
+			// Propagate errors received from origin.
+			return handler.Errorf("origin: %s", serr.ResponseDump).Status(serr.Status)
+		}
+		return err
+	}
+	s.stats.Counter("batch_infohash_names").Inc(int64(len(req.Names)))
+
+	resp := make(map[string]string, len(req.Names))
+	for i, name := range req.Names {
+		if hashes[i] != nil {
+			resp[name] = hashes[i].Hex()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// parseName parses a blob name, which is either a hex sha256 digest like
+// agents announce, or a full digest.
+func parseName(name string) (core.Digest, error) {
+	if strings.Contains(name, ":") {
+		return core.ParseSHA256Digest(name)
+	}
+	return core.NewSHA256DigestFromHex(name)
+}
+
+// resolveInfoHashes returns the infohash of each of digests, in order. The
+// infohashes of blobs which do not exist, or whose metainfo is not yet
+// available, are nil. Resolved torrents are restricted by namespace like
+// metainfo requests are.
+func (s *Server) resolveInfoHashes(
+	ctx context.Context, namespace string, digests []core.Digest) ([]*core.InfoHash, error) {
+
+	hashes := make([]*core.InfoHash, len(digests))
+	errs := make([]error, len(digests))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, _batchInfoHashWorkers)
+	for i := range digests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			mi, err := s.getMetaInfo(ctx, namespace, digests[i])
+			if err != nil {
+				if httputil.IsNotFound(err) || httputil.IsAccepted(err) {
+					return
+				}
+				errs[i] = err
+				return
+			}
+			h := mi.InfoHash()
+			s.tokens.Observe(namespace, h)
+			hashes[i] = &h
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			if _, ok := err.(httputil.StatusError); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("get metainfo of %s: %s", digests[i], err)
+		}
+	}
+	return hashes, nil
+}
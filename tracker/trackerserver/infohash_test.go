@@ -0,0 +1,195 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func decodeInfoHashes(t *testing.T, resp *http.Response) map[string]string {
+	defer resp.Body.Close()
+	var result map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	return result
+}
+
+func TestBatchInfoHashQueryParams(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	mi1 := core.MetaInfoFixture()
+	mi2 := core.MetaInfoFixture()
+	missing := core.DigestFixture()
+	pending := core.DigestFixture()
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi1.Digest()).Return(mi1, nil)
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi2.Digest()).Return(mi2, nil)
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, missing).Return(
+		nil, httputil.StatusError{Status: http.StatusNotFound})
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, pending).Return(
+		nil, httputil.StatusError{Status: http.StatusAccepted})
+
+	q := url.Values{}
+	q.Set("namespace", namespace)
+	q.Add("name", mi1.Digest().Hex())
+	q.Add("name", mi2.Digest().String())
+	q.Add("name", missing.Hex())
+	q.Add("name", pending.Hex())
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/infohash/batch?%s", addr, q.Encode()))
+	require.NoError(err)
+	require.Equal(map[string]string{
+		mi1.Digest().Hex():    mi1.InfoHash().Hex(),
+		mi2.Digest().String(): mi2.InfoHash().Hex(),
+	}, decodeInfoHashes(t, resp))
+}
+
+func TestBatchInfoHashJSONBody(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	body, err := json.Marshal(batchInfoHashRequest{
+		Namespace: namespace,
+		Names:     []string{mi.Digest().Hex()},
+	})
+	require.NoError(err)
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/infohash/batch", addr),
+		httputil.SendBody(bytes.NewReader(body)))
+	require.NoError(err)
+	require.Equal(map[string]string{
+		mi.Digest().Hex(): mi.InfoHash().Hex(),
+	}, decodeInfoHashes(t, resp))
+}
+
+func TestBatchInfoHashPropagatesOriginError(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	d := core.DigestFixture()
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, d).Return(
+		nil, httputil.StatusError{Status: 599})
+
+	q := url.Values{}
+	q.Set("namespace", namespace)
+	q.Add("name", d.Hex())
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/infohash/batch?%s", addr, q.Encode()))
+	require.True(httputil.IsStatus(err, 599))
+}
+
+func TestBatchInfoHashRestrictsTorrentsOfRestrictedNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{AnnounceToken: announcetoken.Config{
+		Enabled:    true,
+		Secret:     "some secret",
+		Namespaces: []string{"namespace-foo/.*"},
+	}})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.NamespaceFixture()
+	mi := core.MetaInfoFixture()
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	q := url.Values{}
+	q.Set("namespace", namespace)
+	q.Add("name", mi.Digest().Hex())
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/infohash/batch?%s", addr, q.Encode()))
+	require.NoError(err)
+	require.Equal(map[string]string{
+		mi.Digest().Hex(): mi.InfoHash().Hex(),
+	}, decodeInfoHashes(t, resp))
+
+	// Torrents resolved in a restricted namespace cannot be announced in
+	// another namespace without a token.
+	_, _, err = newAnnounceClient(core.PeerContextFixture(), addr).Announce(
+		"public/repo", mi.Digest(), mi.InfoHash(), false, announceclient.V2)
+	require.Error(err)
+	require.True(httputil.IsForbidden(err))
+}
+
+func TestBatchInfoHashBadRequests(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tooMany := url.Values{"namespace": {"foo"}}
+	for i := 0; i <= _maxBatchInfoHashNames; i++ {
+		tooMany.Add("name", core.DigestFixture().Hex())
+	}
+
+	tests := []struct {
+		desc  string
+		query url.Values
+		body  []byte
+	}{
+		{"missing namespace", url.Values{"name": {core.DigestFixture().Hex()}}, nil},
+		{"missing names", url.Values{"namespace": {"foo"}}, []byte("{}")},
+		{"invalid name", url.Values{"namespace": {"foo"}, "name": {"bar"}}, nil},
+		{"too many names", tooMany, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := httputil.Get(
+				fmt.Sprintf("http://%s/infohash/batch?%s", addr, test.query.Encode()),
+				httputil.SendBody(bytes.NewReader(test.body)))
+			require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// AdaptiveIntervalConfig defines scaling of the announce interval handed to
+// peers by the size and health of their swarm.
+type AdaptiveIntervalConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MinInterval is the shortest interval peers may announce at, which is
+	// returned to peers alongside the interval. Leechers which were handed out
+	// no seeders are told to announce at MinInterval, such that starving
+	// leechers find new seeders quickly. Values below _minIntervalFloor are
+	// raised to it, since every starving leecher in a swarm announces at it.
+	MinInterval time.Duration `yaml:"min_interval"`
+
+	// MaxInterval caps scaled intervals. Agents fall back to their default
+	// interval when handed intervals above their own max_interval, so
+	// MaxInterval must not exceed it.
+	MaxInterval time.Duration `yaml:"max_interval"`
+
+	// SwarmSize is the number of peers above which the interval grows in
+	// proportion to the swarm, e.g. swarms of twice SwarmSize peers announce
+	// at twice the base interval.
+	SwarmSize int `yaml:"swarm_size"`
+}
+
+// _minIntervalFloor bounds MinInterval, such that swarms without seeders cannot
+// be configured to flood trackers with announces.
+const _minIntervalFloor = time.Second
+
+func (c AdaptiveIntervalConfig) applyDefaults() AdaptiveIntervalConfig {
+	if c.MinInterval == 0 {
+		c.MinInterval = 2 * time.Second
+	}
+	if c.MinInterval < _minIntervalFloor {
+		c.MinInterval = _minIntervalFloor
+	}
+	if c.MaxInterval == 0 {
+		c.MaxInterval = 30 * time.Second
+	}
+	if c.SwarmSize == 0 {
+		c.SwarmSize = 100
+	}
+	return c
+}
+
+// announceInterval returns the interval peer, which was handed out peers,
+// should next announce at, and the shortest interval it may announce at, which
+// is zero if unbounded. swarmSize is the estimated number of peers in the
+// swarm, or negative if unknown.
+func (s *Server) announceInterval(
+	peer *core.PeerInfo, peers []*core.PeerInfo, swarmSize int) (interval, minInterval time.Duration) {
+
+	c := s.config.AdaptiveInterval
+	if !c.Enabled {
+		return s.config.AnnounceInterval, 0
+	}
+	if !peer.Complete && !hasSeeder(peers) {
+		s.stats.Counter("starving_announces").Inc(1)
+		return c.MinInterval, c.MinInterval
+	}
+	interval = s.config.AnnounceInterval
+	if swarmSize > c.SwarmSize {
+		interval = time.Duration(int64(interval) * int64(swarmSize) / int64(c.SwarmSize))
+	}
+	if interval < c.MinInterval {
+		interval = c.MinInterval
+	}
+	if interval > c.MaxInterval {
+		interval = c.MaxInterval
+	}
+	return interval, c.MinInterval
+}
+
+func hasSeeder(peers []*core.PeerInfo) bool {
+	for _, p := range peers {
+		if p.Complete || p.Origin {
+			return true
+		}
+	}
+	return false
+}
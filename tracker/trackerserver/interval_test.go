@@ -0,0 +1,116 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnounceAdaptiveInterval(t *testing.T) {
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+
+	tests := []struct {
+		desc      string
+		peers     []*core.PeerInfo
+		swarmSize int
+		expected  time.Duration
+	}{
+		{"small swarm", []*core.PeerInfo{seeder}, 10, 2 * time.Second},
+		{"large swarm", []*core.PeerInfo{seeder}, 400, 8 * time.Second},
+		{"capped", []*core.PeerInfo{seeder}, 10000, 30 * time.Second},
+		{"starving", []*core.PeerInfo{core.PeerInfoFixture()}, 400, 1500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, Config{
+				AnnounceInterval: 2 * time.Second,
+				AdaptiveInterval: AdaptiveIntervalConfig{
+					Enabled:     true,
+					MinInterval: 1500 * time.Millisecond,
+					MaxInterval: 30 * time.Second,
+					SwarmSize:   100,
+				},
+			})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			h := blob.MetaInfo.InfoHash()
+
+			pctx := core.PeerContextFixture()
+			client := newAnnounceClient(pctx, addr)
+
+			mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil)
+			mocks.peerStore.EXPECT().EstimatePeerCount(h).Return(test.swarmSize, 0, nil)
+			mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(test.peers, nil)
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+			_, interval, err := client.Announce(
+				core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+			require.NoError(err)
+			require.Equal(test.expected, interval)
+		})
+	}
+}
+
+func TestAdaptiveIntervalConfigRaisesMinIntervalToFloor(t *testing.T) {
+	require := require.New(t)
+
+	c := AdaptiveIntervalConfig{MinInterval: 100 * time.Millisecond}.applyDefaults()
+	require.Equal(_minIntervalFloor, c.MinInterval)
+}
+
+func TestAnnounceIntervalReturnsMinInterval(t *testing.T) {
+	require := require.New(t)
+
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+
+	mocks, cleanup := newServerMocks(t, Config{
+		AnnounceInterval: 3 * time.Second,
+		AdaptiveInterval: AdaptiveIntervalConfig{Enabled: true},
+	})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		mocks.config,
+		mocks.stats,
+		mocks.policy,
+		mocks.topology,
+		mocks.peerStore,
+		mocks.originStore,
+		mocks.originCluster)
+
+	interval, minInterval := s.announceInterval(core.PeerInfoFixture(), []*core.PeerInfo{seeder}, 10)
+	require.Equal(3*time.Second, interval)
+	require.Equal(2*time.Second, minInterval)
+
+	interval, minInterval = s.announceInterval(core.PeerInfoFixture(), nil, 10)
+	require.Equal(2*time.Second, interval)
+	require.Equal(2*time.Second, minInterval)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// maintenanceWindow describes when a host under maintenance returns to
+// rotation.
+type maintenanceWindow struct {
+	Host  string    `json:"host"`
+	Until time.Time `json:"until"`
+}
+
+// startMaintenanceHandler withholds a host from handouts for the duration
+// given by the "duration" query argument.
+func (s *Server) startMaintenanceHandler(w http.ResponseWriter, r *http.Request) error {
+	host, err := httputil.ParseParam(r, "host")
+	if err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(r.URL.Query().Get("duration"))
+	if err != nil {
+		return handler.Errorf("parse duration: %s", err).Status(http.StatusBadRequest)
+	}
+	if d <= 0 {
+		return handler.Errorf("duration must be positive").Status(http.StatusBadRequest)
+	}
+	until := s.maintenance.Start(host, d)
+	log.With("host", host, "until", until).Info("Host under maintenance")
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(maintenanceWindow{host, until}); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
+// endMaintenanceHandler returns a host to rotation.
+func (s *Server) endMaintenanceHandler(w http.ResponseWriter, r *http.Request) error {
+	host, err := httputil.ParseParam(r, "host")
+	if err != nil {
+		return err
+	}
+	if !s.maintenance.End(host) {
+		return handler.Errorf("host %s not under maintenance", host).Status(http.StatusNotFound)
+	}
+	log.With("host", host).Info("Host returned to rotation")
+	return nil
+}
+
+// listMaintenanceHandler returns all hosts under maintenance, sorted by when
+// they return to rotation.
+func (s *Server) listMaintenanceHandler(w http.ResponseWriter, r *http.Request) error {
+	windows := []maintenanceWindow{}
+	for host, until := range s.maintenance.List() {
+		windows = append(windows, maintenanceWindow{host, until})
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].Until.Before(windows[j].Until)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(windows); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceEndpoints(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err := httputil.Put(fmt.Sprintf("http://%s/hosts/agent-1/maintenance?duration=bad", addr))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	_, err = httputil.Put(fmt.Sprintf("http://%s/hosts/agent-1/maintenance?duration=-1m", addr))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	resp, err := httputil.Put(fmt.Sprintf("http://%s/hosts/agent-1/maintenance?duration=1h", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var started maintenanceWindow
+	require.NoError(json.NewDecoder(resp.Body).Decode(&started))
+	require.Equal("agent-1", started.Host)
+
+	resp, err = httputil.Get(fmt.Sprintf("http://%s/maintenance", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var windows []maintenanceWindow
+	require.NoError(json.NewDecoder(resp.Body).Decode(&windows))
+	require.Len(windows, 1)
+	require.Equal("agent-1", windows[0].Host)
+
+	_, err = httputil.Delete(fmt.Sprintf("http://%s/hosts/agent-1/maintenance", addr))
+	require.NoError(err)
+
+	_, err = httputil.Delete(fmt.Sprintf("http://%s/hosts/agent-1/maintenance", addr))
+	require.True(httputil.IsStatus(err, http.StatusNotFound))
+}
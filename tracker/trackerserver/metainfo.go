@@ -14,11 +14,19 @@
 package trackerserver
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/tracker/metainfostore"
+	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
 )
 
 func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) error {
@@ -32,7 +40,17 @@ func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) erro
 	}
 
 	timer := s.stats.Timer("get_metainfo").Start()
-	mi, err := s.originCluster.GetMetaInfo(namespace, d)
+	start := time.Now()
+	mi, err := s.getMetaInfo(r.Context(), namespace, d)
+	if s.traces.traced(core.InfoHash{}, d) {
+		s.stats.Counter("traced_requests").Inc(1)
+		logger := log.With("digest", d, "namespace", namespace, "duration", time.Since(start))
+		if err != nil {
+			logger.Infof("Traced metainfo request failed: %s", err)
+		} else {
+			logger.With("hash", mi.InfoHash()).Info("Traced metainfo request")
+		}
+	}
 	if err != nil {
 		if serr, ok := err.(httputil.StatusError); ok {
 			// Propagate errors received from origin.
@@ -42,11 +60,185 @@ func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) erro
 	}
 	timer.Stop()
 
+	// Restrict torrents by the namespace their metainfo was requested in, so
+	// that agents cannot skip tokens by announcing in another namespace.
+	s.tokens.Observe(namespace, mi.InfoHash())
+
 	b, err := mi.Serialize()
 	if err != nil {
 		return fmt.Errorf("serialize metainfo: %s", err)
 	}
+	if s.config.DistributionHints.Enabled {
+		s.attachDistributionHint(w, mi)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(b)
+	if _, err := w.Write(b); err != nil {
+		return errutil.Wrap(err, "write metainfo", d.Hex())
+	}
+	return nil
+}
+
+// getMetaInfo returns the metainfo of d, from the metainfo store if enabled,
+// else from origins. Metainfo fetched from origins is stored.
+func (s *Server) getMetaInfo(
+	ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error) {
+
+	if s.metaInfos == nil {
+		return s.getOriginMetaInfo(ctx, namespace, d)
+	}
+	span, _ := s.startSpan(ctx, "metainfostore.get", core.InfoHash{}, d)
+	mi, err := s.metaInfos.Get(d)
+	if err == nil {
+		span.Finish()
+		s.stats.Counter("metainfo_store_hits").Inc(1)
+		return mi, nil
+	}
+	if err != metainfostore.ErrNotFound {
+		failSpan(span, err)
+		log.With("digest", d).Errorf("Error getting metainfo from store: %s", err)
+		s.countStorageError(storeMetaInfos, "get")
+	}
+	span.Finish()
+	s.stats.Counter("metainfo_store_misses").Inc(1)
+	mi, err = s.getOriginMetaInfo(ctx, namespace, d)
+	if err != nil {
+		return nil, err
+	}
+	span, _ = s.startSpan(ctx, "metainfostore.put", mi.InfoHash(), d)
+	err = s.metaInfos.Put(mi)
+	finishSpan(span, err)
+	if err != nil {
+		log.With("digest", d).Errorf("Error storing metainfo: %s", err)
+		s.countStorageError(storeMetaInfos, "put")
+	}
+	return mi, nil
+}
+
+// getOriginMetaInfo fetches the metainfo of d from origins. Blobs unknown to
+// origins, or whose metainfo is still being generated, are not storage errors.
+func (s *Server) getOriginMetaInfo(
+	ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error) {
+
+	span, _ := s.startSpan(ctx, "origin.get_metainfo", core.InfoHash{}, d)
+	defer span.Finish()
+
+	mi, err := s.originCluster.GetMetaInfo(namespace, d)
+	if err != nil && !httputil.IsNotFound(err) && !httputil.IsAccepted(err) {
+		s.countStorageError(storeOrigin, "get_metainfo")
+		failSpan(span, err)
+	}
+	return mi, err
+}
+
+// putMetaInfoHandler stores the metainfo in the request body, if the metainfo
+// store accepts uploads.
+func (s *Server) putMetaInfoHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.metaInfos == nil || !s.config.MetaInfoStore.AllowUploads {
+		return handler.Errorf("metainfo uploads disabled").Status(http.StatusForbidden)
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return handler.Errorf("parse digest: %s", err).Status(http.StatusBadRequest)
+	}
+	b, err := s.readBody(r)
+	if err != nil {
+		return err
+	}
+	mi, err := core.DeserializeMetaInfo(b)
+	if err != nil {
+		return handler.Errorf("deserialize metainfo: %s", err).Status(http.StatusBadRequest)
+	}
+	if mi.Digest() != d {
+		return handler.Errorf(
+			"metainfo digest %s does not match %s", mi.Digest(), d).
+			Status(http.StatusBadRequest)
+	}
+	if err := s.metaInfos.Put(mi); err != nil {
+		s.countStorageError(storeMetaInfos, "put")
+		return handler.Errorf("store metainfo: %s", err)
+	}
+	s.stats.Counter("metainfo_uploads").Inc(1)
+	return nil
+}
+
+// getMetaInfoByInfoHashHandler returns the stored metainfo of an infohash.
+// Unlike metainfo requested by digest, metainfo is never fetched from origins,
+// since origins cannot look up blobs by infohash.
+func (s *Server) getMetaInfoByInfoHashHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.metaInfos == nil {
+		return handler.Errorf("metainfo store disabled").Status(http.StatusNotFound)
+	}
+	infohash, err := httputil.ParseParam(r, "infohash")
+	if err != nil {
+		return err
+	}
+	h, err := core.NewInfoHashFromHex(infohash)
+	if err != nil {
+		return handler.Errorf("parse infohash: %s", err).Status(http.StatusBadRequest)
+	}
+	mi, err := s.metaInfos.GetByInfoHash(h)
+	if err != nil {
+		if err == metainfostore.ErrNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		s.countStorageError(storeMetaInfos, "get_by_infohash")
+		return handler.Errorf("get metainfo: %s", err)
+	}
+	b, err := mi.Serialize()
+	if err != nil {
+		return fmt.Errorf("serialize metainfo: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		return errutil.Wrap(err, "write metainfo", h.Hex())
+	}
+	return nil
+}
+
+// attachDistributionHint sets the distribution hint of mi on w. Hints are
+// advisory, so failures are logged rather than returned.
+func (s *Server) attachDistributionHint(w http.ResponseWriter, mi *core.MetaInfo) {
+	seeders, leechers, err := s.peerStore.EstimatePeerCount(mi.InfoHash())
+	if err != nil {
+		log.With("hash", mi.InfoHash()).Errorf("Error estimating peer count for hint: %s", err)
+		return
+	}
+	hint := s.config.DistributionHints.distributionHint(mi.Length(), seeders, leechers)
+	b, err := json.Marshal(hint)
+	if err != nil {
+		log.Errorf("Error marshalling distribution hint: %s", err)
+		return
+	}
+	w.Header().Set(metainfoclient.DistributionHintHeader, string(b))
+	s.stats.Counter("distribution_hints").Inc(1)
+}
+
+// getBundleHandler returns the bundle of the small blobs of an image, built by
+// the origins owning its manifest.
+func (s *Server) getBundleHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return handler.Errorf("parse digest: %s", err).Status(http.StatusBadRequest)
+	}
+	index, err := s.originCluster.GetBundle(namespace, d)
+	if err != nil {
+		if serr, ok := err.(httputil.StatusError); ok {
+			if !httputil.IsNotFound(err) && !httputil.IsAccepted(err) {
+				s.countStorageError(storeOrigin, "get_bundle")
+			}
+			// Propagate errors received from origin.
+			return handler.Errorf("origin: %s", serr.ResponseDump).Status(serr.Status)
+		}
+		s.countStorageError(storeOrigin, "get_bundle")
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(index); err != nil {
+		return errutil.Wrap(err, "write bundle index", d.Hex())
+	}
 	return nil
 }
@@ -14,12 +14,18 @@
 package trackerserver
 
 import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/tracker/metainfostore"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/testutil"
 
@@ -72,3 +78,221 @@ func TestGetMetaInfoHandlerPropagatesOriginError(t *testing.T) {
 	require.Error(err)
 	require.True(httputil.IsStatus(err, 599))
 }
+
+func TestGetMetaInfoHandlerAttachesDistributionHint(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{DistributionHints: DistributionHintConfig{Enabled: true}}
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+	mocks.peerStore.EXPECT().EstimatePeerCount(mi.InfoHash()).Return(3, 4, nil)
+
+	client := newMetaInfoClient(addr).(metainfoclient.HintClient)
+
+	result, hint, err := client.DownloadWithHint(namespace, mi.Digest())
+	require.NoError(err)
+	require.Equal(mi, result)
+	require.Equal(&core.DistributionHint{
+		Length:         mi.Length(),
+		Seeders:        3,
+		Leechers:       4,
+		MaxConnections: 7,
+		StallTimeout:   5 * time.Minute,
+	}, hint)
+}
+
+func TestGetMetaInfoHandlerOmitsHintWhenDisabled(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	client := newMetaInfoClient(addr).(metainfoclient.HintClient)
+
+	_, hint, err := client.DownloadWithHint(namespace, mi.Digest())
+	require.NoError(err)
+	require.Nil(hint)
+}
+
+func TestGetMetaInfoHandlerServesFromStore(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{MetaInfoStore: metainfostore.Config{Enabled: true}}
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	// Only fetched from origin once.
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	client := newMetaInfoClient(addr)
+
+	for i := 0; i < 2; i++ {
+		result, err := client.Download(namespace, mi.Digest())
+		require.NoError(err)
+		require.Equal(mi, result)
+	}
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/infohashes/%s/metainfo", addr, mi.InfoHash().Hex()))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var b bytes.Buffer
+	_, err = b.ReadFrom(resp.Body)
+	require.NoError(err)
+	result, err := core.DeserializeMetaInfo(b.Bytes())
+	require.NoError(err)
+	require.Equal(mi, result)
+}
+
+func TestPutMetaInfoHandler(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{MetaInfoStore: metainfostore.Config{Enabled: true, AllowUploads: true}}
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+	other := core.MetaInfoFixture()
+
+	raw, err := mi.Serialize()
+	require.NoError(err)
+
+	_, err = httputil.Put(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/metainfo", addr, url.PathEscape(namespace), other.Digest()),
+		httputil.SendBody(bytes.NewReader(raw)))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	_, err = httputil.Put(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/metainfo", addr, url.PathEscape(namespace), mi.Digest()),
+		httputil.SendBody(bytes.NewReader([]byte("not metainfo"))))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	_, err = httputil.Put(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/metainfo", addr, url.PathEscape(namespace), mi.Digest()),
+		httputil.SendBody(bytes.NewReader(raw)))
+	require.NoError(err)
+
+	// Served without asking origins.
+	result, err := newMetaInfoClient(addr).Download(namespace, mi.Digest())
+	require.NoError(err)
+	require.Equal(mi, result)
+}
+
+func TestPutMetaInfoHandlerRejectsUploadsUnlessAllowed(t *testing.T) {
+	for _, config := range []Config{
+		{},
+		{MetaInfoStore: metainfostore.Config{Enabled: true}},
+	} {
+		require := require.New(t)
+
+		mocks, cleanup := newServerMocks(t, config)
+		defer cleanup()
+
+		addr, stop := testutil.StartServer(mocks.handler())
+		defer stop()
+
+		mi := core.MetaInfoFixture()
+		raw, err := mi.Serialize()
+		require.NoError(err)
+
+		u := fmt.Sprintf(
+			"http://%s/namespace/%s/blobs/%s/metainfo",
+			addr, url.PathEscape(core.NamespaceFixture()), mi.Digest())
+		_, err = httputil.Put(u, httputil.SendBody(bytes.NewReader(raw)))
+		require.True(httputil.IsForbidden(err))
+	}
+}
+
+func TestGetMetaInfoByInfoHashHandlerNotFound(t *testing.T) {
+	for _, config := range []Config{
+		{},
+		{MetaInfoStore: metainfostore.Config{Enabled: true}},
+	} {
+		require := require.New(t)
+
+		mocks, cleanup := newServerMocks(t, config)
+		defer cleanup()
+
+		addr, stop := testutil.StartServer(mocks.handler())
+		defer stop()
+
+		_, err := httputil.Get(
+			fmt.Sprintf("http://%s/infohashes/%s/metainfo", addr, core.InfoHashFixture().Hex()))
+		require.True(httputil.IsNotFound(err))
+	}
+}
+
+func TestGetBundleHandlerFetchesFromOrigin(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	manifest := core.DigestFixture()
+	index := &core.BundleIndex{
+		Digest: core.DigestFixture(),
+		Entries: []core.BundleEntry{
+			{Digest: core.DigestFixture(), Offset: 100, Length: 10},
+			{Digest: core.DigestFixture(), Offset: 110, Length: 20},
+		},
+	}
+
+	mocks.originCluster.EXPECT().GetBundle(namespace, manifest).Return(index, nil)
+
+	client := newMetaInfoClient(addr).(metainfoclient.BundleClient)
+
+	result, err := client.GetBundle(namespace, manifest)
+	require.NoError(err)
+	require.Equal(index, result)
+}
+
+func TestGetBundleHandlerImageNotBundled(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	manifest := core.DigestFixture()
+
+	mocks.originCluster.EXPECT().GetBundle(
+		namespace, manifest).Return(nil, httputil.StatusError{Status: http.StatusNotFound})
+
+	client := newMetaInfoClient(addr).(metainfoclient.BundleClient)
+
+	_, err := client.GetBundle(namespace, manifest)
+	require.Equal(metainfoclient.ErrNotFound, err)
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"github.com/uber-go/tally"
+)
+
+// Storages the tracker depends on, by which storage errors are tagged.
+const (
+	storePeers     = "peerstore"
+	storeOrigins   = "originstore"
+	storeOrigin    = "origin"
+	storeMetaInfos = "metainfo_store"
+)
+
+var _handoutSizeBuckets = tally.MustMakeLinearValueBuckets(0, 5, 21)
+
+// countStorageError counts a failed operation of store.
+func (s *Server) countStorageError(store, op string) {
+	s.stats.Tagged(map[string]string{
+		"store":     store,
+		"operation": op,
+	}).Counter("storage_errors").Inc(1)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"github.com/uber/kraken/core"
+)
+
+// preferNetworks returns copies of peers which share a preferred network with
+// requester, addressed solely by their IP on the most preferred shared network
+// of a usable family. Other peers are returned unchanged. Also returns the
+// number of peers addressed by network.
+func (s *Server) preferNetworks(
+	peers []*core.PeerInfo,
+	requester *core.PeerInfo,
+	usable []string) ([]*core.PeerInfo, int) {
+
+	if len(s.config.PreferredNetworks) == 0 || len(requester.Networks) == 0 {
+		return peers, 0
+	}
+	result := make([]*core.PeerInfo, len(peers))
+	var n int
+	for i, p := range peers {
+		result[i] = p
+		for _, label := range s.config.PreferredNetworks {
+			if _, ok := requester.Networks[label]; !ok {
+				continue
+			}
+			ip, ok := p.Networks[label]
+			if !ok || !familyUsable(usable, core.AddressFamily(ip)) {
+				continue
+			}
+			c := *p
+			c.IP = ip
+			c.IPv6 = ""
+			c.Networks = nil
+			result[i] = &c
+			n++
+			break
+		}
+	}
+	return result, n
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// PeerCacheConfig defines the read-through cache of peer lists in front of the
+// peer store, which spares the peer store from every announce of a deploy
+// wave looking up the same torrent.
+type PeerCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is how long peer lists are cached. Peers which announce while a
+	// torrent is cached are only handed out once its entry expires.
+	TTL time.Duration `yaml:"ttl"`
+
+	// MaxSize is the maximum number of torrents cached. The least recently
+	// used torrents are evicted first.
+	MaxSize int `yaml:"max_size"`
+}
+
+func (c PeerCacheConfig) applyDefaults() PeerCacheConfig {
+	if c.TTL == 0 {
+		c.TTL = 5 * time.Second
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = 10000
+	}
+	return c
+}
+
+type peerCacheEntry struct {
+	h       core.InfoHash
+	peers   []*core.PeerInfo
+	expires time.Time
+}
+
+// peerCache is an in-memory LRU cache of the peers of torrents.
+type peerCache struct {
+	config PeerCacheConfig
+	stats  tally.Scope
+	clk    clock.Clock
+
+	mu      sync.Mutex
+	lru     *list.List // Of *peerCacheEntry, most recently used first.
+	entries map[core.InfoHash]*list.Element
+}
+
+func newPeerCache(config PeerCacheConfig, stats tally.Scope, clk clock.Clock) *peerCache {
+	return &peerCache{
+		config:  config.applyDefaults(),
+		stats:   stats.SubScope("peer_cache"),
+		clk:     clk,
+		lru:     list.New(),
+		entries: make(map[core.InfoHash]*list.Element),
+	}
+}
+
+// get returns the cached peers of h. The returned slice is owned by the
+// caller.
+func (c *peerCache) get(h core.InfoHash) ([]*core.PeerInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[h]
+	if !ok {
+		c.stats.Counter("misses").Inc(1)
+		return nil, false
+	}
+	entry := e.Value.(*peerCacheEntry)
+	if !c.clk.Now().Before(entry.expires) {
+		c.remove(e)
+		c.stats.Counter("misses").Inc(1)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	c.stats.Counter("hits").Inc(1)
+	return append([]*core.PeerInfo(nil), entry.peers...), true
+}
+
+// set caches peers as the peers of h.
+func (c *peerCache) set(h core.InfoHash, peers []*core.PeerInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[h]; ok {
+		c.remove(e)
+	}
+	entry := &peerCacheEntry{
+		h:       h,
+		peers:   append([]*core.PeerInfo(nil), peers...),
+		expires: c.clk.Now().Add(c.config.TTL),
+	}
+	c.entries[h] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.config.MaxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+// evict removes h from c.
+func (c *peerCache) evict(h core.InfoHash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[h]; ok {
+		c.remove(e)
+	}
+}
+
+// remove must be called with c.mu held.
+func (c *peerCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*peerCacheEntry).h)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestPeerCacheExpiresEntries(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	c := newPeerCache(PeerCacheConfig{TTL: time.Second}, tally.NoopScope, clk)
+
+	h := core.InfoHashFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture(), core.PeerInfoFixture()}
+
+	_, ok := c.get(h)
+	require.False(ok)
+
+	c.set(h, peers)
+
+	result, ok := c.get(h)
+	require.True(ok)
+	require.Equal(peers, result)
+
+	clk.Add(time.Second)
+
+	_, ok = c.get(h)
+	require.False(ok)
+}
+
+func TestPeerCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	require := require.New(t)
+
+	c := newPeerCache(PeerCacheConfig{MaxSize: 2}, tally.NoopScope, clock.NewMock())
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+	h3 := core.InfoHashFixture()
+
+	c.set(h1, nil)
+	c.set(h2, nil)
+	_, ok := c.get(h1)
+	require.True(ok)
+	c.set(h3, nil)
+
+	_, ok = c.get(h2)
+	require.False(ok)
+	_, ok = c.get(h1)
+	require.True(ok)
+	_, ok = c.get(h3)
+	require.True(ok)
+
+	c.evict(h1)
+	_, ok = c.get(h1)
+	require.False(ok)
+}
+
+func TestPeerCacheReturnsCopies(t *testing.T) {
+	require := require.New(t)
+
+	c := newPeerCache(PeerCacheConfig{}, tally.NoopScope, clock.NewMock())
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	peers := []*core.PeerInfo{p}
+	c.set(h, peers)
+	peers[0] = core.PeerInfoFixture()
+
+	// Announces append origins to, and reorder, the peers they get.
+	result, _ := c.get(h)
+	result[0] = core.PeerInfoFixture()
+
+	result, _ = c.get(h)
+	require.Equal([]*core.PeerInfo{p}, result)
+}
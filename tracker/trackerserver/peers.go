@@ -0,0 +1,98 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+func (s *Server) peerIndex() (peerstore.PeerIndex, error) {
+	i, ok := s.peerStore.(peerstore.PeerIndex)
+	if !ok {
+		return nil, handler.Errorf("%s", peerstore.ErrNoPeerIndex).Status(http.StatusNotImplemented)
+	}
+	return i, nil
+}
+
+func peerIndexError(err error) error {
+	if err == peerstore.ErrNoPeerIndex {
+		return handler.Errorf("%s", err).Status(http.StatusNotImplemented)
+	}
+	return handler.Errorf("peer index: %s", err)
+}
+
+// hostInfoHashesHandler returns the infohashes which a host recently
+// announced for.
+func (s *Server) hostInfoHashesHandler(w http.ResponseWriter, r *http.Request) error {
+	host, err := httputil.ParseParam(r, "host")
+	if err != nil {
+		return err
+	}
+	i, err := s.peerIndex()
+	if err != nil {
+		return err
+	}
+	hashes, err := i.GetInfoHashesByHost(host)
+	if err != nil {
+		return peerIndexError(err)
+	}
+	resp := make([]string, len(hashes))
+	for j, h := range hashes {
+		resp[j] = h.Hex()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
+// zonePeersHandler returns the peers within a zone which recently announced
+// for an infohash.
+func (s *Server) zonePeersHandler(w http.ResponseWriter, r *http.Request) error {
+	infohash, err := httputil.ParseParam(r, "infohash")
+	if err != nil {
+		return err
+	}
+	h, err := core.NewInfoHashFromHex(infohash)
+	if err != nil {
+		return handler.Errorf("parse infohash: %s", err).Status(http.StatusBadRequest)
+	}
+	zone, err := httputil.ParseParam(r, "zone")
+	if err != nil {
+		return err
+	}
+	i, err := s.peerIndex()
+	if err != nil {
+		return err
+	}
+	peers, err := i.GetPeersByZone(h, zone)
+	if err != nil {
+		return peerIndexError(err)
+	}
+	if peers == nil {
+		peers = []*core.PeerInfo{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(peers); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
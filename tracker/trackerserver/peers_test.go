@@ -0,0 +1,81 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerIndexEndpoints(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	store := peerstore.NewLocalStore(peerstore.LocalConfig{}, clock.New())
+	defer store.Close()
+
+	s := newTestServer(
+		t,
+		mocks.config, mocks.stats, mocks.policy, mocks.topology, store, mocks.originStore, mocks.originCluster)
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	p.Zone = "zone1"
+	require.NoError(store.UpdatePeer(h, p))
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/hosts/%s/infohashes", addr, p.IP))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var hashes []string
+	require.NoError(json.NewDecoder(resp.Body).Decode(&hashes))
+	require.Equal([]string{h.Hex()}, hashes)
+
+	resp, err = httputil.Get(
+		fmt.Sprintf("http://%s/infohashes/%s/zones/zone1/peers", addr, h.Hex()))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var peers []*core.PeerInfo
+	require.NoError(json.NewDecoder(resp.Body).Decode(&peers))
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestPeerIndexEndpointsUnsupportedStore(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/hosts/localhost/infohashes", addr))
+	require.True(httputil.IsStatus(err, http.StatusNotImplemented))
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/uber/kraken/utils/handler"
+
+	"gopkg.in/yaml.v2"
+)
+
+// PolicyStage is a stage of the peer handout pipeline, along with the
+// parameters it applies to announces of a namespace.
+type PolicyStage struct {
+	Stage   string                 `json:"stage"`
+	Enabled bool                   `json:"enabled"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+}
+
+// PolicyResponse defines the response of GET /admin/policy. Stages are listed
+// in the order they apply. Stage names match the stages of handout previews.
+type PolicyResponse struct {
+	Namespace string        `json:"namespace"`
+	Stages    []PolicyStage `json:"stages"`
+}
+
+// policyHandler returns the handout policy which applies to announces of the
+// namespace query argument, with defaults applied and per-namespace overrides
+// resolved.
+func (s *Server) policyHandler(w http.ResponseWriter, r *http.Request) error {
+	resp, err := s.resolvePolicy(r.URL.Query().Get("namespace"))
+	if err != nil {
+		return handler.Errorf("resolve policy: %s", err)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) resolvePolicy(namespace string) (*PolicyResponse, error) {
+	// Optional stages are nil if disabled.
+	var freshness, egress, sharding, coLocation, throughput, load, origins interface{}
+	if s.freshness != nil {
+		freshness = s.freshness.Config()
+	}
+	if s.egress != nil {
+		c := s.egress.Config()
+		weights, override := s.egress.Weights(namespace)
+		params := map[string]interface{}{
+			"min_local_seeders": c.MinLocalSeeders,
+			"weights": map[string]interface{}{
+				"cross_zone": weights.CrossZone,
+				"cross_dc":   weights.CrossDC,
+				"origin":     weights.Origin,
+			},
+		}
+		if override != "" {
+			params["namespace_override"] = override
+		}
+		egress = params
+	}
+	if s.sharding != nil {
+		sharding = s.sharding.Config()
+	}
+	if s.coLocation != nil {
+		coLocation = s.coLocation.Config()
+	}
+	if s.throughput != nil {
+		throughput = s.throughput.Config()
+	}
+	if s.load != nil {
+		load = s.load.Config()
+	}
+	if s.origins != nil {
+		origins = s.origins.Config()
+	}
+
+	// Stages are parameterized either by a map, or by the config they apply.
+	stages := []struct {
+		name    string
+		enabled bool
+		params  interface{}
+	}{
+		{"announce_token", s.tokens.Restricted(namespace), nil},
+		{"peerstore", true, map[string]interface{}{
+			"announce_limit":       s.config.PeerHandoutLimit,
+			"seeder_handout_limit": s.config.SeederHandoutLimit,
+		}},
+		{"deterministic", s.config.DeterministicHandout.Enabled, s.config.DeterministicHandout},
+		{"priority", true, map[string]interface{}{"policy": s.policy.Name()}},
+		{"freshness", freshness != nil, freshness},
+		{"egress", egress != nil, egress},
+		{"maintenance", true, s.maintenance.Config()},
+		{"sharding", sharding != nil, sharding},
+		{"co_location", coLocation != nil, coLocation},
+		{"network", len(s.config.PreferredNetworks) > 0, map[string]interface{}{
+			"preferred_networks": s.config.PreferredNetworks,
+		}},
+		{"address_family", true, map[string]interface{}{
+			"address_families": s.config.AddressFamilies,
+		}},
+		{"addressing", true, map[string]interface{}{
+			"handout_addressing": s.config.HandoutAddressing,
+		}},
+		{"throughput", throughput != nil, throughput},
+		{"load", load != nil, load},
+		{"origin_capacity", origins != nil, origins},
+	}
+
+	resp := &PolicyResponse{Namespace: namespace}
+	for _, st := range stages {
+		stage := PolicyStage{Stage: st.name, Enabled: st.enabled}
+		if st.enabled && st.params != nil {
+			params, ok := st.params.(map[string]interface{})
+			if !ok {
+				var err error
+				params, err = configParams(st.params)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", st.name, err)
+				}
+			}
+			stage.Params = params
+		}
+		resp.Stages = append(resp.Stages, stage)
+	}
+	return resp, nil
+}
+
+// configParams returns the fields of config keyed by their yaml names, such
+// that parameters read like the configuration operators write. The enabled
+// field is omitted, since it is reported by the stage.
+func configParams(config interface{}) (map[string]interface{}, error) {
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %s", err)
+	}
+	var params map[string]interface{}
+	if err := yaml.Unmarshal(b, &params); err != nil {
+		return nil, fmt.Errorf("unmarshal: %s", err)
+	}
+	delete(params, "enabled")
+	for k, v := range params {
+		params[k] = jsonValue(v)
+	}
+	return params, nil
+}
+
+// jsonValue converts the nested maps yaml decodes, which are keyed by
+// arbitrary values, into maps json can encode.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getPolicy(t *testing.T, addr, namespace string) map[string]PolicyStage {
+	resp, err := httputil.Get("http://" + addr + "/admin/policy?namespace=" + namespace)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var policy PolicyResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&policy))
+	require.Equal(t, namespace, policy.Namespace)
+
+	stages := make(map[string]PolicyStage)
+	for _, s := range policy.Stages {
+		stages[s.Stage] = s
+	}
+	return stages
+}
+
+func TestPolicyHandlerResolvesNamespaceOverrides(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{
+		Egress: peerhandoutpolicy.EgressConfig{
+			Enabled: true,
+			Namespaces: []peerhandoutpolicy.NamespaceEgressWeights{{
+				Namespace: "^free/.*",
+				Weights:   peerhandoutpolicy.EgressWeights{CrossZone: 0, CrossDC: 2},
+			}},
+		},
+		OriginCapacity: peerhandoutpolicy.OriginCapacityConfig{Enabled: true},
+	})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	stages := getPolicy(t, addr, "free/foo")
+
+	egress := stages["egress"]
+	require.True(egress.Enabled)
+	require.Equal("^free/.*", egress.Params["namespace_override"])
+	require.Equal(map[string]interface{}{
+		"cross_zone": 0.0,
+		"cross_dc":   2.0,
+		"origin":     0.0,
+	}, egress.Params["weights"])
+
+	stages = getPolicy(t, addr, "paid/foo")
+
+	egress = stages["egress"]
+	require.NotContains(egress.Params, "namespace_override")
+	require.Equal(map[string]interface{}{
+		"cross_zone": 1.0,
+		"cross_dc":   10.0,
+		"origin":     5.0,
+	}, egress.Params["weights"])
+
+	// Defaults are applied.
+	origins := stages["origin_capacity"]
+	require.True(origins.Enabled)
+	require.Equal(50.0, origins.Params["max_leechers"])
+	require.Equal((10 * time.Second).String(), origins.Params["interval"])
+	require.NotContains(origins.Params, "enabled")
+
+	require.False(stages["sharding"].Enabled)
+	require.Nil(stages["sharding"].Params)
+	require.Equal("default", stages["priority"].Params["policy"])
+}
+
+func TestPolicyHandlerOrdersStagesByHandoutPipeline(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	resp, err := httputil.Get("http://" + addr + "/admin/policy")
+	require.NoError(err)
+	defer resp.Body.Close()
+	var policy PolicyResponse
+	require.NoError(json.NewDecoder(resp.Body).Decode(&policy))
+
+	var names []string
+	for _, s := range policy.Stages {
+		names = append(names, s.Stage)
+	}
+	require.Equal([]string{
+		"announce_token",
+		"peerstore",
+		"deterministic",
+		"priority",
+		"freshness",
+		"egress",
+		"maintenance",
+		"sharding",
+		"co_location",
+		"network",
+		"address_family",
+		"addressing",
+		"throughput",
+		"load",
+		"origin_capacity",
+	}, names)
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"fmt"
+
+	"github.com/uber/kraken/utils/netutil"
+)
+
+// _minUnprivilegedPort is the lowest port which processes may bind without
+// elevated privileges.
+const _minUnprivilegedPort = 1024
+
+// PortValidationConfig defines validation of the ports peers announce.
+type PortValidationConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Allowed lists port ranges, e.g. "16000-16999" or "80", which announced
+	// ports must fall within. If empty, any unprivileged port is allowed.
+	// Privileged ports are only allowed if listed explicitly.
+	Allowed []string `yaml:"allowed"`
+}
+
+// portValidator rejects announces of peers listening on disallowed ports.
+type portValidator struct {
+	allowed []netutil.PortRange
+}
+
+// newPortValidator returns an error if any allowed range is invalid, since
+// silently dropping a range could reject every peer, or allow privileged ports
+// if all ranges are dropped.
+func newPortValidator(config PortValidationConfig) (*portValidator, error) {
+	v := &portValidator{}
+	for _, s := range config.Allowed {
+		r, err := netutil.ParsePortRange(s)
+		if err != nil {
+			return nil, fmt.Errorf("allowed port range: %s", err)
+		}
+		v.allowed = append(v.allowed, r)
+	}
+	return v, nil
+}
+
+func (v *portValidator) validate(port int) error {
+	if port <= 0 {
+		return fmt.Errorf("port %d is not a listening port", port)
+	}
+	if len(v.allowed) == 0 {
+		if port < _minUnprivilegedPort {
+			return fmt.Errorf("privileged port %d is not allowed", port)
+		}
+		return nil
+	}
+	for _, r := range v.allowed {
+		if r.Contains(port) {
+			return nil
+		}
+	}
+	return fmt.Errorf("port %d is not within allowed ranges", port)
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortValidator(t *testing.T) {
+	tests := []struct {
+		desc    string
+		allowed []string
+		port    int
+		valid   bool
+	}{
+		{"zero", nil, 0, false},
+		{"privileged", nil, 80, false},
+		{"unprivileged", nil, 16000, true},
+		{"allowlisted privileged", []string{"80"}, 80, true},
+		{"within range", []string{"16000-16999"}, 16500, true},
+		{"outside range", []string{"16000-16999"}, 17000, false},
+		{"zero despite ranges", []string{"1-65535"}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			v, err := newPortValidator(PortValidationConfig{Enabled: true, Allowed: test.allowed})
+			require.NoError(t, err)
+			err = v.validate(test.port)
+			if test.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidPortRanges(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{
+		PortValidation: PortValidationConfig{
+			Enabled: true,
+			Allowed: []string{"x", "16000-16999"},
+		},
+	})
+	defer cleanup()
+
+	_, err := New(
+		mocks.config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+	require.Error(t, err)
+}
+
+func TestAnnounceRejectsDisallowedPort(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{
+		PortValidation: PortValidationConfig{Enabled: true},
+	})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	peer := core.PeerInfoFixture()
+	peer.Port = 80
+
+	body, err := json.Marshal(&announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: h,
+		Peer:     peer,
+	})
+	require.NoError(t, err)
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/announce/%s", addr, h.Hex()),
+		httputil.SendBody(bytes.NewReader(body)))
+	require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// HandoutDecision describes a single decision taken while computing a handout.
+type HandoutDecision struct {
+	Stage  string `json:"stage"`
+	Detail string `json:"detail"`
+}
+
+// PreviewPeer is a peer which would be handed out, along with the priority
+// label assigned to it by the handout policy and the reasons it was chosen.
+type PreviewPeer struct {
+	*core.PeerInfo
+	Priority string   `json:"priority"`
+	Reasons  []string `json:"reasons"`
+}
+
+// PreviewResponse defines the response of an announce preview.
+type PreviewResponse struct {
+	Peers     []PreviewPeer     `json:"peers"`
+	Stale     bool              `json:"stale"`
+	Decisions []HandoutDecision `json:"decisions"`
+}
+
+// handoutTrace records the decisions taken while computing a handout. A nil
+// handoutTrace is valid and records nothing.
+type handoutTrace struct {
+	decisions []HandoutDecision
+	labels    []string
+	spans     []traceSpan
+
+	// preview marks handouts which are only previewed, and therefore must not
+	// count against limits of the peers handed out.
+	preview bool
+}
+
+// traceSpan records how long a stage of a handout took.
+type traceSpan struct {
+	Stage    string        `json:"stage"`
+	Duration time.Duration `json:"duration"`
+}
+
+func (t *handoutTrace) record(stage string, format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.decisions = append(t.decisions, HandoutDecision{stage, fmt.Sprintf(format, args...)})
+}
+
+func (t *handoutTrace) isPreview() bool {
+	return t != nil && t.preview
+}
+
+// span records the duration of stage, which started at start.
+func (t *handoutTrace) span(stage string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.spans = append(t.spans, traceSpan{stage, time.Since(start)})
+}
+
+func (t *handoutTrace) recordLabels(labels []string) {
+	if t == nil {
+		return
+	}
+	t.labels = labels
+}
+
+// explainPeer returns the reasons p was handed out, given the priority label
+// assigned to it by the handout policy.
+func explainPeer(p *core.PeerInfo, label string, stale bool) []string {
+	var reasons []string
+	switch {
+	case p.Origin:
+		reasons = append(reasons, "origin")
+	case p.Complete:
+		reasons = append(reasons, "seeder")
+	default:
+		reasons = append(reasons, "leecher")
+	}
+	if stale && !p.Origin {
+		reasons = append(reasons, "stale")
+	}
+	return append(reasons, "priority:"+label)
+}
+
+// previewHandler runs the handout pipeline for a synthetic peer without
+// writing to the peer store, answering "what would this peer be told to
+// connect to?". Previews of torrents which require announce tokens require an
+// admin token, since previews reveal peers just like announces do.
+func (s *Server) previewHandler(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+
+	h, err := core.NewInfoHashFromHex(q.Get("infohash"))
+	if err != nil {
+		return handler.Errorf("parse infohash: %s", err).Status(http.StatusBadRequest)
+	}
+	if s.tokens.RestrictedTorrent(q.Get("namespace"), h) {
+		if _, err := s.checkAdmin(r); err != nil {
+			return err
+		}
+	}
+	d, err := core.ParseSHA256Digest(q.Get("digest"))
+	if err != nil {
+		return handler.Errorf("parse digest: %s", err).Status(http.StatusBadRequest)
+	}
+	peer, err := parsePreviewPeer(r)
+	if err != nil {
+		return handler.Errorf("parse peer: %s", err).Status(http.StatusBadRequest)
+	}
+
+	trace := &handoutTrace{preview: true}
+	peers, stale, err := s.getPeerHandout(
+		r.Context(), q.Get("namespace"), d, h, peer, announceclient.CurrentProtocol,
+		parseFamilies(q.Get("address_families")), trace)
+	if err != nil {
+		return err
+	}
+	resp := PreviewResponse{
+		Peers:     make([]PreviewPeer, len(peers)),
+		Stale:     stale,
+		Decisions: trace.decisions,
+	}
+	for i, p := range peers {
+		resp.Peers[i] = PreviewPeer{p, trace.labels[i], explainPeer(p, trace.labels[i], stale)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
+// parsePreviewPeer builds the synthetic requesting peer from query args. If
+// no peer_id is supplied, one is derived from ip and port. hostname and zone
+// locate the peer for topology-aware policies.
+func parsePreviewPeer(r *http.Request) (*core.PeerInfo, error) {
+	ip := httputil.GetQueryArg(r, "ip", "127.0.0.1")
+	port, err := strconv.Atoi(httputil.GetQueryArg(r, "port", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("port: %s", err)
+	}
+	complete, err := strconv.ParseBool(httputil.GetQueryArg(r, "complete", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("complete: %s", err)
+	}
+	var peerID core.PeerID
+	if raw := r.URL.Query().Get("peer_id"); raw != "" {
+		peerID, err = core.NewPeerID(raw)
+	} else {
+		peerID, err = core.HashedPeerID(fmt.Sprintf("%s:%d", ip, port))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("peer id: %s", err)
+	}
+	p := core.NewPeerInfo(peerID, ip, port, false, complete)
+	p.Hostname = r.URL.Query().Get("hostname")
+	p.Zone = r.URL.Query().Get("zone")
+	p.Rack = r.URL.Query().Get("rack")
+	p.DC = r.URL.Query().Get("dc")
+	return p, nil
+}
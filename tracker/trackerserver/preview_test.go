@@ -0,0 +1,126 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnouncePreviewDoesNotUpdatePeerStore(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+	origins := []*core.PeerInfo{core.OriginPeerInfoFixture()}
+
+	// No UpdatePeer expectation: the preview must not write.
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(peers, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
+
+	resp, err := httputil.Get(fmt.Sprintf(
+		"http://%s/announce/preview?infohash=%s&digest=%s&ip=10.0.0.1&port=8080",
+		addr, h.Hex(), blob.Digest))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var result PreviewResponse
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Len(result.Peers, 2)
+	for _, p := range result.Peers {
+		require.Equal("default", p.Priority)
+	}
+	require.Equal([]string{"leecher", "priority:default"}, result.Peers[0].Reasons)
+	require.Equal([]string{"origin", "priority:default"}, result.Peers[1].Reasons)
+	require.False(result.Stale)
+
+	var stages []string
+	for _, d := range result.Decisions {
+		stages = append(stages, d.Stage)
+	}
+	require.Equal([]string{"peerstore", "originstore"}, stages)
+}
+
+func TestAnnouncePreviewInvalidArgs(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	h := core.InfoHashFixture()
+	d := core.DigestFixture()
+
+	for _, query := range []string{
+		fmt.Sprintf("digest=%s", d),
+		fmt.Sprintf("infohash=%s", h.Hex()),
+		fmt.Sprintf("infohash=%s&digest=%s&port=abc", h.Hex(), d),
+	} {
+		t.Run(query, func(t *testing.T) {
+			_, err := httputil.Get(fmt.Sprintf("http://%s/announce/preview?%s", addr, query))
+			require.True(t, httputil.IsStatus(err, 400))
+		})
+	}
+}
+
+func TestAnnouncePreviewOfRestrictedTorrentRequiresAdminToken(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		AnnounceToken: announcetoken.Config{
+			Enabled:    true,
+			Secret:     "some secret",
+			Namespaces: []string{"namespace-foo/.*"},
+		},
+		Admin: AdminConfig{Tokens: map[string]string{"ops": "secret"}},
+	}
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	preview := fmt.Sprintf(
+		"http://%s/announce/preview?namespace=%s&infohash=%s&digest=%s",
+		addr, url.QueryEscape(core.NamespaceFixture()), h.Hex(), blob.Digest.Hex())
+
+	_, err := httputil.Get(preview)
+	require.True(httputil.IsStatus(err, http.StatusUnauthorized))
+
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(nil, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	_, err = httputil.Get(preview, httputil.SendHeaders(map[string]string{AdminTokenHeader: "secret"}))
+	require.NoError(err)
+}
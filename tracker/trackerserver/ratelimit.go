@@ -0,0 +1,235 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitConfig defines token bucket rate limits of announce and metainfo
+// requests, such that agents stuck in tight announce loops cannot saturate
+// the tracker. Negative rates disable the corresponding limit.
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// PeerPerSecond is the sustained rate of announces of each peer id. Since
+	// agents announce every torrent they download separately, this must
+	// allow for many concurrent torrents per agent.
+	PeerPerSecond float64 `yaml:"peer_per_second"`
+
+	// PeerBurst is the number of announces each peer id may send at once.
+	PeerBurst int `yaml:"peer_burst"`
+
+	// IPPerSecond is the sustained rate of announce and metainfo requests
+	// from each source IP, across all peers sharing the IP.
+	IPPerSecond float64 `yaml:"ip_per_second"`
+
+	// IPBurst is the number of requests each source IP may send at once.
+	IPBurst int `yaml:"ip_burst"`
+}
+
+func (c RateLimitConfig) applyDefaults() RateLimitConfig {
+	if c.PeerPerSecond == 0 {
+		c.PeerPerSecond = 20
+	}
+	if c.PeerBurst == 0 {
+		c.PeerBurst = 100
+	}
+	if c.IPPerSecond == 0 {
+		c.IPPerSecond = 50
+	}
+	if c.IPBurst == 0 {
+		c.IPBurst = 200
+	}
+	return c
+}
+
+type keyLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// keyedLimiter holds a token bucket per key, forgetting keys once their
+// buckets are full again.
+type keyedLimiter struct {
+	limit rate.Limit
+	burst int
+	ttl   time.Duration
+
+	keys      map[string]*keyLimiter
+	lastSweep time.Time
+}
+
+func newKeyedLimiter(perSecond float64, burst int) *keyedLimiter {
+	if perSecond < 0 || burst <= 0 {
+		return nil
+	}
+	// Buckets of keys idle for ttl have refilled, so forgetting them does not
+	// change which requests are limited.
+	ttl := time.Duration(float64(burst) / perSecond * float64(time.Second))
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+	return &keyedLimiter{
+		limit: rate.Limit(perSecond),
+		burst: burst,
+		ttl:   ttl,
+		keys:  make(map[string]*keyLimiter),
+	}
+}
+
+// reserve records a request of key at now. If key exceeded its limit, the
+// request is not recorded and the duration until it would be allowed is
+// returned instead.
+func (l *keyedLimiter) reserve(key string, now time.Time) (ok bool, wait time.Duration) {
+	l.sweep(now)
+	k, ok := l.keys[key]
+	if !ok {
+		k = &keyLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.keys[key] = k
+	}
+	k.lastSeen = now
+	r := k.limiter.ReserveN(now, 1)
+	if wait = r.DelayFrom(now); wait == 0 {
+		return true, 0
+	}
+	r.CancelAt(now)
+	return false, wait
+}
+
+// sweep forgets keys which have been idle for ttl.
+func (l *keyedLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, k := range l.keys {
+		if now.Sub(k.lastSeen) >= l.ttl {
+			delete(l.keys, key)
+		}
+	}
+}
+
+// rateLimiter enforces RateLimitConfig.
+type rateLimiter struct {
+	stats tally.Scope
+	clk   clock.Clock
+
+	mu    sync.Mutex
+	peers *keyedLimiter // Nil if peers are unlimited.
+	ips   *keyedLimiter // Nil if IPs are unlimited.
+}
+
+func newRateLimiter(config RateLimitConfig, stats tally.Scope, clk clock.Clock) *rateLimiter {
+	config = config.applyDefaults()
+	return &rateLimiter{
+		stats: stats.SubScope("rate_limit"),
+		clk:   clk,
+		peers: newKeyedLimiter(config.PeerPerSecond, config.PeerBurst),
+		ips:   newKeyedLimiter(config.IPPerSecond, config.IPBurst),
+	}
+}
+
+// allowPeer returns 429 with Retry-After if peerID exceeded its limit.
+func (l *rateLimiter) allowPeer(peerID string) error {
+	return l.allow(l.peers, "peer", peerID)
+}
+
+// allowIP returns 429 with Retry-After if ip exceeded its limit.
+func (l *rateLimiter) allowIP(ip string) error {
+	return l.allow(l.ips, "ip", ip)
+}
+
+func (l *rateLimiter) allow(limiter *keyedLimiter, kind, key string) error {
+	if limiter == nil || key == "" {
+		return nil
+	}
+	l.mu.Lock()
+	ok, wait := limiter.reserve(key, l.clk.Now())
+	l.mu.Unlock()
+	if ok {
+		return nil
+	}
+	l.stats.Tagged(map[string]string{"key": kind}).Counter("rejected").Inc(1)
+	retryAfter := int64(math.Ceil(wait.Seconds()))
+	return handler.Errorf(
+		"rate limit of %s %s exceeded, retry after %ds", kind, key, retryAfter).
+		Status(http.StatusTooManyRequests).
+		Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+}
+
+// sourceIP returns the IP r was sent from. Requests proxied by a local nginx
+// carry the IP of the client in X-Real-IP. Returns empty string if unknown.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() {
+		if real := net.ParseIP(r.Header.Get("X-Real-IP")); real != nil {
+			return real.String()
+		}
+	}
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// rateLimit wraps h such that requests exceeding the limit of their source IP
+// are rejected. Requests are served unconditionally if rate limiting is
+// disabled.
+func (s *Server) rateLimit(h handler.ErrHandler) handler.ErrHandler {
+	if s.rateLimiter == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err := s.rateLimiter.allowIP(sourceIP(r)); err != nil {
+			return err
+		}
+		return h(w, r)
+	}
+}
+
+// limitPeer rejects announces of peerID exceeding its limit.
+func (s *Server) limitPeer(peerID string) error {
+	if s.rateLimiter == nil {
+		return nil
+	}
+	return s.rateLimiter.allowPeer(peerID)
+}
+
+// limitAnnounce rejects announces of peerID from ip exceeding either limit.
+// Used by transports other than HTTP, whose requests bypass rateLimit.
+func (s *Server) limitAnnounce(peerID, ip string) error {
+	if s.rateLimiter == nil {
+		return nil
+	}
+	if err := s.rateLimiter.allowIP(ip); err != nil {
+		return err
+	}
+	return s.rateLimiter.allowPeer(peerID)
+}
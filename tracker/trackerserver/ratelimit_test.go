@@ -0,0 +1,227 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestRateLimiterPerPeer(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	l := newRateLimiter(RateLimitConfig{
+		PeerPerSecond: 1,
+		PeerBurst:     2,
+	}, tally.NoopScope, clk)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(l.allowPeer("a"))
+	}
+	err := l.allowPeer("a")
+	requireStatus(t, http.StatusTooManyRequests, err)
+
+	// Other peers have their own buckets.
+	require.NoError(l.allowPeer("b"))
+
+	clk.Add(time.Second)
+	require.NoError(l.allowPeer("a"))
+}
+
+func TestRateLimiterRetryAfter(t *testing.T) {
+	require := require.New(t)
+
+	l := newRateLimiter(RateLimitConfig{
+		IPPerSecond: 0.1,
+		IPBurst:     1,
+	}, tally.NoopScope, clock.NewMock())
+
+	require.NoError(l.allowIP("10.0.0.1"))
+	err := l.allowIP("10.0.0.1")
+	requireStatus(t, http.StatusTooManyRequests, err)
+	require.Contains(err.Error(), "retry after 10s")
+}
+
+func TestRateLimiterRejectedRequestsAreNotCounted(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	l := newRateLimiter(RateLimitConfig{
+		PeerPerSecond: 1,
+		PeerBurst:     1,
+	}, tally.NoopScope, clk)
+
+	require.NoError(l.allowPeer("a"))
+	for i := 0; i < 10; i++ {
+		require.Error(l.allowPeer("a"))
+	}
+	clk.Add(time.Second)
+	require.NoError(l.allowPeer("a"))
+}
+
+func TestRateLimiterNegativeRateDisablesLimit(t *testing.T) {
+	require := require.New(t)
+
+	l := newRateLimiter(RateLimitConfig{
+		PeerPerSecond: -1,
+		IPPerSecond:   1,
+		IPBurst:       1,
+	}, tally.NoopScope, clock.NewMock())
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(l.allowPeer("a"))
+	}
+	require.NoError(l.allowIP("10.0.0.1"))
+	require.Error(l.allowIP("10.0.0.1"))
+}
+
+func TestRateLimiterSweepsIdleKeys(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	l := newRateLimiter(RateLimitConfig{
+		PeerPerSecond: 1,
+		PeerBurst:     10,
+	}, tally.NoopScope, clk)
+
+	require.NoError(l.allowPeer("a"))
+	require.Len(l.peers.keys, 1)
+
+	clk.Add(time.Minute)
+	require.NoError(l.allowPeer("b"))
+	require.Len(l.peers.keys, 1)
+}
+
+func TestSourceIP(t *testing.T) {
+	tests := []struct {
+		desc       string
+		remoteAddr string
+		realIP     string
+		expected   string
+	}{
+		{"remote addr", "10.0.0.1:1234", "", "10.0.0.1"},
+		{"remote addr ignores real ip", "10.0.0.1:1234", "10.0.0.2", "10.0.0.1"},
+		{"loopback proxy", "127.0.0.1:1234", "10.0.0.2", "10.0.0.2"},
+		{"loopback without real ip", "127.0.0.1:1234", "", "127.0.0.1"},
+		{"unix socket", "@", "10.0.0.2", "10.0.0.2"},
+		{"unix socket without real ip", "@", "", ""},
+		{"ipv6", "[2001:db8::1]:1234", "", "2001:db8::1"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			r, err := http.NewRequest("GET", "/announce", nil)
+			require.NoError(t, err)
+			r.RemoteAddr = test.remoteAddr
+			if test.realIP != "" {
+				r.Header.Set("X-Real-IP", test.realIP)
+			}
+			require.Equal(t, test.expected, sourceIP(r))
+		})
+	}
+}
+
+func TestAnnounceRateLimitedPerPeer(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{
+		RateLimit: RateLimitConfig{
+			Enabled:       true,
+			PeerPerSecond: 0.01,
+			PeerBurst:     1,
+		},
+	})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peer := core.PeerInfoFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, gomock.Any()).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(
+		[]*core.PeerInfo{core.PeerInfoFixture()}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	announce := func(peer *core.PeerInfo) error {
+		body, err := json.Marshal(&announceclient.Request{
+			Digest:   &blob.Digest,
+			InfoHash: h,
+			Peer:     peer,
+		})
+		require.NoError(err)
+		_, err = httputil.Post(
+			fmt.Sprintf("http://%s/announce/%s", addr, h.Hex()),
+			httputil.SendBody(bytes.NewReader(body)))
+		return err
+	}
+
+	require.NoError(announce(peer))
+
+	err := announce(peer)
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+	require.Equal("100", err.(httputil.StatusError).Header.Get("Retry-After"))
+}
+
+func TestMetaInfoRateLimitedPerIP(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{
+		RateLimit: RateLimitConfig{
+			Enabled:     true,
+			IPPerSecond: 0.01,
+			IPBurst:     1,
+		},
+	})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	metainfo := fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s/metainfo", addr, url.PathEscape(namespace), blob.Digest)
+
+	_, err := httputil.Get(metainfo, httputil.SendHeaders(map[string]string{"X-Real-IP": "10.0.0.1"}))
+	require.NoError(err)
+
+	// Requests of other IPs are still served.
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, blob.Digest).Return(blob.MetaInfo, nil)
+	_, err = httputil.Get(metainfo, httputil.SendHeaders(map[string]string{"X-Real-IP": "10.0.0.2"}))
+	require.NoError(err)
+
+	_, err = httputil.Get(metainfo, httputil.SendHeaders(map[string]string{"X-Real-IP": "10.0.0.1"}))
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+}
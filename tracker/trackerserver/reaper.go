@@ -0,0 +1,87 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"time"
+
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/randutil"
+)
+
+// Reap deletes expired peers from the peer store every configured interval,
+// plus a random jitter, such that expired peers, and torrents and hosts left
+// without peers, are removed without an operator calling the compaction
+// endpoint. Blocks until Stop is called if reaping is enabled and the peer
+// store supports deleting expired peers, else returns immediately.
+func (s *Server) Reap() {
+	if !s.config.Reaper.Enabled {
+		return
+	}
+	d, ok := s.peerStore.(peerstore.ExpiredPeerDeleter)
+	if !ok {
+		log.Warn("Skipping reaper: peer store does not support deleting expired peers")
+		return
+	}
+	for {
+		timer := s.clk.Timer(s.reapDelay())
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			// Wrapped stores only report whether the underlying store
+			// supports deletion once called.
+			if _, err := s.reapOnce(d); err == peerstore.ErrNoExpiredPeerDeletion {
+				log.Warn("Stopping reaper: peer store does not support deleting expired peers")
+				return
+			}
+		}
+	}
+}
+
+// reapDelay returns the delay before the next reap. Jitter spreads the reaps
+// of trackers sharing a peer store, which would otherwise scan it
+// at once after being deployed together.
+func (s *Server) reapDelay() time.Duration {
+	c := s.config.Reaper
+	if c.Jitter <= 0 {
+		return c.Interval
+	}
+	return c.Interval + randutil.Duration(c.Jitter)
+}
+
+// reapOnce deletes the expired peers of d once, returning the number of keys
+// removed.
+func (s *Server) reapOnce(d peerstore.ExpiredPeerDeleter) (int, error) {
+	start := s.clk.Now()
+	removed, err := d.DeleteExpiredPeers()
+	if err == peerstore.ErrNoExpiredPeerDeletion {
+		return 0, err
+	}
+	s.stats.Timer("reap_duration").Record(s.clk.Now().Sub(start))
+	// Stores may remove some keys before failing.
+	s.stats.Counter("peerstore_reaped_keys").Inc(int64(removed))
+	if err != nil {
+		s.stats.Counter("reap_failures").Inc(1)
+		log.Errorf("Error reaping peer store after removing %d keys: %s", removed, err)
+		return removed, err
+	}
+	s.stats.Counter("reaps").Inc(1)
+	if removed > 0 {
+		log.Infof("Reaped peer store: removed %d keys", removed)
+	}
+	return removed, nil
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReapOnceRemovesExpiredPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	clk := clock.NewMock()
+	store := peerstore.NewLocalStore(peerstore.LocalConfig{TTL: time.Minute}, clk)
+	defer store.Close()
+
+	s := newTestServer(
+		t,
+		Config{Reaper: ReaperConfig{Enabled: true}},
+		mocks.stats, mocks.policy, mocks.topology, store, mocks.originStore, mocks.originCluster)
+
+	expired := core.InfoHashFixture()
+	require.NoError(store.UpdatePeer(expired, core.PeerInfoFixture()))
+
+	clk.Add(2 * time.Minute)
+
+	live := core.InfoHashFixture()
+	require.NoError(store.UpdatePeer(live, core.PeerInfoFixture()))
+
+	removed, err := s.reapOnce(store)
+	require.NoError(err)
+	require.True(removed > 0)
+
+	usage, err := store.Usage()
+	require.NoError(err)
+	require.Equal(peerstore.KeyspaceUsage{Keys: 1, Records: 1}, usage["torrents"])
+
+	// Nothing left to reap.
+	removed, err = s.reapOnce(store)
+	require.NoError(err)
+	require.Equal(0, removed)
+}
+
+func TestReapReturnsForUnsupportedStore(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		Config{Reaper: ReaperConfig{Enabled: true}},
+		mocks.stats, mocks.policy, mocks.topology, mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	// Returns immediately instead of blocking forever.
+	s.Reap()
+}
+
+// countingDeleter counts deletions of expired peers of an embedded store.
+type countingDeleter struct {
+	peerstore.Store
+	deletions int32
+}
+
+func (d *countingDeleter) DeleteExpiredPeers() (int, error) {
+	atomic.AddInt32(&d.deletions, 1)
+	return 0, nil
+}
+
+func TestReapRunsEveryIntervalUntilStopped(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	store := &countingDeleter{Store: mocks.peerStore}
+
+	s := newTestServer(
+		t,
+		Config{Reaper: ReaperConfig{Enabled: true, Interval: time.Minute, Jitter: -1}},
+		mocks.stats, mocks.policy, mocks.topology, store, mocks.originStore, mocks.originCluster)
+	clk := clock.NewMock()
+	s.clk = clk
+
+	done := make(chan struct{})
+	go func() {
+		s.Reap()
+		close(done)
+	}()
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		clk.Add(time.Minute)
+		return atomic.LoadInt32(&store.deletions) >= 2
+	}))
+
+	s.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow("reaper did not stop")
+	}
+}
+
+// unsupportedDeleter wraps a store which cannot delete expired peers, like
+// the peer store wrappers do.
+type unsupportedDeleter struct {
+	peerstore.Store
+}
+
+func (unsupportedDeleter) DeleteExpiredPeers() (int, error) {
+	return 0, peerstore.ErrNoExpiredPeerDeletion
+}
+
+func TestReapStopsForUnsupportedWrappedStore(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		Config{Reaper: ReaperConfig{Enabled: true, Interval: time.Minute, Jitter: -1}},
+		mocks.stats, mocks.policy, mocks.topology, unsupportedDeleter{mocks.peerStore},
+		mocks.originStore, mocks.originCluster)
+	clk := clock.NewMock()
+	s.clk = clk
+
+	done := make(chan struct{})
+	go func() {
+		s.Reap()
+		close(done)
+	}()
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		clk.Add(time.Minute)
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}))
+}
+
+func TestReapDelayIsJittered(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		Config{Reaper: ReaperConfig{Enabled: true, Interval: time.Minute}},
+		mocks.stats, mocks.policy, mocks.topology, mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	for i := 0; i < 100; i++ {
+		d := s.reapDelay()
+		require.True(d >= time.Minute && d < 90*time.Second, "delay %s", d)
+	}
+}
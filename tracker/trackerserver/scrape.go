@@ -0,0 +1,137 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jackpal/bencode-go"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/handler"
+)
+
+// _maxScrapeInfoHashes bounds the number of torrents scraped per request.
+const _maxScrapeInfoHashes = 1000
+
+// scrapeFile is the bencoded stats of a single scraped torrent, as defined by
+// the BitTorrent scrape convention.
+type scrapeFile struct {
+	Complete   int `bencode:"complete"`
+	Downloaded int `bencode:"downloaded"`
+	Incomplete int `bencode:"incomplete"`
+}
+
+// scrapeResponse maps raw 20 byte infohashes to their stats.
+type scrapeResponse struct {
+	Files map[string]scrapeFile `bencode:"files"`
+}
+
+// batchScrapeRequest lists hex infohashes to scrape.
+type batchScrapeRequest struct {
+	InfoHashes []string `json:"info_hashes"`
+}
+
+// scrapeHandler returns the seeders, leechers and completed peers of each
+// info_hash query parameter. Infohashes may be given either as hex, or as
+// url-encoded raw bytes like BitTorrent clients send them.
+func (s *Server) scrapeHandler(w http.ResponseWriter, r *http.Request) error {
+	var hashes []core.InfoHash
+	for _, v := range r.URL.Query()["info_hash"] {
+		h, err := parseScrapeInfoHash(v)
+		if err != nil {
+			return handler.Errorf("parse info_hash: %s", err).Status(http.StatusBadRequest)
+		}
+		hashes = append(hashes, h)
+	}
+	return s.serveScrape(w, hashes)
+}
+
+// batchScrapeHandler is a variant of scrapeHandler which reads hex infohashes
+// from a json body, for batches which do not fit in a url.
+func (s *Server) batchScrapeHandler(w http.ResponseWriter, r *http.Request) error {
+	var req batchScrapeRequest
+	if err := s.decodeBody(r, &req); err != nil {
+		return err
+	}
+	hashes := make([]core.InfoHash, len(req.InfoHashes))
+	for i, v := range req.InfoHashes {
+		h, err := core.NewInfoHashFromHex(v)
+		if err != nil {
+			return handler.Errorf("parse infohash: %s", err).Status(http.StatusBadRequest)
+		}
+		hashes[i] = h
+	}
+	return s.serveScrape(w, hashes)
+}
+
+func parseScrapeInfoHash(v string) (core.InfoHash, error) {
+	var h core.InfoHash
+	if len(v) == len(h) {
+		copy(h[:], v)
+		return h, nil
+	}
+	return core.NewInfoHashFromHex(v)
+}
+
+func (s *Server) serveScrape(w http.ResponseWriter, hashes []core.InfoHash) error {
+	if len(hashes) == 0 {
+		return handler.Errorf("no infohashes").Status(http.StatusBadRequest)
+	}
+	if len(hashes) > _maxScrapeInfoHashes {
+		return handler.Errorf(
+			"%d infohashes exceeds %d", len(hashes), _maxScrapeInfoHashes).
+			Status(http.StatusBadRequest)
+	}
+	stats, err := s.scrape(hashes)
+	if err != nil {
+		return handler.Errorf("scrape: %s", err)
+	}
+	s.stats.Counter("scraped_infohashes").Inc(int64(len(hashes)))
+	resp := scrapeResponse{Files: make(map[string]scrapeFile, len(hashes))}
+	for i, h := range hashes {
+		resp.Files[string(h.Bytes())] = scrapeFile{
+			Complete:   stats[i].Seeders,
+			Downloaded: stats[i].Completed,
+			Incomplete: stats[i].Leechers,
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if err := bencode.Marshal(w, resp); err != nil {
+		return handler.Errorf("bencode response: %s", err)
+	}
+	return nil
+}
+
+// scrape returns the stats of each of hashes, in order. Stores which cannot
+// scrape are queried per torrent, and report no completed peers.
+func (s *Server) scrape(hashes []core.InfoHash) ([]peerstore.SwarmStats, error) {
+	if sc, ok := s.peerStore.(peerstore.Scraper); ok {
+		stats, err := sc.Scrape(hashes)
+		if err != peerstore.ErrNoScrape {
+			return stats, err
+		}
+	}
+	stats := make([]peerstore.SwarmStats, len(hashes))
+	for i, h := range hashes {
+		seeders, leechers, err := s.peerStore.EstimatePeerCount(h)
+		if err != nil {
+			return nil, fmt.Errorf("estimate peer count of %s: %s", h, err)
+		}
+		stats[i] = peerstore.SwarmStats{Seeders: seeders, Leechers: leechers}
+	}
+	return stats, nil
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/jackpal/bencode-go"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeScrapeResponse(t *testing.T, resp *http.Response) scrapeResponse {
+	defer resp.Body.Close()
+
+	// bencode cannot unmarshal into struct map values, so files are decoded
+	// generically.
+	v, err := bencode.Decode(resp.Body)
+	require.NoError(t, err)
+	files, ok := v.(map[string]interface{})["files"].(map[string]interface{})
+	require.True(t, ok)
+
+	result := scrapeResponse{Files: make(map[string]scrapeFile, len(files))}
+	for h, f := range files {
+		stats := f.(map[string]interface{})
+		result.Files[h] = scrapeFile{
+			Complete:   int(stats["complete"].(int64)),
+			Downloaded: int(stats["downloaded"].(int64)),
+			Incomplete: int(stats["incomplete"].(int64)),
+		}
+	}
+	return result
+}
+
+func TestScrape(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	store := peerstore.NewLocalStore(peerstore.LocalConfig{}, clock.New())
+	defer store.Close()
+
+	s := newTestServer(
+		t,
+		Config{}, mocks.stats, mocks.policy, mocks.topology,
+		store, mocks.originStore, mocks.originCluster)
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+	require.NoError(store.UpdatePeer(h1, seeder))
+	require.NoError(store.UpdatePeer(h1, core.PeerInfoFixture()))
+	require.NoError(store.UpdatePeer(h1, core.PeerInfoFixture()))
+
+	expected := scrapeResponse{Files: map[string]scrapeFile{
+		string(h1.Bytes()): {Complete: 1, Downloaded: 1, Incomplete: 2},
+		string(h2.Bytes()): {},
+	}}
+
+	t.Run("hex", func(t *testing.T) {
+		resp, err := httputil.Get(fmt.Sprintf(
+			"http://%s/scrape?info_hash=%s&info_hash=%s", addr, h1.Hex(), h2.Hex()))
+		require.NoError(err)
+		require.Equal(expected, decodeScrapeResponse(t, resp))
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		resp, err := httputil.Get(fmt.Sprintf(
+			"http://%s/scrape?info_hash=%s&info_hash=%s", addr,
+			url.QueryEscape(string(h1.Bytes())), url.QueryEscape(string(h2.Bytes()))))
+		require.NoError(err)
+		require.Equal(expected, decodeScrapeResponse(t, resp))
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		body, err := json.Marshal(batchScrapeRequest{
+			InfoHashes: []string{h1.Hex(), h2.Hex()},
+		})
+		require.NoError(err)
+		resp, err := httputil.Post(
+			fmt.Sprintf("http://%s/scrape", addr),
+			httputil.SendBody(bytes.NewReader(body)))
+		require.NoError(err)
+		require.Equal(expected, decodeScrapeResponse(t, resp))
+	})
+}
+
+func TestScrapeFallsBackToPeerCountEstimates(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	h := core.InfoHashFixture()
+
+	mocks.peerStore.EXPECT().EstimatePeerCount(h).Return(3, 4, nil)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/scrape?info_hash=%s", addr, h.Hex()))
+	require.NoError(err)
+	require.Equal(scrapeResponse{Files: map[string]scrapeFile{
+		string(h.Bytes()): {Complete: 3, Incomplete: 4},
+	}}, decodeScrapeResponse(t, resp))
+}
+
+func TestScrapeErrors(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	for _, query := range []string{"", "?info_hash=foo"} {
+		t.Run(query, func(t *testing.T) {
+			_, err := httputil.Get(fmt.Sprintf("http://%s/scrape%s", addr, query))
+			require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
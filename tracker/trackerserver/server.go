@@ -14,19 +14,29 @@
 package trackerserver
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof" // Registers /debug/pprof endpoints in http.DefaultServeMux.
+	"sync"
 
+	"github.com/andres-erbsen/clock"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pressly/chi"
 	chimiddleware "github.com/pressly/chi/middleware"
 	"github.com/uber-go/tally"
 
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/auth"
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+	"github.com/uber/kraken/tracker/fleet"
+	"github.com/uber/kraken/tracker/metainfostore"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/tracker/topology"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/listener"
 	"github.com/uber/kraken/utils/log"
@@ -40,8 +50,48 @@ type Server struct {
 	peerStore   peerstore.Store
 	originStore originstore.Store
 	policy      *peerhandoutpolicy.PriorityPolicy
+	topology    *topology.Map // Nil if no topology configured.
+	tokens      *announcetoken.Verifier
+	auth        *auth.Authenticator // Nil if authentication disabled.
+	tls         *tls.Config         // Nil if TLS is terminated by nginx.
+	fleet       *fleet.Registry
+	load        *peerhandoutpolicy.LoadTracker           // Nil if load-aware handout disabled.
+	throughput  *peerhandoutpolicy.ThroughputTracker     // Nil if throughput-weighted handout disabled.
+	freshness   *peerhandoutpolicy.FreshnessPolicy       // Nil if stale peers are handed out.
+	egress      *peerhandoutpolicy.EgressPolicy          // Nil if egress-aware handout disabled.
+	sharding    *peerhandoutpolicy.ShardingPolicy        // Nil if sharded handout disabled.
+	coLocation  *peerhandoutpolicy.CoLocationTracker     // Nil if co-location anti-affinity disabled.
+	admission   *admissionController                     // Nil if admission control disabled.
+	rateLimiter *rateLimiter                             // Nil if rate limiting disabled.
+	origins     *peerhandoutpolicy.OriginCapacityLimiter // Nil if origin capacity unlimited.
+	ports       *portValidator                           // Nil if port validation disabled.
+	usage       *usageAccountant                         // Nil if usage accounting disabled.
+	peers       *peerCache                               // Nil if peer lists are not cached.
+	maintenance *peerhandoutpolicy.MaintenanceList
+	traces      *tracedTorrents
+	tracer      opentracing.Tracer
+	metaInfos   metainfostore.Store // Nil if metainfo store disabled.
+	metrics     http.Handler        // Nil if metrics are not scraped from the server.
 
 	originCluster blobclient.ClusterClient
+
+	clk clock.Clock
+
+	readyOnce sync.Once
+	ready     chan struct{}
+	draining  int32
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithMetricsHandler configures the Server to serve metrics at /metrics using
+// h.
+func WithMetricsHandler(h http.Handler) Option {
+	return func(s *Server) { s.metrics = h }
 }
 
 // New creates a new Server.
@@ -49,47 +99,211 @@ func New(
 	config Config,
 	stats tally.Scope,
 	policy *peerhandoutpolicy.PriorityPolicy,
+	topo *topology.Map,
 	peerStore peerstore.Store,
 	originStore originstore.Store,
-	originCluster blobclient.ClusterClient) *Server {
+	originCluster blobclient.ClusterClient,
+	opts ...Option) (*Server, error) {
 
 	config = config.applyDefaults()
 
+	switch config.HandoutAddressing {
+	case AddressByIP, AddressByHostname, AddressByBoth:
+	default:
+		log.Warnf("Unknown handout addressing %q, handing out ips", config.HandoutAddressing)
+		config.HandoutAddressing = AddressByIP
+	}
+	for _, f := range config.AddressFamilies {
+		if f != core.IPv4 && f != core.IPv6 {
+			log.Warnf("Unknown address family %q, handing out ipv4 then ipv6", f)
+			config.AddressFamilies = []string{core.IPv4, core.IPv6}
+			break
+		}
+	}
+
 	stats = stats.Tagged(map[string]string{
 		"module": "trackerserver",
 	})
 
-	return &Server{
+	tokenOpts := []announcetoken.Option{announcetoken.WithStats(stats)}
+	if ts, ok := peerStore.(announcetoken.Store); ok {
+		tokenOpts = append(tokenOpts, announcetoken.WithStore(ts))
+	}
+	tokens, err := announcetoken.NewVerifier(config.AnnounceToken, clock.New(), tokenOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("announce token: %s", err)
+	}
+	s := &Server{
 		config:        config,
 		stats:         stats,
 		peerStore:     peerStore,
 		originStore:   originStore,
 		policy:        policy,
+		topology:      topo,
+		tokens:        tokens,
+		fleet:         fleet.NewRegistry(config.Fleet, clock.New()),
+		maintenance:   peerhandoutpolicy.NewMaintenanceList(config.Maintenance, clock.New()),
+		traces:        newTracedTorrents(config.Tracing, clock.New()),
+		tracer:        opentracing.GlobalTracer(),
 		originCluster: originCluster,
+		clk:           clock.New(),
+		ready:         make(chan struct{}),
+		stop:          make(chan struct{}),
+	}
+	if config.LoadAware.Enabled {
+		s.load = peerhandoutpolicy.NewLoadTracker(config.LoadAware, clock.New())
+	}
+	if config.Throughput.Enabled {
+		var opts []peerhandoutpolicy.ThroughputOption
+		if ts, ok := peerStore.(peerstore.ThroughputStore); ok {
+			opts = append(opts, peerhandoutpolicy.WithThroughputStore(ts))
+		}
+		s.throughput = peerhandoutpolicy.NewThroughputTracker(config.Throughput, clock.New(), opts...)
+	}
+	if config.Freshness.Enabled {
+		s.freshness = peerhandoutpolicy.NewFreshnessPolicy(config.Freshness, clock.New())
+	}
+	if config.Egress.Enabled {
+		s.egress = peerhandoutpolicy.NewEgressPolicy(config.Egress, topo)
+	}
+	if config.OriginCapacity.Enabled {
+		s.origins = peerhandoutpolicy.NewOriginCapacityLimiter(config.OriginCapacity, clock.New())
+	}
+	if config.Sharding.Enabled {
+		s.sharding = peerhandoutpolicy.NewShardingPolicy(config.Sharding)
+	}
+	if config.CoLocation.Enabled {
+		s.coLocation = peerhandoutpolicy.NewCoLocationTracker(config.CoLocation, clock.New())
+	}
+	if config.Auth.Enabled {
+		a, err := auth.New(config.Auth, stats, clock.New())
+		if err != nil {
+			return nil, fmt.Errorf("auth: %s", err)
+		}
+		s.auth = a
+	}
+	serverTLS, err := config.TLS.Build()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %s", err)
+	}
+	s.tls = serverTLS
+	if config.PortValidation.Enabled {
+		ports, err := newPortValidator(config.PortValidation)
+		if err != nil {
+			return nil, fmt.Errorf("port validation: %s", err)
+		}
+		s.ports = ports
 	}
+	if config.Usage.Enabled {
+		s.usage = newUsageAccountant(config.Usage, stats, clock.New())
+	}
+	if config.MetaInfoStore.Enabled {
+		s.metaInfos = metainfostore.NewLocalStore(config.MetaInfoStore, clock.New())
+	}
+	if config.Admission.Enabled {
+		s.admission = newAdmissionController(config.Admission, stats)
+	}
+	if config.RateLimit.Enabled {
+		s.rateLimiter = newRateLimiter(config.RateLimit, stats, clock.New())
+	}
+	if config.PeerCache.Enabled {
+		s.peers = newPeerCache(config.PeerCache, stats, clock.New())
+	}
+	if !config.WarmUp.Enabled {
+		s.readyOnce.Do(func() { close(s.ready) })
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Stop stops the background loops of s, e.g. the reaper.
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
 }
 
 // Handler an http handler for s.
 func (s *Server) Handler() http.Handler {
 	r := chi.NewRouter()
 
+	r.Use(middleware.RequestID)
+	r.Use(middleware.Trace(s.tracer))
 	r.Use(middleware.StatusCounter(s.stats))
 	r.Use(middleware.LatencyTimer(s.stats))
+	r.Use(middleware.RequestCounter(s.stats))
+	r.Use(middleware.ResponseSize(s.stats))
 
+	// Health checks are never subject to admission control, such that an
+	// overloaded tracker is not mistaken for a dead one.
 	r.Get("/health", handler.Wrap(s.healthHandler))
-	r.Get("/announce", handler.Wrap(s.announceHandlerV1))
-	r.Post("/announce/{infohash}", handler.Wrap(s.announceHandlerV2))
-	r.Get("/namespace/{namespace}/blobs/{digest}/metainfo", handler.Wrap(s.getMetaInfoHandler))
+	r.Get("/readiness", handler.Wrap(s.readinessHandler))
+	if s.metrics != nil {
+		r.Handle("/metrics", s.metrics)
+	}
 
-	r.Mount("/debug", chimiddleware.Profiler())
+	critical := func(method, pattern, scope string, h handler.ErrHandler) {
+		h = s.authorize(scope, h)
+		r.Method(method, pattern, s.admit(pattern, classCritical, handler.Wrap(h)))
+	}
+	// Catalog responses can be megabytes of json, so are compressed if
+	// enabled. Announce responses are never compressed.
+	compress := middleware.Compress(s.config.Compression, s.stats)
+	catalog := func(method, pattern, scope string, h handler.ErrHandler) {
+		h = s.authorize(scope, h)
+		r.Method(method, pattern, s.admit(pattern, classCatalog, compress(handler.Wrap(h))))
+	}
+
+	critical("GET", "/announce", ScopeAnnounce, s.rateLimit(s.announceHandlerV1))
+	catalog("GET", "/announce/preview", ScopeAdmin, s.previewHandler)
+	critical("POST", "/announce/{infohash}", ScopeAnnounce, s.rateLimit(s.announceHandlerV2))
+	critical("GET", "/namespace/{namespace}/blobs/{digest}/metainfo", ScopeAnnounce, s.rateLimit(s.getMetaInfoHandler))
+	catalog("PUT", "/namespace/{namespace}/blobs/{digest}/metainfo", ScopeMetaInfoWrite, s.putMetaInfoHandler)
+	critical("GET", "/infohashes/{infohash}/metainfo", ScopeAnnounce, s.rateLimit(s.getMetaInfoByInfoHashHandler))
+	critical("GET", "/namespace/{namespace}/blobs/{digest}/bundle", ScopeAnnounce, s.rateLimit(s.getBundleHandler))
+	critical("GET", "/infohash/batch", ScopeAnnounce, s.rateLimit(s.batchInfoHashHandler))
+	catalog("DELETE", "/infohash", ScopeAdmin, s.deleteInfoHashHandler)
+
+	catalog("GET", "/scrape", ScopeNone, s.scrapeHandler)
+	catalog("POST", "/scrape", ScopeNone, s.batchScrapeHandler)
+
+	critical("POST", "/agents/heartbeat", ScopeAnnounce, s.agentHeartbeatHandler)
+	catalog("GET", "/agents", ScopeNone, s.fleetOverviewHandler)
+	catalog("GET", "/usage", ScopeNone, s.usageHandler)
+
+	catalog("GET", "/hosts/{host}/infohashes", ScopeAdmin, s.hostInfoHashesHandler)
+	catalog("GET", "/maintenance", ScopeNone, s.listMaintenanceHandler)
+	catalog("PUT", "/hosts/{host}/maintenance", ScopeAdmin, s.startMaintenanceHandler)
+	catalog("DELETE", "/hosts/{host}/maintenance", ScopeAdmin, s.endMaintenanceHandler)
+	catalog("GET", "/infohashes/{infohash}/zones/{zone}/peers", ScopeAdmin, s.zonePeersHandler)
+
+	catalog("GET", "/admin/peerstore/usage", ScopeAdmin, s.peerStoreUsageHandler)
+	catalog("POST", "/admin/peerstore/compact", ScopeAdmin, s.peerStoreCompactHandler)
+	catalog("GET", "/admin/policy", ScopeAdmin, s.policyHandler)
+	catalog("GET", "/admin/traces", ScopeAdmin, s.listTracesHandler)
+	catalog("PUT", "/admin/traces/{target}", ScopeAdmin, s.startTraceHandler)
+	catalog("DELETE", "/admin/traces/{target}", ScopeAdmin, s.endTraceHandler)
+
+	catalog("GET", "/topology", ScopeNone, s.topologyHandler)
+	catalog("GET", "/topology/hosts/{host}", ScopeNone, s.hostLocationHandler)
+
+	profiler := chimiddleware.Profiler()
+	if s.auth != nil {
+		profiler = s.auth.Require(ScopeAdmin)(profiler)
+	}
+	r.Mount("/debug", profiler)
 
 	return r
 }
 
 // ListenAndServe is a blocking call which runs s.
 func (s *Server) ListenAndServe() error {
-	log.Infof("Starting tracker server on %s", s.config.Listener)
-	return listener.Serve(s.config.Listener, s.Handler())
+	if s.tls != nil {
+		log.Infof("Starting tracker server with tls on %s", s.config.Listener)
+	} else {
+		log.Infof("Starting tracker server on %s", s.config.Listener)
+	}
+	return listener.ServeTLS(s.config.Listener, s.Handler(), s.tls)
 }
 
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) error {
@@ -0,0 +1,54 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// startSpan starts a span named op, as a child of the span carried in ctx if
+// any, and tags it with the torrent it concerns. Zero h or d are not tagged.
+// Returns a context carrying the new span.
+func (s *Server) startSpan(
+	ctx context.Context, op string, h core.InfoHash, d core.Digest) (opentracing.Span, context.Context) {
+
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, op)
+	if h != (core.InfoHash{}) {
+		span.SetTag("info_hash", h.String())
+	}
+	if d != (core.Digest{}) {
+		span.SetTag("name", d.Hex())
+	}
+	return span, ctx
+}
+
+// failSpan marks span as failed with err.
+func failSpan(span opentracing.Span, err error) {
+	ext.Error.Set(span, true)
+	span.LogFields(otlog.Error(err))
+}
+
+// finishSpan finishes span, marking it as failed if err is non-nil.
+func finishSpan(span opentracing.Span, err error) {
+	if err != nil {
+		failSpan(span, err)
+	}
+	span.Finish()
+}
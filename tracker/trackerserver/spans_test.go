@@ -0,0 +1,130 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *serverMocks) newTracedServer() (*Server, *mocktracer.MockTracer) {
+	s := newTestServer(
+		m.t, m.config, m.stats, m.policy, m.topology, m.peerStore, m.originStore, m.originCluster)
+	tracer := mocktracer.New()
+	s.tracer = tracer
+	return s, tracer
+}
+
+// spansByName indexes spans by operation name, failing t if any name is
+// repeated.
+func spansByName(t *testing.T, spans []*mocktracer.MockSpan) map[string]*mocktracer.MockSpan {
+	result := make(map[string]*mocktracer.MockSpan)
+	for _, span := range spans {
+		require.NotContains(t, result, span.OperationName)
+		result[span.OperationName] = span
+	}
+	return result
+}
+
+func TestAnnounceSpans(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s, tracer := mocks.newTracedServer()
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	storeErr := errors.New("some storage error")
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(storeErr)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(nil, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(
+		[]*core.PeerInfo{core.OriginPeerInfoFixture()}, nil)
+
+	_, _, err := newAnnounceClient(pctx, addr).Announce(
+		core.NamespaceFixture(), blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+
+	spans := spansByName(t, tracer.FinishedSpans())
+	require.Len(spans, 6)
+
+	server := spans["POST /announce/{infohash}"]
+	require.NotNil(server)
+	announce := spans["announce"]
+	require.NotNil(announce)
+	require.Equal(server.SpanContext.SpanID, announce.ParentID)
+	require.Equal(h.String(), announce.Tag("info_hash"))
+	require.Equal(blob.Digest.Hex(), announce.Tag("name"))
+	require.Equal(pctx.PeerID.String(), announce.Tag("peer_id"))
+
+	for _, name := range []string{
+		"peerstore.update_peer",
+		"peerstore.get_peers",
+		"originstore.get_origins",
+		"handout_policy",
+	} {
+		span := spans[name]
+		require.NotNil(span, name)
+		require.Equal(announce.SpanContext.SpanID, span.ParentID, name)
+		require.Equal(h.String(), span.Tag("info_hash"), name)
+		require.Equal(blob.Digest.Hex(), span.Tag("name"), name)
+	}
+	require.Equal(true, spans["peerstore.update_peer"].Tag("error"))
+	require.Nil(spans["peerstore.get_peers"].Tag("error"))
+	require.Equal(1, spans["handout_policy"].Tag("handout_size"))
+}
+
+func TestGetMetaInfoSpans(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s, tracer := mocks.newTracedServer()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+	originErr := errors.New("some origin error")
+
+	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(nil, originErr)
+
+	parent := tracer.StartSpan("parent")
+	_, err := s.getMetaInfo(
+		opentracing.ContextWithSpan(context.Background(), parent), namespace, mi.Digest())
+	require.Equal(originErr, err)
+	parent.Finish()
+
+	spans := spansByName(t, tracer.FinishedSpans())
+	span := spans["origin.get_metainfo"]
+	require.NotNil(span)
+	require.Equal(parent.(*mocktracer.MockSpan).SpanContext.SpanID, span.ParentID)
+	require.Equal(mi.Digest().Hex(), span.Tag("name"))
+	require.Equal(true, span.Tag("error"))
+}
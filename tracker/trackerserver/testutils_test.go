@@ -20,15 +20,22 @@ import (
 	"github.com/uber/kraken/mocks/origin/blobclient"
 	"github.com/uber/kraken/mocks/tracker/originstore"
 	"github.com/uber/kraken/mocks/tracker/peerstore"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/tracker/topology"
 
 	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
 )
 
 type serverMocks struct {
+	t             *testing.T
 	config        Config
 	policy        *peerhandoutpolicy.PriorityPolicy
+	topology      *topology.Map
 	ctrl          *gomock.Controller
 	peerStore     *mockpeerstore.MockStore
 	originStore   *mockoriginstore.MockStore
@@ -39,6 +46,7 @@ type serverMocks struct {
 func newServerMocks(t *testing.T, config Config) (*serverMocks, func()) {
 	ctrl := gomock.NewController(t)
 	return &serverMocks{
+		t:             t,
 		config:        config,
 		policy:        peerhandoutpolicy.DefaultPriorityPolicyFixture(),
 		peerStore:     mockpeerstore.NewMockStore(ctrl),
@@ -49,11 +57,30 @@ func newServerMocks(t *testing.T, config Config) (*serverMocks, func()) {
 }
 
 func (m *serverMocks) handler() http.Handler {
-	return New(
+	return newTestServer(
+		m.t,
 		m.config,
 		m.stats,
 		m.policy,
+		m.topology,
 		m.peerStore,
 		m.originStore,
 		m.originCluster).Handler()
 }
+
+// newTestServer creates a new Server, failing t if the config is invalid.
+func newTestServer(
+	t *testing.T,
+	config Config,
+	stats tally.Scope,
+	policy *peerhandoutpolicy.PriorityPolicy,
+	topo *topology.Map,
+	peerStore peerstore.Store,
+	originStore originstore.Store,
+	originCluster blobclient.ClusterClient,
+	opts ...Option) *Server {
+
+	s, err := New(config, stats, policy, topo, peerStore, originStore, originCluster, opts...)
+	require.NoError(t, err)
+	return s
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/uber/kraken/tracker/topology"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// TopologyResponse lists the host locations cached by the tracker.
+type TopologyResponse struct {
+	Hosts    map[string]topology.Location `json:"hosts"`
+	LoadedAt time.Time                    `json:"loaded_at"`
+}
+
+func (s *Server) checkTopology() error {
+	if s.topology == nil {
+		return handler.Errorf("topology not configured").Status(http.StatusNotImplemented)
+	}
+	return nil
+}
+
+// topologyHandler returns the location of every known host.
+func (s *Server) topologyHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := s.checkTopology(); err != nil {
+		return err
+	}
+	hosts, loadedAt := s.topology.Hosts()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(TopologyResponse{hosts, loadedAt}); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
+// hostLocationHandler returns the location of a single host.
+func (s *Server) hostLocationHandler(w http.ResponseWriter, r *http.Request) error {
+	host, err := httputil.ParseParam(r, "host")
+	if err != nil {
+		return err
+	}
+	if err := s.checkTopology(); err != nil {
+		return err
+	}
+	l, ok := s.topology.Lookup(host)
+	if !ok {
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(l); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/tracker/topology"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyEndpoints(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	loc := topology.Location{Rack: "r1", DC: "dc1", Zone: "z1", BandwidthClass: "10g"}
+	topo, err := topology.New(topology.Config{
+		Hosts: map[string]topology.Location{"host-a": loc},
+	}, clock.New())
+	require.NoError(err)
+	defer topo.Close()
+	mocks.topology = topo
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/topology", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var all TopologyResponse
+	require.NoError(json.NewDecoder(resp.Body).Decode(&all))
+	require.Equal(map[string]topology.Location{"host-a": loc}, all.Hosts)
+
+	resp, err = httputil.Get(fmt.Sprintf("http://%s/topology/hosts/host-a", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var result topology.Location
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(loc, result)
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/topology/hosts/host-b", addr))
+	require.True(httputil.IsNotFound(err))
+}
+
+func TestTopologyEndpointsNotConfigured(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/topology", addr))
+	require.True(httputil.IsStatus(err, http.StatusNotImplemented))
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// TracingConfig defines configuration for tracing the requests of individual
+// torrents.
+type TracingConfig struct {
+	// MaxDuration caps how long a torrent is traced, such that forgotten
+	// traces do not flood logs.
+	MaxDuration time.Duration `yaml:"max_duration"`
+}
+
+func (c TracingConfig) applyDefaults() TracingConfig {
+	if c.MaxDuration == 0 {
+		c.MaxDuration = time.Hour
+	}
+	return c
+}
+
+// tracedTorrents tracks torrents, keyed by infohash or digest, whose requests
+// are logged in full regardless of the configured log level.
+type tracedTorrents struct {
+	config TracingConfig
+	clk    clock.Clock
+
+	mu      sync.Mutex
+	targets map[string]time.Time
+}
+
+func newTracedTorrents(config TracingConfig, clk clock.Clock) *tracedTorrents {
+	return &tracedTorrents{
+		config:  config.applyDefaults(),
+		clk:     clk,
+		targets: make(map[string]time.Time),
+	}
+}
+
+// parseTraceTarget normalizes raw, which is either an infohash or a digest.
+func parseTraceTarget(raw string) (string, error) {
+	if h, err := core.NewInfoHashFromHex(raw); err == nil {
+		return h.String(), nil
+	}
+	if d, err := core.ParseSHA256Digest(raw); err == nil {
+		return d.String(), nil
+	}
+	return "", fmt.Errorf("%q is neither an infohash nor a digest", raw)
+}
+
+// start traces target for d, capped at the configured max duration. Returns
+// when tracing ends.
+func (t *tracedTorrents) start(target string, d time.Duration) time.Time {
+	if d > t.config.MaxDuration {
+		d = t.config.MaxDuration
+	}
+	until := t.clk.Now().Add(d)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.targets[target] = until
+	return until
+}
+
+// end stops tracing target. Returns false if target was not traced.
+func (t *tracedTorrents) end(target string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep()
+	_, ok := t.targets[target]
+	delete(t.targets, target)
+	return ok
+}
+
+// list returns all traced targets and when their tracing ends.
+func (t *tracedTorrents) list() map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep()
+	result := make(map[string]time.Time, len(t.targets))
+	for target, until := range t.targets {
+		result[target] = until
+	}
+	return result
+}
+
+// traced returns whether requests for the torrent of h or d are traced. A zero
+// h or d is ignored.
+func (t *tracedTorrents) traced(h core.InfoHash, d core.Digest) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep()
+	if len(t.targets) == 0 {
+		return false
+	}
+	if _, ok := t.targets[h.String()]; ok && h != (core.InfoHash{}) {
+		return true
+	}
+	if _, ok := t.targets[d.String()]; ok && d != (core.Digest{}) {
+		return true
+	}
+	return false
+}
+
+// sweep discards ended traces. Must be called with t.mu held.
+func (t *tracedTorrents) sweep() {
+	now := t.clk.Now()
+	for target, until := range t.targets {
+		if !now.Before(until) {
+			delete(t.targets, target)
+		}
+	}
+}
+
+// traceWindow describes when tracing of a torrent ends.
+type traceWindow struct {
+	Target string    `json:"target"`
+	Until  time.Time `json:"until"`
+}
+
+// startTraceHandler traces the torrent of an infohash or digest for the
+// duration given by the "duration" query argument.
+func (s *Server) startTraceHandler(w http.ResponseWriter, r *http.Request) error {
+	raw, err := httputil.ParseParam(r, "target")
+	if err != nil {
+		return err
+	}
+	target, err := parseTraceTarget(raw)
+	if err != nil {
+		return handler.Errorf("parse target: %s", err).Status(http.StatusBadRequest)
+	}
+	d, err := time.ParseDuration(r.URL.Query().Get("duration"))
+	if err != nil {
+		return handler.Errorf("parse duration: %s", err).Status(http.StatusBadRequest)
+	}
+	if d <= 0 {
+		return handler.Errorf("duration must be positive").Status(http.StatusBadRequest)
+	}
+	until := s.traces.start(target, d)
+	log.With("target", target, "until", until).Info("Tracing torrent")
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(traceWindow{target, until}); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
+// endTraceHandler stops tracing the torrent of an infohash or digest.
+func (s *Server) endTraceHandler(w http.ResponseWriter, r *http.Request) error {
+	raw, err := httputil.ParseParam(r, "target")
+	if err != nil {
+		return err
+	}
+	target, err := parseTraceTarget(raw)
+	if err != nil {
+		return handler.Errorf("parse target: %s", err).Status(http.StatusBadRequest)
+	}
+	if !s.traces.end(target) {
+		return handler.Errorf("%s not traced", target).Status(http.StatusNotFound)
+	}
+	log.With("target", target).Info("Stopped tracing torrent")
+	return nil
+}
+
+// listTracesHandler returns all traced torrents, sorted by when tracing ends.
+func (s *Server) listTracesHandler(w http.ResponseWriter, r *http.Request) error {
+	windows := []traceWindow{}
+	for target, until := range s.traces.list() {
+		windows = append(windows, traceWindow{target, until})
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].Until.Before(windows[j].Until)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(windows); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracedTorrents(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	traces := newTracedTorrents(TracingConfig{MaxDuration: time.Hour}, clk)
+
+	h := core.InfoHashFixture()
+	d := core.DigestFixture()
+
+	require.False(traces.traced(h, d))
+
+	traces.start(h.String(), time.Minute)
+	require.True(traces.traced(h, core.Digest{}))
+	require.False(traces.traced(core.InfoHashFixture(), core.Digest{}))
+
+	// Durations are capped.
+	until := traces.start(d.String(), 2*time.Hour)
+	require.Equal(clk.Now().Add(time.Hour), until)
+	require.True(traces.traced(core.InfoHash{}, d))
+
+	clk.Add(time.Minute)
+	require.False(traces.traced(h, core.Digest{}))
+	require.True(traces.traced(core.InfoHash{}, d))
+	require.Len(traces.list(), 1)
+
+	require.True(traces.end(d.String()))
+	require.False(traces.end(d.String()))
+	require.False(traces.traced(core.InfoHash{}, d))
+}
+
+func TestParseTraceTarget(t *testing.T) {
+	require := require.New(t)
+
+	h := core.InfoHashFixture()
+	target, err := parseTraceTarget(h.Hex())
+	require.NoError(err)
+	require.Equal(h.String(), target)
+
+	d := core.DigestFixture()
+	target, err = parseTraceTarget(d.String())
+	require.NoError(err)
+	require.Equal(d.String(), target)
+
+	_, err = parseTraceTarget("foo")
+	require.Error(err)
+}
+
+func TestTraceEndpoints(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	d := core.DigestFixture()
+	traceURL := fmt.Sprintf("http://%s/admin/traces/%s", addr, url.PathEscape(d.String()))
+
+	_, err := httputil.Put(fmt.Sprintf("http://%s/admin/traces/foo?duration=1m", addr))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	_, err = httputil.Put(traceURL + "?duration=0s")
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	resp, err := httputil.Put(traceURL + "?duration=10m")
+	require.NoError(err)
+	defer resp.Body.Close()
+	var started traceWindow
+	require.NoError(json.NewDecoder(resp.Body).Decode(&started))
+	require.Equal(d.String(), started.Target)
+
+	resp, err = httputil.Get(fmt.Sprintf("http://%s/admin/traces", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var windows []traceWindow
+	require.NoError(json.NewDecoder(resp.Body).Decode(&windows))
+	require.Len(windows, 1)
+	require.Equal(d.String(), windows[0].Target)
+
+	_, err = httputil.Delete(traceURL)
+	require.NoError(err)
+
+	_, err = httputil.Delete(traceURL)
+	require.True(httputil.IsStatus(err, http.StatusNotFound))
+}
+
+func TestAnnounceTracedTorrent(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		mocks.config,
+		mocks.stats,
+		mocks.policy,
+		mocks.topology,
+		mocks.peerStore,
+		mocks.originStore,
+		mocks.originCluster)
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peer := core.PeerInfoFixture()
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+
+	s.traces.start(h.String(), time.Minute)
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, peer).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{seeder}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	resp, err := s.announce(
+		context.Background(), core.NamespaceFixture(), blob.Digest, h, peer, announceclient.CurrentProtocol, nil)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{seeder}, resp.Peers)
+
+	// Tracing does not annotate responses.
+	require.Nil(resp.Explanations)
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/udptracker"
+	"github.com/uber/kraken/utils/log"
+)
+
+// udpBackend answers UDP announces and scrapes with the same storage and
+// handout policy as HTTP announces.
+type udpBackend struct {
+	s *Server
+}
+
+// UDPBackend returns a udptracker.Backend which serves announces from s.
+// Returns an error if s requires bearer tokens, since UDP announces cannot
+// carry them.
+func (s *Server) UDPBackend() (udptracker.Backend, error) {
+	if s.auth != nil {
+		return nil, errors.New("udp announces cannot be authenticated")
+	}
+	return udpBackend{s}, nil
+}
+
+// Announce answers UDP announce req. UDP handouts can only carry peer ids and
+// addresses, so peers are always handed out by IP, in the address family of
+// the connection the announce was received on.
+func (b udpBackend) Announce(
+	ctx context.Context,
+	req *udptracker.AnnounceRequest,
+	addr *net.UDPAddr) (*udptracker.AnnounceResponse, error) {
+
+	if err := b.s.limitAnnounce(req.PeerID.String(), addr.IP.String()); err != nil {
+		return nil, err
+	}
+	params, err := udptracker.DecodeParams(req.URLData)
+	if err != nil {
+		return nil, fmt.Errorf("decode params: %s", err)
+	}
+	ip := req.IP
+	if ip == nil {
+		ip = addr.IP
+	}
+	peer := &core.PeerInfo{
+		PeerID:   req.PeerID,
+		IP:       ip.String(),
+		Port:     int(req.Port),
+		Complete: req.Left == 0 || req.Event == udptracker.EventCompleted,
+		Hostname: params.Hostname,
+		Zone:     params.Zone,
+		Rack:     params.Rack,
+		DC:       params.DC,
+	}
+	areq := &announceclient.Request{
+		Name:      params.Digest.Hex(),
+		Digest:    &params.Digest,
+		InfoHash:  req.InfoHash,
+		Peer:      peer,
+		Namespace: params.Namespace,
+		Token:     params.Token,
+		Protocol:  announceclient.Protocol1,
+		Transfer: &announceclient.Transfer{
+			Uploaded:   req.Uploaded,
+			Downloaded: req.Downloaded,
+		},
+		Load: params.Load,
+	}
+	if err := areq.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid request: %s", err)
+	}
+	if err := b.s.validatePort(areq); err != nil {
+		return nil, err
+	}
+	if err := b.s.verifyToken(req.InfoHash, areq); err != nil {
+		return nil, err
+	}
+	protocol, err := b.s.negotiateProtocol(areq)
+	if err != nil {
+		return nil, err
+	}
+	b.s.recordLoad(areq)
+	b.s.recordTransfer(areq, req.InfoHash)
+	families := []string{core.AddressFamily(addr.IP.String())}
+	resp, err := b.s.announce(
+		ctx, params.Namespace, params.Digest, req.InfoHash, peer, protocol, families)
+	if err != nil {
+		return nil, err
+	}
+	peers := resp.Peers
+	if req.NumWant > 0 && int(req.NumWant) < len(peers) {
+		peers = peers[:req.NumWant]
+	}
+	// Swarm sizes are advisory, so failed estimates are reported as empty
+	// swarms rather than failing the announce.
+	seeders, leechers, err := b.s.peerStore.EstimatePeerCount(req.InfoHash)
+	if err != nil {
+		log.With("hash", req.InfoHash).Errorf("Error estimating peer count: %s", err)
+		b.s.countStorageError(storePeers, "estimate_peer_count")
+		seeders, leechers = 0, 0
+	}
+	b.s.stats.Counter("udp_announces").Inc(1)
+	return &udptracker.AnnounceResponse{
+		Interval: int32(resp.GetInterval() / time.Second),
+		Seeders:  int32(seeders),
+		Leechers: int32(leechers),
+		Peers:    peers,
+	}, nil
+}
+
+// Scrape returns the stats of each of hashes, as served by the HTTP scrape
+// endpoints.
+func (b udpBackend) Scrape(
+	ctx context.Context, hashes []core.InfoHash) ([]udptracker.ScrapeStats, error) {
+
+	stats, err := b.s.scrape(hashes)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]udptracker.ScrapeStats, len(stats))
+	for i, st := range stats {
+		result[i] = udptracker.ScrapeStats{
+			Seeders:   int32(st.Seeders),
+			Completed: int32(st.Completed),
+			Leechers:  int32(st.Leechers),
+		}
+	}
+	return result, nil
+}
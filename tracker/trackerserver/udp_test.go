@@ -0,0 +1,244 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/tracker/udptracker"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func startUDPServer(t *testing.T, s *Server) (addr string, stop func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	backend, err := s.UDPBackend()
+	require.NoError(t, err)
+	u, err := udptracker.New(udptracker.Config{}, s.stats, backend)
+	require.NoError(t, err)
+	go u.Serve(conn)
+	return conn.LocalAddr().String(), func() { u.Close() }
+}
+
+func TestUDPAnnounceSharesHandoutWithHTTP(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{AnnounceInterval: 5 * time.Second}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+	addr, stop := startUDPServer(t, s)
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	pctx := core.PeerContextFixture()
+	peer := core.PeerInfoFixture()
+	origin := core.OriginPeerInfoFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return([]*core.PeerInfo{peer}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return([]*core.PeerInfo{origin}, nil)
+	mocks.peerStore.EXPECT().EstimatePeerCount(blob.MetaInfo.InfoHash()).Return(1, 1, nil)
+
+	client := udptracker.NewClient(udptracker.ClientConfig{Addr: addr}, pctx)
+
+	result, interval, err := client.Announce(
+		core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+	require.NoError(err)
+	require.Equal(config.AnnounceInterval, interval)
+
+	// UDP handouts only carry peer ids and addresses.
+	var expected []*core.PeerInfo
+	for _, p := range []*core.PeerInfo{origin, peer} {
+		expected = append(expected, &core.PeerInfo{PeerID: p.PeerID, IP: p.IP, Port: p.Port})
+	}
+	require.ElementsMatch(expected, result)
+}
+
+func TestUDPAnnounceRejectsDisallowedPort(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{PortValidation: PortValidationConfig{Enabled: true}}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	blob := core.NewBlobFixture()
+	params := &udptracker.Params{Namespace: core.NamespaceFixture(), Digest: blob.Digest}
+	req := &udptracker.AnnounceRequest{
+		InfoHash: blob.MetaInfo.InfoHash(),
+		PeerID:   core.PeerIDFixture(),
+		Left:     1,
+		Port:     22,
+		URLData:  params.Encode(),
+	}
+	backend, err := s.UDPBackend()
+	require.NoError(err)
+	_, err = backend.Announce(
+		context.Background(), req, &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6881})
+	require.Error(err)
+}
+
+func TestUDPAnnounceEstimatesSwarmSizeAndRecordsLoad(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		LoadAware: peerhandoutpolicy.LoadAwareConfig{Enabled: true, Threshold: 0.8},
+	}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	pctx := core.PeerContextFixture()
+
+	params := &udptracker.Params{
+		Namespace: core.NamespaceFixture(),
+		Digest:    blob.Digest,
+		Load:      &announceclient.LoadHint{UploadSaturation: 0.95, DiskPressure: 0.1},
+	}
+	req := &udptracker.AnnounceRequest{
+		InfoHash: h,
+		PeerID:   pctx.PeerID,
+		Left:     1,
+		NumWant:  1,
+		Port:     uint16(pctx.Port),
+		URLData:  params.Encode(),
+	}
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, gomock.Any()).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(
+		[]*core.PeerInfo{core.PeerInfoFixture(), core.PeerInfoFixture()}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+	mocks.peerStore.EXPECT().EstimatePeerCount(h).Return(40, 60, nil)
+
+	backend, err := s.UDPBackend()
+	require.NoError(err)
+	resp, err := backend.Announce(
+		context.Background(), req, &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: pctx.Port})
+	require.NoError(err)
+
+	// Swarm sizes are estimated, rather than counted from the truncated
+	// handout.
+	require.Len(resp.Peers, 1)
+	require.Equal(int32(40), resp.Seeders)
+	require.Equal(int32(60), resp.Leechers)
+
+	require.InDelta(0.95, s.load.Load(pctx.PeerID), 0.01)
+}
+
+func TestUDPScrapeEstimatesSwarmSize(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		Config{}, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	mocks.peerStore.EXPECT().EstimatePeerCount(h1).Return(3, 7, nil)
+	mocks.peerStore.EXPECT().EstimatePeerCount(h2).Return(0, 1, nil)
+
+	backend, err := s.UDPBackend()
+	require.NoError(err)
+	stats, err := backend.Scrape(context.Background(), []core.InfoHash{h1, h2})
+	require.NoError(err)
+	require.Equal([]udptracker.ScrapeStats{
+		{Seeders: 3, Leechers: 7},
+		{Seeders: 0, Leechers: 1},
+	}, stats)
+}
+
+func TestUDPBackendRefusedWhenAuthRequired(t *testing.T) {
+	config := Config{Auth: authConfigFixture()}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+
+	_, err := s.UDPBackend()
+	require.Error(t, err)
+}
+
+func TestUDPAnnounceRateLimitsPeers(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{RateLimit: RateLimitConfig{Enabled: true, PeerPerSecond: 0.001, PeerBurst: 1}}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology,
+		mocks.peerStore, mocks.originStore, mocks.originCluster)
+	addr, stop := startUDPServer(t, s)
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	pctx := core.PeerContextFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(blob.MetaInfo.InfoHash(), gomock.Any()).Return(nil, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+	mocks.peerStore.EXPECT().EstimatePeerCount(blob.MetaInfo.InfoHash()).Return(0, 1, nil)
+
+	client := udptracker.NewClient(udptracker.ClientConfig{Addr: addr}, pctx)
+
+	_, _, err := client.Announce(
+		core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+	require.NoError(err)
+
+	// The peer's burst is spent, so it cannot bypass HTTP rate limits over UDP.
+	_, _, err = client.Announce(
+		core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+	require.Error(err)
+	require.Contains(err.Error(), "rate limit")
+}
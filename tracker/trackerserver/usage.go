@@ -0,0 +1,252 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// UsageConfig defines accounting of the bytes peers transfer per namespace,
+// derived from the transfers peers report in their announces.
+type UsageConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Interval is the period each usage report covers.
+	Interval time.Duration `yaml:"interval"`
+
+	// LogPath is an optional file which completed reports are appended to as
+	// json lines, e.g. for shipping to Kafka.
+	LogPath string `yaml:"log_path"`
+}
+
+func (c UsageConfig) applyDefaults() UsageConfig {
+	if c.Interval == 0 {
+		c.Interval = time.Hour
+	}
+	return c
+}
+
+// NamespaceUsage defines the bytes transferred within a namespace.
+type NamespaceUsage struct {
+	Uploaded   int64 `json:"uploaded"`
+	Downloaded int64 `json:"downloaded"`
+}
+
+// UsageReport defines the bytes transferred per namespace between Start and
+// End, as reported to a single tracker.
+type UsageReport struct {
+	Start      time.Time                  `json:"start"`
+	End        time.Time                  `json:"end"`
+	Namespaces map[string]*NamespaceUsage `json:"namespaces"`
+}
+
+func newUsageReport(now time.Time, interval time.Duration) *UsageReport {
+	start := now.Truncate(interval)
+	return &UsageReport{
+		Start:      start,
+		End:        start.Add(interval),
+		Namespaces: make(map[string]*NamespaceUsage),
+	}
+}
+
+func (r *UsageReport) copy() *UsageReport {
+	c := &UsageReport{
+		Start:      r.Start,
+		End:        r.End,
+		Namespaces: make(map[string]*NamespaceUsage, len(r.Namespaces)),
+	}
+	for ns, u := range r.Namespaces {
+		uc := *u
+		c.Namespaces[ns] = &uc
+	}
+	return c
+}
+
+// UsageResponse defines the response of the usage endpoint.
+type UsageResponse struct {
+	// Current is the report in progress.
+	Current *UsageReport `json:"current"`
+
+	// Previous is the most recently completed report, if any.
+	Previous *UsageReport `json:"previous,omitempty"`
+}
+
+type transferKey struct {
+	peerID   core.PeerID
+	infoHash core.InfoHash
+}
+
+type transferRecord struct {
+	transfer announceclient.Transfer
+	updated  time.Time
+}
+
+// usageAccountant aggregates the transfers peers report per namespace.
+// Peers report cumulative transfers per torrent, so the accountant remembers
+// the last transfer of each peer and torrent and accounts the difference.
+type usageAccountant struct {
+	config UsageConfig
+	stats  tally.Scope
+	clk    clock.Clock
+
+	mu       sync.Mutex
+	last     map[transferKey]transferRecord
+	current  *UsageReport
+	previous *UsageReport
+}
+
+func newUsageAccountant(config UsageConfig, stats tally.Scope, clk clock.Clock) *usageAccountant {
+	config = config.applyDefaults()
+	return &usageAccountant{
+		config:  config,
+		stats:   stats,
+		clk:     clk,
+		last:    make(map[transferKey]transferRecord),
+		current: newUsageReport(clk.Now(), config.Interval),
+	}
+}
+
+// record accounts transfer, the cumulative transfer of peerID for the torrent
+// h within namespace.
+func (a *usageAccountant) record(
+	namespace string, peerID core.PeerID, h core.InfoHash, transfer announceclient.Transfer) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clk.Now()
+	a.maybeRollover(now)
+
+	key := transferKey{peerID, h}
+	prev, ok := a.last[key]
+	a.last[key] = transferRecord{transfer, now}
+	if !ok {
+		// The first transfer seen only establishes a baseline, since it may
+		// have been accounted by a tracker which owned the torrent before.
+		return
+	}
+	uploaded := transferDelta(prev.transfer.Uploaded, transfer.Uploaded)
+	downloaded := transferDelta(prev.transfer.Downloaded, transfer.Downloaded)
+	if uploaded == 0 && downloaded == 0 {
+		return
+	}
+	u, ok := a.current.Namespaces[namespace]
+	if !ok {
+		u = new(NamespaceUsage)
+		a.current.Namespaces[namespace] = u
+	}
+	u.Uploaded += uploaded
+	u.Downloaded += downloaded
+
+	stats := a.stats.Tagged(map[string]string{"namespace": namespace})
+	stats.Counter("namespace_bytes_uploaded").Inc(uploaded)
+	stats.Counter("namespace_bytes_downloaded").Inc(downloaded)
+}
+
+// transferDelta returns the bytes transferred between two consecutive
+// cumulative counters. Counters which went backwards were restarted, e.g.
+// because the peer restarted the torrent.
+func transferDelta(prev, cur int64) int64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// report returns copies of the current and previous reports.
+func (a *usageAccountant) report() UsageResponse {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.maybeRollover(a.clk.Now())
+
+	resp := UsageResponse{Current: a.current.copy()}
+	if a.previous != nil {
+		resp.Previous = a.previous.copy()
+	}
+	return resp
+}
+
+// maybeRollover completes the current report if now is past its end. Reports
+// are therefore completed on the first announce or query after their end.
+func (a *usageAccountant) maybeRollover(now time.Time) {
+	if now.Before(a.current.End) {
+		return
+	}
+	if a.config.LogPath != "" {
+		if err := a.export(a.current); err != nil {
+			log.Errorf("Error exporting usage report: %s", err)
+			a.stats.Counter("usage_export_failures").Inc(1)
+		}
+	}
+	a.previous = a.current
+	a.current = newUsageReport(now, a.config.Interval)
+
+	// Forget torrents which peers stopped announcing, so the baselines of
+	// departed peers are not remembered forever.
+	for k, r := range a.last {
+		if now.Sub(r.updated) > a.config.Interval {
+			delete(a.last, k)
+		}
+	}
+}
+
+func (a *usageAccountant) export(r *UsageReport) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	f, err := os.OpenFile(a.config.LogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("open: %s", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) recordTransfer(req *announceclient.Request, h core.InfoHash) {
+	if s.usage == nil || req.Transfer == nil || req.Peer == nil {
+		return
+	}
+	s.usage.record(req.Namespace, req.Peer.PeerID, h, *req.Transfer)
+}
+
+// usageHandler returns the bytes transferred per namespace, as reported to
+// this tracker.
+func (s *Server) usageHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.usage == nil {
+		return handler.Errorf("usage accounting not enabled").Status(http.StatusNotFound)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.usage.report()); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
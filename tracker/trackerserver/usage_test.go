@@ -0,0 +1,128 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestUsageAccountantAccountsDeltas(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	a := newUsageAccountant(UsageConfig{Interval: time.Hour}, tally.NoopScope, clk)
+
+	p := core.PeerIDFixture()
+	h := core.InfoHashFixture()
+
+	// The first transfer only establishes a baseline.
+	a.record("ns1", p, h, announceclient.Transfer{Uploaded: 100, Downloaded: 1000})
+	a.record("ns1", p, h, announceclient.Transfer{Uploaded: 150, Downloaded: 1200})
+
+	// Restarted counters are accounted from zero.
+	a.record("ns1", p, h, announceclient.Transfer{Uploaded: 10, Downloaded: 0})
+
+	// Each torrent establishes its own baseline.
+	other := core.PeerIDFixture()
+	a.record("ns2", other, core.InfoHashFixture(), announceclient.Transfer{})
+	a.record("ns2", other, core.InfoHashFixture(), announceclient.Transfer{Downloaded: 5})
+
+	report := a.report().Current
+	require.Equal(map[string]*NamespaceUsage{
+		"ns1": {Uploaded: 60, Downloaded: 200},
+	}, report.Namespaces)
+}
+
+func TestUsageAccountantRollsOverReports(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("/tmp", "usage")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "usage.log")
+
+	clk := clock.NewMock()
+	a := newUsageAccountant(
+		UsageConfig{Interval: time.Hour, LogPath: logPath}, tally.NoopScope, clk)
+
+	p := core.PeerIDFixture()
+	h := core.InfoHashFixture()
+
+	a.record("ns", p, h, announceclient.Transfer{})
+	a.record("ns", p, h, announceclient.Transfer{Uploaded: 10})
+
+	resp := a.report()
+	require.Nil(resp.Previous)
+
+	clk.Add(time.Hour)
+
+	resp = a.report()
+	require.Empty(resp.Current.Namespaces)
+	require.Equal(map[string]*NamespaceUsage{"ns": {Uploaded: 10}}, resp.Previous.Namespaces)
+	require.Equal(resp.Previous.End, resp.Current.Start)
+
+	b, err := ioutil.ReadFile(logPath)
+	require.NoError(err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(lines, 1)
+	var exported UsageReport
+	require.NoError(json.Unmarshal([]byte(lines[0]), &exported))
+	require.Equal(int64(10), exported.Namespaces["ns"].Uploaded)
+}
+
+func TestUsageAccountantForgetsIdleTorrents(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	a := newUsageAccountant(UsageConfig{Interval: time.Hour}, tally.NoopScope, clk)
+
+	p := core.PeerIDFixture()
+	h := core.InfoHashFixture()
+
+	a.record("ns", p, h, announceclient.Transfer{Uploaded: 10})
+
+	clk.Add(2 * time.Hour)
+	a.report()
+
+	// The forgotten torrent establishes a new baseline.
+	a.record("ns", p, h, announceclient.Transfer{Uploaded: 20})
+	require.Empty(a.report().Current.Namespaces)
+}
+
+func TestUsageHandlerNotFoundWhenDisabled(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/usage", addr))
+	require.True(t, httputil.IsNotFound(err))
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// WarmUp preloads the peer cache with the peers of the most announced
+// torrents, such that the first deploy wave after a restart is served from
+// cache instead of hitting the peer store all at once. s reports ready once
+// WarmUp returns. Warm-up is best-effort: errors are logged and never prevent
+// s from becoming ready.
+func (s *Server) WarmUp() {
+	defer s.readyOnce.Do(func() { close(s.ready) })
+
+	if !s.config.WarmUp.Enabled {
+		return
+	}
+	if s.peers == nil {
+		log.Warn("Skipping warm-up: peer cache is disabled")
+		return
+	}
+	l, ok := s.peerStore.(peerstore.HotInfoHashLister)
+	if !ok {
+		log.Warn("Skipping warm-up: peer store does not count announces")
+		return
+	}
+	start := time.Now()
+	hashes, err := l.HottestInfoHashes(s.config.WarmUp.NumInfoHashes)
+	if err != nil {
+		log.Errorf("Skipping warm-up: error listing hottest infohashes: %s", err)
+		return
+	}
+	deadline := start.Add(s.config.WarmUp.Timeout)
+	warmed := make(map[core.InfoHash][]*core.PeerInfo)
+	for _, h := range hashes {
+		if time.Now().After(deadline) {
+			log.Warnf("Warm-up timed out after %d of %d infohashes", len(warmed), len(hashes))
+			break
+		}
+		peers, err := s.getPeersFromStore(h)
+		if err != nil {
+			log.With("hash", h).Errorf("Error warming up peers: %s", err)
+			continue
+		}
+		warmed[h] = peers
+	}
+	// Peers are only cached once warm-up is done, such that entries do not
+	// expire before s reports ready.
+	for h, peers := range warmed {
+		s.peers.set(h, peers)
+	}
+	s.stats.Counter("warmup_infohashes").Inc(int64(len(warmed)))
+	s.stats.Timer("warmup_duration").Record(time.Since(start))
+	log.Infof("Warmed up peers of %d infohashes in %s", len(warmed), time.Since(start))
+}
+
+// Drain marks s as not ready, such that load balancers stop routing new
+// traffic to s, and then blocks for the configured drain period while s keeps
+// serving in-flight agents. Intended to be called before shutdown.
+//
+// NOTE: Trackers do not register themselves in a hash ring. Agents discover
+// trackers via static hosts or DNS, and readiness is the only signal trackers
+// control.
+func (s *Server) Drain() {
+	if !atomic.CompareAndSwapInt32(&s.draining, 0, 1) {
+		return
+	}
+	log.Infof("Draining tracker server for %s", s.config.DrainPeriod)
+	s.stats.Gauge("draining").Update(1)
+	time.Sleep(s.config.DrainPeriod)
+}
+
+// Ready returns whether s has finished warming up and is not draining.
+func (s *Server) Ready() bool {
+	if atomic.LoadInt32(&s.draining) == 1 {
+		return false
+	}
+	select {
+	case <-s.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) readinessHandler(w http.ResponseWriter, r *http.Request) error {
+	if atomic.LoadInt32(&s.draining) == 1 {
+		return handler.Errorf("draining").Status(http.StatusServiceUnavailable)
+	}
+	if !s.Ready() {
+		return handler.Errorf("warming up").Status(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, "OK")
+	return nil
+}
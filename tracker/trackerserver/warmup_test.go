@@ -0,0 +1,150 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/mocks/tracker/peerstore"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+type hotPeerStore struct {
+	*mockpeerstore.MockStore
+	hashes []core.InfoHash
+}
+
+func (s *hotPeerStore) HottestInfoHashes(n int) ([]core.InfoHash, error) {
+	return s.hashes, nil
+}
+
+func TestWarmUpPreloadsHottestInfoHashesBeforeReady(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+	store := &hotPeerStore{mocks.peerStore, []core.InfoHash{h1, h2}}
+
+	config := Config{
+		WarmUp:    WarmUpConfig{Enabled: true},
+		PeerCache: PeerCacheConfig{Enabled: true},
+	}
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology, store, mocks.originStore, mocks.originCluster)
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/readiness", addr))
+	require.True(httputil.IsStatus(err, 503))
+
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	gomock.InOrder(
+		mocks.peerStore.EXPECT().GetPeers(h1, gomock.Any()).Return(peers, nil),
+		mocks.peerStore.EXPECT().GetPeers(h2, gomock.Any()).Return(nil, errors.New("some error")),
+	)
+
+	s.WarmUp()
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/readiness", addr))
+	require.NoError(err)
+
+	// Peers of h1 are served from the peer cache.
+	result, err := s.getPeers(h1)
+	require.NoError(err)
+	require.Equal(peers, result)
+}
+
+func TestWarmUpSkippedWithoutPeerCache(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	store := &hotPeerStore{mocks.peerStore, []core.InfoHash{core.InfoHashFixture()}}
+
+	config := Config{WarmUp: WarmUpConfig{Enabled: true}}
+	s := newTestServer(
+		t,
+		config, mocks.stats, mocks.policy, mocks.topology, store, mocks.originStore, mocks.originCluster)
+	require.Nil(s.peers)
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	// No peers are loaded from the peer store.
+	s.WarmUp()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/readiness", addr))
+	require.NoError(err)
+}
+
+func TestWarmUpDisabledIsReadyImmediately(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/readiness", addr))
+	require.NoError(err)
+}
+
+func TestDrainReportsNotReady(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := newTestServer(
+		t,
+		Config{DrainPeriod: time.Millisecond},
+		mocks.stats,
+		mocks.policy,
+		mocks.topology,
+		mocks.peerStore,
+		mocks.originStore,
+		mocks.originCluster)
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/readiness", addr))
+	require.NoError(err)
+
+	s.Drain()
+
+	require.False(s.Ready())
+	_, err = httputil.Get(fmt.Sprintf("http://%s/readiness", addr))
+	require.True(httputil.IsStatus(err, 503))
+
+	// The server keeps serving while draining.
+	_, err = httputil.Get(fmt.Sprintf("http://%s/health", addr))
+	require.NoError(err)
+}
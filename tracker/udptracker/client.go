@@ -0,0 +1,226 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package udptracker
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+)
+
+// clientConnectionTTL is how long clients reuse connection ids, per BEP 15.
+const clientConnectionTTL = time.Minute
+
+// maxResponseSize is the largest UDP payload.
+const maxResponseSize = 65507
+
+var errTimeout = errors.New("timed out waiting for response")
+
+// Client announces to a UDP tracker. Client implements announceclient.Client.
+type Client struct {
+	config   ClientConfig
+	pctx     core.PeerContext
+	clk      clock.Clock
+	tokens   *announcetoken.Generator
+	transfer func(core.InfoHash) *announceclient.Transfer
+	load     func() *announceclient.LoadHint
+
+	mu          sync.Mutex
+	connID      int64
+	connExpires time.Time
+}
+
+var _ announceclient.Client = (*Client)(nil)
+
+// ClientOption allows setting optional Client parameters.
+type ClientOption func(*Client)
+
+// WithToken configures the client to attach announce tokens to each request.
+func WithToken(config announcetoken.Config) ClientOption {
+	return func(c *Client) { c.tokens = announcetoken.NewGenerator(config, c.clk) }
+}
+
+// WithTransfer configures the client to report the bytes transferred for each
+// announced torrent, as returned by transfer. Torrents with a nil transfer
+// are reported as having transferred nothing.
+func WithTransfer(transfer func(core.InfoHash) *announceclient.Transfer) ClientOption {
+	return func(c *Client) { c.transfer = transfer }
+}
+
+// WithLoadHint configures the client to attach the hint returned by load to
+// each announce.
+func WithLoadHint(load func() *announceclient.LoadHint) ClientOption {
+	return func(c *Client) { c.load = load }
+}
+
+// NewClient creates a new Client.
+func NewClient(config ClientConfig, pctx core.PeerContext, opts ...ClientOption) *Client {
+	c := &Client{
+		config: config.applyDefaults(),
+		pctx:   pctx,
+		clk:    clock.New(),
+	}
+	c.tokens = announcetoken.NewGenerator(announcetoken.Config{}, c.clk)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Announce announces the torrent identified by (d, h) within namespace.
+// Handed out peers only carry peer ids and addresses. version is ignored,
+// since the UDP protocol has a single announce action.
+func (c *Client) Announce(
+	namespace string,
+	d core.Digest,
+	h core.InfoHash,
+	complete bool,
+	version int) ([]*core.PeerInfo, time.Duration, error) {
+
+	token, err := c.tokens.Generate(namespace, h, c.pctx.PeerID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("generate token: %s", err)
+	}
+	params := &Params{
+		Namespace: namespace,
+		Digest:    d,
+		Hostname:  c.pctx.Hostname,
+		Zone:      c.pctx.Zone,
+		Rack:      c.pctx.Rack,
+		DC:        c.pctx.DC,
+		Token:     token,
+	}
+	if c.load != nil {
+		params.Load = c.load()
+	}
+	req := &AnnounceRequest{
+		InfoHash: h,
+		PeerID:   c.pctx.PeerID,
+		Left:     1,
+		Event:    EventNone,
+		NumWant:  -1,
+		Port:     uint16(c.pctx.Port),
+		URLData:  params.Encode(),
+	}
+	if complete {
+		req.Left = 0
+	}
+	if ip := net.ParseIP(c.pctx.IP); ip != nil {
+		req.IP = ip.To4()
+	}
+	if c.transfer != nil {
+		if t := c.transfer(h); t != nil {
+			req.Uploaded = t.Uploaded
+			req.Downloaded = t.Downloaded
+		}
+	}
+	conn, err := net.Dial("udp", c.config.Addr)
+	if err != nil {
+		return nil, 0, fmt.Errorf("dial: %s", err)
+	}
+	defer conn.Close()
+
+	connID, err := c.connect(conn)
+	if err != nil {
+		return nil, 0, fmt.Errorf("connect: %s", err)
+	}
+	req.Header = Header{connID, ActionAnnounce, rand.Int31()}
+	b, err := c.roundTrip(conn, req.Encode(), req.TransactionID)
+	if err != nil {
+		if _, ok := err.(*ErrorResponse); ok {
+			// The connection id may have expired early, e.g. because the
+			// tracker restarted with a new secret.
+			c.resetConnection()
+		}
+		return nil, 0, err
+	}
+	ipv6 := conn.RemoteAddr().(*net.UDPAddr).IP.To4() == nil
+	resp, err := DecodeAnnounceResponse(b, ipv6, true)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decode response: %s", err)
+	}
+	return resp.Peers, time.Duration(resp.Interval) * time.Second, nil
+}
+
+// connect returns a connection id, reusing the previous id if not expired.
+func (c *Client) connect(conn net.Conn) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.clk.Now().Before(c.connExpires) {
+		return c.connID, nil
+	}
+	tid := rand.Int31()
+	b, err := c.roundTrip(conn, EncodeConnectRequest(tid), tid)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := DecodeConnectResponse(b)
+	if err != nil {
+		return 0, fmt.Errorf("decode response: %s", err)
+	}
+	c.connID = resp.ConnectionID
+	c.connExpires = c.clk.Now().Add(clientConnectionTTL)
+	return c.connID, nil
+}
+
+func (c *Client) resetConnection() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connExpires = time.Time{}
+}
+
+// roundTrip sends req over conn until a response carrying transactionID is
+// received, or retries are exhausted. Error responses are returned as an
+// *ErrorResponse error.
+func (c *Client) roundTrip(conn net.Conn, req []byte, transactionID int32) ([]byte, error) {
+	b := make([]byte, maxResponseSize)
+	for i := 0; i <= c.config.Retries; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, fmt.Errorf("write: %s", err)
+		}
+		deadline := time.Now().Add(c.config.Timeout)
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("set deadline: %s", err)
+		}
+		for {
+			n, err := conn.Read(b)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return nil, fmt.Errorf("read: %s", err)
+			}
+			_, tid, err := DecodeResponseHeader(b[:n])
+			if tid != transactionID {
+				// Late response to a retransmitted request.
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return b[:n], nil
+		}
+	}
+	return nil, errTimeout
+}
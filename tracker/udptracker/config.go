@@ -0,0 +1,84 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package udptracker
+
+import "time"
+
+// Config defines UDP tracker configuration.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Addr is the address the tracker listens on for UDP announces.
+	Addr string `yaml:"addr"`
+
+	// Secret signs connection ids. Trackers behind the same load balancer must
+	// share a secret, since clients may send requests to a different tracker
+	// than they connected to. Defaults to a random secret.
+	Secret string `yaml:"secret"`
+
+	// ConnectionTTL is the lifetime of connection ids. Ids are accepted for up
+	// to twice the TTL, per BEP 15. Defaults to one minute.
+	ConnectionTTL time.Duration `yaml:"connection_ttl"`
+
+	// Workers is the number of requests served concurrently.
+	Workers int `yaml:"workers"`
+
+	// QueueSize is the number of received requests buffered for workers.
+	// Requests received while the queue is full are dropped, which clients
+	// recover from by retransmitting.
+	QueueSize int `yaml:"queue_size"`
+
+	// TrustedSources are CIDRs of sources, e.g. NAT gateways, which may
+	// announce an IP other than their own. UDP source addresses are easily
+	// spoofed, so the IPs of announces from all other sources are ignored
+	// unless they match the source address.
+	TrustedSources []string `yaml:"trusted_sources"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.ConnectionTTL == 0 {
+		c.ConnectionTTL = time.Minute
+	}
+	if c.Workers == 0 {
+		c.Workers = 64
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = 4096
+	}
+	return c
+}
+
+// ClientConfig defines UDP announce client configuration.
+type ClientConfig struct {
+	// Addr is the address of the UDP tracker. If empty, agents announce over
+	// HTTP.
+	Addr string `yaml:"addr"`
+
+	// Timeout is how long the client waits for each response before
+	// retransmitting.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Retries is the number of retransmissions of each request.
+	Retries int `yaml:"retries"`
+}
+
+func (c ClientConfig) applyDefaults() ClientConfig {
+	if c.Timeout == 0 {
+		c.Timeout = 2 * time.Second
+	}
+	if c.Retries == 0 {
+		c.Retries = 3
+	}
+	return c
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package udptracker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// connectionIDs issues and verifies connection ids without keeping state.
+// Each id is a MAC of the source IP and the current epoch, such that ids are
+// valid for between one and two TTLs, and trackers sharing a secret accept
+// each others ids.
+type connectionIDs struct {
+	secret []byte
+	ttl    time.Duration
+	clk    clock.Clock
+}
+
+func newConnectionIDs(secret []byte, ttl time.Duration, clk clock.Clock) *connectionIDs {
+	return &connectionIDs{secret, ttl, clk}
+}
+
+func (c *connectionIDs) epoch() int64 {
+	return c.clk.Now().UnixNano() / int64(c.ttl)
+}
+
+func (c *connectionIDs) sign(ip net.IP, epoch int64) int64 {
+	mac := hmac.New(sha256.New, c.secret)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(epoch))
+	mac.Write(b[:])
+	mac.Write(ip.To16())
+	return int64(binary.BigEndian.Uint64(mac.Sum(nil)))
+}
+
+// issue returns a connection id for ip.
+func (c *connectionIDs) issue(ip net.IP) int64 {
+	return c.sign(ip, c.epoch())
+}
+
+// valid returns whether id was issued to ip within the last two epochs.
+func (c *connectionIDs) valid(id int64, ip net.IP) bool {
+	e := c.epoch()
+	return id == c.sign(ip, e) || id == c.sign(ip, e-1)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package udptracker
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+)
+
+// announcePath is the path of the URL data of announce requests.
+const announcePath = "/announce"
+
+// Params are the Kraken specific fields of an announce, which BEP 15 has no
+// room for. They are carried in the URL data of each announce request, as the
+// query of an HTTP announce would be.
+type Params struct {
+	Namespace string
+	Digest    core.Digest
+
+	Hostname string
+	Zone     string
+	Rack     string
+	DC       string
+
+	// Token is only required when the tracker enforces announce tokens.
+	Token *announcetoken.Token
+
+	// Load is an optional hint of how busy the announcing peer currently is.
+	Load *announceclient.LoadHint
+}
+
+// Encode encodes p into URL data.
+func (p *Params) Encode() string {
+	q := url.Values{}
+	q.Set("namespace", p.Namespace)
+	q.Set("digest", p.Digest.String())
+	for k, v := range map[string]string{
+		"hostname": p.Hostname,
+		"zone":     p.Zone,
+		"rack":     p.Rack,
+		"dc":       p.DC,
+	} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if p.Token != nil {
+		q.Set("token_nonce", p.Token.Nonce)
+		q.Set("token_timestamp", strconv.FormatInt(p.Token.Timestamp, 10))
+		q.Set("token_signature", p.Token.Signature)
+	}
+	if p.Load != nil {
+		q.Set("upload_saturation", strconv.FormatFloat(p.Load.UploadSaturation, 'g', -1, 64))
+		q.Set("disk_pressure", strconv.FormatFloat(p.Load.DiskPressure, 'g', -1, 64))
+		q.Set("uploaded", strconv.FormatInt(p.Load.Uploaded, 10))
+	}
+	return announcePath + "?" + q.Encode()
+}
+
+// DecodeParams decodes the params of URL data s.
+func DecodeParams(s string) (*Params, error) {
+	if !strings.HasPrefix(s, announcePath+"?") {
+		return nil, errors.New("url data is not an announce query")
+	}
+	q, err := url.ParseQuery(strings.TrimPrefix(s, announcePath+"?"))
+	if err != nil {
+		return nil, fmt.Errorf("parse query: %s", err)
+	}
+	d, err := core.ParseSHA256Digest(q.Get("digest"))
+	if err != nil {
+		return nil, fmt.Errorf("parse digest: %s", err)
+	}
+	p := &Params{
+		Namespace: q.Get("namespace"),
+		Digest:    d,
+		Hostname:  q.Get("hostname"),
+		Zone:      q.Get("zone"),
+		Rack:      q.Get("rack"),
+		DC:        q.Get("dc"),
+	}
+	if nonce := q.Get("token_nonce"); nonce != "" {
+		ts, err := strconv.ParseInt(q.Get("token_timestamp"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse token timestamp: %s", err)
+		}
+		p.Token = &announcetoken.Token{
+			Nonce:     nonce,
+			Timestamp: ts,
+			Signature: q.Get("token_signature"),
+		}
+	}
+	if q.Get("upload_saturation") != "" {
+		load, err := decodeLoadHint(q)
+		if err != nil {
+			return nil, fmt.Errorf("parse load hint: %s", err)
+		}
+		p.Load = load
+	}
+	return p, nil
+}
+
+func decodeLoadHint(q url.Values) (*announceclient.LoadHint, error) {
+	saturation, err := strconv.ParseFloat(q.Get("upload_saturation"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("upload saturation: %s", err)
+	}
+	pressure, err := strconv.ParseFloat(q.Get("disk_pressure"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("disk pressure: %s", err)
+	}
+	uploaded, err := strconv.ParseInt(q.Get("uploaded"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("uploaded: %s", err)
+	}
+	return &announceclient.LoadHint{
+		UploadSaturation: saturation,
+		DiskPressure:     pressure,
+		Uploaded:         uploaded,
+	}, nil
+}
@@ -0,0 +1,463 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package udptracker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/uber/kraken/core"
+)
+
+// ProtocolID is the magic constant which identifies connect requests.
+const ProtocolID int64 = 0x41727101980
+
+// Actions identify the type of each packet.
+const (
+	ActionConnect  int32 = 0
+	ActionAnnounce int32 = 1
+	ActionScrape   int32 = 2
+	ActionError    int32 = 3
+)
+
+// Announce events.
+const (
+	EventNone      int32 = 0
+	EventCompleted int32 = 1
+	EventStarted   int32 = 2
+	EventStopped   int32 = 3
+)
+
+// MaxScrapeInfoHashes is the most info hashes a single scrape may carry, such
+// that scrape responses fit in a single packet.
+const MaxScrapeInfoHashes = 74
+
+// Option types of BEP 41 announce extensions.
+const (
+	optionEndOfOptions = 0x0
+	optionNOP          = 0x1
+	optionURLData      = 0x2
+)
+
+const (
+	headerSize          = 16
+	announceRequestSize = 98
+	announceHeaderSize  = 20
+	scrapeStatsSize     = 12
+	peerIDSize          = len(core.PeerID{})
+	infoHashSize        = len(core.InfoHash{})
+	maxURLDataChunk     = 255
+)
+
+var errShortPacket = errors.New("packet too short")
+
+// Header prefixes every request.
+type Header struct {
+	ConnectionID  int64
+	Action        int32
+	TransactionID int32
+}
+
+// DecodeHeader decodes the header of request b.
+func DecodeHeader(b []byte) (Header, error) {
+	if len(b) < headerSize {
+		return Header{}, errShortPacket
+	}
+	return Header{
+		ConnectionID:  int64(binary.BigEndian.Uint64(b[0:8])),
+		Action:        int32(binary.BigEndian.Uint32(b[8:12])),
+		TransactionID: int32(binary.BigEndian.Uint32(b[12:16])),
+	}, nil
+}
+
+func (h Header) encode(b []byte) {
+	binary.BigEndian.PutUint64(b[0:8], uint64(h.ConnectionID))
+	binary.BigEndian.PutUint32(b[8:12], uint32(h.Action))
+	binary.BigEndian.PutUint32(b[12:16], uint32(h.TransactionID))
+}
+
+// EncodeConnectRequest encodes a connect request.
+func EncodeConnectRequest(transactionID int32) []byte {
+	b := make([]byte, headerSize)
+	Header{ProtocolID, ActionConnect, transactionID}.encode(b)
+	return b
+}
+
+// ConnectResponse hands out a connection id, which authenticates subsequent
+// requests from the same address.
+type ConnectResponse struct {
+	TransactionID int32
+	ConnectionID  int64
+}
+
+// Encode encodes r.
+func (r *ConnectResponse) Encode() []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint32(b[0:4], uint32(ActionConnect))
+	binary.BigEndian.PutUint32(b[4:8], uint32(r.TransactionID))
+	binary.BigEndian.PutUint64(b[8:16], uint64(r.ConnectionID))
+	return b
+}
+
+// DecodeConnectResponse decodes a connect response.
+func DecodeConnectResponse(b []byte) (*ConnectResponse, error) {
+	if err := checkAction(b, ActionConnect, 16); err != nil {
+		return nil, err
+	}
+	return &ConnectResponse{
+		TransactionID: int32(binary.BigEndian.Uint32(b[4:8])),
+		ConnectionID:  int64(binary.BigEndian.Uint64(b[8:16])),
+	}, nil
+}
+
+// AnnounceRequest defines an announce request.
+type AnnounceRequest struct {
+	Header
+
+	InfoHash   core.InfoHash
+	PeerID     core.PeerID
+	Downloaded int64
+	Left       int64
+	Uploaded   int64
+	Event      int32
+	IP         net.IP // Nil if the tracker should use the source address.
+	Key        uint32
+	NumWant    int32
+	Port       uint16
+
+	// URLData is the BEP 41 request string, i.e. the path and query an HTTP
+	// announce would have been sent to.
+	URLData string
+}
+
+// Encode encodes r.
+func (r *AnnounceRequest) Encode() []byte {
+	b := make([]byte, announceRequestSize)
+	r.Header.encode(b)
+	copy(b[16:36], r.InfoHash[:])
+	copy(b[36:56], r.PeerID[:])
+	binary.BigEndian.PutUint64(b[56:64], uint64(r.Downloaded))
+	binary.BigEndian.PutUint64(b[64:72], uint64(r.Left))
+	binary.BigEndian.PutUint64(b[72:80], uint64(r.Uploaded))
+	binary.BigEndian.PutUint32(b[80:84], uint32(r.Event))
+	if ip4 := r.IP.To4(); ip4 != nil {
+		copy(b[84:88], ip4)
+	}
+	binary.BigEndian.PutUint32(b[88:92], r.Key)
+	binary.BigEndian.PutUint32(b[92:96], uint32(r.NumWant))
+	binary.BigEndian.PutUint16(b[96:98], r.Port)
+	for data := r.URLData; len(data) > 0; {
+		n := len(data)
+		if n > maxURLDataChunk {
+			n = maxURLDataChunk
+		}
+		b = append(b, optionURLData, byte(n))
+		b = append(b, data[:n]...)
+		data = data[n:]
+	}
+	return b
+}
+
+// DecodeAnnounceRequest decodes an announce request, including its BEP 41
+// options.
+func DecodeAnnounceRequest(b []byte) (*AnnounceRequest, error) {
+	h, err := DecodeHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	if h.Action != ActionAnnounce {
+		return nil, fmt.Errorf("unexpected action %d", h.Action)
+	}
+	if len(b) < announceRequestSize {
+		return nil, errShortPacket
+	}
+	r := &AnnounceRequest{
+		Header:     h,
+		Downloaded: int64(binary.BigEndian.Uint64(b[56:64])),
+		Left:       int64(binary.BigEndian.Uint64(b[64:72])),
+		Uploaded:   int64(binary.BigEndian.Uint64(b[72:80])),
+		Event:      int32(binary.BigEndian.Uint32(b[80:84])),
+		Key:        binary.BigEndian.Uint32(b[88:92]),
+		NumWant:    int32(binary.BigEndian.Uint32(b[92:96])),
+		Port:       binary.BigEndian.Uint16(b[96:98]),
+	}
+	copy(r.InfoHash[:], b[16:36])
+	copy(r.PeerID[:], b[36:56])
+	if ip := net.IP(b[84:88]); !ip.Equal(net.IPv4zero) {
+		r.IP = net.IPv4(ip[0], ip[1], ip[2], ip[3])
+	}
+	data, err := decodeOptions(b[announceRequestSize:])
+	if err != nil {
+		return nil, fmt.Errorf("options: %s", err)
+	}
+	r.URLData = data
+	return r, nil
+}
+
+// decodeOptions returns the concatenated URL data of BEP 41 options b.
+func decodeOptions(b []byte) (string, error) {
+	var data []byte
+	for len(b) > 0 {
+		switch b[0] {
+		case optionEndOfOptions:
+			return string(data), nil
+		case optionNOP:
+			b = b[1:]
+		case optionURLData:
+			if len(b) < 2 || len(b) < 2+int(b[1]) {
+				return "", errShortPacket
+			}
+			n := int(b[1])
+			data = append(data, b[2:2+n]...)
+			b = b[2+n:]
+		default:
+			return "", fmt.Errorf("unknown option type %d", b[0])
+		}
+	}
+	return string(data), nil
+}
+
+// AnnounceResponse defines an announce response.
+type AnnounceResponse struct {
+	TransactionID int32
+	Interval      int32 // Seconds.
+	Leechers      int32
+	Seeders       int32
+	Peers         []*core.PeerInfo
+}
+
+// Encode encodes r. Peers are encoded as 6 byte IPv4 addresses, or 18 byte
+// IPv6 addresses if ipv6 is set, followed by their 20 byte peer ids if withIDs
+// is set. Peers which cannot be encoded, i.e. because they are addressed by
+// hostname or by an address of the other family, are skipped, and the number
+// skipped is returned.
+func (r *AnnounceResponse) Encode(ipv6, withIDs bool) ([]byte, int) {
+	b := make([]byte, announceHeaderSize)
+	binary.BigEndian.PutUint32(b[0:4], uint32(ActionAnnounce))
+	binary.BigEndian.PutUint32(b[4:8], uint32(r.TransactionID))
+	binary.BigEndian.PutUint32(b[8:12], uint32(r.Interval))
+	binary.BigEndian.PutUint32(b[12:16], uint32(r.Leechers))
+	binary.BigEndian.PutUint32(b[16:20], uint32(r.Seeders))
+	var skipped int
+	for _, p := range r.Peers {
+		ip := encodeIP(p.IP, ipv6)
+		if ip == nil || p.Port < 0 || p.Port > 65535 {
+			skipped++
+			continue
+		}
+		b = append(b, ip...)
+		b = append(b, byte(p.Port>>8), byte(p.Port))
+		if withIDs {
+			b = append(b, p.PeerID[:]...)
+		}
+	}
+	return b, skipped
+}
+
+func encodeIP(s string, ipv6 bool) net.IP {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	ip4 := ip.To4()
+	if ipv6 {
+		if ip4 != nil {
+			return nil
+		}
+		return ip.To16()
+	}
+	return ip4
+}
+
+// DecodeAnnounceResponse decodes an announce response encoded with the same
+// ipv6 and withIDs flags.
+func DecodeAnnounceResponse(b []byte, ipv6, withIDs bool) (*AnnounceResponse, error) {
+	if err := checkAction(b, ActionAnnounce, announceHeaderSize); err != nil {
+		return nil, err
+	}
+	r := &AnnounceResponse{
+		TransactionID: int32(binary.BigEndian.Uint32(b[4:8])),
+		Interval:      int32(binary.BigEndian.Uint32(b[8:12])),
+		Leechers:      int32(binary.BigEndian.Uint32(b[12:16])),
+		Seeders:       int32(binary.BigEndian.Uint32(b[16:20])),
+	}
+	ipLen := net.IPv4len
+	if ipv6 {
+		ipLen = net.IPv6len
+	}
+	size := ipLen + 2
+	if withIDs {
+		size += peerIDSize
+	}
+	peers := b[announceHeaderSize:]
+	if len(peers)%size != 0 {
+		return nil, fmt.Errorf("peers length %d not a multiple of %d", len(peers), size)
+	}
+	for ; len(peers) > 0; peers = peers[size:] {
+		p := &core.PeerInfo{
+			IP:   net.IP(peers[:ipLen]).String(),
+			Port: int(binary.BigEndian.Uint16(peers[ipLen : ipLen+2])),
+		}
+		if withIDs {
+			copy(p.PeerID[:], peers[ipLen+2:size])
+		}
+		r.Peers = append(r.Peers, p)
+	}
+	return r, nil
+}
+
+// ScrapeRequest defines a scrape request.
+type ScrapeRequest struct {
+	Header
+
+	InfoHashes []core.InfoHash
+}
+
+// Encode encodes r.
+func (r *ScrapeRequest) Encode() []byte {
+	b := make([]byte, headerSize, headerSize+len(r.InfoHashes)*infoHashSize)
+	r.Header.encode(b)
+	for _, h := range r.InfoHashes {
+		b = append(b, h[:]...)
+	}
+	return b
+}
+
+// DecodeScrapeRequest decodes a scrape request.
+func DecodeScrapeRequest(b []byte) (*ScrapeRequest, error) {
+	h, err := DecodeHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	if h.Action != ActionScrape {
+		return nil, fmt.Errorf("unexpected action %d", h.Action)
+	}
+	hashes := b[headerSize:]
+	if len(hashes)%infoHashSize != 0 {
+		return nil, fmt.Errorf(
+			"info hashes length %d not a multiple of %d", len(hashes), infoHashSize)
+	}
+	n := len(hashes) / infoHashSize
+	if n == 0 {
+		return nil, errors.New("no info hashes")
+	}
+	if n > MaxScrapeInfoHashes {
+		return nil, fmt.Errorf("%d info hashes exceeds %d", n, MaxScrapeInfoHashes)
+	}
+	r := &ScrapeRequest{Header: h, InfoHashes: make([]core.InfoHash, n)}
+	for i := range r.InfoHashes {
+		copy(r.InfoHashes[i][:], hashes[i*infoHashSize:])
+	}
+	return r, nil
+}
+
+// ScrapeStats describes the swarm of a single scraped torrent.
+type ScrapeStats struct {
+	Seeders   int32
+	Completed int32
+	Leechers  int32
+}
+
+// ScrapeResponse defines a scrape response. Stats are in the order of the
+// info hashes of the request.
+type ScrapeResponse struct {
+	TransactionID int32
+	Stats         []ScrapeStats
+}
+
+// Encode encodes r.
+func (r *ScrapeResponse) Encode() []byte {
+	b := make([]byte, 8+len(r.Stats)*scrapeStatsSize)
+	binary.BigEndian.PutUint32(b[0:4], uint32(ActionScrape))
+	binary.BigEndian.PutUint32(b[4:8], uint32(r.TransactionID))
+	for i, s := range r.Stats {
+		o := 8 + i*scrapeStatsSize
+		binary.BigEndian.PutUint32(b[o:o+4], uint32(s.Seeders))
+		binary.BigEndian.PutUint32(b[o+4:o+8], uint32(s.Completed))
+		binary.BigEndian.PutUint32(b[o+8:o+12], uint32(s.Leechers))
+	}
+	return b
+}
+
+// DecodeScrapeResponse decodes a scrape response.
+func DecodeScrapeResponse(b []byte) (*ScrapeResponse, error) {
+	if err := checkAction(b, ActionScrape, 8); err != nil {
+		return nil, err
+	}
+	stats := b[8:]
+	if len(stats)%scrapeStatsSize != 0 {
+		return nil, fmt.Errorf(
+			"stats length %d not a multiple of %d", len(stats), scrapeStatsSize)
+	}
+	r := &ScrapeResponse{
+		TransactionID: int32(binary.BigEndian.Uint32(b[4:8])),
+		Stats:         make([]ScrapeStats, len(stats)/scrapeStatsSize),
+	}
+	for i := range r.Stats {
+		o := i * scrapeStatsSize
+		r.Stats[i] = ScrapeStats{
+			Seeders:   int32(binary.BigEndian.Uint32(stats[o : o+4])),
+			Completed: int32(binary.BigEndian.Uint32(stats[o+4 : o+8])),
+			Leechers:  int32(binary.BigEndian.Uint32(stats[o+8 : o+12])),
+		}
+	}
+	return r, nil
+}
+
+// ErrorResponse is sent in place of any response when a request fails.
+type ErrorResponse struct {
+	TransactionID int32
+	Message       string
+}
+
+// Encode encodes r.
+func (r *ErrorResponse) Encode() []byte {
+	b := make([]byte, 8, 8+len(r.Message))
+	binary.BigEndian.PutUint32(b[0:4], uint32(ActionError))
+	binary.BigEndian.PutUint32(b[4:8], uint32(r.TransactionID))
+	return append(b, r.Message...)
+}
+
+// Error implements error.
+func (r *ErrorResponse) Error() string {
+	return fmt.Sprintf("tracker error: %s", r.Message)
+}
+
+// DecodeResponseHeader decodes the action and transaction id of response b.
+// Error responses are decoded into an *ErrorResponse error.
+func DecodeResponseHeader(b []byte) (action int32, transactionID int32, err error) {
+	if len(b) < 8 {
+		return 0, 0, errShortPacket
+	}
+	action = int32(binary.BigEndian.Uint32(b[0:4]))
+	transactionID = int32(binary.BigEndian.Uint32(b[4:8]))
+	if action == ActionError {
+		return action, transactionID, &ErrorResponse{transactionID, string(b[8:])}
+	}
+	return action, transactionID, nil
+}
+
+// checkAction checks that response b carries action and is at least size
+// bytes long.
+func checkAction(b []byte, action int32, size int) error {
+	if len(b) < size {
+		return errShortPacket
+	}
+	if a := int32(binary.BigEndian.Uint32(b[0:4])); a != action {
+		return fmt.Errorf("unexpected action %d", a)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package udptracker
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcetoken"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnounceRequestRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	req := &AnnounceRequest{
+		Header:     Header{12345, ActionAnnounce, 7},
+		InfoHash:   core.InfoHashFixture(),
+		PeerID:     core.PeerIDFixture(),
+		Downloaded: 100,
+		Left:       200,
+		Uploaded:   300,
+		Event:      EventStarted,
+		IP:         net.ParseIP("10.1.2.3"),
+		Key:        42,
+		NumWant:    -1,
+		Port:       16000,
+		// Spans multiple options.
+		URLData: "/announce?" + strings.Repeat("x", 600),
+	}
+	result, err := DecodeAnnounceRequest(req.Encode())
+	require.NoError(err)
+	require.Equal(req.URLData, result.URLData)
+	require.True(req.IP.Equal(result.IP))
+	result.IP = req.IP
+	require.Equal(req, result)
+}
+
+func TestDecodeAnnounceRequestWithoutIP(t *testing.T) {
+	require := require.New(t)
+
+	req := &AnnounceRequest{Header: Header{1, ActionAnnounce, 2}}
+	result, err := DecodeAnnounceRequest(req.Encode())
+	require.NoError(err)
+	require.Nil(result.IP)
+}
+
+func TestDecodeAnnounceRequestErrors(t *testing.T) {
+	req := &AnnounceRequest{Header: Header{1, ActionAnnounce, 2}}
+	valid := req.Encode()
+
+	tests := []struct {
+		desc string
+		b    []byte
+	}{
+		{"short header", valid[:8]},
+		{"short body", valid[:50]},
+		{"wrong action", (&ScrapeRequest{Header: Header{1, ActionScrape, 2}}).Encode()},
+		{"truncated option", append(append([]byte{}, valid...), optionURLData, 10, 'a')},
+		{"unknown option", append(append([]byte{}, valid...), 0x7)},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := DecodeAnnounceRequest(test.b)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestAnnounceResponseRoundTrip(t *testing.T) {
+	tests := []struct {
+		desc    string
+		ipv6    bool
+		withIDs bool
+		ip      string
+	}{
+		{"ipv4", false, false, "10.0.0.1"},
+		{"ipv4 with ids", false, true, "10.0.0.1"},
+		{"ipv6 with ids", true, true, "2001:db8::1"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			p := &core.PeerInfo{IP: test.ip, Port: 6881}
+			if test.withIDs {
+				p.PeerID = core.PeerIDFixture()
+			}
+			resp := &AnnounceResponse{
+				TransactionID: 3,
+				Interval:      10,
+				Leechers:      1,
+				Seeders:       2,
+				Peers: []*core.PeerInfo{
+					p,
+					{Hostname: "foo", Port: 6881}, // Not encodable.
+				},
+			}
+			b, skipped := resp.Encode(test.ipv6, test.withIDs)
+			require.Equal(1, skipped)
+
+			result, err := DecodeAnnounceResponse(b, test.ipv6, test.withIDs)
+			require.NoError(err)
+			resp.Peers = resp.Peers[:1]
+			require.Equal(resp, result)
+		})
+	}
+}
+
+func TestScrapeRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	req := &ScrapeRequest{
+		Header:     Header{1, ActionScrape, 2},
+		InfoHashes: []core.InfoHash{core.InfoHashFixture(), core.InfoHashFixture()},
+	}
+	result, err := DecodeScrapeRequest(req.Encode())
+	require.NoError(err)
+	require.Equal(req, result)
+
+	resp := &ScrapeResponse{
+		TransactionID: 2,
+		Stats:         []ScrapeStats{{1, 2, 3}, {4, 5, 6}},
+	}
+	respResult, err := DecodeScrapeResponse(resp.Encode())
+	require.NoError(err)
+	require.Equal(resp, respResult)
+}
+
+func TestDecodeScrapeRequestRejectsTooManyInfoHashes(t *testing.T) {
+	req := &ScrapeRequest{
+		Header:     Header{1, ActionScrape, 2},
+		InfoHashes: make([]core.InfoHash, MaxScrapeInfoHashes+1),
+	}
+	_, err := DecodeScrapeRequest(req.Encode())
+	require.Error(t, err)
+}
+
+func TestDecodeResponseHeaderReturnsErrorResponse(t *testing.T) {
+	require := require.New(t)
+
+	resp := &ErrorResponse{TransactionID: 9, Message: "some error"}
+	action, tid, err := DecodeResponseHeader(resp.Encode())
+	require.Equal(ActionError, action)
+	require.Equal(int32(9), tid)
+	require.Equal(resp, err)
+}
+
+func TestParamsRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	p := &Params{
+		Namespace: "some/namespace",
+		Digest:    core.DigestFixture(),
+		Hostname:  "host01",
+		Zone:      "zone1",
+		Token:     &announcetoken.Token{Nonce: "abc", Timestamp: 123, Signature: "def"},
+		Load:      &announceclient.LoadHint{UploadSaturation: 0.5, DiskPressure: 0.25, Uploaded: 1024},
+	}
+	result, err := DecodeParams(p.Encode())
+	require.NoError(err)
+	require.Equal(p, result)
+}
+
+func TestDecodeParamsErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"/scrape?digest=foo",
+		"/announce?digest=foo",
+		"/announce?digest=sha256:" + core.DigestFixture().Hex() + "&upload_saturation=x",
+	} {
+		t.Run(s, func(t *testing.T) {
+			_, err := DecodeParams(s)
+			require.Error(t, err)
+		})
+	}
+}
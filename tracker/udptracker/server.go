@@ -0,0 +1,259 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package udptracker
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/requestid"
+)
+
+// maxPacketSize bounds the size of received requests. Announces carrying URL
+// data are the largest requests.
+const maxPacketSize = 2048
+
+// Backend answers announces and scrapes, sharing storage and handout policy
+// with the HTTP tracker.
+type Backend interface {
+	// Announce answers req, which was received from addr. The transaction id
+	// of the response is set by the server.
+	Announce(ctx context.Context, req *AnnounceRequest, addr *net.UDPAddr) (*AnnounceResponse, error)
+
+	// Scrape returns the stats of each of hashes, in order.
+	Scrape(ctx context.Context, hashes []core.InfoHash) ([]ScrapeStats, error)
+}
+
+type packet struct {
+	b    []byte
+	addr *net.UDPAddr
+}
+
+// Server serves the UDP tracker protocol of BEP 15.
+type Server struct {
+	config  Config
+	stats   tally.Scope
+	backend Backend
+	ids     *connectionIDs
+	trusted []*net.IPNet
+
+	mu      sync.Mutex
+	conn    net.PacketConn
+	packets chan packet
+	wg      sync.WaitGroup
+	closed  int32
+}
+
+// New creates a new Server.
+func New(config Config, stats tally.Scope, backend Backend) (*Server, error) {
+	config = config.applyDefaults()
+
+	var trusted []*net.IPNet
+	for _, cidr := range config.TrustedSources {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted source %q: %s", cidr, err)
+		}
+		trusted = append(trusted, n)
+	}
+
+	secret := []byte(config.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	stats = stats.Tagged(map[string]string{
+		"module": "udptracker",
+	})
+	return &Server{
+		config:  config,
+		stats:   stats,
+		backend: backend,
+		ids:     newConnectionIDs(secret, config.ConnectionTTL, clock.New()),
+		trusted: trusted,
+		packets: make(chan packet, config.QueueSize),
+	}, nil
+}
+
+// ListenAndServe is a blocking call which runs s.
+func (s *Server) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	log.Infof("Starting udp tracker server on %s", conn.LocalAddr())
+	return s.Serve(conn)
+}
+
+// Serve serves requests received on conn until conn is closed.
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	for i := 0; i < s.config.Workers; i++ {
+		s.wg.Add(1)
+		go s.work(conn)
+	}
+	defer func() {
+		close(s.packets)
+		s.wg.Wait()
+	}()
+	for {
+		b := make([]byte, maxPacketSize)
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			if atomic.LoadInt32(&s.closed) == 1 {
+				return nil
+			}
+			return err
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		select {
+		case s.packets <- packet{b[:n], udpAddr}:
+		default:
+			s.stats.Counter("dropped_requests").Inc(1)
+		}
+	}
+}
+
+// Close stops s from serving, after which Serve returns once in-flight
+// requests are answered.
+func (s *Server) Close() error {
+	atomic.StoreInt32(&s.closed, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *Server) work(conn net.PacketConn) {
+	defer s.wg.Done()
+	for p := range s.packets {
+		resp := s.handle(p.b, p.addr)
+		if resp == nil {
+			continue
+		}
+		if _, err := conn.WriteTo(resp, p.addr); err != nil {
+			s.stats.Counter("write_errors").Inc(1)
+			log.With("addr", p.addr).Errorf("Error writing udp response: %s", err)
+		}
+	}
+}
+
+// handle returns the response to request b received from addr, or nil if the
+// request should be ignored.
+func (s *Server) handle(b []byte, addr *net.UDPAddr) []byte {
+	h, err := DecodeHeader(b)
+	if err != nil {
+		s.stats.Counter("malformed_requests").Inc(1)
+		return nil
+	}
+	if h.Action == ActionConnect {
+		if h.ConnectionID != ProtocolID {
+			s.stats.Counter("malformed_requests").Inc(1)
+			return nil
+		}
+		s.stats.Counter("connects").Inc(1)
+		resp := &ConnectResponse{h.TransactionID, s.ids.issue(addr.IP)}
+		return resp.Encode()
+	}
+	if !s.ids.valid(h.ConnectionID, addr.IP) {
+		s.stats.Counter("invalid_connection_ids").Inc(1)
+		return s.fail(h, "invalid connection id")
+	}
+	ctx := requestid.NewContext(context.Background(), requestid.New())
+	switch h.Action {
+	case ActionAnnounce:
+		return s.announce(ctx, b, addr, h)
+	case ActionScrape:
+		return s.scrape(ctx, b, h)
+	default:
+		s.stats.Counter("malformed_requests").Inc(1)
+		return s.fail(h, "unknown action")
+	}
+}
+
+func (s *Server) announce(ctx context.Context, b []byte, addr *net.UDPAddr, h Header) []byte {
+	req, err := DecodeAnnounceRequest(b)
+	if err != nil {
+		s.stats.Counter("malformed_requests").Inc(1)
+		return s.fail(h, "decode announce: "+err.Error())
+	}
+	if req.IP != nil && !req.IP.Equal(addr.IP) && !s.isTrusted(addr.IP) {
+		s.stats.Counter("announced_ips_ignored").Inc(1)
+		req.IP = nil
+	}
+	resp, err := s.backend.Announce(ctx, req, addr)
+	if err != nil {
+		s.stats.Counter("announce_errors").Inc(1)
+		log.With(append([]interface{}{
+			"hash", req.InfoHash,
+			"addr", addr}, requestid.LogFields(ctx)...)...).Infof("Error serving udp announce: %s", err)
+		return s.fail(h, err.Error())
+	}
+	s.stats.Counter("announces").Inc(1)
+	resp.TransactionID = h.TransactionID
+	enc, skipped := resp.Encode(addr.IP.To4() == nil, true)
+	if skipped > 0 {
+		s.stats.Counter("unencodable_peers").Inc(int64(skipped))
+	}
+	return enc
+}
+
+// isTrusted returns whether ip may announce IPs other than its own.
+func (s *Server) isTrusted(ip net.IP) bool {
+	for _, n := range s.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) scrape(ctx context.Context, b []byte, h Header) []byte {
+	req, err := DecodeScrapeRequest(b)
+	if err != nil {
+		s.stats.Counter("malformed_requests").Inc(1)
+		return s.fail(h, "decode scrape: "+err.Error())
+	}
+	stats, err := s.backend.Scrape(ctx, req.InfoHashes)
+	if err != nil {
+		s.stats.Counter("scrape_errors").Inc(1)
+		return s.fail(h, err.Error())
+	}
+	s.stats.Counter("scrapes").Inc(1)
+	resp := &ScrapeResponse{h.TransactionID, stats}
+	return resp.Encode()
+}
+
+func (s *Server) fail(h Header, msg string) []byte {
+	resp := &ErrorResponse{h.TransactionID, msg}
+	return resp.Encode()
+}
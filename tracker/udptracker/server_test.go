@@ -0,0 +1,244 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package udptracker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type fakeBackend struct {
+	mu        sync.Mutex
+	announces []*AnnounceRequest
+	peers     []*core.PeerInfo
+	err       error
+}
+
+func (b *fakeBackend) Announce(
+	ctx context.Context, req *AnnounceRequest, addr *net.UDPAddr) (*AnnounceResponse, error) {
+
+	if b.err != nil {
+		return nil, b.err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.announces = append(b.announces, req)
+	return &AnnounceResponse{Interval: 5, Peers: b.peers}, nil
+}
+
+func (b *fakeBackend) Scrape(ctx context.Context, hashes []core.InfoHash) ([]ScrapeStats, error) {
+	stats := make([]ScrapeStats, len(hashes))
+	for i := range stats {
+		stats[i] = ScrapeStats{Seeders: int32(i)}
+	}
+	return stats, nil
+}
+
+func newTestServer(t *testing.T, backend Backend) *Server {
+	s, err := New(Config{Workers: 1}, tally.NoopScope, backend)
+	require.NoError(t, err)
+	return s
+}
+
+func TestConnectionIDsExpireAfterTwoTTLs(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	ids := newConnectionIDs([]byte("secret"), time.Minute, clk)
+	ip := net.ParseIP("10.0.0.1")
+
+	id := ids.issue(ip)
+	require.True(ids.valid(id, ip))
+	require.False(ids.valid(id, net.ParseIP("10.0.0.2")))
+
+	clk.Add(time.Minute)
+	require.True(ids.valid(id, ip))
+
+	clk.Add(time.Minute)
+	require.False(ids.valid(id, ip))
+}
+
+func TestHandleRejectsInvalidConnectionID(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, &fakeBackend{})
+	addr := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6881}
+
+	req := &ScrapeRequest{
+		Header:     Header{12345, ActionScrape, 7},
+		InfoHashes: []core.InfoHash{core.InfoHashFixture()},
+	}
+	_, tid, err := DecodeResponseHeader(s.handle(req.Encode(), addr))
+	require.Equal(int32(7), tid)
+	require.Error(err)
+}
+
+func TestHandleIgnoresConnectWithoutProtocolID(t *testing.T) {
+	s := newTestServer(t, &fakeBackend{})
+	addr := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6881}
+
+	b := EncodeConnectRequest(1)
+	b[0] = 0xff
+	require.Nil(t, s.handle(b, addr))
+}
+
+func TestHandleScrape(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, &fakeBackend{})
+	addr := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6881}
+
+	connResp, err := DecodeConnectResponse(s.handle(EncodeConnectRequest(1), addr))
+	require.NoError(err)
+	require.Equal(int32(1), connResp.TransactionID)
+
+	req := &ScrapeRequest{
+		Header:     Header{connResp.ConnectionID, ActionScrape, 2},
+		InfoHashes: []core.InfoHash{core.InfoHashFixture(), core.InfoHashFixture()},
+	}
+	resp, err := DecodeScrapeResponse(s.handle(req.Encode(), addr))
+	require.NoError(err)
+	require.Equal(&ScrapeResponse{
+		TransactionID: 2,
+		Stats:         []ScrapeStats{{Seeders: 0}, {Seeders: 1}},
+	}, resp)
+}
+
+func TestHandleAnnounceIgnoresIPsOfUntrustedSources(t *testing.T) {
+	tests := []struct {
+		desc     string
+		trusted  []string
+		ip       net.IP
+		expected net.IP
+	}{
+		{"own ip", nil, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.1")},
+		{"other ip", nil, net.ParseIP("10.0.0.2"), nil},
+		{"other ip of trusted source", []string{"10.0.0.0/24"}, net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.2")},
+		{"other ip of untrusted source", []string{"10.0.1.0/24"}, net.ParseIP("10.0.0.2"), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			backend := &fakeBackend{}
+			s, err := New(Config{Workers: 1, TrustedSources: test.trusted}, tally.NoopScope, backend)
+			require.NoError(err)
+			addr := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6881}
+
+			connResp, err := DecodeConnectResponse(s.handle(EncodeConnectRequest(1), addr))
+			require.NoError(err)
+
+			req := &AnnounceRequest{
+				Header:   Header{connResp.ConnectionID, ActionAnnounce, 2},
+				InfoHash: core.InfoHashFixture(),
+				PeerID:   core.PeerIDFixture(),
+				IP:       test.ip,
+				Port:     6881,
+			}
+			_, err = DecodeAnnounceResponse(s.handle(req.Encode(), addr), false, true)
+			require.NoError(err)
+
+			require.Len(backend.announces, 1)
+			if test.expected == nil {
+				require.Nil(backend.announces[0].IP)
+			} else {
+				require.True(test.expected.Equal(backend.announces[0].IP))
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidTrustedSources(t *testing.T) {
+	_, err := New(Config{TrustedSources: []string{"10.0.0.1"}}, tally.NoopScope, &fakeBackend{})
+	require.Error(t, err)
+}
+
+func TestClientAnnounce(t *testing.T) {
+	require := require.New(t)
+
+	peers := []*core.PeerInfo{
+		{PeerID: core.PeerIDFixture(), IP: "10.0.0.1", Port: 6881},
+		{PeerID: core.PeerIDFixture(), IP: "10.0.0.2", Port: 6882},
+	}
+	backend := &fakeBackend{peers: peers}
+	s := newTestServer(t, backend)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(err)
+	go s.Serve(conn)
+	defer s.Close()
+
+	pctx := core.PeerContextFixture()
+	client := NewClient(ClientConfig{Addr: conn.LocalAddr().String()}, pctx)
+
+	namespace := core.NamespaceFixture()
+	blob := core.NewBlobFixture()
+
+	for i := 0; i < 2; i++ {
+		result, interval, err := client.Announce(
+			namespace, blob.Digest, blob.MetaInfo.InfoHash(), true, 0)
+		require.NoError(err)
+		require.Equal(peers, result)
+		require.Equal(5*time.Second, interval)
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	require.Len(backend.announces, 2)
+	req := backend.announces[0]
+	require.Equal(blob.MetaInfo.InfoHash(), req.InfoHash)
+	require.Equal(pctx.PeerID, req.PeerID)
+	require.Equal(int64(0), req.Left)
+	require.Equal(uint16(pctx.Port), req.Port)
+
+	params, err := DecodeParams(req.URLData)
+	require.NoError(err)
+	require.Equal(namespace, params.Namespace)
+	require.Equal(blob.Digest, params.Digest)
+}
+
+func TestClientAnnounceReturnsTrackerError(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, &fakeBackend{err: errors.New("some error")})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(err)
+	go s.Serve(conn)
+	defer s.Close()
+
+	client := NewClient(ClientConfig{Addr: conn.LocalAddr().String()}, core.PeerContextFixture())
+
+	blob := core.NewBlobFixture()
+	_, _, err = client.Announce(
+		core.NamespaceFixture(), blob.Digest, blob.MetaInfo.InfoHash(), false, 0)
+	require.Equal(&ErrorResponse{Message: "some error"}, errWithoutTransactionID(err))
+}
+
+func errWithoutTransactionID(err error) error {
+	if e, ok := err.(*ErrorResponse); ok {
+		return &ErrorResponse{Message: e.Message}
+	}
+	return err
+}
@@ -16,6 +16,9 @@ package bandwidth
 import (
 	"errors"
 	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uber/kraken/utils/log"
@@ -45,12 +48,24 @@ func (c Config) applyDefaults() Config {
 	return c
 }
 
+// _saturationWindow is the minimum duration over which egress saturation is
+// measured.
+const _saturationWindow = 10 * time.Second
+
 // Limiter limits egress and ingress bandwidth via token-bucket rate limiter.
 type Limiter struct {
+	// Accessed atomically. Must be first for 64-bit alignment.
+	egressBytes      int64
+	totalEgressBytes int64
+
 	config  Config
 	egress  *rate.Limiter
 	ingress *rate.Limiter
 	logger  *zap.SugaredLogger
+
+	mu          sync.Mutex
+	windowStart time.Time
+	saturation  float64
 }
 
 // Option allows setting optional parameters in Limiter.
@@ -66,8 +81,9 @@ func NewLimiter(config Config, opts ...Option) (*Limiter, error) {
 	config = config.applyDefaults()
 
 	l := &Limiter{
-		config: config,
-		logger: log.Default(),
+		config:      config,
+		logger:      log.Default(),
+		windowStart: time.Now(),
 	}
 	for _, opt := range opts {
 		opt(l)
@@ -119,6 +135,8 @@ func (l *Limiter) reserve(rl *rate.Limiter, nbytes int64) error {
 // ReserveEgress blocks until egress bandwidth for nbytes is available.
 // Returns error if nbytes is larger than the maximum egress bandwidth.
 func (l *Limiter) ReserveEgress(nbytes int64) error {
+	atomic.AddInt64(&l.egressBytes, nbytes)
+	atomic.AddInt64(&l.totalEgressBytes, nbytes)
 	return l.reserve(l.egress, nbytes)
 }
 
@@ -145,6 +163,31 @@ func (l *Limiter) Adjust(denominator int) error {
 	return nil
 }
 
+// EgressSaturation returns the fraction of the configured egress bandwidth
+// which was reserved over the most recent measurement window. Returns 0 if no
+// egress bandwidth is configured.
+func (l *Limiter) EgressSaturation() float64 {
+	if l.config.EgressBitsPerSec == 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if elapsed := now.Sub(l.windowStart); elapsed >= _saturationWindow {
+		bits := float64(atomic.SwapInt64(&l.egressBytes, 0) * 8)
+		l.saturation = math.Min(1, bits/(float64(l.config.EgressBitsPerSec)*elapsed.Seconds()))
+		l.windowStart = now
+	}
+	return l.saturation
+}
+
+// TotalEgressBytes returns the number of egress bytes reserved since l was
+// created.
+func (l *Limiter) TotalEgressBytes() int64 {
+	return atomic.LoadInt64(&l.totalEgressBytes)
+}
+
 // EgressLimit returns the current egress limit.
 func (l *Limiter) EgressLimit() int64 {
 	return int64(l.egress.Limit())
@@ -73,6 +73,26 @@ func TestLimiterDisabled(t *testing.T) {
 	require.NoError(reserve(l, 1, ingress))
 }
 
+func TestLimiterTotalEgressBytes(t *testing.T) {
+	require := require.New(t)
+
+	l, err := NewLimiter(Config{
+		EgressBitsPerSec:  800,
+		IngressBitsPerSec: 800,
+		TokenSize:         1,
+		Enable:            false,
+	})
+	require.NoError(err)
+
+	require.NoError(l.ReserveEgress(10))
+	require.NoError(l.ReserveEgress(5))
+	require.NoError(l.ReserveIngress(7))
+
+	// Measuring saturation does not reset the total.
+	l.EgressSaturation()
+	require.Equal(int64(15), l.TotalEgressBytes())
+}
+
 func TestLimiterReserveConcurrency(t *testing.T) {
 	t.Parallel()
 
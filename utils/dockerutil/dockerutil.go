@@ -14,39 +14,95 @@
 package dockerutil
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 
-	"github.com/uber/kraken/core"
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
 	"github.com/docker/distribution/manifest/schema2"
+	"github.com/uber/kraken/core"
+)
+
+// OCI media types of image manifests and image indexes, which OCI manifests
+// may omit.
+const (
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
 )
 
-// ParseManifestV2 returns a parsed v2 manifest and its digest
+// OCI media types of image configs and layers.
+const (
+	MediaTypeOCIConfig                    = "application/vnd.oci.image.config.v1+json"
+	MediaTypeOCILayer                     = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeOCILayerGzip                 = "application/vnd.oci.image.layer.v1.tar+gzip"
+	MediaTypeOCILayerZstd                 = "application/vnd.oci.image.layer.v1.tar+zstd"
+	MediaTypeOCINondistributableLayer     = "application/vnd.oci.image.layer.nondistributable.v1.tar"
+	MediaTypeOCINondistributableLayerGzip = "application/vnd.oci.image.layer.nondistributable.v1.tar+gzip"
+	MediaTypeOCINondistributableLayerZstd = "application/vnd.oci.image.layer.nondistributable.v1.tar+zstd"
+)
+
+var _ociLayerTypes = map[string]bool{
+	MediaTypeOCILayer:                     true,
+	MediaTypeOCILayerGzip:                 true,
+	MediaTypeOCILayerZstd:                 true,
+	MediaTypeOCINondistributableLayer:     true,
+	MediaTypeOCINondistributableLayerGzip: true,
+	MediaTypeOCINondistributableLayerZstd: true,
+}
+
+// ManifestMediaTypes lists the media types of all manifests ParseManifest
+// supports, e.g. for Accept headers.
+var ManifestMediaTypes = []string{
+	schema2.MediaTypeManifest,
+	manifestlist.MediaTypeManifestList,
+	MediaTypeOCIManifest,
+	MediaTypeOCIIndex,
+}
+
+// ParseManifestV2 returns a parsed docker schema2 or OCI image manifest, and
+// its digest. Manifest lists and image indexes are rejected.
 func ParseManifestV2(r io.Reader) (distribution.Manifest, core.Digest, error) {
-	b, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, core.Digest{}, fmt.Errorf("read: %s", err)
-	}
-	manifest, desc, err := distribution.UnmarshalManifest(schema2.MediaTypeManifest, b)
+	manifest, d, err := ParseManifest(r)
 	if err != nil {
-		return nil, core.Digest{}, fmt.Errorf("unmarshal manifest: %s", err)
+		return nil, core.Digest{}, err
 	}
-	deserializedManifest, ok := manifest.(*schema2.DeserializedManifest)
-	if !ok {
-		return nil, core.Digest{}, errors.New("expected schema2.DeserializedManifest")
+	if IsManifestList(manifest) {
+		return nil, core.Digest{}, errors.New("expected image manifest, got manifest list")
 	}
-	version := deserializedManifest.Manifest.Versioned.SchemaVersion
-	if version != 2 {
-		return nil, core.Digest{}, fmt.Errorf("unsupported manifest version: %d", version)
+	return manifest, d, nil
+}
+
+// ManifestLayers returns the layers of the image manifest m.
+func ManifestLayers(m distribution.Manifest) ([]distribution.Descriptor, error) {
+	switch dm := m.(type) {
+	case *schema2.DeserializedManifest:
+		return dm.Layers, nil
+	case *ocischema.DeserializedManifest:
+		return dm.Layers, nil
+	default:
+		return nil, fmt.Errorf("unsupported manifest type %T", m)
 	}
-	d, err := core.ParseSHA256Digest(string(desc.Digest))
+}
+
+// ManifestAnnotations returns the annotations of the image manifest m.
+// Schema2 manifests do not model annotations, but OCI tooling may still set
+// them, so they are read from the raw payload of either manifest type.
+func ManifestAnnotations(m distribution.Manifest) (map[string]string, error) {
+	_, payload, err := m.Payload()
 	if err != nil {
-		return nil, core.Digest{}, fmt.Errorf("parse digest: %s", err)
+		return nil, fmt.Errorf("payload: %s", err)
 	}
-	return manifest, d, nil
+	var annotated struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(payload, &annotated); err != nil {
+		return nil, fmt.Errorf("unmarshal annotations: %s", err)
+	}
+	return annotated.Annotations, nil
 }
 
 // GetManifestReferences returns a list of references by a V2 manifest
@@ -61,3 +117,103 @@ func GetManifestReferences(manifest distribution.Manifest) ([]core.Digest, error
 	}
 	return refs, nil
 }
+
+// ParseManifest returns a parsed docker schema2 manifest, OCI image manifest,
+// docker manifest list or OCI image index, and its digest. Manifest lists and
+// image indexes are returned as *manifestlist.DeserializedManifestList, and
+// must only reference image manifests.
+func ParseManifest(r io.Reader) (distribution.Manifest, core.Digest, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("read: %s", err)
+	}
+	mediaType, err := manifestMediaType(b)
+	if err != nil {
+		return nil, core.Digest{}, err
+	}
+	manifest, desc, err := distribution.UnmarshalManifest(mediaType, b)
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("unmarshal manifest: %s", err)
+	}
+	switch m := manifest.(type) {
+	case *schema2.DeserializedManifest:
+	case *ocischema.DeserializedManifest:
+		if err := validateOCIManifest(m); err != nil {
+			return nil, core.Digest{}, err
+		}
+	case *manifestlist.DeserializedManifestList:
+		if err := validateManifestList(m); err != nil {
+			return nil, core.Digest{}, err
+		}
+	default:
+		return nil, core.Digest{}, fmt.Errorf("unsupported manifest type %T", manifest)
+	}
+	d, err := core.ParseSHA256Digest(string(desc.Digest))
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("parse digest: %s", err)
+	}
+	return manifest, d, nil
+}
+
+// IsManifestList returns whether m is a manifest list or image index.
+func IsManifestList(m distribution.Manifest) bool {
+	_, ok := m.(*manifestlist.DeserializedManifestList)
+	return ok
+}
+
+// manifestMediaType returns the media type of the manifest b. OCI manifests
+// may omit their media type, in which case image indexes are told apart from
+// image manifests by their manifests field.
+func manifestMediaType(b []byte) (string, error) {
+	var v struct {
+		SchemaVersion int             `json:"schemaVersion"`
+		MediaType     string          `json:"mediaType"`
+		Manifests     json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", fmt.Errorf("unmarshal manifest: %s", err)
+	}
+	if v.SchemaVersion != 2 {
+		return "", fmt.Errorf("unsupported manifest version: %d", v.SchemaVersion)
+	}
+	if v.MediaType != "" {
+		return v.MediaType, nil
+	}
+	if v.Manifests != nil {
+		return MediaTypeOCIIndex, nil
+	}
+	return MediaTypeOCIManifest, nil
+}
+
+// validateOCIManifest checks that m references an OCI image config and OCI
+// layers, such that artifacts which are not images are rejected.
+func validateOCIManifest(m *ocischema.DeserializedManifest) error {
+	if m.Config.MediaType != MediaTypeOCIConfig {
+		return fmt.Errorf("unsupported config media type %q in oci manifest", m.Config.MediaType)
+	}
+	for _, desc := range m.Layers {
+		if !_ociLayerTypes[desc.MediaType] {
+			return fmt.Errorf("unsupported layer media type %q in oci manifest", desc.MediaType)
+		}
+	}
+	return nil
+}
+
+// validateManifestList checks that every manifest referenced by l is an image
+// manifest with a sha256 digest. Nested lists are not supported.
+func validateManifestList(l *manifestlist.DeserializedManifestList) error {
+	if len(l.Manifests) == 0 {
+		return errors.New("manifest list references no manifests")
+	}
+	for _, desc := range l.Manifests {
+		switch desc.MediaType {
+		case schema2.MediaTypeManifest, MediaTypeOCIManifest:
+		default:
+			return fmt.Errorf("unsupported media type %q in manifest list", desc.MediaType)
+		}
+		if _, err := core.ParseSHA256Digest(string(desc.Digest)); err != nil {
+			return fmt.Errorf("parse digest: %s", err)
+		}
+	}
+	return nil
+}
@@ -15,6 +15,7 @@ package dockerutil
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/uber/kraken/core"
 )
@@ -50,3 +51,61 @@ func ManifestFixture(config core.Digest, layer1 core.Digest, layer2 core.Digest)
 
 	return d, raw
 }
+
+// OCIManifestFixture creates an OCI image manifest blob for testing purposes.
+// Like manifests built by some OCI tooling, it omits its media type.
+func OCIManifestFixture(config core.Digest, layer1 core.Digest, layer2 core.Digest) (core.Digest, []byte) {
+	raw := []byte(fmt.Sprintf(`{
+	   "schemaVersion": 2,
+	   "config": {
+		  "mediaType": "application/vnd.oci.image.config.v1+json",
+		  "size": 2940,
+		  "digest": "%s"
+	   },
+	   "layers": [
+		  {
+			 "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			 "size": 1902063,
+			 "digest": "%s"
+		  },
+		  {
+			 "mediaType": "application/vnd.oci.image.layer.v1.tar+zstd",
+			 "size": 2345077,
+			 "digest": "%s"
+		  }
+	   ]
+	}`, config, layer1, layer2))
+
+	d, err := core.NewDigester().FromBytes(raw)
+	if err != nil {
+		panic(err)
+	}
+
+	return d, raw
+}
+
+// ManifestListFixture creates a manifest list blob referencing manifests for
+// testing purposes.
+func ManifestListFixture(manifests ...core.Digest) (core.Digest, []byte) {
+	var descs []string
+	for i, m := range manifests {
+		descs = append(descs, fmt.Sprintf(`{
+		  "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+		  "size": 528,
+		  "digest": "%s",
+		  "platform": {"architecture": "arch%d", "os": "linux"}
+	   }`, m, i))
+	}
+	raw := []byte(fmt.Sprintf(`{
+	   "schemaVersion": 2,
+	   "mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+	   "manifests": [%s]
+	}`, strings.Join(descs, ",")))
+
+	d, err := core.NewDigester().FromBytes(raw)
+	if err != nil {
+		panic(err)
+	}
+
+	return d, raw
+}
@@ -13,7 +13,10 @@
 // limitations under the License.
 package errutil
 
-import "bytes"
+import (
+	"bytes"
+	"errors"
+)
 
 // MultiError defines a list of multiple errors. Useful for type assertions and
 // inspecting individual errors.
@@ -40,3 +43,70 @@ func Join(errs []error) error {
 	}
 	return MultiError(errs)
 }
+
+// OpError annotates an error with the operation which failed and, optionally,
+// the key and backend the operation was performed against. The underlying
+// error remains inspectable via errors.Is and errors.As.
+type OpError struct {
+	Op      string
+	Key     string
+	Backend string
+	Err     error
+}
+
+func (e *OpError) Error() string {
+	var b bytes.Buffer
+	b.WriteString(e.Op)
+	if e.Key != "" {
+		b.WriteString(" ")
+		b.WriteString(e.Key)
+	}
+	if e.Backend != "" {
+		b.WriteString(" (backend ")
+		b.WriteString(e.Backend)
+		b.WriteString(")")
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Wrap annotates err with op and key. Returns nil if err is nil.
+func Wrap(err error, op, key string) error {
+	if err == nil {
+		return nil
+	}
+	return &OpError{Op: op, Key: key, Err: err}
+}
+
+// WrapBackend annotates err with op, key and backend. Returns nil if err is
+// nil.
+func WrapBackend(err error, backend, op, key string) error {
+	if err == nil {
+		return nil
+	}
+	return &OpError{Op: op, Key: key, Backend: backend, Err: err}
+}
+
+// Fields returns the context of the outermost OpError within err as key-value
+// pairs suitable for structured logging. Returns nil if err carries no
+// context.
+func Fields(err error) []interface{} {
+	var e *OpError
+	if !errors.As(err, &e) {
+		return nil
+	}
+	fields := []interface{}{"op", e.Op}
+	if e.Key != "" {
+		fields = append(fields, "key", e.Key)
+	}
+	if e.Backend != "" {
+		fields = append(fields, "backend", e.Backend)
+	}
+	return fields
+}
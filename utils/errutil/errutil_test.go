@@ -57,3 +57,48 @@ func TestJoinNonNil(t *testing.T) {
 	}
 	require.Error(t, f())
 }
+
+func TestWrapNil(t *testing.T) {
+	require.NoError(t, Wrap(nil, "download", "foo"))
+	require.NoError(t, WrapBackend(nil, "s3", "download", "foo"))
+}
+
+func TestOpError(t *testing.T) {
+	cause := errors.New("some error")
+
+	tests := []struct {
+		description string
+		err         error
+		result      string
+		fields      []interface{}
+	}{
+		{
+			"op and key",
+			Wrap(cause, "download", "foo"),
+			"download foo: some error",
+			[]interface{}{"op", "download", "key", "foo"},
+		}, {
+			"op, key and backend",
+			WrapBackend(cause, "s3", "download", "foo"),
+			"download foo (backend s3): some error",
+			[]interface{}{"op", "download", "key", "foo", "backend", "s3"},
+		}, {
+			"op only",
+			Wrap(cause, "list", ""),
+			"list: some error",
+			[]interface{}{"op", "list"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require := require.New(t)
+			require.Equal(test.result, test.err.Error())
+			require.True(errors.Is(test.err, cause))
+			require.Equal(test.fields, Fields(test.err))
+		})
+	}
+}
+
+func TestFieldsWithoutContext(t *testing.T) {
+	require.Nil(t, Fields(errors.New("some error")))
+}
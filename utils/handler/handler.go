@@ -14,10 +14,13 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/requestid"
 )
 
 // Error defines an HTTP handler error which encapsulates status and headers
@@ -70,14 +73,19 @@ func (e *Error) Error() string {
 type ErrHandler func(http.ResponseWriter, *http.Request) error
 
 // Wrap converts an ErrHandler into an http.HandlerFunc by handling the error
-// returned by h.
+// returned by h. If the error wraps an *Error, e.g. within an
+// errutil.OpError, the status and headers of the *Error are used. Context
+// carried by errutil.OpError is included in logs. If the request carries a
+// request id, it is included in logs and error bodies.
 func Wrap(h ErrHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var status int
 		var errMsg string
+		var fields []interface{}
+		id := requestid.FromContext(r.Context())
 		if err := h(w, r); err != nil {
-			switch e := err.(type) {
-			case *Error:
+			var e *Error
+			if errors.As(err, &e) {
 				for k, vs := range e.header {
 					for _, v := range vs {
 						w.Header().Add(k, v)
@@ -85,17 +93,24 @@ func Wrap(h ErrHandler) http.HandlerFunc {
 				}
 				status = e.status
 				errMsg = e.msg
-			default:
+			} else {
 				status = http.StatusInternalServerError
-				errMsg = e.Error()
+				errMsg = err.Error()
+			}
+			fields = append(errutil.Fields(err), requestid.LogFields(r.Context())...)
+			body := errMsg
+			if body != "" && id != "" {
+				body = fmt.Sprintf("%s (request id %s)", body, id)
 			}
 			w.WriteHeader(status)
-			w.Write([]byte(errMsg))
+			if _, err := w.Write([]byte(body)); err != nil {
+				log.With(fields...).Errorf("Error writing %d response: %s", status, err)
+			}
 		} else {
 			status = http.StatusOK
 		}
 		if status >= 400 && status != 404 {
-			log.Infof("%d %s %s %s", status, r.Method, r.URL.Path, errMsg)
+			log.With(fields...).Infof("%d %s %s %s", status, r.Method, r.URL.Path, errMsg)
 		}
 	}
 }
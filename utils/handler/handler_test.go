@@ -0,0 +1,80 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uber/kraken/utils/errutil"
+	"github.com/uber/kraken/utils/requestid"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		description string
+		err         error
+		status      int
+		body        string
+	}{
+		{"no error", nil, http.StatusOK, ""},
+		{"plain error", errors.New("some error"), http.StatusInternalServerError, "some error"},
+		{"handler error", Errorf("bad input").Status(http.StatusBadRequest), http.StatusBadRequest, "bad input"},
+		{
+			"wrapped handler error",
+			errutil.Wrap(Errorf("not here").Status(http.StatusNotFound), "stat", "foo"),
+			http.StatusNotFound,
+			"not here",
+		}, {
+			"wrapped plain error",
+			errutil.WrapBackend(errors.New("timeout"), "s3", "download", "foo"),
+			http.StatusInternalServerError,
+			"download foo (backend s3): timeout",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require := require.New(t)
+
+			h := Wrap(func(w http.ResponseWriter, r *http.Request) error { return test.err })
+
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest("GET", "/", nil))
+
+			require.Equal(test.status, rec.Code)
+			require.Equal(test.body, rec.Body.String())
+		})
+	}
+}
+
+func TestWrapIncludesRequestID(t *testing.T) {
+	require := require.New(t)
+
+	h := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		return Errorf("bad input").Status(http.StatusBadRequest)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(requestid.NewContext(req.Context(), "abc123"))
+
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	require.Equal(http.StatusBadRequest, rec.Code)
+	require.Equal("bad input (request id abc123)", rec.Body.String())
+}
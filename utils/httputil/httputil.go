@@ -105,6 +105,12 @@ func IsForbidden(err error) bool {
 	return IsStatus(err, http.StatusForbidden)
 }
 
+// IsInsufficientStorage returns true if err is a "insufficient storage"
+// StatusError, i.e. the server is running out of disk space.
+func IsInsufficientStorage(err error) bool {
+	return IsStatus(err, http.StatusInsufficientStorage)
+}
+
 func isRetryable(code int) bool {
 	_, ok := retryableCodes[code]
 	return ok
@@ -141,6 +147,7 @@ type sendOptions struct {
 	redirect      func(req *http.Request, via []*http.Request) error
 	retry         retryOptions
 	transport     http.RoundTripper
+	proxy         *Proxy
 	ctx           context.Context
 
 	// This is not a valid http option. It provides a way to override
@@ -254,6 +261,19 @@ func SendTLS(config *tls.Config) SendOption {
 	}
 }
 
+// SendTLSNoFallback is SendTLS for servers which must only be reached over
+// TLS, i.e. failed https requests are not retried over http. No-op if config
+// is nil.
+func SendTLSNoFallback(config *tls.Config) SendOption {
+	return func(o *sendOptions) {
+		if config == nil {
+			return
+		}
+		SendTLS(config)(o)
+		o.httpFallbackDisabled = true
+	}
+}
+
 // SendTLSTransport sets the transport with TLS config for the HTTP client.
 func SendTLSTransport(transport http.RoundTripper) SendOption {
 	return func(o *sendOptions) {
@@ -262,6 +282,12 @@ func SendTLSTransport(transport http.RoundTripper) SendOption {
 	}
 }
 
+// SendProxy routes the request through proxy. Applies to the default
+// transport and to transports set by SendTLS. No-op if proxy is nil.
+func SendProxy(proxy *Proxy) SendOption {
+	return func(o *sendOptions) { o.proxy = proxy }
+}
+
 // SendTransport sets the transport for the HTTP client.
 func SendTransport(transport http.RoundTripper) SendOption {
 	return func(o *sendOptions) { o.transport = transport }
@@ -292,6 +318,7 @@ func Send(method, rawurl string, options ...SendOption) (*http.Response, error)
 	for _, o := range options {
 		o(opts)
 	}
+	opts.transport = opts.proxy.wrap(opts.transport)
 
 	req, err := newRequest(method, opts)
 	if err != nil {
@@ -0,0 +1,146 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package httputil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig defines an egress proxy for outbound requests.
+type ProxyConfig struct {
+	// URL is the address of the proxy. http:// and https:// proxies forward
+	// plain http requests and tunnel https requests with CONNECT. socks5://
+	// proxies tunnel all requests.
+	URL string `yaml:"url"`
+
+	// NoProxy lists destinations which are reached directly, in NO_PROXY
+	// format: hostnames, domain suffixes (".example.com"), ips and cidrs, each
+	// with an optional port. Loopback destinations are always reached
+	// directly.
+	NoProxy []string `yaml:"no_proxy"`
+}
+
+// Build creates a Proxy from c. Returns nil if no proxy is configured.
+func (c ProxyConfig) Build() (*Proxy, error) {
+	if c.URL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse proxy url: %s", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy url %q has no host", c.URL)
+	}
+	config := &httpproxy.Config{
+		HTTPProxy:  c.URL,
+		HTTPSProxy: c.URL,
+		NoProxy:    strings.Join(c.NoProxy, ","),
+	}
+	return &Proxy{proxy: config.ProxyFunc()}, nil
+}
+
+// ProxiesConfig maps remote addresses to the proxies used to reach them.
+type ProxiesConfig map[string]ProxyConfig
+
+// Build creates Proxies from c.
+func (c ProxiesConfig) Build() (map[string]*Proxy, error) {
+	proxies := make(map[string]*Proxy)
+	for addr, config := range c {
+		p, err := config.Build()
+		if err != nil {
+			return nil, fmt.Errorf("proxy of %s: %s", addr, err)
+		}
+		if p != nil {
+			proxies[addr] = p
+		}
+	}
+	return proxies, nil
+}
+
+// Proxy routes outbound requests through an egress proxy. The nil Proxy sends
+// requests directly.
+type Proxy struct {
+	proxy func(*url.URL) (*url.URL, error)
+
+	transportOnce sync.Once
+	transport     *http.Transport
+}
+
+// Func returns the proxy selection function of p, for use in
+// http.Transport.Proxy.
+func (p *Proxy) Func() func(*http.Request) (*url.URL, error) {
+	if p == nil {
+		return nil
+	}
+	return func(r *http.Request) (*url.URL, error) {
+		return p.proxy(r.URL)
+	}
+}
+
+// Transport returns a shared transport which routes requests through p, and
+// is otherwise identical to http.DefaultTransport.
+func (p *Proxy) Transport() *http.Transport {
+	if p == nil {
+		return http.DefaultTransport.(*http.Transport)
+	}
+	p.transportOnce.Do(func() {
+		p.transport = http.DefaultTransport.(*http.Transport).Clone()
+		p.transport.Proxy = p.Func()
+	})
+	return p.transport
+}
+
+// NewTransport returns a transport which verifies servers with tlsConfig and
+// routes requests through proxy, and is otherwise identical to
+// http.DefaultTransport. Either may be nil.
+func NewTransport(tlsConfig *tls.Config, proxy *Proxy) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	if proxy != nil {
+		t.Proxy = proxy.Func()
+	}
+	return t
+}
+
+// wrap returns a transport which routes requests through p, based on rt.
+// Transports which are not an *http.Transport cannot be proxied, and are
+// returned unchanged. Such transports must be configured with Func directly.
+func (p *Proxy) wrap(rt http.RoundTripper) http.RoundTripper {
+	if p == nil {
+		return rt
+	}
+	switch t := rt.(type) {
+	case nil:
+		return p.Transport()
+	case *http.Transport:
+		t = t.Clone()
+		t.Proxy = p.Func()
+		return t
+	default:
+		return rt
+	}
+}
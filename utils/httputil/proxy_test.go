@@ -0,0 +1,170 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package httputil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProxy records the requests it receives. Plain http requests are answered
+// directly, and CONNECT requests are refused.
+type fakeProxy struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (p *fakeProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.requests = append(p.requests, fmt.Sprintf("%s %s", r.Method, r.Host))
+	p.mu.Unlock()
+
+	if r.Method == http.MethodConnect {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	fmt.Fprint(w, "proxied")
+}
+
+func (p *fakeProxy) received() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.requests...)
+}
+
+func TestProxyConfigBuild(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config ProxyConfig
+		nilOK  bool
+		err    bool
+	}{
+		{"empty", ProxyConfig{}, true, false},
+		{"http", ProxyConfig{URL: "http://proxy:3128"}, false, false},
+		{"socks5", ProxyConfig{URL: "socks5://proxy:1080"}, false, false},
+		{"unsupported scheme", ProxyConfig{URL: "ftp://proxy:21"}, false, true},
+		{"no host", ProxyConfig{URL: "http://"}, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			p, err := test.config.Build()
+			if test.err {
+				require.Error(err)
+				return
+			}
+			require.NoError(err)
+			require.Equal(test.nilOK, p == nil)
+		})
+	}
+}
+
+func TestProxyNoProxy(t *testing.T) {
+	require := require.New(t)
+
+	p, err := ProxyConfig{
+		URL:     "http://proxy:3128",
+		NoProxy: []string{".internal.example.com", "10.0.0.0/8"},
+	}.Build()
+	require.NoError(err)
+
+	for target, proxied := range map[string]bool{
+		"https://s3.amazonaws.com/bucket":     true,
+		"http://origin.internal.example.com/": false,
+		"http://10.1.2.3:8080/":               false,
+		"http://localhost:8080/":              false,
+	} {
+		u, err := url.Parse(target)
+		require.NoError(err)
+
+		result, err := p.Func()(&http.Request{URL: u})
+		require.NoError(err)
+		if proxied {
+			require.Equal("proxy:3128", result.Host, target)
+		} else {
+			require.Nil(result, target)
+		}
+	}
+}
+
+func TestSendProxyForwardsHTTP(t *testing.T) {
+	require := require.New(t)
+
+	fp := &fakeProxy{}
+	addr, stop := testutil.StartServer(fp)
+	defer stop()
+
+	p, err := ProxyConfig{URL: "http://" + addr}.Build()
+	require.NoError(err)
+
+	resp, err := Get("http://backend.example.com/blobs", SendProxy(p))
+	require.NoError(err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal("proxied", string(b))
+
+	require.Equal([]string{"GET backend.example.com"}, fp.received())
+}
+
+func TestSendProxyTunnelsHTTPS(t *testing.T) {
+	require := require.New(t)
+
+	fp := &fakeProxy{}
+	addr, stop := testutil.StartServer(fp)
+	defer stop()
+
+	p, err := ProxyConfig{URL: "http://" + addr}.Build()
+	require.NoError(err)
+
+	config, cleanup := genCerts(t)
+	defer cleanup()
+	tls, err := config.BuildClient()
+	require.NoError(err)
+
+	// The fake proxy refuses to tunnel, but must have been asked to.
+	_, err = Get(
+		"http://backend.example.com/blobs",
+		SendTLS(tls),
+		SendProxy(p),
+		DisableHTTPFallback())
+	require.Error(err)
+
+	require.Equal([]string{"CONNECT backend.example.com:443"}, fp.received())
+}
+
+func TestSendNilProxyIsNoop(t *testing.T) {
+	require := require.New(t)
+
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "direct")
+	}))
+	defer stop()
+
+	resp, err := Get("http://"+addr+"/", SendProxy(nil))
+	require.NoError(err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal("direct", string(b))
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"time"
 
 	"github.com/uber/kraken/utils/log"
 )
@@ -36,6 +37,14 @@ type TLSConfig struct {
 	Client X509Pair `yaml:"client"`
 	CAs    []Secret `yaml:"cas"`
 
+	// ReloadInterval is how often client certs and CAs are reloaded from
+	// disk. Zero disables reloading.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+
+	// RotationOverlap is how long the previous client cert and CAs remain
+	// accepted after a reload picks up new ones. Defaults to 1h.
+	RotationOverlap time.Duration `yaml:"rotation_overlap"`
+
 	// Lazy init.
 	tls *tls.Config
 }
@@ -63,6 +72,14 @@ func (c *TLSConfig) BuildClient() (*tls.Config, error) {
 	if c.tls != nil {
 		return c.tls, nil
 	}
+	if c.ReloadInterval > 0 {
+		config, err := c.buildRotatingClient()
+		if err != nil {
+			return nil, fmt.Errorf("build rotating client: %s", err)
+		}
+		c.tls = config
+		return c.tls, nil
+	}
 
 	var caPool *x509.CertPool
 	var certs []tls.Certificate
@@ -98,6 +115,130 @@ func (c *TLSConfig) BuildClient() (*tls.Config, error) {
 	return c.tls, nil
 }
 
+// BuildServer builds tls.Config for servers which terminate TLS themselves
+// rather than behind nginx. Clients must present certificates signed by one of
+// the configured CAs. Returns nil if server TLS is disabled.
+func (c *TLSConfig) BuildServer() (*tls.Config, error) {
+	if c.Server.Disabled {
+		log.Infof("Server TLS is disabled")
+		return nil, nil
+	}
+	if c.Server.Cert.Path == "" {
+		return nil, errors.New("server cert required")
+	}
+	if len(c.CAs) == 0 {
+		return nil, errors.New("cas required to verify clients")
+	}
+	certPEM, err := parseCert(c.Server.Cert.Path)
+	if err != nil {
+		return nil, fmt.Errorf("parse server cert: %s", err)
+	}
+	keyPEM, err := parseKey(c.Server.Key.Path, c.Server.Passphrase.Path)
+	if err != nil {
+		return nil, fmt.Errorf("parse server key: %s", err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("load server x509 key pair: %s", err)
+	}
+	caPool, err := createCertPool(c.CAs)
+	if err != nil {
+		return nil, fmt.Errorf("create cert pool: %s", err)
+	}
+	return &tls.Config{
+		Certificates:             []tls.Certificate{cert},
+		ClientCAs:                caPool,
+		ClientAuth:               tls.RequireAndVerifyClientCert,
+		PreferServerCipherSuites: true,
+	}, nil
+}
+
+// ServerTLSConfig defines TLS termination for servers which are reached
+// without nginx in front of them.
+type ServerTLSConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Cert       Secret `yaml:"cert"`
+	Key        Secret `yaml:"key"`
+	Passphrase Secret `yaml:"passphrase"`
+
+	// ClientCAs enables mutual TLS. If set, clients must present certificates
+	// signed by one of ClientCAs. System CAs are not trusted for clients.
+	ClientCAs []Secret `yaml:"client_cas"`
+}
+
+// Build builds tls.Config for a server. Returns nil if TLS is disabled.
+func (c ServerTLSConfig) Build() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	if c.Cert.Path == "" || c.Key.Path == "" {
+		return nil, errors.New("cert and key required")
+	}
+	certPEM, err := parseCert(c.Cert.Path)
+	if err != nil {
+		return nil, fmt.Errorf("parse cert: %s", err)
+	}
+	keyPEM, err := parseKey(c.Key.Path, c.Passphrase.Path)
+	if err != nil {
+		return nil, fmt.Errorf("parse key: %s", err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("load x509 key pair: %s", err)
+	}
+	config := &tls.Config{
+		Certificates:             []tls.Certificate{cert},
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+	}
+	if len(c.ClientCAs) > 0 {
+		pems, err := concatSecrets(c.ClientCAs)
+		if err != nil {
+			return nil, fmt.Errorf("concat client cas: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if ok := pool.AppendCertsFromPEM(pems); !ok {
+			return nil, errors.New("no certs found in client cas")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// ClientTLSConfig defines TLS for connections to servers outside of Kraken,
+// e.g. storage backends signed by private CAs or which require client
+// certificates.
+type ClientTLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// CAs verify servers in addition to the system CAs.
+	CAs []Secret `yaml:"cas"`
+
+	// Client is presented to servers which require mutual TLS.
+	Client X509Pair `yaml:"client"`
+
+	// ServerName overrides the name servers are verified against, which
+	// otherwise is the host being connected to.
+	ServerName string `yaml:"server_name"`
+}
+
+// Build builds tls.Config for a client. Returns nil if TLS is disabled.
+func (c ClientTLSConfig) Build() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	config := &TLSConfig{Name: c.ServerName, CAs: c.CAs}
+	if c.Client.Cert.Path != "" {
+		config.Client = X509Pair{
+			Cert:       c.Client.Cert,
+			Key:        c.Client.Key,
+			Passphrase: c.Client.Passphrase,
+		}
+	}
+	return config.BuildClient()
+}
+
 // WriteCABundle writes a list of CA to a writer.
 func (c *TLSConfig) WriteCABundle(w io.Writer) error {
 	pems, err := concatSecrets(c.CAs)
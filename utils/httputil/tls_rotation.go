@@ -0,0 +1,228 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package httputil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// certMaterial is a snapshot of client TLS material loaded from disk.
+type certMaterial struct {
+	fingerprint [sha256.Size]byte
+	cert        *tls.Certificate
+	roots       *x509.CertPool
+}
+
+// certRotator periodically reloads client TLS material from disk. After a
+// rotation, the previous cert and CAs remain usable for an overlap window, such
+// that peers which have not picked up the new certs yet can still be reached.
+// Since every handshake reads the current material, in-flight connections are
+// left untouched and new connections pick up new certs lazily.
+type certRotator struct {
+	name    string
+	client  X509Pair
+	cas     []Secret
+	overlap time.Duration
+	clk     clock.Clock
+
+	mu        sync.RWMutex
+	current   *certMaterial
+	previous  *certMaterial
+	rotatedAt time.Time
+}
+
+func newCertRotator(c *TLSConfig, clk clock.Clock) (*certRotator, error) {
+	r := &certRotator{
+		name:    c.Name,
+		client:  c.Client,
+		cas:     c.CAs,
+		overlap: c.RotationOverlap,
+		clk:     clk,
+	}
+	m, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.current = m
+	return r, nil
+}
+
+func (r *certRotator) load() (*certMaterial, error) {
+	var raw bytes.Buffer
+	m := &certMaterial{}
+	if len(r.cas) > 0 {
+		pems, err := concatSecrets(r.cas)
+		if err != nil {
+			return nil, fmt.Errorf("concat secrets: %s", err)
+		}
+		raw.Write(pems)
+		m.roots, err = createCertPool(r.cas)
+		if err != nil {
+			return nil, fmt.Errorf("create cert pool: %s", err)
+		}
+	}
+	if r.client.Cert.Path != "" {
+		certPEM, err := parseCert(r.client.Cert.Path)
+		if err != nil {
+			return nil, fmt.Errorf("parse client cert: %s", err)
+		}
+		keyPEM, err := parseKey(r.client.Key.Path, r.client.Passphrase.Path)
+		if err != nil {
+			return nil, fmt.Errorf("parse client key: %s", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("load client x509 key pair: %s", err)
+		}
+		raw.Write(certPEM)
+		raw.Write(keyPEM)
+		m.cert = &cert
+	}
+	m.fingerprint = sha256.Sum256(raw.Bytes())
+	return m, nil
+}
+
+// reload reloads TLS material from disk, rotating if it has changed. Returns
+// whether a rotation happened.
+func (r *certRotator) reload() (bool, error) {
+	m, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m.fingerprint == r.current.fingerprint {
+		return false, nil
+	}
+	r.previous = r.current
+	r.current = m
+	r.rotatedAt = r.clk.Now()
+	return true, nil
+}
+
+func (r *certRotator) run(interval time.Duration) {
+	for range r.clk.Tick(interval) {
+		rotated, err := r.reload()
+		if err != nil {
+			// Keep using the current certs until the new ones are readable,
+			// e.g. when cert and key are being replaced non-atomically.
+			log.Errorf("Error reloading tls certs: %s", err)
+			continue
+		}
+		if rotated {
+			log.Infof("Rotated tls certs, previous certs are accepted for %s", r.overlap)
+		}
+	}
+}
+
+// material returns the current material, and the previous material if still
+// within the overlap window.
+func (r *certRotator) material() (current, previous *certMaterial) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.previous != nil && r.clk.Now().Sub(r.rotatedAt) < r.overlap {
+		return r.current, r.previous
+	}
+	return r.current, nil
+}
+
+// getClientCertificate presents the current client cert, unless the server
+// only accepts the previous one during the overlap window.
+func (r *certRotator) getClientCertificate(
+	cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+
+	current, previous := r.material()
+	if current.cert == nil {
+		return &tls.Certificate{}, nil
+	}
+	if previous != nil && previous.cert != nil &&
+		cri.SupportsCertificate(current.cert) != nil &&
+		cri.SupportsCertificate(previous.cert) == nil {
+		return previous.cert, nil
+	}
+	return current.cert, nil
+}
+
+// verifyPeerCertificate verifies server certs against the current CAs, and the
+// previous CAs during the overlap window.
+func (r *certRotator) verifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no server certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("parse certificate: %s", err)
+		}
+		certs[i] = cert
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	current, previous := r.material()
+	opts := x509.VerifyOptions{
+		DNSName:       r.name,
+		Intermediates: intermediates,
+		Roots:         current.roots,
+	}
+	_, err := certs[0].Verify(opts)
+	if err != nil && previous != nil {
+		opts.Roots = previous.roots
+		if _, perr := certs[0].Verify(opts); perr == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// buildRotatingClient builds a tls.Config whose certs are reloaded every
+// ReloadInterval.
+func (c *TLSConfig) buildRotatingClient() (*tls.Config, error) {
+	if c.Name == "" {
+		return nil, errors.New("name is required to reload certs")
+	}
+	if c.RotationOverlap == 0 {
+		c.RotationOverlap = time.Hour
+	}
+	r, err := newCertRotator(c, clock.New())
+	if err != nil {
+		return nil, err
+	}
+	go r.run(c.ReloadInterval)
+
+	return &tls.Config{
+		ServerName:               c.Name,
+		PreferServerCipherSuites: true,
+		GetClientCertificate:     r.getClientCertificate,
+		// Verification is done by VerifyPeerCertificate instead, which
+		// accepts both the current and previous CAs during rotation.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: r.verifyPeerCertificate,
+	}, nil
+}
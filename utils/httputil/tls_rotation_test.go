@@ -0,0 +1,182 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package httputil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// rotateCerts overwrites the CA and client cert files of config with a new CA
+// and a client cert signed by it, returning the new CA.
+func rotateCerts(t *testing.T, config *TLSConfig) (caPEM, caKeyPEM, caSecret []byte) {
+	require := require.New(t)
+
+	caPEM, caKeyPEM, caSecret = genKeyPair(t, nil, nil, nil)
+	certPEM, keyPEM, secret := genKeyPair(t, caPEM, caKeyPEM, caSecret)
+
+	require.NoError(ioutil.WriteFile(config.CAs[0].Path, caPEM, 0644))
+	require.NoError(ioutil.WriteFile(config.Client.Cert.Path, certPEM, 0644))
+	require.NoError(ioutil.WriteFile(config.Client.Key.Path, keyPEM, 0644))
+	require.NoError(ioutil.WriteFile(config.Client.Passphrase.Path, secret, 0644))
+
+	return caPEM, caKeyPEM, caSecret
+}
+
+func derBytes(t *testing.T, certPEM []byte) []byte {
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+	return block.Bytes
+}
+
+func subject(t *testing.T, certPEM []byte) []byte {
+	cert, err := x509.ParseCertificate(derBytes(t, certPEM))
+	require.NoError(t, err)
+	return cert.RawSubject
+}
+
+func TestCertRotatorReloadsClientCert(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := genCerts(t)
+	defer cleanup()
+	config.CAs = config.CAs[:1]
+	config.RotationOverlap = time.Hour
+
+	clk := clock.NewMock()
+	r, err := newCertRotator(config, clk)
+	require.NoError(err)
+
+	original, err := r.getClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(err)
+
+	rotated, err := r.reload()
+	require.NoError(err)
+	require.False(rotated)
+
+	oldCAPEM, err := ioutil.ReadFile(config.CAs[0].Path)
+	require.NoError(err)
+	newCAPEM, _, _ := rotateCerts(t, config)
+
+	rotated, err = r.reload()
+	require.NoError(err)
+	require.True(rotated)
+
+	current, err := r.getClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(err)
+	require.NotEqual(original.Certificate, current.Certificate)
+
+	// Servers which only trust the old CA still get the old cert during the
+	// overlap window.
+	oldOnly := &tls.CertificateRequestInfo{
+		AcceptableCAs:    [][]byte{subject(t, oldCAPEM)},
+		Version:          tls.VersionTLS12,
+		SignatureSchemes: []tls.SignatureScheme{tls.PKCS1WithSHA256},
+	}
+	cert, err := r.getClientCertificate(oldOnly)
+	require.NoError(err)
+	require.Equal(original.Certificate, cert.Certificate)
+
+	newOnly := &tls.CertificateRequestInfo{
+		AcceptableCAs:    [][]byte{subject(t, newCAPEM)},
+		Version:          tls.VersionTLS12,
+		SignatureSchemes: []tls.SignatureScheme{tls.PKCS1WithSHA256},
+	}
+	cert, err = r.getClientCertificate(newOnly)
+	require.NoError(err)
+	require.Equal(current.Certificate, cert.Certificate)
+
+	clk.Add(time.Hour)
+
+	cert, err = r.getClientCertificate(oldOnly)
+	require.NoError(err)
+	require.Equal(current.Certificate, cert.Certificate)
+}
+
+func TestCertRotatorVerifiesBothCAsDuringOverlap(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := genCerts(t)
+	defer cleanup()
+	config.CAs = config.CAs[:1]
+	config.RotationOverlap = time.Hour
+
+	oldCAPEM, err := ioutil.ReadFile(config.CAs[0].Path)
+	require.NoError(err)
+
+	clk := clock.NewMock()
+	r, err := newCertRotator(config, clk)
+	require.NoError(err)
+
+	// genCerts uses the server cert as root CA, so a server cert signed by the
+	// old CA must be verifiable.
+	oldServerPEM := oldCAPEM
+	require.NoError(r.verifyPeerCertificate([][]byte{derBytes(t, oldServerPEM)}, nil))
+
+	newCAPEM, newCAKeyPEM, newCASecret := rotateCerts(t, config)
+	newServerPEM, _, _ := genKeyPair(t, newCAPEM, newCAKeyPEM, newCASecret)
+
+	_, err = r.reload()
+	require.NoError(err)
+
+	require.NoError(r.verifyPeerCertificate([][]byte{derBytes(t, oldServerPEM)}, nil))
+	require.NoError(r.verifyPeerCertificate([][]byte{derBytes(t, newServerPEM)}, nil))
+
+	clk.Add(time.Hour)
+
+	require.Error(r.verifyPeerCertificate([][]byte{derBytes(t, oldServerPEM)}, nil))
+	require.NoError(r.verifyPeerCertificate([][]byte{derBytes(t, newServerPEM)}, nil))
+}
+
+func TestCertRotatorKeepsCurrentCertsOnReloadError(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := genCerts(t)
+	defer cleanup()
+	config.CAs = config.CAs[:1]
+
+	r, err := newCertRotator(config, clock.NewMock())
+	require.NoError(err)
+
+	original, err := r.getClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(err)
+
+	require.NoError(ioutil.WriteFile(config.Client.Key.Path, []byte("partial"), 0644))
+
+	_, err = r.reload()
+	require.Error(err)
+
+	cert, err := r.getClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(err)
+	require.Equal(original.Certificate, cert.Certificate)
+}
+
+func TestTLSClientReloadRequiresName(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := genCerts(t)
+	defer cleanup()
+	config.Name = ""
+	config.ReloadInterval = time.Minute
+
+	_, err := config.BuildClient()
+	require.Error(err)
+}
@@ -45,7 +45,10 @@ func genKeyPair(t *testing.T, caPEM, caKeyPEM, caSercret []byte) (certPEM, keyPE
 		Subject: pkix.Name{
 			Organization: []string{"kraken"},
 			CommonName:   "kraken",
+			// Unique per cert, such that issuers of different CAs can be told apart.
+			OrganizationalUnit: []string{string(randutil.Text(8))},
 		},
+		DNSNames:  []string{"kraken"},
 		NotBefore: time.Now().Add(-5 * time.Minute),
 		NotAfter:  time.Now().Add(time.Hour * 24 * 180),
 
@@ -177,6 +180,48 @@ func TestTLSClientDisabled(t *testing.T) {
 	require.Nil(tls)
 }
 
+func TestTLSServerDisabled(t *testing.T) {
+	require := require.New(t)
+	c := TLSConfig{}
+	c.Server.Disabled = true
+	tls, err := c.BuildServer()
+	require.NoError(err)
+	require.Nil(tls)
+}
+
+func TestTLSServerRequiresCAs(t *testing.T) {
+	require := require.New(t)
+	c := TLSConfig{}
+	c.Server.Cert.Path = "/etc/kraken/server.crt"
+	_, err := c.BuildServer()
+	require.Error(err)
+}
+
+func TestTLSServerAcceptsClients(t *testing.T) {
+	require := require.New(t)
+
+	c, cleanup := genCerts(t)
+	defer cleanup()
+
+	// The root CA doubles as the server cert.
+	certPEM, keyPEM, passphrase := genKeyPair(t, nil, nil, nil)
+	certPath, cleanupCert := testutil.TempFile(certPEM)
+	defer cleanupCert()
+	keyPath, cleanupKey := testutil.TempFile(keyPEM)
+	defer cleanupKey()
+	passphrasePath, cleanupPassphrase := testutil.TempFile(passphrase)
+	defer cleanupPassphrase()
+	c.Server.Cert.Path = certPath
+	c.Server.Key.Path = keyPath
+	c.Server.Passphrase.Path = passphrasePath
+
+	serverTLS, err := c.BuildServer()
+	require.NoError(err)
+	require.Equal(tls.RequireAndVerifyClientCert, serverTLS.ClientAuth)
+	require.Len(serverTLS.Certificates, 1)
+	require.NotNil(serverTLS.ClientCAs)
+}
+
 func TestTLSClientSuccess(t *testing.T) {
 	t.Skip("TODO https://github.com/uber/kraken/issues/230")
 
@@ -253,3 +298,153 @@ func TestTLSClientFallbackError(t *testing.T) {
 	_, err = Get("https://some-non-existent-addr/", SendTLS(tls))
 	require.Error(err)
 }
+
+// genSignedPair writes a key pair signed by the given CA to temp files.
+func genSignedPair(t *testing.T, caPEM, caKeyPEM, caSecret []byte) (X509Pair, func()) {
+	var cleanup testutil.Cleanup
+	defer cleanup.Recover()
+
+	certPEM, keyPEM, secret := genKeyPair(t, caPEM, caKeyPEM, caSecret)
+	certPath, c := testutil.TempFile(certPEM)
+	cleanup.Add(c)
+	keyPath, c := testutil.TempFile(keyPEM)
+	cleanup.Add(c)
+	secretPath, c := testutil.TempFile(secret)
+	cleanup.Add(c)
+
+	return X509Pair{
+		Cert:       Secret{certPath},
+		Key:        Secret{keyPath},
+		Passphrase: Secret{secretPath},
+	}, cleanup.Run
+}
+
+// genServerTLS returns server and client configs signed by the same CA.
+func genServerTLS(t *testing.T) (ServerTLSConfig, ClientTLSConfig, func()) {
+	var cleanup testutil.Cleanup
+	defer cleanup.Recover()
+
+	caPEM, caKeyPEM, caSecret := genKeyPair(t, nil, nil, nil)
+	caPath, c := testutil.TempFile(caPEM)
+	cleanup.Add(c)
+
+	server, c := genSignedPair(t, caPEM, caKeyPEM, caSecret)
+	cleanup.Add(c)
+	client, c := genSignedPair(t, caPEM, caKeyPEM, caSecret)
+	cleanup.Add(c)
+
+	serverConfig := ServerTLSConfig{
+		Enabled:    true,
+		Cert:       server.Cert,
+		Key:        server.Key,
+		Passphrase: server.Passphrase,
+		ClientCAs:  []Secret{{caPath}},
+	}
+	clientConfig := ClientTLSConfig{
+		Enabled:    true,
+		CAs:        []Secret{{caPath}},
+		Client:     client,
+		ServerName: "kraken",
+	}
+	return serverConfig, clientConfig, cleanup.Run
+}
+
+func startServerTLS(t *testing.T, config ServerTLSConfig) (addr string, stop func()) {
+	require := require.New(t)
+
+	serverTLS, err := config.Build()
+	require.NoError(err)
+
+	l, err := tls.Listen("tcp", "localhost:0", serverTLS)
+	require.NoError(err)
+	r := chi.NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "OK")
+	})
+	go http.Serve(l, r)
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func TestServerTLSDisabled(t *testing.T) {
+	require := require.New(t)
+
+	serverTLS, err := ServerTLSConfig{}.Build()
+	require.NoError(err)
+	require.Nil(serverTLS)
+}
+
+func TestServerTLSRequiresCertAndKey(t *testing.T) {
+	require := require.New(t)
+
+	_, err := ServerTLSConfig{Enabled: true, Cert: Secret{"/etc/kraken/server.crt"}}.Build()
+	require.Error(err)
+}
+
+func TestServerTLSVerifiesClients(t *testing.T) {
+	require := require.New(t)
+
+	serverConfig, clientConfig, cleanup := genServerTLS(t)
+	defer cleanup()
+
+	addr, stop := startServerTLS(t, serverConfig)
+	defer stop()
+
+	clientTLS, err := clientConfig.Build()
+	require.NoError(err)
+
+	_, err = Get("http://"+addr+"/", SendTLSNoFallback(clientTLS))
+	require.NoError(err)
+
+	// Clients without certificates are rejected, and not retried over http.
+	clientConfig.Client = X509Pair{}
+	clientTLS, err = clientConfig.Build()
+	require.NoError(err)
+
+	_, err = Get("http://"+addr+"/", SendTLSNoFallback(clientTLS))
+	require.True(IsNetworkError(err))
+}
+
+func TestServerTLSWithoutClientCAsAcceptsAnyClient(t *testing.T) {
+	require := require.New(t)
+
+	serverConfig, clientConfig, cleanup := genServerTLS(t)
+	defer cleanup()
+
+	serverConfig.ClientCAs = nil
+	addr, stop := startServerTLS(t, serverConfig)
+	defer stop()
+
+	clientConfig.Client = X509Pair{}
+	clientTLS, err := clientConfig.Build()
+	require.NoError(err)
+
+	_, err = Get("http://"+addr+"/", SendTLSNoFallback(clientTLS))
+	require.NoError(err)
+}
+
+func TestClientTLSDisabled(t *testing.T) {
+	require := require.New(t)
+
+	clientTLS, err := ClientTLSConfig{}.Build()
+	require.NoError(err)
+	require.Nil(clientTLS)
+}
+
+func TestNewTransport(t *testing.T) {
+	require := require.New(t)
+
+	serverConfig, clientConfig, cleanup := genServerTLS(t)
+	defer cleanup()
+
+	addr, stop := startServerTLS(t, serverConfig)
+	defer stop()
+
+	clientTLS, err := clientConfig.Build()
+	require.NoError(err)
+
+	client := &http.Client{Transport: NewTransport(clientTLS, nil)}
+	resp, err := client.Get("https://" + addr + "/")
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+}
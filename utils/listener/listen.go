@@ -14,6 +14,7 @@
 package listener
 
 import (
+	"crypto/tls"
 	"net"
 	"net/http"
 )
@@ -27,3 +28,16 @@ func Serve(config Config, h http.Handler) error {
 	}
 	return http.Serve(l, h)
 }
+
+// ServeTLS serves h on a listener configured by config, terminating TLS with
+// tlsConfig. Serves plaintext if tlsConfig is nil.
+func ServeTLS(config Config, h http.Handler, tlsConfig *tls.Config) error {
+	if tlsConfig == nil {
+		return Serve(config, h)
+	}
+	l, err := net.Listen(config.Net, config.Addr)
+	if err != nil {
+		return err
+	}
+	return http.Serve(tls.NewListener(l, tlsConfig), h)
+}
@@ -18,12 +18,24 @@ package log
 // and hides out some initialization details
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 var (
-	_default *zap.SugaredLogger
+	// _default holds the global *zap.SugaredLogger. It is replaced at runtime
+	// when reconfigured, so it is read without holding _configMu.
+	_default atomic.Value
+
+	// _config is the config _default was built from, if any, from which it is
+	// rebuilt when reconfigured. Writes of _default are made with _configMu
+	// held, such that _default always matches _config.
+	_config   *zap.Config
+	_configMu sync.Mutex
 )
 
 // configure a default logger
@@ -46,18 +58,71 @@ func ConfigureLogger(zapConfig zap.Config) *zap.SugaredLogger {
 	// Skip this wrapper in a call stack.
 	logger = logger.WithOptions(zap.AddCallerSkip(1))
 
-	_default = logger.Sugar()
-	return _default
+	sugar := logger.Sugar()
+
+	_configMu.Lock()
+	_config = &zapConfig
+	_default.Store(sugar)
+	_configMu.Unlock()
+
+	return sugar
 }
 
-// SetGlobalLogger sets the global logger.
+// SetGlobalLogger sets the global logger. Loggers set this way cannot be
+// reconfigured.
 func SetGlobalLogger(l *zap.SugaredLogger) {
-	_default = l
+	_configMu.Lock()
+	_config = nil
+	_default.Store(l)
+	_configMu.Unlock()
+}
+
+// Settings are the settings of the global logger which can be changed at
+// runtime.
+type Settings struct {
+	Level zapcore.Level `json:"level"`
+
+	// Sampling is nil if sampling is disabled.
+	Sampling *zap.SamplingConfig `json:"sampling"`
+}
+
+// GetSettings returns the settings of the global logger. Returns false if the
+// global logger was not built by ConfigureLogger.
+func GetSettings() (Settings, bool) {
+	_configMu.Lock()
+	defer _configMu.Unlock()
+
+	if _config == nil || _config.Level == (zap.AtomicLevel{}) {
+		return Settings{}, false
+	}
+	return Settings{Level: _config.Level.Level(), Sampling: _config.Sampling}, true
+}
+
+// Reconfigure rebuilds the global logger with s. Loggers previously derived
+// from the global logger, e.g. by With, share its level but keep their
+// sampling.
+func Reconfigure(s Settings) error {
+	_configMu.Lock()
+	defer _configMu.Unlock()
+
+	if _config == nil || _config.Level == (zap.AtomicLevel{}) {
+		return errors.New("global logger was not built from config")
+	}
+	c := *_config
+	c.Sampling = s.Sampling
+	logger, err := c.Build()
+	if err != nil {
+		return err
+	}
+	c.Level.SetLevel(s.Level)
+	_config = &c
+	_default.Store(logger.WithOptions(zap.AddCallerSkip(1)).Sugar())
+	return nil
 }
 
 // Default returns the default global logger.
 func Default() *zap.SugaredLogger {
-	return _default
+	return _default.Load().(*zap.SugaredLogger)
 }
 
 // Debug uses fmt.Sprint to construct and log a message.
@@ -124,7 +189,8 @@ func Fatalf(template string, args ...interface{}) {
 // pairs are treated as they are in With.
 //
 // When debug-level logging is disabled, this is much faster than
-//  s.With(keysAndValues).Debug(msg)
+//
+//	s.With(keysAndValues).Debug(msg)
 func Debugw(msg string, keysAndValues ...interface{}) {
 	Default().Debugw(msg, keysAndValues...)
 }
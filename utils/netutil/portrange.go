@@ -0,0 +1,75 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netutil
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	Min int
+	Max int
+}
+
+// ParsePortRange parses a port range of the form "min-max", or a single port.
+func ParsePortRange(s string) (PortRange, error) {
+	parts := strings.SplitN(s, "-", 2)
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port %q", parts[0])
+	}
+	max := min
+	if len(parts) == 2 {
+		max, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return PortRange{}, fmt.Errorf("invalid port %q", parts[1])
+		}
+	}
+	if min < 1 || max > 65535 || min > max {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return PortRange{min, max}, nil
+}
+
+// Contains returns whether port is within r.
+func (r PortRange) Contains(port int) bool {
+	return port >= r.Min && port <= r.Max
+}
+
+func (r PortRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// ListenInRange binds a tcp listener to a random port within r, trying up to
+// attempts ports. The listener is returned bound, rather than just its port,
+// such that no other process can take the port before the caller serves on it.
+func ListenInRange(r PortRange, attempts int) (net.Listener, error) {
+	for i := 0; i < attempts; i++ {
+		port := r.Min + rand.Intn(r.Max-r.Min+1)
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			continue
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("no free port in %s after %d attempts", r, attempts)
+}
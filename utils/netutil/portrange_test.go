@@ -0,0 +1,81 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package netutil
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected PortRange
+	}{
+		{"6881", PortRange{6881, 6881}},
+		{"6881-6889", PortRange{6881, 6889}},
+		{" 1 - 65535 ", PortRange{1, 65535}},
+	}
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			r, err := ParsePortRange(test.s)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, r)
+		})
+	}
+}
+
+func TestParsePortRangeErrors(t *testing.T) {
+	for _, s := range []string{"", "a", "1-b", "0", "0-10", "10-1", "1-65536"} {
+		t.Run(s, func(t *testing.T) {
+			_, err := ParsePortRange(s)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPortRangeContains(t *testing.T) {
+	r := PortRange{100, 200}
+	require.False(t, r.Contains(99))
+	require.True(t, r.Contains(100))
+	require.True(t, r.Contains(200))
+	require.False(t, r.Contains(201))
+}
+
+func TestListenInRange(t *testing.T) {
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(err)
+	defer l.Close()
+	used := l.Addr().(*net.TCPAddr).Port
+
+	// The only port in range is taken.
+	_, err = ListenInRange(PortRange{used, used}, 3)
+	require.Error(err)
+
+	l.Close()
+	bound, err := ListenInRange(PortRange{used, used}, 3)
+	require.NoError(err)
+	defer bound.Close()
+	require.Equal(used, bound.Addr().(*net.TCPAddr).Port)
+	require.Equal(fmt.Sprint(used), PortRange{used, used}.String())
+
+	// The port stays bound until the listener is closed.
+	_, err = net.Listen("tcp", fmt.Sprintf(":%d", used))
+	require.Error(err)
+}
@@ -19,6 +19,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"syscall"
 )
 
 // IsEmpty returns true if directory dir is empty.
@@ -45,6 +46,9 @@ func ReadLines(f *os.File) ([]string, error) {
 		l := s.Text()
 		lines = append(lines, l)
 	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("scan %s: %s", f.Name(), err)
+	}
 	return lines, nil
 }
 
@@ -60,9 +64,24 @@ func EnsureFilePresent(filepath string, perm os.FileMode) error {
 		if err != nil {
 			return fmt.Errorf("create: %s", err)
 		}
-		f.Close()
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("close: %s", err)
+		}
 	} else if err != nil {
 		return fmt.Errorf("stat: %s", err)
 	}
 	return nil
 }
+
+// DiskUtilization returns the fraction of the filesystem containing dir which
+// is in use.
+func DiskUtilization(dir string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("statfs: %s", err)
+	}
+	if st.Blocks == 0 {
+		return 0, nil
+	}
+	return float64(st.Blocks-st.Bavail) / float64(st.Blocks), nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package requestid carries request ids through request contexts, such that
+// logs, responses and errors of a single request can be tied together.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header is the HTTP header request ids are sent and returned in.
+const Header = "X-Request-ID"
+
+// _maxLen bounds the length of request ids accepted from callers, since they
+// are copied into logs and responses.
+const _maxLen = 128
+
+type contextKey struct{}
+
+// New returns a new random request id.
+func New() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id carried by ctx, or "" if none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// LogFields returns the log fields identifying the request of ctx, or nil if
+// ctx carries no request id.
+func LogFields(ctx context.Context) []interface{} {
+	id := FromContext(ctx)
+	if id == "" {
+		return nil
+	}
+	return []interface{}{"request_id", id}
+}
+
+// FromRequest returns the request id sent by the caller of r, or a new id if
+// the caller sent none, or one which is unsafe to log.
+func FromRequest(r *http.Request) string {
+	id := r.Header.Get(Header)
+	if id == "" || len(id) > _maxLen {
+		return New()
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return New()
+		}
+	}
+	return id
+}
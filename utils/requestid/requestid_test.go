@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	require.Equal("", FromContext(ctx))
+	require.Nil(LogFields(ctx))
+
+	ctx = NewContext(ctx, "abc")
+	require.Equal("abc", FromContext(ctx))
+	require.Equal([]interface{}{"request_id", "abc"}, LogFields(ctx))
+}
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		desc     string
+		header   string
+		expected string
+	}{
+		{"propagated", "abc-123", "abc-123"},
+		{"missing", "", ""},
+		{"too long", strings.Repeat("a", _maxLen+1), ""},
+		{"unprintable", "abc\ndef", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			r, err := http.NewRequest("GET", "/", nil)
+			require.NoError(err)
+			if test.header != "" {
+				r.Header.Set(Header, test.header)
+			}
+			id := FromRequest(r)
+			if test.expected != "" {
+				require.Equal(test.expected, id)
+			} else {
+				require.Len(id, 16)
+				require.NotEqual(test.header, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package syncutil
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// ShardedLocks hashes keys onto a fixed number of locks, such that operations
+// on different keys rarely contend without allocating a lock per key.
+type ShardedLocks []sync.RWMutex
+
+// NewShardedLocks returns an initialized ShardedLocks with n shards. n is
+// rounded up to 1.
+func NewShardedLocks(n int) ShardedLocks {
+	if n < 1 {
+		n = 1
+	}
+	return ShardedLocks(make([]sync.RWMutex, n))
+}
+
+// Len returns the number of shards.
+func (l ShardedLocks) Len() int {
+	return len(l)
+}
+
+// Shard returns the shard index of key.
+func (l ShardedLocks) Shard(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(len(l)))
+}
+
+// Get returns the lock of shard i.
+func (l ShardedLocks) Get(i int) *sync.RWMutex {
+	return &l[i]
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package syncutil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedLocksShardIsStable(t *testing.T) {
+	require := require.New(t)
+
+	l := NewShardedLocks(16)
+	require.Equal(16, l.Len())
+
+	for i := 0; i < 100; i++ {
+		k := []byte(fmt.Sprintf("key-%d", i))
+		require.Equal(l.Shard(k), l.Shard(k))
+		require.True(l.Shard(k) < l.Len())
+	}
+}
+
+func TestShardedLocksSpreadsKeys(t *testing.T) {
+	l := NewShardedLocks(16)
+
+	shards := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		shards[l.Shard([]byte(fmt.Sprintf("key-%d", i)))] = true
+	}
+	require.Len(t, shards, 16)
+}
+
+func TestShardedLocksAtLeastOneShard(t *testing.T) {
+	l := NewShardedLocks(0)
+	require.Equal(t, 1, l.Len())
+	require.Equal(t, 0, l.Shard([]byte("key")))
+}